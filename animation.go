@@ -0,0 +1,102 @@
+package rmbg
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+const (
+	// DefaultMaxFrames is the frame limit of animations when none is given
+	DefaultMaxFrames = 1000
+	// DefaultGIFThreshold is the mask value at or above which GIF pixels stay
+	// opaque when none is given
+	DefaultGIFThreshold = 128
+)
+
+// ErrTooManyFrames is returned for animations with more frames than allowed
+var ErrTooManyFrames = errors.New("animation exceeds frame limit")
+
+// AnimationOptions configures ProcessGIF and ProcessAPNG
+type AnimationOptions struct {
+	// MaxPixels rejects animations whose canvas is larger (default:
+	// DefaultMaxPixels, < 0 disables)
+	MaxPixels int
+	// MaxFrames rejects animations with more frames (default:
+	// DefaultMaxFrames, < 0 disables)
+	MaxFrames int
+	// Smoothing is the weight of the previous frames in each mask, see
+	// MaskSmoother (default: DefaultSmoothing)
+	Smoothing *float64
+	// Threshold is the mask value at or above which a GIF pixel stays opaque,
+	// since GIF transparency is all or nothing (default: DefaultGIFThreshold)
+	Threshold uint8
+	// Background replaces the background; nil keeps it transparent
+	Background color.Color
+}
+
+// limits returns the pixel and frame limits of opts, 0 meaning none
+func (opts *AnimationOptions) limits() (maxPixels, maxFrames int) {
+	maxPixels, maxFrames = opts.MaxPixels, opts.MaxFrames
+	if maxPixels == 0 {
+		maxPixels = DefaultMaxPixels
+	}
+	if maxFrames == 0 {
+		maxFrames = DefaultMaxFrames
+	}
+	return max(maxPixels, 0), max(maxFrames, 0)
+}
+
+// check enforces the limits of opts on a canvas and frame count
+func (opts *AnimationOptions) check(width, height, frames int) error {
+	maxPixels, maxFrames := opts.limits()
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("%w: dimensions %dx%d", ErrInvalidImage, width, height)
+	}
+	if maxPixels > 0 && int64(width)*int64(height) > int64(maxPixels) {
+		return fmt.Errorf("%w: %dx%d, limit %d pixels", ErrImageTooLarge, width, height, maxPixels)
+	}
+	if maxFrames > 0 && frames > maxFrames {
+		return fmt.Errorf("%w: %d frames, limit %d", ErrTooManyFrames, frames, maxFrames)
+	}
+	return nil
+}
+
+// frameProcessor removes the background of consecutive frames of one
+// animation with smoothed masks
+type frameProcessor struct {
+	r        *RemBG
+	smoother *MaskSmoother
+	bg       color.Color
+}
+
+func (r *RemBG) newFrameProcessor(opts *AnimationOptions) (*frameProcessor, error) {
+	smoothing := DefaultSmoothing
+	if opts.Smoothing != nil {
+		smoothing = *opts.Smoothing
+	}
+	smoother, err := NewMaskSmoother(smoothing)
+	if err != nil {
+		return nil, err
+	}
+	return &frameProcessor{r: r, smoother: smoother, bg: opts.Background}, nil
+}
+
+// frame returns the cutout of a full canvas frame and its smoothed mask
+func (p *frameProcessor) frame(img image.Image) (image.Image, *image.Gray, error) {
+	res, _, err := p.r.process(img)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Release()
+
+	mask := image.NewGray(res.Mask.Rect)
+	draw.Draw(mask, mask.Rect, res.Mask, res.Mask.Rect.Min, draw.Src)
+	p.smoother.Apply(mask)
+	if p.bg == nil {
+		return cutout(img, mask), mask, nil
+	}
+	return composite(img, mask, p.bg), mask, nil
+}
@@ -0,0 +1,213 @@
+package rmbg
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+)
+
+// maskedEngine returns an engine predicting masks[i] for imgs[i]
+func maskedEngine(imgs []image.Image, masks []*image.Gray) *RemBG {
+	r := cachedEngine()
+	r.cache = newMaskCache(len(imgs) + 1)
+	for i, img := range imgs {
+		r.cache.put(hashImage(img, r.model.cacheSalt()), &prediction{mask: masks[i]})
+	}
+	return r
+}
+
+// halfMask returns an 8x8 mask with the left half at left and the right half
+// at right
+func halfMask(left, right uint8) *image.Gray {
+	mask := image.NewGray(image.Rect(0, 0, 8, 8))
+	for i := range mask.Pix {
+		if i%8 < 4 {
+			mask.Pix[i] = left
+		} else {
+			mask.Pix[i] = right
+		}
+	}
+	return mask
+}
+
+func TestProcessGIF(t *testing.T) {
+	red, green := color.RGBA{R: 255, A: 255}, color.RGBA{G: 255, A: 255}
+	pal := color.Palette{red, green}
+	first := image.NewPaletted(image.Rect(0, 0, 8, 8), pal)
+	// The second frame only covers the left half
+	second := image.NewPaletted(image.Rect(0, 0, 4, 8), pal)
+	for i := range second.Pix {
+		second.Pix[i] = 1
+	}
+	var in bytes.Buffer
+	err := gif.EncodeAll(&in, &gif.GIF{
+		Image:     []*image.Paletted{first, second},
+		Delay:     []int{10, 20},
+		LoopCount: 3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	canvas0 := solidImage(8, 8, color.NRGBA{R: 255, A: 255})
+	canvas1 := solidImage(8, 8, color.NRGBA{R: 255, A: 255})
+	for y := range 8 {
+		for x := range 4 {
+			canvas1.Set(x, y, green)
+		}
+	}
+	r := maskedEngine([]image.Image{canvas0, canvas1}, []*image.Gray{halfMask(0, 255), halfMask(255, 255)})
+
+	var out bytes.Buffer
+	if err := r.ProcessGIF(bytes.NewReader(in.Bytes()), &out, nil); err != nil {
+		t.Fatalf("ProcessGIF failed: %v", err)
+	}
+	g, err := gif.DecodeAll(&out)
+	if err != nil {
+		t.Fatalf("expected valid GIF, got %v", err)
+	}
+	if len(g.Image) != 2 || g.Delay[0] != 10 || g.Delay[1] != 20 || g.LoopCount != 3 {
+		t.Fatalf("expected 2 frames with delays [10 20] and 3 loops, got %d, %v, %d", len(g.Image), g.Delay, g.LoopCount)
+	}
+	if _, _, _, a := g.Image[0].At(1, 1).RGBA(); a != 0 {
+		t.Errorf("expected transparent background in frame 0, got alpha %d", a)
+	}
+	if c := color.RGBAModel.Convert(g.Image[0].At(6, 1)); c != red {
+		t.Errorf("expected red object in frame 0, got %v", c)
+	}
+	// Smoothing lifts the left half to 128, which stays opaque
+	if c := color.RGBAModel.Convert(g.Image[1].At(1, 1)); c != green {
+		t.Errorf("expected green in frame 1, got %v", c)
+	}
+
+	t.Run("Limits", func(t *testing.T) {
+		err := r.ProcessGIF(bytes.NewReader(in.Bytes()), &out, &AnimationOptions{MaxFrames: 1})
+		if !errors.Is(err, ErrTooManyFrames) {
+			t.Errorf("expected ErrTooManyFrames, got %v", err)
+		}
+		err = r.ProcessGIF(bytes.NewReader(in.Bytes()), &out, &AnimationOptions{MaxPixels: 10})
+		if !errors.Is(err, ErrImageTooLarge) {
+			t.Errorf("expected ErrImageTooLarge, got %v", err)
+		}
+		err = r.ProcessGIF(bytes.NewReader([]byte("GIF89a")), &out, nil)
+		if !errors.Is(err, ErrInvalidImage) {
+			t.Errorf("expected ErrInvalidImage, got %v", err)
+		}
+	})
+}
+
+func TestProcessAPNG(t *testing.T) {
+	red := solidImage(8, 8, color.NRGBA{R: 255, A: 255})
+	blue := solidImage(8, 8, color.NRGBA{B: 255, A: 255})
+	src := &apngImage{
+		width: 8, height: 8, plays: 2,
+		frames: []*apngFrame{{delayNum: 1, delayDen: 10}, {delayNum: 3, delayDen: 10}},
+	}
+	var in bytes.Buffer
+	if err := encodeAPNG(&in, []*image.NRGBA{red, blue}, src); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		a, err := decodeAPNG(in.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(a.frames) != 2 || a.plays != 2 || a.frames[1].delayNum != 3 {
+			t.Fatalf("expected 2 frames, 2 plays and delay 3, got %d, %d, %d", len(a.frames), a.plays, a.frames[1].delayNum)
+		}
+		img, err := a.decodeFrame(a.frames[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c := color.NRGBAModel.Convert(img.At(5, 5)); c != (color.NRGBA{B: 255, A: 255}) {
+			t.Errorf("expected blue frame, got %v", c)
+		}
+		// Other decoders show the first frame
+		if _, err := png.Decode(bytes.NewReader(in.Bytes())); err != nil {
+			t.Errorf("expected the default image to decode, got %v", err)
+		}
+	})
+
+	r := maskedEngine([]image.Image{red, blue}, []*image.Gray{halfMask(0, 255), halfMask(255, 255)})
+	var out bytes.Buffer
+	if err := r.ProcessAPNG(bytes.NewReader(in.Bytes()), &out, nil); err != nil {
+		t.Fatalf("ProcessAPNG failed: %v", err)
+	}
+	a, err := decodeAPNG(out.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.frames) != 2 || a.plays != 2 || a.frames[0].delayNum != 1 {
+		t.Fatalf("expected timing to be kept, got %d frames, %d plays, delay %d", len(a.frames), a.plays, a.frames[0].delayNum)
+	}
+	for i, expected := range []uint8{0, 128} {
+		img, err := a.decodeFrame(a.frames[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c := color.NRGBAModel.Convert(img.At(1, 1)).(color.NRGBA); c.A != expected {
+			t.Errorf("frame %d: expected smoothed alpha %d, got %d", i, expected, c.A)
+		}
+	}
+
+	t.Run("PlainPNG", func(t *testing.T) {
+		var plain bytes.Buffer
+		if err := png.Encode(&plain, red); err != nil {
+			t.Fatal(err)
+		}
+		out.Reset()
+		if err := r.ProcessAPNG(&plain, &out, nil); err != nil {
+			t.Fatalf("ProcessAPNG failed: %v", err)
+		}
+		a, err := decodeAPNG(out.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(a.frames) != 1 {
+			t.Errorf("expected 1 frame, got %d", len(a.frames))
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		corrupt := bytes.Clone(in.Bytes())
+		corrupt[20] ^= 0xff
+		if err := r.ProcessAPNG(bytes.NewReader(corrupt), &out, nil); !errors.Is(err, ErrInvalidImage) {
+			t.Errorf("expected ErrInvalidImage, got %v", err)
+		}
+	})
+}
+
+func TestMaskSmoother(t *testing.T) {
+	s, err := NewMaskSmoother(0.75)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, expected := range []uint8{200, 150, 113} {
+		mask := halfMask(0, 0)
+		if i == 0 {
+			mask = halfMask(200, 200)
+		}
+		s.Apply(mask)
+		if mask.Pix[0] != expected {
+			t.Errorf("step %d: expected %d, got %d", i, expected, mask.Pix[0])
+		}
+	}
+
+	s.Apply(image.NewGray(image.Rect(0, 0, 2, 2)))
+	mask := halfMask(80, 80)
+	s.Apply(mask)
+	if mask.Pix[0] != 80 {
+		t.Errorf("expected a size change to restart, got %d", mask.Pix[0])
+	}
+
+	for _, v := range []float64{-1, 1} {
+		if _, err := NewMaskSmoother(v); !errors.Is(err, ErrInvalidSmoothing) {
+			t.Errorf("%g: expected ErrInvalidSmoothing, got %v", v, err)
+		}
+	}
+}
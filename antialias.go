@@ -0,0 +1,67 @@
+package rmbg
+
+import (
+	"image"
+	"math"
+)
+
+// DefaultAntialiasWidth is the default Config.AntialiasWidth
+const DefaultAntialiasWidth = 1.0
+
+// antialiasUpsampleInto scales mask to the zero-based dst and anti-aliases
+// its boundary. The mask is interpolated bilinearly and binarized at half
+// level; each pixel then gets the coverage of the binarized shape, estimated
+// from its signed distance to the boundary, which is the interpolated value's
+// offset from half level over its gradient. The edge ramps over width pixels
+// instead of over a whole model pixel blurred by a box filter.
+func antialiasUpsampleInto(dst, mask *image.Gray, width float64) {
+	if width <= 0 {
+		width = DefaultAntialiasWidth
+	}
+	mb := mask.Bounds()
+	sw, sh := mb.Dx(), mb.Dy()
+	w, h := dst.Rect.Dx(), dst.Rect.Dy()
+	xRatio := float64(sw) / float64(w)
+	yRatio := float64(sh) / float64(h)
+	at := func(x, y int) float64 {
+		return float64(mask.Pix[y*mask.Stride+x]) / 255
+	}
+
+	parallelRows(h, func(start, end int) {
+		for y := start; y < end; y++ {
+			// Sample at pixel centers
+			sy := math.Max((float64(y)+0.5)*yRatio-0.5, 0)
+			y0 := min(int(sy), sh-1)
+			y1 := min(y0+1, sh-1)
+			ly := sy - float64(y0)
+			row := dst.Pix[y*dst.Stride:][:w]
+			for x := range row {
+				sx := math.Max((float64(x)+0.5)*xRatio-0.5, 0)
+				x0 := min(int(sx), sw-1)
+				x1 := min(x0+1, sw-1)
+				lx := sx - float64(x0)
+
+				p00, p10, p01, p11 := at(x0, y0), at(x1, y0), at(x0, y1), at(x1, y1)
+				top := p00 + (p10-p00)*lx
+				bottom := p01 + (p11-p01)*lx
+				v := top + (bottom-top)*ly
+
+				// Gradient per output pixel
+				gx := ((p10-p00)*(1-ly) + (p11-p01)*ly) * xRatio
+				gy := (bottom - top) * yRatio
+				g := math.Hypot(gx, gy)
+
+				var coverage float64
+				if g < 1e-6 {
+					// Flat: fully inside or outside
+					if v >= 0.5 {
+						coverage = 1
+					}
+				} else {
+					coverage = min(max(0.5+(v-0.5)/g/width, 0), 1)
+				}
+				row[x] = uint8(math.Round(coverage * 255))
+			}
+		}
+	})
+}
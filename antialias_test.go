@@ -0,0 +1,71 @@
+package rmbg
+
+import (
+	"image"
+	"testing"
+)
+
+// partial counts the pixels of row y of mask that are neither 0 nor 255
+func partial(mask *image.Gray, y int) int {
+	n := 0
+	for _, v := range mask.Pix[y*mask.Stride:][:mask.Rect.Dx()] {
+		if v != 0 && v != 255 {
+			n++
+		}
+	}
+	return n
+}
+
+func TestAntialiasUpsample(t *testing.T) {
+	// A vertical edge between the two halves of a model mask
+	mask := image.NewGray(image.Rect(0, 0, 8, 8))
+	fillRect(mask, image.Rect(0, 0, 4, 8), 255)
+
+	upsample := func(width float64) *image.Gray {
+		dst := image.NewGray(image.Rect(0, 0, 64, 64))
+		antialiasUpsampleInto(dst, mask, width)
+		return dst
+	}
+
+	t.Run("Crisp", func(t *testing.T) {
+		dst := upsample(0)
+		if n := partial(dst, 32); n > 2 {
+			t.Errorf("expected at most 2 partial pixels across the edge, got %d", n)
+		}
+		if dst.GrayAt(0, 32).Y != 255 || dst.GrayAt(63, 32).Y != 0 {
+			t.Errorf("expected solid inside and outside, got %d and %d", dst.GrayAt(0, 32).Y, dst.GrayAt(63, 32).Y)
+		}
+		// The edge sits halfway, at x = 32
+		if a, b := int(dst.GrayAt(31, 32).Y), int(dst.GrayAt(32, 32).Y); a+b < 250 || a+b > 260 || a <= b {
+			t.Errorf("expected symmetric coverage around x = 32, got %d and %d", a, b)
+		}
+	})
+
+	t.Run("Width", func(t *testing.T) {
+		crisp, soft := partial(upsample(1), 32), partial(upsample(4), 32)
+		if soft <= crisp {
+			t.Errorf("expected a wider transition than %d pixels, got %d", crisp, soft)
+		}
+	})
+
+	t.Run("BlurIsWider", func(t *testing.T) {
+		r := &RemBG{blurPool: newBlurBufferPool()}
+		dst := image.NewGray(image.Rect(0, 0, 64, 64))
+		r.resizeGrayBlur5OInto(dst, mask)
+		if blur, aa := partial(dst, 32), partial(upsample(1), 32); blur <= aa {
+			t.Errorf("expected the box blur to spread wider than %d pixels, got %d", aa, blur)
+		}
+	})
+
+	t.Run("Flat", func(t *testing.T) {
+		full := image.NewGray(image.Rect(0, 0, 8, 8))
+		fillRect(full, full.Rect, 255)
+		dst := image.NewGray(image.Rect(0, 0, 20, 20))
+		antialiasUpsampleInto(dst, full, 1)
+		for i, v := range dst.Pix {
+			if v != 255 {
+				t.Fatalf("expected an opaque mask, got %d at %d", v, i)
+			}
+		}
+	})
+}
@@ -0,0 +1,318 @@
+package rmbg
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+)
+
+// APNG frame disposal and blending operations
+const (
+	apngDisposeNone       = 0
+	apngDisposeBackground = 1
+	apngDisposePrevious   = 2
+	apngBlendSource       = 0
+)
+
+// apngFrame is one frame of an APNG: its fcTL fields and image data
+type apngFrame struct {
+	rect               image.Rectangle
+	delayNum, delayDen uint16
+	dispose, blend     byte
+	data               []byte
+}
+
+// apngImage is a decoded APNG stream
+type apngImage struct {
+	width, height int
+	plays         uint32
+	// header holds the chunks shared by all frames (PLTE, tRNS, ...)
+	header []rawChunk
+	ihdr   []byte
+	frames []*apngFrame
+}
+
+// rawChunk is a PNG chunk without its length and CRC
+type rawChunk struct {
+	typ  string
+	data []byte
+}
+
+// readPNGChunks splits a PNG stream into chunks, checking their CRCs
+func readPNGChunks(data []byte) ([]rawChunk, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errors.New("not a PNG file")
+	}
+	data = data[len(pngSignature):]
+	var chunks []rawChunk
+	for len(data) > 0 {
+		if len(data) < 12 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		n := binary.BigEndian.Uint32(data)
+		if uint64(n) > uint64(len(data)-12) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		typ, body := string(data[4:8]), data[8:8+n]
+		if crc32.ChecksumIEEE(data[4:8+n]) != binary.BigEndian.Uint32(data[8+n:]) {
+			return nil, fmt.Errorf("invalid checksum in %s chunk", typ)
+		}
+		chunks = append(chunks, rawChunk{typ, body})
+		data = data[12+n:]
+		if typ == "IEND" {
+			break
+		}
+	}
+	return chunks, nil
+}
+
+// writePNGChunk writes one chunk with its length and CRC
+func writePNGChunk(w *bytes.Buffer, typ string, data []byte) {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(data)))
+	w.Write(n[:])
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(typ))
+	crc.Write(data)
+	w.WriteString(typ)
+	w.Write(data)
+	binary.BigEndian.PutUint32(n[:], crc.Sum32())
+	w.Write(n[:])
+}
+
+// decodeAPNG parses an APNG stream. A plain PNG yields one frame.
+func decodeAPNG(data []byte) (*apngImage, error) {
+	chunks, err := readPNGChunks(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 || chunks[0].typ != "IHDR" || len(chunks[0].data) != 13 {
+		return nil, errors.New("missing IHDR chunk")
+	}
+	a := &apngImage{
+		width:  int(binary.BigEndian.Uint32(chunks[0].data)),
+		height: int(binary.BigEndian.Uint32(chunks[0].data[4:])),
+		ihdr:   chunks[0].data,
+	}
+
+	var (
+		animated bool
+		current  *apngFrame
+		seenIDAT bool
+	)
+	for _, c := range chunks[1:] {
+		switch c.typ {
+		case "acTL":
+			if len(c.data) != 8 {
+				return nil, errors.New("invalid acTL chunk")
+			}
+			animated = true
+			a.plays = binary.BigEndian.Uint32(c.data[4:])
+		case "fcTL":
+			if len(c.data) != 26 {
+				return nil, errors.New("invalid fcTL chunk")
+			}
+			x, y := int(binary.BigEndian.Uint32(c.data[12:])), int(binary.BigEndian.Uint32(c.data[16:]))
+			w, h := int(binary.BigEndian.Uint32(c.data[4:])), int(binary.BigEndian.Uint32(c.data[8:]))
+			rect := image.Rect(x, y, x+w, y+h)
+			if w <= 0 || h <= 0 || !rect.In(image.Rect(0, 0, a.width, a.height)) {
+				return nil, fmt.Errorf("frame %v outside canvas", rect)
+			}
+			current = &apngFrame{
+				rect:     rect,
+				delayNum: binary.BigEndian.Uint16(c.data[20:]),
+				delayDen: binary.BigEndian.Uint16(c.data[22:]),
+				dispose:  c.data[24],
+				blend:    c.data[25],
+			}
+			a.frames = append(a.frames, current)
+		case "IDAT":
+			seenIDAT = true
+			if !animated {
+				if current == nil {
+					current = &apngFrame{rect: image.Rect(0, 0, a.width, a.height)}
+					a.frames = append(a.frames, current)
+				}
+				current.data = append(current.data, c.data...)
+			} else if current != nil && len(a.frames) == 1 {
+				// The default image is the first frame
+				current.data = append(current.data, c.data...)
+			}
+		case "fdAT":
+			if current == nil || len(c.data) < 4 {
+				return nil, errors.New("fdAT chunk without frame")
+			}
+			current.data = append(current.data, c.data[4:]...)
+		case "IEND":
+		default:
+			if !seenIDAT {
+				a.header = append(a.header, c)
+			}
+		}
+	}
+	if len(a.frames) == 0 {
+		return nil, errors.New("no frames")
+	}
+	return a, nil
+}
+
+// decodeFrame decodes the image data of f as a standalone PNG
+func (a *apngImage) decodeFrame(f *apngFrame) (image.Image, error) {
+	var buf bytes.Buffer
+	buf.Write(pngSignature)
+	ihdr := append([]byte(nil), a.ihdr...)
+	binary.BigEndian.PutUint32(ihdr, uint32(f.rect.Dx()))
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(f.rect.Dy()))
+	writePNGChunk(&buf, "IHDR", ihdr)
+	for _, c := range a.header {
+		writePNGChunk(&buf, c.typ, c.data)
+	}
+	writePNGChunk(&buf, "IDAT", f.data)
+	writePNGChunk(&buf, "IEND", nil)
+	return png.Decode(&buf)
+}
+
+// encodeAPNG writes full canvas RGBA frames with the timing of src
+func encodeAPNG(w io.Writer, frames []*image.NRGBA, src *apngImage) error {
+	var buf bytes.Buffer
+	buf.Write(pngSignature)
+
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr, uint32(src.width))
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(src.height))
+	ihdr[8], ihdr[9] = 8, 6 // 8-bit RGBA
+	writePNGChunk(&buf, "IHDR", ihdr)
+
+	actl := make([]byte, 8)
+	binary.BigEndian.PutUint32(actl, uint32(len(frames)))
+	binary.BigEndian.PutUint32(actl[4:], src.plays)
+	writePNGChunk(&buf, "acTL", actl)
+
+	var seq uint32
+	for i, img := range frames {
+		fctl := make([]byte, 26)
+		binary.BigEndian.PutUint32(fctl, seq)
+		binary.BigEndian.PutUint32(fctl[4:], uint32(src.width))
+		binary.BigEndian.PutUint32(fctl[8:], uint32(src.height))
+		binary.BigEndian.PutUint16(fctl[20:], src.frames[i].delayNum)
+		binary.BigEndian.PutUint16(fctl[22:], src.frames[i].delayDen)
+		// Each frame covers the canvas and replaces it
+		fctl[24], fctl[25] = apngDisposeNone, apngBlendSource
+		writePNGChunk(&buf, "fcTL", fctl)
+		seq++
+
+		data, err := compressRGBA(img)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			writePNGChunk(&buf, "IDAT", data)
+			continue
+		}
+		fdat := make([]byte, 4, 4+len(data))
+		binary.BigEndian.PutUint32(fdat, seq)
+		writePNGChunk(&buf, "fdAT", append(fdat, data...))
+		seq++
+	}
+	writePNGChunk(&buf, "IEND", nil)
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// compressRGBA returns the zlib compressed scanlines of img, each with the Up
+// filter except the first
+func compressRGBA(img *image.NRGBA) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	b := img.Bounds()
+	n := b.Dx() * 4
+	line := make([]byte, 1+n)
+	for y := range b.Dy() {
+		row := img.Pix[y*img.Stride:][:n]
+		if y == 0 {
+			line[0] = 0
+			copy(line[1:], row)
+		} else {
+			line[0] = 2
+			prev := img.Pix[(y-1)*img.Stride:][:n]
+			for x := range row {
+				line[1+x] = row[x] - prev[x]
+			}
+		}
+		if _, err := zw.Write(line); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ProcessAPNG removes the background of every frame of an animated PNG and
+// writes the result to w as an RGBA APNG with the same timing and play count.
+// Masks are smoothed across frames. A plain PNG is written as a one frame
+// animation.
+func (r *RemBG) ProcessAPNG(rd io.Reader, w io.Writer, opts *AnimationOptions) error {
+	if opts == nil {
+		opts = &AnimationOptions{}
+	}
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return err
+	}
+	a, err := decodeAPNG(data)
+	if err != nil {
+		return r.countError(ErrorKindDecode, fmt.Errorf("%w: %w", ErrInvalidImage, err))
+	}
+	if err := opts.check(a.width, a.height, len(a.frames)); err != nil {
+		return r.countError(ErrorKindDecode, err)
+	}
+
+	p, err := r.newFrameProcessor(opts)
+	if err != nil {
+		return err
+	}
+	canvas := image.NewNRGBA(image.Rect(0, 0, a.width, a.height))
+	out := make([]*image.NRGBA, 0, len(a.frames))
+	for i, f := range a.frames {
+		img, err := a.decodeFrame(f)
+		if err != nil {
+			return r.countError(ErrorKindDecode, fmt.Errorf("%w: frame %d: %w", ErrInvalidImage, i, err))
+		}
+		var previous *image.NRGBA
+		if f.dispose == apngDisposePrevious && i > 0 {
+			previous = image.NewNRGBA(canvas.Rect)
+			copy(previous.Pix, canvas.Pix)
+		}
+		op := draw.Over
+		if f.blend == apngBlendSource {
+			op = draw.Src
+		}
+		draw.Draw(canvas, f.rect, img, img.Bounds().Min, op)
+
+		res, _, err := p.frame(canvas)
+		if err != nil {
+			return fmt.Errorf("frame %d: %w", i, err)
+		}
+		frame := image.NewNRGBA(canvas.Rect)
+		draw.Draw(frame, frame.Rect, res, image.Point{}, draw.Src)
+		out = append(out, frame)
+
+		switch {
+		case previous != nil:
+			canvas = previous
+		case f.dispose == apngDisposeBackground, f.dispose == apngDisposePrevious:
+			// Previous on the first frame is treated as background
+			draw.Draw(canvas, f.rect, image.Transparent, image.Point{}, draw.Src)
+		}
+	}
+	return encodeAPNG(w, out, a)
+}
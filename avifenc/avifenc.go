@@ -0,0 +1,49 @@
+//go:build avif
+
+// Package avifenc encodes rmbg.FormatAVIF output with the AV1 encoder of
+// github.com/gen2brain/avif, alpha channel included. Importing it registers
+// the encoder. It is a module of its own, so the core library does not depend
+// on the encoder, and is only built with the avif tag:
+//
+//	go get github.com/josuedeavila/rmbg/avifenc
+//	go build -tags avif
+package avifenc
+
+import (
+	"image"
+	"io"
+
+	"github.com/gen2brain/avif"
+	"github.com/josuedeavila/rmbg"
+)
+
+var _ rmbg.Encoder = Encoder{}
+
+func init() {
+	rmbg.RegisterEncoder(rmbg.FormatAVIF, Encoder{})
+}
+
+// Encoder writes AVIF images
+type Encoder struct {
+	// Speed trades compression for encoding time, from 1 (slowest, smallest)
+	// to 10 (default: avif.DefaultSpeed)
+	Speed int
+}
+
+// Encode implements rmbg.Encoder. The alpha channel is coded at the quality
+// of the color.
+func (e Encoder) Encode(w io.Writer, img image.Image, opts *rmbg.IOOptions) error {
+	quality := opts.AVIFQuality
+	if quality <= 0 {
+		quality = avif.DefaultQuality
+	}
+	speed := e.Speed
+	if speed <= 0 {
+		speed = avif.DefaultSpeed
+	}
+	return avif.Encode(w, img, avif.Options{
+		Quality:      min(quality, 100),
+		QualityAlpha: min(quality, 100),
+		Speed:        speed,
+	})
+}
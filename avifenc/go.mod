@@ -0,0 +1,18 @@
+module github.com/josuedeavila/rmbg/avifenc
+
+go 1.25
+
+require (
+	github.com/gen2brain/avif v0.4.4
+	github.com/josuedeavila/rmbg v0.0.0-00010101000000-000000000000
+)
+
+require (
+	github.com/disintegration/imaging v1.6.2 // indirect
+	github.com/ebitengine/purego v0.8.3 // indirect
+	github.com/tetratelabs/wazero v1.9.0 // indirect
+	github.com/yalue/onnxruntime_go v1.23.0 // indirect
+	golang.org/x/image v0.36.0 // indirect
+)
+
+replace github.com/josuedeavila/rmbg => ../
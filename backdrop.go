@@ -0,0 +1,200 @@
+package rmbg
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"math/rand/v2"
+)
+
+// Defaults of Checkerboard, the squares design tools draw behind transparency
+var (
+	DefaultCheckerSize  = 8
+	DefaultCheckerLight = color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+	DefaultCheckerDark  = color.NRGBA{R: 204, G: 204, B: 204, A: 255}
+)
+
+// Backdrop generates a replacement background of any size, see
+// ReplaceBackground and IOOptions.Backdrop
+type Backdrop interface {
+	// Render returns the background as a zero-based w x h image
+	Render(w, h int) image.Image
+}
+
+// SolidBackdrop is a single color
+type SolidBackdrop struct {
+	Color color.Color
+}
+
+// Render implements Backdrop
+func (s SolidBackdrop) Render(w, h int) image.Image {
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(dst, dst.Rect, image.NewUniform(colorOrBlack(s.Color)), image.Point{}, draw.Src)
+	return dst
+}
+
+// LinearGradient blends two colors along a direction
+type LinearGradient struct {
+	// From and To are the colors at the start and the end of the gradient
+	From, To color.Color
+	// Angle is the direction of the gradient in degrees, clockwise from left
+	// to right: 90 runs from top to bottom
+	Angle float64
+}
+
+// Render implements Backdrop
+func (g LinearGradient) Render(w, h int) image.Image {
+	from, to := toNRGBAColor(g.From), toNRGBAColor(g.To)
+	dx, dy := math.Cos(g.Angle*math.Pi/180), math.Sin(g.Angle*math.Pi/180)
+	// Project the corners to span the full gradient
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, c := range [4][2]float64{{0, 0}, {float64(w), 0}, {0, float64(h)}, {float64(w), float64(h)}} {
+		d := c[0]*dx + c[1]*dy
+		lo, hi = min(lo, d), max(hi, d)
+	}
+	return renderGradient(w, h, from, to, func(x, y float64) float64 {
+		if hi == lo {
+			return 0
+		}
+		return (x*dx + y*dy - lo) / (hi - lo)
+	})
+}
+
+// RadialGradient blends two colors from the center outwards
+type RadialGradient struct {
+	// Inner and Outer are the colors at the center and at Radius
+	Inner, Outer color.Color
+	// Radius is where Outer is reached, as a fraction of the distance from
+	// the center to the corners (default: 1)
+	Radius float64
+}
+
+// Render implements Backdrop
+func (g RadialGradient) Render(w, h int) image.Image {
+	radius := g.Radius
+	if radius <= 0 {
+		radius = 1
+	}
+	cx, cy := float64(w)/2, float64(h)/2
+	reach := math.Hypot(cx, cy) * radius
+	return renderGradient(w, h, toNRGBAColor(g.Inner), toNRGBAColor(g.Outer), func(x, y float64) float64 {
+		if reach == 0 {
+			return 0
+		}
+		return math.Hypot(x-cx, y-cy) / reach
+	})
+}
+
+// Checkerboard alternates two colors in squares, as design tools show
+// transparency
+type Checkerboard struct {
+	// Size is the side of the squares in pixels (default:
+	// DefaultCheckerSize)
+	Size int
+	// Light and Dark are the colors of the squares (default:
+	// DefaultCheckerLight and DefaultCheckerDark)
+	Light, Dark color.Color
+}
+
+// Render implements Backdrop
+func (c Checkerboard) Render(w, h int) image.Image {
+	size := c.Size
+	if size <= 0 {
+		size = DefaultCheckerSize
+	}
+	light, dark := DefaultCheckerLight, DefaultCheckerDark
+	if c.Light != nil {
+		light = toNRGBAColor(c.Light)
+	}
+	if c.Dark != nil {
+		dark = toNRGBAColor(c.Dark)
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	parallelRows(h, func(start, end int) {
+		for y := start; y < end; y++ {
+			row := dst.Pix[y*dst.Stride:][:w*4]
+			for x := range w {
+				p := light
+				if (x/size+y/size)%2 == 1 {
+					p = dark
+				}
+				row[x*4], row[x*4+1], row[x*4+2], row[x*4+3] = p.R, p.G, p.B, p.A
+			}
+		}
+	})
+	return dst
+}
+
+// NoiseBackdrop is a color with random grain, like a studio backdrop
+type NoiseBackdrop struct {
+	// Color is the mean color (default: black)
+	Color color.Color
+	// Amount is the standard deviation of the grain in 8-bit levels
+	Amount float64
+	// Seed makes the grain reproducible
+	Seed uint64
+}
+
+// Render implements Backdrop
+func (n NoiseBackdrop) Render(w, h int) image.Image {
+	base := toNRGBAColor(colorOrBlack(n.Color))
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	rng := rand.New(rand.NewPCG(n.Seed, n.Seed^0x9e3779b97f4a7c15))
+	for i := 0; i < len(dst.Pix); i += 4 {
+		// The same grain on every channel keeps the hue
+		v := rng.NormFloat64() * n.Amount
+		dst.Pix[i] = clampLevel(float64(base.R) + v)
+		dst.Pix[i+1] = clampLevel(float64(base.G) + v)
+		dst.Pix[i+2] = clampLevel(float64(base.B) + v)
+		dst.Pix[i+3] = base.A
+	}
+	return dst
+}
+
+// ReplaceBackground draws img over a backdrop rendered at its size, using
+// mask as alpha, e.g. the Mask of a Result. The mask may have any resolution.
+func ReplaceBackground(img image.Image, mask *image.Gray, backdrop Backdrop) *image.RGBA {
+	b := img.Bounds()
+	return flattenOver(cutout(img, fitMask(mask, b.Dx(), b.Dy())), backdrop.Render(b.Dx(), b.Dy()))
+}
+
+// renderGradient returns a w x h image blending from into to by the position
+// t, clamped to [0, 1], of each pixel center
+func renderGradient(w, h int, from, to color.NRGBA, t func(x, y float64) float64) *image.NRGBA {
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	lerp := func(a, b uint8, f float64) uint8 {
+		return uint8(float64(a) + (float64(b)-float64(a))*f + 0.5)
+	}
+	parallelRows(h, func(start, end int) {
+		for y := start; y < end; y++ {
+			row := dst.Pix[y*dst.Stride:][:w*4]
+			for x := range w {
+				f := min(max(t(float64(x)+0.5, float64(y)+0.5), 0), 1)
+				row[x*4] = lerp(from.R, to.R, f)
+				row[x*4+1] = lerp(from.G, to.G, f)
+				row[x*4+2] = lerp(from.B, to.B, f)
+				row[x*4+3] = lerp(from.A, to.A, f)
+			}
+		}
+	})
+	return dst
+}
+
+// toNRGBAColor converts c, black when nil, to non-premultiplied 8-bit
+func toNRGBAColor(c color.Color) color.NRGBA {
+	return color.NRGBAModel.Convert(colorOrBlack(c)).(color.NRGBA)
+}
+
+// colorOrBlack returns c, or black when it is nil
+func colorOrBlack(c color.Color) color.Color {
+	if c == nil {
+		return color.Black
+	}
+	return c
+}
+
+// clampLevel rounds v to an 8-bit level
+func clampLevel(v float64) uint8 {
+	return uint8(min(max(v+0.5, 0), 255))
+}
@@ -0,0 +1,166 @@
+package rmbg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func TestBackdrops(t *testing.T) {
+	white := color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+	black := color.NRGBA{A: 255}
+	at := func(img image.Image, x, y int) color.NRGBA {
+		return color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+	}
+
+	t.Run("Solid", func(t *testing.T) {
+		img := SolidBackdrop{Color: color.NRGBA{R: 10, G: 20, B: 30, A: 255}}.Render(4, 3)
+		if got := img.Bounds(); got != image.Rect(0, 0, 4, 3) {
+			t.Errorf("expected 4x3 at the origin, got %v", got)
+		}
+		if c := at(img, 3, 2); c != (color.NRGBA{10, 20, 30, 255}) {
+			t.Errorf("expected the color, got %v", c)
+		}
+	})
+
+	t.Run("LinearGradient", func(t *testing.T) {
+		img := LinearGradient{From: color.White, To: color.Black}.Render(100, 10)
+		if c := at(img, 0, 5); c.R < 250 {
+			t.Errorf("expected white on the left, got %v", c)
+		}
+		if c := at(img, 99, 5); c.R > 5 {
+			t.Errorf("expected black on the right, got %v", c)
+		}
+		if a, b := at(img, 50, 0), at(img, 50, 9); a != b {
+			t.Errorf("expected columns of one color, got %v and %v", a, b)
+		}
+
+		vertical := LinearGradient{From: color.White, To: color.Black, Angle: 90}.Render(10, 100)
+		if top, bottom := at(vertical, 5, 0), at(vertical, 5, 99); top.R < 250 || bottom.R > 5 {
+			t.Errorf("expected white to black from top to bottom, got %v and %v", top, bottom)
+		}
+	})
+
+	t.Run("RadialGradient", func(t *testing.T) {
+		img := RadialGradient{Inner: color.White, Outer: color.Black}.Render(100, 100)
+		if c := at(img, 50, 50); c.R < 250 {
+			t.Errorf("expected white at the center, got %v", c)
+		}
+		if c := at(img, 0, 0); c.R > 5 {
+			t.Errorf("expected black in the corners, got %v", c)
+		}
+		if edge := at(img, 0, 50); edge.R < 50 || edge.R > 100 {
+			t.Errorf("expected gray at the edges, got %v", edge)
+		}
+
+		small := RadialGradient{Inner: color.White, Outer: color.Black, Radius: 0.5}.Render(100, 100)
+		if c := at(small, 0, 50); c != black {
+			t.Errorf("expected black beyond the radius, got %v", c)
+		}
+	})
+
+	t.Run("Checkerboard", func(t *testing.T) {
+		img := Checkerboard{}.Render(32, 32)
+		if c := at(img, 0, 0); c != DefaultCheckerLight {
+			t.Errorf("expected %v, got %v", DefaultCheckerLight, c)
+		}
+		if c := at(img, DefaultCheckerSize, 0); c != DefaultCheckerDark {
+			t.Errorf("expected %v, got %v", DefaultCheckerDark, c)
+		}
+		if c := at(img, DefaultCheckerSize, DefaultCheckerSize); c != DefaultCheckerLight {
+			t.Errorf("expected %v, got %v", DefaultCheckerLight, c)
+		}
+
+		custom := Checkerboard{Size: 2, Light: color.White, Dark: color.Black}.Render(4, 4)
+		if c := at(custom, 2, 1); c != black {
+			t.Errorf("expected black, got %v", c)
+		}
+		if c := at(custom, 3, 3); c != white {
+			t.Errorf("expected white, got %v", c)
+		}
+	})
+
+	t.Run("Noise", func(t *testing.T) {
+		gray := color.NRGBA{R: 128, G: 128, B: 128, A: 255}
+		n := NoiseBackdrop{Color: gray, Amount: 10, Seed: 7}
+		img := n.Render(64, 64).(*image.NRGBA)
+		var sum, varied int
+		for i := 0; i < len(img.Pix); i += 4 {
+			if img.Pix[i] != img.Pix[i+1] || img.Pix[i] != img.Pix[i+2] {
+				t.Fatalf("expected gray grain, got %v", img.Pix[i:i+4])
+			}
+			sum += int(img.Pix[i])
+			if img.Pix[i] != 128 {
+				varied++
+			}
+		}
+		if mean := sum / (64 * 64); mean < 126 || mean > 130 {
+			t.Errorf("expected a mean near 128, got %d", mean)
+		}
+		if varied < 64*64/2 {
+			t.Errorf("expected grain on most pixels, got %d", varied)
+		}
+		if again := n.Render(64, 64).(*image.NRGBA); !bytes.Equal(again.Pix, img.Pix) {
+			t.Errorf("expected the same seed to render the same grain")
+		}
+		if plain := (NoiseBackdrop{Color: gray}).Render(2, 2); at(plain, 1, 1) != gray {
+			t.Errorf("expected no grain without an amount, got %v", at(plain, 1, 1))
+		}
+	})
+}
+
+func TestReplaceBackground(t *testing.T) {
+	red := color.NRGBA{R: 255, A: 255}
+	img := solidImage(20, 10, red)
+	mask := image.NewGray(image.Rect(0, 0, 4, 2))
+	fillRect(mask, image.Rect(0, 0, 2, 2), 255)
+
+	out := ReplaceBackground(img, mask, SolidBackdrop{Color: color.White})
+	if got := out.Bounds(); got != img.Bounds() {
+		t.Errorf("expected %v, got %v", img.Bounds(), got)
+	}
+	if c := color.NRGBAModel.Convert(out.At(2, 5)); c != red {
+		t.Errorf("expected the subject, got %v", c)
+	}
+	if c := color.NRGBAModel.Convert(out.At(18, 5)); c != (color.NRGBA{255, 255, 255, 255}) {
+		t.Errorf("expected the backdrop, got %v", c)
+	}
+}
+
+func TestRemoveBackgroundBackdrop(t *testing.T) {
+	// The left half is opaque, so the full model mask keeps it
+	src := image.NewNRGBA(image.Rect(0, 0, 20, 10))
+	for y := range 10 {
+		for x := range 10 {
+			src.SetNRGBA(x, y, color.NRGBA{R: 255, A: 255})
+		}
+	}
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, src); err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	r := cachedEngine(src)
+
+	var out bytes.Buffer
+	blue := color.NRGBA{B: 255, A: 255}
+	opts := &IOOptions{Background: color.White, Backdrop: SolidBackdrop{Color: blue}}
+	if err := r.RemoveBackgroundFrom(bytes.NewReader(encoded.Bytes()), &out, FormatPNG, opts); err != nil {
+		t.Fatalf("RemoveBackgroundFrom failed: %v", err)
+	}
+	img, err := png.Decode(&out)
+	if err != nil {
+		t.Fatalf("invalid output: %v", err)
+	}
+	if c := color.NRGBAModel.Convert(img.At(5, 5)); c != (color.NRGBA{R: 255, A: 255}) {
+		t.Errorf("expected the subject, got %v", c)
+	}
+	if c := color.NRGBAModel.Convert(img.At(15, 5)); c != blue {
+		t.Errorf("expected the backdrop over the background, got %v", c)
+	}
+
+	if err := r.RemoveBackgroundFrom(bytes.NewReader(encoded.Bytes()), &out, FormatSVG, opts); err == nil {
+		t.Errorf("expected error for a backdrop in SVG output")
+	}
+}
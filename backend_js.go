@@ -0,0 +1,91 @@
+//go:build js && wasm
+
+package rmbg
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"syscall/js"
+	"unsafe"
+)
+
+// jsBackend runs the model through a JavaScript function
+type jsBackend struct {
+	fn js.Value
+}
+
+// JSBackend returns a Backend calling fn, typically a wrapper around an
+// onnxruntime-web InferenceSession:
+//
+//	async (input, size) => {
+//	  const tensor = new ort.Tensor("float32", input, [1, 3, size, size]);
+//	  const out = await session.run({ "input.1": tensor });
+//	  return out["1959"].data;
+//	}
+//
+// fn receives the input as a Float32Array and the input size, and returns the
+// output map as a Float32Array or a Promise of one. Calls block until the
+// Promise settles, so the engine must not be used from a js.FuncOf callback.
+func JSBackend(fn js.Value) Backend {
+	return &jsBackend{fn: fn}
+}
+
+func (b *jsBackend) Run(input, output []float32) error {
+	arr := js.Global().Get("Float32Array").New(len(input))
+	js.CopyBytesToJS(jsBytes(arr), floatBytes(input))
+
+	size := int(math.Round(math.Sqrt(float64(len(output)))))
+	result, err := await(b.fn.Invoke(arr, size))
+	if err != nil {
+		return err
+	}
+	if result.Get("length").Int() != len(output) {
+		return fmt.Errorf("backend returned %d values, expected %d", result.Get("length").Int(), len(output))
+	}
+	js.CopyBytesToGo(floatBytes(output), jsBytes(result))
+	return nil
+}
+
+// await returns the value of v, waiting for it if it is a Promise
+func await(v js.Value) (js.Value, error) {
+	if v.Type() != js.TypeObject || v.Get("then").Type() != js.TypeFunction {
+		return v, nil
+	}
+	type settled struct {
+		value js.Value
+		err   error
+	}
+	done := make(chan settled, 1)
+	onResolve := js.FuncOf(func(_ js.Value, args []js.Value) any {
+		done <- settled{value: args[0]}
+		return nil
+	})
+	defer onResolve.Release()
+	onReject := js.FuncOf(func(_ js.Value, args []js.Value) any {
+		msg := "backend promise rejected"
+		if len(args) > 0 {
+			msg = args[0].Call("toString").String()
+		}
+		done <- settled{err: errors.New(msg)}
+		return nil
+	})
+	defer onReject.Release()
+
+	v.Call("then", onResolve, onReject)
+	s := <-done
+	return s.value, s.err
+}
+
+// jsBytes views the memory of a typed array as a Uint8Array
+func jsBytes(arr js.Value) js.Value {
+	return js.Global().Get("Uint8Array").New(arr.Get("buffer"), arr.Get("byteOffset"), arr.Get("byteLength"))
+}
+
+// floatBytes views a float32 slice as bytes
+func floatBytes(f []float32) []byte {
+	if len(f) == 0 {
+		return nil
+	}
+	return unsafe.Slice((*byte)(unsafe.Pointer(&f[0])), len(f)*4)
+}
@@ -0,0 +1,112 @@
+package rmbg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// squareBackend outputs a logit map with a centered square of foreground
+type squareBackend struct {
+	calls atomic.Int32
+}
+
+func (b *squareBackend) Run(input, output []float32) error {
+	b.calls.Add(1)
+	size := 0
+	for size*size < len(output) {
+		size++
+	}
+	for y := range size {
+		for x := range size {
+			v := float32(-10)
+			if x >= size/4 && x < size*3/4 && y >= size/4 && y < size*3/4 {
+				v = 10
+			}
+			output[y*size+x] = v
+		}
+	}
+	return nil
+}
+
+func TestBackend(t *testing.T) {
+	backend := &squareBackend{}
+	r, err := New(&Config{Backend: backend, ModelPath: "does-not-exist.onnx", Sessions: 2})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := r.Healthy(); err != nil {
+		t.Errorf("expected healthy engine, got %v", err)
+	}
+	if err := r.Warmup(context.Background()); err != nil {
+		t.Fatalf("Warmup failed: %v", err)
+	}
+	if n := backend.calls.Load(); n != 2 {
+		t.Errorf("expected one warm-up run per session, got %d", n)
+	}
+
+	res, err := r.Process(solidImage(40, 40, color.NRGBA{R: 90, G: 120, B: 30, A: 255}))
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if res.Mask.GrayAt(20, 20).Y != 255 || res.Mask.GrayAt(1, 1).Y != 0 {
+		t.Errorf("expected the square as foreground, got %d at the center and %d in the corner",
+			res.Mask.GrayAt(20, 20).Y, res.Mask.GrayAt(1, 1).Y)
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := r.Process(image.NewRGBA(image.Rect(0, 0, 4, 4))); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed after Close, got %v", err)
+	}
+
+	t.Run("Routing", func(t *testing.T) {
+		_, err := New(&Config{Backend: backend, ModelRouting: &ModelRouting{}})
+		if err == nil {
+			t.Error("expected model routing to be rejected with a backend")
+		}
+	})
+}
+
+func TestLoadFallback(t *testing.T) {
+	unavailable := fmt.Errorf("%w: no library", ErrRuntimeUnavailable)
+	defer func(f func(string) (Backend, error)) { fallbackBackend = f }(fallbackBackend)
+
+	t.Run("None", func(t *testing.T) {
+		fallbackBackend = nil
+		if _, err := loadFallback(&Config{}, "model.onnx", unavailable); err != unavailable {
+			t.Errorf("expected the runtime error, got %v", err)
+		}
+	})
+
+	backend := &squareBackend{}
+	fallbackBackend = func(string) (Backend, error) { return backend, nil }
+
+	t.Run("Loaded", func(t *testing.T) {
+		got, err := loadFallback(&Config{}, "model.onnx", unavailable)
+		if err != nil || got != backend {
+			t.Errorf("expected the fallback backend, got %v, %v", got, err)
+		}
+	})
+
+	t.Run("OtherError", func(t *testing.T) {
+		other := errors.New("busy")
+		if _, err := loadFallback(&Config{}, "model.onnx", other); err != other {
+			t.Errorf("expected errors other than ErrRuntimeUnavailable to pass through, got %v", err)
+		}
+	})
+
+	t.Run("Failed", func(t *testing.T) {
+		fallbackBackend = func(string) (Backend, error) { return nil, errors.New("bad graph") }
+		_, err := loadFallback(&Config{}, "model.onnx", unavailable)
+		if !errors.Is(err, ErrRuntimeUnavailable) || !strings.Contains(err.Error(), "bad graph") {
+			t.Errorf("expected both errors, got %v", err)
+		}
+	})
+}
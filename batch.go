@@ -0,0 +1,120 @@
+package rmbg
+
+import (
+	"image"
+	"runtime"
+	"sync"
+)
+
+// BatchResult is the outcome of one image of a batch
+type BatchResult struct {
+	// Index is the position of the image in the input
+	Index int
+	// Image is the cropped image, nil if Err is set
+	Image image.Image
+	// Err is the error for this image only
+	Err error
+}
+
+// BatchCrop smart crops imgs concurrently and returns one result per image, in
+// input order. A failure on one image does not stop the others.
+func (r *RemBG) BatchCrop(imgs []image.Image, config *CropConfig) []BatchResult {
+	return runBatch(imgs, r.batchWorkers(), func(img image.Image) (image.Image, error) {
+		return r.SmartCrop(img, config)
+	})
+}
+
+// BatchCropStream smart crops the images received from in concurrently. Results
+// are sent in input order; the returned channel is closed once in is closed and
+// every image has been processed.
+func (r *RemBG) BatchCropStream(in <-chan image.Image, config *CropConfig) <-chan BatchResult {
+	return streamBatch(in, r.batchWorkers(), func(img image.Image) (image.Image, error) {
+		return r.SmartCrop(img, config)
+	})
+}
+
+// batchWorkers is the number of concurrent batch workers: one per session plus
+// one so preprocessing and cropping overlap with inference
+func (r *RemBG) batchWorkers() int {
+	return max(1, min(runtime.NumCPU(), r.sessionCount()+1))
+}
+
+// sessionCount is the number of sessions across the loaded models
+func (r *RemBG) sessionCount() int {
+	n := 0
+	for _, m := range []*model{r.currentModel(), r.portrait} {
+		if m != nil && m.sessions != nil {
+			n += m.sessions.size()
+		}
+	}
+	return max(1, n)
+}
+
+// runBatch applies fn to imgs with the given number of workers
+func runBatch(imgs []image.Image, workers int, fn func(image.Image) (image.Image, error)) []BatchResult {
+	results := make([]BatchResult, len(imgs))
+	next := make(chan int)
+
+	var wg sync.WaitGroup
+	for range min(workers, len(imgs)) {
+		wg.Go(func() {
+			for i := range next {
+				img, err := fn(imgs[i])
+				results[i] = BatchResult{Index: i, Image: img, Err: err}
+			}
+		})
+	}
+	for i := range imgs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	return results
+}
+
+// streamBatch applies fn to the images received from in with the given number
+// of workers, sending results in input order
+func streamBatch(in <-chan image.Image, workers int, fn func(image.Image) (image.Image, error)) <-chan BatchResult {
+	type job struct {
+		index int
+		img   image.Image
+		done  chan BatchResult
+	}
+
+	jobs := make(chan job)
+	// order holds one pending result per in-flight image, which bounds the
+	// number of images buffered ahead of a slow one
+	order := make(chan chan BatchResult, workers)
+	out := make(chan BatchResult)
+
+	for range workers {
+		go func() {
+			for j := range jobs {
+				img, err := fn(j.img)
+				j.done <- BatchResult{Index: j.index, Image: img, Err: err}
+			}
+		}()
+	}
+
+	go func() {
+		i := 0
+		for img := range in {
+			done := make(chan BatchResult, 1)
+			order <- done
+			jobs <- job{index: i, img: img, done: done}
+			i++
+		}
+		close(jobs)
+		close(order)
+	}()
+
+	go func() {
+		for done := range order {
+			out <- <-done
+		}
+		close(out)
+	}()
+
+	return out
+}
@@ -0,0 +1,75 @@
+package rmbg
+
+import (
+	"errors"
+	"image"
+	"math/rand/v2"
+	"testing"
+	"time"
+)
+
+// sizeFn returns an image whose width encodes the input width, failing on width 0
+func sizeFn(img image.Image) (image.Image, error) {
+	w := img.Bounds().Dx()
+	if w == 0 {
+		return nil, errors.New("empty image")
+	}
+	time.Sleep(time.Duration(rand.IntN(3)) * time.Millisecond)
+	return image.NewGray(image.Rect(0, 0, w, 1)), nil
+}
+
+func TestRunBatch(t *testing.T) {
+	imgs := make([]image.Image, 20)
+	for i := range imgs {
+		imgs[i] = image.NewGray(image.Rect(0, 0, i, 1))
+	}
+
+	results := runBatch(imgs, 4, sizeFn)
+	if len(results) != len(imgs) {
+		t.Fatalf("expected %d results, got %d", len(imgs), len(results))
+	}
+	for i, res := range results {
+		if res.Index != i {
+			t.Errorf("expected index %d, got %d", i, res.Index)
+		}
+		if i == 0 {
+			if res.Err == nil {
+				t.Error("expected error for empty image")
+			}
+			continue
+		}
+		if res.Err != nil {
+			t.Errorf("image %d: unexpected error %v", i, res.Err)
+		} else if got := res.Image.Bounds().Dx(); got != i {
+			t.Errorf("image %d: expected width %d, got %d", i, i, got)
+		}
+	}
+
+	if got := runBatch(nil, 4, sizeFn); len(got) != 0 {
+		t.Errorf("expected no results for empty batch, got %d", len(got))
+	}
+}
+
+func TestStreamBatch(t *testing.T) {
+	in := make(chan image.Image)
+	go func() {
+		for i := range 30 {
+			in <- image.NewGray(image.Rect(0, 0, i, 1))
+		}
+		close(in)
+	}()
+
+	next := 0
+	for res := range streamBatch(in, 3, sizeFn) {
+		if res.Index != next {
+			t.Fatalf("expected index %d, got %d", next, res.Index)
+		}
+		if next > 0 && res.Image.Bounds().Dx() != next {
+			t.Errorf("image %d: expected width %d, got %d", next, next, res.Image.Bounds().Dx())
+		}
+		next++
+	}
+	if next != 30 {
+		t.Errorf("expected 30 results, got %d", next)
+	}
+}
@@ -0,0 +1,159 @@
+package rmbg
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// benchSizes are the image sizes every stage is benchmarked at: a web upload, a
+// full HD frame and a 12MP phone photo
+var benchSizes = []image.Point{{640, 480}, {1920, 1080}, {4000, 3000}}
+
+// benchImage returns a YCbCr image, as decoded from a JPEG, with a bright
+// ellipse on a gradient so no stage hits a uniform-input shortcut
+func benchImage(size image.Point) *image.YCbCr {
+	img := image.NewYCbCr(image.Rect(0, 0, size.X, size.Y), image.YCbCrSubsampleRatio420)
+	cx, cy := float64(size.X)/2, float64(size.Y)/2
+	for y := range size.Y {
+		for x := range size.X {
+			dx, dy := (float64(x)-cx)/(cx/2), (float64(y)-cy)/(cy/2)
+			v := uint8(x * 128 / size.X)
+			if dx*dx+dy*dy < 1 {
+				v = 220
+			}
+			img.Y[img.YOffset(x, y)] = v
+		}
+	}
+	for i := range img.Cb {
+		img.Cb[i], img.Cr[i] = uint8(i), 128
+	}
+	return img
+}
+
+// benchMask returns a model-resolution mask with a soft-edged ellipse
+func benchMask() *image.Gray {
+	mask := image.NewGray(image.Rect(0, 0, inputSize, inputSize))
+	c := float64(inputSize) / 2
+	for y := range inputSize {
+		for x := range inputSize {
+			dx, dy := (float64(x)-c)/(c/2), (float64(y)-c)/(c/2)
+			d := dx*dx + dy*dy
+			mask.Pix[y*mask.Stride+x] = uint8(255 * max(0, min(1, (1.2-d)/0.4)))
+		}
+	}
+	return mask
+}
+
+func sizeName(size image.Point) string {
+	return fmt.Sprintf("%dx%d", size.X, size.Y)
+}
+
+// benchEngine loads the model from RMBG_BENCH_MODEL or the example directory,
+// skipping the benchmark when it is missing
+func benchEngine(b *testing.B, config *Config) *RemBG {
+	b.Helper()
+	modelPath := os.Getenv("RMBG_BENCH_MODEL")
+	if modelPath == "" {
+		modelPath = filepath.Join("example", "models", "u2netp.onnx")
+	}
+	if _, err := os.Stat(modelPath); err != nil {
+		b.Skipf("Skipping inference benchmark: model not found at %s", modelPath)
+	}
+
+	config.ModelPath = modelPath
+	r, err := New(config)
+	if err != nil {
+		b.Fatalf("Failed to create RemBG: %v", err)
+	}
+	b.Cleanup(func() { _ = r.Close() })
+	return r
+}
+
+func BenchmarkStagePreprocess(b *testing.B) {
+	dst := make([]float32, 3*inputSize*inputSize)
+	for _, size := range benchSizes {
+		img := benchImage(size)
+		b.Run(sizeName(size), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				resizeNormalize(dst, img, inputSize, mean, std)
+			}
+		})
+	}
+}
+
+func BenchmarkStageUpsample(b *testing.B) {
+	mask := benchMask()
+	methods := []struct {
+		name       string
+		upsampling Upsampling
+	}{
+		{"Blur", UpsampleBlur},
+		{"Guided", UpsampleGuided},
+	}
+
+	for _, method := range methods {
+		r := &RemBG{blurPool: newBlurBufferPool(), upsampling: method.upsampling}
+		for _, size := range benchSizes {
+			img := benchImage(size)
+			b.Run(method.name+"/"+sizeName(size), func(b *testing.B) {
+				b.ReportAllocs()
+				for b.Loop() {
+					r.upsampleMask(mask, img)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkStageBlend(b *testing.B) {
+	r := &RemBG{blurPool: newBlurBufferPool()}
+	mask := benchMask()
+	for _, size := range benchSizes {
+		img := benchImage(size)
+		full := r.upsampleMask(mask, img)
+		dst := image.NewRGBA(img.Bounds())
+		b.Run(sizeName(size), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				blendParallel(dst, img, full)
+			}
+		})
+	}
+}
+
+func BenchmarkStageInference(b *testing.B) {
+	r := benchEngine(b, &Config{CpuMemArena: true, MemPattern: true})
+	// Preprocessing is excluded: every iteration runs on the same input
+	size := r.model.spec.InputSize
+	input := make([]float32, 3*size*size)
+	output := make([]float32, size*size)
+	resizeNormalize(input, benchImage(benchSizes[0]), size, r.model.spec.Mean, r.model.spec.Std)
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := r.model.runData(input, output); err != nil {
+			b.Fatalf("inference failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkProcess(b *testing.B) {
+	r := benchEngine(b, &Config{CpuMemArena: true, MemPattern: true, PoolOutputs: true})
+	for _, size := range benchSizes {
+		img := benchImage(size)
+		b.Run(sizeName(size), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				res, err := r.Process(img)
+				if err != nil {
+					b.Fatalf("Process failed: %v", err)
+				}
+				res.Release()
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package rmbg
+
+import (
+	"image"
+	"math"
+)
+
+// Defaults of Bilateral
+const (
+	DefaultBilateralRadius     = 3
+	DefaultBilateralSigmaColor = 20.0
+)
+
+// Bilateral smooths sensor noise while keeping edges: each pixel is averaged
+// with its neighbors, weighted by their distance and by how close their color
+// is, so flat areas of noisy night shots become clean and the object outline
+// stays sharp. The filter runs separably, along rows then columns, which is
+// much faster than the full window and close to it on photos.
+type Bilateral struct {
+	// Radius is the window radius in pixels (default:
+	// DefaultBilateralRadius)
+	Radius int
+	// SigmaColor is the color difference, on a 0 to 255 scale, at which
+	// neighbors lose most of their weight; larger values smooth more
+	// (default: DefaultBilateralSigmaColor)
+	SigmaColor float64
+}
+
+// Apply implements PreProcessor
+func (b Bilateral) Apply(img *image.NRGBA) error {
+	radius := b.Radius
+	if radius <= 0 {
+		radius = DefaultBilateralRadius
+	}
+	sigmaColor := b.SigmaColor
+	if sigmaColor <= 0 {
+		sigmaColor = DefaultBilateralSigmaColor
+	}
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	if w == 0 || h == 0 {
+		return nil
+	}
+
+	spatial := make([]float32, radius+1)
+	sigmaSpace := max(float64(radius)/2, 0.5)
+	for d := range spatial {
+		spatial[d] = float32(math.Exp(-float64(d*d) / (2 * sigmaSpace * sigmaSpace)))
+	}
+	// The color weight depends on the summed absolute channel difference
+	var rangeWeight [3*255 + 1]float32
+	for d := range rangeWeight {
+		diff := float64(d) / 3
+		rangeWeight[d] = float32(math.Exp(-diff * diff / (2 * sigmaColor * sigmaColor)))
+	}
+
+	tmp := make([]uint8, w*h*4)
+	// Rows of img into tmp
+	parallelRows(h, func(start, end int) {
+		for y := start; y < end; y++ {
+			src := img.Pix[y*img.Stride:][:w*4]
+			bilateralLine(tmp[y*w*4:][:w*4], src, w, 4, radius, spatial, &rangeWeight)
+		}
+	})
+	// Columns of tmp back into img
+	parallelRows(w, func(start, end int) {
+		col := make([]uint8, h*4)
+		out := make([]uint8, h*4)
+		for x := start; x < end; x++ {
+			for y := range h {
+				copy(col[y*4:y*4+4], tmp[(y*w+x)*4:])
+			}
+			bilateralLine(out, col, h, 4, radius, spatial, &rangeWeight)
+			for y := range h {
+				copy(img.Pix[y*img.Stride+x*4:][:3], out[y*4:y*4+3])
+			}
+		}
+	})
+	return nil
+}
+
+// bilateralLine filters the n pixels of src, step bytes apart, into dst along
+// one dimension. Alpha is copied.
+func bilateralLine(dst, src []uint8, n, step, radius int, spatial []float32, rangeWeight *[3*255 + 1]float32) {
+	for i := range n {
+		p := src[i*step : i*step+4]
+		var sum [3]float32
+		var total float32
+		for j := max(i-radius, 0); j <= min(i+radius, n-1); j++ {
+			q := src[j*step : j*step+3]
+			d := absDiff(p[0], q[0]) + absDiff(p[1], q[1]) + absDiff(p[2], q[2])
+			wt := spatial[abs(i-j)] * rangeWeight[d]
+			sum[0] += wt * float32(q[0])
+			sum[1] += wt * float32(q[1])
+			sum[2] += wt * float32(q[2])
+			total += wt
+		}
+		o := dst[i*step : i*step+4]
+		for c := range sum {
+			o[c] = uint8(sum[c]/total + 0.5)
+		}
+		o[3] = p[3]
+	}
+}
+
+// absDiff returns |a - b|
+func absDiff(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
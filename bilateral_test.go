@@ -0,0 +1,61 @@
+package rmbg
+
+import (
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+func TestBilateral(t *testing.T) {
+	// Two noisy halves: dark on the left, bright on the right
+	rng := rand.New(rand.NewSource(1))
+	img := solidImage(40, 40, color.NRGBA{})
+	for y := range 40 {
+		for x := range 40 {
+			base := 60
+			if x >= 20 {
+				base = 190
+			}
+			v := uint8(base + rng.Intn(21) - 10)
+			img.SetNRGBA(x, y, color.NRGBA{R: v, G: v, B: v, A: 255})
+		}
+	}
+	spread := func(x0, x1 int) int {
+		lo, hi := 255, 0
+		for y := 5; y < 35; y++ {
+			for x := x0; x < x1; x++ {
+				v := int(img.NRGBAAt(x, y).R)
+				lo, hi = min(lo, v), max(hi, v)
+			}
+		}
+		return hi - lo
+	}
+	before := spread(5, 15)
+
+	if err := (Bilateral{}).Apply(img); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if after := spread(5, 15); after*2 > before {
+		t.Errorf("expected the noise spread of %d to halve, got %d", before, after)
+	}
+	if a, b := int(img.NRGBAAt(19, 20).R), int(img.NRGBAAt(20, 20).R); b-a < 100 {
+		t.Errorf("expected the edge kept, got %d and %d", a, b)
+	}
+	if got := img.NRGBAAt(3, 3).A; got != 255 {
+		t.Errorf("expected alpha kept, got %d", got)
+	}
+}
+
+func TestDenoiseConfig(t *testing.T) {
+	r, err := New(&Config{Backend: &squareBackend{}, Denoise: &Bilateral{}, Exposure: ExposureStretch})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer r.Close()
+	if len(r.preProcessors) != 2 {
+		t.Fatalf("expected 2 pre-processors, got %d", len(r.preProcessors))
+	}
+	if _, ok := r.preProcessors[0].(Bilateral); !ok {
+		t.Errorf("expected denoising to run first, got %T", r.preProcessors[0])
+	}
+}
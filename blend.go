@@ -0,0 +1,157 @@
+package rmbg
+
+import (
+	"image"
+	"image/color"
+	"runtime"
+	"sync"
+)
+
+// blendParallel composites src over white using mask as alpha, splitting rows
+// across CPUs. Rows are independent, so the output does not depend on the
+// number of CPUs. mask and dst are addressed relative to their own bounds, so
+// they may be zero-based while src is not.
+func blendParallel(dst *image.RGBA, src image.Image, mask *image.Gray) {
+	parallelRows(src.Bounds().Dy(), func(start, end int) {
+		blendRows(dst, src, mask, start, end)
+	})
+}
+
+// parallelRows calls fn on consecutive ranges of rows [start, end) covering
+// h rows, one range per CPU
+func parallelRows(h int, fn func(start, end int)) {
+	workers := runtime.NumCPU()
+	chunk := (h + workers - 1) / workers
+	if chunk == 0 {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for start := 0; start < h; start += chunk {
+		end := min(start+chunk, h)
+		wg.Go(func() {
+			fn(start, end)
+		})
+	}
+	wg.Wait()
+}
+
+// deepImage returns img when it has more than 8 bits per channel, which the
+// output keeps instead of truncating
+func deepImage(img image.Image) (image.RGBA64Image, bool) {
+	switch img := img.(type) {
+	case *image.RGBA64, *image.NRGBA64, *image.Gray16:
+		return img.(image.RGBA64Image), true
+	}
+	return nil, false
+}
+
+func isDeep(img image.Image) bool {
+	_, ok := deepImage(img)
+	return ok
+}
+
+// blend16 is blendParallel for deep images: it composites src over white into
+// a new image with 16 bits per channel. The 8-bit mask is widened, so edges
+// keep 256 alpha levels but colors keep their precision.
+func blend16(src image.RGBA64Image, mask *image.Gray) *image.RGBA64 {
+	b, mb := src.Bounds(), mask.Bounds()
+	dst := image.NewRGBA64(b)
+	parallelRows(b.Dy(), func(start, end int) {
+		for y := start; y < end; y++ {
+			m := mask.Pix[mask.PixOffset(mb.Min.X, mb.Min.Y+y):][:b.Dx()]
+			d := dst.Pix[y*dst.Stride:][:b.Dx()*8]
+			for x, a := range m {
+				c := src.RGBA64At(b.Min.X+x, b.Min.Y+y)
+				a16 := uint32(a) * 0x101
+				for i, v := range [3]uint32{uint32(c.R), uint32(c.G), uint32(c.B)} {
+					v = (v*a16 + 0xffff*(0xffff-a16)) / 0xffff
+					d[x*8+i*2], d[x*8+i*2+1] = uint8(v>>8), uint8(v)
+				}
+				d[x*8+6], d[x*8+7] = 0xff, 0xff
+			}
+		}
+	})
+	return dst
+}
+
+// blendRows blends rows [start, end), counted from the top of each image
+func blendRows(dst *image.RGBA, src image.Image, mask *image.Gray, start, end int) {
+	b, mb, db := src.Bounds(), mask.Bounds(), dst.Bounds()
+	w := b.Dx()
+
+	for y := start; y < end; y++ {
+		m := mask.Pix[mask.PixOffset(mb.Min.X, mb.Min.Y+y):][:w]
+		d := dst.Pix[dst.PixOffset(db.Min.X, db.Min.Y+y):][:w*4]
+		sy := b.Min.Y + y
+
+		switch s := src.(type) {
+		case *image.RGBA:
+			row := s.Pix[s.PixOffset(b.Min.X, sy):][:w*4]
+			for x, a := range m {
+				i := x * 4
+				d[i+0] = blendWhite(row[i+0], a)
+				d[i+1] = blendWhite(row[i+1], a)
+				d[i+2] = blendWhite(row[i+2], a)
+				d[i+3] = 255
+			}
+		case *image.NRGBA:
+			row := s.Pix[s.PixOffset(b.Min.X, sy):][:w*4]
+			for x, a := range m {
+				i := x * 4
+				if row[i+3] == 255 {
+					d[i+0] = blendWhite(row[i+0], a)
+					d[i+1] = blendWhite(row[i+1], a)
+					d[i+2] = blendWhite(row[i+2], a)
+				} else {
+					// Premultiply like color.NRGBA.RGBA
+					r, g, bl, _ := color.NRGBA{R: row[i], G: row[i+1], B: row[i+2], A: row[i+3]}.RGBA()
+					d[i+0] = blendWhite(uint8(r>>8), a)
+					d[i+1] = blendWhite(uint8(g>>8), a)
+					d[i+2] = blendWhite(uint8(bl>>8), a)
+				}
+				d[i+3] = 255
+			}
+		case *image.YCbCr:
+			// Convert the row in place, then blend it
+			ycbcrRow(d, s, b.Min.X, sy, w)
+			for x, a := range m {
+				i := x * 4
+				d[i+0] = blendWhite(d[i+0], a)
+				d[i+1] = blendWhite(d[i+1], a)
+				d[i+2] = blendWhite(d[i+2], a)
+			}
+		case *image.Gray:
+			row := s.Pix[s.PixOffset(b.Min.X, sy):][:w]
+			for x, a := range m {
+				v := blendWhite(row[x], a)
+				i := x * 4
+				d[i+0], d[i+1], d[i+2], d[i+3] = v, v, v, 255
+			}
+		case *image.CMYK:
+			row := s.Pix[s.PixOffset(b.Min.X, sy):][:w*4]
+			for x, a := range m {
+				i := x * 4
+				r, g, bl := color.CMYKToRGB(row[i], row[i+1], row[i+2], row[i+3])
+				d[i+0] = blendWhite(r, a)
+				d[i+1] = blendWhite(g, a)
+				d[i+2] = blendWhite(bl, a)
+				d[i+3] = 255
+			}
+		default:
+			for x, a := range m {
+				r, g, bl, _ := src.At(b.Min.X+x, sy).RGBA()
+				i := x * 4
+				d[i+0] = blendWhite(uint8(r>>8), a)
+				d[i+1] = blendWhite(uint8(g>>8), a)
+				d[i+2] = blendWhite(uint8(bl>>8), a)
+				d[i+3] = 255
+			}
+		}
+	}
+}
+
+// blendWhite mixes v with white using alpha a
+func blendWhite(v, a uint8) uint8 {
+	return uint8((uint32(v)*uint32(a) + 255*uint32(255-a)) / 255)
+}
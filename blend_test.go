@@ -0,0 +1,189 @@
+package rmbg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestBlendParallel(t *testing.T) {
+	bounds := image.Rect(0, 0, 10, 10)
+	dst := image.NewRGBA(bounds)
+
+	// Red source image
+	src := image.NewRGBA(bounds)
+	for i := 0; i < len(src.Pix); i += 4 {
+		src.Pix[i] = 255   // R
+		src.Pix[i+3] = 255 // A
+	}
+
+	// Mask: half transparent, half opaque
+	mask := image.NewGray(bounds)
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			if x < 5 {
+				mask.SetGray(x, y, color.Gray{Y: 0}) // Transparent background
+			} else {
+				mask.SetGray(x, y, color.Gray{Y: 255}) // Opaque object
+			}
+		}
+	}
+
+	blendParallel(dst, src, mask)
+
+	// In blendParallel implementation:
+	// alpha := float64(mask.GrayAt(x, y).Y) / 255.0
+	// rOut := uint8(alpha*float64(rv>>8) + (1-alpha)*255)
+	// Where rv>>8 for 255 R is 255.
+	// If alpha = 0 (background): rOut = 0 + (1)*255 = 255 (White)
+	// If alpha = 1 (object): rOut = 1*255 + 0 = 255 (Red - but wait, source is Red)
+
+	// Let's check a pixel that should be "object" (Red)
+	r, g, b, _ := dst.At(7, 5).RGBA()
+	if uint8(r>>8) != 255 || uint8(g>>8) != 0 || uint8(b>>8) != 0 {
+		t.Errorf("Expected red pixel at (7,5), got R:%d G:%d B:%d", r>>8, g>>8, b>>8)
+	}
+
+	// Let's check a pixel that should be "background" (White)
+	r, g, b, _ = dst.At(2, 5).RGBA()
+	if uint8(r>>8) != 255 || uint8(g>>8) != 255 || uint8(b>>8) != 255 {
+		t.Errorf("Expected white pixel at (2,5), got R:%d G:%d B:%d", r>>8, g>>8, b>>8)
+	}
+}
+
+// opaqueImage hides the concrete type of an image to force the generic path
+type opaqueImage struct{ image.Image }
+
+func TestBlendFastPaths(t *testing.T) {
+	bounds := image.Rect(3, 5, 67, 45)
+	nrgba := image.NewNRGBA(bounds)
+	for i := range nrgba.Pix {
+		nrgba.Pix[i] = uint8(i * 7)
+	}
+	rgba := image.NewRGBA(bounds)
+	for i := range rgba.Pix {
+		rgba.Pix[i] = uint8(i * 5)
+		if i%4 == 3 {
+			rgba.Pix[i] = 255
+		}
+	}
+	ycbcr := image.NewYCbCr(bounds, image.YCbCrSubsampleRatio420)
+	for i := range ycbcr.Y {
+		ycbcr.Y[i] = uint8(i * 3)
+	}
+	for i := range ycbcr.Cb {
+		ycbcr.Cb[i] = uint8(i * 11)
+		ycbcr.Cr[i] = uint8(i * 13)
+	}
+
+	gray := image.NewGray(bounds)
+	for i := range gray.Pix {
+		gray.Pix[i] = uint8(i * 3)
+	}
+	cmyk := image.NewCMYK(bounds)
+	for i := range cmyk.Pix {
+		cmyk.Pix[i] = uint8(i * 7)
+	}
+
+	// Zero-based mask, as produced by the upsamplers
+	mask := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for i := range mask.Pix {
+		mask.Pix[i] = uint8(i * 17)
+	}
+
+	for name, src := range map[string]image.Image{"RGBA": rgba, "NRGBA": nrgba, "YCbCr": ycbcr, "Gray": gray, "CMYK": cmyk} {
+		t.Run(name, func(t *testing.T) {
+			fast := image.NewRGBA(bounds)
+			blendParallel(fast, src, mask)
+			generic := image.NewRGBA(bounds)
+			blendParallel(generic, opaqueImage{src}, mask)
+
+			for i := range fast.Pix {
+				if fast.Pix[i] != generic.Pix[i] {
+					t.Fatalf("pixel byte %d: expected %d, got %d", i, generic.Pix[i], fast.Pix[i])
+				}
+			}
+		})
+	}
+
+	t.Run("Offset", func(t *testing.T) {
+		dst := image.NewRGBA(bounds)
+		blendParallel(dst, opaqueImage{rgba}, mask)
+		// The top-left source pixel is blended with the first mask pixel
+		a := mask.Pix[0]
+		want := blendWhite(rgba.Pix[0], a)
+		if got := dst.RGBAAt(bounds.Min.X, bounds.Min.Y).R; got != want {
+			t.Errorf("expected %d, got %d", want, got)
+		}
+	})
+}
+
+func BenchmarkBlendParallel(b *testing.B) {
+	bounds := image.Rect(0, 0, 1920, 1080)
+	mask := image.NewGray(bounds)
+	for i := range mask.Pix {
+		mask.Pix[i] = uint8(i)
+	}
+	rgba := image.NewRGBA(bounds)
+	sources := map[string]image.Image{
+		"RGBA":    rgba,
+		"NRGBA":   image.NewNRGBA(bounds),
+		"YCbCr":   image.NewYCbCr(bounds, image.YCbCrSubsampleRatio420),
+		"Generic": opaqueImage{rgba},
+	}
+
+	for name, src := range sources {
+		b.Run(name, func(b *testing.B) {
+			dst := image.NewRGBA(bounds)
+			for b.Loop() {
+				blendParallel(dst, src, mask)
+			}
+		})
+	}
+}
+
+func TestBlendChunking(t *testing.T) {
+	img := benchImage(image.Pt(97, 61))
+	mask := image.NewGray(img.Bounds())
+	for i := range mask.Pix {
+		mask.Pix[i] = uint8(i * 7)
+	}
+
+	whole := image.NewRGBA(img.Bounds())
+	blendRows(whole, img, mask, 0, 61)
+	chunked := image.NewRGBA(img.Bounds())
+	for start := 0; start < 61; start += 5 {
+		blendRows(chunked, img, mask, start, min(start+5, 61))
+	}
+	if !bytes.Equal(whole.Pix, chunked.Pix) {
+		t.Errorf("expected output independent of row chunking")
+	}
+}
+
+func TestBlend16(t *testing.T) {
+	src := image.NewNRGBA64(image.Rect(2, 3, 6, 4))
+	for x := 2; x < 6; x++ {
+		src.SetNRGBA64(x, 3, color.NRGBA64{R: 0x1234, G: 0xfedc, B: 0x0101, A: 0xffff})
+	}
+	mask := image.NewGray(image.Rect(0, 0, 4, 1))
+	copy(mask.Pix, []uint8{0, 64, 200, 255})
+
+	dst := blend16(src, mask)
+	if dst.Bounds() != src.Bounds() {
+		t.Fatalf("expected bounds %v, got %v", src.Bounds(), dst.Bounds())
+	}
+	for i, a := range mask.Pix {
+		a16 := float64(a) / 255
+		want := func(v uint16) uint16 { return uint16(float64(v)*a16 + 0xffff*(1-a16)) }
+		got := dst.RGBA64At(2+i, 3)
+		for _, c := range [][2]uint16{{got.R, want(0x1234)}, {got.G, want(0xfedc)}, {got.B, want(0x0101)}} {
+			if d := int(c[0]) - int(c[1]); d < -1 || d > 1 {
+				t.Errorf("expected %#04x at alpha %d, got %#04x", c[1], a, c[0])
+			}
+		}
+		if got.A != 0xffff {
+			t.Errorf("expected opaque output, got alpha %#04x", got.A)
+		}
+	}
+}
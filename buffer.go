@@ -1,6 +1,9 @@
 package rmbg
 
-import "sync"
+import (
+	"image"
+	"sync"
+)
 
 type blurBufferPool struct {
 	pool sync.Pool
@@ -36,3 +39,48 @@ func (p *blurBufferPool) get(size int) *blurBuffer {
 func (p *blurBufferPool) put(buf *blurBuffer) {
 	p.pool.Put(buf)
 }
+
+// imagePool recycles the pixel buffers of full-resolution outputs. A nil pool
+// allocates fresh images and ignores puts.
+type imagePool struct {
+	pool sync.Pool
+}
+
+func newImagePool() *imagePool {
+	return &imagePool{}
+}
+
+func (p *imagePool) getPix(size int) []uint8 {
+	if p == nil {
+		return make([]uint8, size)
+	}
+	if buf, ok := p.pool.Get().(*[]uint8); ok && cap(*buf) >= size {
+		return (*buf)[:size]
+	}
+	return make([]uint8, size)
+}
+
+func (p *imagePool) putPix(pix []uint8) {
+	if p == nil || pix == nil {
+		return
+	}
+	p.pool.Put(&pix)
+}
+
+// rgba returns an RGBA image with undefined contents
+func (p *imagePool) rgba(bounds image.Rectangle) *image.RGBA {
+	return &image.RGBA{
+		Pix:    p.getPix(bounds.Dx() * bounds.Dy() * 4),
+		Stride: bounds.Dx() * 4,
+		Rect:   bounds,
+	}
+}
+
+// gray returns a zero-based Gray image with undefined contents
+func (p *imagePool) gray(w, h int) *image.Gray {
+	return &image.Gray{
+		Pix:    p.getPix(w * h),
+		Stride: w,
+		Rect:   image.Rect(0, 0, w, h),
+	}
+}
@@ -0,0 +1,172 @@
+package rmbg
+
+import (
+	"container/list"
+	"encoding/binary"
+	"hash/maphash"
+	"image"
+	"sync"
+)
+
+var hashSeed = maphash.MakeSeed()
+
+// maskCache is an LRU cache of model predictions keyed by image content
+type maskCache struct {
+	mu       sync.Mutex
+	capacity int
+	// distance is the Hamming distance of perceptual hashes within which
+	// getNear matches; 0 disables perceptual matching
+	distance int
+	items    map[uint64]*list.Element
+	order    *list.List
+}
+
+type cacheEntry struct {
+	key  uint64
+	pred *prediction
+	// near identifies the image perceptually, when set
+	near *nearKey
+}
+
+// nearKey identifies an image for perceptual matching: only images of the
+// same size, whose masks align, run through the same model match
+type nearKey struct {
+	salt string
+	size image.Point
+	hash ImageHash
+}
+
+// nearKeyOf returns the perceptual key of img for the model salt
+func nearKeyOf(img image.Image, salt string) *nearKey {
+	return &nearKey{salt: salt, size: img.Bounds().Size(), hash: PHash(img)}
+}
+
+func newMaskCache(capacity int) *maskCache {
+	return &maskCache{
+		capacity: capacity,
+		items:    make(map[uint64]*list.Element, capacity),
+		order:    list.New(),
+	}
+}
+
+func (c *maskCache) get(key uint64) (*prediction, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*cacheEntry).pred, true
+}
+
+// getNear returns the prediction of the closest cached image to near within
+// c.distance
+func (c *maskCache) getNear(near *nearKey) (*prediction, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var best *list.Element
+	bestDist := c.distance + 1
+	for el := c.order.Front(); el != nil; el = el.Next() {
+		other := el.Value.(*cacheEntry).near
+		if other == nil || other.salt != near.salt || other.size != near.size {
+			continue
+		}
+		if d := other.hash.Distance(near.hash); d < bestDist {
+			best, bestDist = el, d
+		}
+	}
+	if best == nil {
+		return nil, false
+	}
+	c.order.MoveToFront(best)
+	return best.Value.(*cacheEntry).pred, true
+}
+
+func (c *maskCache) put(key uint64, pred *prediction) {
+	c.putNear(key, nil, pred)
+}
+
+// putNear is put also recording the perceptual key of the image, if any
+func (c *maskCache) putNear(key uint64, near *nearKey, pred *prediction) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*cacheEntry)
+		entry.pred = pred
+		if near != nil {
+			entry.near = near
+		}
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&cacheEntry{key: key, pred: pred, near: near})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *maskCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// hashImage hashes the bounds and pixel content of img. Common image types
+// are hashed straight from their pixel buffers.
+func hashImage(img image.Image, salt string) uint64 {
+	var h maphash.Hash
+	h.SetSeed(hashSeed)
+	_, _ = h.WriteString(salt)
+
+	b := img.Bounds()
+	var buf [8]byte
+	for _, v := range []int{b.Min.X, b.Min.Y, b.Max.X, b.Max.Y} {
+		binary.LittleEndian.PutUint64(buf[:], uint64(v))
+		_, _ = h.Write(buf[:])
+	}
+
+	writeRows := func(pix []uint8, stride, rowLen int) {
+		for y := range b.Dy() {
+			_, _ = h.Write(pix[y*stride : y*stride+rowLen])
+		}
+	}
+
+	switch src := img.(type) {
+	case *image.RGBA:
+		writeRows(src.Pix, src.Stride, b.Dx()*4)
+	case *image.NRGBA:
+		writeRows(src.Pix, src.Stride, b.Dx()*4)
+	case *image.Gray:
+		writeRows(src.Pix, src.Stride, b.Dx())
+	case *image.CMYK:
+		writeRows(src.Pix, src.Stride, b.Dx()*4)
+	case *image.RGBA64:
+		writeRows(src.Pix, src.Stride, b.Dx()*8)
+	case *image.NRGBA64:
+		writeRows(src.Pix, src.Stride, b.Dx()*8)
+	case *image.YCbCr:
+		_, _ = h.Write(src.Y)
+		_, _ = h.Write(src.Cb)
+		_, _ = h.Write(src.Cr)
+	default:
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				r, g, bl, a := img.At(x, y).RGBA()
+				binary.LittleEndian.PutUint16(buf[0:], uint16(r))
+				binary.LittleEndian.PutUint16(buf[2:], uint16(g))
+				binary.LittleEndian.PutUint16(buf[4:], uint16(bl))
+				binary.LittleEndian.PutUint16(buf[6:], uint16(a))
+				_, _ = h.Write(buf[:])
+			}
+		}
+	}
+
+	return h.Sum64()
+}
@@ -0,0 +1,117 @@
+package rmbg
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestMaskCache(t *testing.T) {
+	c := newMaskCache(2)
+	a, b, d := &prediction{}, &prediction{}, &prediction{}
+
+	c.put(1, a)
+	c.put(2, b)
+	if got, ok := c.get(1); !ok || got != a {
+		t.Fatalf("expected cached prediction for key 1")
+	}
+
+	// Key 2 is now least recently used and gets evicted
+	c.put(3, d)
+	if _, ok := c.get(2); ok {
+		t.Errorf("expected key 2 to be evicted")
+	}
+	if _, ok := c.get(1); !ok {
+		t.Errorf("expected key 1 to survive eviction")
+	}
+	if c.len() != 2 {
+		t.Errorf("expected 2 entries, got %d", c.len())
+	}
+
+	c.put(1, d)
+	if got, _ := c.get(1); got != d {
+		t.Errorf("expected key 1 to be updated")
+	}
+}
+
+func TestHashImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	same := image.NewRGBA(image.Rect(0, 0, 10, 10))
+
+	if hashImage(img, "m") != hashImage(same, "m") {
+		t.Errorf("expected identical images to hash equally")
+	}
+	if hashImage(img, "m") == hashImage(img, "other") {
+		t.Errorf("expected salt to change the hash")
+	}
+
+	same.SetRGBA(3, 3, color.RGBA{1, 0, 0, 255})
+	if hashImage(img, "m") == hashImage(same, "m") {
+		t.Errorf("expected different pixels to change the hash")
+	}
+
+	if hashImage(img, "m") == hashImage(image.NewRGBA(image.Rect(0, 0, 20, 5)), "m") {
+		t.Errorf("expected different bounds to change the hash")
+	}
+
+	t.Run("GenericImage", func(t *testing.T) {
+		c1 := image.NewCMYK(image.Rect(0, 0, 4, 4))
+		c2 := image.NewCMYK(image.Rect(0, 0, 4, 4))
+		c2.SetCMYK(1, 1, color.CMYK{C: 200})
+		if hashImage(c1, "m") == hashImage(c2, "m") {
+			t.Errorf("expected generic path to hash pixel content")
+		}
+	})
+}
+
+func TestPredictUsesCache(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	m := &model{spec: ModelU2NetP}
+	r := &RemBG{model: m, cache: newMaskCache(4)}
+
+	cached := &prediction{mask: image.NewGray(image.Rect(0, 0, 1, 1))}
+	r.cache.put(hashImage(img, m.spec.Name), cached)
+
+	// The model has no session, so only a cache hit can succeed
+	pred, err := r.predict(img)
+	if err != nil {
+		t.Fatalf("predict failed: %v", err)
+	}
+	if pred != cached {
+		t.Errorf("expected cached prediction")
+	}
+}
+
+func TestPredictUsesNearDuplicate(t *testing.T) {
+	img := hashPattern(40, 30, false)
+	m := &model{spec: ModelU2NetP}
+	r := &RemBG{model: m, cache: newMaskCache(4)}
+	r.cache.distance = 4
+
+	cached := &prediction{mask: image.NewGray(image.Rect(0, 0, 1, 1))}
+	r.cache.putNear(hashImage(img, m.spec.Name), nearKeyOf(img, m.spec.Name), cached)
+
+	// The model has no session, so only a cache hit can succeed
+	shifted := imaging.AdjustBrightness(img, 5)
+	pred, err := r.predict(shifted)
+	if err != nil {
+		t.Fatalf("predict failed: %v", err)
+	}
+	if pred != cached {
+		t.Errorf("expected cached prediction")
+	}
+
+	for name, other := range map[string]image.Image{
+		"another size":  imaging.Resize(img, 20, 15, imaging.Linear),
+		"another image": hashPattern(40, 30, true),
+	} {
+		if _, ok := r.cache.getNear(nearKeyOf(other, m.spec.Name)); ok {
+			t.Errorf("expected no hit for %s", name)
+		}
+	}
+	if _, ok := r.cache.getNear(nearKeyOf(shifted, "other-model")); ok {
+		t.Errorf("expected no hit for another model")
+	}
+}
@@ -0,0 +1,122 @@
+package rmbg
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"slices"
+)
+
+// classTargets returns the indices of the classes of spec named by targets,
+// by default every class but the first, which multi-class models use for the
+// background. It returns nil for single-class models.
+func classTargets(spec ModelSpec, targets []string) ([]int, error) {
+	if len(spec.Classes) == 0 {
+		return nil, nil
+	}
+	if len(targets) == 0 {
+		indices := make([]int, len(spec.Classes)-1)
+		for i := range indices {
+			indices[i] = i + 1
+		}
+		return indices, nil
+	}
+	indices := make([]int, 0, len(targets))
+	for _, name := range targets {
+		i := slices.Index(spec.Classes, name)
+		if i < 0 {
+			return nil, fmt.Errorf("%s has no class %q (classes: %v)", spec.Name, name, spec.Classes)
+		}
+		if !slices.Contains(indices, i) {
+			indices = append(indices, i)
+		}
+	}
+	return indices, nil
+}
+
+// channels returns the number of output planes of the model
+func (s ModelSpec) channels() int {
+	return max(1, len(s.Classes))
+}
+
+// planeOf returns the values of kind m.spec.Output inside area of an output:
+// its single plane, or for multi-class models the probability of the target
+// classes
+func (m *model) planeOf(output []float32, area image.Rectangle) []float32 {
+	if len(m.spec.Classes) == 0 {
+		return m.areaOf(output, area)
+	}
+	probs := m.classProbabilities(output, area)
+	plane := probs[m.targets[0]]
+	for _, c := range m.targets[1:] {
+		for i, p := range probs[c] {
+			plane[i] += p
+		}
+	}
+	fromProbabilities(plane, m.spec.Output)
+	return plane
+}
+
+// classProbabilities returns the softmax of the class planes of a multi-class
+// output inside area, one probability plane per class
+func (m *model) classProbabilities(output []float32, area image.Rectangle) [][]float32 {
+	n := m.spec.InputSize * m.spec.InputSize
+	logits := make([][]float32, len(m.spec.Classes))
+	probs := make([][]float32, len(m.spec.Classes))
+	for c := range logits {
+		logits[c] = m.areaOf(output[c*n:][:n], area)
+		probs[c] = make([]float32, len(logits[c]))
+	}
+	exps := make([]float64, len(logits))
+	for i := range probs[0] {
+		hi := logits[0][i]
+		for _, l := range logits[1:] {
+			hi = max(hi, l[i])
+		}
+		var sum float64
+		for c, l := range logits {
+			exps[c] = math.Exp(float64(l[i] - hi))
+			sum += exps[c]
+		}
+		for c, e := range exps {
+			probs[c][i] = float32(e / sum)
+		}
+	}
+	return probs
+}
+
+// ClassMasks runs a multi-class model on img and returns the probability mask
+// of each of its classes, at the resolution of img, keyed by class name
+func (r *RemBG) ClassMasks(img image.Image) (map[string]*image.Gray, error) {
+	m := r.acquireModel()
+	defer m.release()
+	if len(m.spec.Classes) == 0 {
+		return nil, fmt.Errorf("%w: %s has no classes", ErrUnsupportedModel, m.spec.Name)
+	}
+	src := img
+	if len(r.preProcessors) > 0 {
+		var err error
+		if src, err = r.preProcess(img); err != nil {
+			return nil, err
+		}
+	}
+
+	area := m.inputArea(src.Bounds().Size())
+	output, err := m.infer(m.preprocess(src, area))
+	if err != nil {
+		return nil, r.countError("", err)
+	}
+	probs := m.classProbabilities(*output, area)
+	m.outputs.put(output)
+
+	b := img.Bounds()
+	masks := make(map[string]*image.Gray, len(probs))
+	for c, name := range m.spec.Classes {
+		mask := image.NewGray(image.Rect(0, 0, area.Dx(), area.Dy()))
+		for i, p := range probs[c] {
+			mask.Pix[i] = uint8(p*255 + 0.5)
+		}
+		masks[name] = r.resizeGrayBlur5O(mask, b.Dx(), b.Dy())
+	}
+	return masks, nil
+}
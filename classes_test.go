@@ -0,0 +1,162 @@
+package rmbg
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// classBackend outputs background, person and product logits: each class is
+// sure of one third of the columns
+type classBackend struct{ size int }
+
+func (b classBackend) Run(input, output []float32) error {
+	n := b.size * b.size
+	if len(output) != 3*n {
+		return fmt.Errorf("expected %d output values, got %d", 3*n, len(output))
+	}
+	for c := range 3 {
+		for i := range n {
+			output[c*n+i] = -5
+			if (i%b.size)*3/b.size == c {
+				output[c*n+i] = 5
+			}
+		}
+	}
+	return nil
+}
+
+func TestTargetClasses(t *testing.T) {
+	spec := ModelSpec{
+		Name:       "classes",
+		InputName:  "in",
+		OutputName: "out",
+		InputSize:  24,
+		Output:     OutputAlpha,
+		Classes:    []string{"background", "person", "product"},
+	}
+	src := solidImage(24, 24, color.NRGBA{R: 90, G: 120, B: 30, A: 255})
+	columns := func(t *testing.T, mask *image.Gray) [3]uint8 {
+		t.Helper()
+		return [3]uint8{mask.GrayAt(4, 12).Y, mask.GrayAt(12, 12).Y, mask.GrayAt(20, 12).Y}
+	}
+
+	for _, tt := range []struct {
+		name    string
+		targets []string
+		want    [3]bool
+	}{
+		{"Default", nil, [3]bool{false, true, true}},
+		{"Product", []string{"product"}, [3]bool{false, false, true}},
+		{"PersonAndBackground", []string{"person", "background", "person"}, [3]bool{true, true, false}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := New(&Config{Backend: classBackend{24}, Model: &spec, TargetClasses: tt.targets})
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+			defer r.Close()
+			pred, err := r.predict(src)
+			if err != nil {
+				t.Fatalf("predict failed: %v", err)
+			}
+			for i, v := range columns(t, pred.mask) {
+				if (v > 128) != tt.want[i] {
+					t.Errorf("expected foreground %v in third %d, got mask value %d", tt.want[i], i, v)
+				}
+			}
+		})
+	}
+
+	t.Run("Logits", func(t *testing.T) {
+		logits := spec
+		logits.Output = OutputLogits
+		r, err := New(&Config{Backend: classBackend{24}, Model: &logits, TargetClasses: []string{"person"}})
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		defer r.Close()
+		pred, err := r.predict(src)
+		if err != nil {
+			t.Fatalf("predict failed: %v", err)
+		}
+		if got := columns(t, pred.mask); got != [3]uint8{0, 255, 0} {
+			t.Errorf("expected binary mask of the person, got %v", got)
+		}
+	})
+
+	t.Run("UnknownClass", func(t *testing.T) {
+		if _, err := New(&Config{Backend: classBackend{24}, Model: &spec, TargetClasses: []string{"car"}}); err == nil {
+			t.Error("expected error for unknown class")
+		}
+	})
+
+	t.Run("SingleClassModel", func(t *testing.T) {
+		_, err := New(&Config{Backend: &squareBackend{}, TargetClasses: []string{"person"}})
+		if !errors.Is(err, ErrUnsupportedModel) {
+			t.Errorf("expected ErrUnsupportedModel, got %v", err)
+		}
+	})
+
+	t.Run("OneClass", func(t *testing.T) {
+		one := spec
+		one.Classes = []string{"person"}
+		if err := validateSpec(one); !errors.Is(err, ErrUnsupportedModel) {
+			t.Errorf("expected ErrUnsupportedModel, got %v", err)
+		}
+	})
+}
+
+func TestClassMasks(t *testing.T) {
+	spec := ModelSpec{
+		Name:       "classes",
+		InputName:  "in",
+		OutputName: "out",
+		InputSize:  24,
+		Output:     OutputAlpha,
+		Classes:    []string{"background", "person", "product"},
+	}
+	r, err := New(&Config{Backend: classBackend{24}, Model: &spec})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer r.Close()
+
+	src := solidImage(48, 36, color.NRGBA{R: 90, G: 120, B: 30, A: 255})
+	masks, err := r.ClassMasks(src)
+	if err != nil {
+		t.Fatalf("ClassMasks failed: %v", err)
+	}
+	if len(masks) != 3 {
+		t.Fatalf("expected 3 masks, got %d", len(masks))
+	}
+	for i, name := range spec.Classes {
+		mask := masks[name]
+		if mask == nil {
+			t.Fatalf("expected a mask for %q", name)
+		}
+		if mask.Bounds() != image.Rect(0, 0, 48, 36) {
+			t.Errorf("expected mask of the image size, got %v", mask.Bounds())
+		}
+		x := i*16 + 8
+		if v := mask.GrayAt(x, 18).Y; v < 200 {
+			t.Errorf("expected %q at x=%d, got %d", name, x, v)
+		}
+		if v := mask.GrayAt((x+16)%48, 18).Y; v > 55 {
+			t.Errorf("expected no %q at x=%d, got %d", name, (x+16)%48, v)
+		}
+	}
+
+	t.Run("SingleClassModel", func(t *testing.T) {
+		r, err := New(&Config{Backend: &squareBackend{}})
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		defer r.Close()
+		if _, err := r.ClassMasks(src); !errors.Is(err, ErrUnsupportedModel) {
+			t.Errorf("expected ErrUnsupportedModel, got %v", err)
+		}
+	})
+}
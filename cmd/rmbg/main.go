@@ -0,0 +1,436 @@
+// Command rmbg removes image backgrounds from the command line.
+//
+//	rmbg remove -i in.jpg -o out.png
+//	rmbg remove -i photos/ -o cutouts/ --bg white --format jpg
+//	rmbg crop -i 'shots/*.jpg' -o crops/ --margin 5% --square
+//
+// Inputs are files, directories (processed recursively) or glob patterns.
+// The exit code is 0 when every image succeeded, 1 when some failed and 2 on
+// usage errors.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/josuedeavila/rmbg"
+)
+
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+// errUsage marks errors caused by invalid arguments
+var errUsage = errors.New("usage error")
+
+var models = map[string]rmbg.ModelSpec{
+	rmbg.ModelU2NetP.Name:        rmbg.ModelU2NetP,
+	rmbg.ModelU2Net.Name:         rmbg.ModelU2Net,
+	rmbg.ModelU2NetHumanSeg.Name: rmbg.ModelU2NetHumanSeg,
+	rmbg.ModelMODNet.Name:        rmbg.ModelMODNet,
+	rmbg.ModelClothSeg.Name:      rmbg.ModelClothSeg,
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+func usage(w io.Writer) {
+	fmt.Fprint(w, `Usage: rmbg <command> [flags] [inputs...]
+
+Commands:
+  remove  remove the background of images
+  crop    remove the background and smart crop around the object
+
+Run 'rmbg <command> -h' for the flags of a command.
+`)
+}
+
+// options are the parsed flags of a command
+type options struct {
+	inputs       []string
+	output       string
+	model        string
+	modelPath    string
+	ortLib       string
+	background   string
+	format       string
+	quality      int
+	lossless     bool
+	depth        int
+	convertColor bool
+	exposure     rmbg.Exposure
+	denoise      bool
+	shadow       bool
+	reflection   bool
+	despill      string
+	sidecar      bool
+	dpi          float64
+	workers      int
+	skipExisting bool
+	contentNames bool
+	manifest     string
+	state        string
+	resume       bool
+	quiet        bool
+
+	// crop only
+	margin    string
+	square    bool
+	threshold int
+	fallback  bool
+}
+
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return exitUsage
+	}
+	cmd := args[0]
+	if cmd == "-h" || cmd == "--help" || cmd == "help" {
+		usage(stdout)
+		return exitOK
+	}
+	if cmd != "remove" && cmd != "crop" {
+		fmt.Fprintf(stderr, "rmbg: unknown command %q\n\n", cmd)
+		usage(stderr)
+		return exitUsage
+	}
+
+	opts, err := parseFlags(cmd, args[1:], stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "rmbg %s: %v\n", cmd, err)
+		return exitUsage
+	}
+
+	failed, err := process(ctx, cmd, opts, stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "rmbg %s: %v\n", cmd, err)
+		if errors.Is(err, errUsage) {
+			return exitUsage
+		}
+		return exitFailure
+	}
+	if failed > 0 {
+		return exitFailure
+	}
+	return exitOK
+}
+
+func parseFlags(cmd string, args []string, stderr io.Writer) (*options, error) {
+	fs := flag.NewFlagSet("rmbg "+cmd, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	opts := &options{}
+	var input, exposure string
+	fs.StringVar(&input, "i", "", "input file, directory or glob pattern (inputs may also be given as arguments)")
+	fs.StringVar(&opts.output, "o", "", "output file, or directory for several inputs (default: next to each input with a _nobg suffix)")
+	fs.StringVar(&opts.model, "model", rmbg.ModelU2NetP.Name, "model: u2netp, u2net, u2net_human_seg or modnet")
+	fs.StringVar(&opts.modelPath, "model-path", "", "path to the ONNX model (default: $RMBG_MODEL_DIR/<model>.onnx, or models/<model>.onnx)")
+	fs.StringVar(&opts.ortLib, "ort-lib", "", "path to the ONNX Runtime shared library (default: $"+rmbg.LibraryPathEnv+")")
+	fs.StringVar(&opts.background, "bg", "transparent", "background: transparent, white, black or #rrggbb")
+	fs.StringVar(&opts.format, "format", "", "output format: png, jpg, webp, avif, tiff, psd, ora or svg (default: from the output extension, else png)")
+	fs.IntVar(&opts.quality, "quality", rmbg.DefaultJPEGQuality, "JPEG, lossy WebP and AVIF quality from 1 to 100")
+	fs.BoolVar(&opts.lossless, "lossless", false, "encode WebP output losslessly")
+	fs.IntVar(&opts.depth, "depth", 8, "bits per channel of TIFF output: 8 or 16")
+	fs.Float64Var(&opts.dpi, "dpi", 0, "resolution of JPEG, PNG and TIFF output in dots per inch (default: the input's)")
+	fs.BoolVar(&opts.convertColor, "convert-color", false, "run the model on wide-gamut inputs converted to sRGB, keeping their color space in the output")
+	fs.StringVar(&exposure, "exposure", "off", "normalize exposure before segmentation, for dark or hazy photos: off, stretch or clahe")
+	fs.BoolVar(&opts.denoise, "denoise", false, "smooth sensor noise before segmentation, for high-ISO photos")
+	fs.BoolVar(&opts.shadow, "shadow", false, "keep the soft shadow under the object at reduced opacity")
+	fs.BoolVar(&opts.reflection, "reflection", false, "add a fading reflection of the object below it")
+	fs.StringVar(&opts.despill, "despill", "", "remove the cast of a green or blue screen from the object edges: green or blue")
+	fs.BoolVar(&opts.sidecar, "sidecar", false, "write a JSON sidecar with the bounding box, contour, area, confidence, model and timing next to each output")
+	fs.IntVar(&opts.workers, "workers", 0, "images of a directory processed at once (default: sessions plus one)")
+	fs.BoolVar(&opts.skipExisting, "skip-existing", false, "skip inputs whose output already exists")
+	fs.BoolVar(&opts.contentNames, "content-names", false, "name the outputs of a directory after the hash of their input and settings")
+	fs.StringVar(&opts.manifest, "manifest", "", "write a JSON manifest mapping the inputs of a directory to their outputs and settings to this path, relative to the output directory")
+	fs.StringVar(&opts.state, "state", "", "record the completed inputs of a directory in this file, relative to the output directory, for -resume")
+	fs.BoolVar(&opts.resume, "resume", false, "skip the inputs of a directory completed by a previous run (default state file: "+rmbg.DefaultStateFile+")")
+	fs.BoolVar(&opts.quiet, "q", false, "do not print progress")
+	if cmd == "crop" {
+		fs.StringVar(&opts.margin, "margin", "20", "margin around the object in pixels, or as a percentage like 5%")
+		fs.BoolVar(&opts.square, "square", false, "pad the crop to a square")
+		fs.IntVar(&opts.threshold, "threshold", 10, "mask value from 0 to 255 above which a pixel belongs to the object")
+		fs.BoolVar(&opts.fallback, "fallback", false, "when no object is found, retry with a lower threshold, then the automatic mask, then crop the full frame")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if input != "" {
+		opts.inputs = append(opts.inputs, input)
+	}
+	opts.inputs = append(opts.inputs, fs.Args()...)
+	if len(opts.inputs) == 0 {
+		return nil, errors.New("no input given")
+	}
+	if _, ok := models[opts.model]; !ok {
+		return nil, fmt.Errorf("unknown model %q", opts.model)
+	}
+	var err error
+	if opts.exposure, err = rmbg.ParseExposure(exposure); err != nil {
+		return nil, err
+	}
+	if opts.threshold < 0 || opts.threshold > 255 {
+		return nil, fmt.Errorf("threshold %d is outside [0, 255]", opts.threshold)
+	}
+	return opts, nil
+}
+
+// process runs cmd on every input and returns the number of failed images
+func process(ctx context.Context, cmd string, opts *options, stderr io.Writer) (int, error) {
+	ioOpts, err := ioOptions(cmd, opts)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", errUsage, err)
+	}
+	format, err := outputFormat(opts)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", errUsage, err)
+	}
+	files, dirs, err := expandInputs(opts.inputs)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", errUsage, err)
+	}
+	if (opts.contentNames || opts.manifest != "" || opts.state != "" || opts.resume) && len(dirs) == 0 {
+		return 0, fmt.Errorf("%w: -content-names, -manifest, -state and -resume need a directory input", errUsage)
+	}
+	if opts.output != "" && (len(files) > 1 || len(dirs) > 0) && !isDir(opts.output) && filepath.Ext(opts.output) != "" {
+		return 0, fmt.Errorf("%w: output %s must be a directory for directory or multiple inputs", errUsage, opts.output)
+	}
+
+	engine, err := newEngine(opts)
+	if err != nil {
+		return 0, err
+	}
+	defer engine.Close()
+
+	several := len(files)+len(dirs) > 1
+	p := &progress{w: stderr, quiet: opts.quiet}
+	failed := 0
+	for _, dir := range dirs {
+		out := opts.output
+		switch {
+		case out == "":
+			out = strings.TrimRight(dir, `/\`) + "_nobg"
+		case several:
+			out = filepath.Join(out, filepath.Base(dir))
+		}
+		report, err := engine.ProcessDir(ctx, dir, out, &rmbg.DirOptions{
+			Workers:      opts.workers,
+			SkipExisting: opts.skipExisting,
+			ContentNames: opts.contentNames,
+			Manifest:     opts.manifest,
+			State:        opts.state,
+			Resume:       opts.resume,
+			Format:       format,
+			IO:           ioOpts,
+			Progress: func(f rmbg.FileResult, done, total int) {
+				p.file(f, done, total)
+			},
+		})
+		if err != nil && report == nil {
+			return failed, err
+		}
+		failed += report.Failed
+		if err != nil {
+			return failed, err
+		}
+	}
+
+	for i, in := range files {
+		if err := ctx.Err(); err != nil {
+			return failed + len(files) - i, err
+		}
+		res := rmbg.FileResult{Input: in, Output: outputPath(in, opts.output, format, several)}
+		start := time.Now()
+		if _, err := os.Stat(res.Output); opts.skipExisting && err == nil {
+			res.Skipped = true
+		} else {
+			if err := os.MkdirAll(filepath.Dir(res.Output), 0o755); err != nil {
+				res.Err = err
+			} else {
+				res.Err = engine.ProcessFile(in, res.Output, ioOpts)
+			}
+		}
+		res.Duration = time.Since(start)
+		if res.Err != nil {
+			failed++
+		}
+		p.file(res, i+1, len(files))
+	}
+	return failed, nil
+}
+
+func newEngine(opts *options) (*rmbg.RemBG, error) {
+	spec := models[opts.model]
+	path := opts.modelPath
+	if path == "" {
+		dir := os.Getenv("RMBG_MODEL_DIR")
+		if dir == "" {
+			dir = "models"
+		}
+		path = filepath.Join(dir, opts.model+".onnx")
+	}
+	config := &rmbg.Config{
+		ModelPath:      path,
+		Model:          &spec,
+		ORTLibraryPath: opts.ortLib,
+		MemPattern:     true,
+		Exposure:       opts.exposure,
+	}
+	if opts.denoise {
+		config.Denoise = &rmbg.Bilateral{}
+	}
+	if opts.shadow {
+		config.Shadow = &rmbg.ShadowOptions{}
+	}
+	return rmbg.New(config)
+}
+
+func ioOptions(cmd string, opts *options) (*rmbg.IOOptions, error) {
+	bg, err := rmbg.ParseColor(opts.background)
+	if err != nil {
+		return nil, err
+	}
+	if opts.quality < 1 || opts.quality > 100 {
+		return nil, fmt.Errorf("quality %d is outside [1, 100]", opts.quality)
+	}
+	if opts.dpi < 0 {
+		return nil, fmt.Errorf("dpi %v is negative", opts.dpi)
+	}
+	if opts.depth != 8 && opts.depth != 16 {
+		return nil, fmt.Errorf("depth %d is not 8 or 16", opts.depth)
+	}
+	ioOpts := &rmbg.IOOptions{
+		Background:   bg,
+		JPEGQuality:  opts.quality,
+		WebPQuality:  opts.quality,
+		WebPLossless: opts.lossless,
+		AVIFQuality:  opts.quality,
+		TIFF16:       opts.depth == 16,
+		ConvertColor: opts.convertColor,
+		DPI:          opts.dpi,
+		Sidecar:      opts.sidecar,
+	}
+	if opts.reflection {
+		ioOpts.Reflection = &rmbg.ReflectionOptions{}
+	}
+	if opts.despill != "" {
+		screen, err := rmbg.ParseScreen(opts.despill)
+		if err != nil {
+			return nil, err
+		}
+		ioOpts.Despill = &rmbg.DespillOptions{Screen: screen}
+	}
+	if cmd == "crop" {
+		crop := &rmbg.CropConfig{MinThreshold: uint8(opts.threshold), SquarePad: opts.square}
+		if opts.fallback {
+			crop.Fallbacks = rmbg.DefaultFallbacks
+		}
+		if crop.Margin, crop.MarginPercent, err = rmbg.ParseMargin(opts.margin); err != nil {
+			return nil, err
+		}
+		if err := crop.Validate(); err != nil {
+			return nil, err
+		}
+		ioOpts.Crop = crop
+	}
+	return ioOpts, nil
+}
+
+// outputFormat is the format named by --format, or implied by the output
+// extension
+func outputFormat(opts *options) (rmbg.Format, error) {
+	if opts.format != "" {
+		return rmbg.ParseFormat(opts.format)
+	}
+	if ext := filepath.Ext(opts.output); ext != "" && !isDir(opts.output) {
+		return rmbg.FormatFromPath(opts.output)
+	}
+	return rmbg.FormatPNG, nil
+}
+
+// expandInputs splits the inputs into files and directories, expanding glob
+// patterns
+func expandInputs(inputs []string) (files, dirs []string, err error) {
+	for _, in := range inputs {
+		matches := []string{in}
+		if strings.ContainsAny(in, "*?[") {
+			if matches, err = filepath.Glob(in); err != nil {
+				return nil, nil, fmt.Errorf("invalid pattern %q: %w", in, err)
+			}
+			if len(matches) == 0 {
+				return nil, nil, fmt.Errorf("no file matches %s", in)
+			}
+		}
+		for _, m := range matches {
+			info, err := os.Stat(m)
+			if err != nil {
+				return nil, nil, err
+			}
+			if info.IsDir() {
+				dirs = append(dirs, m)
+			} else {
+				files = append(files, m)
+			}
+		}
+	}
+	return files, dirs, nil
+}
+
+// outputPath is where the output of the file in is written. Without an
+// output, it goes next to in with a _nobg suffix; with several inputs or a
+// directory output, into that directory.
+func outputPath(in, output string, format rmbg.Format, several bool) string {
+	ext := "." + format.String()
+	if format == rmbg.FormatJPEG {
+		ext = ".jpg"
+	}
+	stem := strings.TrimSuffix(filepath.Base(in), filepath.Ext(in))
+	switch {
+	case output == "":
+		return filepath.Join(filepath.Dir(in), stem+"_nobg"+ext)
+	case several || isDir(output) || strings.HasSuffix(output, "/") || strings.HasSuffix(output, string(filepath.Separator)):
+		return filepath.Join(output, stem+ext)
+	}
+	return output
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// progress prints one line per finished image
+type progress struct {
+	w     io.Writer
+	quiet bool
+}
+
+func (p *progress) file(f rmbg.FileResult, done, total int) {
+	switch {
+	case f.Err != nil:
+		fmt.Fprintf(p.w, "[%d/%d] %s: %v\n", done, total, f.Input, f.Err)
+	case p.quiet:
+	case f.Skipped:
+		fmt.Fprintf(p.w, "[%d/%d] %s: skipped, %s exists\n", done, total, f.Input, f.Output)
+	default:
+		fmt.Fprintf(p.w, "[%d/%d] %s -> %s (%s)\n", done, total, f.Input, f.Output, f.Duration.Round(time.Millisecond))
+	}
+}
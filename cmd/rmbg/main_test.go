@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/josuedeavila/rmbg"
+)
+
+func TestRunExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.png")
+	if err := os.WriteFile(input, []byte("png"), 0o644); err != nil {
+		t.Fatalf("failed to write input: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"NoArgs", nil, exitUsage},
+		{"Help", []string{"help"}, exitOK},
+		{"CommandHelp", []string{"remove", "-h"}, exitOK},
+		{"UnknownCommand", []string{"paint"}, exitUsage},
+		{"NoInput", []string{"remove"}, exitUsage},
+		{"UnknownModel", []string{"remove", "-model", "yolo", input}, exitUsage},
+		{"BadBackground", []string{"remove", "-bg", "sky", input}, exitUsage},
+		{"BadMargin", []string{"crop", "-margin", "lots", input}, exitUsage},
+		{"BadDespill", []string{"remove", "-despill", "purple", input}, exitUsage},
+		{"BadExposure", []string{"remove", "-exposure", "auto", input}, exitUsage},
+		{"MissingInput", []string{"remove", filepath.Join(dir, "missing.png")}, exitUsage},
+		{"ManifestWithoutDir", []string{"remove", "-manifest", "m.json", input}, exitUsage},
+		{"ResumeWithoutDir", []string{"remove", "-resume", input}, exitUsage},
+		{"MissingModel", []string{"remove", "-model-path", filepath.Join(dir, "missing.onnx"), input}, exitFailure},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if got := run(context.Background(), tt.args, &stdout, &stderr); got != tt.want {
+				t.Errorf("expected exit code %d, got %d (stderr: %s)", tt.want, got, stderr.String())
+			}
+		})
+	}
+}
+
+func TestOutputPath(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join("shots", "cat.jpeg")
+	tests := []struct {
+		output  string
+		format  rmbg.Format
+		several bool
+		want    string
+	}{
+		{"", rmbg.FormatPNG, false, filepath.Join("shots", "cat_nobg.png")},
+		{"out.jpg", rmbg.FormatJPEG, false, "out.jpg"},
+		{dir, rmbg.FormatPNG, false, filepath.Join(dir, "cat.png")},
+		{"cutouts", rmbg.FormatJPEG, true, filepath.Join("cutouts", "cat.jpg")},
+		{"cutouts", rmbg.FormatWebP, true, filepath.Join("cutouts", "cat.webp")},
+		{"cutouts", rmbg.FormatTIFF, true, filepath.Join("cutouts", "cat.tiff")},
+	}
+	for _, tt := range tests {
+		if got := outputPath(in, tt.output, tt.format, tt.several); got != tt.want {
+			t.Errorf("expected %s for output %q, got %s", tt.want, tt.output, got)
+		}
+	}
+}
+
+func TestUsage(t *testing.T) {
+	var stdout bytes.Buffer
+	run(context.Background(), []string{"help"}, &stdout, &bytes.Buffer{})
+	if !strings.Contains(stdout.String(), "remove") || !strings.Contains(stdout.String(), "crop") {
+		t.Errorf("expected usage to list commands, got %q", stdout.String())
+	}
+}
@@ -0,0 +1,76 @@
+package rmbg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// ColorPopOptions configures ColorPop
+type ColorPopOptions struct {
+	// Saturation is the share of its original saturation the background
+	// keeps, from 0 for grayscale to 1 for unchanged colors (default: 0)
+	Saturation float64
+	// Tint multiplies the desaturated background, e.g. a sepia tone; white
+	// parts of the background take the tint color (default: none)
+	Tint color.Color
+}
+
+// ColorPop segments img and keeps its subject in color while the background
+// turns gray or tinted, see ColorPopWithMask
+func (r *RemBG) ColorPop(img image.Image, opts *ColorPopOptions) (*image.NRGBA, error) {
+	pred, err := r.predict(img)
+	if err != nil {
+		return nil, err
+	}
+	mask := r.upsampleMask(pred.mask, img)
+	defer r.outputs.putPix(mask.Pix)
+	return ColorPopWithMask(img, mask, opts)
+}
+
+// ColorPopWithMask keeps the subject of img given by mask in color and
+// desaturates the rest. Mask values blend the two, so soft edges and hair
+// fade from color to gray instead of showing a halo; the mask may have any
+// resolution. Alpha is kept.
+func ColorPopWithMask(img image.Image, mask *image.Gray, opts *ColorPopOptions) (*image.NRGBA, error) {
+	var o ColorPopOptions
+	if opts != nil {
+		o = *opts
+	}
+	if mask == nil || mask.Bounds().Empty() {
+		return nil, fmt.Errorf("mask image is nil or empty")
+	}
+	if o.Saturation < 0 || o.Saturation > 1 {
+		return nil, fmt.Errorf("saturation %g is outside [0, 1]", o.Saturation)
+	}
+	tint := [3]float32{1, 1, 1}
+	if o.Tint != nil {
+		c := color.NRGBAModel.Convert(o.Tint).(color.NRGBA)
+		tint = [3]float32{float32(c.R) / 255, float32(c.G) / 255, float32(c.B) / 255}
+	}
+
+	dst := toNRGBA(img)
+	w, h := dst.Rect.Dx(), dst.Rect.Dy()
+	mask = fitMask(mask, w, h)
+	mb := mask.Bounds()
+	sat := float32(o.Saturation)
+	parallelRows(h, func(start, end int) {
+		for y := start; y < end; y++ {
+			row := dst.Pix[y*dst.Stride:][:w*4]
+			m := mask.Pix[mask.PixOffset(mb.Min.X, mb.Min.Y+y):][:w]
+			for x, v := range m {
+				if v == 255 {
+					continue
+				}
+				p := row[x*4 : x*4+3 : x*4+3]
+				a := float32(v) / 255
+				l := lumaOf(p[0], p[1], p[2]) * 255
+				for c := range p {
+					bg := (l + sat*(float32(p[c])-l)) * tint[c]
+					p[c] = uint8(min(float32(p[c])*a+bg*(1-a)+0.5, 255))
+				}
+			}
+		}
+	})
+	return dst, nil
+}
@@ -0,0 +1,77 @@
+package rmbg
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestColorPop(t *testing.T) {
+	red := color.NRGBA{R: 200, G: 40, B: 40, A: 255}
+	img := solidImage(20, 20, red)
+	mask := image.NewGray(img.Rect)
+	fillRect(mask, image.Rect(0, 0, 10, 20), 255)
+	fillRect(mask, image.Rect(10, 0, 12, 20), 128)
+	gray := uint8(lumaOf(red.R, red.G, red.B)*255 + 0.5)
+
+	t.Run("Grayscale", func(t *testing.T) {
+		out, err := ColorPopWithMask(img, mask, nil)
+		if err != nil {
+			t.Fatalf("ColorPopWithMask failed: %v", err)
+		}
+		if c := out.NRGBAAt(5, 5); c != red {
+			t.Errorf("expected the subject unchanged, got %v", c)
+		}
+		if c := out.NRGBAAt(15, 5); c != (color.NRGBA{gray, gray, gray, 255}) {
+			t.Errorf("expected gray %d, got %v", gray, c)
+		}
+		if c := out.NRGBAAt(10, 5); c.R <= gray || c.R >= red.R || c.G <= red.G || c.G >= gray {
+			t.Errorf("expected a blend at the soft edge, got %v", c)
+		}
+		if c := img.NRGBAAt(15, 5); c != red {
+			t.Errorf("expected the input unchanged, got %v", c)
+		}
+	})
+
+	t.Run("Saturation", func(t *testing.T) {
+		out, err := ColorPopWithMask(img, mask, &ColorPopOptions{Saturation: 1})
+		if err != nil {
+			t.Fatalf("ColorPopWithMask failed: %v", err)
+		}
+		if c := out.NRGBAAt(15, 5); c != red {
+			t.Errorf("expected colors kept, got %v", c)
+		}
+		if _, err := ColorPopWithMask(img, mask, &ColorPopOptions{Saturation: 2}); err == nil {
+			t.Error("expected error for saturation above 1")
+		}
+	})
+
+	t.Run("Tint", func(t *testing.T) {
+		out, err := ColorPopWithMask(img, mask, &ColorPopOptions{Tint: color.NRGBA{R: 255, G: 128, B: 0, A: 255}})
+		if err != nil {
+			t.Fatalf("ColorPopWithMask failed: %v", err)
+		}
+		c := out.NRGBAAt(15, 5)
+		if c.R != gray || c.B != 0 || c.G < gray/2-1 || c.G > gray/2+1 {
+			t.Errorf("expected gray %d tinted orange, got %v", gray, c)
+		}
+	})
+
+	t.Run("Engine", func(t *testing.T) {
+		r, err := New(&Config{Backend: topBackend{}})
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		defer r.Close()
+		out, err := r.ColorPop(img, nil)
+		if err != nil {
+			t.Fatalf("ColorPop failed: %v", err)
+		}
+		if c := out.NRGBAAt(10, 2); c != red {
+			t.Errorf("expected the subject in color, got %v", c)
+		}
+		if c := out.NRGBAAt(10, 18); c.R != c.G || c.G != c.B {
+			t.Errorf("expected a gray background, got %v", c)
+		}
+	})
+}
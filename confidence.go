@@ -0,0 +1,63 @@
+package rmbg
+
+// Confidence summarizes how clearly a model separated object from background.
+// Low scores usually mean the mask should be reviewed manually.
+type Confidence struct {
+	// MeanForeground is the mean probability of the pixels classified as object
+	MeanForeground float64 `json:"mean_foreground"`
+	// AreaRatio is the fraction of the frame classified as object
+	AreaRatio float64 `json:"area_ratio"`
+	// Separability is Otsu's between-class variance over the total variance (0-1)
+	Separability float64 `json:"separability"`
+	// Score combines the metrics above into a single 0-1 value
+	Score float64 `json:"score"`
+}
+
+const (
+	// masks covering less than this fraction of the frame are suspicious
+	minReliableArea = 0.01
+	// masks covering more than 1 - this fraction of the frame are suspicious
+	maxReliableArea = 0.02
+)
+
+// computeConfidence derives confidence metrics from per-pixel probabilities
+// and the threshold that was used to binarize them
+func computeConfidence(probs []float32, threshold float32) Confidence {
+	if len(probs) == 0 {
+		return Confidence{}
+	}
+
+	var sumB, sumF, sumSq float64
+	var nB, nF int
+	for _, p := range probs {
+		v := float64(p)
+		sumSq += v * v
+		if p > threshold {
+			sumF += v
+			nF++
+		} else {
+			sumB += v
+			nB++
+		}
+	}
+
+	n := float64(len(probs))
+	c := Confidence{AreaRatio: float64(nF) / n}
+	if nF == 0 {
+		return c
+	}
+	c.MeanForeground = sumF / float64(nF)
+
+	meanAll := (sumB + sumF) / n
+	totalVar := sumSq/n - meanAll*meanAll
+	if nB > 0 && totalVar > 1e-12 {
+		wB, wF := float64(nB)/n, float64(nF)/n
+		d := sumB/float64(nB) - c.MeanForeground
+		c.Separability = min(1, wB*wF*d*d/totalVar)
+	}
+
+	areaFactor := min(1, c.AreaRatio/minReliableArea) * min(1, (1-c.AreaRatio)/maxReliableArea)
+	c.Score = c.MeanForeground * c.Separability * areaFactor
+
+	return c
+}
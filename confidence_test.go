@@ -0,0 +1,56 @@
+package rmbg
+
+import (
+	"testing"
+)
+
+func TestComputeConfidence(t *testing.T) {
+	t.Run("Empty", func(t *testing.T) {
+		c := computeConfidence(nil, 0.5)
+		if c != (Confidence{}) {
+			t.Errorf("expected zero confidence, got %+v", c)
+		}
+	})
+
+	t.Run("ClearSeparation", func(t *testing.T) {
+		probs := make([]float32, 100)
+		for i := range 30 {
+			probs[i] = 0.99
+		}
+		for i := 30; i < 100; i++ {
+			probs[i] = 0.01
+		}
+		c := computeConfidence(probs, 0.5)
+		if c.AreaRatio != 0.3 {
+			t.Errorf("expected area ratio 0.3, got %f", c.AreaRatio)
+		}
+		if c.Separability < 0.99 {
+			t.Errorf("expected high separability, got %f", c.Separability)
+		}
+		if c.Score < 0.9 {
+			t.Errorf("expected high score, got %f", c.Score)
+		}
+	})
+
+	t.Run("Ambiguous", func(t *testing.T) {
+		probs := make([]float32, 100)
+		for i := range probs {
+			probs[i] = 0.45 + float32(i%10)*0.01
+		}
+		c := computeConfidence(probs, 0.5)
+		if c.Score > 0.6 {
+			t.Errorf("expected low score for ambiguous probabilities, got %f", c.Score)
+		}
+	})
+
+	t.Run("FullFrame", func(t *testing.T) {
+		probs := make([]float32, 100)
+		for i := range probs {
+			probs[i] = 0.9
+		}
+		c := computeConfidence(probs, 0.5)
+		if c.Score != 0 {
+			t.Errorf("expected zero score when everything is foreground, got %f", c.Score)
+		}
+	})
+}
@@ -0,0 +1,325 @@
+package rmbg
+
+import (
+	"image"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Point is a sub-pixel position in image coordinates
+type Point struct {
+	X, Y float64
+}
+
+// Polygon is a closed outline; the last point connects back to the first
+type Polygon []Point
+
+// ContourConfig configures contour extraction
+type ContourConfig struct {
+	// Threshold is the mask value at or above which a pixel is inside the object (default: 128)
+	Threshold uint8
+	// Tolerance is the Douglas-Peucker simplification distance in pixels (default: 1.0, negative disables)
+	Tolerance float64
+	// MinArea discards polygons whose enclosed area in pixels is smaller than this value
+	MinArea float64
+}
+
+// Area returns the signed area of the polygon (shoelace formula)
+func (p Polygon) Area() float64 {
+	if len(p) < 3 {
+		return 0
+	}
+	sum := 0.0
+	for i := range p {
+		j := (i + 1) % len(p)
+		sum += p[i].X*p[j].Y - p[j].X*p[i].Y
+	}
+	return sum / 2
+}
+
+// ExtractContours traces the outlines of the object in a mask using marching squares
+// and simplifies them with Douglas-Peucker. Holes are returned with the opposite
+// winding of outer boundaries, so the result can be filled with the nonzero rule.
+func ExtractContours(mask *image.Gray, config *ContourConfig) []Polygon {
+	if config == nil {
+		config = &ContourConfig{
+			Threshold: 128,
+			Tolerance: 1.0,
+		}
+	}
+	if mask == nil {
+		return nil
+	}
+
+	bounds := mask.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == 0 || h == 0 {
+		return nil
+	}
+
+	threshold := config.Threshold
+	if threshold == 0 {
+		threshold = 128
+	}
+
+	// value samples the mask with a zero border so every contour is closed
+	value := func(x, y int) float64 {
+		if x < 0 || y < 0 || x >= w || y >= h {
+			return 0
+		}
+		return float64(mask.Pix[y*mask.Stride+x])
+	}
+	inside := func(x, y int) bool {
+		return value(x, y) >= float64(threshold)
+	}
+
+	// Corners of the padded grid run from -1 to w (and -1 to h)
+	gridW := w + 2
+	hKey := func(x, y int) int { return ((y+1)*gridW + (x + 1)) * 2 }
+	vKey := func(x, y int) int { return ((y+1)*gridW+(x+1))*2 + 1 }
+
+	thr := float64(threshold) - 0.5
+	interp := func(a, b float64) float64 {
+		if a == b {
+			return 0.5
+		}
+		return math.Max(0, math.Min(1, (thr-a)/(b-a)))
+	}
+
+	points := make(map[int]Point)
+	next := make(map[int]int)
+	var order []int
+
+	edgePoint := func(key, x, y int, horizontal bool) {
+		if _, ok := points[key]; ok {
+			return
+		}
+		if horizontal {
+			t := interp(value(x, y), value(x+1, y))
+			points[key] = Point{X: float64(x) + t, Y: float64(y)}
+		} else {
+			t := interp(value(x, y), value(x, y+1))
+			points[key] = Point{X: float64(x), Y: float64(y) + t}
+		}
+	}
+
+	for y := -1; y < h; y++ {
+		for x := -1; x < w; x++ {
+			idx := 0
+			if inside(x, y) {
+				idx |= 8
+			}
+			if inside(x+1, y) {
+				idx |= 4
+			}
+			if inside(x+1, y+1) {
+				idx |= 2
+			}
+			if inside(x, y+1) {
+				idx |= 1
+			}
+			if idx == 0 || idx == 15 {
+				continue
+			}
+
+			top, right := hKey(x, y), vKey(x+1, y)
+			bottom, left := hKey(x, y+1), vKey(x, y)
+			edgePoint(top, x, y, true)
+			edgePoint(right, x+1, y, false)
+			edgePoint(bottom, x, y+1, true)
+			edgePoint(left, x, y, false)
+
+			// Segments are oriented so the object always lies to the left
+			link := func(from, to int) {
+				next[from] = to
+				order = append(order, from)
+			}
+			switch idx {
+			case 1:
+				link(bottom, left)
+			case 2:
+				link(right, bottom)
+			case 3:
+				link(right, left)
+			case 4:
+				link(top, right)
+			case 6:
+				link(top, bottom)
+			case 7:
+				link(top, left)
+			case 8:
+				link(left, top)
+			case 9:
+				link(bottom, top)
+			case 11:
+				link(right, top)
+			case 12:
+				link(left, right)
+			case 13:
+				link(bottom, right)
+			case 14:
+				link(left, bottom)
+			case 5, 10:
+				center := (value(x, y) + value(x+1, y) + value(x+1, y+1) + value(x, y+1)) / 4
+				connected := center >= thr
+				switch {
+				case idx == 5 && connected:
+					link(top, left)
+					link(bottom, right)
+				case idx == 5:
+					link(top, right)
+					link(bottom, left)
+				case connected:
+					link(right, top)
+					link(left, bottom)
+				default:
+					link(left, top)
+					link(right, bottom)
+				}
+			}
+		}
+	}
+
+	offX := float64(bounds.Min.X) + 0.5
+	offY := float64(bounds.Min.Y) + 0.5
+
+	var polygons []Polygon
+	for _, start := range order {
+		if _, ok := next[start]; !ok {
+			continue
+		}
+		var poly Polygon
+		key := start
+		for {
+			to, ok := next[key]
+			if !ok {
+				break
+			}
+			delete(next, key)
+			p := points[key]
+			poly = append(poly, Point{X: p.X + offX, Y: p.Y + offY})
+			key = to
+		}
+		if len(poly) < 3 {
+			continue
+		}
+		if config.Tolerance >= 0 {
+			tolerance := config.Tolerance
+			if tolerance == 0 {
+				tolerance = 1.0
+			}
+			poly = simplifyClosed(poly, tolerance)
+		}
+		if len(poly) < 3 || math.Abs(poly.Area()) < config.MinArea {
+			continue
+		}
+		polygons = append(polygons, poly)
+	}
+
+	return polygons
+}
+
+// simplifyClosed runs Douglas-Peucker on a closed polygon by splitting it at the
+// point farthest from its first vertex
+func simplifyClosed(poly Polygon, tolerance float64) Polygon {
+	far, farDist := 0, -1.0
+	for i, p := range poly {
+		dx, dy := p.X-poly[0].X, p.Y-poly[0].Y
+		if d := dx*dx + dy*dy; d > farDist {
+			far, farDist = i, d
+		}
+	}
+	if far == 0 {
+		return poly
+	}
+
+	first := douglasPeucker(poly[:far+1], tolerance)
+	closing := append(append(Polygon{}, poly[far:]...), poly[0])
+	second := douglasPeucker(closing, tolerance)
+
+	out := make(Polygon, 0, len(first)+len(second))
+	out = append(out, first...)
+	out = append(out, second[1:len(second)-1]...)
+	return out
+}
+
+func douglasPeucker(points Polygon, tolerance float64) Polygon {
+	if len(points) < 3 {
+		return points
+	}
+
+	keep := make([]bool, len(points))
+	keep[0], keep[len(points)-1] = true, true
+
+	type span struct{ from, to int }
+	stack := []span{{0, len(points) - 1}}
+	for len(stack) > 0 {
+		s := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		maxDist, index := 0.0, -1
+		for i := s.from + 1; i < s.to; i++ {
+			if d := segmentDistance(points[i], points[s.from], points[s.to]); d > maxDist {
+				maxDist, index = d, i
+			}
+		}
+		if index >= 0 && maxDist > tolerance {
+			keep[index] = true
+			stack = append(stack, span{s.from, index}, span{index, s.to})
+		}
+	}
+
+	out := make(Polygon, 0, len(points))
+	for i, p := range points {
+		if keep[i] {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func segmentDistance(p, a, b Point) float64 {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	lenSq := dx*dx + dy*dy
+	if lenSq == 0 {
+		return math.Hypot(p.X-a.X, p.Y-a.Y)
+	}
+	t := math.Max(0, math.Min(1, ((p.X-a.X)*dx+(p.Y-a.Y)*dy)/lenSq))
+	return math.Hypot(p.X-(a.X+t*dx), p.Y-(a.Y+t*dy))
+}
+
+// SVGPath encodes polygons as SVG path data ("M x y L ... Z" per polygon).
+// Use it with fill-rule="nonzero" so holes stay transparent.
+func SVGPath(polygons []Polygon) string {
+	var sb strings.Builder
+	for _, poly := range polygons {
+		if len(poly) == 0 {
+			continue
+		}
+		for i, p := range poly {
+			if sb.Len() > 0 {
+				sb.WriteByte(' ')
+			}
+			if i == 0 {
+				sb.WriteString("M")
+			} else {
+				sb.WriteString("L")
+			}
+			sb.WriteString(formatCoord(p.X))
+			sb.WriteByte(' ')
+			sb.WriteString(formatCoord(p.Y))
+		}
+		sb.WriteString(" Z")
+	}
+	return sb.String()
+}
+
+func formatCoord(v float64) string {
+	return strconv.FormatFloat(roundCoord(v), 'f', -1, 64)
+}
+
+// roundCoord rounds a coordinate to hundredths of a pixel
+func roundCoord(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,121 @@
+package rmbg
+
+import (
+	"image"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestExtractContours(t *testing.T) {
+	t.Run("EmptyMask", func(t *testing.T) {
+		mask := image.NewGray(image.Rect(0, 0, 10, 10))
+		if polys := ExtractContours(mask, nil); len(polys) != 0 {
+			t.Errorf("expected no contours, got %d", len(polys))
+		}
+	})
+
+	t.Run("Square", func(t *testing.T) {
+		mask := image.NewGray(image.Rect(0, 0, 20, 20))
+		fillRect(mask, image.Rect(5, 5, 15, 15), 255)
+
+		exact := ExtractContours(mask, &ContourConfig{Threshold: 128, Tolerance: -1})
+		if len(exact) != 1 {
+			t.Fatalf("expected 1 contour, got %d", len(exact))
+		}
+		// A 10x10 block traced on pixel edges encloses ~100 px² (corners are cut slightly)
+		area := math.Abs(exact[0].Area())
+		if area < 99 || area > 100 {
+			t.Errorf("expected area ~100, got %f", area)
+		}
+
+		// Simplification should reduce the square to roughly its corners
+		simplified := ExtractContours(mask, nil)
+		if len(simplified) != 1 || len(simplified[0]) > 8 {
+			t.Errorf("expected simplified polygon, got %v", simplified)
+		}
+	})
+
+	t.Run("DefaultThreshold", func(t *testing.T) {
+		// A faint halo below 128 is outside the object with a zero config too
+		mask := image.NewGray(image.Rect(0, 0, 20, 20))
+		fillRect(mask, image.Rect(2, 2, 18, 18), 60)
+		fillRect(mask, image.Rect(5, 5, 15, 15), 255)
+
+		for _, config := range []*ContourConfig{nil, {}} {
+			polys := ExtractContours(mask, config)
+			if len(polys) != 1 {
+				t.Fatalf("%+v: expected 1 contour, got %d", config, len(polys))
+			}
+			if area := math.Abs(polys[0].Area()); area > 110 {
+				t.Errorf("%+v: expected the halo left out, got area %f", config, area)
+			}
+		}
+	})
+
+	t.Run("Hole", func(t *testing.T) {
+		mask := image.NewGray(image.Rect(0, 0, 30, 30))
+		fillRect(mask, image.Rect(5, 5, 25, 25), 255)
+		fillRect(mask, image.Rect(12, 12, 18, 18), 0)
+
+		polys := ExtractContours(mask, nil)
+		if len(polys) != 2 {
+			t.Fatalf("expected outer contour and hole, got %d", len(polys))
+		}
+		if math.Signbit(polys[0].Area()) == math.Signbit(polys[1].Area()) {
+			t.Errorf("expected hole to have opposite winding")
+		}
+	})
+
+	t.Run("MinArea", func(t *testing.T) {
+		mask := image.NewGray(image.Rect(0, 0, 20, 20))
+		fillRect(mask, image.Rect(2, 2, 4, 4), 255)
+		fillRect(mask, image.Rect(8, 8, 18, 18), 255)
+
+		polys := ExtractContours(mask, &ContourConfig{Threshold: 128, Tolerance: 1, MinArea: 10})
+		if len(polys) != 1 {
+			t.Errorf("expected small blob to be discarded, got %d contours", len(polys))
+		}
+	})
+
+	t.Run("OffsetBounds", func(t *testing.T) {
+		mask := image.NewGray(image.Rect(100, 100, 110, 110))
+		fillRect(mask, image.Rect(102, 102, 108, 108), 255)
+
+		polys := ExtractContours(mask, nil)
+		if len(polys) != 1 {
+			t.Fatalf("expected 1 contour, got %d", len(polys))
+		}
+		for _, p := range polys[0] {
+			if p.X < 101 || p.X > 109 || p.Y < 101 || p.Y > 109 {
+				t.Errorf("point %v outside expected region", p)
+			}
+		}
+	})
+}
+
+func TestSVGPath(t *testing.T) {
+	polys := []Polygon{{{0, 0}, {10, 0}, {10, 10.125}}}
+	got := SVGPath(polys)
+	want := "M0 0 L10 0 L10 10.13 Z"
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	if SVGPath(nil) != "" {
+		t.Errorf("expected empty path for no polygons")
+	}
+
+	two := SVGPath(append(polys, polys...))
+	if strings.Count(two, "M") != 2 || strings.Count(two, "Z") != 2 {
+		t.Errorf("expected two subpaths, got %q", two)
+	}
+}
+
+func fillRect(mask *image.Gray, r image.Rectangle, v uint8) {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			mask.Pix[mask.PixOffset(x, y)] = v
+		}
+	}
+}
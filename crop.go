@@ -1,10 +1,16 @@
 package rmbg
 
 import (
+	"errors"
 	"fmt"
 	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
 
 	"github.com/disintegration/imaging"
+	"golang.org/x/image/draw"
 )
 
 // CropConfig configures the behavior of the smart crop
@@ -17,8 +23,163 @@ type CropConfig struct {
 	MinThreshold uint8
 	// SquareCrop forces the crop to be square, using the largest dimension
 	SquareCrop bool
+	// SquarePad keeps the tight crop and pads the shorter side with Background to
+	// make the output square, instead of pulling in surrounding image content
+	SquarePad bool
+	// Centering selects how the crop is centered on the object (default: CenterBoundingBox)
+	Centering Centering
+	// MassTrim is the fraction of object mass ignored on each side when Centering is
+	// CenterMass, so thin protrusions don't stretch the crop (default: 0.02)
+	MassTrim float64
+	// MinWidth and MinHeight expand small crops around their center (padding with
+	// Background if the image is too small)
+	MinWidth, MinHeight int
+	// MaxWidth and MaxHeight shrink large crops around their center. They are applied
+	// before AspectRatio, which may expand the crop again.
+	MaxWidth, MaxHeight int
+	// AspectRatio forces the crop to width/height (e.g. 4.0/5.0). The crop is expanded
+	// around the object and letterboxed with Background if the image is too small.
+	AspectRatio float64
+	// TargetWidth and TargetHeight scale the crop to fit a fixed canvas, centered and
+	// padded with Background. Setting only one of them scales to that dimension.
+	TargetWidth, TargetHeight int
+	// Background fills padding and letterboxing (default: transparent)
+	Background color.Color
+	// Anchor places the object off-center in the crop, e.g. on a rule-of-thirds
+	// line (default: AnchorCenter)
+	Anchor Anchor
+	// Fallbacks are tried in order when the mask holds no object, instead of
+	// failing with ErrNoObjectDetected, e.g. DefaultFallbacks
+	Fallbacks []Fallback
+	// FallbackThreshold is the MinThreshold of FallbackLowerThreshold (default:
+	// DefaultFallbackThreshold)
+	FallbackThreshold uint8
 }
 
+// ParseMargin parses a margin given in pixels ("20") or as a percentage of the
+// object size ("5%"), returning the values for Margin and MarginPercent
+func ParseMargin(s string) (pixels int, fraction float64, err error) {
+	if pct, ok := strings.CutSuffix(s, "%"); ok {
+		v, err := strconv.ParseFloat(pct, 64)
+		if err != nil || v < 0 {
+			return 0, 0, fmt.Errorf("%w: %q", ErrInvalidMargin, s)
+		}
+		return 0, v / 100, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 0 {
+		return 0, 0, fmt.Errorf("%w: %q", ErrInvalidMargin, s)
+	}
+	return v, 0, nil
+}
+
+var (
+	// ErrInvalidMargin is returned for negative margins or a MarginPercent above 10
+	ErrInvalidMargin = errors.New("invalid crop margin")
+	// ErrInvalidSize is returned for negative sizes, ratios or trims
+	ErrInvalidSize = errors.New("invalid crop size")
+	// ErrConflictingOptions is returned when crop options contradict each other
+	ErrConflictingOptions = errors.New("conflicting crop options")
+)
+
+// Validate reports configurations that would produce meaningless crops. The
+// returned error wraps ErrInvalidMargin, ErrInvalidSize or ErrConflictingOptions,
+// except for unknown fallbacks.
+func (c *CropConfig) Validate() error {
+	if c.Margin < 0 {
+		return fmt.Errorf("%w: margin %d is negative", ErrInvalidMargin, c.Margin)
+	}
+	if c.MarginPercent < 0 || c.MarginPercent > 10 {
+		return fmt.Errorf("%w: margin percent %g is outside [0, 10]", ErrInvalidMargin, c.MarginPercent)
+	}
+
+	for _, v := range []struct {
+		name string
+		size int
+	}{
+		{"min width", c.MinWidth},
+		{"min height", c.MinHeight},
+		{"max width", c.MaxWidth},
+		{"max height", c.MaxHeight},
+		{"target width", c.TargetWidth},
+		{"target height", c.TargetHeight},
+	} {
+		if v.size < 0 {
+			return fmt.Errorf("%w: %s %d is negative", ErrInvalidSize, v.name, v.size)
+		}
+	}
+	if c.AspectRatio < 0 || math.IsNaN(c.AspectRatio) || math.IsInf(c.AspectRatio, 0) {
+		return fmt.Errorf("%w: aspect ratio %g", ErrInvalidSize, c.AspectRatio)
+	}
+	if c.MassTrim < 0 || c.MassTrim >= 0.5 {
+		return fmt.Errorf("%w: mass trim %g is outside [0, 0.5)", ErrInvalidSize, c.MassTrim)
+	}
+
+	if c.MaxWidth > 0 && c.MinWidth > c.MaxWidth {
+		return fmt.Errorf("%w: min width %d exceeds max width %d", ErrConflictingOptions, c.MinWidth, c.MaxWidth)
+	}
+	if c.MaxHeight > 0 && c.MinHeight > c.MaxHeight {
+		return fmt.Errorf("%w: min height %d exceeds max height %d", ErrConflictingOptions, c.MinHeight, c.MaxHeight)
+	}
+	if c.SquareCrop && c.SquarePad {
+		return fmt.Errorf("%w: square crop with square padding", ErrConflictingOptions)
+	}
+	if (c.SquareCrop || c.SquarePad) && c.AspectRatio > 0 && c.AspectRatio != 1 {
+		return fmt.Errorf("%w: square output with aspect ratio %g", ErrConflictingOptions, c.AspectRatio)
+	}
+	if c.AspectRatio > 0 && c.TargetWidth > 0 && c.TargetHeight > 0 {
+		target := float64(c.TargetWidth) / float64(c.TargetHeight)
+		if math.Abs(target-c.AspectRatio)/c.AspectRatio > 0.01 {
+			return fmt.Errorf("%w: aspect ratio %g does not match target size %dx%d",
+				ErrConflictingOptions, c.AspectRatio, c.TargetWidth, c.TargetHeight)
+		}
+	}
+	return validateFallbacks(c.Fallbacks)
+}
+
+// Anchor is where the object's center is placed within the crop
+type Anchor int
+
+const (
+	// AnchorCenter centers the object
+	AnchorCenter Anchor = iota
+	// AnchorThirdsLeft places the object on the left third line
+	AnchorThirdsLeft
+	// AnchorThirdsRight places the object on the right third line
+	AnchorThirdsRight
+	// AnchorTop places the object on the upper third line
+	AnchorTop
+	// AnchorBottom places the object on the lower third line
+	AnchorBottom
+)
+
+// fractions returns the relative position of the object center in the crop
+func (a Anchor) fractions() (float64, float64) {
+	switch a {
+	case AnchorThirdsLeft:
+		return 1.0 / 3.0, 0.5
+	case AnchorThirdsRight:
+		return 2.0 / 3.0, 0.5
+	case AnchorTop:
+		return 0.5, 1.0 / 3.0
+	case AnchorBottom:
+		return 0.5, 2.0 / 3.0
+	default:
+		return 0.5, 0.5
+	}
+}
+
+// Centering selects the reference point of the crop
+type Centering int
+
+const (
+	// CenterBoundingBox centers the crop on the bounding box of the mask
+	CenterBoundingBox Centering = iota
+	// CenterMass centers the crop on the mask's center of mass and sizes it from
+	// salience-weighted extents
+	CenterMass
+)
+
 type objectBounds struct {
 	MinX, MinY, MaxX, MaxY int
 	Width, Height          int
@@ -33,6 +194,9 @@ func (r *RemBG) SmartCrop(img image.Image, config *CropConfig) (image.Image, err
 			MinThreshold: 10,
 		}
 	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
 
 	maskImg, err := r.predictMask(img)
 	if err != nil {
@@ -40,9 +204,167 @@ func (r *RemBG) SmartCrop(img image.Image, config *CropConfig) (image.Image, err
 	}
 	bounds := img.Bounds()
 	origW, origH := bounds.Dx(), bounds.Dy()
+	maskB := maskImg.Bounds()
 	return crop(img, maskImg, config,
-		float64(origW)/float64(inputSize),
-		float64(origH)/float64(inputSize))
+		float64(origW)/float64(maskB.Dx()),
+		float64(origH)/float64(maskB.Dy()))
+}
+
+// SmartCropInfo is SmartCrop that also returns the geometry of the detected object
+func (r *RemBG) SmartCropInfo(img image.Image, config *CropConfig) (image.Image, *ObjectInfo, error) {
+	if config == nil {
+		config = &CropConfig{
+			Margin:       10,
+			MinThreshold: 10,
+		}
+	}
+	if err := config.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	maskImg, err := r.predictMask(img)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, maskImg, config, err := fallbackBounds(img, maskImg, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := MeasureObject(img.Bounds(), maskImg, config.MinThreshold)
+	if err != nil {
+		return nil, nil, err
+	}
+	return applyCrop(img, b.Crop, config), info, nil
+}
+
+// ObjectInfo describes the geometry of the detected object, in image coordinates
+type ObjectInfo struct {
+	// Area is the number of image pixels covered by the object
+	Area int
+	// Coverage is the fraction of the frame covered by the object
+	Coverage float64
+	// Centroid is the center of mass of the object
+	Centroid Point
+	// BBox is the bounding box of the object
+	BBox image.Rectangle
+}
+
+// MeasureObject computes the geometry of the pixels of mask at or above
+// threshold. The mask may have any resolution; measurements are scaled to bounds.
+func MeasureObject(bounds image.Rectangle, mask *image.Gray, threshold uint8) (*ObjectInfo, error) {
+	if mask == nil {
+		return nil, fmt.Errorf("mask image is nil")
+	}
+	maskB := mask.Bounds()
+	if maskB.Empty() || bounds.Empty() {
+		return nil, fmt.Errorf("mask image is empty")
+	}
+
+	w, h := maskB.Dx(), maskB.Dy()
+	count, sumX, sumY := 0, 0, 0
+	minX, minY, maxX, maxY := w, h, -1, -1
+	for y := range h {
+		for x, v := range mask.Pix[y*mask.Stride : y*mask.Stride+w] {
+			if v < threshold {
+				continue
+			}
+			count++
+			sumX += x
+			sumY += y
+			minX, maxX = min(minX, x), max(maxX, x)
+			minY, maxY = min(minY, y), max(maxY, y)
+		}
+	}
+	if count == 0 {
+		return nil, ErrNoObjectDetected
+	}
+
+	sx := float64(bounds.Dx()) / float64(w)
+	sy := float64(bounds.Dy()) / float64(h)
+	return &ObjectInfo{
+		Area:     int(math.Round(float64(count) * sx * sy)),
+		Coverage: float64(count) / float64(w*h),
+		Centroid: Point{
+			X: float64(bounds.Min.X) + (float64(sumX)/float64(count)+0.5)*sx,
+			Y: float64(bounds.Min.Y) + (float64(sumY)/float64(count)+0.5)*sy,
+		},
+		BBox: image.Rect(
+			int(float64(minX)*sx), int(float64(minY)*sy),
+			int(math.Ceil(float64(maxX+1)*sx)), int(math.Ceil(float64(maxY+1)*sy)),
+		).Add(bounds.Min),
+	}, nil
+}
+
+// CropBounds describes where the object is and how SmartCrop would crop it
+type CropBounds struct {
+	// Object is the bounding box of the detected object
+	Object image.Rectangle
+	// Crop is the rectangle SmartCrop would extract; it can extend past the image
+	// when padding is needed
+	Crop image.Rectangle
+	// Coverage is the fraction of the image covered by the object mask
+	Coverage float64
+	// BoxCoverage is the fraction of the image covered by the object bounding box
+	BoxCoverage float64
+	// Fallback is the CropConfig.Fallbacks step that found the object, or
+	// FallbackNone
+	Fallback Fallback
+}
+
+// DetectBounds runs segmentation and returns the crop rectangle SmartCrop would
+// use, without allocating a cropped image
+func (r *RemBG) DetectBounds(img image.Image, config *CropConfig) (*CropBounds, error) {
+	if config == nil {
+		config = &CropConfig{
+			Margin:       10,
+			MinThreshold: 10,
+		}
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	maskImg, err := r.predictMask(img)
+	if err != nil {
+		return nil, err
+	}
+	b, _, _, err := fallbackBounds(img, maskImg, config)
+	return b, err
+}
+
+func detectCropBounds(bounds image.Rectangle, maskImg *image.Gray, config *CropConfig) (*CropBounds, error) {
+	maskB := maskImg.Bounds()
+	reg, err := cropRegion(bounds, maskImg, config,
+		float64(bounds.Dx())/float64(maskB.Dx()),
+		float64(bounds.Dy())/float64(maskB.Dy()))
+	if err != nil {
+		return nil, err
+	}
+
+	imgArea := float64(bounds.Dx() * bounds.Dy())
+	return &CropBounds{
+		Object:      reg.object,
+		Crop:        reg.crop,
+		Coverage:    maskCoverage(maskImg, config.MinThreshold),
+		BoxCoverage: float64(reg.object.Dx()*reg.object.Dy()) / imgArea,
+	}, nil
+}
+
+// maskCoverage returns the fraction of mask pixels at or above threshold
+func maskCoverage(mask *image.Gray, threshold uint8) float64 {
+	b := mask.Bounds()
+	if b.Empty() {
+		return 0
+	}
+	count := 0
+	for y := range b.Dy() {
+		for _, v := range mask.Pix[y*mask.Stride : y*mask.Stride+b.Dx()] {
+			if v >= threshold {
+				count++
+			}
+		}
+	}
+	return float64(count) / float64(b.Dx()*b.Dy())
 }
 
 func detectObjectBounds(mask *image.Gray, minThreshold uint8) (objectBounds, bool) {
@@ -79,6 +401,66 @@ func detectObjectBounds(mask *image.Gray, minThreshold uint8) (objectBounds, boo
 	}, true
 }
 
+// detectSalientBounds computes the mask's center of mass and the extents that
+// contain all but trim of the object mass on each side
+func detectSalientBounds(mask *image.Gray, minThreshold uint8, trim float64) (objectBounds, bool) {
+	bounds := mask.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	cols := make([]float64, w)
+	rows := make([]float64, h)
+
+	total, sumX, sumY := 0.0, 0.0, 0.0
+	for y := range h {
+		line := mask.Pix[y*mask.Stride : y*mask.Stride+w]
+		for x, v := range line {
+			if v < minThreshold {
+				continue
+			}
+			weight := float64(v)
+			cols[x] += weight
+			rows[y] += weight
+			total += weight
+			sumX += weight * float64(x)
+			sumY += weight * float64(y)
+		}
+	}
+	if total == 0 {
+		return objectBounds{}, false
+	}
+
+	minX, maxX := trimmedExtent(cols, total*trim)
+	minY, maxY := trimmedExtent(rows, total*trim)
+	return objectBounds{
+		MinX:    bounds.Min.X + minX,
+		MinY:    bounds.Min.Y + minY,
+		MaxX:    bounds.Min.X + maxX,
+		MaxY:    bounds.Min.Y + maxY,
+		Width:   maxX - minX,
+		Height:  maxY - minY,
+		CenterX: bounds.Min.X + int(sumX/total+0.5),
+		CenterY: bounds.Min.Y + int(sumY/total+0.5),
+	}, true
+}
+
+// trimmedExtent returns the first and last index at which the cumulative mass
+// from either end exceeds cut
+func trimmedExtent(mass []float64, cut float64) (int, int) {
+	lo, hi := 0, len(mass)-1
+	for acc := 0.0; lo < hi; lo++ {
+		acc += mass[lo]
+		if acc > cut {
+			break
+		}
+	}
+	for acc := 0.0; hi > lo; hi-- {
+		acc += mass[hi]
+		if acc > cut {
+			break
+		}
+	}
+	return lo, hi
+}
+
 // SmartCropFromMask performs a smart crop using an existing mask
 func (engine *RemBG) SmartCropFromMask(img image.Image, maskFunc Mask, config *CropConfig) (image.Image, error) {
 	if config == nil {
@@ -87,10 +469,38 @@ func (engine *RemBG) SmartCropFromMask(img image.Image, maskFunc Mask, config *C
 			MinThreshold: 10,
 		}
 	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
 
 	return crop(img, maskFunc(img), config, 1.0, 1.0)
 }
 
+// SmartCropWithMask performs a smart crop using a precomputed mask, skipping mask
+// generation. The mask may have any resolution; it is scaled to the image.
+func (engine *RemBG) SmartCropWithMask(img image.Image, mask *image.Gray, config *CropConfig) (image.Image, error) {
+	if config == nil {
+		config = &CropConfig{
+			Margin:       20,
+			MinThreshold: 10,
+		}
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if mask == nil {
+		return nil, fmt.Errorf("mask image is nil")
+	}
+
+	bounds, maskB := img.Bounds(), mask.Bounds()
+	if maskB.Empty() {
+		return nil, fmt.Errorf("mask image is empty")
+	}
+	return crop(img, mask, config,
+		float64(bounds.Dx())/float64(maskB.Dx()),
+		float64(bounds.Dy())/float64(maskB.Dy()))
+}
+
 func crop(
 	img image.Image,
 	maskImg *image.Gray,
@@ -100,22 +510,89 @@ func crop(
 	if maskImg == nil {
 		return nil, fmt.Errorf("mask image is nil")
 	}
+	fallback, config, f, err := applyFallbacks(img, maskImg, config)
+	if err != nil {
+		return nil, err
+	}
+	if f == FallbackFullFrame {
+		return applyCrop(img, img.Bounds(), config), nil
+	}
+	if fb := fallback.Bounds(); fb != maskImg.Bounds() {
+		// AutoMask has the resolution of the image
+		scaleX = float64(img.Bounds().Dx()) / float64(fb.Dx())
+		scaleY = float64(img.Bounds().Dy()) / float64(fb.Dy())
+	}
+	maskImg = fallback
+
+	region, err := cropRegion(img.Bounds(), maskImg, config, scaleX, scaleY)
+	if err != nil {
+		return nil, err
+	}
+	return applyCrop(img, region.crop, config), nil
+}
+
+// applyCrop extracts rect from img and fits it to the target canvas, if any
+func applyCrop(img image.Image, rect image.Rectangle, config *CropConfig) image.Image {
+	out := cropPadded(img, rect, config.Background)
+	if config.SquarePad {
+		out = padSquare(out, config.Background)
+	}
+	if config.TargetWidth > 0 || config.TargetHeight > 0 {
+		out = fitCanvas(out, config.TargetWidth, config.TargetHeight, config.Background)
+	}
+	return out
+}
+
+// region is the object bounding box and the crop rectangle, both in image coordinates
+type region struct {
+	object image.Rectangle
+	crop   image.Rectangle
+}
+
+// cropRegion computes the crop rectangle for an image with the given bounds.
+// The crop may extend past the image when padding is required.
+func cropRegion(
+	bounds image.Rectangle,
+	maskImg *image.Gray,
+	config *CropConfig,
+	scaleX, scaleY float64,
+) (region, error) {
+	if maskImg == nil {
+		return region{}, fmt.Errorf("mask image is nil")
+	}
 
 	objBounds, found := detectObjectBounds(maskImg, config.MinThreshold)
 	if !found {
-		return nil, fmt.Errorf("no object detected in image")
+		return region{}, ErrNoObjectDetected
 	}
 
-	bounds := img.Bounds()
 	origW, origH := bounds.Dx(), bounds.Dy()
+	maskMin := maskImg.Bounds().Min
 
 	// Scale from mask space to original space
 	scaled := &objectBounds{
-		MinX: int(float64(objBounds.MinX) * scaleX),
-		MinY: int(float64(objBounds.MinY) * scaleY),
-		MaxX: int(float64(objBounds.MaxX) * scaleX),
-		MaxY: int(float64(objBounds.MaxY) * scaleY),
+		MinX: int(float64(objBounds.MinX-maskMin.X) * scaleX),
+		MinY: int(float64(objBounds.MinY-maskMin.Y) * scaleY),
+		MaxX: int(float64(objBounds.MaxX-maskMin.X) * scaleX),
+		MaxY: int(float64(objBounds.MaxY-maskMin.Y) * scaleY),
+	}
+	object := image.Rect(scaled.MinX, scaled.MinY, scaled.MaxX, scaled.MaxY)
+
+	// Center on the mass of the object, spanning its salient extents symmetrically
+	if config.Centering == CenterMass {
+		trim := config.MassTrim
+		if trim <= 0 {
+			trim = 0.02
+		}
+		salient, _ := detectSalientBounds(maskImg, config.MinThreshold, trim)
+		cx := int(float64(salient.CenterX-maskMin.X) * scaleX)
+		cy := int(float64(salient.CenterY-maskMin.Y) * scaleY)
+		halfW := max(cx-int(float64(salient.MinX-maskMin.X)*scaleX), int(float64(salient.MaxX-maskMin.X)*scaleX)-cx)
+		halfH := max(cy-int(float64(salient.MinY-maskMin.Y)*scaleY), int(float64(salient.MaxY-maskMin.Y)*scaleY)-cy)
+		scaled.MinX, scaled.MaxX = cx-halfW, cx+halfW
+		scaled.MinY, scaled.MaxY = cy-halfH, cy+halfH
 	}
+
 	scaled.Width = scaled.MaxX - scaled.MinX
 	scaled.Height = scaled.MaxY - scaled.MinY
 
@@ -148,5 +625,186 @@ func crop(
 	}
 
 	rect := image.Rect(cropMinX, cropMinY, cropMaxX, cropMaxY)
-	return imaging.Crop(img, rect), nil
+	imgRect := image.Rect(0, 0, origW, origH)
+	fx, fy := config.Anchor.fractions()
+	if config.Anchor != AnchorCenter {
+		rect = shiftInside(anchorRect(rect, fx, fy), imgRect)
+	}
+	if config.MinWidth > 0 || config.MinHeight > 0 || config.MaxWidth > 0 || config.MaxHeight > 0 {
+		rect = shiftInside(constrainSize(rect, config, fx, fy), imgRect)
+	}
+	if config.AspectRatio > 0 {
+		rect = shiftInside(fitAspect(rect, config.AspectRatio, fx, fy), imgRect)
+	}
+
+	return region{
+		object: object.Add(bounds.Min),
+		crop:   rect.Add(bounds.Min),
+	}, nil
+}
+
+// anchorRect expands r so that its current center ends up at the relative
+// position (fx, fy) of the result while r stays fully contained
+func anchorRect(r image.Rectangle, fx, fy float64) image.Rectangle {
+	place := func(lo, hi int, f float64) (int, int) {
+		c := float64(lo+hi) / 2
+		size := math.Max((c-float64(lo))/f, (float64(hi)-c)/(1-f))
+		start := int(math.Round(c - f*size))
+		return start, start + int(math.Round(size))
+	}
+
+	r.Min.X, r.Max.X = place(r.Min.X, r.Max.X, fx)
+	r.Min.Y, r.Max.Y = place(r.Min.Y, r.Max.Y, fy)
+	return r
+}
+
+// resizeAround changes the span [lo, hi) to size, keeping the point at relative
+// position f fixed
+func resizeAround(lo, hi, size int, f float64) (int, int) {
+	lo -= int(float64(size-(hi-lo)) * f)
+	return lo, lo + size
+}
+
+// constrainSize grows or shrinks r to respect the min/max sizes of config,
+// keeping the anchor point (fx, fy) fixed
+func constrainSize(r image.Rectangle, config *CropConfig, fx, fy float64) image.Rectangle {
+	clampSize := func(size, minSize, maxSize int) int {
+		if minSize > 0 && size < minSize {
+			size = minSize
+		}
+		if maxSize > 0 && size > maxSize {
+			size = maxSize
+		}
+		return size
+	}
+
+	w := clampSize(r.Dx(), config.MinWidth, config.MaxWidth)
+	h := clampSize(r.Dy(), config.MinHeight, config.MaxHeight)
+	r.Min.X, r.Max.X = resizeAround(r.Min.X, r.Max.X, w, fx)
+	r.Min.Y, r.Max.Y = resizeAround(r.Min.Y, r.Max.Y, h, fy)
+	return r
+}
+
+// fitAspect expands r until width/height equals ratio, keeping the anchor
+// point (fx, fy) fixed
+func fitAspect(r image.Rectangle, ratio float64, fx, fy float64) image.Rectangle {
+	w, h := max(r.Dx(), 1), max(r.Dy(), 1)
+
+	if float64(w)/float64(h) < ratio {
+		w = int(math.Round(float64(h) * ratio))
+	} else {
+		h = int(math.Round(float64(w) / ratio))
+	}
+
+	r.Min.X, r.Max.X = resizeAround(r.Min.X, r.Max.X, w, fx)
+	r.Min.Y, r.Max.Y = resizeAround(r.Min.Y, r.Max.Y, h, fy)
+	return r
+}
+
+// shiftInside moves r so it overlaps bounds as much as possible. When r is
+// larger than bounds in a dimension it is centered on bounds instead.
+func shiftInside(r, bounds image.Rectangle) image.Rectangle {
+	dx, dy := 0, 0
+	switch {
+	case r.Dx() > bounds.Dx():
+		dx = bounds.Min.X + (bounds.Dx()-r.Dx())/2 - r.Min.X
+	case r.Min.X < bounds.Min.X:
+		dx = bounds.Min.X - r.Min.X
+	case r.Max.X > bounds.Max.X:
+		dx = bounds.Max.X - r.Max.X
+	}
+	switch {
+	case r.Dy() > bounds.Dy():
+		dy = bounds.Min.Y + (bounds.Dy()-r.Dy())/2 - r.Min.Y
+	case r.Min.Y < bounds.Min.Y:
+		dy = bounds.Min.Y - r.Min.Y
+	case r.Max.Y > bounds.Max.Y:
+		dy = bounds.Max.Y - r.Max.Y
+	}
+	return r.Add(image.Pt(dx, dy))
+}
+
+// cropPadded crops rect from img, filling any part of rect outside the image
+// with bg (transparent if nil)
+func cropPadded(img image.Image, rect image.Rectangle, bg color.Color) image.Image {
+	imgRect := img.Bounds()
+	if isDeep(img) {
+		dst := canvas16(rect.Dx(), rect.Dy(), bg)
+		inside := rect.Intersect(imgRect)
+		draw.Draw(dst, inside.Sub(rect.Min), img, inside.Min, draw.Src)
+		return dst
+	}
+	if rect.In(imgRect) {
+		return imaging.Crop(img, rect)
+	}
+
+	dst := imaging.New(rect.Dx(), rect.Dy(), fillColor(bg))
+	inside := rect.Intersect(imgRect)
+	if !inside.Empty() {
+		part := imaging.Crop(img, inside)
+		dst = imaging.Paste(dst, part, inside.Min.Sub(rect.Min))
+	}
+	return dst
+}
+
+// fitCanvas scales img to fit inside a width x height canvas and centers it,
+// padding with bg. A zero width or height is derived from the image aspect ratio.
+func fitCanvas(img image.Image, width, height int, bg color.Color) image.Image {
+	b := img.Bounds()
+	if b.Dx() == 0 || b.Dy() == 0 {
+		return imaging.New(max(width, 1), max(height, 1), fillColor(bg))
+	}
+	if width <= 0 {
+		width = max(1, int(math.Round(float64(height)*float64(b.Dx())/float64(b.Dy()))))
+	}
+	if height <= 0 {
+		height = max(1, int(math.Round(float64(width)*float64(b.Dy())/float64(b.Dx()))))
+	}
+
+	scale := math.Min(float64(width)/float64(b.Dx()), float64(height)/float64(b.Dy()))
+	w := max(1, min(width, int(math.Round(float64(b.Dx())*scale))))
+	h := max(1, min(height, int(math.Round(float64(b.Dy())*scale))))
+	if isDeep(img) {
+		canvas := canvas16(width, height, bg)
+		at := image.Pt((width-w)/2, (height-h)/2)
+		draw.CatmullRom.Scale(canvas, image.Rectangle{at, at.Add(image.Pt(w, h))}, img, b, draw.Src, nil)
+		return canvas
+	}
+	resized := imaging.Resize(img, w, h, imaging.Lanczos)
+
+	canvas := imaging.New(width, height, fillColor(bg))
+	return imaging.Paste(canvas, resized, image.Pt((width-w)/2, (height-h)/2))
+}
+
+// padSquare centers img on a square canvas of its largest dimension, filled
+// with bg
+func padSquare(img image.Image, bg color.Color) image.Image {
+	b := img.Bounds()
+	size := max(b.Dx(), b.Dy())
+	if b.Dx() == b.Dy() {
+		return img
+	}
+	if isDeep(img) {
+		canvas := canvas16(size, size, bg)
+		at := image.Pt((size-b.Dx())/2, (size-b.Dy())/2)
+		draw.Draw(canvas, b.Sub(b.Min).Add(at), img, b.Min, draw.Src)
+		return canvas
+	}
+	canvas := imaging.New(size, size, fillColor(bg))
+	return imaging.Paste(canvas, img, image.Pt((size-b.Dx())/2, (size-b.Dy())/2))
+}
+
+// canvas16 returns a zero-based canvas with 16 bits per channel filled with
+// bg, for deep images
+func canvas16(w, h int, bg color.Color) *image.NRGBA64 {
+	canvas := image.NewNRGBA64(image.Rect(0, 0, w, h))
+	draw.Draw(canvas, canvas.Rect, image.NewUniform(fillColor(bg)), image.Point{}, draw.Src)
+	return canvas
+}
+
+func fillColor(bg color.Color) color.Color {
+	if bg == nil {
+		return color.Transparent
+	}
+	return bg
 }
@@ -1,8 +1,10 @@
 package rmbg
 
 import (
+	"errors"
 	"image"
 	"image/color"
+	"math"
 	"testing"
 )
 
@@ -166,3 +168,494 @@ func TestSmartCropFromMask(t *testing.T) {
 		t.Errorf("expected 20x20 crop, got %dx%d", bounds.Dx(), bounds.Dy())
 	}
 }
+
+func TestCenterMass(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+
+	// A solid 20x20 body with a thin 1px cable running to the right edge
+	mask := image.NewGray(image.Rect(0, 0, 100, 100))
+	for y := 40; y < 60; y++ {
+		for x := 20; x < 40; x++ {
+			mask.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+	for x := 40; x < 100; x++ {
+		mask.SetGray(x, 50, color.Gray{Y: 255})
+	}
+
+	t.Run("BoundingBoxIncludesCable", func(t *testing.T) {
+		res, err := crop(img, mask, &CropConfig{MinThreshold: 10}, 1, 1)
+		if err != nil {
+			t.Fatalf("crop failed: %v", err)
+		}
+		if res.Bounds().Dx() < 70 {
+			t.Errorf("expected bbox crop to span the cable, got width %d", res.Bounds().Dx())
+		}
+	})
+
+	t.Run("MassIgnoresCable", func(t *testing.T) {
+		res, err := crop(img, mask, &CropConfig{MinThreshold: 10, Centering: CenterMass, MassTrim: 0.1}, 1, 1)
+		if err != nil {
+			t.Fatalf("crop failed: %v", err)
+		}
+		if w := res.Bounds().Dx(); w > 40 {
+			t.Errorf("expected mass-centered crop to focus on the body, got width %d", w)
+		}
+	})
+}
+
+func TestDetectSalientBounds(t *testing.T) {
+	mask := image.NewGray(image.Rect(0, 0, 10, 10))
+	for y := 2; y < 6; y++ {
+		for x := 2; x < 6; x++ {
+			mask.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+
+	b, found := detectSalientBounds(mask, 10, 0)
+	if !found {
+		t.Fatalf("expected object found")
+	}
+	if b.MinX != 2 || b.MaxX != 5 || b.MinY != 2 || b.MaxY != 5 {
+		t.Errorf("unexpected extents: %+v", b)
+	}
+	if b.CenterX != 4 || b.CenterY != 4 {
+		t.Errorf("expected center (4,4), got (%d,%d)", b.CenterX, b.CenterY)
+	}
+
+	if _, found := detectSalientBounds(image.NewGray(image.Rect(0, 0, 5, 5)), 10, 0); found {
+		t.Errorf("expected no object in empty mask")
+	}
+}
+
+func TestAspectRatio(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	mask := image.NewGray(image.Rect(0, 0, 200, 100))
+	for y := 40; y < 60; y++ {
+		for x := 90; x < 110; x++ {
+			mask.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+
+	tests := []struct {
+		name  string
+		ratio float64
+		w, h  int
+	}{
+		{"Portrait", 4.0 / 5.0, 19, 24},
+		{"Wide", 16.0 / 9.0, 34, 19},
+		{"Square", 1, 19, 19},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := crop(img, mask, &CropConfig{MinThreshold: 10, AspectRatio: tt.ratio}, 1, 1)
+			if err != nil {
+				t.Fatalf("crop failed: %v", err)
+			}
+			if res.Bounds().Dx() != tt.w || res.Bounds().Dy() != tt.h {
+				t.Errorf("expected %dx%d, got %dx%d", tt.w, tt.h, res.Bounds().Dx(), res.Bounds().Dy())
+			}
+		})
+	}
+
+	t.Run("LetterboxWhenImageTooSmall", func(t *testing.T) {
+		res, err := crop(img, mask, &CropConfig{MinThreshold: 10, Margin: 80, AspectRatio: 1}, 1, 1)
+		if err != nil {
+			t.Fatalf("crop failed: %v", err)
+		}
+		b := res.Bounds()
+		if b.Dx() != b.Dy() {
+			t.Errorf("expected exact square, got %dx%d", b.Dx(), b.Dy())
+		}
+		if _, _, _, a := res.At(b.Dx()/2, 0).RGBA(); a != 0 {
+			t.Errorf("expected transparent letterbox, got alpha %d", a)
+		}
+	})
+}
+
+func TestShiftInside(t *testing.T) {
+	bounds := image.Rect(0, 0, 100, 100)
+	tests := []struct {
+		in, want image.Rectangle
+	}{
+		{image.Rect(-10, 20, 30, 60), image.Rect(0, 20, 40, 60)},
+		{image.Rect(80, 90, 120, 130), image.Rect(60, 60, 100, 100)},
+		{image.Rect(-20, 0, 120, 50), image.Rect(-20, 0, 120, 50)},
+		{image.Rect(10, 10, 20, 20), image.Rect(10, 10, 20, 20)},
+	}
+	for _, tt := range tests {
+		if got := shiftInside(tt.in, bounds); got != tt.want {
+			t.Errorf("shiftInside(%v) = %v; want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTargetCanvas(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	mask := image.NewGray(image.Rect(0, 0, 100, 100))
+	for y := 30; y < 70; y++ {
+		for x := 40; x < 60; x++ {
+			mask.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+
+	t.Run("FixedCanvas", func(t *testing.T) {
+		red := color.NRGBA{R: 255, A: 255}
+		res, err := crop(img, mask, &CropConfig{MinThreshold: 10, TargetWidth: 120, TargetHeight: 120, Background: red}, 1, 1)
+		if err != nil {
+			t.Fatalf("crop failed: %v", err)
+		}
+		if res.Bounds().Dx() != 120 || res.Bounds().Dy() != 120 {
+			t.Fatalf("expected 120x120 canvas, got %v", res.Bounds())
+		}
+		// Tall object is centered horizontally, so the left edge is padding
+		r, g, b, _ := res.At(2, 60).RGBA()
+		if r>>8 != 255 || g>>8 != 0 || b>>8 != 0 {
+			t.Errorf("expected red padding, got %d,%d,%d", r>>8, g>>8, b>>8)
+		}
+		r, g, b, _ = res.At(60, 60).RGBA()
+		if r>>8 != 255 || g>>8 != 255 || b>>8 != 255 {
+			t.Errorf("expected white object in center, got %d,%d,%d", r>>8, g>>8, b>>8)
+		}
+	})
+
+	t.Run("WidthOnly", func(t *testing.T) {
+		res, err := crop(img, mask, &CropConfig{MinThreshold: 10, TargetWidth: 38}, 1, 1)
+		if err != nil {
+			t.Fatalf("crop failed: %v", err)
+		}
+		if res.Bounds().Dx() != 38 || res.Bounds().Dy() != 78 {
+			t.Errorf("expected 38x78, got %dx%d", res.Bounds().Dx(), res.Bounds().Dy())
+		}
+	})
+}
+
+func TestCropSizeConstraints(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	mask := image.NewGray(image.Rect(0, 0, 100, 100))
+	for y := 45; y < 55; y++ {
+		for x := 45; x < 55; x++ {
+			mask.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+
+	t.Run("MinSize", func(t *testing.T) {
+		res, err := crop(img, mask, &CropConfig{MinThreshold: 10, MinWidth: 40, MinHeight: 30}, 1, 1)
+		if err != nil {
+			t.Fatalf("crop failed: %v", err)
+		}
+		if res.Bounds().Dx() != 40 || res.Bounds().Dy() != 30 {
+			t.Errorf("expected 40x30, got %dx%d", res.Bounds().Dx(), res.Bounds().Dy())
+		}
+	})
+
+	t.Run("MaxSize", func(t *testing.T) {
+		res, err := crop(img, mask, &CropConfig{MinThreshold: 10, Margin: 30, MaxWidth: 50, MaxHeight: 20}, 1, 1)
+		if err != nil {
+			t.Fatalf("crop failed: %v", err)
+		}
+		if res.Bounds().Dx() != 50 || res.Bounds().Dy() != 20 {
+			t.Errorf("expected 50x20, got %dx%d", res.Bounds().Dx(), res.Bounds().Dy())
+		}
+	})
+
+	t.Run("MinLargerThanImage", func(t *testing.T) {
+		res, err := crop(img, mask, &CropConfig{MinThreshold: 10, MinWidth: 150}, 1, 1)
+		if err != nil {
+			t.Fatalf("crop failed: %v", err)
+		}
+		if res.Bounds().Dx() != 150 {
+			t.Errorf("expected padded width 150, got %d", res.Bounds().Dx())
+		}
+	})
+}
+
+func TestConstrainSize(t *testing.T) {
+	r := constrainSize(image.Rect(10, 10, 15, 15), &CropConfig{MinWidth: 10, MinHeight: 8}, 0.5, 0.5)
+	if r != image.Rect(8, 9, 18, 17) {
+		t.Errorf("unexpected rect %v", r)
+	}
+	r = constrainSize(image.Rect(0, 0, 100, 50), &CropConfig{MaxWidth: 60}, 0.5, 0.5)
+	if r != image.Rect(20, 0, 80, 50) {
+		t.Errorf("unexpected rect %v", r)
+	}
+}
+
+func TestDetectCropBounds(t *testing.T) {
+	mask := image.NewGray(image.Rect(0, 0, 10, 10))
+	for y := 4; y <= 6; y++ {
+		for x := 4; x <= 6; x++ {
+			mask.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+
+	b, err := detectCropBounds(image.Rect(0, 0, 100, 100), mask, &CropConfig{Margin: 5, MinThreshold: 10})
+	if err != nil {
+		t.Fatalf("detectCropBounds failed: %v", err)
+	}
+	if b.Object != image.Rect(40, 40, 60, 60) {
+		t.Errorf("unexpected object rect %v", b.Object)
+	}
+	if b.Crop != image.Rect(35, 35, 65, 65) {
+		t.Errorf("unexpected crop rect %v", b.Crop)
+	}
+	if b.Coverage != 0.09 {
+		t.Errorf("expected coverage 0.09, got %f", b.Coverage)
+	}
+	if b.BoxCoverage != 0.04 {
+		t.Errorf("expected box coverage 0.04, got %f", b.BoxCoverage)
+	}
+
+	t.Run("OffsetImage", func(t *testing.T) {
+		b, err := detectCropBounds(image.Rect(100, 200, 200, 300), mask, &CropConfig{MinThreshold: 10})
+		if err != nil {
+			t.Fatalf("detectCropBounds failed: %v", err)
+		}
+		if b.Object != image.Rect(140, 240, 160, 260) {
+			t.Errorf("expected rect in image coordinates, got %v", b.Object)
+		}
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		if _, err := detectCropBounds(image.Rect(0, 0, 100, 100), image.NewGray(image.Rect(0, 0, 10, 10)), &CropConfig{MinThreshold: 10}); err == nil {
+			t.Errorf("expected error for empty mask")
+		}
+	})
+}
+
+func TestCropOffsetImage(t *testing.T) {
+	full := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	sub := full.SubImage(image.Rect(50, 50, 100, 100))
+	mask := image.NewGray(sub.Bounds())
+	for y := 60; y < 70; y++ {
+		for x := 60; x < 70; x++ {
+			mask.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+
+	res, err := crop(sub, mask, &CropConfig{MinThreshold: 10}, 1, 1)
+	if err != nil {
+		t.Fatalf("crop failed: %v", err)
+	}
+	if res.Bounds().Dx() != 9 || res.Bounds().Dy() != 9 {
+		t.Errorf("expected 9x9 crop of sub-image, got %v", res.Bounds())
+	}
+}
+
+func TestSmartCropWithMask(t *testing.T) {
+	engine := &RemBG{}
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+
+	t.Run("FullResolution", func(t *testing.T) {
+		mask := image.NewGray(img.Bounds())
+		for y := 40; y <= 60; y++ {
+			for x := 40; x <= 60; x++ {
+				mask.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+		res, err := engine.SmartCropWithMask(img, mask, &CropConfig{MinThreshold: 10})
+		if err != nil {
+			t.Fatalf("SmartCropWithMask failed: %v", err)
+		}
+		if res.Bounds().Dx() != 20 || res.Bounds().Dy() != 20 {
+			t.Errorf("expected 20x20 crop, got %dx%d", res.Bounds().Dx(), res.Bounds().Dy())
+		}
+	})
+
+	t.Run("LowResolution", func(t *testing.T) {
+		mask := image.NewGray(image.Rect(0, 0, 10, 10))
+		for y := 4; y <= 6; y++ {
+			for x := 4; x <= 6; x++ {
+				mask.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+		res, err := engine.SmartCropWithMask(img, mask, &CropConfig{MinThreshold: 10})
+		if err != nil {
+			t.Fatalf("SmartCropWithMask failed: %v", err)
+		}
+		if res.Bounds().Dx() != 20 || res.Bounds().Dy() != 20 {
+			t.Errorf("expected 20x20 crop, got %dx%d", res.Bounds().Dx(), res.Bounds().Dy())
+		}
+	})
+
+	t.Run("NilMask", func(t *testing.T) {
+		if _, err := engine.SmartCropWithMask(img, nil, nil); err == nil {
+			t.Errorf("expected error for nil mask")
+		}
+	})
+}
+
+func TestAnchor(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 300, 300))
+	mask := image.NewGray(image.Rect(0, 0, 300, 300))
+	for y := 140; y < 160; y++ {
+		for x := 140; x < 160; x++ {
+			mask.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+
+	tests := []struct {
+		anchor Anchor
+		fx, fy float64
+	}{
+		{AnchorThirdsLeft, 1.0 / 3.0, 0.5},
+		{AnchorThirdsRight, 2.0 / 3.0, 0.5},
+		{AnchorTop, 0.5, 1.0 / 3.0},
+		{AnchorBottom, 0.5, 2.0 / 3.0},
+	}
+	for _, tt := range tests {
+		b, err := detectCropBounds(img.Bounds(), mask, &CropConfig{MinThreshold: 10, Anchor: tt.anchor, AspectRatio: 16.0 / 9.0})
+		if err != nil {
+			t.Fatalf("detectCropBounds failed: %v", err)
+		}
+		cx := float64(b.Object.Min.X+b.Object.Max.X) / 2
+		cy := float64(b.Object.Min.Y+b.Object.Max.Y) / 2
+		gotFx := (cx - float64(b.Crop.Min.X)) / float64(b.Crop.Dx())
+		gotFy := (cy - float64(b.Crop.Min.Y)) / float64(b.Crop.Dy())
+		if math.Abs(gotFx-tt.fx) > 0.05 || math.Abs(gotFy-tt.fy) > 0.05 {
+			t.Errorf("anchor %d: expected object at (%.2f, %.2f), got (%.2f, %.2f) in %v", tt.anchor, tt.fx, tt.fy, gotFx, gotFy, b.Crop)
+		}
+		if !b.Object.In(b.Crop) {
+			t.Errorf("anchor %d: object %v not contained in crop %v", tt.anchor, b.Object, b.Crop)
+		}
+	}
+}
+
+func TestCropConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config CropConfig
+		want   error
+	}{
+		{"Default", CropConfig{Margin: 10, MinThreshold: 10}, nil},
+		{"Full", CropConfig{MarginPercent: 0.1, MinWidth: 100, MaxWidth: 200, AspectRatio: 2, TargetWidth: 400, TargetHeight: 200}, nil},
+		{"NegativeMargin", CropConfig{Margin: -1}, ErrInvalidMargin},
+		{"LargeMarginPercent", CropConfig{MarginPercent: 11}, ErrInvalidMargin},
+		{"NegativeWidth", CropConfig{MinWidth: -5}, ErrInvalidSize},
+		{"NegativeAspect", CropConfig{AspectRatio: -1}, ErrInvalidSize},
+		{"MassTrim", CropConfig{MassTrim: 0.5}, ErrInvalidSize},
+		{"MinAboveMax", CropConfig{MinHeight: 300, MaxHeight: 200}, ErrConflictingOptions},
+		{"SquareAspect", CropConfig{SquareCrop: true, AspectRatio: 1.5}, ErrConflictingOptions},
+		{"TargetAspect", CropConfig{AspectRatio: 1, TargetWidth: 400, TargetHeight: 200}, ErrConflictingOptions},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	t.Run("SmartCropWithMask", func(t *testing.T) {
+		img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+		mask := image.NewGray(image.Rect(0, 0, 10, 10))
+		_, err := (&RemBG{}).SmartCropWithMask(img, mask, &CropConfig{Margin: -1})
+		if !errors.Is(err, ErrInvalidMargin) {
+			t.Errorf("expected ErrInvalidMargin, got %v", err)
+		}
+	})
+}
+
+func TestSquarePad(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 200, 200))
+	for y := range 200 {
+		for x := range 200 {
+			img.Set(x, y, color.RGBA{R: 200, A: 255})
+		}
+	}
+	mask := image.NewGray(image.Rect(0, 0, 200, 200))
+	fillRect(mask, image.Rect(80, 40, 120, 160), 255)
+
+	config := &CropConfig{MinThreshold: 10, SquarePad: true, Background: color.White}
+	out, err := (&RemBG{}).SmartCropWithMask(img, mask, config)
+	if err != nil {
+		t.Fatalf("SmartCropWithMask failed: %v", err)
+	}
+
+	b := out.Bounds()
+	if b.Dx() != b.Dy() {
+		t.Fatalf("expected square output, got %dx%d", b.Dx(), b.Dy())
+	}
+	// The sides come from padding, not from the image
+	if r, g, _, _ := out.At(b.Min.X, b.Min.Y+b.Dy()/2).RGBA(); r>>8 != 255 || g>>8 != 255 {
+		t.Errorf("expected padding on the left edge, got r=%d g=%d", r>>8, g>>8)
+	}
+	if r, g, _, _ := out.At(b.Min.X+b.Dx()/2, b.Min.Y+b.Dy()/2).RGBA(); r>>8 != 200 || g>>8 != 0 {
+		t.Errorf("expected image content in the center, got r=%d g=%d", r>>8, g>>8)
+	}
+
+	if err := (&CropConfig{SquareCrop: true, SquarePad: true}).Validate(); !errors.Is(err, ErrConflictingOptions) {
+		t.Errorf("expected ErrConflictingOptions, got %v", err)
+	}
+}
+
+func TestMeasureObject(t *testing.T) {
+	mask := image.NewGray(image.Rect(0, 0, 100, 100))
+	fillRect(mask, image.Rect(10, 20, 30, 60), 255)
+
+	t.Run("SameResolution", func(t *testing.T) {
+		info, err := MeasureObject(mask.Bounds(), mask, 128)
+		if err != nil {
+			t.Fatalf("MeasureObject failed: %v", err)
+		}
+		if info.Area != 800 {
+			t.Errorf("expected area 800, got %d", info.Area)
+		}
+		if math.Abs(info.Coverage-0.08) > 1e-9 {
+			t.Errorf("expected coverage 0.08, got %f", info.Coverage)
+		}
+		if info.Centroid != (Point{X: 20, Y: 40}) {
+			t.Errorf("expected centroid (20, 40), got %v", info.Centroid)
+		}
+		if want := image.Rect(10, 20, 30, 60); info.BBox != want {
+			t.Errorf("expected bbox %v, got %v", want, info.BBox)
+		}
+	})
+
+	t.Run("Scaled", func(t *testing.T) {
+		info, err := MeasureObject(image.Rect(100, 0, 300, 400), mask, 128)
+		if err != nil {
+			t.Fatalf("MeasureObject failed: %v", err)
+		}
+		if info.Area != 6400 {
+			t.Errorf("expected area 6400, got %d", info.Area)
+		}
+		if info.Centroid != (Point{X: 140, Y: 160}) {
+			t.Errorf("expected centroid (140, 160), got %v", info.Centroid)
+		}
+		if want := image.Rect(120, 80, 160, 240); info.BBox != want {
+			t.Errorf("expected bbox %v, got %v", want, info.BBox)
+		}
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		if _, err := MeasureObject(mask.Bounds(), image.NewGray(image.Rect(0, 0, 10, 10)), 128); err == nil {
+			t.Error("expected error for empty mask")
+		}
+	})
+}
+
+func TestParseMargin(t *testing.T) {
+	if px, frac, err := ParseMargin("15"); err != nil || px != 15 || frac != 0 {
+		t.Errorf("expected 15 pixels, got %d, %g (%v)", px, frac, err)
+	}
+	if px, frac, err := ParseMargin("5%"); err != nil || px != 0 || frac != 0.05 {
+		t.Errorf("expected 5%%, got %d, %g (%v)", px, frac, err)
+	}
+	for _, s := range []string{"-1", "x%", ""} {
+		if _, _, err := ParseMargin(s); !errors.Is(err, ErrInvalidMargin) {
+			t.Errorf("expected ErrInvalidMargin for %q, got %v", s, err)
+		}
+	}
+}
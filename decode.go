@@ -0,0 +1,152 @@
+package rmbg
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/draw"
+	// Register TIFF and WebP decoding with the image package
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// DefaultMaxPixels is the pixel limit used by ProcessReader when none is given
+const DefaultMaxPixels = 50_000_000
+
+// maxTrailer bounds what is read past the image data looking for metadata,
+// such as the EXIF chunk WebP stores after the pixels
+const maxTrailer = 16 << 20
+
+var (
+	// ErrImageTooLarge is returned when an encoded image declares more pixels
+	// than the decode limit allows
+	ErrImageTooLarge = errors.New("image exceeds pixel limit")
+	// ErrInvalidImage is returned when the input is not a decodable image
+	ErrInvalidImage = errors.New("invalid image")
+)
+
+// DecodeOptions bounds the memory used to decode untrusted input
+type DecodeOptions struct {
+	// MaxPixels rejects images whose header declares more than this many pixels
+	// before any pixel data is decoded (default: DefaultMaxPixels, < 0 disables)
+	MaxPixels int
+	// MaxSide downsamples decoded images so their longest side is at most this
+	// many pixels (0 keeps the decoded size)
+	MaxSide int
+	// IgnoreOrientation keeps the stored pixel layout instead of turning the
+	// image upright according to its EXIF orientation
+	IgnoreOrientation bool
+}
+
+// DecodeImage reads an image from rd, checking its declared dimensions against
+// opts.MaxPixels before decoding so oversized uploads are rejected cheaply.
+// It reads the formats registered with the image package and RegisterDecoder,
+// and applies the EXIF orientation of the image unless opts.IgnoreOrientation
+// is set.
+func DecodeImage(rd io.Reader, opts *DecodeOptions) (image.Image, error) {
+	img, _, err := decodeImage(rd, opts)
+	return img, err
+}
+
+// decodeImage is DecodeImage, also returning the metadata of the input. Once
+// applied, the orientation is reset in the metadata.
+func decodeImage(rd io.Reader, opts *DecodeOptions) (image.Image, metadata, error) {
+	if opts == nil {
+		opts = &DecodeOptions{}
+	}
+	var in bytes.Buffer
+	img, err := decodePixels(io.TeeReader(rd, &in), opts)
+	if err != nil {
+		return nil, metadata{}, err
+	}
+	// Metadata is best effort, so a failing trailer only loses it
+	_, _ = io.CopyN(io.Discard, io.TeeReader(rd, &in), maxTrailer)
+
+	md := readMetadata(in.Bytes())
+	if o := md.orientation(); o > 1 && !opts.IgnoreOrientation {
+		img = orient(img, o)
+		md.resetOrientation()
+	}
+	return img, md, nil
+}
+
+// decodePixels decodes rd within the limits of opts
+func decodePixels(rd io.Reader, opts *DecodeOptions) (image.Image, error) {
+	maxPixels := opts.MaxPixels
+	if maxPixels == 0 {
+		maxPixels = DefaultMaxPixels
+	}
+
+	// Keep the header bytes read by DecodeConfig so the full decode can replay them
+	br := bufio.NewReader(rd)
+	var head bytes.Buffer
+	var (
+		cfg    image.Config
+		format string
+		err    error
+	)
+	custom, ok := sniffDecoder(br)
+	if ok {
+		format = custom.name
+		cfg, err = custom.dec.DecodeConfig(io.TeeReader(br, &head))
+	} else {
+		cfg, format, err = image.DecodeConfig(io.TeeReader(br, &head))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read header: %w", ErrInvalidImage, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, fmt.Errorf("%w: %s dimensions %dx%d", ErrInvalidImage, format, cfg.Width, cfg.Height)
+	}
+	if maxPixels > 0 && int64(cfg.Width)*int64(cfg.Height) > int64(maxPixels) {
+		return nil, fmt.Errorf("%w: %dx%d %s, limit %d pixels", ErrImageTooLarge, cfg.Width, cfg.Height, format, maxPixels)
+	}
+
+	var img image.Image
+	if ok {
+		img, err = custom.dec.Decode(io.MultiReader(&head, br))
+	} else {
+		img, _, err = image.Decode(io.MultiReader(&head, br))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode %s: %w", ErrInvalidImage, format, err)
+	}
+	return downsample(img, opts.MaxSide), nil
+}
+
+// downsample shrinks img so its longest side is at most maxSide pixels
+func downsample(img image.Image, maxSide int) image.Image {
+	b := img.Bounds()
+	if maxSide <= 0 || max(b.Dx(), b.Dy()) <= maxSide {
+		return img
+	}
+	if isDeep(img) {
+		// imaging works in 8 bits; round the other side like it does
+		w, h := maxSide, max(1, (2*b.Dy()*maxSide+b.Dx())/(2*b.Dx()))
+		if b.Dy() > b.Dx() {
+			w, h = max(1, (2*b.Dx()*maxSide+b.Dy())/(2*b.Dy())), maxSide
+		}
+		dst := image.NewNRGBA64(image.Rect(0, 0, w, h))
+		draw.BiLinear.Scale(dst, dst.Rect, img, b, draw.Src, nil)
+		return dst
+	}
+	if b.Dx() >= b.Dy() {
+		return imaging.Resize(img, maxSide, 0, imaging.Box)
+	}
+	return imaging.Resize(img, 0, maxSide, imaging.Box)
+}
+
+// ProcessReader decodes an image from rd within the limits of opts and removes
+// its background
+func (r *RemBG) ProcessReader(rd io.Reader, opts *DecodeOptions) (*Result, error) {
+	img, err := DecodeImage(rd, opts)
+	if err != nil {
+		return nil, r.countError(ErrorKindDecode, err)
+	}
+	return r.Process(img)
+}
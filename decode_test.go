@@ -0,0 +1,96 @@
+package rmbg
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeImage(t *testing.T) {
+	data := encodePNG(t, 200, 100)
+
+	t.Run("Default", func(t *testing.T) {
+		img, err := DecodeImage(bytes.NewReader(data), nil)
+		if err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+		if got := img.Bounds().Size(); got != image.Pt(200, 100) {
+			t.Errorf("expected 200x100, got %v", got)
+		}
+	})
+
+	t.Run("MaxPixels", func(t *testing.T) {
+		_, err := DecodeImage(bytes.NewReader(data), &DecodeOptions{MaxPixels: 19_999})
+		if !errors.Is(err, ErrImageTooLarge) {
+			t.Errorf("expected ErrImageTooLarge, got %v", err)
+		}
+		if _, err := DecodeImage(bytes.NewReader(data), &DecodeOptions{MaxPixels: 20_000}); err != nil {
+			t.Errorf("expected image at the limit to decode, got %v", err)
+		}
+		if _, err := DecodeImage(bytes.NewReader(data), &DecodeOptions{MaxPixels: -1}); err != nil {
+			t.Errorf("expected disabled limit to decode, got %v", err)
+		}
+	})
+
+	t.Run("MaxSide", func(t *testing.T) {
+		img, err := DecodeImage(bytes.NewReader(data), &DecodeOptions{MaxSide: 50})
+		if err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+		if got := img.Bounds().Size(); got != image.Pt(50, 25) {
+			t.Errorf("expected 50x25, got %v", got)
+		}
+
+		tall, err := DecodeImage(bytes.NewReader(encodePNG(t, 40, 120)), &DecodeOptions{MaxSide: 60})
+		if err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+		if got := tall.Bounds().Size(); got != image.Pt(20, 60) {
+			t.Errorf("expected 20x60, got %v", got)
+		}
+	})
+
+	t.Run("MaxSideDeep", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, image.NewNRGBA64(image.Rect(0, 0, 120, 41))); err != nil {
+			t.Fatalf("failed to encode: %v", err)
+		}
+		img, err := DecodeImage(&buf, &DecodeOptions{MaxSide: 60})
+		if err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+		if _, ok := img.(*image.NRGBA64); !ok {
+			t.Errorf("expected 16 bits kept, got %T", img)
+		}
+		if got := img.Bounds().Size(); got != image.Pt(60, 21) {
+			t.Errorf("expected 60x21, got %v", got)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		if _, err := DecodeImage(strings.NewReader("not an image"), nil); err == nil {
+			t.Errorf("expected error for invalid data")
+		}
+		if _, err := DecodeImage(bytes.NewReader(data[:len(data)/2]), nil); err == nil {
+			t.Errorf("expected error for truncated data")
+		}
+	})
+}
+
+func TestDecodeImageInvalid(t *testing.T) {
+	if _, err := DecodeImage(strings.NewReader("not an image"), nil); !errors.Is(err, ErrInvalidImage) {
+		t.Errorf("expected ErrInvalidImage, got %v", err)
+	}
+}
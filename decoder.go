@@ -0,0 +1,60 @@
+package rmbg
+
+import (
+	"bufio"
+	"image"
+	"io"
+	"sync"
+)
+
+// Decoder reads an input format the image package has no decoder for, such
+// as HEIC (see the heifdec package)
+type Decoder interface {
+	// DecodeConfig returns the color model and dimensions of the image
+	// without decoding its pixels, so DecodeImage can enforce its limits
+	DecodeConfig(r io.Reader) (image.Config, error)
+	// Decode returns the image
+	Decode(r io.Reader) (image.Image, error)
+}
+
+type registeredDecoder struct {
+	name, magic string
+	dec         Decoder
+}
+
+var decoders struct {
+	sync.RWMutex
+	list []registeredDecoder
+}
+
+// RegisterDecoder makes DecodeImage, and so every engine I/O method, read
+// inputs starting with magic with dec, ahead of the image package decoders.
+// As for image.RegisterFormat, "?" in magic matches any byte. name is the
+// format reported in errors.
+func RegisterDecoder(name, magic string, dec Decoder) {
+	decoders.Lock()
+	defer decoders.Unlock()
+	decoders.list = append(decoders.list, registeredDecoder{name: name, magic: magic, dec: dec})
+}
+
+// sniffDecoder returns the registered decoder matching the first bytes of br
+func sniffDecoder(br *bufio.Reader) (registeredDecoder, bool) {
+	decoders.RLock()
+	defer decoders.RUnlock()
+	for _, d := range decoders.list {
+		head, err := br.Peek(len(d.magic))
+		if err == nil && matchMagic(d.magic, head) {
+			return d, true
+		}
+	}
+	return registeredDecoder{}, false
+}
+
+func matchMagic(magic string, head []byte) bool {
+	for i := range len(magic) {
+		if magic[i] != '?' && magic[i] != head[i] {
+			return false
+		}
+	}
+	return true
+}
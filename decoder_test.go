@@ -0,0 +1,79 @@
+package rmbg
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"strings"
+	"testing"
+)
+
+// fakeDecoder reads "TEST?" followed by the width and height in one byte each
+// as a solid red image
+type fakeDecoder struct{}
+
+func (fakeDecoder) DecodeConfig(r io.Reader) (image.Config, error) {
+	var hdr [7]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: color.NRGBAModel, Width: int(hdr[5]), Height: int(hdr[6])}, nil
+}
+
+func (d fakeDecoder) Decode(r io.Reader) (image.Image, error) {
+	cfg, err := d.DecodeConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	return solidImage(cfg.Width, cfg.Height, color.NRGBA{R: 255, A: 255}), nil
+}
+
+func TestRegisterDecoder(t *testing.T) {
+	RegisterDecoder("test", "TEST?", fakeDecoder{})
+
+	t.Run("Decode", func(t *testing.T) {
+		img, err := DecodeImage(strings.NewReader("TEST1\x14\x0a"), nil)
+		if err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+		if got := img.Bounds().Size(); got != image.Pt(20, 10) {
+			t.Errorf("expected 20x10, got %v", got)
+		}
+	})
+
+	t.Run("MaxPixels", func(t *testing.T) {
+		_, err := DecodeImage(strings.NewReader("TEST1\x14\x0a"), &DecodeOptions{MaxPixels: 199})
+		if !errors.Is(err, ErrImageTooLarge) {
+			t.Errorf("expected ErrImageTooLarge, got %v", err)
+		}
+		if err == nil || !strings.Contains(err.Error(), "test") {
+			t.Errorf("expected the format name in %v", err)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := DecodeImage(strings.NewReader("TEST1"), nil)
+		if !errors.Is(err, ErrInvalidImage) {
+			t.Errorf("expected ErrInvalidImage, got %v", err)
+		}
+	})
+
+	t.Run("OtherFormats", func(t *testing.T) {
+		if _, err := DecodeImage(bytes.NewReader(encodePNG(t, 4, 3)), nil); err != nil {
+			t.Errorf("expected PNG to decode, got %v", err)
+		}
+	})
+
+	t.Run("ProcessReader", func(t *testing.T) {
+		r := cachedEngine(solidImage(20, 10, color.NRGBA{R: 255, A: 255}))
+		res, err := r.ProcessReader(strings.NewReader("TEST1\x14\x0a"), nil)
+		if err != nil {
+			t.Fatalf("ProcessReader failed: %v", err)
+		}
+		if got := res.Image.Bounds().Size(); got != image.Pt(20, 10) {
+			t.Errorf("expected 20x10, got %v", got)
+		}
+	})
+}
@@ -0,0 +1,139 @@
+package rmbg
+
+import (
+	"fmt"
+	"image"
+)
+
+// DefaultDespillBand is the default DespillOptions.Band
+const DefaultDespillBand = 8
+
+// despillBackground is the mask value below which a pixel is background when
+// locating the edge band
+const despillBackground = 128
+
+// Screen is the backdrop color whose spill Despill removes
+type Screen int
+
+const (
+	// ScreenGreen removes green spill
+	ScreenGreen Screen = iota
+	// ScreenBlue removes blue spill
+	ScreenBlue
+)
+
+func (s Screen) String() string {
+	switch s {
+	case ScreenGreen:
+		return "green"
+	case ScreenBlue:
+		return "blue"
+	}
+	return fmt.Sprintf("Screen(%d)", int(s))
+}
+
+// ParseScreen returns the screen named s, as printed by String
+func ParseScreen(s string) (Screen, error) {
+	switch s {
+	case "green":
+		return ScreenGreen, nil
+	case "blue":
+		return ScreenBlue, nil
+	}
+	return 0, fmt.Errorf("unknown screen %q", s)
+}
+
+// DespillOptions configures Despill
+type DespillOptions struct {
+	// Screen is the backdrop color (default: ScreenGreen)
+	Screen Screen
+	// Band is how far from the background, in pixels, foreground pixels are
+	// corrected; semi-transparent pixels always are (default:
+	// DefaultDespillBand)
+	Band int
+	// Strength blends from no correction at 0 to the full limit at 1
+	// (default: 1)
+	Strength float64
+}
+
+// Despill returns img with the color cast of a green or blue screen removed
+// from the foreground near the edge of mask, which has the size of img.
+// There the screen channel is limited to the larger of the other two, so
+// green-lit hair and edges turn neutral while colors that were not lifted by
+// the screen are kept. The result has 8 bits per channel.
+func Despill(img image.Image, mask *image.Gray, opts *DespillOptions) *image.NRGBA {
+	o := DespillOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Band <= 0 {
+		o.Band = DefaultDespillBand
+	}
+	if o.Strength <= 0 || o.Strength > 1 {
+		o.Strength = 1
+	}
+	screen, other1, other2 := 1, 0, 2
+	if o.Screen == ScreenBlue {
+		screen, other1, other2 = 2, 0, 1
+	}
+
+	dst := toNRGBA(img)
+	w, h := min(dst.Rect.Dx(), mask.Rect.Dx()), min(dst.Rect.Dy(), mask.Rect.Dy())
+	near := nearBackground(mask, w, h, o.Band)
+	parallelRows(h, func(start, end int) {
+		for y := start; y < end; y++ {
+			row := dst.Pix[y*dst.Stride:][:w*4]
+			mrow := mask.Pix[y*mask.Stride:][:w]
+			for x, m := range mrow {
+				if m == 0 || m == 255 && !near[y*w+x] {
+					continue
+				}
+				p := row[x*4 : x*4+4 : x*4+4]
+				limit := max(p[other1], p[other2])
+				if p[screen] > limit {
+					p[screen] -= uint8(float64(p[screen]-limit)*o.Strength + 0.5)
+				}
+			}
+		}
+	})
+	return dst
+}
+
+// nearBackground reports for each pixel of the w x h top left of mask whether
+// a background pixel lies within band pixels, horizontally, vertically or
+// diagonally
+func nearBackground(mask *image.Gray, w, h, band int) []bool {
+	// Count background pixels in a sliding window along rows, then columns
+	rows := make([]int32, w*h)
+	for y := range h {
+		mrow := mask.Pix[y*mask.Stride:][:w]
+		var n int32
+		for x := -band; x < w; x++ {
+			if in := x + band; in < w && mrow[in] < despillBackground {
+				n++
+			}
+			if out := x - band - 1; out >= 0 && mrow[out] < despillBackground {
+				n--
+			}
+			if x >= 0 {
+				rows[y*w+x] = n
+			}
+		}
+	}
+	near := make([]bool, w*h)
+	for x := range w {
+		var n int32
+		for y := -band; y < h; y++ {
+			if in := y + band; in < h {
+				n += rows[in*w+x]
+			}
+			if out := y - band - 1; out >= 0 {
+				n -= rows[out*w+x]
+			}
+			if y >= 0 {
+				near[y*w+x] = n > 0
+			}
+		}
+	}
+	return near
+}
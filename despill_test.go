@@ -0,0 +1,122 @@
+package rmbg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// spillScene is a 40x10 image whose left half is green screen and right half
+// a grayish object with a green cast, plus one saturated green object pixel
+// far from the edge
+func spillScene() (*image.NRGBA, *image.Gray) {
+	img := solidImage(40, 10, color.NRGBA{R: 120, G: 160, B: 110, A: 255})
+	mask := image.NewGray(img.Rect)
+	fillRect(mask, image.Rect(20, 0, 40, 10), 255)
+	for y := range 10 {
+		for x := range 20 {
+			img.SetNRGBA(x, y, color.NRGBA{G: 255, A: 255})
+		}
+	}
+	img.SetNRGBA(38, 5, color.NRGBA{R: 20, G: 200, B: 30, A: 255})
+	return img, mask
+}
+
+func TestDespill(t *testing.T) {
+	img, mask := spillScene()
+	out := Despill(img, mask, nil)
+
+	tests := []struct {
+		name string
+		x, y int
+		want color.NRGBA
+	}{
+		{"Edge", 20, 5, color.NRGBA{R: 120, G: 120, B: 110, A: 255}},
+		{"InsideBand", 27, 5, color.NRGBA{R: 120, G: 120, B: 110, A: 255}},
+		{"OutsideBand", 30, 5, color.NRGBA{R: 120, G: 160, B: 110, A: 255}},
+		{"FarGreen", 38, 5, color.NRGBA{R: 20, G: 200, B: 30, A: 255}},
+		{"Background", 5, 5, color.NRGBA{G: 255, A: 255}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := out.NRGBAAt(tt.x, tt.y); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("Strength", func(t *testing.T) {
+		out := Despill(img, mask, &DespillOptions{Strength: 0.5})
+		if got := out.NRGBAAt(20, 5).G; got != 140 {
+			t.Errorf("expected green halfway to the limit, got %d", got)
+		}
+	})
+
+	t.Run("Blue", func(t *testing.T) {
+		blue := solidImage(4, 1, color.NRGBA{R: 100, G: 90, B: 150, A: 255})
+		soft := image.NewGray(blue.Rect)
+		fillRect(soft, soft.Rect, 200)
+		out := Despill(blue, soft, &DespillOptions{Screen: ScreenBlue})
+		if got := out.NRGBAAt(0, 0); got != (color.NRGBA{R: 100, G: 90, B: 100, A: 255}) {
+			t.Errorf("expected blue limited to red, got %v", got)
+		}
+	})
+}
+
+func TestNearBackground(t *testing.T) {
+	mask := image.NewGray(image.Rect(0, 0, 9, 9))
+	fillRect(mask, mask.Rect, 255)
+	mask.SetGray(4, 4, color.Gray{})
+	near := nearBackground(mask, 9, 9, 2)
+	for y := range 9 {
+		for x := range 9 {
+			want := x >= 2 && x <= 6 && y >= 2 && y <= 6
+			if near[y*9+x] != want {
+				t.Errorf("expected %v at (%d, %d), got %v", want, x, y, near[y*9+x])
+			}
+		}
+	}
+}
+
+func TestParseScreen(t *testing.T) {
+	for _, s := range []Screen{ScreenGreen, ScreenBlue} {
+		if got, err := ParseScreen(s.String()); err != nil || got != s {
+			t.Errorf("expected %v, got %v, %v", s, got, err)
+		}
+	}
+	if _, err := ParseScreen("red"); err == nil {
+		t.Errorf("expected error for an unknown screen")
+	}
+}
+
+func TestRemoveBackgroundDespill(t *testing.T) {
+	src := solidImage(20, 10, color.NRGBA{R: 100, G: 180, B: 100, A: 255})
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, src); err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	// The object is the right half
+	mask := image.NewGray(src.Rect)
+	fillRect(mask, image.Rect(10, 0, 20, 10), 255)
+	r := cachedEngine()
+	r.cache.put(hashImage(src, r.model.spec.Name), &prediction{mask: mask})
+
+	var out bytes.Buffer
+	opts := &IOOptions{Background: color.White, Despill: &DespillOptions{}}
+	if err := r.RemoveBackgroundFrom(bytes.NewReader(encoded.Bytes()), &out, FormatPNG, opts); err != nil {
+		t.Fatalf("RemoveBackgroundFrom failed: %v", err)
+	}
+	img, err := png.Decode(&out)
+	if err != nil {
+		t.Fatalf("invalid output: %v", err)
+	}
+	if got := color.NRGBAModel.Convert(img.At(14, 5)).(color.NRGBA); got != (color.NRGBA{R: 100, G: 100, B: 100, A: 255}) {
+		t.Errorf("expected no green cast near the edge, got %v", got)
+	}
+
+	if err := r.RemoveBackgroundFrom(bytes.NewReader(encoded.Bytes()), &out, FormatPSD, opts); err == nil {
+		t.Errorf("expected error despilling PSD output")
+	}
+}
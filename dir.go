@@ -0,0 +1,399 @@
+package rmbg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrOutputIsInput is the error of a ProcessDir input whose output path is
+// the input itself, which would overwrite the source image
+var ErrOutputIsInput = errors.New("output would overwrite its input")
+
+// DefaultInclude are the file patterns ProcessDir processes when DirOptions
+// sets none: the formats the decoder understands
+var DefaultInclude = []string{"*.jpg", "*.jpeg", "*.png", "*.gif", "*.bmp", "*.tif", "*.tiff", "*.webp"}
+
+// DirOptions configures ProcessDir
+type DirOptions struct {
+	// Workers is the number of files processed at once (default: one per
+	// session plus one)
+	Workers int
+	// Include selects the files to process by glob pattern, matched
+	// case-insensitively against the file name and against the slash-separated
+	// path relative to the input directory (default: DefaultInclude)
+	Include []string
+	// Exclude skips files matching any of these patterns, matched like Include;
+	// a matching directory is skipped entirely
+	Exclude []string
+	// SkipExisting leaves files whose output already exists untouched
+	SkipExisting bool
+	// ContentNames names each output after the hash of its input file and the
+	// settings of the run, in the directory of the input: the same input
+	// rendered the same way always gets the same name, and a change of the
+	// model file, the output-affecting engine settings, Format or IO a new
+	// one, so outputs can be cached forever. See ManifestEngine for how custom
+	// processors are identified. With SkipExisting, re-runs only
+	// process new or changed inputs. Identical inputs share one output.
+	ContentNames bool
+	// Manifest writes a JSON Manifest to this path, relative to the output
+	// directory unless absolute, mapping each input to its output and the
+	// settings of the run
+	Manifest string
+	// State records each completed input in this file, relative to the output
+	// directory unless absolute, as it completes, so that a crashed or
+	// canceled run can be resumed. Without Resume, the file starts over.
+	State string
+	// Resume skips the inputs that State, or DefaultStateFile when unset,
+	// records as completed, that have not changed since and whose output is
+	// still there. A state file written with other settings, such as another
+	// Format, IO or model, starts over.
+	Resume bool
+	// Format is the output format; output files keep their relative path with
+	// the format's extension (default: FormatPNG)
+	Format Format
+	// IO configures decoding, cropping and encoding (default: ProcessFile
+	// defaults)
+	IO *IOOptions
+	// Progress is called after each file with its result and the number of
+	// files done so far out of total. Calls are serialized.
+	Progress func(f FileResult, done, total int)
+}
+
+// FileResult is the outcome of one file of ProcessDir
+type FileResult struct {
+	// Input and Output are the paths of the source and output files
+	Input  string
+	Output string
+	// Skipped is set when the output already existed and SkipExisting is on,
+	// when another input of ContentNames with the same content wrote it, or when a
+	// previous run completed the input and Resume is on
+	Skipped bool
+	// Hash is the content hash the output is named after with ContentNames
+	Hash string
+	// Duration is the time spent processing the file
+	Duration time.Duration
+	// Err is the error for this file only
+	Err error
+}
+
+// DirReport is the outcome of ProcessDir
+type DirReport struct {
+	// Files holds one result per matched file, sorted by input path
+	Files []FileResult
+	// Processed, Skipped and Failed count the files by outcome
+	Processed, Skipped, Failed int
+}
+
+// ProcessDir removes the background of every image under inDir matching
+// opts, writing the outputs under outDir with the same relative paths. Files
+// are processed concurrently and a failure on one does not stop the others.
+// If ctx is canceled, files not yet started fail with ctx's error, which is
+// also returned. The error is otherwise only set when inDir cannot be walked
+// or the state file or manifest cannot be written.
+//
+// The state file and manifest are never taken as inputs, and neither is
+// outDir when it lies inside inDir. When outDir is inDir itself, outputs
+// matching Include are inputs of later runs, and an input whose output path
+// is the input, such as a PNG written as PNG, fails with ErrOutputIsInput
+// instead of being overwritten.
+func (r *RemBG) ProcessDir(ctx context.Context, inDir, outDir string, opts *DirOptions) (*DirReport, error) {
+	if opts == nil {
+		opts = &DirOptions{}
+	}
+	include := opts.Include
+	if len(include) == 0 {
+		include = DefaultInclude
+	}
+	for _, pattern := range append(append([]string{}, include...), opts.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = r.batchWorkers()
+	}
+
+	// The outputs and files of the run are not inputs when outDir is inside
+	// inDir
+	state := statePath(opts, outDir)
+	own := []string{outDir, state, filepath.Join(outDir, DefaultStateFile)}
+	if opts.Manifest != "" {
+		manifest := manifestPath(opts.Manifest, outDir)
+		own = append(own, manifest, manifest+".tmp")
+	}
+	files, err := listFiles(inDir, include, opts.Exclude, own)
+	if err != nil {
+		return nil, err
+	}
+	run := &dirRun{opts: opts, outDir: outDir, ext: "." + opts.Format.String()}
+	if opts.Format == FormatJPEG {
+		run.ext = ".jpg"
+	}
+	var params ManifestParams
+	if opts.ContentNames || opts.Manifest != "" || state != "" {
+		if params, run.params, err = r.manifestParams(opts); err != nil {
+			return nil, err
+		}
+	}
+	if state != "" {
+		if run.state, err = openState(state, stateParams(run.params, opts.ContentNames), opts.Resume); err != nil {
+			return nil, err
+		}
+		defer run.state.close()
+	}
+
+	report := &DirReport{Files: make([]FileResult, len(files))}
+	for i, rel := range files {
+		out := strings.TrimSuffix(rel, filepath.Ext(rel)) + run.ext
+		report.Files[i] = FileResult{Input: filepath.Join(inDir, rel), Output: filepath.Join(outDir, out)}
+	}
+
+	var progressMu sync.Mutex
+	done := 0
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(workers, len(files)) {
+		wg.Go(func() {
+			for i := range next {
+				r.processDirFile(&report.Files[i], files[i], run)
+				if opts.Progress != nil {
+					progressMu.Lock()
+					done++
+					opts.Progress(report.Files[i], done, len(files))
+					progressMu.Unlock()
+				}
+			}
+		})
+	}
+	for i := range report.Files {
+		if ctx.Err() != nil {
+			report.Files[i].Err = ctx.Err()
+			continue
+		}
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			report.Files[i].Err = ctx.Err()
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	for _, f := range report.Files {
+		switch {
+		case f.Err != nil:
+			report.Failed++
+		case f.Skipped:
+			report.Skipped++
+		default:
+			report.Processed++
+		}
+	}
+	if opts.Manifest != "" {
+		if err := writeManifest(opts.Manifest, inDir, outDir, params, report); err != nil {
+			return report, err
+		}
+	}
+	return report, ctx.Err()
+}
+
+// dirRun is the state of a ProcessDir call shared by its workers
+type dirRun struct {
+	opts   *DirOptions
+	outDir string
+	// ext is the extension of the outputs
+	ext string
+	// params is the JSON encoding of the settings, which content names hash
+	params []byte
+	// claimed maps the content-named outputs being written to their *claim,
+	// so identical inputs write theirs once
+	claimed sync.Map
+	// state records completed inputs, when set
+	state *batchState
+}
+
+// errClaimAbandoned is the error of a claim whose input stopped before
+// writing its output
+var errClaimAbandoned = errors.New("output not written")
+
+// claim is the write of a content-named output by the first of its inputs,
+// which the others wait for
+type claim struct {
+	done chan struct{}
+	// err is the error of the write, set before done is closed
+	err error
+}
+
+// processDirFile processes the input rel of run into f
+func (r *RemBG) processDirFile(f *FileResult, rel string, run *dirRun) {
+	start := time.Now()
+	defer func() { f.Duration = time.Since(start) }()
+	opts := run.opts
+
+	var info fs.FileInfo
+	if run.state != nil {
+		var err error
+		if info, err = os.Stat(f.Input); err != nil {
+			f.Err = err
+			return
+		}
+		if rec, ok := run.state.completed(rel, info); ok {
+			// An output deleted since is done again
+			output := filepath.Join(run.outDir, filepath.FromSlash(rec.Output))
+			if _, err := os.Stat(output); err == nil {
+				f.Output, f.Hash, f.Skipped = output, rec.Hash, true
+				return
+			}
+		}
+	}
+	var c *claim
+	if opts.ContentNames {
+		hash, err := contentHash(f.Input, run.params)
+		if err != nil {
+			f.Err = err
+			return
+		}
+		f.Hash = hash
+		f.Output = contentName(f.Output, hash, run.ext)
+		c = &claim{done: make(chan struct{}), err: errClaimAbandoned}
+		if other, dup := run.claimed.LoadOrStore(f.Output, c); dup {
+			// The output is only there if the input that claimed it wrote it
+			other := other.(*claim)
+			<-other.done
+			f.Err, f.Skipped = other.err, other.err == nil
+			return
+		}
+		defer close(c.done)
+	}
+
+	if sameFile(f.Input, f.Output) {
+		f.Err = fmt.Errorf("%w: %s", ErrOutputIsInput, f.Input)
+		if c != nil {
+			c.err = f.Err
+		}
+		return
+	}
+	if opts.SkipExisting {
+		_, err := os.Stat(f.Output)
+		f.Skipped = err == nil
+	}
+	if !f.Skipped {
+		f.Err = os.MkdirAll(filepath.Dir(f.Output), 0o755)
+		if f.Err == nil {
+			f.Err = r.ProcessFile(f.Input, f.Output, opts.IO)
+		}
+	}
+	if c != nil {
+		c.err = f.Err
+	}
+	if f.Err != nil {
+		return
+	}
+
+	if run.state != nil {
+		out, err := filepath.Rel(run.outDir, f.Output)
+		if err != nil {
+			f.Err = err
+			return
+		}
+		rec := stateRecord{
+			Input:   filepath.ToSlash(rel),
+			Output:  filepath.ToSlash(out),
+			Hash:    f.Hash,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		}
+		if err := run.state.record(rec); err != nil {
+			f.Err = fmt.Errorf("failed to record state: %w", err)
+		}
+	}
+}
+
+// sameFile reports whether the paths a and b name the same file
+func sameFile(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA == nil && errB == nil && absA == absB {
+		return true
+	}
+	// Links and case-insensitive file systems give one file several paths
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	infoB, err := os.Stat(b)
+	return err == nil && os.SameFile(infoA, infoB)
+}
+
+// listFiles returns the paths relative to root of the regular files matching
+// include and not exclude, in lexical order, leaving out the files and
+// directories at the paths of skip other than root
+func listFiles(root string, include, exclude, skip []string) ([]string, error) {
+	skipped := make(map[string]bool, len(skip))
+	for _, p := range skip {
+		if p == "" {
+			continue
+		}
+		if abs, err := filepath.Abs(p); err == nil {
+			skipped[abs] = true
+		}
+	}
+	var files []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if abs, err := filepath.Abs(p); err == nil && skipped[abs] {
+				return filepath.SkipDir
+			}
+		}
+		if matchAny(exclude, rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() && matchAny(include, rel) {
+			if abs, err := filepath.Abs(p); err == nil && skipped[abs] {
+				return nil
+			}
+			files = append(files, rel)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// matchAny reports whether the name or slash-separated path of rel matches
+// any of the patterns, ignoring case
+func matchAny(patterns []string, rel string) bool {
+	rel = strings.ToLower(filepath.ToSlash(rel))
+	name := rel[strings.LastIndex(rel, "/")+1:]
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+	}
+	return false
+}
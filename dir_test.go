@@ -0,0 +1,342 @@
+package rmbg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestProcessDir(t *testing.T) {
+	red := solidImage(8, 4, color.NRGBA{R: 255, A: 255})
+	in, out := t.TempDir(), t.TempDir()
+	write := func(rel string, data []byte) {
+		t.Helper()
+		path := filepath.Join(in, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", rel, err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, red); err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	write("a.png", buf.Bytes())
+	write("sub/B.PNG", buf.Bytes())
+	write("broken.png", []byte("not an image"))
+	write("notes.txt", []byte("hello"))
+	write("raw/c.png", buf.Bytes())
+
+	r := cachedEngine(red)
+	var progress []int
+	opts := &DirOptions{Exclude: []string{"raw"}, Workers: 2, Progress: func(_ FileResult, done, total int) {
+		if total != 3 {
+			t.Errorf("expected 3 files in total, got %d", total)
+		}
+		progress = append(progress, done)
+	}}
+
+	report, err := r.ProcessDir(context.Background(), in, out, opts)
+	if err != nil {
+		t.Fatalf("ProcessDir failed: %v", err)
+	}
+	if len(report.Files) != 3 || report.Processed != 2 || report.Failed != 1 {
+		t.Fatalf("expected 2 processed and 1 failed of 3, got %+v", report)
+	}
+	if report.Files[0].Input != filepath.Join(in, "a.png") || report.Files[1].Err == nil {
+		t.Errorf("expected files in lexical order with broken.png failing, got %+v", report.Files)
+	}
+	if !slices.Equal(progress, []int{1, 2, 3}) {
+		t.Errorf("expected progress 1, 2, 3, got %v", progress)
+	}
+	for _, rel := range []string{"a.png", "sub/B.png"} {
+		if _, err := os.Stat(filepath.Join(out, rel)); err != nil {
+			t.Errorf("expected output %s, got %v", rel, err)
+		}
+	}
+
+	t.Run("SkipExisting", func(t *testing.T) {
+		report, err := r.ProcessDir(context.Background(), in, out, &DirOptions{Include: []string{"*.png"}, Exclude: []string{"raw", "broken.png"}, SkipExisting: true})
+		if err != nil {
+			t.Fatalf("ProcessDir failed: %v", err)
+		}
+		if report.Skipped != 2 || report.Processed != 0 {
+			t.Errorf("expected 2 skipped files, got %+v", report)
+		}
+	})
+
+	t.Run("Format", func(t *testing.T) {
+		jpgOut := t.TempDir()
+		if _, err := r.ProcessDir(context.Background(), in, jpgOut, &DirOptions{Include: []string{"a.png"}, Format: FormatJPEG}); err != nil {
+			t.Fatalf("ProcessDir failed: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(jpgOut, "a.jpg")); err != nil {
+			t.Errorf("expected a.jpg, got %v", err)
+		}
+	})
+
+	t.Run("ContentNames", func(t *testing.T) {
+		named := t.TempDir()
+		copyOpts := &DirOptions{Include: []string{"*.png"}, Exclude: []string{"broken.png"}, ContentNames: true, SkipExisting: true, Manifest: "manifest.json"}
+		report, err := r.ProcessDir(context.Background(), in, named, copyOpts)
+		if err != nil {
+			t.Fatalf("ProcessDir failed: %v", err)
+		}
+		// a.png, raw/c.png and sub/B.PNG have the same content, in three
+		// directories
+		if report.Processed != 3 || report.Failed != 0 {
+			t.Fatalf("expected 3 processed files, got %+v", report)
+		}
+		hash := report.Files[0].Hash
+		if len(hash) != 32 || report.Files[1].Hash != hash {
+			t.Fatalf("expected one 32-digit hash for identical inputs, got %+v", report.Files)
+		}
+		for _, rel := range []string{hash + ".png", "sub/" + hash + ".png"} {
+			if _, err := os.Stat(filepath.Join(named, rel)); err != nil {
+				t.Errorf("expected output %s, got %v", rel, err)
+			}
+		}
+
+		data, err := os.ReadFile(filepath.Join(named, "manifest.json"))
+		if err != nil {
+			t.Fatalf("expected a manifest, got %v", err)
+		}
+		var m Manifest
+		if err := json.Unmarshal(data, &m); err != nil {
+			t.Fatalf("invalid manifest: %v", err)
+		}
+		if m.Params.Model != ModelU2NetP.Name || m.Params.Format != "png" {
+			t.Errorf("expected u2netp and png parameters, got %+v", m.Params)
+		}
+		want := ManifestEntry{Input: "sub/B.PNG", Output: "sub/" + hash + ".png", Hash: hash}
+		if len(m.Files) != 3 || m.Files[2] != want {
+			t.Errorf("expected %+v last of 3 entries, got %+v", want, m.Files)
+		}
+
+		// The same run again finds every output
+		report, err = r.ProcessDir(context.Background(), in, named, copyOpts)
+		if err != nil {
+			t.Fatalf("ProcessDir failed: %v", err)
+		}
+		if report.Skipped != 3 {
+			t.Errorf("expected 3 skipped files, got %+v", report)
+		}
+
+		// Other settings name outputs differently
+		report, err = r.ProcessDir(context.Background(), in, named, &DirOptions{Include: []string{"a.png"}, ContentNames: true, IO: &IOOptions{Background: color.White}})
+		if err != nil {
+			t.Fatalf("ProcessDir failed: %v", err)
+		}
+		if report.Files[0].Hash == hash {
+			t.Errorf("expected another hash for another background")
+		}
+
+		// So do engine settings
+		guided := cachedEngine(red)
+		guided.upsampling = UpsampleGuided
+		report, err = guided.ProcessDir(context.Background(), in, t.TempDir(), &DirOptions{Include: []string{"a.png"}, ContentNames: true})
+		if err != nil {
+			t.Fatalf("ProcessDir failed: %v", err)
+		}
+		if report.Files[0].Hash == hash {
+			t.Errorf("expected another hash for another upsampling")
+		}
+
+		// And the model file, as after ReloadModel
+		reloaded := cachedEngine(red)
+		reloaded.modelPath = filepath.Join(t.TempDir(), "model.onnx")
+		if err := os.WriteFile(reloaded.modelPath, []byte("weights"), 0o644); err != nil {
+			t.Fatalf("failed to write model: %v", err)
+		}
+		report, err = reloaded.ProcessDir(context.Background(), in, t.TempDir(), &DirOptions{Include: []string{"a.png"}, ContentNames: true})
+		if err != nil {
+			t.Fatalf("ProcessDir failed: %v", err)
+		}
+		if report.Files[0].Hash == hash {
+			t.Errorf("expected another hash for another model file")
+		}
+
+		// Identical inputs of a directory share their output
+		dupes := t.TempDir()
+		for _, name := range []string{"x.png", "y.png"} {
+			if err := os.WriteFile(filepath.Join(dupes, name), buf.Bytes(), 0o644); err != nil {
+				t.Fatalf("failed to write %s: %v", name, err)
+			}
+		}
+		report, err = r.ProcessDir(context.Background(), dupes, t.TempDir(), &DirOptions{ContentNames: true})
+		if err != nil {
+			t.Fatalf("ProcessDir failed: %v", err)
+		}
+		if report.Processed != 1 || report.Skipped != 1 || report.Files[0].Output != report.Files[1].Output {
+			t.Errorf("expected one output for both inputs, got %+v", report)
+		}
+
+		// and its failure
+		blocked := t.TempDir()
+		if err := os.Mkdir(filepath.Join(blocked, filepath.Base(report.Files[0].Output)), 0o755); err != nil {
+			t.Fatalf("failed to block the output: %v", err)
+		}
+		report, err = r.ProcessDir(context.Background(), dupes, blocked, &DirOptions{ContentNames: true})
+		if err != nil {
+			t.Fatalf("ProcessDir failed: %v", err)
+		}
+		if report.Failed != 2 || report.Files[0].Err == nil || report.Files[1].Err == nil {
+			t.Errorf("expected both inputs to fail, got %+v", report)
+		}
+	})
+
+	t.Run("Resume", func(t *testing.T) {
+		resumed := t.TempDir()
+		stateOpts := &DirOptions{Exclude: []string{"raw"}, State: "state.jsonl"}
+		report, err := r.ProcessDir(context.Background(), in, resumed, stateOpts)
+		if err != nil {
+			t.Fatalf("ProcessDir failed: %v", err)
+		}
+		if report.Processed != 2 || report.Failed != 1 {
+			t.Fatalf("expected 2 processed and 1 failed, got %+v", report)
+		}
+
+		// Completed inputs are skipped, failed ones retried
+		resumeOpts := &DirOptions{Exclude: []string{"raw"}, Resume: true, State: "state.jsonl"}
+		report, err = r.ProcessDir(context.Background(), in, resumed, resumeOpts)
+		if err != nil {
+			t.Fatalf("ProcessDir failed: %v", err)
+		}
+		if report.Skipped != 2 || report.Failed != 1 {
+			t.Errorf("expected 2 skipped and 1 failed, got %+v", report)
+		}
+		if report.Files[0].Output != filepath.Join(resumed, "a.png") {
+			t.Errorf("expected the recorded output, got %s", report.Files[0].Output)
+		}
+
+		// A changed input runs again
+		later := time.Now().Add(time.Hour)
+		if err := os.Chtimes(filepath.Join(in, "a.png"), later, later); err != nil {
+			t.Fatalf("failed to touch a.png: %v", err)
+		}
+		report, err = r.ProcessDir(context.Background(), in, resumed, resumeOpts)
+		if err != nil {
+			t.Fatalf("ProcessDir failed: %v", err)
+		}
+		if report.Processed != 1 || report.Skipped != 1 {
+			t.Errorf("expected the changed input processed again, got %+v", report)
+		}
+
+		// Without Resume the state starts over
+		if _, err := r.ProcessDir(context.Background(), in, resumed, &DirOptions{Include: []string{"a.png"}, State: "state.jsonl"}); err != nil {
+			t.Fatalf("ProcessDir failed: %v", err)
+		}
+		data, err := os.ReadFile(filepath.Join(resumed, "state.jsonl"))
+		if err != nil {
+			t.Fatalf("expected a state file, got %v", err)
+		}
+		if n := bytes.Count(data, []byte("\n")); n != 2 {
+			t.Errorf("expected a header and 1 record, got %d lines", n)
+		}
+
+		// A deleted output is done again
+		if err := os.Remove(filepath.Join(resumed, "a.png")); err != nil {
+			t.Fatalf("failed to remove a.png: %v", err)
+		}
+		report, err = r.ProcessDir(context.Background(), in, resumed, &DirOptions{Include: []string{"a.png"}, Resume: true, State: "state.jsonl"})
+		if err != nil {
+			t.Fatalf("ProcessDir failed: %v", err)
+		}
+		if report.Processed != 1 {
+			t.Errorf("expected the deleted output processed again, got %+v", report)
+		}
+
+		// Other settings start over
+		report, err = r.ProcessDir(context.Background(), in, resumed, &DirOptions{Include: []string{"a.png"}, Resume: true, State: "state.jsonl", Format: FormatJPEG})
+		if err != nil {
+			t.Fatalf("ProcessDir failed: %v", err)
+		}
+		if report.Processed != 1 || report.Files[0].Output != filepath.Join(resumed, "a.jpg") {
+			t.Errorf("expected a JPEG run to start over, got %+v", report)
+		}
+	})
+
+	t.Run("InPlace", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "a.png"), buf.Bytes(), 0o644); err != nil {
+			t.Fatalf("failed to write a.png: %v", err)
+		}
+		report, err := r.ProcessDir(context.Background(), dir, dir, nil)
+		if err != nil {
+			t.Fatalf("ProcessDir failed: %v", err)
+		}
+		if report.Failed != 1 || !errors.Is(report.Files[0].Err, ErrOutputIsInput) {
+			t.Errorf("expected ErrOutputIsInput, got %+v", report.Files)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, "a.png"))
+		if err != nil || !bytes.Equal(data, buf.Bytes()) {
+			t.Errorf("expected the source left untouched")
+		}
+	})
+
+	t.Run("SameDir", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "a.png"), buf.Bytes(), 0o644); err != nil {
+			t.Fatalf("failed to write a.png: %v", err)
+		}
+		sameOpts := &DirOptions{Include: []string{"*.png", "*.json", "*.jsonl"}, Resume: true, Manifest: "manifest.json", Format: FormatJPEG}
+		for range 2 {
+			report, err := r.ProcessDir(context.Background(), dir, dir, sameOpts)
+			if err != nil {
+				t.Fatalf("ProcessDir failed: %v", err)
+			}
+			if len(report.Files) != 1 || report.Failed != 0 {
+				t.Errorf("expected the state file and manifest not taken as inputs, got %+v", report.Files)
+			}
+		}
+		data, err := os.ReadFile(filepath.Join(dir, "a.png"))
+		if err != nil || !bytes.Equal(data, buf.Bytes()) {
+			t.Errorf("expected the source left untouched")
+		}
+	})
+
+	t.Run("NestedOutDir", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "a.png"), buf.Bytes(), 0o644); err != nil {
+			t.Fatalf("failed to write a.png: %v", err)
+		}
+		nested := filepath.Join(dir, "cutouts")
+		for range 2 {
+			report, err := r.ProcessDir(context.Background(), dir, nested, nil)
+			if err != nil {
+				t.Fatalf("ProcessDir failed: %v", err)
+			}
+			if len(report.Files) != 1 || report.Processed != 1 {
+				t.Errorf("expected the outputs of earlier runs not taken as inputs, got %+v", report.Files)
+			}
+		}
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		report, err := r.ProcessDir(ctx, in, t.TempDir(), opts)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+		if report.Failed != len(report.Files) {
+			t.Errorf("expected every file to fail, got %+v", report)
+		}
+	})
+
+	t.Run("BadPattern", func(t *testing.T) {
+		if _, err := r.ProcessDir(context.Background(), in, out, &DirOptions{Include: []string{"["}}); err == nil {
+			t.Errorf("expected invalid pattern error")
+		}
+	})
+}
@@ -0,0 +1,137 @@
+package rmbg
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// Quad is a quadrilateral with its corners in the order top-left, top-right,
+// bottom-right, bottom-left
+type Quad [4]Point
+
+// DocumentOptions configures ExtractDocument
+type DocumentOptions struct {
+	// Width and Height are the size of the output in pixels. Setting only one
+	// keeps the aspect ratio measured on the page (default: the measured size
+	// of the page).
+	Width, Height int
+	// Threshold is the mask value at or above which a pixel belongs to the
+	// page (default: 128)
+	Threshold uint8
+}
+
+// ExtractDocument segments a flat document such as a page or a receipt, finds
+// its corners and warps it to an upright rectangle, removing the background
+// and the perspective of the shot, see ExtractDocumentWithMask
+func (r *RemBG) ExtractDocument(img image.Image, opts *DocumentOptions) (*image.NRGBA, error) {
+	pred, err := r.predict(img)
+	if err != nil {
+		return nil, err
+	}
+	mask := r.upsampleMask(pred.mask, img)
+	defer r.outputs.putPix(mask.Pix)
+	return ExtractDocumentWithMask(img, mask, opts)
+}
+
+// ExtractDocumentWithMask warps the page of img given by mask, which may have
+// any resolution, to an upright rectangle. Pixels of the rectangle outside
+// the mask, such as torn or folded corners, are transparent. It returns
+// ErrNoObjectDetected when the mask holds no page.
+func ExtractDocumentWithMask(img image.Image, mask *image.Gray, opts *DocumentOptions) (*image.NRGBA, error) {
+	var o DocumentOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.Width < 0 || o.Height < 0 {
+		return nil, fmt.Errorf("%w: document size %dx%d is negative", ErrInvalidSize, o.Width, o.Height)
+	}
+	if mask == nil || mask.Bounds().Empty() {
+		return nil, fmt.Errorf("mask image is nil or empty")
+	}
+	corners, ok := DetectDocument(mask, o.Threshold)
+	if !ok {
+		return nil, fmt.Errorf("%w: no page in the mask", ErrNoObjectDetected)
+	}
+
+	// Corners in image coordinates, relative to its origin
+	b, mb := img.Bounds(), mask.Bounds()
+	sx := float64(b.Dx()) / float64(mb.Dx())
+	sy := float64(b.Dy()) / float64(mb.Dy())
+	var page Quad
+	for i, p := range corners {
+		page[i] = Point{p.X * sx, p.Y * sy}
+	}
+	w, h := documentSize(page, o.Width, o.Height)
+
+	out, err := WarpQuad(img, page, w, h)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNoObjectDetected, err)
+	}
+	toMask, err := EstimateHomography(outputQuad(w, h), corners)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNoObjectDetected, err)
+	}
+	alpha := warpGray(mask, toMask, w, h)
+	for i, a := range alpha.Pix {
+		out.Pix[i*4+3] = uint8(uint16(out.Pix[i*4+3]) * uint16(a) / 255)
+	}
+	return out, nil
+}
+
+// DetectDocument returns the corners of the largest object of mask at or
+// above threshold (default: 128), in mask coordinates relative to its origin.
+// Each corner is the outline point furthest towards its diagonal, which finds
+// pages and receipts turned by less than 45 degrees. It reports false when the
+// mask holds no object.
+func DetectDocument(mask *image.Gray, threshold uint8) (Quad, bool) {
+	if threshold == 0 {
+		threshold = 128
+	}
+	var outline Polygon
+	for _, poly := range ExtractContours(mask, &ContourConfig{Threshold: threshold, Tolerance: -1}) {
+		if math.Abs(poly.Area()) > math.Abs(outline.Area()) {
+			outline = poly
+		}
+	}
+	if len(outline) < 3 {
+		return Quad{}, false
+	}
+
+	origin := mask.Bounds().Min
+	var q Quad
+	best := [4]float64{math.Inf(1), math.Inf(-1), math.Inf(-1), math.Inf(1)}
+	for _, p := range outline {
+		p = Point{p.X - float64(origin.X), p.Y - float64(origin.Y)}
+		if s := p.X + p.Y; s < best[0] {
+			best[0], q[0] = s, p
+		}
+		if d := p.X - p.Y; d > best[1] {
+			best[1], q[1] = d, p
+		}
+		if s := p.X + p.Y; s > best[2] {
+			best[2], q[2] = s, p
+		}
+		if d := p.X - p.Y; d < best[3] {
+			best[3], q[3] = d, p
+		}
+	}
+	return q, true
+}
+
+// documentSize returns the output size of a page: width and height when set,
+// else the mean lengths of its opposite sides, scaled to the one set
+func documentSize(page Quad, width, height int) (int, int) {
+	dist := func(a, b Point) float64 { return math.Hypot(b.X-a.X, b.Y-a.Y) }
+	w := (dist(page[0], page[1]) + dist(page[3], page[2])) / 2
+	h := (dist(page[0], page[3]) + dist(page[1], page[2])) / 2
+	switch {
+	case width > 0 && height > 0:
+		return width, height
+	case width > 0:
+		return width, max(1, int(math.Round(float64(width)*h/w)))
+	case height > 0:
+		return max(1, int(math.Round(float64(height)*w/h))), height
+	}
+	return max(1, int(math.Round(w))), max(1, int(math.Round(h)))
+}
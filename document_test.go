@@ -0,0 +1,110 @@
+package rmbg
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestDetectDocument(t *testing.T) {
+	mask := image.NewGray(image.Rect(0, 0, 60, 50))
+	fillRect(mask, image.Rect(10, 5, 40, 45), 255)
+	q, ok := DetectDocument(mask, 0)
+	if !ok {
+		t.Fatal("expected a page")
+	}
+	want := Quad{{10, 5}, {40, 5}, {40, 45}, {10, 45}}
+	for i := range q {
+		if math.Abs(q[i].X-want[i].X) > 0.6 || math.Abs(q[i].Y-want[i].Y) > 0.6 {
+			t.Errorf("expected corner %d near %v, got %v", i, want[i], q[i])
+		}
+	}
+
+	if _, ok := DetectDocument(image.NewGray(image.Rect(0, 0, 10, 10)), 0); ok {
+		t.Error("expected no page in an empty mask")
+	}
+}
+
+func TestExtractDocument(t *testing.T) {
+	red := color.NRGBA{R: 220, G: 30, B: 30, A: 255}
+	blue := color.NRGBA{R: 30, G: 30, B: 220, A: 255}
+	// A 100x140 page, red on the left and blue on the right, shot at an
+	// angle on a dark table
+	page := Quad{{52, 20}, {150, 34}, {138, 180}, {40, 166}}
+	toPage, err := EstimateHomography(page, Quad{{0, 0}, {100, 0}, {100, 140}, {0, 140}})
+	if err != nil {
+		t.Fatalf("EstimateHomography failed: %v", err)
+	}
+	img := solidImage(200, 200, color.NRGBA{R: 20, G: 20, B: 20, A: 255})
+	mask := image.NewGray(img.Rect)
+	for y := range 200 {
+		for x := range 200 {
+			p := toPage.Apply(Point{float64(x) + 0.5, float64(y) + 0.5})
+			if p.X < 0 || p.X >= 100 || p.Y < 0 || p.Y >= 140 {
+				continue
+			}
+			img.SetNRGBA(x, y, red)
+			if p.X >= 50 {
+				img.SetNRGBA(x, y, blue)
+			}
+			mask.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+
+	out, err := ExtractDocumentWithMask(img, mask, nil)
+	if err != nil {
+		t.Fatalf("ExtractDocumentWithMask failed: %v", err)
+	}
+	w, h := out.Rect.Dx(), out.Rect.Dy()
+	if math.Abs(float64(w)-99) > 3 || math.Abs(float64(h)-146) > 6 {
+		t.Errorf("expected about 99x146, got %dx%d", w, h)
+	}
+	for _, tt := range []struct {
+		x, y int
+		want color.NRGBA
+	}{
+		{w / 4, h / 2, red},
+		{3 * w / 4, h / 2, blue},
+		{5, 5, red},
+		{w - 5, h - 5, blue},
+	} {
+		if c := out.NRGBAAt(tt.x, tt.y); absDiff(c.R, tt.want.R) > 8 || absDiff(c.B, tt.want.B) > 8 || c.A < 250 {
+			t.Errorf("expected %v at (%d,%d), got %v", tt.want, tt.x, tt.y, c)
+		}
+	}
+
+	t.Run("Size", func(t *testing.T) {
+		out, err := ExtractDocumentWithMask(img, mask, &DocumentOptions{Width: 50})
+		if err != nil {
+			t.Fatalf("ExtractDocumentWithMask failed: %v", err)
+		}
+		if out.Rect.Dx() != 50 || math.Abs(float64(out.Rect.Dy())-73) > 3 {
+			t.Errorf("expected about 50x73, got %v", out.Rect.Size())
+		}
+	})
+
+	t.Run("LowResolutionMask", func(t *testing.T) {
+		small := image.NewGray(image.Rect(0, 0, 100, 100))
+		for y := range 100 {
+			for x := range 100 {
+				small.Pix[y*100+x] = mask.Pix[(2*y+1)*200+2*x+1]
+			}
+		}
+		out, err := ExtractDocumentWithMask(img, small, nil)
+		if err != nil {
+			t.Fatalf("ExtractDocumentWithMask failed: %v", err)
+		}
+		if c := out.NRGBAAt(out.Rect.Dx()/4, out.Rect.Dy()/2); c != red {
+			t.Errorf("expected red on the left, got %v", c)
+		}
+	})
+
+	t.Run("NoPage", func(t *testing.T) {
+		_, err := ExtractDocumentWithMask(img, image.NewGray(img.Rect), nil)
+		if !errors.Is(err, ErrNoObjectDetected) {
+			t.Errorf("expected ErrNoObjectDetected, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,158 @@
+package rmbg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"slices"
+)
+
+const (
+	tiffTagXResolution    = 282
+	tiffTagYResolution    = 283
+	tiffTagResolutionUnit = 296
+
+	tiffShort    = 3
+	tiffRational = 5
+
+	tiffUnitInch = 2
+	tiffUnitCM   = 3
+
+	// jpegAPP0 holds the JFIF header and its pixel density
+	jpegAPP0 = 0xe0
+)
+
+var jfifHeader = []byte("JFIF\x00")
+
+// resolution is the pixel density of an image in dots per inch, zero when
+// unknown
+type resolution struct {
+	x, y float64
+}
+
+func (r resolution) valid() bool {
+	return r.x > 0 && r.y > 0
+}
+
+// jfifResolution reads the density of a JFIF APP0 payload, following its
+// header. Densities without a unit only give the pixel aspect ratio.
+func jfifResolution(jfif []byte) resolution {
+	if len(jfif) < 7 {
+		return resolution{}
+	}
+	x, y := float64(binary.BigEndian.Uint16(jfif[3:])), float64(binary.BigEndian.Uint16(jfif[5:]))
+	switch jfif[2] {
+	case 1:
+		return resolution{x, y}
+	case 2:
+		return resolution{x * 2.54, y * 2.54}
+	}
+	return resolution{}
+}
+
+// jfifSegment is a JFIF APP0 payload with the density r
+func jfifSegment(r resolution) []byte {
+	density := func(v float64) uint16 { return uint16(min(max(math.Round(v), 1), math.MaxUint16)) }
+	seg := append(bytes.Clone(jfifHeader), 1, 2, 1)
+	seg = binary.BigEndian.AppendUint16(seg, density(r.x))
+	seg = binary.BigEndian.AppendUint16(seg, density(r.y))
+	// No thumbnail
+	return append(seg, 0, 0)
+}
+
+// pngResolution reads the pHYs chunk of a PNG file
+func pngResolution(data []byte) resolution {
+	phys := pngChunk(data, "pHYs", nil)
+	// Unit 1 is the meter; without it the density is only an aspect ratio
+	if len(phys) < 9 || phys[8] != 1 {
+		return resolution{}
+	}
+	return resolution{
+		float64(binary.BigEndian.Uint32(phys)) * 0.0254,
+		float64(binary.BigEndian.Uint32(phys[4:])) * 0.0254,
+	}
+}
+
+// pngPhys is a pHYs chunk with the density r
+func pngPhys(r resolution) []byte {
+	phys := binary.BigEndian.AppendUint32(nil, uint32(math.Round(r.x/0.0254)))
+	phys = binary.BigEndian.AppendUint32(phys, uint32(math.Round(r.y/0.0254)))
+	return append(phys, 1)
+}
+
+// tiffResolution reads the resolution of the first IFD of data, a TIFF file
+// or an EXIF block
+func tiffResolution(data []byte) resolution {
+	order, ifd, ok := tiffHeader(data)
+	if !ok {
+		return resolution{}
+	}
+	entries, ok := tiffEntries(data, order, ifd)
+	if !ok {
+		return resolution{}
+	}
+	var r resolution
+	scale := 1.0
+	for e := range slices.Chunk(entries, 12) {
+		switch order.Uint16(e) {
+		case tiffTagXResolution:
+			r.x = tiffRationalAt(data, order, e)
+		case tiffTagYResolution:
+			r.y = tiffRationalAt(data, order, e)
+		case tiffTagResolutionUnit:
+			switch order.Uint16(e[8:]) {
+			case tiffUnitInch:
+			case tiffUnitCM:
+				scale = 2.54
+			default:
+				return resolution{}
+			}
+		}
+	}
+	return resolution{r.x * scale, r.y * scale}
+}
+
+// tiffRationalAt reads the value of a RATIONAL entry, or 0
+func tiffRationalAt(data []byte, order byteOrder, e []byte) float64 {
+	at := int(order.Uint32(e[8:]))
+	if order.Uint16(e[2:]) != tiffRational || at < 0 || at+8 > len(data) {
+		return 0
+	}
+	den := order.Uint32(data[at+4:])
+	if den == 0 {
+		return 0
+	}
+	return float64(order.Uint32(data[at:])) / float64(den)
+}
+
+// tiffRationalValue is a RATIONAL value approximating v
+func tiffRationalValue(order byteOrder, v float64) []byte {
+	return order.AppendUint32(order.AppendUint32(nil, uint32(math.Round(v*1000))), 1000)
+}
+
+// setEXIFResolution returns a copy of exif with the resolution it declares
+// changed to r. Fields it lacks are not added.
+func setEXIFResolution(exif []byte, r resolution) []byte {
+	order, ifd, ok := tiffHeader(exif)
+	if !ok {
+		return exif
+	}
+	entries, ok := tiffEntries(exif, order, ifd)
+	if !ok {
+		return exif
+	}
+	exif = bytes.Clone(exif)
+	for i := 0; i+12 <= len(entries); i += 12 {
+		e := exif[ifd+2+i:][:12]
+		at := int(order.Uint32(e[8:]))
+		switch tag, typ := order.Uint16(e), order.Uint16(e[2:]); {
+		case tag == tiffTagXResolution && typ == tiffRational && at >= 0 && at+8 <= len(exif):
+			copy(exif[at:], tiffRationalValue(order, r.x))
+		case tag == tiffTagYResolution && typ == tiffRational && at >= 0 && at+8 <= len(exif):
+			copy(exif[at:], tiffRationalValue(order, r.y))
+		case tag == tiffTagResolutionUnit && typ == tiffShort:
+			order.PutUint16(e[8:], tiffUnitInch)
+		}
+	}
+	return exif
+}
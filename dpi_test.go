@@ -0,0 +1,147 @@
+package rmbg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"testing"
+)
+
+// closeTo reports whether r is within 0.05 dpi of x by y
+func closeTo(r resolution, x, y float64) bool {
+	return math.Abs(r.x-x) < 0.05 && math.Abs(r.y-y) < 0.05
+}
+
+func TestResolution(t *testing.T) {
+	dpi := resolution{300, 150}
+	encoders := map[string]func(*bytes.Buffer) ([]byte, error){
+		"JPEG": func(buf *bytes.Buffer) ([]byte, error) {
+			err := jpeg.Encode(buf, gradientImage(8, 8), nil)
+			return writeJPEGMetadata(buf.Bytes(), metadata{dpi: dpi}), err
+		},
+		"PNG": func(buf *bytes.Buffer) ([]byte, error) {
+			err := png.Encode(buf, gradientImage(8, 8))
+			return writePNGMetadata(buf.Bytes(), metadata{dpi: dpi}), err
+		},
+		"TIFF": func(buf *bytes.Buffer) ([]byte, error) {
+			err := EncodeTIFF(buf, gradientImage(8, 8), nil)
+			return writeTIFFMetadata(buf.Bytes(), metadata{dpi: dpi}), err
+		},
+	}
+	for name, encode := range encoders {
+		t.Run(name, func(t *testing.T) {
+			data, err := encode(&bytes.Buffer{})
+			if err != nil {
+				t.Fatalf("failed to encode: %v", err)
+			}
+			if _, err := DecodeImage(bytes.NewReader(data), nil); err != nil {
+				t.Fatalf("failed to decode: %v", err)
+			}
+			if got := readMetadata(data).dpi; !closeTo(got, 300, 150) {
+				t.Errorf("expected 300x150 dpi, got %v", got)
+			}
+		})
+	}
+
+	t.Run("TIFFDefault", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := EncodeTIFF(&buf, gradientImage(8, 8), nil); err != nil {
+			t.Fatalf("failed to encode: %v", err)
+		}
+		if got := readMetadata(buf.Bytes()).dpi; !closeTo(got, 72, 72) {
+			t.Errorf("expected 72 dpi, got %v", got)
+		}
+	})
+
+	t.Run("JFIFUnits", func(t *testing.T) {
+		for unit, want := range map[byte]float64{0: 0, 1: 118, 2: 299.72} {
+			jfif := []byte{1, 2, unit, 0, 118, 0, 118}
+			if got := jfifResolution(jfif); !closeTo(got, want, want) {
+				t.Errorf("expected %v dpi for unit %d, got %v", want, unit, got)
+			}
+		}
+	})
+
+	t.Run("None", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, gradientImage(8, 8)); err != nil {
+			t.Fatalf("failed to encode: %v", err)
+		}
+		if got := readMetadata(buf.Bytes()).dpi; got.valid() {
+			t.Errorf("expected no resolution, got %v", got)
+		}
+	})
+}
+
+func TestSetEXIFResolution(t *testing.T) {
+	// IFD0 with XResolution, YResolution and ResolutionUnit in centimeters,
+	// the rationals following the IFD
+	order := binary.LittleEndian
+	exif := order.AppendUint32([]byte("II*\x00"), 8)
+	exif = order.AppendUint16(exif, 3)
+	values := uint32(8 + 2 + 3*12 + 4)
+	for i, tag := range []uint16{tiffTagXResolution, tiffTagYResolution} {
+		exif = order.AppendUint16(exif, tag)
+		exif = order.AppendUint16(exif, tiffRational)
+		exif = order.AppendUint32(exif, 1)
+		exif = order.AppendUint32(exif, values+uint32(i*8))
+	}
+	exif = order.AppendUint16(exif, tiffTagResolutionUnit)
+	exif = order.AppendUint16(exif, tiffShort)
+	exif = order.AppendUint32(exif, 1)
+	exif = order.AppendUint32(exif, tiffUnitCM)
+	exif = order.AppendUint32(exif, 0)
+	for range 2 {
+		exif = order.AppendUint32(order.AppendUint32(exif, 28), 1)
+	}
+
+	if got := tiffResolution(exif); !closeTo(got, 71.12, 71.12) {
+		t.Fatalf("expected 71.12 dpi, got %v", got)
+	}
+	got := setEXIFResolution(exif, resolution{600, 600})
+	if r := tiffResolution(got); !closeTo(r, 600, 600) {
+		t.Errorf("expected 600 dpi, got %v", r)
+	}
+	if r := tiffResolution(exif); !closeTo(r, 71.12, 71.12) {
+		t.Errorf("expected the input to be left alone, got %v", r)
+	}
+}
+
+func TestOutputDPI(t *testing.T) {
+	src := solidImage(20, 10, color.NRGBA{R: 255, A: 255})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	input := writePNGMetadata(buf.Bytes(), metadata{dpi: resolution{300, 300}})
+	r := cachedEngine(src)
+
+	for name, tt := range map[string]struct {
+		opts   *IOOptions
+		format Format
+		want   float64
+	}{
+		"Kept":            {nil, FormatJPEG, 300},
+		"Target":          {&IOOptions{DPI: 600}, FormatPNG, 600},
+		"TIFF":            {&IOOptions{DPI: 600}, FormatTIFF, 600},
+		"Stripped":        {&IOOptions{StripMetadata: true}, FormatPNG, 0},
+		"StrippedWithDPI": {&IOOptions{StripMetadata: true, DPI: 96}, FormatJPEG, 96},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := r.RemoveBackgroundFrom(bytes.NewReader(input), &out, tt.format, tt.opts); err != nil {
+				t.Fatalf("RemoveBackgroundFrom failed: %v", err)
+			}
+			if _, _, err := image.Decode(bytes.NewReader(out.Bytes())); err != nil {
+				t.Fatalf("failed to decode output: %v", err)
+			}
+			if got := readMetadata(out.Bytes()).dpi; !closeTo(got, tt.want, tt.want) {
+				t.Errorf("expected %v dpi, got %v", tt.want, got)
+			}
+		})
+	}
+}
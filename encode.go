@@ -0,0 +1,422 @@
+package rmbg
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultJPEGQuality is the JPEG quality used when IOOptions sets none
+const DefaultJPEGQuality = 90
+
+// Format is the encoding of an output image
+type Format int
+
+const (
+	// FormatPNG keeps the removed background transparent
+	FormatPNG Format = iota
+	// FormatJPEG composites the object over a background color
+	FormatJPEG
+	// FormatWebP keeps the removed background transparent, in a smaller file
+	// than PNG
+	FormatWebP
+	// FormatAVIF keeps the removed background transparent. It has no built-in
+	// encoder: see RegisterEncoder and the avifenc package.
+	FormatAVIF
+	// FormatTIFF keeps the removed background transparent, optionally with 16
+	// bits per channel, for print workflows
+	FormatTIFF
+	// FormatPSD is a Photoshop document keeping the original, the cut-out and
+	// the mask apart for further editing; see EncodePSD
+	FormatPSD
+	// FormatORA is the OpenRaster equivalent of FormatPSD, for Krita and GIMP;
+	// see EncodeOpenRaster
+	FormatORA
+	// FormatSVG embeds the object, cropped, in an SVG clipped by its vector
+	// outline; see EncodeSVG
+	FormatSVG
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatPNG:
+		return "png"
+	case FormatJPEG:
+		return "jpeg"
+	case FormatWebP:
+		return "webp"
+	case FormatAVIF:
+		return "avif"
+	case FormatTIFF:
+		return "tiff"
+	case FormatPSD:
+		return "psd"
+	case FormatORA:
+		return "ora"
+	case FormatSVG:
+		return "svg"
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// MediaType returns the MIME type of the format
+func (f Format) MediaType() string {
+	switch f {
+	case FormatPSD:
+		return "image/vnd.adobe.photoshop"
+	case FormatORA:
+		return "image/openraster"
+	case FormatSVG:
+		return "image/svg+xml"
+	}
+	return "image/" + f.String()
+}
+
+// FormatFromPath returns the format matching the extension of path: .png,
+// .jpg and .jpeg, .webp, .avif, .tif and .tiff, .psd, .ora or .svg
+func FormatFromPath(path string) (Format, error) {
+	ext := strings.TrimPrefix(filepath.Ext(path), ".")
+	if ext == "" {
+		return 0, fmt.Errorf("cannot infer image format of %s: no extension", path)
+	}
+	return ParseFormat(ext)
+}
+
+// ParseFormat returns the format named by s: "png", "jpg", "jpeg", "webp",
+// "avif", "tif", "tiff", "psd", "ora" or "svg", in any case
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "png":
+		return FormatPNG, nil
+	case "jpg", "jpeg":
+		return FormatJPEG, nil
+	case "webp":
+		return FormatWebP, nil
+	case "avif":
+		return FormatAVIF, nil
+	case "tif", "tiff":
+		return FormatTIFF, nil
+	case "psd":
+		return FormatPSD, nil
+	case "ora":
+		return FormatORA, nil
+	case "svg":
+		return FormatSVG, nil
+	}
+	return 0, fmt.Errorf("unsupported image format %q", s)
+}
+
+// ParseColor parses a background color: transparent (or none, or empty),
+// white, black or #rrggbb. Transparent yields nil.
+func ParseColor(s string) (color.Color, error) {
+	switch strings.ToLower(s) {
+	case "", "transparent", "none":
+		return nil, nil
+	case "white":
+		return color.White, nil
+	case "black":
+		return color.Black, nil
+	}
+	hex := strings.TrimPrefix(s, "#")
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 6 || err != nil {
+		return nil, fmt.Errorf("invalid color %q: expected transparent, white, black or #rrggbb", s)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 255}, nil
+}
+
+// IOOptions configures RemoveBackgroundFrom
+type IOOptions struct {
+	// Decode bounds the decoding of the input (default: DecodeImage defaults)
+	Decode *DecodeOptions
+	// Crop additionally smart crops the output when set; its Background
+	// defaults to the output background. Layered and SVG formats cannot be
+	// cropped.
+	Crop *CropConfig
+	// Background is composited behind the object (default: transparent for
+	// PNG, WebP, AVIF and TIFF, white for JPEG)
+	Background color.Color
+	// JPEGQuality is the JPEG quality from 1 to 100 (default: DefaultJPEGQuality)
+	JPEGQuality int
+	// WebPQuality is the lossy WebP quality from 1 to 100 (default:
+	// DefaultWebPQuality)
+	WebPQuality int
+	// WebPLossless encodes WebP output losslessly, ignoring WebPQuality
+	WebPLossless bool
+	// AVIFQuality is the AVIF quality from 1 to 100 (default: the encoder's)
+	AVIFQuality int
+	// TIFF16 writes TIFF output with 16 bits per channel even from 8-bit
+	// inputs; 16-bit inputs keep 16 bits in PNG and TIFF output regardless
+	TIFF16 bool
+	// StripMetadata drops the EXIF block, XMP packet, ICC profile and
+	// resolution that ProcessFile and RemoveBackgroundFrom otherwise copy from
+	// the input
+	StripMetadata bool
+	// DPI sets the resolution of JPEG, PNG and TIFF outputs in dots per inch,
+	// and of the copied EXIF block (default: the input's)
+	DPI float64
+	// ConvertColor runs the model on the input converted to sRGB when its ICC
+	// profile describes another RGB space, such as Display P3 or Adobe RGB,
+	// so wide-gamut colors do not skew the mask. The output stays in the
+	// input's color space, with Background converted into it, and keeps the
+	// profile unless StripMetadata is set.
+	ConvertColor bool
+	// Sidecar makes ProcessFile, ProcessObject and ProcessDir write a JSON
+	// Sidecar next to each output, named after it with .json appended
+	Sidecar bool
+	// Reflection adds a mirrored, fading reflection of the object below it,
+	// after the crop and before the background; the output has 8 bits per
+	// channel. Layered and SVG formats cannot have one.
+	Reflection *ReflectionOptions
+	// Despill removes the green or blue cast a screen leaves on the edges of
+	// the object before it is composited; the output has 8 bits per channel.
+	// Layered and SVG formats cannot be despilled.
+	Despill *DespillOptions
+	// Backdrop replaces Background with a generated image, such as a
+	// gradient, rendered at the size of the output after the crop and
+	// reflection; the output has 8 bits per channel. Layered and SVG formats
+	// cannot have one.
+	Backdrop Backdrop
+}
+
+// RemoveBackgroundFrom decodes an image from rd, removes its background and
+// writes the result to w in the given format. Unless opts.StripMetadata is
+// set, the ICC profile of JPEG, PNG, WebP and TIFF inputs is copied to JPEG,
+// PNG, WebP and TIFF outputs, and so are the EXIF block and XMP packet of
+// JPEG, PNG and WebP inputs except to TIFF. The image is turned upright as
+// for DecodeImage, and the copied orientation reset to match. PSD, OpenRaster
+// and SVG outputs ignore Background and carry no metadata.
+func (r *RemBG) RemoveBackgroundFrom(rd io.Reader, w io.Writer, format Format, opts *IOOptions) error {
+	if opts == nil {
+		opts = &IOOptions{}
+	}
+	if opts.Crop != nil {
+		if err := opts.Crop.Validate(); err != nil {
+			return err
+		}
+	}
+
+	img, md, err := decodeImage(rd, opts.Decode)
+	if err != nil {
+		return r.countError(ErrorKindDecode, err)
+	}
+	var out bytes.Buffer
+	if _, err := r.render(&out, img, md, format, opts); err != nil {
+		return err
+	}
+	_, err = w.Write(withMetadata(out.Bytes(), md, format, opts))
+	return err
+}
+
+// render processes img, whose input had metadata md, and writes the output
+// described by opts to w. It returns the sidecar of the image when
+// opts.Sidecar is set.
+func (r *RemBG) render(w io.Writer, img image.Image, md metadata, format Format, opts *IOOptions) (*Sidecar, error) {
+	start := time.Now()
+	if err := checkEncoder(format); err != nil {
+		return nil, err
+	}
+	if isLayered(format) || format == FormatSVG {
+		switch {
+		case opts.Crop != nil:
+			return nil, fmt.Errorf("%v output cannot be cropped", format)
+		case opts.Reflection != nil:
+			return nil, fmt.Errorf("%v output cannot have a reflection", format)
+		case opts.Despill != nil:
+			return nil, fmt.Errorf("%v output cannot be despilled", format)
+		case opts.Backdrop != nil:
+			return nil, fmt.Errorf("%v output cannot have a backdrop", format)
+		}
+	}
+	img, ds := r.limitOutput(img)
+	infer := img
+	if opts.ConvertColor {
+		if p, ok := parseICC(iccProfile(md.icc)); ok && !p.isSRGB() {
+			infer = p.toSRGB(img)
+			opts = p.outputOptions(opts)
+		}
+	}
+	res, pred, err := r.processAs(img, infer)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Release()
+	if ds != nil {
+		res.Downscale = ds
+	}
+
+	if err := encodeResult(w, img, res, pred, format, opts); err != nil {
+		return nil, err
+	}
+	if !opts.Sidecar {
+		return nil, nil
+	}
+	sc := newSidecar(img, res, pred)
+	sc.Timing.Total = milliseconds(time.Since(start))
+	return sc, nil
+}
+
+// encodeResult writes the output of res, computed by pred for img, to w
+func encodeResult(w io.Writer, img image.Image, res *Result, pred *prediction, format Format, opts *IOOptions) error {
+	img = res.sourceOf(img)
+	switch {
+	case isLayered(format):
+		return encodeLayered(w, img, res.Mask, format)
+	case format == FormatSVG:
+		return EncodeSVG(w, img, res.Mask, nil)
+	}
+	out, err := renderOutput(img, res, pred.mask, format, opts)
+	if err != nil {
+		return err
+	}
+	return encodeImage(w, out, format, opts)
+}
+
+// renderOutput composites img over the background of opts, or keeps it
+// transparent, and applies the despill, crop, reflection and backdrop of opts.
+// mask is the model mask, used for the crop bounds.
+func renderOutput(img image.Image, res *Result, mask *image.Gray, format Format, opts *IOOptions) (image.Image, error) {
+	img = res.sourceOf(img)
+	bg := opts.Background
+	if bg == nil && format == FormatJPEG {
+		bg = color.White
+	}
+	// A reflection or backdrop is drawn on the cut-out, before the background
+	fill := bg
+	if opts.Reflection != nil || opts.Backdrop != nil {
+		fill = nil
+	}
+	if opts.Despill != nil {
+		img = Despill(img, res.Mask, opts.Despill)
+	}
+
+	var out image.Image
+	deep := isDeep(img) && opts.Reflection == nil && opts.Backdrop == nil
+	switch {
+	case fill == nil && deep:
+		out = cutout16(img, res.Mask)
+	case fill == nil:
+		out = cutout(img, res.Mask)
+	case isWhite(fill) && opts.Despill == nil:
+		// Process already composited over white
+		out = res.Image
+	case deep:
+		out = composite16(img, res.Mask, fill)
+	default:
+		out = composite(img, res.Mask, fill)
+	}
+
+	if opts.Crop != nil {
+		config := *opts.Crop
+		if config.Background == nil {
+			config.Background = fill
+		}
+		b, _, _, err := fallbackBounds(img, mask, &config)
+		if err != nil {
+			return nil, err
+		}
+		out = applyCrop(out, b.Crop, &config)
+	}
+	if opts.Reflection != nil {
+		out = Reflect(out, opts.Reflection)
+		if bg != nil && opts.Backdrop == nil {
+			out = flatten(out, bg)
+		}
+	}
+	if opts.Backdrop != nil {
+		b := out.Bounds()
+		out = flattenOver(out, opts.Backdrop.Render(b.Dx(), b.Dy()))
+	}
+	return out, nil
+}
+
+// cutout returns img with mask as its alpha channel, in img's coordinates
+func cutout(img image.Image, mask *image.Gray) *image.NRGBA {
+	b := img.Bounds()
+	dst := toNRGBA(img)
+	mb := mask.Bounds()
+	for y := range b.Dy() {
+		row := dst.Pix[y*dst.Stride:][:b.Dx()*4]
+		m := mask.Pix[mask.PixOffset(mb.Min.X, mb.Min.Y+y):][:b.Dx()]
+		for x, a := range m {
+			row[x*4+3] = uint8(uint16(row[x*4+3]) * uint16(a) / 255)
+		}
+	}
+	return dst
+}
+
+// composite draws img over a solid bg using mask as alpha, in img's coordinates
+func composite(img image.Image, mask *image.Gray, bg color.Color) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(b)
+	draw.Draw(dst, b, image.NewUniform(bg), image.Point{}, draw.Src)
+	// Gray has no alpha channel, so view its pixels as one
+	alpha := &image.Alpha{Pix: mask.Pix, Stride: mask.Stride, Rect: mask.Rect}
+	draw.DrawMask(dst, b, img, b.Min, alpha, mask.Rect.Min, draw.Over)
+	return dst
+}
+
+// cutout16 is cutout keeping 16 bits per channel
+func cutout16(img image.Image, mask *image.Gray) *image.NRGBA64 {
+	b := img.Bounds()
+	dst := image.NewNRGBA64(b)
+	draw.Draw(dst, b, img, b.Min, draw.Src)
+	mb := mask.Bounds()
+	for y := range b.Dy() {
+		row := dst.Pix[y*dst.Stride:][:b.Dx()*8]
+		m := mask.Pix[mask.PixOffset(mb.Min.X, mb.Min.Y+y):][:b.Dx()]
+		for x, a := range m {
+			i := x*8 + 6
+			v := (uint32(row[i])<<8 | uint32(row[i+1])) * uint32(a) / 255
+			row[i], row[i+1] = uint8(v>>8), uint8(v)
+		}
+	}
+	return dst
+}
+
+// composite16 is composite keeping 16 bits per channel
+func composite16(img image.Image, mask *image.Gray, bg color.Color) *image.RGBA64 {
+	b := img.Bounds()
+	dst := image.NewRGBA64(b)
+	draw.Draw(dst, b, image.NewUniform(bg), image.Point{}, draw.Src)
+	alpha := &image.Alpha{Pix: mask.Pix, Stride: mask.Stride, Rect: mask.Rect}
+	draw.DrawMask(dst, b, img, b.Min, alpha, mask.Rect.Min, draw.Over)
+	return dst
+}
+
+func isWhite(c color.Color) bool {
+	r, g, b, a := c.RGBA()
+	return r == 0xffff && g == 0xffff && b == 0xffff && a == 0xffff
+}
+
+// encodeImage writes img to w in the given format, with the quality settings
+// of opts. Registered encoders take precedence over the built-in ones.
+func encodeImage(w io.Writer, img image.Image, format Format, opts *IOOptions) error {
+	if enc := registeredEncoder(format); enc != nil {
+		return enc.Encode(w, img, opts)
+	}
+	switch format {
+	case FormatPNG:
+		return png.Encode(w, img)
+	case FormatJPEG:
+		quality := opts.JPEGQuality
+		if quality <= 0 {
+			quality = DefaultJPEGQuality
+		}
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: min(quality, 100)})
+	case FormatWebP:
+		return EncodeWebP(w, img, &WebPOptions{Lossless: opts.WebPLossless, Quality: opts.WebPQuality})
+	case FormatTIFF:
+		return EncodeTIFF(w, img, &TIFFOptions{Depth16: opts.TIFF16})
+	}
+	return fmt.Errorf("%v output: %w", format, ErrNoEncoder)
+}
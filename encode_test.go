@@ -0,0 +1,274 @@
+package rmbg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestParseFormat(t *testing.T) {
+	for _, s := range []string{"png", "PNG"} {
+		if f, err := ParseFormat(s); err != nil || f != FormatPNG {
+			t.Errorf("expected png for %q, got %v (%v)", s, f, err)
+		}
+	}
+	for _, s := range []string{"jpg", "jpeg", "JPG"} {
+		if f, err := ParseFormat(s); err != nil || f != FormatJPEG {
+			t.Errorf("expected jpeg for %q, got %v (%v)", s, f, err)
+		}
+	}
+	for _, s := range []string{"webp", "WEBP"} {
+		if f, err := ParseFormat(s); err != nil || f != FormatWebP {
+			t.Errorf("expected webp for %q, got %v (%v)", s, f, err)
+		}
+	}
+	if f, err := ParseFormat("AVIF"); err != nil || f != FormatAVIF {
+		t.Errorf("expected avif, got %v (%v)", f, err)
+	}
+	for _, s := range []string{"tif", "tiff", "TIF"} {
+		if f, err := ParseFormat(s); err != nil || f != FormatTIFF {
+			t.Errorf("expected tiff for %q, got %v (%v)", s, f, err)
+		}
+	}
+	if f, err := ParseFormat("PSD"); err != nil || f != FormatPSD {
+		t.Errorf("expected psd, got %v (%v)", f, err)
+	}
+	if f, err := ParseFormat("ora"); err != nil || f != FormatORA {
+		t.Errorf("expected ora, got %v (%v)", f, err)
+	}
+	if f, err := ParseFormat("svg"); err != nil || f != FormatSVG {
+		t.Errorf("expected svg, got %v (%v)", f, err)
+	}
+	if _, err := ParseFormat("gif"); err == nil {
+		t.Errorf("expected error for gif")
+	}
+}
+
+func TestFormatMediaType(t *testing.T) {
+	tests := map[Format]string{FormatPNG: "image/png", FormatJPEG: "image/jpeg", FormatPSD: "image/vnd.adobe.photoshop", FormatORA: "image/openraster", FormatSVG: "image/svg+xml"}
+	for f, want := range tests {
+		if got := f.MediaType(); got != want {
+			t.Errorf("expected %s for %v, got %s", want, f, got)
+		}
+	}
+}
+
+func TestRemoveBackgroundFrom(t *testing.T) {
+	src := solidImage(20, 10, color.NRGBA{R: 255, A: 255})
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, src); err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	r := cachedEngine(src)
+
+	t.Run("PNG", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := r.RemoveBackgroundFrom(bytes.NewReader(encoded.Bytes()), &out, FormatPNG, nil); err != nil {
+			t.Fatalf("RemoveBackgroundFrom failed: %v", err)
+		}
+		img, err := png.Decode(&out)
+		if err != nil {
+			t.Fatalf("expected PNG output, got %v", err)
+		}
+		if got := img.Bounds().Size(); got != image.Pt(20, 10) {
+			t.Errorf("expected 20x10, got %v", got)
+		}
+	})
+
+	t.Run("JPEG", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := r.RemoveBackgroundFrom(bytes.NewReader(encoded.Bytes()), &out, FormatJPEG, &IOOptions{JPEGQuality: 80}); err != nil {
+			t.Fatalf("RemoveBackgroundFrom failed: %v", err)
+		}
+		if _, err := jpeg.Decode(&out); err != nil {
+			t.Errorf("expected JPEG output, got %v", err)
+		}
+	})
+
+	t.Run("WebP", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := r.RemoveBackgroundFrom(bytes.NewReader(encoded.Bytes()), &out, FormatWebP, &IOOptions{WebPLossless: true}); err != nil {
+			t.Fatalf("RemoveBackgroundFrom failed: %v", err)
+		}
+		img, format, err := image.Decode(&out)
+		if err != nil || format != "webp" {
+			t.Fatalf("expected WebP output, got %s (%v)", format, err)
+		}
+		if got := img.Bounds().Size(); got != image.Pt(20, 10) {
+			t.Errorf("expected 20x10, got %v", got)
+		}
+	})
+
+	t.Run("TIFF", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := r.RemoveBackgroundFrom(bytes.NewReader(encoded.Bytes()), &out, FormatTIFF, &IOOptions{TIFF16: true}); err != nil {
+			t.Fatalf("RemoveBackgroundFrom failed: %v", err)
+		}
+		img, format, err := image.Decode(&out)
+		if err != nil || format != "tiff" {
+			t.Fatalf("expected TIFF output, got %s (%v)", format, err)
+		}
+		if _, ok := img.(*image.NRGBA64); !ok {
+			t.Errorf("expected *image.NRGBA64, got %T", img)
+		}
+	})
+
+	t.Run("Crop", func(t *testing.T) {
+		var out bytes.Buffer
+		opts := &IOOptions{Crop: &CropConfig{SquarePad: true}}
+		if err := r.RemoveBackgroundFrom(bytes.NewReader(encoded.Bytes()), &out, FormatPNG, opts); err != nil {
+			t.Fatalf("RemoveBackgroundFrom failed: %v", err)
+		}
+		img, err := png.Decode(&out)
+		if err != nil {
+			t.Fatalf("expected PNG output, got %v", err)
+		}
+		if size := img.Bounds().Size(); size.X != size.Y {
+			t.Errorf("expected square output, got %v", size)
+		}
+	})
+
+	t.Run("InvalidInput", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := r.RemoveBackgroundFrom(bytes.NewReader([]byte("nope")), &out, FormatPNG, nil); err == nil {
+			t.Errorf("expected decode error")
+		}
+		if out.Len() != 0 {
+			t.Errorf("expected nothing written on error, got %d bytes", out.Len())
+		}
+	})
+}
+
+func TestCutoutAndComposite(t *testing.T) {
+	img := solidImage(2, 1, color.NRGBA{R: 200, G: 100, A: 255})
+	mask := image.NewGray(image.Rect(0, 0, 2, 1))
+	mask.Pix[0], mask.Pix[1] = 255, 0
+
+	cut := cutout(img, mask)
+	if got := cut.NRGBAAt(0, 0); got != (color.NRGBA{R: 200, G: 100, A: 255}) {
+		t.Errorf("expected opaque object pixel, got %v", got)
+	}
+	if got := cut.NRGBAAt(1, 0).A; got != 0 {
+		t.Errorf("expected transparent background pixel, got alpha %d", got)
+	}
+
+	blue := color.RGBA{B: 255, A: 255}
+	comp := composite(img, mask, blue)
+	if got := comp.RGBAAt(1, 0); got != blue {
+		t.Errorf("expected background color, got %v", got)
+	}
+	if got := comp.RGBAAt(0, 0); got != (color.RGBA{R: 200, G: 100, A: 255}) {
+		t.Errorf("expected object color, got %v", got)
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	tests := map[string]color.Color{
+		"transparent": nil,
+		"white":       color.White,
+		"#ff8000":     color.RGBA{R: 255, G: 128, A: 255},
+	}
+	for s, want := range tests {
+		got, err := ParseColor(s)
+		if err != nil || got != want {
+			t.Errorf("expected %v for %q, got %v (%v)", want, s, got, err)
+		}
+	}
+	for _, s := range []string{"#fff", "blue", "#gggggg"} {
+		if _, err := ParseColor(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
+
+func TestDeepOutput(t *testing.T) {
+	// Colors 8 bits cannot represent, so any truncation shows
+	deep := color.NRGBA64{R: 0x1234, G: 0x5678, B: 0x9abc, A: 0xffff}
+	src := image.NewNRGBA64(image.Rect(0, 0, 20, 10))
+	for y := range 10 {
+		for x := range 20 {
+			src.SetNRGBA64(x, y, deep)
+		}
+	}
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, src); err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	input, err := DecodeImage(bytes.NewReader(encoded.Bytes()), nil)
+	if err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	r := cachedEngine(input)
+
+	render := func(t *testing.T, opts *IOOptions) image.Image {
+		t.Helper()
+		var out bytes.Buffer
+		if err := r.RemoveBackgroundFrom(bytes.NewReader(encoded.Bytes()), &out, FormatPNG, opts); err != nil {
+			t.Fatalf("RemoveBackgroundFrom failed: %v", err)
+		}
+		img, err := png.Decode(&out)
+		if err != nil {
+			t.Fatalf("expected PNG output, got %v", err)
+		}
+		return img
+	}
+	check := func(t *testing.T, img image.Image, x, y int) {
+		t.Helper()
+		if got := color.NRGBA64Model.Convert(img.At(x, y)); got != deep {
+			t.Errorf("expected %v at %d,%d, got %v", deep, x, y, got)
+		}
+	}
+
+	t.Run("Transparent", func(t *testing.T) {
+		img := render(t, nil)
+		if !isDeep(img) {
+			t.Fatalf("expected 16-bit PNG, got %T", img)
+		}
+		check(t, img, 5, 5)
+	})
+
+	t.Run("Background", func(t *testing.T) {
+		for _, bg := range []color.Color{color.White, color.Black} {
+			img := render(t, &IOOptions{Background: bg})
+			if !isDeep(img) {
+				t.Fatalf("expected 16-bit PNG, got %T", img)
+			}
+			check(t, img, 5, 5)
+		}
+	})
+
+	t.Run("Crop", func(t *testing.T) {
+		img := render(t, &IOOptions{Crop: &CropConfig{Margin: 5, SquarePad: true}})
+		if size := img.Bounds().Size(); size.X != size.Y {
+			t.Errorf("expected square output, got %v", size)
+		}
+		check(t, img, img.Bounds().Dx()/2, img.Bounds().Dy()/2)
+
+		img = render(t, &IOOptions{Crop: &CropConfig{TargetWidth: 40, TargetHeight: 40}})
+		if got := img.Bounds().Size(); got != image.Pt(40, 40) {
+			t.Errorf("expected 40x40, got %v", got)
+		}
+		check(t, img, 20, 20)
+	})
+
+	t.Run("EightBit", func(t *testing.T) {
+		// 8-bit inputs keep 8-bit output
+		src := solidImage(20, 10, color.NRGBA{R: 255, A: 255})
+		var encoded bytes.Buffer
+		if err := png.Encode(&encoded, src); err != nil {
+			t.Fatalf("failed to encode: %v", err)
+		}
+		var out bytes.Buffer
+		if err := cachedEngine(src).RemoveBackgroundFrom(&encoded, &out, FormatPNG, nil); err != nil {
+			t.Fatalf("RemoveBackgroundFrom failed: %v", err)
+		}
+		if img, err := png.Decode(&out); err != nil {
+			t.Fatalf("expected PNG output, got %v", err)
+		} else if isDeep(img) {
+			t.Errorf("expected 8-bit PNG, got %T", img)
+		}
+	})
+}
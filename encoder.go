@@ -0,0 +1,71 @@
+package rmbg
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"sync"
+)
+
+// ErrNoEncoder is returned when writing a format that has neither a built-in
+// nor a registered encoder
+var ErrNoEncoder = errors.New("no encoder registered")
+
+// Encoder writes images in one output format, for formats rmbg has no
+// built-in encoder for or to replace a built-in one
+type Encoder interface {
+	// Encode writes img to w; opts holds the quality settings of the output
+	// and is never nil
+	Encode(w io.Writer, img image.Image, opts *IOOptions) error
+}
+
+// EncoderFunc adapts a function to Encoder
+type EncoderFunc func(w io.Writer, img image.Image, opts *IOOptions) error
+
+// Encode implements Encoder
+func (f EncoderFunc) Encode(w io.Writer, img image.Image, opts *IOOptions) error {
+	return f(w, img, opts)
+}
+
+var encoders struct {
+	sync.RWMutex
+	m map[Format]Encoder
+}
+
+// RegisterEncoder makes enc the encoder of format for every engine, taking
+// precedence over the built-in encoder. A nil enc restores the default.
+func RegisterEncoder(format Format, enc Encoder) {
+	encoders.Lock()
+	defer encoders.Unlock()
+	if enc == nil {
+		delete(encoders.m, format)
+		return
+	}
+	if encoders.m == nil {
+		encoders.m = make(map[Format]Encoder)
+	}
+	encoders.m[format] = enc
+}
+
+func registeredEncoder(format Format) Encoder {
+	encoders.RLock()
+	defer encoders.RUnlock()
+	return encoders.m[format]
+}
+
+// checkEncoder fails early, before any inference, when format cannot be
+// written
+func checkEncoder(format Format) error {
+	switch format {
+	case FormatPNG, FormatJPEG, FormatWebP, FormatTIFF, FormatPSD, FormatORA, FormatSVG:
+		return nil
+	}
+	if registeredEncoder(format) != nil {
+		return nil
+	}
+	if format == FormatAVIF {
+		return fmt.Errorf("%v output: %w; import github.com/josuedeavila/rmbg/avifenc and build with -tags avif", format, ErrNoEncoder)
+	}
+	return fmt.Errorf("%v output: %w", format, ErrNoEncoder)
+}
@@ -0,0 +1,69 @@
+package rmbg
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"testing"
+)
+
+func TestRegisterEncoder(t *testing.T) {
+	src := solidImage(12, 8, color.NRGBA{B: 255, A: 255})
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, src); err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	r := cachedEngine(src)
+
+	t.Run("Unregistered", func(t *testing.T) {
+		var out bytes.Buffer
+		err := r.RemoveBackgroundFrom(bytes.NewReader(encoded.Bytes()), &out, FormatAVIF, nil)
+		if !errors.Is(err, ErrNoEncoder) {
+			t.Errorf("expected ErrNoEncoder, got %v", err)
+		}
+	})
+
+	t.Run("Registered", func(t *testing.T) {
+		var got *IOOptions
+		RegisterEncoder(FormatAVIF, EncoderFunc(func(w io.Writer, img image.Image, opts *IOOptions) error {
+			got = opts
+			if size := img.Bounds().Size(); size != image.Pt(12, 8) {
+				t.Errorf("expected 12x8 image, got %v", size)
+			}
+			_, err := w.Write([]byte("avif"))
+			return err
+		}))
+		defer RegisterEncoder(FormatAVIF, nil)
+
+		var out bytes.Buffer
+		opts := &IOOptions{AVIFQuality: 50}
+		if err := r.RemoveBackgroundFrom(bytes.NewReader(encoded.Bytes()), &out, FormatAVIF, opts); err != nil {
+			t.Fatalf("RemoveBackgroundFrom failed: %v", err)
+		}
+		if out.String() != "avif" {
+			t.Errorf("expected encoder output, got %q", out.String())
+		}
+		if got != opts {
+			t.Errorf("expected the encoder to receive the options")
+		}
+	})
+
+	t.Run("Override", func(t *testing.T) {
+		RegisterEncoder(FormatPNG, EncoderFunc(func(w io.Writer, img image.Image, opts *IOOptions) error {
+			_, err := w.Write([]byte("custom"))
+			return err
+		}))
+		defer RegisterEncoder(FormatPNG, nil)
+
+		var out bytes.Buffer
+		if err := r.RemoveBackgroundFrom(bytes.NewReader(encoded.Bytes()), &out, FormatPNG, nil); err != nil {
+			t.Fatalf("RemoveBackgroundFrom failed: %v", err)
+		}
+		if out.String() != "custom" {
+			t.Errorf("expected the registered encoder to replace PNG, got %q", out.String())
+		}
+	})
+}
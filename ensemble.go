@@ -0,0 +1,359 @@
+package rmbg
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/disintegration/imaging"
+)
+
+// Fusion selects how Config.Ensemble combines the probability maps of its
+// models
+type Fusion int
+
+const (
+	// FusionMean takes the weighted mean of the probabilities
+	FusionMean Fusion = iota
+	// FusionMax takes the highest probability, keeping every part any model
+	// found; weights are ignored
+	FusionMax
+	// FusionVote keeps the pixels that models holding more than half of the
+	// total weight see as foreground
+	FusionVote
+)
+
+func (f Fusion) String() string {
+	switch f {
+	case FusionMean:
+		return "mean"
+	case FusionMax:
+		return "max"
+	case FusionVote:
+		return "vote"
+	}
+	return fmt.Sprintf("Fusion(%d)", int(f))
+}
+
+// EnsembleMember is a further model of Config.Ensemble
+type EnsembleMember struct {
+	// ModelPath is the path to the ONNX model file
+	ModelPath string
+	// Model describes the model (default: ModelU2NetP)
+	Model *ModelSpec
+	// Weight is the share of the model in FusionMean and FusionVote, relative
+	// to the main model's 1 (default: 1)
+	Weight float64
+	// Backend runs the model instead of ONNX Runtime (default:
+	// Config.Backend)
+	Backend Backend
+}
+
+// ensembleMember is a loaded EnsembleMember
+type ensembleMember struct {
+	model  *model
+	weight float64
+}
+
+// newMainModel loads the default model of an engine together with the
+// members of config.Ensemble
+func newMainModel(config *Config, modelPath string, spec ModelSpec) (*model, error) {
+	m, err := newModel(config, modelPath, spec)
+	if err != nil {
+		return nil, err
+	}
+	if err := loadEnsemble(config, m); err != nil {
+		_ = m.close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// loadEnsemble loads the members of config.Ensemble into m, the main model
+func loadEnsemble(config *Config, m *model) error {
+	if len(config.Ensemble) == 0 {
+		return nil
+	}
+	switch config.Fusion {
+	case FusionMean, FusionMax, FusionVote:
+	default:
+		return fmt.Errorf("unknown fusion %v", config.Fusion)
+	}
+	for i, member := range config.Ensemble {
+		if member.Weight < 0 {
+			return fmt.Errorf("ensemble member %d: weight %g must not be negative", i, member.Weight)
+		}
+		spec := ModelU2NetP
+		if member.Model != nil {
+			spec = *member.Model
+		}
+		sub := *config
+		sub.Scales, sub.Ensemble = nil, nil
+		if member.Backend != nil {
+			sub.Backend = member.Backend
+		}
+		mm, err := newModel(&sub, member.ModelPath, spec)
+		if err != nil {
+			return fmt.Errorf("ensemble member %d: %w", i, err)
+		}
+		weight := member.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		m.members = append(m.members, ensembleMember{model: mm, weight: weight})
+	}
+	m.fusion = config.Fusion
+	return nil
+}
+
+// fusePlanes combines planes, aligned at the largest resolution, with the
+// given weights and fusion
+func fusePlanes(planes []probPlane, weights []float64, fusion Fusion) probPlane {
+	w, h := largestPlane(planes)
+	aligned := make([][]float32, len(planes))
+	for i, p := range planes {
+		aligned[i] = make([]float32, w*h)
+		resamplePlaneAdd(aligned[i], w, h, p.probs, p.w, p.h)
+	}
+	var total float64
+	for _, wt := range weights {
+		total += wt
+	}
+
+	out := make([]float32, w*h)
+	for j := range out {
+		switch fusion {
+		case FusionMax:
+			for _, a := range aligned {
+				out[j] = max(out[j], a[j])
+			}
+		case FusionVote:
+			var votes float64
+			for i, a := range aligned {
+				if a[j] >= 0.5 {
+					votes += weights[i]
+				}
+			}
+			if votes > total/2 {
+				out[j] = 1
+			}
+		default:
+			var sum float64
+			for i, a := range aligned {
+				sum += weights[i] * float64(a[j])
+			}
+			if total > 0 {
+				out[j] = float32(sum / total)
+			}
+		}
+	}
+	return probPlane{out, w, h}
+}
+
+// multiPass reports whether predictions run the model more than once per
+// image or tile: to refine it, at several scales, mirrored or as an ensemble
+func (r *RemBG) multiPass() bool {
+	return r.refine || len(r.config.Scales) > 0 || r.config.FlipTTA || len(r.config.Ensemble) > 0
+}
+
+// newScaleModels loads the model at modelPath once per size of
+// config.Scales other than the input size of spec
+func newScaleModels(config *Config, modelPath string, spec ModelSpec) ([]*model, error) {
+	sub := *config
+	sub.Scales = nil
+	var models []*model
+	for _, size := range config.Scales {
+		if size == spec.InputSize {
+			continue
+		}
+		scaled := spec
+		scaled.InputSize = size
+		m, err := newModel(&sub, modelPath, scaled)
+		if err != nil {
+			for _, m := range models {
+				_ = m.close()
+			}
+			return nil, fmt.Errorf("scale %d: %w", size, err)
+		}
+		models = append(models, m)
+	}
+	return models, nil
+}
+
+// validateScales checks the input sizes of Config.Scales
+func validateScales(scales []int) error {
+	for _, size := range scales {
+		if size <= 0 {
+			return fmt.Errorf("scale %d must be positive", size)
+		}
+	}
+	return nil
+}
+
+// probPlane is a w x h map of foreground probabilities
+type probPlane struct {
+	probs []float32
+	w, h  int
+}
+
+// predictEnsemble runs every pass of m and of its ensemble members on img:
+// each scale model, on img and on its mirror image when m.flip is set. The
+// probability maps of a model are averaged, then fused across members with
+// m.fusion, aligned at the largest resolution, before the mask is
+// thresholded.
+func (m *model) predictEnsemble(img image.Image) (*prediction, error) {
+	inputs := []image.Image{img}
+	if m.flip {
+		inputs = append(inputs, imaging.FlipH(img))
+	}
+	members := append([]ensembleMember{{model: m, weight: 1}}, m.members...)
+	planes := make([]probPlane, len(members))
+	var timing stageTimes
+	for i, member := range members {
+		p, t, err := member.model.averagePasses(inputs)
+		if err != nil {
+			return nil, err
+		}
+		planes[i] = p
+		timing = timing.add(t)
+	}
+
+	t0 := time.Now()
+	fused := planes[0]
+	if len(members) > 1 {
+		weights := make([]float64, len(members))
+		for i, member := range members {
+			weights[i] = member.weight
+		}
+		fused = fusePlanes(planes, weights, m.fusion)
+	}
+	fromProbabilities(fused.probs, m.spec.Output)
+
+	pred := maskFromPlane(fused.probs, fused.w, fused.h, m.spec.Output)
+	pred.model = m.spec.Name
+	timing.decode += time.Since(t0)
+	pred.timing = timing
+	return pred, nil
+}
+
+// averagePasses runs m and each of its scale models on inputs, an image and
+// optionally its mirror image, and returns the mean of their probability
+// maps at the largest resolution
+func (m *model) averagePasses(inputs []image.Image) (probPlane, stageTimes, error) {
+	var planes []probPlane
+	var timing stageTimes
+	for _, sm := range append([]*model{m}, m.scales...) {
+		for i, in := range inputs {
+			t0 := time.Now()
+			area := sm.inputArea(in.Bounds().Size())
+			input := sm.preprocess(in, area)
+
+			t1 := time.Now()
+			output, err := sm.infer(input)
+			if err != nil {
+				return probPlane{}, timing, err
+			}
+
+			t2 := time.Now()
+			probs := slices.Clone(sm.planeOf(*output, area))
+			sm.outputs.put(output)
+			toProbabilities(probs, sm.spec.Output)
+			if i > 0 {
+				flipPlane(probs, area.Dx())
+			}
+			planes = append(planes, probPlane{probs, area.Dx(), area.Dy()})
+			timing = timing.add(stageTimes{
+				preprocess: t1.Sub(t0),
+				inference:  t2.Sub(t1),
+				decode:     time.Since(t2),
+			})
+		}
+	}
+	if len(planes) == 1 {
+		return planes[0], timing, nil
+	}
+
+	t0 := time.Now()
+	w, h := largestPlane(planes)
+	avg := make([]float32, w*h)
+	for _, p := range planes {
+		resamplePlaneAdd(avg, w, h, p.probs, p.w, p.h)
+	}
+	for i := range avg {
+		avg[i] /= float32(len(planes))
+	}
+	timing.decode += time.Since(t0)
+	return probPlane{avg, w, h}, timing, nil
+}
+
+// largestPlane returns the size of the plane with the most values
+func largestPlane(planes []probPlane) (int, int) {
+	p := slices.MaxFunc(planes, func(a, b probPlane) int {
+		return a.w*a.h - b.w*b.h
+	})
+	return p.w, p.h
+}
+
+// flipPlane mirrors the rows of a plane w values wide in place
+func flipPlane(data []float32, w int) {
+	if w == 0 {
+		return
+	}
+	for row := data; len(row) >= w; row = row[w:] {
+		slices.Reverse(row[:w])
+	}
+}
+
+// toProbabilities turns model output values of kind into probabilities in
+// place
+func toProbabilities(data []float32, kind OutputKind) {
+	for i, v := range data {
+		if kind == OutputAlpha {
+			data[i] = max(0, min(1, v))
+		} else {
+			data[i] = sigmoid(v)
+		}
+	}
+}
+
+// fromProbabilities turns probabilities back into output values of kind in
+// place, so averaged maps are thresholded like a single output
+func fromProbabilities(data []float32, kind OutputKind) {
+	if kind == OutputAlpha {
+		return
+	}
+	for i, p := range data {
+		p = max(1e-6, min(1-1e-6, p))
+		data[i] = float32(math.Log(float64(p / (1 - p))))
+	}
+}
+
+// resamplePlaneAdd adds the sw x sh plane src, bilinearly resampled to w x h,
+// to dst
+func resamplePlaneAdd(dst []float32, w, h int, src []float32, sw, sh int) {
+	if sw == w && sh == h {
+		for i, v := range src {
+			dst[i] += v
+		}
+		return
+	}
+	xRatio := float64(sw) / float64(w)
+	yRatio := float64(sh) / float64(h)
+	for y := range h {
+		sy := max((float64(y)+0.5)*yRatio-0.5, 0)
+		y0 := min(int(sy), sh-1)
+		y1 := min(y0+1, sh-1)
+		fy := float32(sy - float64(y0))
+		for x := range w {
+			sx := max((float64(x)+0.5)*xRatio-0.5, 0)
+			x0 := min(int(sx), sw-1)
+			x1 := min(x0+1, sw-1)
+			fx := float32(sx - float64(x0))
+			top := src[y0*sw+x0]*(1-fx) + src[y0*sw+x1]*fx
+			bottom := src[y1*sw+x0]*(1-fx) + src[y1*sw+x1]*fx
+			dst[y*w+x] += top*(1-fy) + bottom*fy
+		}
+	}
+}
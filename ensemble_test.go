@@ -0,0 +1,205 @@
+package rmbg
+
+import (
+	"image/color"
+	"slices"
+	"sync/atomic"
+	"testing"
+)
+
+// scaleBackend outputs a confident foreground logit map at input sizes of at
+// least minSize and background below, recording the sizes it ran at
+type scaleBackend struct {
+	minSize int
+	calls   atomic.Int32
+}
+
+func (b *scaleBackend) Run(input, output []float32) error {
+	b.calls.Add(1)
+	v := float32(-10)
+	if len(output) >= b.minSize*b.minSize {
+		v = 10
+	}
+	for i := range output {
+		output[i] = v
+	}
+	return nil
+}
+
+func TestScales(t *testing.T) {
+	src := solidImage(60, 40, color.NRGBA{R: 90, G: 120, B: 30, A: 255})
+
+	t.Run("Aligned", func(t *testing.T) {
+		r, err := New(&Config{Backend: &squareBackend{}, Scales: []int{160, 240, 320}, Letterbox: true})
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		defer r.Close()
+		pred, err := r.predict(src)
+		if err != nil {
+			t.Fatalf("predict failed: %v", err)
+		}
+		if got := pred.mask.Bounds().Size(); got.X != 320 {
+			t.Errorf("expected the mask at the largest scale, got %v", got)
+		}
+		// The letterboxed square covers the middle at every scale
+		c := pred.mask.Bounds().Size().Div(2)
+		if got := pred.mask.GrayAt(c.X, c.Y).Y; got != 255 {
+			t.Errorf("expected the center in the foreground, got %d", got)
+		}
+	})
+
+	t.Run("Average", func(t *testing.T) {
+		backend := &scaleBackend{minSize: 300}
+		r, err := New(&Config{Backend: backend, Scales: []int{160, 240}, SoftMask: true})
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		defer r.Close()
+		pred, err := r.predict(src)
+		if err != nil {
+			t.Fatalf("predict failed: %v", err)
+		}
+		if n := backend.calls.Load(); n != 3 {
+			t.Errorf("expected 3 inferences, got %d", n)
+		}
+		// One scale in three sees the foreground
+		if got := pred.mask.GrayAt(10, 10).Y; got < 80 || got > 90 {
+			t.Errorf("expected a third of full opacity, got %d", got)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		if _, err := New(&Config{Backend: &squareBackend{}, Scales: []int{0}}); err == nil {
+			t.Errorf("expected error for a zero scale")
+		}
+	})
+}
+
+// halfBackend outputs a foreground logit map on the left half of the input
+// when the input's left half is brighter than its right half, and a
+// background one otherwise
+type halfBackend struct{}
+
+func (halfBackend) Run(input, output []float32) error {
+	size := 0
+	for size*size < len(output) {
+		size++
+	}
+	var left, right float32
+	for y := range size {
+		for x := range size {
+			if x < size/2 {
+				left += input[y*size+x]
+			} else {
+				right += input[y*size+x]
+			}
+		}
+	}
+	for y := range size {
+		for x := range size {
+			v := float32(-10)
+			if left > right && x < size/2 {
+				v = 10
+			}
+			output[y*size+x] = v
+		}
+	}
+	return nil
+}
+
+func TestFlipTTA(t *testing.T) {
+	// The left half is bright, so only the unflipped pass finds the subject
+	src := solidImage(40, 40, color.NRGBA{R: 20, G: 20, B: 20, A: 255})
+	for y := range 40 {
+		for x := range 20 {
+			src.SetNRGBA(x, y, color.NRGBA{R: 230, G: 230, B: 230, A: 255})
+		}
+	}
+	r, err := New(&Config{Backend: halfBackend{}, FlipTTA: true, SoftMask: true})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer r.Close()
+	pred, err := r.predict(src)
+	if err != nil {
+		t.Fatalf("predict failed: %v", err)
+	}
+	// Half the passes see the subject on the left, and both map it back there
+	if got := pred.mask.GrayAt(10, 160).Y; got < 120 || got > 135 {
+		t.Errorf("expected half opacity on the left, got %d", got)
+	}
+	if got := pred.mask.GrayAt(300, 160).Y; got > 5 {
+		t.Errorf("expected the right half in the background, got %d", got)
+	}
+}
+
+func TestFlipPlane(t *testing.T) {
+	data := []float32{1, 2, 3, 4, 5, 6}
+	flipPlane(data, 3)
+	if want := []float32{3, 2, 1, 6, 5, 4}; !slices.Equal(data, want) {
+		t.Errorf("expected %v, got %v", want, data)
+	}
+}
+
+// constBackend outputs the logit v everywhere
+type constBackend float32
+
+func (b constBackend) Run(input, output []float32) error {
+	for i := range output {
+		output[i] = float32(b)
+	}
+	return nil
+}
+
+func TestEnsemble(t *testing.T) {
+	src := solidImage(40, 40, color.NRGBA{R: 90, G: 120, B: 30, A: 255})
+	// The main model is sure of the foreground, both members of the
+	// background
+	members := []EnsembleMember{
+		{Backend: constBackend(-10), Weight: 1},
+		{Backend: constBackend(-10), Weight: 2},
+	}
+	center := func(t *testing.T, fusion Fusion, members []EnsembleMember) uint8 {
+		t.Helper()
+		r, err := New(&Config{Backend: constBackend(10), SoftMask: true, Ensemble: members, Fusion: fusion})
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		defer r.Close()
+		pred, err := r.predict(src)
+		if err != nil {
+			t.Fatalf("predict failed: %v", err)
+		}
+		return pred.mask.GrayAt(100, 100).Y
+	}
+
+	t.Run("Mean", func(t *testing.T) {
+		// A weight of 1 in 4 for the foreground
+		if got := center(t, FusionMean, members); got < 60 || got > 68 {
+			t.Errorf("expected a quarter of full opacity, got %d", got)
+		}
+	})
+	t.Run("Max", func(t *testing.T) {
+		if got := center(t, FusionMax, members); got < 250 {
+			t.Errorf("expected the foreground, got %d", got)
+		}
+	})
+	t.Run("Vote", func(t *testing.T) {
+		if got := center(t, FusionVote, members); got > 5 {
+			t.Errorf("expected the majority for the background, got %d", got)
+		}
+		outvoted := []EnsembleMember{{Backend: constBackend(-10), Weight: 0.5}}
+		if got := center(t, FusionVote, outvoted); got < 250 {
+			t.Errorf("expected the heavier main model to win, got %d", got)
+		}
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		if _, err := New(&Config{Backend: constBackend(0), Ensemble: members, Fusion: Fusion(7)}); err == nil {
+			t.Errorf("expected error for an unknown fusion")
+		}
+		if _, err := New(&Config{Backend: constBackend(0), Ensemble: []EnsembleMember{{Weight: -1}}}); err == nil {
+			t.Errorf("expected error for a negative weight")
+		}
+	})
+}
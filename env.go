@@ -0,0 +1,90 @@
+package rmbg
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// LibraryPathEnv is the environment variable read for the ONNX Runtime shared
+// library path when none is configured
+const LibraryPathEnv = "RMBG_ORT_LIB"
+
+// ErrAlreadyInitialized is returned by Initialize when the ONNX Runtime
+// environment is already set up, e.g. by an earlier New
+var ErrAlreadyInitialized = errors.New("ONNX Runtime environment already initialized")
+
+// InitOptions controls the initialization of the ONNX Runtime environment
+type InitOptions struct {
+	// LibraryPath is the path to the ONNX Runtime shared library (default: the
+	// RMBG_ORT_LIB environment variable, then onnxruntime.so, or onnxruntime.dll
+	// on Windows, found on the library search path)
+	LibraryPath string
+	// LogLevel is the minimum severity of ONNX Runtime's own log messages, which
+	// are written to stderr (default: slog.LevelWarn)
+	LogLevel slog.Level
+	// DisableTelemetry turns off ONNX Runtime telemetry on platforms that have it
+	DisableTelemetry bool
+}
+
+var (
+	envMu sync.Mutex
+	// envRefs counts the loaded models using the environment
+	envRefs int
+)
+
+// Initialize sets up the ONNX Runtime environment shared by all engines. New
+// calls it with default options on first use, so it only needs to be called
+// to control those options, before the first engine is created. A failed
+// initialization, e.g. a missing shared library, is reported as
+// ErrRuntimeUnavailable and may be retried.
+func Initialize(opts *InitOptions) error {
+	envMu.Lock()
+	defer envMu.Unlock()
+	if runtimeInitialized() {
+		return ErrAlreadyInitialized
+	}
+	return initializeEnv(opts)
+}
+
+// Shutdown destroys the ONNX Runtime environment and unloads its shared
+// library. Every engine must be closed first, otherwise ErrEnvironmentInUse is
+// returned and the environment is left untouched. The environment is
+// initialized again by the next New or Initialize.
+func Shutdown() error {
+	envMu.Lock()
+	defer envMu.Unlock()
+	if envRefs > 0 {
+		return fmt.Errorf("%w: %d models still loaded", ErrEnvironmentInUse, envRefs)
+	}
+	if !runtimeInitialized() {
+		return nil
+	}
+	return destroyEnv()
+}
+
+// acquireEnv takes a reference on the environment, initializing it with
+// default options and the given library path unless it is already
+// initialized, in which case the path is ignored. Every successful call must
+// be paired with releaseEnv.
+func acquireEnv(libraryPath string) error {
+	envMu.Lock()
+	defer envMu.Unlock()
+	if !runtimeInitialized() {
+		if err := initializeEnv(&InitOptions{LibraryPath: libraryPath, LogLevel: slog.LevelWarn}); err != nil {
+			return err
+		}
+	}
+	envRefs++
+	return nil
+}
+
+// releaseEnv drops a reference taken by acquireEnv. The environment stays
+// loaded until Shutdown, so engines can be created again without reloading
+// the library.
+func releaseEnv() {
+	envMu.Lock()
+	defer envMu.Unlock()
+	envRefs--
+}
@@ -0,0 +1,23 @@
+//go:build !cgo
+
+package rmbg
+
+import (
+	"errors"
+	"fmt"
+)
+
+// errNoCgo explains why ONNX Runtime is missing from builds without cgo
+var errNoCgo = errors.New("built without cgo; use Config.Backend")
+
+func runtimeInitialized() bool {
+	return false
+}
+
+func destroyEnv() error {
+	return nil
+}
+
+func initializeEnv(*InitOptions) error {
+	return fmt.Errorf("%w: %w", ErrRuntimeUnavailable, errNoCgo)
+}
@@ -0,0 +1,62 @@
+//go:build cgo
+
+package rmbg
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// runtimeInitialized reports whether the ONNX Runtime environment is set up
+func runtimeInitialized() bool {
+	return ort.IsInitialized()
+}
+
+// destroyEnv destroys the ONNX Runtime environment
+func destroyEnv() error {
+	return ort.DestroyEnvironment()
+}
+
+func initializeEnv(opts *InitOptions) error {
+	if opts == nil {
+		opts = &InitOptions{LogLevel: slog.LevelWarn}
+	}
+	path := opts.LibraryPath
+	if path == "" {
+		path = os.Getenv(LibraryPathEnv)
+	}
+	if path != "" {
+		ort.SetSharedLibraryPath(path)
+	}
+
+	if err := ort.InitializeEnvironment(ortLogLevel(opts.LogLevel)); err != nil {
+		if path != "" {
+			return fmt.Errorf("%w: loading %s: %w", ErrRuntimeUnavailable, path, err)
+		}
+		return fmt.Errorf("%w: %w", ErrRuntimeUnavailable, err)
+	}
+	if opts.DisableTelemetry {
+		if err := ort.DisableTelemetry(); err != nil {
+			_ = ort.DestroyEnvironment()
+			return fmt.Errorf("failed to disable telemetry: %w", err)
+		}
+	}
+	return nil
+}
+
+// ortLogLevel maps a slog level to the closest ONNX Runtime severity
+func ortLogLevel(level slog.Level) ort.EnvironmentOption {
+	switch {
+	case level < slog.LevelInfo:
+		return ort.WithLogLevelVerbose()
+	case level < slog.LevelWarn:
+		return ort.WithLogLevelInfo()
+	case level < slog.LevelError:
+		return ort.WithLogLevelWarning()
+	default:
+		return ort.WithLogLevelError()
+	}
+}
@@ -0,0 +1,106 @@
+//go:build cgo
+
+package rmbg
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+func TestInitialize(t *testing.T) {
+	if ort.IsInitialized() {
+		t.Skip("Skipping: ONNX Runtime environment already initialized")
+	}
+	t.Cleanup(func() {
+		if runtime.GOOS == "windows" {
+			ort.SetSharedLibraryPath("onnxruntime.dll")
+		} else {
+			ort.SetSharedLibraryPath("onnxruntime.so")
+		}
+	})
+
+	opts := &InitOptions{LibraryPath: filepath.Join(t.TempDir(), "missing.so")}
+	// A failed initialization must leave the environment retryable
+	for range 2 {
+		if err := Initialize(opts); !errors.Is(err, ErrRuntimeUnavailable) {
+			t.Fatalf("expected ErrRuntimeUnavailable, got %v", err)
+		}
+		if ort.IsInitialized() {
+			t.Fatalf("expected environment to stay uninitialized")
+		}
+	}
+
+	t.Run("EnvFallback", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "env.so")
+		t.Setenv(LibraryPathEnv, path)
+		err := Initialize(nil)
+		if !errors.Is(err, ErrRuntimeUnavailable) || !strings.Contains(err.Error(), path) {
+			t.Errorf("expected ErrRuntimeUnavailable loading %s, got %v", path, err)
+		}
+	})
+
+	t.Run("ConfigPath", func(t *testing.T) {
+		modelPath := filepath.Join(t.TempDir(), "model.onnx")
+		if err := os.WriteFile(modelPath, []byte("onnx"), 0o644); err != nil {
+			t.Fatalf("failed to write model: %v", err)
+		}
+		libPath := filepath.Join(t.TempDir(), "config.so")
+		t.Setenv(LibraryPathEnv, filepath.Join(t.TempDir(), "env.so"))
+
+		// The configured path takes precedence over the environment variable
+		_, err := New(&Config{ModelPath: modelPath, ORTLibraryPath: libPath})
+		if !errors.Is(err, ErrRuntimeUnavailable) || !strings.Contains(err.Error(), libPath) {
+			t.Errorf("expected ErrRuntimeUnavailable loading %s, got %v", libPath, err)
+		}
+	})
+}
+
+func TestClose(t *testing.T) {
+	refs := func() int {
+		envMu.Lock()
+		defer envMu.Unlock()
+		return envRefs
+	}
+	before := refs()
+
+	r := &RemBG{model: openModel(t), portrait: openModel(t)}
+	if err := Shutdown(); !errors.Is(err, ErrEnvironmentInUse) {
+		t.Errorf("expected ErrEnvironmentInUse with open engines, got %v", err)
+	}
+
+	for range 2 {
+		if err := r.Close(); err != nil {
+			t.Fatalf("expected Close to succeed, got %v", err)
+		}
+		if got := refs(); got != before {
+			t.Fatalf("expected %d environment references, got %d", before, got)
+		}
+	}
+
+	out := make([]float32, 1)
+	if err := r.model.runData(nil, out); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed after Close, got %v", err)
+	}
+	if !ort.IsInitialized() && before == 0 {
+		if err := Shutdown(); err != nil {
+			t.Errorf("expected Shutdown without engines to succeed, got %v", err)
+		}
+	}
+}
+
+func TestOrtLogLevel(t *testing.T) {
+	// Every level must map to an option without panicking, including levels
+	// outside the predefined ones
+	for _, level := range []slog.Level{slog.LevelDebug - 4, slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError, slog.LevelError + 4} {
+		if ortLogLevel(level) == nil {
+			t.Errorf("expected option for level %v", level)
+		}
+	}
+}
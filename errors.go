@@ -0,0 +1,91 @@
+package rmbg
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+)
+
+var (
+	// ErrNoObjectDetected is returned when a mask has no pixel above the
+	// detection threshold
+	ErrNoObjectDetected = errors.New("no object detected in image")
+	// ErrModelNotFound is returned when a model file does not exist
+	ErrModelNotFound = errors.New("model not found")
+	// ErrUnsupportedModel is returned when a model does not match its ModelSpec,
+	// e.g. the tensor names differ or the output kind is unknown
+	ErrUnsupportedModel = errors.New("unsupported model")
+	// ErrRuntimeUnavailable is returned when the ONNX Runtime environment cannot
+	// be initialized, e.g. because its shared library is missing
+	ErrRuntimeUnavailable = errors.New("ONNX Runtime unavailable")
+	// ErrEnvironmentInUse is returned by Shutdown while engines are still open
+	ErrEnvironmentInUse = errors.New("ONNX Runtime environment in use")
+	// ErrClosed is returned by calls on a closed engine
+	ErrClosed = errors.New("engine closed")
+	// ErrInferenceFailed matches every InferenceError
+	ErrInferenceFailed = errors.New("inference failed")
+)
+
+// InferenceError is returned when ONNX Runtime fails to run a model. It matches
+// ErrInferenceFailed and unwraps to the runtime error.
+type InferenceError struct {
+	// Model is the name of the model that failed
+	Model string
+	// Err is the error reported by ONNX Runtime
+	Err error
+}
+
+func (e *InferenceError) Error() string {
+	return fmt.Sprintf("inference failed on %s: %v", e.Model, e.Err)
+}
+
+func (e *InferenceError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrInferenceFailed
+func (e *InferenceError) Is(target error) bool {
+	return target == ErrInferenceFailed
+}
+
+// checkModelFile returns ErrModelNotFound if path does not exist
+func checkModelFile(path string) error {
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %q", ErrModelNotFound, path)
+	}
+	return nil
+}
+
+// validateSpec rejects specs the engine cannot run
+func validateSpec(spec ModelSpec) error {
+	if spec.InputSize <= 0 {
+		return fmt.Errorf("%w: %s has input size %d", ErrUnsupportedModel, spec.Name, spec.InputSize)
+	}
+	switch spec.Output {
+	case OutputLogits, OutputAlpha, OutputSoftLogits:
+	default:
+		return fmt.Errorf("%w: %s has unknown output kind %d", ErrUnsupportedModel, spec.Name, spec.Output)
+	}
+	if spec.InputName == "" || spec.OutputName == "" {
+		return fmt.Errorf("%w: %s is missing tensor names", ErrUnsupportedModel, spec.Name)
+	}
+	if len(spec.Classes) == 1 {
+		return fmt.Errorf("%w: %s has a single class", ErrUnsupportedModel, spec.Name)
+	}
+	return nil
+}
+
+// tensorMismatch describes how the tensor names of a model differ from spec,
+// or returns "" if they match
+func tensorMismatch(spec ModelSpec, inputs, outputs []string) string {
+	if !slices.Contains(inputs, spec.InputName) {
+		return fmt.Sprintf("no input %q (model inputs: %s)", spec.InputName, strings.Join(inputs, ", "))
+	}
+	if !slices.Contains(outputs, spec.OutputName) {
+		return fmt.Sprintf("no output %q (model outputs: %s)", spec.OutputName, strings.Join(outputs, ", "))
+	}
+	return ""
+}
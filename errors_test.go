@@ -0,0 +1,85 @@
+package rmbg
+
+import (
+	"errors"
+	"image"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInferenceError(t *testing.T) {
+	cause := errors.New("ort: invalid dimensions")
+	var err error = &InferenceError{Model: "u2netp", Err: cause}
+
+	if !errors.Is(err, ErrInferenceFailed) {
+		t.Errorf("expected error to match ErrInferenceFailed")
+	}
+	if !errors.Is(err, cause) {
+		t.Errorf("expected error to unwrap to the runtime error")
+	}
+	var ie *InferenceError
+	if !errors.As(err, &ie) || ie.Model != "u2netp" {
+		t.Errorf("expected errors.As to find the model name, got %v", ie)
+	}
+	if !strings.Contains(err.Error(), "u2netp") || !strings.Contains(err.Error(), cause.Error()) {
+		t.Errorf("expected message to name the model and cause, got %q", err.Error())
+	}
+}
+
+func TestCheckModelFile(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.onnx")
+	if err := checkModelFile(missing); !errors.Is(err, ErrModelNotFound) {
+		t.Errorf("expected ErrModelNotFound, got %v", err)
+	}
+	if err := checkModelFile("errors_test.go"); err != nil {
+		t.Errorf("expected existing file to pass, got %v", err)
+	}
+}
+
+func TestValidateSpec(t *testing.T) {
+	for _, spec := range []ModelSpec{ModelU2NetP, ModelU2Net, ModelU2NetHumanSeg, ModelMODNet} {
+		if err := validateSpec(spec); err != nil {
+			t.Errorf("expected %s to be valid, got %v", spec.Name, err)
+		}
+	}
+
+	bad := []ModelSpec{
+		{Name: "size", InputName: "in", OutputName: "out"},
+		{Name: "kind", InputName: "in", OutputName: "out", InputSize: 320, Output: OutputKind(9)},
+		{Name: "names", InputSize: 320},
+	}
+	for _, spec := range bad {
+		if err := validateSpec(spec); !errors.Is(err, ErrUnsupportedModel) {
+			t.Errorf("%s: expected ErrUnsupportedModel, got %v", spec.Name, err)
+		}
+	}
+}
+
+func TestTensorMismatch(t *testing.T) {
+	if got := tensorMismatch(ModelU2NetP, []string{"input.1"}, []string{"1959", "1960"}); got != "" {
+		t.Errorf("expected match, got %q", got)
+	}
+	if got := tensorMismatch(ModelU2NetP, []string{"input"}, []string{"1959"}); !strings.Contains(got, `"input.1"`) {
+		t.Errorf("expected missing input to be reported, got %q", got)
+	}
+	if got := tensorMismatch(ModelMODNet, []string{"input"}, []string{"mask"}); !strings.Contains(got, "mask") {
+		t.Errorf("expected available outputs to be listed, got %q", got)
+	}
+}
+
+func TestNewMissingModel(t *testing.T) {
+	// The model file is checked before the runtime is loaded, so this holds
+	// without ONNX Runtime installed
+	_, err := New(&Config{ModelPath: "missing.onnx"})
+	if !errors.Is(err, ErrModelNotFound) {
+		t.Errorf("expected ErrModelNotFound, got %v", err)
+	}
+}
+
+func TestErrNoObjectDetected(t *testing.T) {
+	empty := image.NewGray(image.Rect(0, 0, 10, 10))
+	if _, err := (&RemBG{}).SmartCropWithMask(image.NewRGBA(empty.Bounds()), empty, nil); !errors.Is(err, ErrNoObjectDetected) {
+		t.Errorf("expected ErrNoObjectDetected, got %v", err)
+	}
+}
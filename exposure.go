@@ -0,0 +1,199 @@
+package rmbg
+
+import (
+	"fmt"
+	"image"
+)
+
+// Defaults of CLAHE
+const (
+	DefaultCLAHETiles     = 8
+	DefaultCLAHEClipLimit = 2.0
+)
+
+// Exposure selects the normalization of exposure and contrast applied to
+// images before inference
+type Exposure int
+
+const (
+	// ExposureOff leaves images as they are
+	ExposureOff Exposure = iota
+	// ExposureStretch stretches each channel to the full range, see
+	// AutoContrast
+	ExposureStretch
+	// ExposureCLAHE equalizes the luminance histogram tile by tile, see CLAHE
+	ExposureCLAHE
+)
+
+func (e Exposure) String() string {
+	switch e {
+	case ExposureOff:
+		return "off"
+	case ExposureStretch:
+		return "stretch"
+	case ExposureCLAHE:
+		return "clahe"
+	}
+	return fmt.Sprintf("Exposure(%d)", int(e))
+}
+
+// ParseExposure returns the exposure named s, as printed by String
+func ParseExposure(s string) (Exposure, error) {
+	switch s {
+	case "off", "":
+		return ExposureOff, nil
+	case "stretch":
+		return ExposureStretch, nil
+	case "clahe":
+		return ExposureCLAHE, nil
+	}
+	return 0, fmt.Errorf("unknown exposure %q", s)
+}
+
+// preProcessor returns the pre-processor implementing e, or nil for
+// ExposureOff
+func (e Exposure) preProcessor() (PreProcessor, error) {
+	switch e {
+	case ExposureOff:
+		return nil, nil
+	case ExposureStretch:
+		return AutoContrast{}, nil
+	case ExposureCLAHE:
+		return CLAHE{}, nil
+	}
+	return nil, fmt.Errorf("unknown exposure %v", e)
+}
+
+// CLAHE applies contrast limited adaptive histogram equalization to the
+// luminance of an image: each tile of a grid gets its own equalization,
+// interpolated between tiles, and its histogram is clipped first so flat
+// regions do not amplify noise. Underexposed and hazy photos gain local
+// contrast while colors keep their hue.
+type CLAHE struct {
+	// Tiles is the number of tiles along each side (default:
+	// DefaultCLAHETiles)
+	Tiles int
+	// ClipLimit caps each histogram bin at this multiple of the mean bin
+	// count, limiting the contrast gain (default: DefaultCLAHEClipLimit)
+	ClipLimit float64
+}
+
+// Apply implements PreProcessor
+func (c CLAHE) Apply(img *image.NRGBA) error {
+	tiles := c.Tiles
+	if tiles <= 0 {
+		tiles = DefaultCLAHETiles
+	}
+	clipLimit := c.ClipLimit
+	if clipLimit <= 0 {
+		clipLimit = DefaultCLAHEClipLimit
+	}
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	tx, ty := min(tiles, w), min(tiles, h)
+	if tx == 0 || ty == 0 {
+		return nil
+	}
+
+	luma := make([]uint8, w*h)
+	for y := range h {
+		row := img.Pix[y*img.Stride:][:w*4]
+		for x := range w {
+			luma[y*w+x] = uint8(lumaOf(row[x*4], row[x*4+1], row[x*4+2])*255 + 0.5)
+		}
+	}
+
+	// One lookup table per tile
+	luts := make([][256]uint8, tx*ty)
+	for j := range ty {
+		y0, y1 := j*h/ty, (j+1)*h/ty
+		for i := range tx {
+			x0, x1 := i*w/tx, (i+1)*w/tx
+			var hist [256]int
+			for y := y0; y < y1; y++ {
+				for _, v := range luma[y*w+x0 : y*w+x1] {
+					hist[v]++
+				}
+			}
+			luts[j*tx+i] = claheLUT(&hist, (x1-x0)*(y1-y0), clipLimit)
+		}
+	}
+
+	// Each pixel blends the tables of the four nearest tile centers
+	cols, rows := claheNeighbors(w, tx), claheNeighbors(h, ty)
+	parallelRows(h, func(start, end int) {
+		for y := start; y < end; y++ {
+			j0, j1, fy := rows[y].k0, rows[y].k1, rows[y].f
+			row := img.Pix[y*img.Stride:][:w*4]
+			for x := range w {
+				i0, i1, fx := cols[x].k0, cols[x].k1, cols[x].f
+				v := luma[y*w+x]
+				top := float64(luts[j0*tx+i0][v])*(1-fx) + float64(luts[j0*tx+i1][v])*fx
+				bottom := float64(luts[j1*tx+i0][v])*(1-fx) + float64(luts[j1*tx+i1][v])*fx
+				mapped := top*(1-fy) + bottom*fy
+
+				p := row[x*4 : x*4+3 : x*4+3]
+				if v == 0 {
+					g := uint8(mapped + 0.5)
+					p[0], p[1], p[2] = g, g, g
+					continue
+				}
+				// Scale the color to keep its hue
+				gain := mapped / float64(v)
+				for k := range p {
+					p[k] = uint8(min(float64(p[k])*gain+0.5, 255))
+				}
+			}
+		}
+	})
+	return nil
+}
+
+// claheNeighbor locates a pixel between the centers of tiles k0 and k1, at
+// fraction f of the way to k1
+type claheNeighbor struct {
+	k0, k1 int
+	f      float64
+}
+
+// claheNeighbors returns the neighboring tiles of each of size pixels split
+// into n tiles. Pixels outside the outer tile centers use one tile.
+func claheNeighbors(size, n int) []claheNeighbor {
+	center := func(k int) float64 {
+		return float64(k*size/n+(k+1)*size/n) / 2
+	}
+	out := make([]claheNeighbor, size)
+	k := 0
+	for p := range out {
+		pos := float64(p) + 0.5
+		for k < n-1 && center(k+1) <= pos {
+			k++
+		}
+		if c0 := center(k); pos > c0 && k < n-1 {
+			out[p] = claheNeighbor{k, k + 1, (pos - c0) / (center(k+1) - c0)}
+		} else {
+			out[p] = claheNeighbor{k, k, 0}
+		}
+	}
+	return out
+}
+
+// claheLUT clips hist, a histogram of n pixels, at clipLimit times its mean
+// bin count, spreads the excess evenly and returns its equalization
+func claheLUT(hist *[256]int, n int, clipLimit float64) [256]uint8 {
+	var lut [256]uint8
+	if n == 0 {
+		return lut
+	}
+	limit := clipLimit * float64(n) / 256
+	var excess float64
+	for _, count := range hist {
+		excess += max(float64(count)-limit, 0)
+	}
+	share := excess / 256
+	var cdf float64
+	for v, count := range hist {
+		cdf += min(float64(count), limit) + share
+		lut[v] = uint8(min(cdf*255/float64(n)+0.5, 255))
+	}
+	return lut
+}
@@ -0,0 +1,62 @@
+package rmbg
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestExposureString(t *testing.T) {
+	for _, e := range []Exposure{ExposureOff, ExposureStretch, ExposureCLAHE} {
+		got, err := ParseExposure(e.String())
+		if err != nil || got != e {
+			t.Errorf("expected %v to round-trip, got %v (%v)", e, got, err)
+		}
+	}
+	if _, err := ParseExposure("auto"); err == nil {
+		t.Errorf("expected error for an unknown exposure")
+	}
+	if _, err := New(&Config{Backend: &squareBackend{}, Exposure: Exposure(9)}); err == nil {
+		t.Errorf("expected New to reject an unknown exposure")
+	}
+}
+
+func TestCLAHE(t *testing.T) {
+	// A dark, low-contrast image: a faint square on a dim background
+	img := solidImage(256, 256, color.NRGBA{R: 30, G: 30, B: 30, A: 255})
+	for y := 80; y < 176; y++ {
+		for x := 80; x < 176; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: 40, G: 36, B: 32, A: 255})
+		}
+	}
+	contrast := func() int {
+		return int(img.NRGBAAt(88, 120).R) - int(img.NRGBAAt(72, 120).R)
+	}
+	before := contrast()
+	if err := (CLAHE{ClipLimit: 40}).Apply(img); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if after := contrast(); after < 3*before {
+		t.Errorf("expected the contrast of %d to at least triple, got %d", before, after)
+	}
+	if p := img.NRGBAAt(88, 120); p.R <= p.G || p.G <= p.B {
+		t.Errorf("expected the hue kept, got %v", p)
+	}
+
+	t.Run("Flat", func(t *testing.T) {
+		flat := solidImage(32, 32, color.NRGBA{R: 80, G: 80, B: 80, A: 255})
+		if err := (CLAHE{}).Apply(flat); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+		if got := flat.NRGBAAt(5, 5).R; got < 70 || got > 90 {
+			t.Errorf("expected a flat image about unchanged, got %d", got)
+		}
+	})
+
+	t.Run("Tiny", func(t *testing.T) {
+		tiny := image.NewNRGBA(image.Rect(0, 0, 3, 1))
+		if err := (CLAHE{}).Apply(tiny); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+	})
+}
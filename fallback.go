@@ -0,0 +1,111 @@
+package rmbg
+
+import (
+	"fmt"
+	"image"
+)
+
+// DefaultFallbackThreshold is the default CropConfig.FallbackThreshold
+const DefaultFallbackThreshold = 1
+
+// Fallback is a way of finding something to crop when the mask holds no
+// object, tried in the order of CropConfig.Fallbacks
+type Fallback int
+
+const (
+	// FallbackNone reports that the mask held the object
+	FallbackNone Fallback = iota
+	// FallbackLowerThreshold retries the mask with CropConfig.FallbackThreshold
+	FallbackLowerThreshold
+	// FallbackAutoMask replaces the mask with AutoMask, which finds objects
+	// from the alpha channel, a uniform background or edges
+	FallbackAutoMask
+	// FallbackFullFrame crops the whole image, ignoring the margin, size and
+	// aspect ratio settings
+	FallbackFullFrame
+)
+
+// DefaultFallbacks tries every fallback, from the closest to the model mask
+// to the full frame, so a crop never fails for lack of an object
+var DefaultFallbacks = []Fallback{FallbackLowerThreshold, FallbackAutoMask, FallbackFullFrame}
+
+func (f Fallback) String() string {
+	switch f {
+	case FallbackNone:
+		return "none"
+	case FallbackLowerThreshold:
+		return "lower-threshold"
+	case FallbackAutoMask:
+		return "automask"
+	case FallbackFullFrame:
+		return "full-frame"
+	}
+	return fmt.Sprintf("Fallback(%d)", int(f))
+}
+
+// validateFallbacks reports unknown fallbacks
+func validateFallbacks(fallbacks []Fallback) error {
+	for _, f := range fallbacks {
+		if f <= FallbackNone || f > FallbackFullFrame {
+			return fmt.Errorf("unknown fallback %v", f)
+		}
+	}
+	return nil
+}
+
+// applyFallbacks returns the mask of img and the config to crop it with: mask
+// and config when the mask holds an object at config.MinThreshold, else those
+// of the first of config.Fallbacks that finds one, with a full mask for
+// FallbackFullFrame. It returns ErrNoObjectDetected when none does.
+func applyFallbacks(img image.Image, mask *image.Gray, config *CropConfig) (*image.Gray, *CropConfig, Fallback, error) {
+	if maskCoverage(mask, config.MinThreshold) > 0 {
+		return mask, config, FallbackNone, nil
+	}
+	for _, f := range config.Fallbacks {
+		switch f {
+		case FallbackLowerThreshold:
+			threshold := config.FallbackThreshold
+			if threshold == 0 {
+				threshold = DefaultFallbackThreshold
+			}
+			if threshold < config.MinThreshold && maskCoverage(mask, threshold) > 0 {
+				lowered := *config
+				lowered.MinThreshold = threshold
+				return mask, &lowered, f, nil
+			}
+		case FallbackAutoMask:
+			if auto := AutoMask(img); maskCoverage(auto, config.MinThreshold) > 0 {
+				return auto, config, f, nil
+			}
+		case FallbackFullFrame:
+			full := image.NewGray(mask.Bounds())
+			for i := range full.Pix {
+				full.Pix[i] = 255
+			}
+			return full, config, f, nil
+		}
+	}
+	return mask, config, FallbackNone, ErrNoObjectDetected
+}
+
+// fallbackBounds is detectCropBounds applying config.Fallbacks. It also
+// returns the mask and config the bounds were detected with.
+func fallbackBounds(img image.Image, mask *image.Gray, config *CropConfig) (*CropBounds, *image.Gray, *CropConfig, error) {
+	if mask == nil {
+		return nil, nil, nil, fmt.Errorf("mask image is nil")
+	}
+	mask, config, f, err := applyFallbacks(img, mask, config)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if f == FallbackFullFrame {
+		bounds := img.Bounds()
+		return &CropBounds{Object: bounds, Crop: bounds, Coverage: 1, BoxCoverage: 1, Fallback: f}, mask, config, nil
+	}
+	b, err := detectCropBounds(img.Bounds(), mask, config)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	b.Fallback = f
+	return b, mask, config, nil
+}
@@ -0,0 +1,131 @@
+package rmbg
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestFallbacks(t *testing.T) {
+	white := color.NRGBA{255, 255, 255, 255}
+	blank := image.NewGray(image.Rect(0, 0, 10, 10))
+
+	t.Run("None", func(t *testing.T) {
+		img := solidImage(100, 100, white)
+		if _, err := crop(img, blank, &CropConfig{MinThreshold: 10}, 10, 10); !errors.Is(err, ErrNoObjectDetected) {
+			t.Errorf("expected ErrNoObjectDetected, got %v", err)
+		}
+	})
+
+	t.Run("MaskFound", func(t *testing.T) {
+		mask := image.NewGray(image.Rect(0, 0, 10, 10))
+		fillRect(mask, image.Rect(4, 4, 6, 6), 255)
+		b, _, _, err := fallbackBounds(solidImage(100, 100, white), mask, &CropConfig{MinThreshold: 10, Fallbacks: DefaultFallbacks})
+		if err != nil {
+			t.Fatalf("fallbackBounds failed: %v", err)
+		}
+		if b.Fallback != FallbackNone {
+			t.Errorf("expected no fallback, got %v", b.Fallback)
+		}
+	})
+
+	t.Run("LowerThreshold", func(t *testing.T) {
+		mask := image.NewGray(image.Rect(0, 0, 10, 10))
+		fillRect(mask, image.Rect(2, 3, 5, 7), 4)
+		config := &CropConfig{MinThreshold: 10, Fallbacks: DefaultFallbacks}
+		b, _, _, err := fallbackBounds(solidImage(100, 100, white), mask, config)
+		if err != nil {
+			t.Fatalf("fallbackBounds failed: %v", err)
+		}
+		if b.Fallback != FallbackLowerThreshold {
+			t.Errorf("expected %v, got %v", FallbackLowerThreshold, b.Fallback)
+		}
+		if b.Object != image.Rect(20, 30, 40, 60) {
+			t.Errorf("expected object (20,30)-(40,60), got %v", b.Object)
+		}
+		if config.MinThreshold != 10 {
+			t.Errorf("expected config to be left unchanged, got threshold %d", config.MinThreshold)
+		}
+
+		config.FallbackThreshold = 5
+		b, _, _, err = fallbackBounds(solidImage(100, 100, white), mask, config)
+		if err != nil {
+			t.Fatalf("fallbackBounds failed: %v", err)
+		}
+		if b.Fallback == FallbackLowerThreshold {
+			t.Errorf("expected the mask to stay empty at threshold 5")
+		}
+	})
+
+	t.Run("AutoMask", func(t *testing.T) {
+		img := solidImage(100, 100, white)
+		draw.Draw(img, image.Rect(30, 40, 60, 80), image.NewUniform(color.NRGBA{20, 40, 200, 255}), image.Point{}, draw.Src)
+		config := &CropConfig{MinThreshold: 10, Fallbacks: []Fallback{FallbackAutoMask}}
+		b, _, _, err := fallbackBounds(img, blank, config)
+		if err != nil {
+			t.Fatalf("fallbackBounds failed: %v", err)
+		}
+		if b.Fallback != FallbackAutoMask {
+			t.Errorf("expected %v, got %v", FallbackAutoMask, b.Fallback)
+		}
+		if !b.Object.In(image.Rect(25, 35, 65, 85)) || !image.Rect(32, 42, 58, 78).In(b.Object) {
+			t.Errorf("expected object near (30,40)-(60,80), got %v", b.Object)
+		}
+
+		out, err := crop(img, blank, config, 10, 10)
+		if err != nil {
+			t.Fatalf("crop failed: %v", err)
+		}
+		if out.Bounds().Dx() >= 100 || out.Bounds().Dy() >= 100 {
+			t.Errorf("expected a crop around the object, got %v", out.Bounds())
+		}
+	})
+
+	t.Run("FullFrame", func(t *testing.T) {
+		img := solidImage(100, 80, white)
+		config := &CropConfig{Margin: 20, MinThreshold: 10, Fallbacks: DefaultFallbacks}
+		b, _, _, err := fallbackBounds(img, blank, config)
+		if err != nil {
+			t.Fatalf("fallbackBounds failed: %v", err)
+		}
+		if b.Fallback != FallbackFullFrame {
+			t.Errorf("expected %v, got %v", FallbackFullFrame, b.Fallback)
+		}
+		if b.Crop != img.Bounds() {
+			t.Errorf("expected crop %v, got %v", img.Bounds(), b.Crop)
+		}
+
+		out, err := crop(img, blank, config, 10, 8)
+		if err != nil {
+			t.Fatalf("crop failed: %v", err)
+		}
+		if out.Bounds().Size() != img.Bounds().Size() {
+			t.Errorf("expected size %v, got %v", img.Bounds().Size(), out.Bounds().Size())
+		}
+	})
+
+	t.Run("Validate", func(t *testing.T) {
+		if err := (&CropConfig{Fallbacks: DefaultFallbacks}).Validate(); err != nil {
+			t.Errorf("expected valid config, got %v", err)
+		}
+		if err := (&CropConfig{Fallbacks: []Fallback{FallbackNone}}).Validate(); err == nil {
+			t.Error("expected error for unknown fallback")
+		}
+	})
+}
+
+func TestFallbackString(t *testing.T) {
+	for f, want := range map[Fallback]string{
+		FallbackNone:           "none",
+		FallbackLowerThreshold: "lower-threshold",
+		FallbackAutoMask:       "automask",
+		FallbackFullFrame:      "full-frame",
+		Fallback(9):            "Fallback(9)",
+	} {
+		if got := f.String(); got != want {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package rmbg
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ProcessFile removes the background of the image at inPath and writes it to
+// outPath. The input format is detected from the file contents and the output
+// format from the extension of outPath: PNG, WebP and AVIF keep the
+// background transparent, JPEG is composited over opts.Background (default:
+// white), PSD and OpenRaster keep the original, the cut-out and the mask as
+// layers, and SVG clips the object by its outline. The metadata of the input
+// is copied as for RemoveBackgroundFrom. The output, and the sidecar when
+// opts.Sidecar is set, are written to temporary files that replace them once
+// complete.
+func (r *RemBG) ProcessFile(inPath, outPath string, opts *IOOptions) error {
+	if opts == nil {
+		opts = &IOOptions{}
+	}
+	format, err := FormatFromPath(outPath)
+	if err != nil {
+		return err
+	}
+	if opts.Crop != nil {
+		if err := opts.Crop.Validate(); err != nil {
+			return err
+		}
+	}
+
+	data, err := os.ReadFile(inPath)
+	if err != nil {
+		return err
+	}
+	encoded, sc, err := r.processData(inPath, data, format, opts)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(outPath, encoded); err != nil {
+		return err
+	}
+	if sc == nil {
+		return nil
+	}
+	sc.Input, sc.Output = inPath, outPath
+	js, err := sc.marshal()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(sidecarPath(outPath), js)
+}
+
+// processData decodes data, read from name, renders it as format and copies
+// its metadata to the output as described for ProcessFile. It also returns
+// the sidecar of the image when opts.Sidecar is set.
+func (r *RemBG) processData(name string, data []byte, format Format, opts *IOOptions) ([]byte, *Sidecar, error) {
+	img, md, err := decodeImage(bytes.NewReader(data), opts.Decode)
+	if err != nil {
+		return nil, nil, r.countError(ErrorKindDecode, fmt.Errorf("%s: %w", name, err))
+	}
+
+	var out bytes.Buffer
+	sc, err := r.render(&out, img, md, format, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return withMetadata(out.Bytes(), md, format, opts), sc, nil
+}
+
+// withMetadata copies md to the encoded output, unless opts.StripMetadata is
+// set or format cannot carry it, and sets the resolution of opts.DPI
+func withMetadata(encoded []byte, md metadata, format Format, opts *IOOptions) []byte {
+	if opts.StripMetadata {
+		md = metadata{}
+	}
+	if opts.DPI > 0 {
+		md.dpi = resolution{opts.DPI, opts.DPI}
+		if md.exif != nil {
+			md.exif = setEXIFResolution(md.exif, md.dpi)
+		}
+	}
+	switch format {
+	case FormatJPEG:
+		return writeJPEGMetadata(encoded, md)
+	case FormatWebP:
+		return writeWebPMetadata(encoded, md)
+	case FormatPNG:
+		return writePNGMetadata(encoded, md)
+	case FormatTIFF:
+		return writeTIFFMetadata(encoded, md)
+	}
+	return encoded
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it
+// over path, so readers never see a partial file
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	// CreateTemp makes the file private; give it the permissions of a new file
+	if err := os.Chmod(tmp, 0o644); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package rmbg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProcessFile(t *testing.T) {
+	exif := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x00")
+	icc := append(append([]byte{}, iccHeader...), 1, 1, 0xab)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, solidImage(16, 8, color.NRGBA{G: 200, A: 255}), nil); err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	input := writeJPEGMetadata(buf.Bytes(), metadata{exif: exif, icc: [][]byte{icc}})
+	decoded, err := jpeg.Decode(bytes.NewReader(input))
+	if err != nil {
+		t.Fatalf("failed to decode input: %v", err)
+	}
+
+	dir := t.TempDir()
+	inPath := filepath.Join(dir, "in.jpg")
+	if err := os.WriteFile(inPath, input, 0o644); err != nil {
+		t.Fatalf("failed to write input: %v", err)
+	}
+	r := cachedEngine(decoded)
+
+	t.Run("JPEG", func(t *testing.T) {
+		outPath := filepath.Join(dir, "out.jpeg")
+		if err := r.ProcessFile(inPath, outPath, nil); err != nil {
+			t.Fatalf("ProcessFile failed: %v", err)
+		}
+		data, err := os.ReadFile(outPath)
+		if err != nil {
+			t.Fatalf("failed to read output: %v", err)
+		}
+		if _, err := jpeg.Decode(bytes.NewReader(data)); err != nil {
+			t.Fatalf("expected valid JPEG, got %v", err)
+		}
+		md := readMetadata(data)
+		if !bytes.Equal(md.exif, exif) || len(md.icc) != 1 || !bytes.Equal(md.icc[0], icc) {
+			t.Errorf("expected EXIF and ICC to be preserved, got %+v", md)
+		}
+	})
+
+	t.Run("PNG", func(t *testing.T) {
+		outPath := filepath.Join(dir, "out.png")
+		if err := r.ProcessFile(inPath, outPath, nil); err != nil {
+			t.Fatalf("ProcessFile failed: %v", err)
+		}
+		data, err := os.ReadFile(outPath)
+		if err != nil {
+			t.Fatalf("failed to read output: %v", err)
+		}
+		if _, format, err := image.Decode(bytes.NewReader(data)); err != nil || format != "png" {
+			t.Fatalf("expected valid PNG, got %s (%v)", format, err)
+		}
+		md := readMetadata(data)
+		if !bytes.Equal(md.exif, exif) || len(md.icc) != 1 || !bytes.Equal(md.icc[0], icc) {
+			t.Errorf("expected EXIF and ICC to be preserved, got %+v", md)
+		}
+	})
+
+	t.Run("WebP", func(t *testing.T) {
+		outPath := filepath.Join(dir, "out.webp")
+		if err := r.ProcessFile(inPath, outPath, nil); err != nil {
+			t.Fatalf("ProcessFile failed: %v", err)
+		}
+		data, err := os.ReadFile(outPath)
+		if err != nil {
+			t.Fatalf("failed to read output: %v", err)
+		}
+		if _, format, err := image.Decode(bytes.NewReader(data)); err != nil || format != "webp" {
+			t.Fatalf("expected valid WebP, got %s (%v)", format, err)
+		}
+		md := readMetadata(data)
+		if !bytes.Equal(md.exif, exif) || len(md.icc) != 1 || !bytes.Equal(md.icc[0], icc) {
+			t.Errorf("expected EXIF and ICC to be preserved, got %+v", md)
+		}
+	})
+
+	t.Run("StripMetadata", func(t *testing.T) {
+		outPath := filepath.Join(dir, "stripped.jpg")
+		if err := r.ProcessFile(inPath, outPath, &IOOptions{StripMetadata: true}); err != nil {
+			t.Fatalf("ProcessFile failed: %v", err)
+		}
+		data, err := os.ReadFile(outPath)
+		if err != nil {
+			t.Fatalf("failed to read output: %v", err)
+		}
+		if md := readMetadata(data); md.exif != nil || md.icc != nil {
+			t.Errorf("expected no metadata, got %+v", md)
+		}
+	})
+
+	t.Run("UnknownExtension", func(t *testing.T) {
+		outPath := filepath.Join(dir, "out.gif")
+		if err := r.ProcessFile(inPath, outPath, nil); err == nil {
+			t.Errorf("expected error for .gif output")
+		}
+		if _, err := os.Stat(outPath); !os.IsNotExist(err) {
+			t.Errorf("expected no output file, got %v", err)
+		}
+	})
+
+	t.Run("MissingInput", func(t *testing.T) {
+		if err := r.ProcessFile(filepath.Join(dir, "missing.jpg"), filepath.Join(dir, "x.png"), nil); !os.IsNotExist(err) {
+			t.Errorf("expected not-exist error, got %v", err)
+		}
+	})
+}
+
+func TestReadMetadata(t *testing.T) {
+	if md := readMetadata([]byte("not an image")); md.exif != nil || md.icc != nil {
+		t.Errorf("expected no metadata, got %+v", md)
+	}
+	// A truncated segment length must not read past the data
+	truncated := []byte{0xff, 0xd8, 0xff, jpegAPP1, 0xff, 0xff, 'E', 'x'}
+	if md := readMetadata(truncated); md.exif != nil {
+		t.Errorf("expected no metadata from truncated JPEG, got %+v", md)
+	}
+}
+
+func TestFormatFromPath(t *testing.T) {
+	tests := map[string]Format{"a.png": FormatPNG, "b.JPG": FormatJPEG, "dir/c.jpeg": FormatJPEG, "d.WebP": FormatWebP}
+	for path, want := range tests {
+		if got, err := FormatFromPath(path); err != nil || got != want {
+			t.Errorf("expected %v for %s, got %v (%v)", want, path, got, err)
+		}
+	}
+	if _, err := FormatFromPath("noext"); err == nil {
+		t.Errorf("expected error without extension")
+	}
+}
@@ -0,0 +1,70 @@
+package rmbg
+
+import (
+	"fmt"
+	"image"
+	"slices"
+)
+
+// Garment is a kind of garment found by ModelClothSeg
+type Garment int
+
+const (
+	// GarmentUpper covers tops, shirts and jackets
+	GarmentUpper Garment = iota + 1
+	// GarmentLower covers trousers, shorts and skirts
+	GarmentLower
+	// GarmentFull covers dresses, jumpsuits and coats worn over the whole body
+	GarmentFull
+)
+
+// String returns the class name of the garment in ModelClothSeg
+func (g Garment) String() string {
+	switch g {
+	case GarmentUpper:
+		return "upper"
+	case GarmentLower:
+		return "lower"
+	case GarmentFull:
+		return "full"
+	}
+	return fmt.Sprintf("Garment(%d)", int(g))
+}
+
+// ParseGarment returns the garment named s, as printed by String
+func ParseGarment(s string) (Garment, error) {
+	for _, g := range []Garment{GarmentUpper, GarmentLower, GarmentFull} {
+		if s == g.String() {
+			return g, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown garment %q", s)
+}
+
+// GarmentMask runs a cloth segmentation model such as ModelClothSeg on img and
+// returns the probability mask of garment, at the resolution of img
+func (r *RemBG) GarmentMask(img image.Image, garment Garment) (*image.Gray, error) {
+	if spec := r.currentModel().spec; !slices.Contains(spec.Classes, garment.String()) {
+		return nil, fmt.Errorf("%w: %s has no %v garment class", ErrUnsupportedModel, spec.Name, garment)
+	}
+	masks, err := r.ClassMasks(img)
+	if err != nil {
+		return nil, err
+	}
+	mask, ok := masks[garment.String()]
+	if !ok {
+		// The model was reloaded since the check
+		return nil, fmt.Errorf("%w: %v garment class", ErrUnsupportedModel, garment)
+	}
+	return mask, nil
+}
+
+// ExtractGarment returns img with everything but garment transparent, e.g. a
+// shirt without the mannequin or model wearing it
+func (r *RemBG) ExtractGarment(img image.Image, garment Garment) (*image.NRGBA, error) {
+	mask, err := r.GarmentMask(img, garment)
+	if err != nil {
+		return nil, err
+	}
+	return cutout(img, mask), nil
+}
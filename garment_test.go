@@ -0,0 +1,72 @@
+package rmbg
+
+import (
+	"errors"
+	"image/color"
+	"testing"
+)
+
+func TestGarments(t *testing.T) {
+	if err := validateSpec(ModelClothSeg); err != nil {
+		t.Errorf("expected valid cloth segmentation spec, got %v", err)
+	}
+
+	spec := ModelSpec{
+		Name:       "cloth",
+		InputName:  "in",
+		OutputName: "out",
+		InputSize:  24,
+		Output:     OutputAlpha,
+		Classes:    []string{"background", "upper", "lower"},
+	}
+	r, err := New(&Config{Backend: classBackend{24}, Model: &spec})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer r.Close()
+	src := solidImage(24, 24, color.NRGBA{R: 90, G: 120, B: 30, A: 255})
+
+	t.Run("Mask", func(t *testing.T) {
+		mask, err := r.GarmentMask(src, GarmentLower)
+		if err != nil {
+			t.Fatalf("GarmentMask failed: %v", err)
+		}
+		if v := mask.GrayAt(20, 12).Y; v < 200 {
+			t.Errorf("expected the lower garment on the right, got %d", v)
+		}
+		if v := mask.GrayAt(12, 12).Y; v > 55 {
+			t.Errorf("expected no lower garment in the middle, got %d", v)
+		}
+	})
+
+	t.Run("Extract", func(t *testing.T) {
+		out, err := r.ExtractGarment(src, GarmentUpper)
+		if err != nil {
+			t.Fatalf("ExtractGarment failed: %v", err)
+		}
+		if a := out.NRGBAAt(12, 12).A; a < 200 {
+			t.Errorf("expected the upper garment opaque, got alpha %d", a)
+		}
+		if a := out.NRGBAAt(4, 12).A; a > 55 {
+			t.Errorf("expected the background transparent, got alpha %d", a)
+		}
+	})
+
+	t.Run("MissingClass", func(t *testing.T) {
+		if _, err := r.GarmentMask(src, GarmentFull); !errors.Is(err, ErrUnsupportedModel) {
+			t.Errorf("expected ErrUnsupportedModel, got %v", err)
+		}
+	})
+}
+
+func TestParseGarment(t *testing.T) {
+	for _, g := range []Garment{GarmentUpper, GarmentLower, GarmentFull} {
+		got, err := ParseGarment(g.String())
+		if err != nil || got != g {
+			t.Errorf("expected %v, got %v (%v)", g, got, err)
+		}
+	}
+	if _, err := ParseGarment("hat"); err == nil {
+		t.Error("expected error for unknown garment")
+	}
+}
@@ -0,0 +1,58 @@
+//go:build gcs
+
+// Package gcsstorage implements rmbg.Storage on Google Cloud Storage. It is a
+// module of its own, so the core library does not depend on the SDK, and is
+// only built with the gcs tag:
+//
+//	go get github.com/josuedeavila/rmbg/gcsstorage
+//	go build -tags gcs
+package gcsstorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+
+	"cloud.google.com/go/storage"
+	"github.com/josuedeavila/rmbg"
+)
+
+var _ rmbg.Storage = (*Storage)(nil)
+
+// Storage stores objects in one bucket
+type Storage struct {
+	bucket *storage.BucketHandle
+	name   string
+}
+
+// New creates a storage for bucket
+func New(client *storage.Client, bucket string) *Storage {
+	return &Storage{bucket: client.Bucket(bucket), name: bucket}
+}
+
+// Get implements rmbg.Storage
+func (s *Storage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	rc, err := s.bucket.Object(key).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, fmt.Errorf("%w: gs://%s/%s", rmbg.ErrObjectNotFound, s.name, key)
+	}
+	return rc, err
+}
+
+// Put implements rmbg.Storage. The upload is aborted if reading r fails.
+func (s *Storage) Put(ctx context.Context, key string, r io.Reader) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w := s.bucket.Object(key).NewWriter(ctx)
+	w.ContentType = mime.TypeByExtension(path.Ext(key))
+	if _, err := io.Copy(w, r); err != nil {
+		cancel()
+		_ = w.Close()
+		return err
+	}
+	return w.Close()
+}
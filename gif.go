@@ -0,0 +1,147 @@
+package rmbg
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+)
+
+// ProcessGIF removes the background of every frame of an animated GIF and
+// writes the result to w with the same timing and loop count. Masks are
+// smoothed across frames and cut at opts.Threshold, since GIF pixels are
+// either opaque or transparent.
+func (r *RemBG) ProcessGIF(rd io.Reader, w io.Writer, opts *AnimationOptions) error {
+	if opts == nil {
+		opts = &AnimationOptions{}
+	}
+	threshold := opts.Threshold
+	if threshold == 0 {
+		threshold = DefaultGIFThreshold
+	}
+
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return err
+	}
+	cfg, err := gif.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return r.countError(ErrorKindDecode, fmt.Errorf("%w: %w", ErrInvalidImage, err))
+	}
+	if err := opts.check(cfg.Width, cfg.Height, 0); err != nil {
+		return r.countError(ErrorKindDecode, err)
+	}
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return r.countError(ErrorKindDecode, fmt.Errorf("%w: %w", ErrInvalidImage, err))
+	}
+	if err := opts.check(cfg.Width, cfg.Height, len(g.Image)); err != nil {
+		return r.countError(ErrorKindDecode, err)
+	}
+
+	p, err := r.newFrameProcessor(opts)
+	if err != nil {
+		return err
+	}
+	out := &gif.GIF{
+		Delay:     g.Delay,
+		LoopCount: g.LoopCount,
+		Config:    image.Config{Width: cfg.Width, Height: cfg.Height},
+	}
+	canvas := image.NewRGBA(image.Rect(0, 0, cfg.Width, cfg.Height))
+	var previous *image.RGBA
+	for i, frame := range g.Image {
+		disposal := byte(gif.DisposalNone)
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewRGBA(canvas.Rect)
+			copy(previous.Pix, canvas.Pix)
+		}
+		draw.Draw(canvas, frame.Rect, frame, frame.Rect.Min, draw.Over)
+
+		img, mask, err := p.frame(canvas)
+		if err != nil {
+			return fmt.Errorf("frame %d: %w", i, err)
+		}
+		out.Image = append(out.Image, palettedFrame(img, mask, frame.Palette, threshold, opts.Background == nil))
+		// Every output frame covers the canvas, so clear it between frames
+		out.Disposal = append(out.Disposal, gif.DisposalBackground)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Rect, image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return gif.EncodeAll(w, out)
+}
+
+// palettedFrame quantizes img to palette, reserving an index for the pixels
+// whose mask is below threshold when transparent is set
+func palettedFrame(img image.Image, mask *image.Gray, palette color.Palette, threshold uint8, transparent bool) *image.Paletted {
+	pal := make(color.Palette, len(palette), 256)
+	copy(pal, palette)
+	transparentIndex := -1
+	if transparent {
+		for i, c := range pal {
+			if _, _, _, a := c.RGBA(); a == 0 {
+				transparentIndex = i
+				break
+			}
+		}
+		if transparentIndex < 0 {
+			if len(pal) == 256 {
+				pal = pal[:255]
+			}
+			transparentIndex = len(pal)
+			pal = append(pal, color.Transparent)
+		}
+	}
+
+	b := img.Bounds()
+	dst := image.NewPaletted(image.Rect(0, 0, b.Dx(), b.Dy()), pal)
+	index := make(map[color.RGBA]uint8)
+	for y := range b.Dy() {
+		m := mask.Pix[y*mask.Stride:][:b.Dx()]
+		row := dst.Pix[y*dst.Stride:][:b.Dx()]
+		for x := range row {
+			if transparentIndex >= 0 && m[x] < threshold {
+				row[x] = uint8(transparentIndex)
+				continue
+			}
+			r, g, bl, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			c := color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(bl >> 8), 255}
+			i, ok := index[c]
+			if !ok {
+				i = uint8(nearestOpaque(pal, c))
+				index[c] = i
+			}
+			row[x] = i
+		}
+	}
+	return dst
+}
+
+// nearestOpaque returns the index of the opaque color of pal closest to c
+func nearestOpaque(pal color.Palette, c color.RGBA) int {
+	best, bestDist := 0, uint32(1<<32-1)
+	for i, p := range pal {
+		pr, pg, pb, pa := p.RGBA()
+		if pa == 0 {
+			continue
+		}
+		dr := int32(pr>>8) - int32(c.R)
+		dg := int32(pg>>8) - int32(c.G)
+		db := int32(pb>>8) - int32(c.B)
+		if d := uint32(dr*dr + dg*dg + db*db); d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	return best
+}
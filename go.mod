@@ -5,6 +5,5 @@ go 1.25
 require (
 	github.com/disintegration/imaging v1.6.2
 	github.com/yalue/onnxruntime_go v1.23.0
+	golang.org/x/image v0.36.0
 )
-
-require golang.org/x/image v0.36.0 // indirect
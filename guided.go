@@ -0,0 +1,222 @@
+package rmbg
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/disintegration/imaging"
+)
+
+// Upsampling selects how the model mask is scaled to the image resolution
+type Upsampling int
+
+const (
+	// UpsampleBlur uses bilinear interpolation followed by a 5x5 box blur
+	UpsampleBlur Upsampling = iota
+	// UpsampleGuided uses a guided filter with the image as guidance, so mask
+	// edges follow the edges of the image
+	UpsampleGuided
+	// UpsampleAntialias binarizes the interpolated mask and anti-aliases its
+	// boundary with the sub-pixel coverage of each pixel, giving crisp edges
+	// with a transition of Config.AntialiasWidth pixels
+	UpsampleAntialias
+)
+
+func (u Upsampling) String() string {
+	switch u {
+	case UpsampleBlur:
+		return "blur"
+	case UpsampleGuided:
+		return "guided"
+	case UpsampleAntialias:
+		return "antialias"
+	}
+	return fmt.Sprintf("Upsampling(%d)", int(u))
+}
+
+const (
+	// guidedWorkSize is the longest side of the resolution the filter
+	// coefficients are computed at
+	guidedWorkSize = 1024
+	// guidedRadius is the filter radius in mask pixels, wide enough to cover the
+	// uncertain band of an upscaled mask edge
+	guidedRadius = 2
+	guidedEps    = 1e-3
+)
+
+// upsampleMask scales mask to the size of img with the configured method
+func (r *RemBG) upsampleMask(mask *image.Gray, img image.Image) *image.Gray {
+	b := img.Bounds()
+	dst := r.outputs.gray(b.Dx(), b.Dy())
+	switch r.upsampling {
+	case UpsampleGuided:
+		guidedUpsampleInto(dst, mask, img)
+	case UpsampleAntialias:
+		antialiasUpsampleInto(dst, mask, r.antialiasWidth)
+	default:
+		r.resizeGrayBlur5OInto(dst, mask)
+	}
+	return dst
+}
+
+// guidedUpsample is a fast guided filter: the linear coefficients relating the
+// image luminance to the mask are fitted at a reduced resolution, then scaled
+// up and applied to the full-resolution luminance.
+func guidedUpsample(mask *image.Gray, img image.Image) *image.Gray {
+	b := img.Bounds()
+	dst := image.NewGray(image.Rect(0, 0, b.Dx(), b.Dy()))
+	guidedUpsampleInto(dst, mask, img)
+	return dst
+}
+
+// guidedUpsampleInto is guidedUpsample writing to a zero-based dst with the
+// size of img
+func guidedUpsampleInto(dst, mask *image.Gray, img image.Image) {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 {
+		return
+	}
+
+	scale := min(1, float64(guidedWorkSize)/float64(max(w, h)))
+	lw := max(1, int(math.Round(float64(w)*scale)))
+	lh := max(1, int(math.Round(float64(h)*scale)))
+
+	full := imaging.Clone(img)
+	guide := luminance(imaging.Resize(full, lw, lh, imaging.Box))
+
+	mb := mask.Bounds()
+	radius := max(1, int(math.Ceil(guidedRadius*float64(lw)/float64(mb.Dx()))))
+	sx := float64(mb.Dx()) / float64(lw)
+	sy := float64(mb.Dy()) / float64(lh)
+	p := make([]float32, lw*lh)
+	for y := range lh {
+		for x := range lw {
+			p[y*lw+x] = float32(sampleGray(mask, (float64(x)+0.5)*sx-0.5, (float64(y)+0.5)*sy-0.5) / 255)
+		}
+	}
+
+	n := lw * lh
+	ip := make([]float32, n)
+	ii := make([]float32, n)
+	for i := range n {
+		ip[i] = guide[i] * p[i]
+		ii[i] = guide[i] * guide[i]
+	}
+	meanI := boxMean(guide, lw, lh, radius)
+	meanP := boxMean(p, lw, lh, radius)
+	corrI := boxMean(ii, lw, lh, radius)
+	corrIP := boxMean(ip, lw, lh, radius)
+
+	a, bb := ii, ip // reuse buffers
+	for i := range n {
+		varI := corrI[i] - meanI[i]*meanI[i]
+		covIP := corrIP[i] - meanI[i]*meanP[i]
+		a[i] = covIP / (varI + guidedEps)
+		bb[i] = meanP[i] - a[i]*meanI[i]
+	}
+	meanA := boxMean(a, lw, lh, radius)
+	meanB := boxMean(bb, lw, lh, radius)
+
+	// Apply the upscaled coefficients to the full-resolution guide
+	fx := float64(lw) / float64(w)
+	fy := float64(lh) / float64(h)
+	workers := runtime.NumCPU()
+	chunk := (h + workers - 1) / workers
+	var wg sync.WaitGroup
+	for start := 0; start < h; start += chunk {
+		end := min(start+chunk, h)
+		wg.Go(func() {
+			for y := start; y < end; y++ {
+				src := full.Pix[y*full.Stride:]
+				row := dst.Pix[y*dst.Stride:]
+				ly := (float64(y)+0.5)*fy - 0.5
+				for x := range w {
+					lx := (float64(x)+0.5)*fx - 0.5
+					i := x * 4
+					lum := lumaOf(src[i], src[i+1], src[i+2])
+					q := sampleFloat(meanA, lw, lh, lx, ly)*lum + sampleFloat(meanB, lw, lh, lx, ly)
+					row[x] = uint8(max(0, min(1, q))*255 + 0.5)
+				}
+			}
+		})
+	}
+	wg.Wait()
+}
+
+// luminance returns the luma of img in [0, 1]
+func luminance(img *image.NRGBA) []float32 {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	out := make([]float32, w*h)
+	for y := range h {
+		row := img.Pix[y*img.Stride:]
+		for x := range w {
+			i := x * 4
+			out[y*w+x] = lumaOf(row[i], row[i+1], row[i+2])
+		}
+	}
+	return out
+}
+
+func lumaOf(r, g, b uint8) float32 {
+	return (0.299*float32(r) + 0.587*float32(g) + 0.114*float32(b)) / 255
+}
+
+// boxMean averages src over (2*radius+1)^2 windows, shrinking the window at
+// the borders
+func boxMean(src []float32, w, h, radius int) []float32 {
+	tmp := make([]float32, w*h)
+	for y := range h {
+		row := src[y*w : y*w+w]
+		var sum float32
+		for x := range min(radius, w) {
+			sum += row[x]
+		}
+		for x := range w {
+			if x+radius < w {
+				sum += row[x+radius]
+			}
+			if x-radius-1 >= 0 {
+				sum -= row[x-radius-1]
+			}
+			count := min(x+radius, w-1) - max(x-radius, 0) + 1
+			tmp[y*w+x] = sum / float32(count)
+		}
+	}
+
+	out := make([]float32, w*h)
+	for x := range w {
+		var sum float32
+		for y := range min(radius, h) {
+			sum += tmp[y*w+x]
+		}
+		for y := range h {
+			if y+radius < h {
+				sum += tmp[(y+radius)*w+x]
+			}
+			if y-radius-1 >= 0 {
+				sum -= tmp[(y-radius-1)*w+x]
+			}
+			count := min(y+radius, h-1) - max(y-radius, 0) + 1
+			out[y*w+x] = sum / float32(count)
+		}
+	}
+	return out
+}
+
+// sampleFloat bilinearly samples a w x h plane at (fx, fy), clamping at the edges
+func sampleFloat(src []float32, w, h int, fx, fy float64) float32 {
+	fx = max(0, min(fx, float64(w-1)))
+	fy = max(0, min(fy, float64(h-1)))
+	x0, y0 := int(fx), int(fy)
+	x1, y1 := min(x0+1, w-1), min(y0+1, h-1)
+	ax, ay := float32(fx-float64(x0)), float32(fy-float64(y0))
+
+	top := src[y0*w+x0] + (src[y0*w+x1]-src[y0*w+x0])*ax
+	bottom := src[y1*w+x0] + (src[y1*w+x1]-src[y1*w+x0])*ax
+	return top + (bottom-top)*ay
+}
@@ -0,0 +1,76 @@
+package rmbg
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestBoxMean(t *testing.T) {
+	w, h := 7, 5
+	src := make([]float32, w*h)
+	for i := range src {
+		src[i] = 0.25
+	}
+	for i, v := range boxMean(src, w, h, 2) {
+		if math.Abs(float64(v-0.25)) > 1e-6 {
+			t.Fatalf("expected constant 0.25 at %d, got %f", i, v)
+		}
+	}
+
+	// A single row impulse spreads evenly over the window
+	src = make([]float32, 9)
+	src[4] = 9
+	out := boxMean(src, 9, 1, 1)
+	want := []float32{0, 0, 0, 3, 3, 3, 0, 0, 0}
+	for i := range want {
+		if math.Abs(float64(out[i]-want[i])) > 1e-6 {
+			t.Errorf("expected %v, got %v", want, out)
+			break
+		}
+	}
+}
+
+func TestGuidedUpsample(t *testing.T) {
+	// Image with a sharp vertical edge at x=200, mask with a soft edge around it
+	img := image.NewRGBA(image.Rect(0, 0, 400, 100))
+	for y := range 100 {
+		for x := range 400 {
+			if x < 200 {
+				img.Set(x, y, color.White)
+			} else {
+				img.Set(x, y, color.Black)
+			}
+		}
+	}
+	// The mask fades out over x=180..220, so blur upsampling misses the image edge
+	mask := image.NewGray(image.Rect(0, 0, 40, 10))
+	fillRect(mask, image.Rect(0, 0, 18, 10), 255)
+	for x, v := range []uint8{204, 153, 102, 51} {
+		fillRect(mask, image.Rect(18+x, 0, 19+x, 10), v)
+	}
+
+	out := guidedUpsample(mask, img)
+	if out.Bounds() != image.Rect(0, 0, 400, 100) {
+		t.Fatalf("expected 400x100 mask, got %v", out.Bounds())
+	}
+
+	// The guided mask must cross 50% at the image edge rather than the mask edge
+	crossing := func(m *image.Gray) int {
+		for x := range 400 {
+			if m.GrayAt(x, 50).Y < 128 {
+				return x
+			}
+		}
+		return 400
+	}
+	r := &RemBG{blurPool: newBlurBufferPool()}
+	blurred := r.resizeGrayBlur5O(mask, 400, 100)
+	if got := crossing(out); abs(got-200) > 3 {
+		t.Errorf("expected edge at x=200, got %d (blur upsampling: %d)", got, crossing(blurred))
+	}
+	if out.GrayAt(20, 50).Y < 200 || out.GrayAt(380, 50).Y > 55 {
+		t.Errorf("expected foreground left and background right, got %d and %d", out.GrayAt(20, 50).Y, out.GrayAt(380, 50).Y)
+	}
+}
@@ -0,0 +1,177 @@
+package rmbg
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/bits"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/disintegration/imaging"
+)
+
+// DefaultDuplicateDistance is the Hamming distance between perceptual hashes
+// at or below which NearDuplicate considers two images the same shot
+const DefaultDuplicateDistance = 8
+
+// ImageHash is a 64-bit perceptual hash: visually similar images have hashes
+// differing in few bits, see Distance
+type ImageHash uint64
+
+// String returns the hash as 16 hex digits
+func (h ImageHash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
+
+// ParseImageHash parses the hex form returned by ImageHash.String
+func ParseImageHash(s string) (ImageHash, error) {
+	v, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid image hash %q: %w", s, err)
+	}
+	return ImageHash(v), nil
+}
+
+// Distance returns the number of bits differing between h and other, from 0
+// for identical hashes to 64
+func (h ImageHash) Distance(other ImageHash) int {
+	return bits.OnesCount64(uint64(h ^ other))
+}
+
+// DHash returns the difference hash of img: whether each pixel of a 9x8
+// grayscale thumbnail is brighter than its right neighbor. It is fast and
+// survives rescaling and recompression, but not crops.
+func DHash(img image.Image) ImageHash {
+	luma := hashThumbnail(img, 9, 8)
+	var h ImageHash
+	for y := range 8 {
+		for x := range 8 {
+			h <<= 1
+			if luma[y*9+x] > luma[y*9+x+1] {
+				h |= 1
+			}
+		}
+	}
+	return h
+}
+
+// PHash returns the perceptual hash of img: whether each of the 8x8 lowest
+// frequencies of the DCT of a 32x32 grayscale thumbnail is above their
+// median. It is slower than DHash and more robust to gamma, contrast and
+// color changes.
+func PHash(img image.Image) ImageHash {
+	const size, freqs = 32, 8
+	luma := hashThumbnail(img, size, size)
+
+	var basis [freqs][size]float64
+	for u := range freqs {
+		for x := range size {
+			basis[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * size))
+		}
+	}
+	// Separable DCT: rows first, then the columns of the low frequencies
+	var rows [size][freqs]float64
+	for y := range size {
+		for u := range freqs {
+			for x := range size {
+				rows[y][u] += luma[y*size+x] * basis[u][x]
+			}
+		}
+	}
+	var coeffs [freqs * freqs]float64
+	for v := range freqs {
+		for u := range freqs {
+			for y := range size {
+				coeffs[v*freqs+u] += rows[y][u] * basis[v][y]
+			}
+		}
+	}
+
+	// The DC term only measures the mean brightness, so it stays out of the
+	// median
+	sorted := slices.Clone(coeffs[1:])
+	slices.Sort(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+	var h ImageHash
+	for _, c := range coeffs {
+		h <<= 1
+		if c > median {
+			h |= 1
+		}
+	}
+	return h
+}
+
+// NearDuplicate reports whether the perceptual hashes of a and b differ in
+// at most maxDistance bits (default: DefaultDuplicateDistance), e.g. two
+// exports of the same product shot
+func NearDuplicate(a, b image.Image, maxDistance int) bool {
+	if maxDistance <= 0 {
+		maxDistance = DefaultDuplicateDistance
+	}
+	return PHash(a).Distance(PHash(b)) <= maxDistance
+}
+
+// DuplicateIndex finds near-duplicates among the images of a batch, so
+// pipelines can skip processing the same shot twice. It is safe for
+// concurrent use.
+type DuplicateIndex struct {
+	maxDistance int
+
+	mu     sync.Mutex
+	keys   []string
+	hashes []ImageHash
+}
+
+// NewDuplicateIndex returns an empty index matching hashes that differ in at
+// most maxDistance bits (default: DefaultDuplicateDistance)
+func NewDuplicateIndex(maxDistance int) *DuplicateIndex {
+	if maxDistance <= 0 {
+		maxDistance = DefaultDuplicateDistance
+	}
+	return &DuplicateIndex{maxDistance: maxDistance}
+}
+
+// Add records the hash of the image named key, such as its path, unless the
+// index holds a near-duplicate; then it returns the key of the closest one
+// and true
+func (d *DuplicateIndex) Add(key string, h ImageHash) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	best, match := d.maxDistance+1, ""
+	for i, other := range d.hashes {
+		if dist := h.Distance(other); dist < best {
+			best, match = dist, d.keys[i]
+		}
+	}
+	if best <= d.maxDistance {
+		return match, true
+	}
+	d.keys = append(d.keys, key)
+	d.hashes = append(d.hashes, h)
+	return "", false
+}
+
+// Len returns the number of images recorded
+func (d *DuplicateIndex) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.keys)
+}
+
+// hashThumbnail returns the luma of img resized to w x h, row by row
+func hashThumbnail(img image.Image, w, h int) []float64 {
+	luma := make([]float64, w*h)
+	if img.Bounds().Empty() {
+		return luma
+	}
+	small := imaging.Resize(img, w, h, imaging.Box)
+	for i := range luma {
+		p := small.Pix[i*4:]
+		luma[i] = float64(lumaOf(p[0], p[1], p[2]))
+	}
+	return luma
+}
@@ -0,0 +1,104 @@
+package rmbg
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// hashPattern is a w x h image of a light disc over a horizontal gradient,
+// mirrored when flip is set
+func hashPattern(w, h int, flip bool) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			fx, fy := float64(x)/float64(w), float64(y)/float64(h)
+			if flip {
+				fx = 1 - fx
+			}
+			v := uint8(40 + 120*fx)
+			if dx, dy := fx-0.3, fy-0.4; dx*dx+dy*dy < 0.04 {
+				v = 230
+			}
+			img.SetNRGBA(x, y, color.NRGBA{R: v, G: v / 2, B: 255 - v, A: 255})
+		}
+	}
+	return img
+}
+
+func TestImageHash(t *testing.T) {
+	img := hashPattern(200, 150, false)
+	small := imaging.Resize(img, 100, 75, imaging.Lanczos)
+	brighter := imaging.AdjustBrightness(img, 10)
+	other := hashPattern(200, 150, true)
+
+	for _, hash := range []struct {
+		name string
+		fn   func(image.Image) ImageHash
+	}{{"PHash", PHash}, {"DHash", DHash}} {
+		t.Run(hash.name, func(t *testing.T) {
+			h := hash.fn(img)
+			if d := h.Distance(hash.fn(img)); d != 0 {
+				t.Errorf("expected the same hash twice, got distance %d", d)
+			}
+			if d := h.Distance(hash.fn(small)); d > 4 {
+				t.Errorf("expected a rescaled copy within 4 bits, got %d", d)
+			}
+			if d := h.Distance(hash.fn(brighter)); d > 4 {
+				t.Errorf("expected a brighter copy within 4 bits, got %d", d)
+			}
+			if d := h.Distance(hash.fn(other)); d <= DefaultDuplicateDistance {
+				t.Errorf("expected another image beyond %d bits, got %d", DefaultDuplicateDistance, d)
+			}
+		})
+	}
+
+	t.Run("String", func(t *testing.T) {
+		h := ImageHash(0x00ff00ff00ff00ff)
+		if s := h.String(); s != "00ff00ff00ff00ff" {
+			t.Errorf("expected 00ff00ff00ff00ff, got %s", s)
+		}
+		parsed, err := ParseImageHash(h.String())
+		if err != nil || parsed != h {
+			t.Errorf("expected %v, got %v (%v)", h, parsed, err)
+		}
+		if _, err := ParseImageHash("not a hash"); err == nil {
+			t.Errorf("expected error for an invalid hash")
+		}
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		if h := PHash(image.NewNRGBA(image.Rect(0, 0, 0, 0))); h != 0 {
+			t.Errorf("expected 0 for an empty image, got %v", h)
+		}
+	})
+}
+
+func TestNearDuplicate(t *testing.T) {
+	img := hashPattern(200, 150, false)
+	if !NearDuplicate(img, imaging.Resize(img, 120, 90, imaging.Linear), 0) {
+		t.Errorf("expected a rescaled copy to be a near-duplicate")
+	}
+	if NearDuplicate(img, hashPattern(200, 150, true), 0) {
+		t.Errorf("expected a mirrored image not to be a near-duplicate")
+	}
+}
+
+func TestDuplicateIndex(t *testing.T) {
+	index := NewDuplicateIndex(0)
+	if _, dup := index.Add("a.jpg", 0); dup {
+		t.Errorf("expected no duplicate in an empty index")
+	}
+	if _, dup := index.Add("b.jpg", ^ImageHash(0)); dup {
+		t.Errorf("expected no duplicate 64 bits away")
+	}
+	match, dup := index.Add("c.jpg", 0b111)
+	if !dup || match != "a.jpg" {
+		t.Errorf("expected a duplicate of a.jpg, got %q %v", match, dup)
+	}
+	if n := index.Len(); n != 2 {
+		t.Errorf("expected duplicates not to be recorded, got %d images", n)
+	}
+}
@@ -0,0 +1,77 @@
+package rmbg
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Warmup runs one inference on every session of every model, so the first
+// requests do not pay for memory planning and kernel compilation. It blocks
+// while sessions are busy and returns ctx's error if ctx is done first; an
+// inference already started is not interrupted.
+func (r *RemBG) Warmup(ctx context.Context) error {
+	if r.closed.Load() {
+		return ErrClosed
+	}
+	start := time.Now()
+	general := r.acquireModel()
+	defer general.release()
+	for _, m := range []*model{general, r.portrait} {
+		if m == nil || m.sessions == nil {
+			continue
+		}
+		if err := m.warmup(ctx); err != nil {
+			return err
+		}
+	}
+	r.log(slog.LevelInfo, "engine warmed up",
+		slog.Int("sessions", r.sessionCount()),
+		slog.Duration("duration", time.Since(start)),
+	)
+	return nil
+}
+
+// Healthy reports whether the engine can serve requests: it returns ErrClosed
+// after Close and ErrRuntimeUnavailable if ONNX Runtime was shut down. It does
+// not run inference, so it is cheap enough for frequent readiness probes.
+func (r *RemBG) Healthy() error {
+	if r.closed.Load() {
+		return ErrClosed
+	}
+	if m := r.currentModel(); m == nil || m.sessions == nil || m.sessions.size() == 0 {
+		return ErrClosed
+	}
+	if m := r.currentModel(); !m.external && !runtimeInitialized() {
+		return ErrRuntimeUnavailable
+	}
+	return nil
+}
+
+// warmup holds every session in turn and runs it on a blank input; the output
+// is discarded
+func (m *model) warmup(ctx context.Context) error {
+	input, output := m.inputs.get(), m.outputs.get()
+	defer m.inputs.put(input)
+	defer m.outputs.put(output)
+	clear(*input)
+
+	held := make([]session, 0, m.sessions.size())
+	defer func() {
+		for _, s := range held {
+			m.sessions.release(s)
+		}
+	}()
+
+	for range m.sessions.size() {
+		s, err := m.sessions.acquireContext(ctx)
+		if err != nil {
+			return err
+		}
+		held = append(held, s)
+		if err := s.run(*input, *output); err != nil {
+			return &InferenceError{Model: m.spec.Name, Err: err}
+		}
+	}
+	return nil
+}
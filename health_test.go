@@ -0,0 +1,47 @@
+package rmbg
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestWarmup(t *testing.T) {
+	t.Run("Canceled", func(t *testing.T) {
+		m := openModel(t)
+		r := &RemBG{model: m}
+		t.Cleanup(func() { _ = r.Close() })
+
+		// Every session is busy, so warm-up waits until ctx is done
+		s, _ := m.sessions.acquire()
+		defer m.sessions.release(s)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := r.Warmup(ctx); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		r := &RemBG{model: openModel(t)}
+		if err := r.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+		if err := r.Warmup(context.Background()); !errors.Is(err, ErrClosed) {
+			t.Errorf("expected ErrClosed, got %v", err)
+		}
+	})
+}
+
+func TestHealthy(t *testing.T) {
+	r := &RemBG{model: openModel(t)}
+	if err := r.Healthy(); err != nil && !errors.Is(err, ErrRuntimeUnavailable) {
+		t.Errorf("expected open engine to be healthy, got %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := r.Healthy(); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
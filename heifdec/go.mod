@@ -0,0 +1,16 @@
+module github.com/josuedeavila/rmbg/heifdec
+
+go 1.25
+
+require (
+	github.com/josuedeavila/rmbg v0.0.0-00010101000000-000000000000
+	github.com/strukturag/libheif v1.18.2
+)
+
+require (
+	github.com/disintegration/imaging v1.6.2 // indirect
+	github.com/yalue/onnxruntime_go v1.23.0 // indirect
+	golang.org/x/image v0.36.0 // indirect
+)
+
+replace github.com/josuedeavila/rmbg => ../
@@ -0,0 +1,89 @@
+//go:build heif
+
+// Package heifdec decodes HEIC and HEIF inputs, such as iPhone photos, with
+// libheif through github.com/strukturag/libheif/go/heif. Importing it
+// registers the decoder and adds *.heic and *.heif to rmbg.DefaultInclude. It
+// is a module of its own, so the core library does not depend on libheif, and
+// is only built with the heif tag and needs libheif and cgo:
+//
+//	go get github.com/josuedeavila/rmbg/heifdec
+//	go build -tags heif
+package heifdec
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+
+	"github.com/josuedeavila/rmbg"
+	"github.com/strukturag/libheif/go/heif"
+)
+
+var _ rmbg.Decoder = Decoder{}
+
+// brands are the ftyp major brands of HEIF still images
+var brands = []string{"heic", "heix", "hevc", "hevx", "heim", "heis", "mif1", "msf1"}
+
+func init() {
+	for _, brand := range brands {
+		rmbg.RegisterDecoder("heif", "????ftyp"+brand, Decoder{})
+	}
+	rmbg.DefaultInclude = append(rmbg.DefaultInclude, "*.heic", "*.heif")
+}
+
+// Decoder reads the primary image of a HEIF file
+type Decoder struct{}
+
+// DecodeConfig implements rmbg.Decoder. libheif needs the whole file, but
+// only parses its headers here.
+func (Decoder) DecodeConfig(r io.Reader) (image.Config, error) {
+	handle, err := primaryImage(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{
+		ColorModel: colorModel(handle),
+		Width:      handle.GetWidth(),
+		Height:     handle.GetHeight(),
+	}, nil
+}
+
+// Decode implements rmbg.Decoder
+func (Decoder) Decode(r io.Reader) (image.Image, error) {
+	handle, err := primaryImage(r)
+	if err != nil {
+		return nil, err
+	}
+	img, err := handle.DecodeImage(heif.ColorspaceUndefined, heif.ChromaUndefined, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode: %w", err)
+	}
+	return img.GetImage()
+}
+
+func primaryImage(r io.Reader) (*heif.ImageHandle, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	ctx, err := heif.NewContext()
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.ReadFromMemory(data); err != nil {
+		return nil, fmt.Errorf("failed to read: %w", err)
+	}
+	handle, err := ctx.GetPrimaryImageHandle()
+	if err != nil {
+		return nil, fmt.Errorf("no primary image: %w", err)
+	}
+	return handle, nil
+}
+
+func colorModel(handle *heif.ImageHandle) color.Model {
+	if handle.HasAlphaChannel() {
+		return color.NRGBAModel
+	}
+	return color.YCbCrModel
+}
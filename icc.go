@@ -0,0 +1,272 @@
+package rmbg
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// colorProfile is an RGB ICC profile of the matrix/TRC kind, as are sRGB,
+// Display P3, Adobe RGB and ProPhoto RGB. Profiles built on lookup tables are
+// not supported.
+type colorProfile struct {
+	// toXYZ maps linear RGB to the D50 XYZ connection space, row-major
+	toXYZ [9]float64
+	trc   [3]toneCurve
+}
+
+// toneCurve maps an encoded channel value in [0, 1] to its linear value,
+// either as a sampled table or as an ICC parametric function
+type toneCurve struct {
+	table []float64
+	// kind and params are the function type and its g, a, b, c, d, e, f
+	kind   int
+	params [7]float64
+}
+
+// srgbProfile is sRGB as adapted to D50 by its ICC profile
+var srgbProfile = colorProfile{
+	toXYZ: [9]float64{
+		0.4360747, 0.3850649, 0.1430804,
+		0.2225045, 0.7168786, 0.0606169,
+		0.0139322, 0.0971045, 0.7141733,
+	},
+	trc: [3]toneCurve{srgbCurve, srgbCurve, srgbCurve},
+}
+
+var srgbCurve = toneCurve{kind: 3, params: [7]float64{2.4, 1 / 1.055, 0.055 / 1.055, 1 / 12.92, 0.04045}}
+
+// parseICC reads a matrix/TRC RGB profile, reporting false for any other
+// profile or malformed data
+func parseICC(data []byte) (*colorProfile, bool) {
+	if len(data) < 132 || string(data[16:20]) != "RGB " || string(data[20:24]) != "XYZ " {
+		return nil, false
+	}
+	tags := make(map[string][]byte)
+	count := int(binary.BigEndian.Uint32(data[128:]))
+	for i := range count {
+		at := 132 + i*12
+		if at+12 > len(data) {
+			return nil, false
+		}
+		offset := int(binary.BigEndian.Uint32(data[at+4:]))
+		size := int(binary.BigEndian.Uint32(data[at+8:]))
+		if offset < 0 || size < 0 || offset+size > len(data) {
+			return nil, false
+		}
+		tags[string(data[at:at+4])] = data[offset : offset+size]
+	}
+
+	p := &colorProfile{}
+	for i, sig := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+		tag := tags[sig]
+		if len(tag) < 20 || string(tag[:4]) != "XYZ " {
+			return nil, false
+		}
+		for j := range 3 {
+			p.toXYZ[j*3+i] = s15Fixed16(tag[8+j*4:])
+		}
+	}
+	for i, sig := range []string{"rTRC", "gTRC", "bTRC"} {
+		curve, ok := parseCurve(tags[sig])
+		if !ok {
+			return nil, false
+		}
+		p.trc[i] = curve
+	}
+	return p, true
+}
+
+func parseCurve(tag []byte) (toneCurve, bool) {
+	if len(tag) < 12 {
+		return toneCurve{}, false
+	}
+	switch string(tag[:4]) {
+	case "curv":
+		n := int(binary.BigEndian.Uint32(tag[8:]))
+		switch {
+		case n == 0:
+			return toneCurve{params: [7]float64{1}}, true
+		case len(tag) < 12+n*2:
+			return toneCurve{}, false
+		case n == 1:
+			return toneCurve{params: [7]float64{float64(binary.BigEndian.Uint16(tag[12:])) / 256}}, true
+		}
+		table := make([]float64, n)
+		for i := range table {
+			table[i] = float64(binary.BigEndian.Uint16(tag[12+i*2:])) / 0xffff
+		}
+		return toneCurve{table: table}, true
+	case "para":
+		kind := int(binary.BigEndian.Uint16(tag[8:]))
+		if kind > 4 {
+			return toneCurve{}, false
+		}
+		n := [5]int{1, 3, 4, 5, 7}[kind]
+		if len(tag) < 12+n*4 {
+			return toneCurve{}, false
+		}
+		c := toneCurve{kind: kind}
+		for i := range n {
+			c.params[i] = s15Fixed16(tag[12+i*4:])
+		}
+		return c, true
+	}
+	return toneCurve{}, false
+}
+
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+// linear returns the linear value of the encoded value v
+func (c *toneCurve) linear(v float64) float64 {
+	if c.table != nil {
+		x := v * float64(len(c.table)-1)
+		i := min(int(x), len(c.table)-2)
+		return c.table[i] + (c.table[i+1]-c.table[i])*(x-float64(i))
+	}
+	g, a, b, cc, d, e, f := c.params[0], c.params[1], c.params[2], c.params[3], c.params[4], c.params[5], c.params[6]
+	switch c.kind {
+	case 1:
+		if v >= -b/a {
+			return math.Pow(a*v+b, g)
+		}
+		return 0
+	case 2:
+		if v >= -b/a {
+			return math.Pow(a*v+b, g) + cc
+		}
+		return cc
+	case 3:
+		if v >= d {
+			return math.Pow(a*v+b, g)
+		}
+		return cc * v
+	case 4:
+		if v >= d {
+			return math.Pow(a*v+b, g) + e
+		}
+		return cc*v + f
+	}
+	return math.Pow(v, g)
+}
+
+// encode inverts linear by bisection, as tables and some functions have no
+// closed-form inverse
+func (c *toneCurve) encode(l float64) float64 {
+	lo, hi := 0.0, 1.0
+	for range 32 {
+		mid := (lo + hi) / 2
+		if c.linear(mid) < l {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2
+}
+
+// isSRGB reports whether p describes sRGB, so converting would be a no-op
+func (p *colorProfile) isSRGB() bool {
+	for i, v := range p.toXYZ {
+		if math.Abs(v-srgbProfile.toXYZ[i]) > 0.002 {
+			return false
+		}
+	}
+	for i := range p.trc {
+		for _, v := range []float64{0.02, 0.2, 0.5, 0.8} {
+			if math.Abs(p.trc[i].linear(v)-srgbCurve.linear(v)) > 0.002 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// toSRGB returns img converted from p to 8-bit sRGB, clipping colors outside
+// the sRGB gamut, for the model's input
+func (p *colorProfile) toSRGB(img image.Image) *image.NRGBA {
+	m := mul3(invert3(srgbProfile.toXYZ), p.toXYZ)
+	var lin [3][256]float64
+	for c := range lin {
+		for i := range lin[c] {
+			lin[c][i] = p.trc[c].linear(float64(i) / 255)
+		}
+	}
+	// Linear values are quantized finely enough to keep dark tones distinct
+	var enc [4096]uint8
+	for i := range enc {
+		enc[i] = uint8(math.Round(srgbCurve.encode(float64(i)/4095) * 255))
+	}
+
+	b := img.Bounds()
+	dst := image.NewNRGBA(b)
+	draw.Draw(dst, b, img, b.Min, draw.Src)
+	parallelRows(b.Dy(), func(start, end int) {
+		for y := start; y < end; y++ {
+			row := dst.Pix[y*dst.Stride:][:b.Dx()*4]
+			for x := 0; x < len(row); x += 4 {
+				r, g, bl := lin[0][row[x]], lin[1][row[x+1]], lin[2][row[x+2]]
+				for c := range 3 {
+					v := m[c*3]*r + m[c*3+1]*g + m[c*3+2]*bl
+					row[x+c] = enc[int(math.Round(min(max(v, 0), 1)*4095))]
+				}
+			}
+		}
+	})
+	return dst
+}
+
+// fromSRGB converts an sRGB color to p, clipping it to p's gamut
+func (p *colorProfile) fromSRGB(c color.Color) color.Color {
+	if c == nil {
+		return nil
+	}
+	n := color.NRGBA64Model.Convert(c).(color.NRGBA64)
+	in := [3]float64{float64(n.R) / 0xffff, float64(n.G) / 0xffff, float64(n.B) / 0xffff}
+	for i := range in {
+		in[i] = srgbCurve.linear(in[i])
+	}
+	m := mul3(invert3(p.toXYZ), srgbProfile.toXYZ)
+	var out [3]uint16
+	for i := range out {
+		v := min(max(m[i*3]*in[0]+m[i*3+1]*in[1]+m[i*3+2]*in[2], 0), 1)
+		out[i] = uint16(math.Round(p.trc[i].encode(v) * 0xffff))
+	}
+	return color.NRGBA64{R: out[0], G: out[1], B: out[2], A: n.A}
+}
+
+// outputOptions returns opts with its background colors converted from sRGB
+// to p
+func (p *colorProfile) outputOptions(opts *IOOptions) *IOOptions {
+	converted := *opts
+	converted.Background = p.fromSRGB(opts.Background)
+	if opts.Crop != nil && opts.Crop.Background != nil {
+		crop := *opts.Crop
+		crop.Background = p.fromSRGB(crop.Background)
+		converted.Crop = &crop
+	}
+	return &converted
+}
+
+func mul3(a, b [9]float64) [9]float64 {
+	var m [9]float64
+	for i := range 3 {
+		for j := range 3 {
+			m[i*3+j] = a[i*3]*b[j] + a[i*3+1]*b[3+j] + a[i*3+2]*b[6+j]
+		}
+	}
+	return m
+}
+
+func invert3(m [9]float64) [9]float64 {
+	det := m[0]*(m[4]*m[8]-m[5]*m[7]) - m[1]*(m[3]*m[8]-m[5]*m[6]) + m[2]*(m[3]*m[7]-m[4]*m[6])
+	return [9]float64{
+		(m[4]*m[8] - m[5]*m[7]) / det, (m[2]*m[7] - m[1]*m[8]) / det, (m[1]*m[5] - m[2]*m[4]) / det,
+		(m[5]*m[6] - m[3]*m[8]) / det, (m[0]*m[8] - m[2]*m[6]) / det, (m[2]*m[3] - m[0]*m[5]) / det,
+		(m[3]*m[7] - m[4]*m[6]) / det, (m[1]*m[6] - m[0]*m[7]) / det, (m[0]*m[4] - m[1]*m[3]) / det,
+	}
+}
@@ -0,0 +1,234 @@
+package rmbg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"testing"
+)
+
+// adobeRGB are the D50 colorants of Adobe RGB (1998)
+var adobeRGB = [9]float64{
+	0.6097559, 0.2052401, 0.1492240,
+	0.3111145, 0.6256714, 0.0632141,
+	0.0194702, 0.0608902, 0.7445396,
+}
+
+// testProfile builds a matrix/TRC profile with the given colorants and a
+// shared tone curve tag
+func testProfile(toXYZ [9]float64, curve []byte) []byte {
+	var tags [][2]any
+	for i, sig := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+		tag := []byte("XYZ \x00\x00\x00\x00")
+		for j := range 3 {
+			tag = binary.BigEndian.AppendUint32(tag, uint32(int32(math.Round(toXYZ[j*3+i]*65536))))
+		}
+		tags = append(tags, [2]any{sig, tag})
+	}
+	for _, sig := range []string{"rTRC", "gTRC", "bTRC"} {
+		tags = append(tags, [2]any{sig, curve})
+	}
+
+	header := make([]byte, 128)
+	copy(header[16:], "RGB XYZ ")
+	table := binary.BigEndian.AppendUint32(nil, uint32(len(tags)))
+	var data []byte
+	offset := 128 + 4 + 12*len(tags)
+	for _, t := range tags {
+		tag := t[1].([]byte)
+		table = append(table, t[0].(string)...)
+		table = binary.BigEndian.AppendUint32(table, uint32(offset+len(data)))
+		table = binary.BigEndian.AppendUint32(table, uint32(len(tag)))
+		data = append(data, tag...)
+		data = append(data, make([]byte, len(data)%4)...)
+	}
+	return append(append(header, table...), data...)
+}
+
+// gammaCurve is a curv tag with a single gamma
+func gammaCurve(gamma float64) []byte {
+	return binary.BigEndian.AppendUint16([]byte("curv\x00\x00\x00\x00\x00\x00\x00\x01"), uint16(math.Round(gamma*256)))
+}
+
+// srgbParaCurve is the sRGB tone curve as a para tag
+func srgbParaCurve() []byte {
+	tag := []byte("para\x00\x00\x00\x00\x00\x03\x00\x00")
+	for _, v := range srgbCurve.params[:5] {
+		tag = binary.BigEndian.AppendUint32(tag, uint32(int32(math.Round(v*65536))))
+	}
+	return tag
+}
+
+func TestParseICC(t *testing.T) {
+	t.Run("AdobeRGB", func(t *testing.T) {
+		p, ok := parseICC(testProfile(adobeRGB, gammaCurve(2.2)))
+		if !ok {
+			t.Fatalf("expected profile to parse")
+		}
+		if p.isSRGB() {
+			t.Errorf("expected Adobe RGB not to be sRGB")
+		}
+		if got := p.trc[1].linear(0.5); math.Abs(got-math.Pow(0.5, 2.2)) > 0.001 {
+			t.Errorf("expected gamma 2.2, got %v at 0.5", got)
+		}
+	})
+
+	t.Run("SRGB", func(t *testing.T) {
+		p, ok := parseICC(testProfile(srgbProfile.toXYZ, srgbParaCurve()))
+		if !ok {
+			t.Fatalf("expected profile to parse")
+		}
+		if !p.isSRGB() {
+			t.Errorf("expected sRGB to be recognized")
+		}
+	})
+
+	t.Run("Table", func(t *testing.T) {
+		curve := binary.BigEndian.AppendUint32([]byte("curv\x00\x00\x00\x00"), 3)
+		for _, v := range []uint16{0, 0x4000, 0xffff} {
+			curve = binary.BigEndian.AppendUint16(curve, v)
+		}
+		p, ok := parseICC(testProfile(adobeRGB, curve))
+		if !ok {
+			t.Fatalf("expected profile to parse")
+		}
+		if got := p.trc[0].linear(0.25); math.Abs(got-0.125) > 0.001 {
+			t.Errorf("expected 0.125 at 0.25, got %v", got)
+		}
+		if got := p.trc[0].encode(0.125); math.Abs(got-0.25) > 0.001 {
+			t.Errorf("expected 0.25 for 0.125, got %v", got)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		profile := testProfile(adobeRGB, gammaCurve(2.2))
+		for name, data := range map[string][]byte{
+			"Empty":     nil,
+			"Truncated": profile[:len(profile)-10],
+			"CMYK":      append(append(append([]byte{}, profile[:16]...), "CMYK"...), profile[20:]...),
+		} {
+			if _, ok := parseICC(data); ok {
+				t.Errorf("expected %s profile to be rejected", name)
+			}
+		}
+	})
+}
+
+func TestColorConversion(t *testing.T) {
+	p, _ := parseICC(testProfile(adobeRGB, gammaCurve(2.2)))
+
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 1))
+	copy(img.Pix, []uint8{128, 128, 128, 255, 0, 255, 0, 255, 255, 255, 255, 255})
+	got := p.toSRGB(img)
+	// White and gray keep their neutral axis, Adobe green is outside sRGB
+	for x, want := range []color.NRGBA{{128, 128, 128, 255}, {0, 255, 0, 255}, {255, 255, 255, 255}} {
+		c := got.NRGBAAt(x, 0)
+		for i, v := range []uint8{c.R, c.G, c.B} {
+			w := []uint8{want.R, want.G, want.B}[i]
+			if d := int(v) - int(w); d < -3 || d > 3 {
+				t.Errorf("expected about %v at %d, got %v", want, x, c)
+				break
+			}
+		}
+	}
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		src := color.NRGBA{R: 200, G: 90, B: 30, A: 255}
+		adobe := color.NRGBAModel.Convert(p.fromSRGB(src)).(color.NRGBA)
+		if adobe == src {
+			t.Errorf("expected the color to change, got %v", adobe)
+		}
+		back := p.toSRGB(solidImage(1, 1, adobe)).NRGBAAt(0, 0)
+		if d := max(abs(int(back.R)-200), abs(int(back.G)-90), abs(int(back.B)-30)); d > 2 {
+			t.Errorf("expected %v back, got %v", src, back)
+		}
+		if p.fromSRGB(nil) != nil {
+			t.Errorf("expected nil to stay transparent")
+		}
+	})
+}
+
+func TestICCPassthrough(t *testing.T) {
+	profile := testProfile(adobeRGB, gammaCurve(2.2))
+	md := metadata{icc: iccSegments(profile)}
+
+	t.Run("PNG", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, gradientImage(8, 8)); err != nil {
+			t.Fatalf("failed to encode: %v", err)
+		}
+		data := writePNGMetadata(buf.Bytes(), md)
+		if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+			t.Fatalf("failed to decode: %v", err)
+		}
+		if got := iccProfile(readMetadata(data).icc); !bytes.Equal(got, profile) {
+			t.Errorf("expected %d byte profile, got %d bytes", len(profile), len(got))
+		}
+	})
+
+	t.Run("TIFF", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := EncodeTIFF(&buf, gradientImage(8, 8), nil); err != nil {
+			t.Fatalf("failed to encode: %v", err)
+		}
+		data := writeTIFFMetadata(buf.Bytes(), md)
+		img, err := DecodeImage(bytes.NewReader(data), nil)
+		if err != nil {
+			t.Fatalf("failed to decode: %v", err)
+		}
+		if got := img.(*image.NRGBA); !bytes.Equal(got.Pix, gradientImage(8, 8).Pix) {
+			t.Errorf("expected pixels unchanged")
+		}
+		if got := iccProfile(readMetadata(data).icc); !bytes.Equal(got, profile) {
+			t.Errorf("expected %d byte profile, got %d bytes", len(profile), len(got))
+		}
+		// Rewriting replaces the tag
+		again := writeTIFFMetadata(data, md)
+		if got := iccProfile(readMetadata(again).icc); !bytes.Equal(got, profile) {
+			t.Errorf("expected %d byte profile after rewrite, got %d bytes", len(profile), len(got))
+		}
+		if _, err := DecodeImage(bytes.NewReader(again), nil); err != nil {
+			t.Errorf("failed to decode rewritten TIFF: %v", err)
+		}
+	})
+
+	t.Run("RemoveBackgroundFrom", func(t *testing.T) {
+		src := solidImage(20, 10, color.NRGBA{R: 40, G: 200, B: 90, A: 255})
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, src); err != nil {
+			t.Fatalf("failed to encode: %v", err)
+		}
+		input := writePNGMetadata(buf.Bytes(), md)
+		p, _ := parseICC(profile)
+
+		// The engine only knows the mask of the converted image, so this
+		// fails unless the model sees sRGB
+		r := cachedEngine(p.toSRGB(src))
+		var out bytes.Buffer
+		if err := r.RemoveBackgroundFrom(bytes.NewReader(input), &out, FormatPNG, &IOOptions{ConvertColor: true}); err != nil {
+			t.Fatalf("RemoveBackgroundFrom failed: %v", err)
+		}
+		img, err := png.Decode(bytes.NewReader(out.Bytes()))
+		if err != nil {
+			t.Fatalf("expected PNG output, got %v", err)
+		}
+		if got := color.NRGBAModel.Convert(img.At(3, 3)); got != src.NRGBAAt(3, 3) {
+			t.Errorf("expected original color %v, got %v", src.NRGBAAt(3, 3), got)
+		}
+		if got := iccProfile(readMetadata(out.Bytes()).icc); !bytes.Equal(got, profile) {
+			t.Errorf("expected the profile to be kept")
+		}
+
+		out.Reset()
+		err = r.RemoveBackgroundFrom(bytes.NewReader(input), &out, FormatPNG, &IOOptions{ConvertColor: true, StripMetadata: true})
+		if err != nil {
+			t.Fatalf("RemoveBackgroundFrom failed: %v", err)
+		}
+		if md := readMetadata(out.Bytes()); md.icc != nil {
+			t.Errorf("expected no profile, got %d segments", len(md.icc))
+		}
+	})
+}
@@ -0,0 +1,185 @@
+package rmbg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// IDPhotoSpec describes the framing of a passport or ID photo
+type IDPhotoSpec struct {
+	// Name identifies the spec, e.g. "us-passport"
+	Name string
+	// Width and Height are the output size in pixels
+	Width, Height int
+	// HeadHeight is the distance from the top of the head to the chin as a fraction
+	// of the output height
+	HeadHeight float64
+	// TopMargin is the space above the head as a fraction of the output height
+	TopMargin float64
+	// Background is the solid color behind the subject (default: white)
+	Background color.Color
+}
+
+var (
+	// IDPhotoUS is the US passport and visa format: 2x2 in at 300 DPI, head 1-1 3/8 in
+	IDPhotoUS = IDPhotoSpec{
+		Name:       "us-passport",
+		Width:      600,
+		Height:     600,
+		HeadHeight: 0.6,
+		TopMargin:  0.1,
+		Background: color.White,
+	}
+	// IDPhotoSchengen is the ICAO format used across the EU: 35x45 mm at 300 DPI,
+	// head 32-36 mm
+	IDPhotoSchengen = IDPhotoSpec{
+		Name:       "schengen",
+		Width:      413,
+		Height:     531,
+		HeadHeight: 0.75,
+		TopMargin:  0.07,
+		Background: color.RGBA{R: 235, G: 235, B: 235, A: 255},
+	}
+	// IDPhotoUK is the UK passport format: 35x45 mm at 300 DPI, head 29-34 mm
+	IDPhotoUK = IDPhotoSpec{
+		Name:       "uk-passport",
+		Width:      413,
+		Height:     531,
+		HeadHeight: 0.7,
+		TopMargin:  0.08,
+		Background: color.RGBA{R: 235, G: 235, B: 235, A: 255},
+	}
+)
+
+// idPhotoThreshold is the mask value above which a pixel belongs to the subject
+const idPhotoThreshold = 128
+
+// IDPhoto removes the background and frames the subject's head and shoulders
+// according to spec (default: IDPhotoUS), on a solid background
+func (r *RemBG) IDPhoto(img image.Image, spec *IDPhotoSpec) (image.Image, error) {
+	if spec == nil {
+		spec = &IDPhotoUS
+	}
+	if spec.Width <= 0 || spec.Height <= 0 {
+		return nil, fmt.Errorf("invalid ID photo size %dx%d", spec.Width, spec.Height)
+	}
+	if spec.HeadHeight <= 0 || spec.HeadHeight+spec.TopMargin >= 1 {
+		return nil, fmt.Errorf("invalid ID photo head height %.2f with top margin %.2f", spec.HeadHeight, spec.TopMargin)
+	}
+
+	res, pred, err := r.process(img)
+	if err != nil {
+		return nil, err
+	}
+
+	rect, err := idPhotoRegion(img.Bounds(), pred.mask, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	bg := spec.Background
+	if bg == nil {
+		bg = color.White
+	}
+	bounds := img.Bounds()
+	flat := imaging.New(bounds.Dx(), bounds.Dy(), bg)
+	flat = imaging.Overlay(flat, res.Image, image.Point{}, 1)
+	res.Release()
+
+	out := cropPadded(flat, rect.Sub(bounds.Min), bg)
+	return imaging.Resize(out, spec.Width, spec.Height, imaging.Lanczos), nil
+}
+
+// idPhotoRegion computes the crop rectangle, in image coordinates, that places
+// the detected head according to spec
+func idPhotoRegion(bounds image.Rectangle, mask *image.Gray, spec *IDPhotoSpec) (image.Rectangle, error) {
+	head, ok := detectHead(mask, idPhotoThreshold)
+	if !ok {
+		return image.Rectangle{}, ErrNoObjectDetected
+	}
+
+	maskB := mask.Bounds()
+	sx := float64(bounds.Dx()) / float64(maskB.Dx())
+	sy := float64(bounds.Dy()) / float64(maskB.Dy())
+	top := float64(head.Min.Y-maskB.Min.Y) * sy
+	chin := float64(head.Max.Y-maskB.Min.Y) * sy
+	cx := float64(head.Min.X+head.Max.X-2*maskB.Min.X) / 2 * sx
+
+	cropH := (chin - top) / spec.HeadHeight
+	cropW := cropH * float64(spec.Width) / float64(spec.Height)
+	minX := int(math.Round(cx - cropW/2))
+	minY := int(math.Round(top - spec.TopMargin*cropH))
+	rect := image.Rect(minX, minY, minX+int(math.Round(cropW)), minY+int(math.Round(cropH)))
+	return rect.Add(bounds.Min), nil
+}
+
+// detectHead estimates the head box of a head-and-shoulders mask from its row
+// widths: the head widens from the crown, narrows at the neck and the shoulders
+// widen again below it. The box spans from the crown to the neck.
+func detectHead(mask *image.Gray, threshold uint8) (image.Rectangle, bool) {
+	b := mask.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	type span struct{ lo, hi int }
+	rows := make([]span, h)
+	top := -1
+	for y := range h {
+		line := mask.Pix[y*mask.Stride : y*mask.Stride+w]
+		lo, hi := -1, -1
+		for x, v := range line {
+			if v >= threshold {
+				if lo < 0 {
+					lo = x
+				}
+				hi = x + 1
+			}
+		}
+		rows[y] = span{lo, hi}
+		if lo >= 0 && top < 0 {
+			top = y
+		}
+	}
+	if top < 0 {
+		return image.Rectangle{}, false
+	}
+	width := func(y int) int { return rows[y].hi - rows[y].lo }
+
+	// Follow the head down to its widest row until the rows narrow into the
+	// neck, then find the narrowest row before the shoulders widen past the head
+	widest, y := top, top
+	for ; y < h && rows[y].lo >= 0; y++ {
+		if width(y) < width(widest)*9/10 {
+			break
+		}
+		if width(y) > width(widest) {
+			widest = y
+		}
+	}
+	neck := -1
+	for ; y < h && rows[y].lo >= 0; y++ {
+		if width(y) > width(widest) {
+			break
+		}
+		if neck < 0 || width(y) < width(neck) {
+			neck = y
+		}
+	}
+
+	if neck < 0 {
+		// No visible neck; assume the head is the upper part of the silhouette
+		neck = top + max(1, (y-top)*2/5)
+	}
+
+	minX, maxX := w, 0
+	for y := top; y < neck; y++ {
+		if rows[y].lo >= 0 {
+			minX = min(minX, rows[y].lo)
+			maxX = max(maxX, rows[y].hi)
+		}
+	}
+	return image.Rect(minX, top, maxX, neck).Add(b.Min), true
+}
@@ -0,0 +1,73 @@
+package rmbg
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+// portraitMask draws a head, neck and shoulders silhouette on a 200x200 mask
+func portraitMask() *image.Gray {
+	mask := image.NewGray(image.Rect(0, 0, 200, 200))
+	fillRect(mask, image.Rect(80, 20, 120, 70), 255)  // head
+	fillRect(mask, image.Rect(90, 70, 110, 85), 255)  // neck
+	fillRect(mask, image.Rect(40, 85, 160, 200), 255) // shoulders
+	return mask
+}
+
+func TestDetectHead(t *testing.T) {
+	t.Run("Neck", func(t *testing.T) {
+		head, ok := detectHead(portraitMask(), 128)
+		if !ok {
+			t.Fatal("expected head to be detected")
+		}
+		want := image.Rect(80, 20, 120, 70)
+		if head != want {
+			t.Errorf("expected head %v, got %v", want, head)
+		}
+	})
+
+	t.Run("NoNeck", func(t *testing.T) {
+		mask := image.NewGray(image.Rect(0, 0, 100, 100))
+		fillRect(mask, image.Rect(20, 0, 80, 100), 255)
+		head, ok := detectHead(mask, 128)
+		if !ok {
+			t.Fatal("expected head to be detected")
+		}
+		if head.Min.Y != 0 || head.Max.Y != 40 {
+			t.Errorf("expected head rows [0, 40), got [%d, %d)", head.Min.Y, head.Max.Y)
+		}
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		if _, ok := detectHead(image.NewGray(image.Rect(0, 0, 10, 10)), 128); ok {
+			t.Error("expected no head in empty mask")
+		}
+	})
+}
+
+func TestIDPhotoRegion(t *testing.T) {
+	// The image is twice the mask resolution
+	bounds := image.Rect(0, 0, 400, 400)
+	spec := IDPhotoSchengen
+
+	rect, err := idPhotoRegion(bounds, portraitMask(), &spec)
+	if err != nil {
+		t.Fatalf("idPhotoRegion failed: %v", err)
+	}
+
+	ratio := float64(rect.Dx()) / float64(rect.Dy())
+	if want := float64(spec.Width) / float64(spec.Height); math.Abs(ratio-want) > 0.01 {
+		t.Errorf("expected aspect ratio %.3f, got %.3f", want, ratio)
+	}
+	headH := float64(2 * (70 - 20))
+	if got := headH / float64(rect.Dy()); math.Abs(got-spec.HeadHeight) > 0.01 {
+		t.Errorf("expected head height %.2f, got %.2f", spec.HeadHeight, got)
+	}
+	if got := float64(40-rect.Min.Y) / float64(rect.Dy()); math.Abs(got-spec.TopMargin) > 0.01 {
+		t.Errorf("expected top margin %.2f, got %.2f", spec.TopMargin, got)
+	}
+	if cx := (rect.Min.X + rect.Max.X) / 2; cx < 199 || cx > 201 {
+		t.Errorf("expected crop centered on x=200, got %d", cx)
+	}
+}
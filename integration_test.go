@@ -1,8 +1,10 @@
 package rmbg
 
 import (
+	"bytes"
 	"image"
 	"image/color"
+	"image/png"
 	"os"
 	"path/filepath"
 	"testing"
@@ -66,4 +68,44 @@ func TestRemBG_Integration(t *testing.T) {
 			t.Error("Expected cropped image, got nil")
 		}
 	})
+
+	t.Run("RemoveAndCrop", func(t *testing.T) {
+		res, err := remover.RemoveAndCrop(img, &CropConfig{
+			Margin:       5,
+			MinThreshold: 10,
+		})
+		if err != nil {
+			t.Fatalf("RemoveAndCrop failed: %v", err)
+		}
+		if res.Image == nil || res.Cropped == nil || res.Bounds == nil || res.Object == nil {
+			t.Errorf("Expected image, crop, bounds and object info, got %+v", res)
+		}
+	})
+
+	t.Run("ProcessROI", func(t *testing.T) {
+		res, err := remover.ProcessROI(img, image.Rect(20, 20, 80, 80))
+		if err != nil {
+			t.Fatalf("ProcessROI failed: %v", err)
+		}
+		if res.Image.Bounds() != img.Bounds() || res.Mask.Bounds().Size() != img.Bounds().Size() {
+			t.Errorf("Expected full-size outputs, got image %v and mask %v", res.Image.Bounds(), res.Mask.Bounds())
+		}
+		if res.Mask.GrayAt(5, 5).Y != 0 {
+			t.Errorf("Expected background outside the region, got %d", res.Mask.GrayAt(5, 5).Y)
+		}
+	})
+
+	t.Run("ProcessReader", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatalf("Failed to encode image: %v", err)
+		}
+		res, err := remover.ProcessReader(&buf, &DecodeOptions{MaxSide: 50})
+		if err != nil {
+			t.Fatalf("ProcessReader failed: %v", err)
+		}
+		if got := res.Image.Bounds().Size(); max(got.X, got.Y) != 50 {
+			t.Errorf("Expected output downsampled to 50px, got %v", got)
+		}
+	})
 }
@@ -0,0 +1,299 @@
+// Package jobs processes images asynchronously: Submit queues an image and
+// returns a job ID, workers run the queued jobs through an engine and the
+// result is fetched later by ID. Useful for bulk processing where a
+// synchronous call would time out.
+//
+// Queue and Store are interfaces so jobs can live in an external system such
+// as Redis or SQS; Memory implements both in process.
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/josuedeavila/rmbg"
+)
+
+var (
+	// ErrNotFound is returned for unknown job IDs
+	ErrNotFound = errors.New("job not found")
+	// ErrQueueClosed is returned by Queue.Pop once the queue is closed
+	ErrQueueClosed = errors.New("queue closed")
+)
+
+// Status is the state of a job
+type Status string
+
+const (
+	StatusQueued  Status = "queued"
+	StatusRunning Status = "running"
+	StatusDone    Status = "done"
+	StatusFailed  Status = "failed"
+)
+
+// Job is a queued image and, once processed, its result
+type Job struct {
+	ID     string
+	Status Status
+	// Input is the encoded image; it is dropped once the job has run
+	Input []byte
+	// Format and Options are passed to Engine.RemoveBackgroundFrom
+	Format  rmbg.Format
+	Options *rmbg.IOOptions
+	// Result is the encoded output of a done job
+	Result []byte
+	// Error is the failure of a failed job
+	Error string
+
+	Created, Started, Finished time.Time
+}
+
+// Engine processes one job; *rmbg.RemBG implements it
+type Engine interface {
+	RemoveBackgroundFrom(rd io.Reader, w io.Writer, format rmbg.Format, opts *rmbg.IOOptions) error
+}
+
+// Queue hands job IDs to workers
+type Queue interface {
+	// Push queues id
+	Push(ctx context.Context, id string) error
+	// Pop blocks until an ID is available, ctx is done or the queue is
+	// closed (ErrQueueClosed)
+	Pop(ctx context.Context) (string, error)
+}
+
+// Store keeps jobs by ID
+type Store interface {
+	// Put creates or replaces a job
+	Put(ctx context.Context, job *Job) error
+	// Get returns the job with id, or ErrNotFound
+	Get(ctx context.Context, id string) (*Job, error)
+	// Delete removes a job; unknown IDs are not an error
+	Delete(ctx context.Context, id string) error
+}
+
+// Config configures a Manager
+type Config struct {
+	// Workers is the number of jobs processed at once (default: number of CPUs)
+	Workers int
+	// Queue and Store hold the jobs (default: one shared Memory)
+	Queue Queue
+	Store Store
+	// Logger receives queue and store failures that workers retry past
+	// (default: no logging)
+	Logger *slog.Logger
+}
+
+// Manager submits jobs and runs them
+type Manager struct {
+	engine  Engine
+	workers int
+	queue   Queue
+	store   Store
+	logger  *slog.Logger
+}
+
+const (
+	// storeAttempts bounds how often a worker retries one store call
+	storeAttempts = 5
+	// retryBackoff is the first pause between retries; it doubles up to
+	// maxRetryBackoff
+	retryBackoff    = 10 * time.Millisecond
+	maxRetryBackoff = 5 * time.Second
+)
+
+// New creates a manager for engine. Jobs are queued right away but only
+// processed while Run is active.
+func New(engine Engine, config *Config) *Manager {
+	if config == nil {
+		config = &Config{}
+	}
+	m := &Manager{engine: engine, workers: config.Workers, queue: config.Queue, store: config.Store, logger: config.Logger}
+	if m.workers <= 0 {
+		m.workers = runtime.NumCPU()
+	}
+	if m.queue == nil || m.store == nil {
+		mem := NewMemory(0)
+		if m.queue == nil {
+			m.queue = mem
+		}
+		if m.store == nil {
+			m.store = mem
+		}
+	}
+	return m
+}
+
+// Submit queues input, an encoded image, and returns the job ID
+func (m *Manager) Submit(ctx context.Context, input []byte, format rmbg.Format, opts *rmbg.IOOptions) (string, error) {
+	id, err := newID()
+	if err != nil {
+		return "", err
+	}
+	job := &Job{
+		ID:      id,
+		Status:  StatusQueued,
+		Input:   input,
+		Format:  format,
+		Options: opts,
+		Created: time.Now(),
+	}
+	if err := m.store.Put(ctx, job); err != nil {
+		return "", fmt.Errorf("failed to store job: %w", err)
+	}
+	if err := m.queue.Push(ctx, id); err != nil {
+		_ = m.store.Delete(ctx, id)
+		return "", fmt.Errorf("failed to queue job: %w", err)
+	}
+	return id, nil
+}
+
+// Get returns the job with id
+func (m *Manager) Get(ctx context.Context, id string) (*Job, error) {
+	return m.store.Get(ctx, id)
+}
+
+// Delete removes a job, e.g. once its result has been fetched
+func (m *Manager) Delete(ctx context.Context, id string) error {
+	return m.store.Delete(ctx, id)
+}
+
+// Run processes queued jobs until ctx is canceled or the queue is closed.
+// Jobs already running are finished before Run returns; a job popped as ctx
+// is canceled is queued again for the next Run.
+func (m *Manager) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	errs := make([]error, m.workers)
+	for i := range m.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = m.work(ctx)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// work pops and runs jobs until the queue stops. Queue and store failures
+// are logged and retried so one bad call does not stop the worker.
+func (m *Manager) work(ctx context.Context) error {
+	backoff := retryBackoff
+	for {
+		id, err := m.queue.Pop(ctx)
+		if err != nil {
+			if errors.Is(err, ErrQueueClosed) || ctx.Err() != nil {
+				return nil
+			}
+			m.log(ctx, "failed to pop job", slog.Any("error", err))
+			if !sleep(ctx, backoff) {
+				return nil
+			}
+			backoff = min(2*backoff, maxRetryBackoff)
+			continue
+		}
+		backoff = retryBackoff
+		if ctx.Err() != nil {
+			// Popped as Run was stopping: hand the job to the next Run, or
+			// finish it here if the queue no longer takes it
+			if err := m.queue.Push(context.WithoutCancel(ctx), id); err == nil {
+				return nil
+			}
+		}
+		if err := m.runJob(context.WithoutCancel(ctx), id); err != nil {
+			m.log(ctx, "failed to run job", slog.String("id", id), slog.Any("error", err))
+		}
+	}
+}
+
+// runJob processes one job; only storage failures are returned, processing
+// failures are recorded on the job. Store calls are retried, and a job whose
+// result cannot be stored is left in its last stored state.
+func (m *Manager) runJob(ctx context.Context, id string) error {
+	var job *Job
+	err := m.retry(ctx, id, func() (err error) {
+		job, err = m.store.Get(ctx, id)
+		return err
+	})
+	if errors.Is(err, ErrNotFound) {
+		// Deleted while queued
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load job %s: %w", id, err)
+	}
+
+	job.Status = StatusRunning
+	job.Started = time.Now()
+	if err := m.retry(ctx, id, func() error { return m.store.Put(ctx, job) }); err != nil {
+		return fmt.Errorf("failed to store job %s: %w", id, err)
+	}
+
+	var out bytes.Buffer
+	if err := m.engine.RemoveBackgroundFrom(bytes.NewReader(job.Input), &out, job.Format, job.Options); err != nil {
+		job.Status = StatusFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = StatusDone
+		job.Result = out.Bytes()
+	}
+	job.Input = nil
+	job.Finished = time.Now()
+	if err := m.retry(ctx, id, func() error { return m.store.Put(ctx, job) }); err != nil {
+		return fmt.Errorf("failed to store job %s: %w", id, err)
+	}
+	return nil
+}
+
+// retry calls fn up to storeAttempts times with a doubling pause in between.
+// ErrNotFound is final and returned right away.
+func (m *Manager) retry(ctx context.Context, id string, fn func() error) error {
+	backoff := retryBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || errors.Is(err, ErrNotFound) || attempt == storeAttempts {
+			return err
+		}
+		m.log(ctx, "job store failed, retrying", slog.String("id", id), slog.Int("attempt", attempt), slog.Any("error", err))
+		sleep(ctx, backoff)
+		backoff = min(2*backoff, maxRetryBackoff)
+	}
+}
+
+// log emits a warning on the configured logger
+func (m *Manager) log(ctx context.Context, msg string, attrs ...slog.Attr) {
+	if m.logger == nil {
+		return
+	}
+	m.logger.LogAttrs(ctx, slog.LevelWarn, msg, attrs...)
+}
+
+// sleep pauses for d and reports whether ctx is still active
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// newID returns a random job ID
+func newID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate job ID: %w", err)
+	}
+	return hex.EncodeToString(b[:]), nil
+}
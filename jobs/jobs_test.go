@@ -0,0 +1,275 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/josuedeavila/rmbg"
+)
+
+var _ Engine = (*rmbg.RemBG)(nil)
+
+// fakeEngine echoes the input with an "out:" prefix, or fails on "bad"
+type fakeEngine struct {
+	calls atomic.Int32
+}
+
+func (e *fakeEngine) RemoveBackgroundFrom(rd io.Reader, w io.Writer, _ rmbg.Format, _ *rmbg.IOOptions) error {
+	e.calls.Add(1)
+	b, err := io.ReadAll(rd)
+	if err != nil {
+		return err
+	}
+	if string(b) == "bad" {
+		return rmbg.ErrInvalidImage
+	}
+	_, err = w.Write(append([]byte("out:"), b...))
+	return err
+}
+
+// cancelQueue cancels Run right after handing out an ID, as if shutdown
+// raced the pop
+type cancelQueue struct {
+	*Memory
+	cancel context.CancelFunc
+}
+
+func (q *cancelQueue) Pop(ctx context.Context) (string, error) {
+	id, err := q.Memory.Pop(ctx)
+	q.cancel()
+	return id, err
+}
+
+// flakyStore fails the next failPuts calls to Put
+type flakyStore struct {
+	*Memory
+	failPuts atomic.Int32
+}
+
+func (s *flakyStore) Put(ctx context.Context, job *Job) error {
+	if s.failPuts.Add(-1) >= 0 {
+		return errors.New("store unavailable")
+	}
+	return s.Memory.Put(ctx, job)
+}
+
+// wait polls the job until it leaves the queued and running states
+func wait(t *testing.T, m *Manager, id string) *Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := m.Get(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status == StatusDone || job.Status == StatusFailed {
+			return job
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return nil
+}
+
+func TestManager(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Lifecycle", func(t *testing.T) {
+		engine := &fakeEngine{}
+		m := New(engine, &Config{Workers: 2})
+
+		ok, err := m.Submit(ctx, []byte("img"), rmbg.FormatPNG, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bad, err := m.Submit(ctx, []byte("bad"), rmbg.FormatPNG, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok == bad {
+			t.Fatalf("expected distinct IDs, got %s twice", ok)
+		}
+
+		job, err := m.Get(ctx, ok)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status != StatusQueued {
+			t.Errorf("expected queued before Run, got %s", job.Status)
+		}
+
+		runCtx, cancel := context.WithCancel(ctx)
+		done := make(chan error)
+		go func() { done <- m.Run(runCtx) }()
+
+		job = wait(t, m, ok)
+		if job.Status != StatusDone || string(job.Result) != "out:img" {
+			t.Errorf("expected done with out:img, got %s with %q", job.Status, job.Result)
+		}
+		if job.Input != nil {
+			t.Error("expected input to be dropped after processing")
+		}
+		if job.Started.IsZero() || job.Finished.Before(job.Started) {
+			t.Errorf("unexpected timestamps %v, %v", job.Started, job.Finished)
+		}
+
+		job = wait(t, m, bad)
+		if job.Status != StatusFailed || job.Error != rmbg.ErrInvalidImage.Error() {
+			t.Errorf("expected failed with %q, got %s with %q", rmbg.ErrInvalidImage, job.Status, job.Error)
+		}
+
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("expected nil from Run, got %v", err)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		m := New(&fakeEngine{}, nil)
+		if _, err := m.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("DeletedWhileQueued", func(t *testing.T) {
+		engine := &fakeEngine{}
+		mem := NewMemory(0)
+		m := New(engine, &Config{Workers: 1, Queue: mem, Store: mem})
+		id, err := m.Submit(ctx, []byte("img"), rmbg.FormatPNG, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Delete(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+		mem.Close()
+		if err := m.Run(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if n := engine.calls.Load(); n != 0 {
+			t.Errorf("expected deleted job to be skipped, got %d calls", n)
+		}
+	})
+
+	t.Run("DrainOnClose", func(t *testing.T) {
+		engine := &fakeEngine{}
+		mem := NewMemory(0)
+		m := New(engine, &Config{Workers: 3, Queue: mem, Store: mem})
+		var ids []string
+		for range 10 {
+			id, err := m.Submit(ctx, []byte("img"), rmbg.FormatPNG, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+		mem.Close()
+		if _, err := m.Submit(ctx, []byte("img"), rmbg.FormatPNG, nil); !errors.Is(err, ErrQueueClosed) {
+			t.Errorf("expected ErrQueueClosed after Close, got %v", err)
+		}
+		if err := m.Run(ctx); err != nil {
+			t.Fatal(err)
+		}
+		for _, id := range ids {
+			if job, _ := m.Get(ctx, id); job.Status != StatusDone {
+				t.Errorf("expected %s done, got %s", id, job.Status)
+			}
+		}
+	})
+
+	t.Run("CancelAfterPop", func(t *testing.T) {
+		engine := &fakeEngine{}
+		mem := NewMemory(0)
+		runCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		m := New(engine, &Config{Workers: 1, Queue: &cancelQueue{Memory: mem, cancel: cancel}, Store: mem})
+		id, err := m.Submit(ctx, []byte("img"), rmbg.FormatPNG, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Run(runCtx); err != nil {
+			t.Fatal(err)
+		}
+		if mem.Len() != 1 {
+			t.Fatalf("expected the popped job to be queued again, got length %d", mem.Len())
+		}
+		if job, _ := m.Get(ctx, id); job.Status != StatusQueued {
+			t.Errorf("expected queued, got %s", job.Status)
+		}
+
+		mem.Close()
+		if err := New(engine, &Config{Workers: 1, Queue: mem, Store: mem}).Run(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if job, _ := m.Get(ctx, id); job.Status != StatusDone {
+			t.Errorf("expected done on the next Run, got %s", job.Status)
+		}
+	})
+
+	t.Run("StoreFailsOnce", func(t *testing.T) {
+		engine := &fakeEngine{}
+		mem := NewMemory(0)
+		store := &flakyStore{Memory: mem}
+		m := New(engine, &Config{Workers: 1, Queue: mem, Store: store})
+		var ids []string
+		for range 2 {
+			id, err := m.Submit(ctx, []byte("img"), rmbg.FormatPNG, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+		store.failPuts.Store(1)
+		mem.Close()
+		if err := m.Run(ctx); err != nil {
+			t.Fatal(err)
+		}
+		for _, id := range ids {
+			if job, _ := m.Get(ctx, id); job.Status != StatusDone {
+				t.Errorf("expected %s done, got %s", id, job.Status)
+			}
+		}
+		if n := engine.calls.Load(); n != 2 {
+			t.Errorf("expected 2 engine calls, got %d", n)
+		}
+	})
+}
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Full", func(t *testing.T) {
+		mem := NewMemory(1)
+		if err := mem.Push(ctx, "a"); err != nil {
+			t.Fatal(err)
+		}
+		timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		if err := mem.Push(timeout, "b"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected DeadlineExceeded on a full queue, got %v", err)
+		}
+		if mem.Len() != 1 {
+			t.Errorf("expected length 1, got %d", mem.Len())
+		}
+	})
+
+	t.Run("Copies", func(t *testing.T) {
+		mem := NewMemory(0)
+		job := &Job{ID: "a", Status: StatusQueued}
+		if err := mem.Put(ctx, job); err != nil {
+			t.Fatal(err)
+		}
+		job.Status = StatusDone
+		got, err := mem.Get(ctx, "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != StatusQueued {
+			t.Errorf("expected stored copy to stay queued, got %s", got.Status)
+		}
+	})
+}
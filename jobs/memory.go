@@ -0,0 +1,113 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultMemoryCapacity is the queue capacity of NewMemory(0)
+const DefaultMemoryCapacity = 1024
+
+// Memory is an in-process Queue and Store. Jobs are lost when the process
+// exits.
+type Memory struct {
+	ids       chan string
+	closeOnce sync.Once
+	closed    chan struct{}
+
+	mu   sync.RWMutex
+	jobs map[string]*Job
+}
+
+// NewMemory creates a memory queue holding up to capacity queued IDs; Push
+// blocks while it is full (default: DefaultMemoryCapacity)
+func NewMemory(capacity int) *Memory {
+	if capacity <= 0 {
+		capacity = DefaultMemoryCapacity
+	}
+	return &Memory{
+		ids:    make(chan string, capacity),
+		closed: make(chan struct{}),
+		jobs:   make(map[string]*Job),
+	}
+}
+
+// Push implements Queue
+func (q *Memory) Push(ctx context.Context, id string) error {
+	select {
+	case <-q.closed:
+		return ErrQueueClosed
+	default:
+	}
+	select {
+	case q.ids <- id:
+		return nil
+	case <-q.closed:
+		return ErrQueueClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pop implements Queue. IDs still queued after Close are returned before
+// ErrQueueClosed.
+func (q *Memory) Pop(ctx context.Context) (string, error) {
+	select {
+	case id := <-q.ids:
+		return id, nil
+	default:
+	}
+	select {
+	case id := <-q.ids:
+		return id, nil
+	case <-q.closed:
+		select {
+		case id := <-q.ids:
+			return id, nil
+		default:
+			return "", ErrQueueClosed
+		}
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Close stops the queue: Push fails and Pop returns ErrQueueClosed once the
+// remaining IDs are drained
+func (q *Memory) Close() {
+	q.closeOnce.Do(func() { close(q.closed) })
+}
+
+// Len returns the number of queued IDs
+func (q *Memory) Len() int {
+	return len(q.ids)
+}
+
+// Put implements Store; the job is copied
+func (q *Memory) Put(_ context.Context, job *Job) error {
+	c := *job
+	q.mu.Lock()
+	q.jobs[job.ID] = &c
+	q.mu.Unlock()
+	return nil
+}
+
+// Get implements Store; the returned job is a copy
+func (q *Memory) Get(_ context.Context, id string) (*Job, error) {
+	q.mu.RLock()
+	job, ok := q.jobs[id]
+	q.mu.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c := *job
+	return &c, nil
+}
+
+// Delete implements Store
+func (q *Memory) Delete(_ context.Context, id string) error {
+	q.mu.Lock()
+	delete(q.jobs, id)
+	q.mu.Unlock()
+	return nil
+}
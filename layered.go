@@ -0,0 +1,314 @@
+package rmbg
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// psdMaxSide is the largest width or height of a version 1 PSD
+const psdMaxSide = 30000
+
+// oraThumbnailSide bounds the thumbnail OpenRaster files carry
+const oraThumbnailSide = 256
+
+// Layer names in layered outputs
+const (
+	layerOriginal = "Original"
+	layerCutout   = "Cut-out"
+	layerMask     = "Mask"
+)
+
+// psdAlphaNames is the PSD image resource naming alpha channels
+const psdAlphaNames = 0x03ee
+
+// isLayered reports whether format keeps the original, the cut-out and the
+// mask apart rather than a single composited image
+func isLayered(format Format) bool {
+	return format == FormatPSD || format == FormatORA
+}
+
+// encodeLayered writes img and mask to w as the layered format
+func encodeLayered(w io.Writer, img image.Image, mask *image.Gray, format Format) error {
+	if format == FormatORA {
+		return EncodeOpenRaster(w, img, mask)
+	}
+	return EncodePSD(w, img, mask)
+}
+
+// EncodePSD writes img to w as a Photoshop document with two layers: the
+// original image, hidden, and above it the cut-out, whose transparency is
+// mask. mask is also saved as an alpha channel named "Mask", which loads as a
+// selection. Channels have 8 bits and are PackBits-compressed; images wider or
+// taller than 30000 pixels are rejected.
+func EncodePSD(w io.Writer, img image.Image, mask *image.Gray) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width > psdMaxSide || height > psdMaxSide {
+		return fmt.Errorf("psd: %dx%d image exceeds %d pixels per side", width, height, psdMaxSide)
+	}
+	if mask.Bounds().Size() != b.Size() {
+		return fmt.Errorf("psd: %v mask for a %v image", mask.Bounds().Size(), b.Size())
+	}
+
+	orig := image.NewNRGBA(b)
+	draw.Draw(orig, b, img, b.Min, draw.Src)
+	cut := cutout(img, mask)
+	flat := composite(img, mask, color.White)
+	alpha := grayPlane(mask)
+
+	out := []byte("8BPS")
+	out = binary.BigEndian.AppendUint16(out, 1)
+	out = append(out, 0, 0, 0, 0, 0, 0)
+	out = binary.BigEndian.AppendUint16(out, 4) // RGB and the mask channel
+	out = binary.BigEndian.AppendUint32(out, uint32(height))
+	out = binary.BigEndian.AppendUint32(out, uint32(width))
+	out = binary.BigEndian.AppendUint16(out, 8)
+	out = binary.BigEndian.AppendUint16(out, 3) // RGB color mode
+	out = binary.BigEndian.AppendUint32(out, 0) // no color mode data
+
+	names := append([]byte{byte(len(layerMask))}, layerMask...)
+	resources := []byte("8BIM")
+	resources = binary.BigEndian.AppendUint16(resources, psdAlphaNames)
+	resources = append(resources, 0, 0) // empty resource name, padded
+	resources = binary.BigEndian.AppendUint32(resources, uint32(len(names)))
+	resources = append(resources, names...)
+	if len(names)%2 == 1 {
+		resources = append(resources, 0)
+	}
+	out = binary.BigEndian.AppendUint32(out, uint32(len(resources)))
+	out = append(out, resources...)
+
+	layers := []psdLayer{
+		{name: layerOriginal, hidden: true, planes: rgbaPlanes(orig.Pix, orig.Stride, width, height)},
+		{name: layerCutout, planes: rgbaPlanes(cut.Pix, cut.Stride, width, height)},
+	}
+	info := binary.BigEndian.AppendUint16(nil, uint16(len(layers)))
+	var data []byte
+	for _, l := range layers {
+		info, data = l.append(info, data, width, height)
+	}
+	info = append(info, data...)
+	if len(info)%2 == 1 {
+		info = append(info, 0)
+	}
+	out = binary.BigEndian.AppendUint32(out, uint32(len(info)+8))
+	out = binary.BigEndian.AppendUint32(out, uint32(len(info)))
+	out = append(out, info...)
+	out = binary.BigEndian.AppendUint32(out, 0) // no global layer mask
+
+	// The merged image, as flattened over white, and the mask channel
+	planes := rgbaPlanes(flat.Pix, flat.Stride, width, height)
+	out = binary.BigEndian.AppendUint16(out, 1)
+	var counts, packed []byte
+	for _, p := range [][]byte{planes[0], planes[1], planes[2], alpha} {
+		c, d := packPlane(p, width, height)
+		counts = append(counts, c...)
+		packed = append(packed, d...)
+	}
+	out = append(out, counts...)
+	out = append(out, packed...)
+
+	_, err := w.Write(out)
+	return err
+}
+
+// psdLayer is a full-canvas PSD layer with its red, green, blue and
+// transparency planes
+type psdLayer struct {
+	name   string
+	hidden bool
+	planes [4][]byte
+}
+
+// append appends the layer record to info and its channel image data to data
+func (l psdLayer) append(info, data []byte, width, height int) ([]byte, []byte) {
+	info = binary.BigEndian.AppendUint32(info, 0)
+	info = binary.BigEndian.AppendUint32(info, 0)
+	info = binary.BigEndian.AppendUint32(info, uint32(height))
+	info = binary.BigEndian.AppendUint32(info, uint32(width))
+	info = binary.BigEndian.AppendUint16(info, uint16(len(l.planes)))
+	for i, id := range []int16{0, 1, 2, -1} {
+		counts, packed := packPlane(l.planes[i], width, height)
+		info = binary.BigEndian.AppendUint16(info, uint16(id))
+		info = binary.BigEndian.AppendUint32(info, uint32(2+len(counts)+len(packed)))
+		data = binary.BigEndian.AppendUint16(data, 1)
+		data = append(data, counts...)
+		data = append(data, packed...)
+	}
+
+	var flags byte
+	if l.hidden {
+		flags |= 0x02
+	}
+	info = append(info, "8BIMnorm"...)
+	info = append(info, 255, 0, flags, 0)
+	name := append([]byte{byte(len(l.name))}, l.name...)
+	for len(name)%4 != 0 {
+		name = append(name, 0)
+	}
+	info = binary.BigEndian.AppendUint32(info, uint32(8+len(name)))
+	info = binary.BigEndian.AppendUint32(info, 0) // no layer mask
+	info = binary.BigEndian.AppendUint32(info, 0) // no blending ranges
+	info = append(info, name...)
+	return info, data
+}
+
+// rgbaPlanes splits 4-byte pixels into one plane per channel
+func rgbaPlanes(pix []byte, stride, width, height int) [4][]byte {
+	var planes [4][]byte
+	for c := range planes {
+		planes[c] = make([]byte, width*height)
+	}
+	for y := range height {
+		row := pix[y*stride:][:width*4]
+		for x := range width {
+			for c := range planes {
+				planes[c][y*width+x] = row[x*4+c]
+			}
+		}
+	}
+	return planes
+}
+
+// grayPlane returns the pixels of mask without row padding
+func grayPlane(mask *image.Gray) []byte {
+	b := mask.Bounds()
+	plane := make([]byte, 0, b.Dx()*b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		plane = append(plane, mask.Pix[mask.PixOffset(b.Min.X, y):][:b.Dx()]...)
+	}
+	return plane
+}
+
+// packPlane PackBits-compresses each row of plane, returning the 16-bit
+// compressed row lengths and the rows
+func packPlane(plane []byte, width, height int) (counts, packed []byte) {
+	for y := range height {
+		n := len(packed)
+		packed = packBits(packed, plane[y*width:][:width])
+		counts = binary.BigEndian.AppendUint16(counts, uint16(len(packed)-n))
+	}
+	return counts, packed
+}
+
+// packBits appends src to dst compressed with PackBits: runs of three or more
+// equal bytes are stored once with a negative count, other bytes verbatim
+// behind their count minus one
+func packBits(dst, src []byte) []byte {
+	for i := 0; i < len(src); {
+		j := i + 1
+		for j < len(src) && j-i < 128 && src[j] == src[i] {
+			j++
+		}
+		if j-i >= 3 {
+			dst = append(dst, byte(int8(1-(j-i))), src[i])
+			i = j
+			continue
+		}
+		for j = i; j < len(src) && j-i < 128; j++ {
+			if j+2 < len(src) && src[j] == src[j+1] && src[j] == src[j+2] {
+				break
+			}
+		}
+		dst = append(dst, byte(j-i-1))
+		dst = append(dst, src[i:j]...)
+		i = j
+	}
+	return dst
+}
+
+// EncodeOpenRaster writes img to w as an OpenRaster file, which Krita and
+// GIMP open as layers: the cut-out on top, with mask as its transparency,
+// and hidden below it a grayscale layer of mask and the original image.
+// 16-bit images keep 16 bits per channel.
+func EncodeOpenRaster(w io.Writer, img image.Image, mask *image.Gray) error {
+	b := img.Bounds()
+	if mask.Bounds().Size() != b.Size() {
+		return fmt.Errorf("openraster: %v mask for a %v image", mask.Bounds().Size(), b.Size())
+	}
+	var cut image.Image
+	if isDeep(img) {
+		cut = cutout16(img, mask)
+	} else {
+		cut = cutout(img, mask)
+	}
+
+	zw := zip.NewWriter(w)
+	// The mimetype comes first and uncompressed, so the format can be sniffed
+	mimetype := []byte("image/openraster")
+	f, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               "mimetype",
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE(mimetype),
+		CompressedSize64:   uint64(len(mimetype)),
+		UncompressedSize64: uint64(len(mimetype)),
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(mimetype); err != nil {
+		return err
+	}
+
+	stack := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<image version="0.0.3" w="%d" h="%d">
+  <stack>
+    <layer name="%s" src="data/cutout.png"/>
+    <layer name="%s" src="data/mask.png" visibility="hidden"/>
+    <layer name="%s" src="data/original.png" visibility="hidden"/>
+  </stack>
+</image>
+`, b.Dx(), b.Dy(), layerCutout, layerMask, layerOriginal)
+	f, err = zw.Create("stack.xml")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(f, stack); err != nil {
+		return err
+	}
+
+	thumb := oraThumbnail(cut)
+	for _, entry := range []struct {
+		name string
+		img  image.Image
+	}{
+		{"data/cutout.png", cut},
+		{"data/mask.png", mask},
+		{"data/original.png", img},
+		{"mergedimage.png", cut},
+		{"Thumbnails/thumbnail.png", thumb},
+	} {
+		f, err := zw.Create(entry.name)
+		if err != nil {
+			return err
+		}
+		if err := png.Encode(f, entry.img); err != nil {
+			return fmt.Errorf("openraster: %s: %w", entry.name, err)
+		}
+	}
+	return zw.Close()
+}
+
+// oraThumbnail scales img to fit the OpenRaster thumbnail bounds, keeping
+// smaller images as they are
+func oraThumbnail(img image.Image) image.Image {
+	b := img.Bounds()
+	side := max(b.Dx(), b.Dy())
+	if side <= oraThumbnailSide {
+		return img
+	}
+	w := max(1, b.Dx()*oraThumbnailSide/side)
+	h := max(1, b.Dy()*oraThumbnailSide/side)
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, b, xdraw.Src, nil)
+	return dst
+}
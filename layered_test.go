@@ -0,0 +1,271 @@
+package rmbg
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"testing"
+)
+
+// unpackBits reverses packBits
+func unpackBits(src []byte) []byte {
+	var dst []byte
+	for i := 0; i < len(src); {
+		n := int(int8(src[i]))
+		i++
+		if n >= 0 {
+			dst = append(dst, src[i:i+n+1]...)
+			i += n + 1
+			continue
+		}
+		for range 1 - n {
+			dst = append(dst, src[i])
+		}
+		i++
+	}
+	return dst
+}
+
+func TestPackBits(t *testing.T) {
+	long := bytes.Repeat([]byte{7}, 300)
+	mixed := append([]byte{1, 2, 3, 3, 3, 3, 4, 5, 5}, long...)
+	for _, src := range [][]byte{{}, {9}, {1, 2}, {1, 1}, mixed, gradientImage(200, 1).Pix} {
+		packed := packBits(nil, src)
+		if got := unpackBits(packed); !bytes.Equal(got, src) {
+			t.Errorf("expected %v to round-trip, got %v", src, got)
+		}
+	}
+	if packed := packBits(nil, long); len(packed) != 6 {
+		t.Errorf("expected 3 runs of 2 bytes for 300 equal bytes, got %d bytes", len(packed))
+	}
+}
+
+// layeredInput is a 4x2 image whose left half the mask keeps
+func layeredInput() (image.Image, *image.Gray) {
+	img := solidImage(4, 2, color.NRGBA{R: 200, G: 100, B: 50, A: 255})
+	mask := image.NewGray(image.Rect(0, 0, 4, 2))
+	for y := range 2 {
+		mask.SetGray(0, y, color.Gray{Y: 255})
+		mask.SetGray(1, y, color.Gray{Y: 128})
+	}
+	return img, mask
+}
+
+func TestEncodePSD(t *testing.T) {
+	img, mask := layeredInput()
+	var buf bytes.Buffer
+	if err := EncodePSD(&buf, img, mask); err != nil {
+		t.Fatalf("EncodePSD failed: %v", err)
+	}
+	data := buf.Bytes()
+	be := binary.BigEndian
+
+	if string(data[:4]) != "8BPS" || be.Uint16(data[4:]) != 1 {
+		t.Fatalf("expected a version 1 PSD header, got %q", data[:6])
+	}
+	if ch, h, w := be.Uint16(data[12:]), be.Uint32(data[14:]), be.Uint32(data[18:]); ch != 4 || w != 4 || h != 2 {
+		t.Errorf("expected 4 channels of 4x2, got %d of %dx%d", ch, w, h)
+	}
+	pos := 26
+	pos += 4 + int(be.Uint32(data[pos:])) // color mode data
+	resources := data[pos+4:][:be.Uint32(data[pos:])]
+	if !bytes.Contains(resources, []byte("\x04Mask")) {
+		t.Errorf("expected the alpha channel to be named Mask")
+	}
+	pos += 4 + len(resources)
+
+	// Layer info: two records, then their channel data
+	info := data[pos+8:]
+	if n := be.Uint16(info); n != 2 {
+		t.Fatalf("expected 2 layers, got %d", n)
+	}
+	p := 2
+	type record struct {
+		name     string
+		hidden   bool
+		channels map[int16]int
+	}
+	var records []record
+	for range 2 {
+		rec := record{channels: map[int16]int{}}
+		if bottom, right := be.Uint32(info[p+8:]), be.Uint32(info[p+12:]); bottom != 2 || right != 4 {
+			t.Errorf("expected a full-canvas layer, got %dx%d", right, bottom)
+		}
+		n := int(be.Uint16(info[p+16:]))
+		p += 18
+		var ids []int16
+		for range n {
+			id := int16(be.Uint16(info[p:]))
+			ids = append(ids, id)
+			rec.channels[id] = int(be.Uint32(info[p+2:]))
+			p += 6
+		}
+		if string(info[p:p+8]) != "8BIMnorm" {
+			t.Fatalf("expected normal blending, got %q", info[p:p+8])
+		}
+		rec.hidden = info[p+10]&0x02 != 0
+		extra := int(be.Uint32(info[p+12:]))
+		rec.name = string(info[p+25 : p+25+int(info[p+24])])
+		p += 16 + extra
+		records = append(records, rec)
+	}
+	if records[0].name != layerOriginal || !records[0].hidden {
+		t.Errorf("expected hidden %s at the bottom, got %+v", layerOriginal, records[0])
+	}
+	if records[1].name != layerCutout || records[1].hidden {
+		t.Errorf("expected visible %s on top, got %+v", layerCutout, records[1])
+	}
+
+	channel := func(t *testing.T, data []byte) []byte {
+		t.Helper()
+		if c := be.Uint16(data); c != 1 {
+			t.Fatalf("expected RLE compression, got %d", c)
+		}
+		return unpackBits(data[2+2*2:])
+	}
+	// Skip the original's channels to reach the cut-out's transparency
+	for _, id := range []int16{0, 1, 2, -1} {
+		p += records[0].channels[id]
+	}
+	for _, id := range []int16{0, 1, 2} {
+		p += records[1].channels[id]
+	}
+	alpha := channel(t, info[p:][:records[1].channels[-1]])
+	if want := []byte{255, 128, 0, 0, 255, 128, 0, 0}; !bytes.Equal(alpha, want) {
+		t.Errorf("expected cut-out transparency %v, got %v", want, alpha)
+	}
+
+	// The merged image ends with the mask channel
+	merged := data[pos+4+int(be.Uint32(data[pos:])):]
+	counts := merged[2:][:4*2*2]
+	var sizes []int
+	for i := range 8 {
+		sizes = append(sizes, int(be.Uint16(counts[i*2:])))
+	}
+	rows := merged[2+len(counts):]
+	off := 0
+	for _, n := range sizes[:6] {
+		off += n
+	}
+	got := unpackBits(rows[off:])
+	if want := []byte{255, 128, 0, 0, 255, 128, 0, 0}; !bytes.Equal(got, want) {
+		t.Errorf("expected mask channel %v, got %v", want, got)
+	}
+	if red := unpackBits(rows[:sizes[0]]); red[3] != 255 || red[0] != 200 {
+		t.Errorf("expected merged image flattened over white, got red %v", red)
+	}
+
+	t.Run("TooLarge", func(t *testing.T) {
+		img := image.NewGray(image.Rect(0, 0, psdMaxSide+1, 1))
+		mask := image.NewGray(img.Bounds())
+		if err := EncodePSD(io.Discard, img, mask); err == nil {
+			t.Errorf("expected error for %d pixels wide", psdMaxSide+1)
+		}
+	})
+}
+
+func TestEncodeOpenRaster(t *testing.T) {
+	img, mask := layeredInput()
+	var buf bytes.Buffer
+	if err := EncodeOpenRaster(&buf, img, mask); err != nil {
+		t.Fatalf("EncodeOpenRaster failed: %v", err)
+	}
+	if got := buf.Bytes()[30:54]; string(got) != "mimetypeimage/openraster" {
+		t.Errorf("expected an uncompressed mimetype first, got %q", got)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("expected a zip file, got %v", err)
+	}
+	open := func(t *testing.T, name string) []byte {
+		t.Helper()
+		f, err := zr.Open(name)
+		if err != nil {
+			t.Fatalf("expected %s, got %v", name, err)
+		}
+		defer f.Close()
+		data, err := io.ReadAll(f)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", name, err)
+		}
+		return data
+	}
+
+	var stack struct {
+		W      int `xml:"w,attr"`
+		H      int `xml:"h,attr"`
+		Layers []struct {
+			Name       string `xml:"name,attr"`
+			Src        string `xml:"src,attr"`
+			Visibility string `xml:"visibility,attr"`
+		} `xml:"stack>layer"`
+	}
+	if err := xml.Unmarshal(open(t, "stack.xml"), &stack); err != nil {
+		t.Fatalf("invalid stack.xml: %v", err)
+	}
+	if stack.W != 4 || stack.H != 2 || len(stack.Layers) != 3 {
+		t.Fatalf("expected 3 layers of 4x2, got %+v", stack)
+	}
+	layers := map[string]image.Image{}
+	for _, l := range stack.Layers {
+		decoded, err := png.Decode(bytes.NewReader(open(t, l.Src)))
+		if err != nil {
+			t.Fatalf("invalid layer %s: %v", l.Name, err)
+		}
+		layers[l.Name] = decoded
+		if hidden := l.Visibility == "hidden"; hidden != (l.Name != layerCutout) {
+			t.Errorf("expected only %s visible, got %s %q", layerCutout, l.Name, l.Visibility)
+		}
+	}
+	if got := color.NRGBAModel.Convert(layers[layerCutout].At(1, 0)).(color.NRGBA); got.A != 128 || got.R != 200 {
+		t.Errorf("expected half-transparent object pixel, got %v", got)
+	}
+	if got := color.GrayModel.Convert(layers[layerMask].At(0, 1)).(color.Gray); got.Y != 255 {
+		t.Errorf("expected mask value 255, got %d", got.Y)
+	}
+	if _, _, _, a := layers[layerOriginal].At(3, 0).RGBA(); a != 0xffff {
+		t.Errorf("expected opaque original, got alpha %d", a)
+	}
+	for _, name := range []string{"mergedimage.png", "Thumbnails/thumbnail.png"} {
+		if _, err := png.Decode(bytes.NewReader(open(t, name))); err != nil {
+			t.Errorf("invalid %s: %v", name, err)
+		}
+	}
+
+	t.Run("Thumbnail", func(t *testing.T) {
+		if got := oraThumbnail(gradientImage(1024, 512)).Bounds().Size(); got != image.Pt(256, 128) {
+			t.Errorf("expected 256x128, got %v", got)
+		}
+	})
+}
+
+func TestRemoveBackgroundLayered(t *testing.T) {
+	src := solidImage(20, 10, color.NRGBA{R: 255, A: 255})
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, src); err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	r := cachedEngine(src)
+
+	for _, format := range []Format{FormatPSD, FormatORA} {
+		t.Run(format.String(), func(t *testing.T) {
+			var out bytes.Buffer
+			if err := r.RemoveBackgroundFrom(bytes.NewReader(encoded.Bytes()), &out, format, nil); err != nil {
+				t.Fatalf("RemoveBackgroundFrom failed: %v", err)
+			}
+			if out.Len() == 0 {
+				t.Errorf("expected output")
+			}
+			opts := &IOOptions{Crop: &CropConfig{}}
+			if err := r.RemoveBackgroundFrom(bytes.NewReader(encoded.Bytes()), io.Discard, format, opts); err == nil {
+				t.Errorf("expected error cropping %v output", format)
+			}
+		})
+	}
+}
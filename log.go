@@ -0,0 +1,15 @@
+package rmbg
+
+import (
+	"context"
+	"log/slog"
+)
+
+// log emits a structured event on the configured logger. Attributes should be
+// built with the typed slog constructors so disabled levels cost nothing.
+func (r *RemBG) log(level slog.Level, msg string, attrs ...slog.Attr) {
+	if r.logger == nil || !r.logger.Enabled(context.Background(), level) {
+		return
+	}
+	r.logger.LogAttrs(context.Background(), level, msg, attrs...)
+}
@@ -0,0 +1,79 @@
+package rmbg
+
+import (
+	"bytes"
+	"encoding/json"
+	"image/color"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// logRecords decodes the JSON lines written by a slog.JSONHandler
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for line := range strings.Lines(buf.String()) {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+func TestLog(t *testing.T) {
+	t.Run("NilLogger", func(t *testing.T) {
+		(&RemBG{}).log(slog.LevelInfo, "ignored") // must not panic
+	})
+
+	t.Run("Level", func(t *testing.T) {
+		var buf bytes.Buffer
+		r := &RemBG{logger: slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))}
+		r.log(slog.LevelDebug, "hidden")
+		r.log(slog.LevelInfo, "shown", slog.Int("n", 1))
+
+		records := logRecords(t, &buf)
+		if len(records) != 1 || records[0]["msg"] != "shown" || records[0]["n"] != 1.0 {
+			t.Errorf("expected only the info record, got %v", records)
+		}
+	})
+
+	t.Run("Process", func(t *testing.T) {
+		img := solidImage(12, 8, color.NRGBA{G: 255, A: 255})
+		r := cachedEngine(img)
+		var buf bytes.Buffer
+		r.logger = slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+		if _, err := r.Process(img); err != nil {
+			t.Fatalf("Process failed: %v", err)
+		}
+
+		records := logRecords(t, &buf)
+		if len(records) != 2 {
+			t.Fatalf("expected 2 records, got %v", records)
+		}
+		if records[0]["msg"] != "mask cache hit" {
+			t.Errorf("expected cache hit event, got %v", records[0]["msg"])
+		}
+		processed := records[1]
+		if processed["msg"] != "image processed" || processed["width"] != 12.0 || processed["height"] != 8.0 {
+			t.Errorf("expected image processed event for 12x8, got %v", processed)
+		}
+		for _, key := range []string{"preprocess", "inference", "decode", "upsample", "blend"} {
+			if _, ok := processed[key]; !ok {
+				t.Errorf("expected %s timing in %v", key, processed)
+			}
+		}
+	})
+}
+
+func TestUpsamplingString(t *testing.T) {
+	if UpsampleGuided.String() != "guided" || Upsampling(7).String() != "Upsampling(7)" {
+		t.Errorf("unexpected names %q and %q", UpsampleGuided.String(), Upsampling(7).String())
+	}
+	if UpsampleAntialias.String() != "antialias" {
+		t.Errorf("unexpected name %q", UpsampleAntialias.String())
+	}
+}
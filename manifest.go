@@ -0,0 +1,278 @@
+package rmbg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Manifest records the outputs of a ProcessDir run, see DirOptions.Manifest
+type Manifest struct {
+	// Params are the settings every output was rendered with
+	Params ManifestParams `json:"params"`
+	// Files holds one entry per output, sorted by input path
+	Files []ManifestEntry `json:"files"`
+}
+
+// ManifestParams are the settings outputs are rendered with
+type ManifestParams struct {
+	// Model is the name of the engine's model
+	Model string `json:"model"`
+	// Format is the output format
+	Format string `json:"format"`
+	// Backdrop is the Go type of IO.Backdrop, which its fields alone do not
+	// identify
+	Backdrop string `json:"backdrop,omitempty"`
+	// IO are the input and output options
+	IO *IOOptions `json:"io,omitempty"`
+	// Engine are the settings of the engine
+	Engine ManifestEngine `json:"engine"`
+}
+
+// ManifestEngine are the settings of an engine that change its outputs, see
+// Config. Pre-processors, post-processors and the portrait detector are
+// identified by their type and exported fields: a function adapter such as
+// PreProcessorFunc, or a type configured through unexported state, is the
+// same whatever it does.
+type ManifestEngine struct {
+	// Model is the current model, after any ReloadModel
+	Model ManifestModel `json:"model"`
+	// Portrait is the portrait model of Config.ModelRouting and Detector its
+	// detector
+	Portrait *ManifestModel `json:"portrait,omitempty"`
+	Detector string         `json:"detector,omitempty"`
+	// Ensemble are the further models of Config.Ensemble
+	Ensemble          []ManifestModel  `json:"ensemble,omitempty"`
+	Fusion            Fusion           `json:"fusion"`
+	Letterbox         bool             `json:"letterbox,omitempty"`
+	TargetClasses     []string         `json:"target_classes,omitempty"`
+	SoftMask          bool             `json:"soft_mask,omitempty"`
+	MaskCacheDistance int              `json:"mask_cache_distance,omitempty"`
+	TileSize          int              `json:"tile_size,omitempty"`
+	TileOverlap       int              `json:"tile_overlap,omitempty"`
+	MaxMegapixels     float64          `json:"max_megapixels,omitempty"`
+	ResolutionPolicy  ResolutionPolicy `json:"resolution_policy"`
+	Scales            []int            `json:"scales,omitempty"`
+	FlipTTA           bool             `json:"flip_tta,omitempty"`
+	Upsampling        Upsampling       `json:"upsampling"`
+	AntialiasWidth    float64          `json:"antialias_width,omitempty"`
+	Refine            bool             `json:"refine,omitempty"`
+	Shadow            *ShadowOptions   `json:"shadow,omitempty"`
+	// PreProcessors include Config.Denoise and Config.Exposure, in the order
+	// they run
+	PreProcessors  []string `json:"pre_processors,omitempty"`
+	PostProcessors []string `json:"post_processors,omitempty"`
+	Deterministic  bool     `json:"deterministic,omitempty"`
+}
+
+// ManifestModel identifies a model
+type ManifestModel struct {
+	// Spec describes the model's tensors
+	Spec ModelSpec `json:"spec"`
+	// Digest is the hex SHA-256 of the model file, unset for models run by a
+	// Config.Backend
+	Digest string `json:"digest,omitempty"`
+	// Weight is the share of an ensemble member in the fusion
+	Weight float64 `json:"weight,omitempty"`
+}
+
+// ManifestEntry maps an input to its output
+type ManifestEntry struct {
+	// Input is the path of the source relative to the input directory, and
+	// Output that of the output relative to the output directory, both
+	// slash-separated
+	Input  string `json:"input"`
+	Output string `json:"output"`
+	// Hash is the content hash outputs are named after with
+	// DirOptions.ContentNames
+	Hash string `json:"hash,omitempty"`
+	// Skipped is set when the output was left untouched, see
+	// DirOptions.SkipExisting
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+// manifestParams returns the settings of a ProcessDir run and their JSON
+// encoding, which content names hash
+func (r *RemBG) manifestParams(opts *DirOptions) (ManifestParams, []byte, error) {
+	engine, err := r.manifestEngine()
+	if err != nil {
+		return ManifestParams{}, nil, err
+	}
+	params := ManifestParams{Model: engine.Model.Spec.Name, Format: opts.Format.String(), IO: opts.IO, Engine: engine}
+	if opts.IO != nil && opts.IO.Backdrop != nil {
+		params.Backdrop = fmt.Sprintf("%T", opts.IO.Backdrop)
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return ManifestParams{}, nil, fmt.Errorf("failed to encode parameters: %w", err)
+	}
+	return params, data, nil
+}
+
+// manifestEngine returns the settings of r that change outputs, hashing the
+// files of its models
+func (r *RemBG) manifestEngine() (ManifestEngine, error) {
+	r.modelMu.RLock()
+	m, modelPath := r.model, r.modelPath
+	r.modelMu.RUnlock()
+
+	config := &r.config
+	engine := ManifestEngine{
+		Fusion:            config.Fusion,
+		Letterbox:         m.letterbox,
+		TargetClasses:     config.TargetClasses,
+		SoftMask:          config.SoftMask,
+		MaskCacheDistance: config.MaskCacheDistance,
+		TileSize:          r.tileSize,
+		TileOverlap:       r.tileOverlap,
+		MaxMegapixels:     config.MaxMegapixels,
+		ResolutionPolicy:  config.ResolutionPolicy,
+		Scales:            config.Scales,
+		FlipTTA:           m.flip,
+		Upsampling:        r.upsampling,
+		AntialiasWidth:    r.antialiasWidth,
+		Refine:            r.refine,
+		Shadow:            r.shadow,
+		Deterministic:     config.Deterministic,
+	}
+	var err error
+	if engine.Model, err = manifestModel(m.spec, modelPath, 0); err != nil {
+		return ManifestEngine{}, err
+	}
+	if r.portrait != nil {
+		portrait, err := manifestModel(r.portrait.spec, config.ModelRouting.PortraitModelPath, 0)
+		if err != nil {
+			return ManifestEngine{}, err
+		}
+		engine.Portrait = &portrait
+		engine.Detector = describe(r.detector)
+	}
+	for _, member := range config.Ensemble {
+		spec := ModelU2NetP
+		if member.Model != nil {
+			spec = *member.Model
+		}
+		weight := member.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		mm, err := manifestModel(spec, member.ModelPath, weight)
+		if err != nil {
+			return ManifestEngine{}, err
+		}
+		engine.Ensemble = append(engine.Ensemble, mm)
+	}
+	for _, p := range r.preProcessors {
+		engine.PreProcessors = append(engine.PreProcessors, describe(p))
+	}
+	for _, p := range r.postProcessors {
+		engine.PostProcessors = append(engine.PostProcessors, describe(p))
+	}
+	return engine, nil
+}
+
+// manifestModel identifies the model described by spec in the file at path,
+// which is not read when empty
+func manifestModel(spec ModelSpec, path string, weight float64) (ManifestModel, error) {
+	mm := ManifestModel{Spec: spec, Weight: weight}
+	if path == "" {
+		return mm, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return ManifestModel{}, fmt.Errorf("failed to hash model: %w", err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return ManifestModel{}, fmt.Errorf("failed to hash model: %w", err)
+	}
+	mm.Digest = hex.EncodeToString(h.Sum(nil))
+	return mm, nil
+}
+
+// describe returns the Go type of v followed by the JSON encoding of its
+// exported fields, when it has one
+func describe(v any) string {
+	name := fmt.Sprintf("%T", v)
+	if data, err := json.Marshal(v); err == nil {
+		name += string(data)
+	}
+	return name
+}
+
+// contentHash returns the hex SHA-256 of params followed by the content of
+// the file at path, truncated to 128 bits
+func contentHash(path string, params []byte) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	_, _ = h.Write(params)
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16]), nil
+}
+
+// writeManifest writes the manifest of report to path, relative to outDir
+// unless absolute
+func writeManifest(path, inDir, outDir string, params ManifestParams, report *DirReport) error {
+	path = manifestPath(path, outDir)
+	m := Manifest{Params: params, Files: []ManifestEntry{}}
+	for _, f := range report.Files {
+		if f.Err != nil {
+			continue
+		}
+		in, err := filepath.Rel(inDir, f.Input)
+		if err != nil {
+			return err
+		}
+		out, err := filepath.Rel(outDir, f.Output)
+		if err != nil {
+			return err
+		}
+		m.Files = append(m.Files, ManifestEntry{
+			Input:   filepath.ToSlash(in),
+			Output:  filepath.ToSlash(out),
+			Hash:    f.Hash,
+			Skipped: f.Skipped,
+		})
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// Write a complete manifest or none, so readers never see a partial one
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// manifestPath returns the manifest path of DirOptions.Manifest, relative to
+// outDir unless absolute
+func manifestPath(path, outDir string) string {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(outDir, path)
+	}
+	return path
+}
+
+// contentName returns p with its base name replaced by hash
+func contentName(p, hash, ext string) string {
+	return filepath.Join(filepath.Dir(p), hash+ext)
+}
@@ -294,3 +294,16 @@ func detectUniformBackground(img image.Image) (color.Color, bool) {
 	}
 	return bg, isUniform
 }
+
+// fitMask returns mask resized to w x h, or mask itself when it has that size
+func fitMask(mask *image.Gray, w, h int) *image.Gray {
+	if mask.Bounds().Size() == image.Pt(w, h) {
+		return mask
+	}
+	resized := imaging.Resize(mask, w, h, imaging.Linear)
+	gray := image.NewGray(image.Rect(0, 0, w, h))
+	for i := range gray.Pix {
+		gray.Pix[i] = resized.Pix[i*4]
+	}
+	return gray
+}
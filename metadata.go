@@ -0,0 +1,398 @@
+package rmbg
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"slices"
+)
+
+var (
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+	exifHeader   = []byte("Exif\x00\x00")
+	xmpHeader    = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	iccHeader    = []byte("ICC_PROFILE\x00")
+	// xmpKeyword starts the PNG iTXt chunk holding an XMP packet
+	xmpKeyword = []byte("XML:com.adobe.xmp\x00")
+)
+
+const (
+	// maxICCProfile bounds the decompressed size of a PNG ICC profile
+	maxICCProfile = 16 << 20
+	// tiffTagICC is the TIFF InterColorProfile tag
+	tiffTagICC = 34675
+	// tiffByte and tiffUndefined are the TIFF field types of byte arrays
+	tiffByte      = 1
+	tiffUndefined = 7
+
+	jpegAPP1 = 0xe1
+	jpegAPP2 = 0xe2
+	jpegSOS  = 0xda
+	// jpegMaxSegment is the largest payload of a JPEG marker segment
+	jpegMaxSegment = 0xffff - 2
+)
+
+// metadata is the part of an encoded image's metadata that survives
+// reencoding: the EXIF block, the XMP packet, the ICC profile and the
+// resolution
+type metadata struct {
+	// exif is the TIFF structure of the EXIF block, without the JPEG "Exif"
+	// header
+	exif []byte
+	// icc are the APP2 segment payloads holding the ICC profile, in order,
+	// whatever the format it was read from
+	icc [][]byte
+	// xmp is the XMP packet
+	xmp []byte
+	// dpi is the resolution of the JFIF header, pHYs chunk or TIFF tags
+	dpi resolution
+}
+
+// readMetadata extracts the metadata of a JPEG, PNG, WebP or TIFF file; other
+// formats and malformed files yield no metadata. Only the ICC profile and
+// resolution of TIFF files are read.
+func readMetadata(data []byte) metadata {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		return readJPEGMetadata(data)
+	case bytes.HasPrefix(data, pngSignature):
+		return metadata{
+			exif: pngChunk(data, "eXIf", nil),
+			icc:  iccSegments(pngICCProfile(data)),
+			xmp:  pngXMP(data),
+			dpi:  pngResolution(data),
+		}
+	case bytes.HasPrefix(data, []byte("RIFF")):
+		return readWebPMetadata(data)
+	case bytes.HasPrefix(data, []byte("II*\x00")), bytes.HasPrefix(data, []byte("MM\x00*")):
+		return metadata{icc: iccSegments(tiffICCProfile(data)), dpi: tiffResolution(data)}
+	}
+	return metadata{}
+}
+
+func readJPEGMetadata(data []byte) metadata {
+	var md metadata
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			break
+		}
+		marker := data[i+1]
+		if marker == 0xff {
+			// Fill byte
+			i++
+			continue
+		}
+		if marker == 0x01 || marker >= 0xd0 && marker <= 0xd7 {
+			i += 2
+			continue
+		}
+		if marker == jpegSOS {
+			break
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end > len(data) {
+			break
+		}
+		payload := data[i+4 : end]
+		switch {
+		case marker == jpegAPP0 && bytes.HasPrefix(payload, jfifHeader):
+			md.dpi = jfifResolution(payload[len(jfifHeader):])
+		case marker == jpegAPP1 && md.exif == nil && bytes.HasPrefix(payload, exifHeader):
+			md.exif = payload[len(exifHeader):]
+		case marker == jpegAPP1 && md.xmp == nil && bytes.HasPrefix(payload, xmpHeader):
+			md.xmp = payload[len(xmpHeader):]
+		case marker == jpegAPP2 && bytes.HasPrefix(payload, iccHeader):
+			md.icc = append(md.icc, payload)
+		}
+		i = end
+	}
+	return md
+}
+
+// pngChunk returns the data of the first chunk of the given type starting
+// with prefix
+func pngChunk(data []byte, typ string, prefix []byte) []byte {
+	for i := len(pngSignature); i+8 <= len(data); {
+		n := int(binary.BigEndian.Uint32(data[i:]))
+		end := i + 12 + n
+		if n < 0 || end > len(data) {
+			return nil
+		}
+		if chunk := data[i+8 : i+8+n]; string(data[i+4:i+8]) == typ && bytes.HasPrefix(chunk, prefix) {
+			return chunk
+		}
+		i = end
+	}
+	return nil
+}
+
+// pngICCProfile returns the decompressed profile of the iCCP chunk, or nil
+func pngICCProfile(data []byte) []byte {
+	chunk := pngChunk(data, "iCCP", nil)
+	// A profile name, its terminator and the compression method precede the
+	// zlib stream
+	name := bytes.IndexByte(chunk, 0)
+	if name < 0 || len(chunk) < name+2 || chunk[name+1] != 0 {
+		return nil
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(chunk[name+2:]))
+	if err != nil {
+		return nil
+	}
+	profile, err := io.ReadAll(io.LimitReader(zr, maxICCProfile+1))
+	if err != nil || len(profile) > maxICCProfile {
+		return nil
+	}
+	return profile
+}
+
+// pngXMP returns the XMP packet of an iTXt chunk, or nil
+func pngXMP(data []byte) []byte {
+	chunk := pngChunk(data, "iTXt", xmpKeyword)
+	// The keyword is followed by the compression flag and method, and by the
+	// language tag and translated keyword, both terminated
+	rest := chunk[min(len(xmpKeyword)+2, len(chunk)):]
+	for range 2 {
+		i := bytes.IndexByte(rest, 0)
+		if i < 0 {
+			return nil
+		}
+		rest = rest[i+1:]
+	}
+	if chunk[len(xmpKeyword)] == 0 {
+		return rest
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(rest))
+	if err != nil {
+		return nil
+	}
+	xmp, err := io.ReadAll(io.LimitReader(zr, maxICCProfile+1))
+	if err != nil || len(xmp) > maxICCProfile {
+		return nil
+	}
+	return xmp
+}
+
+// byteOrder reads and appends integers in one byte order
+type byteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+// tiffHeader returns the byte order of a TIFF file and the offset of its
+// first IFD
+func tiffHeader(data []byte) (byteOrder, int, bool) {
+	if len(data) < 8 {
+		return nil, 0, false
+	}
+	var order byteOrder = binary.LittleEndian
+	if data[0] == 'M' {
+		order = binary.BigEndian
+	}
+	ifd := int(order.Uint32(data[4:]))
+	if ifd < 8 || ifd+2 > len(data) {
+		return nil, 0, false
+	}
+	return order, ifd, true
+}
+
+// tiffEntries returns the 12-byte entries of the IFD at offset ifd
+func tiffEntries(data []byte, order byteOrder, ifd int) ([]byte, bool) {
+	end := ifd + 2 + int(order.Uint16(data[ifd:]))*12
+	if end+4 > len(data) {
+		return nil, false
+	}
+	return data[ifd+2 : end], true
+}
+
+// tiffICCProfile returns the InterColorProfile of the first image of a TIFF
+// file, or nil
+func tiffICCProfile(data []byte) []byte {
+	order, ifd, ok := tiffHeader(data)
+	if !ok {
+		return nil
+	}
+	entries, ok := tiffEntries(data, order, ifd)
+	if !ok {
+		return nil
+	}
+	for e := range slices.Chunk(entries, 12) {
+		if order.Uint16(e) != tiffTagICC {
+			continue
+		}
+		typ, n, at := order.Uint16(e[2:]), int(order.Uint32(e[4:])), int(order.Uint32(e[8:]))
+		if typ != tiffByte && typ != tiffUndefined || n <= 4 || at < 0 || at+n > len(data) {
+			return nil
+		}
+		return data[at : at+n]
+	}
+	return nil
+}
+
+// writeJPEGMetadata inserts the metadata segments after the SOI marker of an
+// encoded JPEG. Segments too large for a marker are dropped.
+func writeJPEGMetadata(data []byte, md metadata) []byte {
+	var segs bytes.Buffer
+	writeSegment := func(marker byte, parts ...[]byte) {
+		n := 0
+		for _, p := range parts {
+			n += len(p)
+		}
+		if n > jpegMaxSegment {
+			return
+		}
+		segs.Write([]byte{0xff, marker})
+		_ = binary.Write(&segs, binary.BigEndian, uint16(n+2))
+		for _, p := range parts {
+			segs.Write(p)
+		}
+	}
+	if md.dpi.valid() {
+		writeSegment(jpegAPP0, jfifSegment(md.dpi))
+	}
+	if md.exif != nil {
+		writeSegment(jpegAPP1, exifHeader, md.exif)
+	}
+	if md.xmp != nil {
+		writeSegment(jpegAPP1, xmpHeader, md.xmp)
+	}
+	for _, icc := range md.icc {
+		writeSegment(jpegAPP2, icc)
+	}
+	if segs.Len() == 0 || len(data) < 2 {
+		return data
+	}
+
+	out := make([]byte, 0, len(data)+segs.Len())
+	out = append(out, data[:2]...)
+	out = append(out, segs.Bytes()...)
+	return append(out, data[2:]...)
+}
+
+// writePNGMetadata inserts an iCCP chunk with the ICC profile, a pHYs chunk
+// with the resolution, an eXIf chunk and an iTXt chunk with the XMP packet
+// after the IHDR chunk of an encoded PNG, ahead of the palette and pixel data
+// as PNG requires
+func writePNGMetadata(data []byte, md metadata) []byte {
+	profile := iccProfile(md.icc)
+	if md.exif == nil && md.xmp == nil && profile == nil && !md.dpi.valid() {
+		return data
+	}
+	at := len(pngSignature)
+	if at+8 > len(data) || string(data[at+4:at+8]) != "IHDR" {
+		return data
+	}
+	at += 12 + int(binary.BigEndian.Uint32(data[at:]))
+	if at > len(data) {
+		return data
+	}
+
+	var chunk bytes.Buffer
+	if profile != nil {
+		var iccp bytes.Buffer
+		iccp.WriteString("ICC profile\x00\x00")
+		zw := zlib.NewWriter(&iccp)
+		_, _ = zw.Write(profile)
+		_ = zw.Close()
+		writePNGChunk(&chunk, "iCCP", iccp.Bytes())
+	}
+	if md.dpi.valid() {
+		writePNGChunk(&chunk, "pHYs", pngPhys(md.dpi))
+	}
+	if md.exif != nil {
+		writePNGChunk(&chunk, "eXIf", md.exif)
+	}
+	if md.xmp != nil {
+		// Uncompressed, with empty language tag and translated keyword
+		itxt := append(append(bytes.Clone(xmpKeyword), 0, 0, 0, 0), md.xmp...)
+		writePNGChunk(&chunk, "iTXt", itxt)
+	}
+
+	out := make([]byte, 0, len(data)+chunk.Len())
+	out = append(out, data[:at]...)
+	out = append(out, chunk.Bytes()...)
+	return append(out, data[at:]...)
+}
+
+// writeTIFFMetadata sets the ICC profile and resolution of the first image of
+// an encoded TIFF
+func writeTIFFMetadata(data []byte, md metadata) []byte {
+	order, _, ok := tiffHeader(data)
+	if !ok {
+		return data
+	}
+	var fields []tiffField
+	if profile := iccProfile(md.icc); profile != nil {
+		fields = append(fields, tiffField{tiffTagICC, tiffUndefined, uint32(len(profile)), profile})
+	}
+	if md.dpi.valid() {
+		fields = append(fields,
+			tiffField{tiffTagXResolution, tiffRational, 1, tiffRationalValue(order, md.dpi.x)},
+			tiffField{tiffTagYResolution, tiffRational, 1, tiffRationalValue(order, md.dpi.y)},
+			tiffField{tiffTagResolutionUnit, tiffShort, 1, order.AppendUint16(nil, tiffUnitInch)},
+		)
+	}
+	return setTIFFFields(data, fields)
+}
+
+// tiffField is an IFD entry, with its value in the byte order of the file
+type tiffField struct {
+	tag, typ uint16
+	count    uint32
+	value    []byte
+}
+
+// setTIFFFields sets fields in the first IFD of a TIFF file, replacing those
+// with the same tags. The values that do not fit in their entry and a new
+// IFD are appended, and the header is pointed at the new IFD.
+func setTIFFFields(data []byte, fields []tiffField) []byte {
+	order, ifd, ok := tiffHeader(data)
+	if len(fields) == 0 || !ok {
+		return data
+	}
+	entries, ok := tiffEntries(data, order, ifd)
+	if !ok {
+		return data
+	}
+	next := data[ifd+2+len(entries):][:4]
+
+	out := append([]byte(nil), data...)
+	set := make(map[uint16][]byte)
+	for _, f := range fields {
+		e := make([]byte, 12)
+		order.PutUint16(e, f.tag)
+		order.PutUint16(e[2:], f.typ)
+		order.PutUint32(e[4:], f.count)
+		if len(f.value) <= 4 {
+			copy(e[8:], f.value)
+		} else {
+			out = append(out, make([]byte, len(out)%2)...)
+			order.PutUint32(e[8:], uint32(len(out)))
+			out = append(out, f.value...)
+		}
+		set[f.tag] = e
+	}
+	var sorted [][]byte
+	for e := range slices.Chunk(entries, 12) {
+		if _, ok := set[order.Uint16(e)]; !ok {
+			sorted = append(sorted, e)
+		}
+	}
+	for _, e := range set {
+		sorted = append(sorted, e)
+	}
+	// Entries are sorted by tag
+	slices.SortFunc(sorted, func(a, b []byte) int { return int(order.Uint16(a)) - int(order.Uint16(b)) })
+
+	out = append(out, make([]byte, len(out)%2)...)
+	ifdAt := len(out)
+	out = append(out, 0, 0)
+	order.PutUint16(out[ifdAt:], uint16(len(sorted)))
+	for _, e := range sorted {
+		out = append(out, e...)
+	}
+	out = append(out, next...)
+	order.PutUint32(out[4:], uint32(ifdAt))
+	return out
+}
@@ -0,0 +1,61 @@
+package rmbg
+
+import (
+	"errors"
+	"image"
+	"time"
+)
+
+// Error kinds passed to MetricsCollector.IncErrors
+const (
+	ErrorKindDecode    = "decode"
+	ErrorKindInference = "inference"
+	ErrorKindClosed    = "closed"
+	ErrorKindOther     = "other"
+)
+
+// MetricsCollector receives engine metrics, e.g. to export them to Prometheus
+// (see the prommetrics package). Methods are called on the calling goroutine
+// and must be safe for concurrent use.
+type MetricsCollector interface {
+	// ObserveLatency records the duration of one of the Stage names
+	ObserveLatency(stage string, d time.Duration)
+	// IncErrors counts a failed call by one of the ErrorKind names
+	IncErrors(kind string)
+	// ObserveImageSize records the pixel count of a segmented image
+	ObserveImageSize(pixels int)
+}
+
+// observeImage reports the size of an image about to be segmented
+func (r *RemBG) observeImage(img image.Image) {
+	if r.metrics != nil {
+		b := img.Bounds()
+		r.metrics.ObserveImageSize(b.Dx() * b.Dy())
+	}
+}
+
+// countError reports err under kind, or under the kind derived from err when
+// kind is empty, and returns err
+func (r *RemBG) countError(kind string, err error) error {
+	if r.metrics == nil || err == nil {
+		return err
+	}
+	if kind == "" {
+		kind = errorKind(err)
+	}
+	r.metrics.IncErrors(kind)
+	return err
+}
+
+func errorKind(err error) string {
+	switch {
+	case errors.Is(err, ErrClosed):
+		return ErrorKindClosed
+	case errors.Is(err, ErrInferenceFailed):
+		return ErrorKindInference
+	case errors.Is(err, ErrImageTooLarge), errors.Is(err, ErrInvalidImage):
+		return ErrorKindDecode
+	default:
+		return ErrorKindOther
+	}
+}
@@ -0,0 +1,162 @@
+// Package metrics compares segmentation masks, e.g. to evaluate a model
+// version against ground truth or to regression-test threshold tuning.
+package metrics
+
+import (
+	"fmt"
+	"image"
+)
+
+// DefaultThreshold is the mask value at or above which a pixel counts as foreground
+const DefaultThreshold = 128
+
+// IoU returns the intersection over union of the foreground of two masks.
+// Two empty masks are considered identical (IoU = 1).
+func IoU(a, b *image.Gray, threshold uint8) (float64, error) {
+	inter, union, err := overlap(a, b, threshold)
+	if err != nil {
+		return 0, err
+	}
+	if union == 0 {
+		return 1, nil
+	}
+	return float64(inter) / float64(union), nil
+}
+
+// Dice returns the Dice coefficient (F1 over pixels) of two masks.
+// Two empty masks are considered identical (Dice = 1).
+func Dice(a, b *image.Gray, threshold uint8) (float64, error) {
+	inter, union, err := overlap(a, b, threshold)
+	if err != nil {
+		return 0, err
+	}
+	// |A| + |B| = union + intersection
+	total := union + inter
+	if total == 0 {
+		return 1, nil
+	}
+	return 2 * float64(inter) / float64(total), nil
+}
+
+// BoundaryFScore returns the boundary F-measure between a predicted and a
+// ground-truth mask: boundary pixels count as matched when they lie within
+// tolerance pixels of the other mask's boundary.
+func BoundaryFScore(pred, truth *image.Gray, threshold uint8, tolerance int) (float64, error) {
+	if err := checkSize(pred, truth); err != nil {
+		return 0, err
+	}
+
+	predEdge := boundary(pred, threshold)
+	truthEdge := boundary(truth, threshold)
+
+	predCount, predMatched := matchBoundary(predEdge, truthEdge, tolerance)
+	truthCount, truthMatched := matchBoundary(truthEdge, predEdge, tolerance)
+
+	if predCount == 0 && truthCount == 0 {
+		return 1, nil
+	}
+	if predCount == 0 || truthCount == 0 {
+		return 0, nil
+	}
+
+	precision := float64(predMatched) / float64(predCount)
+	recall := float64(truthMatched) / float64(truthCount)
+	if precision+recall == 0 {
+		return 0, nil
+	}
+	return 2 * precision * recall / (precision + recall), nil
+}
+
+func checkSize(a, b *image.Gray) error {
+	if a == nil || b == nil {
+		return fmt.Errorf("mask is nil")
+	}
+	if a.Bounds().Size() != b.Bounds().Size() {
+		return fmt.Errorf("mask sizes differ: %v vs %v", a.Bounds().Size(), b.Bounds().Size())
+	}
+	return nil
+}
+
+func overlap(a, b *image.Gray, threshold uint8) (inter, union int, err error) {
+	if err := checkSize(a, b); err != nil {
+		return 0, 0, err
+	}
+
+	w, h := a.Bounds().Dx(), a.Bounds().Dy()
+	for y := range h {
+		rowA := a.Pix[y*a.Stride : y*a.Stride+w]
+		rowB := b.Pix[y*b.Stride : y*b.Stride+w]
+		for x := range w {
+			inA := rowA[x] >= threshold
+			inB := rowB[x] >= threshold
+			if inA && inB {
+				inter++
+			}
+			if inA || inB {
+				union++
+			}
+		}
+	}
+	return inter, union, nil
+}
+
+// boundary marks foreground pixels that have a 4-connected background neighbour
+// (pixels outside the image count as background)
+func boundary(mask *image.Gray, threshold uint8) [][]bool {
+	w, h := mask.Bounds().Dx(), mask.Bounds().Dy()
+	in := func(x, y int) bool {
+		if x < 0 || y < 0 || x >= w || y >= h {
+			return false
+		}
+		return mask.Pix[y*mask.Stride+x] >= threshold
+	}
+
+	edge := make([][]bool, h)
+	for y := range h {
+		edge[y] = make([]bool, w)
+		for x := range w {
+			if in(x, y) && (!in(x-1, y) || !in(x+1, y) || !in(x, y-1) || !in(x, y+1)) {
+				edge[y][x] = true
+			}
+		}
+	}
+	return edge
+}
+
+// matchBoundary counts the boundary pixels of src and how many of them lie
+// within tolerance (Euclidean) of a boundary pixel of dst
+func matchBoundary(src, dst [][]bool, tolerance int) (count, matched int) {
+	h := len(src)
+	if h == 0 {
+		return 0, 0
+	}
+	w := len(src[0])
+	tolSq := tolerance * tolerance
+
+	for y := range h {
+		for x := range w {
+			if !src[y][x] {
+				continue
+			}
+			count++
+		search:
+			for dy := -tolerance; dy <= tolerance; dy++ {
+				yy := y + dy
+				if yy < 0 || yy >= h {
+					continue
+				}
+				for dx := -tolerance; dx <= tolerance; dx++ {
+					xx := x + dx
+					if xx < 0 || xx >= w || dx*dx+dy*dy > tolSq {
+						continue
+					}
+					if dst[yy][xx] {
+						matched++
+						break search
+					}
+				}
+			}
+		}
+	}
+	return count, matched
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+func rectMask(w, h int, r image.Rectangle) *image.Gray {
+	mask := image.NewGray(image.Rect(0, 0, w, h))
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			mask.Pix[mask.PixOffset(x, y)] = 255
+		}
+	}
+	return mask
+}
+
+func TestIoUAndDice(t *testing.T) {
+	a := rectMask(10, 10, image.Rect(0, 0, 4, 10)) // 40 px
+	b := rectMask(10, 10, image.Rect(2, 0, 6, 10)) // 40 px, 20 shared
+
+	iou, err := IoU(a, b, DefaultThreshold)
+	if err != nil {
+		t.Fatalf("IoU failed: %v", err)
+	}
+	if math.Abs(iou-20.0/60.0) > 1e-9 {
+		t.Errorf("expected IoU 0.333, got %f", iou)
+	}
+
+	dice, err := Dice(a, b, DefaultThreshold)
+	if err != nil {
+		t.Fatalf("Dice failed: %v", err)
+	}
+	if math.Abs(dice-0.5) > 1e-9 {
+		t.Errorf("expected Dice 0.5, got %f", dice)
+	}
+
+	t.Run("Empty", func(t *testing.T) {
+		empty := image.NewGray(image.Rect(0, 0, 5, 5))
+		if v, _ := IoU(empty, empty, DefaultThreshold); v != 1 {
+			t.Errorf("expected IoU 1 for empty masks, got %f", v)
+		}
+		if v, _ := Dice(empty, empty, DefaultThreshold); v != 1 {
+			t.Errorf("expected Dice 1 for empty masks, got %f", v)
+		}
+	})
+
+	t.Run("SizeMismatch", func(t *testing.T) {
+		if _, err := IoU(a, image.NewGray(image.Rect(0, 0, 5, 5)), DefaultThreshold); err == nil {
+			t.Errorf("expected error for mismatched sizes")
+		}
+	})
+}
+
+func TestBoundaryFScore(t *testing.T) {
+	truth := rectMask(40, 40, image.Rect(10, 10, 30, 30))
+
+	t.Run("Identical", func(t *testing.T) {
+		f, err := BoundaryFScore(truth, truth, DefaultThreshold, 0)
+		if err != nil {
+			t.Fatalf("BoundaryFScore failed: %v", err)
+		}
+		if f != 1 {
+			t.Errorf("expected F 1, got %f", f)
+		}
+	})
+
+	t.Run("ShiftedWithinTolerance", func(t *testing.T) {
+		pred := rectMask(40, 40, image.Rect(11, 10, 31, 30))
+		strict, _ := BoundaryFScore(pred, truth, DefaultThreshold, 0)
+		loose, _ := BoundaryFScore(pred, truth, DefaultThreshold, 2)
+		if loose != 1 {
+			t.Errorf("expected F 1 with tolerance 2, got %f", loose)
+		}
+		if strict >= loose {
+			t.Errorf("expected strict score %f below tolerant score %f", strict, loose)
+		}
+	})
+
+	t.Run("Disjoint", func(t *testing.T) {
+		pred := rectMask(40, 40, image.Rect(0, 0, 4, 4))
+		f, _ := BoundaryFScore(pred, truth, DefaultThreshold, 1)
+		if f != 0 {
+			t.Errorf("expected F 0 for disjoint masks, got %f", f)
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package rmbg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/color"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingMetrics struct {
+	mu     sync.Mutex
+	stages []string
+	errors []string
+	pixels []int
+}
+
+func (m *recordingMetrics) ObserveLatency(stage string, _ time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stages = append(m.stages, stage)
+}
+
+func (m *recordingMetrics) IncErrors(kind string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.errors = append(m.errors, kind)
+}
+
+func (m *recordingMetrics) ObserveImageSize(pixels int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pixels = append(m.pixels, pixels)
+}
+
+func TestMetrics(t *testing.T) {
+	img := solidImage(20, 10, color.NRGBA{R: 255, A: 255})
+	r := cachedEngine(img)
+	metrics := &recordingMetrics{}
+	r.metrics = metrics
+
+	if _, err := r.Process(img); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if len(metrics.pixels) != 1 || metrics.pixels[0] != 200 {
+		t.Errorf("expected one image of 200 pixels, got %v", metrics.pixels)
+	}
+	if !slices.Equal(metrics.stages, []string{StageUpsample, StageBlend}) {
+		t.Errorf("expected upsample and blend latencies, got %v", metrics.stages)
+	}
+
+	if _, err := r.ProcessReader(bytes.NewReader([]byte("not an image")), nil); err == nil {
+		t.Fatalf("expected decode error")
+	}
+	if len(metrics.errors) != 1 || metrics.errors[0] != ErrorKindDecode {
+		t.Errorf("expected one decode error, got %v", metrics.errors)
+	}
+}
+
+func TestErrorKind(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{ErrClosed, ErrorKindClosed},
+		{&InferenceError{Model: "u2netp", Err: errors.New("boom")}, ErrorKindInference},
+		{fmt.Errorf("decode: %w", ErrImageTooLarge), ErrorKindDecode},
+		{errors.New("person detection failed"), ErrorKindOther},
+	}
+	for _, tt := range tests {
+		if got := errorKind(tt.err); got != tt.want {
+			t.Errorf("expected %s for %v, got %s", tt.want, tt.err, got)
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package rmbg
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+)
+
+// OutputKind describes how a model's raw output is turned into a mask
+type OutputKind int
+
+const (
+	// OutputLogits is a saliency map of logits, binarized with sigmoid + Otsu (U²-Net family)
+	OutputLogits OutputKind = iota
+	// OutputAlpha is an alpha matte in [0, 1] that is used as-is (MODNet and other matting models)
+	OutputAlpha
+	// OutputSoftLogits is a saliency map of logits kept soft after the sigmoid
+	OutputSoftLogits
+)
+
+// ModelSpec describes the inputs, outputs and normalization of a segmentation model
+type ModelSpec struct {
+	// Name identifies the model in logs and metadata
+	Name string
+	// InputName is the name of the image input tensor
+	InputName string
+	// OutputName is the name of the mask output tensor
+	OutputName string
+	// InputSize is the square resolution the image is resized to before inference
+	InputSize int
+	// Mean and Std normalize each RGB channel after scaling to [0, 1]
+	Mean, Std [3]float32
+	// Output is the kind of map produced by the model
+	Output OutputKind
+	// Classes names the output planes of multi-class models, which output one
+	// plane of logits per class (1×C×N×N). Their softmax probabilities are
+	// summed over Config.TargetClasses and the sum is decoded according to
+	// Output: OutputAlpha keeps it as a soft mask, OutputLogits binarizes it.
+	Classes []string
+}
+
+var (
+	// ModelU2NetP is the small U²-Net model (u2netp.onnx)
+	ModelU2NetP = ModelSpec{
+		Name:       "u2netp",
+		InputName:  "input.1",
+		OutputName: "1959",
+		InputSize:  inputSize,
+		Mean:       mean,
+		Std:        std,
+		Output:     OutputLogits,
+	}
+	// ModelU2Net is the full U²-Net model (u2net.onnx)
+	ModelU2Net = ModelSpec{
+		Name:       "u2net",
+		InputName:  "input.1",
+		OutputName: "1959",
+		InputSize:  inputSize,
+		Mean:       mean,
+		Std:        std,
+		Output:     OutputLogits,
+	}
+	// ModelU2NetHumanSeg is U²-Net trained for human segmentation (u2net_human_seg.onnx)
+	ModelU2NetHumanSeg = ModelSpec{
+		Name:       "u2net_human_seg",
+		InputName:  "input.1",
+		OutputName: "1959",
+		InputSize:  inputSize,
+		Mean:       mean,
+		Std:        std,
+		Output:     OutputLogits,
+	}
+	// ModelMODNet is the MODNet portrait matting model, which outputs a soft alpha matte
+	ModelMODNet = ModelSpec{
+		Name:       "modnet",
+		InputName:  "input",
+		OutputName: "output",
+		InputSize:  512,
+		Mean:       [3]float32{0.5, 0.5, 0.5},
+		Std:        [3]float32{0.5, 0.5, 0.5},
+		Output:     OutputAlpha,
+	}
+	// ModelSkySeg is U²-Net trained for sky segmentation (skyseg.onnx), whose
+	// mask is the sky, see ReplaceSky
+	ModelSkySeg = ModelSpec{
+		Name:       "skyseg",
+		InputName:  "input.1",
+		OutputName: "1959",
+		InputSize:  inputSize,
+		Mean:       mean,
+		Std:        std,
+		Output:     OutputSoftLogits,
+	}
+	// ModelClothSeg is U²-Net trained for garment segmentation
+	// (u2net_cloth_seg.onnx), with one class per kind of garment, see Garment
+	ModelClothSeg = ModelSpec{
+		Name:       "u2net_cloth_seg",
+		InputName:  "input.1",
+		OutputName: "1959",
+		InputSize:  768,
+		Mean:       mean,
+		Std:        std,
+		Output:     OutputAlpha,
+		Classes:    []string{"background", GarmentUpper.String(), GarmentLower.String(), GarmentFull.String()},
+	}
+)
+
+// model is a pool of ONNX sessions together with its spec and staging buffers
+type model struct {
+	spec     ModelSpec
+	sessions *sessionPool
+	inputs   *floatPool
+	outputs  *floatPool
+
+	closeOnce sync.Once
+	// users counts the calls holding the model, see RemBG.acquireModel
+	users sync.WaitGroup
+	// generation is incremented by every reload of the default model
+	generation uint64
+	// letterbox keeps the aspect ratio of images in the model input, see
+	// Config.Letterbox
+	letterbox bool
+	// external is set when the sessions run on a Config.Backend, which does
+	// not hold a reference on the ONNX Runtime environment
+	external bool
+	// scales are the same model at the other input sizes of Config.Scales,
+	// whose probability maps predict averages with its own
+	scales []*model
+	// flip also runs the model on the mirrored image, see Config.FlipTTA
+	flip bool
+	// members are the further models of Config.Ensemble, fused with this one
+	// by fusion
+	members []ensembleMember
+	fusion  Fusion
+	// targets are the indices of the classes of a multi-class model that form
+	// the mask, see Config.TargetClasses
+	targets []int
+}
+
+// fallbackBackend loads a model on a backend that needs no ONNX Runtime. It is
+// set by builds with the purego tag, see purego.go.
+var fallbackBackend func(modelPath string) (Backend, error)
+
+// loadFallback loads modelPath on fallbackBackend when ONNX Runtime could not
+// be loaded with err. It returns err unchanged when there is no fallback.
+func loadFallback(config *Config, modelPath string, err error) (Backend, error) {
+	if fallbackBackend == nil || !errors.Is(err, ErrRuntimeUnavailable) {
+		return nil, err
+	}
+	backend, ferr := fallbackBackend(modelPath)
+	if ferr != nil {
+		return nil, fmt.Errorf("%w; pure-Go fallback: %w", err, ferr)
+	}
+	if config.Logger != nil {
+		config.Logger.Warn("ONNX Runtime unavailable, using the pure-Go backend", slog.String("model", modelPath), slog.Any("error", err))
+	}
+	return backend, nil
+}
+
+func newModel(config *Config, modelPath string, spec ModelSpec) (*model, error) {
+	if config.SoftMask && spec.Output == OutputLogits {
+		spec.Output = OutputSoftLogits
+	}
+	if err := validateSpec(spec); err != nil {
+		return nil, err
+	}
+	targets, err := classTargets(spec, config.TargetClasses)
+	if err != nil {
+		return nil, err
+	}
+	var sessions []session
+	backend := config.Backend
+	if backend == nil {
+		if err := checkModelFile(modelPath); err != nil {
+			return nil, err
+		}
+		if err := acquireEnv(config.ORTLibraryPath); err != nil {
+			if backend, err = loadFallback(config, modelPath, err); err != nil {
+				return nil, err
+			}
+		} else if sessions, err = newORTSessions(config, modelPath, spec); err != nil {
+			releaseEnv()
+			return nil, err
+		}
+	}
+	if backend != nil {
+		sessions = make([]session, max(1, config.Sessions))
+		for i := range sessions {
+			sessions[i] = &backendSession{backend: backend}
+		}
+	}
+
+	size := spec.InputSize * spec.InputSize
+	m := &model{
+		spec:      spec,
+		sessions:  newSessionPool(sessions),
+		external:  backend != nil,
+		inputs:    newFloatPool(3 * size),
+		outputs:   newFloatPool(spec.channels() * size),
+		letterbox: config.Letterbox,
+		flip:      config.FlipTTA,
+		targets:   targets,
+	}
+	if len(config.Scales) > 0 {
+		scales, err := newScaleModels(config, modelPath, spec)
+		if err != nil {
+			_ = m.close()
+			return nil, err
+		}
+		m.scales = scales
+	}
+	return m, nil
+}
+
+// close waits for running inferences, destroys the sessions and releases the
+// environment. Later calls do nothing.
+func (m *model) close() error {
+	if m.sessions == nil {
+		return nil
+	}
+	var err error
+	m.closeOnce.Do(func() {
+		err = m.sessions.close()
+		if !m.external {
+			releaseEnv()
+		}
+		for _, s := range m.scales {
+			if serr := s.close(); err == nil {
+				err = serr
+			}
+		}
+		for _, member := range m.members {
+			if merr := member.model.close(); err == nil {
+				err = merr
+			}
+		}
+	})
+	return err
+}
+
+// runData copies input into a free session, runs it and copies its output to
+// output. The session is only held while it runs.
+func (m *model) runData(input, output []float32) error {
+	s, ok := m.sessions.acquire()
+	if !ok {
+		return ErrClosed
+	}
+	defer m.sessions.release(s)
+	return s.run(input, output)
+}
+
+// prediction is a mask at the model resolution together with its confidence
+type prediction struct {
+	mask       *image.Gray
+	confidence Confidence
+	timing     stageTimes
+	// model is the name of the model that produced the mask
+	model string
+	// downscale is set when the mask was computed on a shrunk copy
+	downscale *Downscale
+}
+
+// predict runs the model and returns a mask at the model resolution, or at
+// the largest resolution of its scales and ensemble members
+func (m *model) predict(img image.Image) (*prediction, error) {
+	if len(m.scales) > 0 || m.flip || len(m.members) > 0 {
+		return m.predictEnsemble(img)
+	}
+	t0 := time.Now()
+	area := m.inputArea(img.Bounds().Size())
+	input := m.preprocess(img, area)
+
+	t1 := time.Now()
+	output, err := m.infer(input)
+	if err != nil {
+		return nil, err
+	}
+
+	t2 := time.Now()
+	pred := m.decode(output, area)
+	pred.timing = stageTimes{
+		preprocess: t1.Sub(t0),
+		inference:  t2.Sub(t1),
+		decode:     time.Since(t2),
+	}
+	return pred, nil
+}
+
+// inputArea returns the rectangle of the model input an image of imgSize is
+// resized to: the whole input, or its letterboxed area
+func (m *model) inputArea(imgSize image.Point) image.Rectangle {
+	size := m.spec.InputSize
+	if m.letterbox {
+		return letterboxArea(imgSize, size)
+	}
+	return image.Rect(0, 0, size, size)
+}
+
+// preprocess resizes and normalizes img into area of a pooled input buffer
+func (m *model) preprocess(img image.Image, area image.Rectangle) *[]float32 {
+	input := m.inputs.get()
+	resizeNormalizeArea(*input, img, m.spec.InputSize, area, m.spec.Mean, m.spec.Std)
+	return input
+}
+
+// infer runs a session on input, returning it to the pool, and returns a
+// pooled output buffer to be passed to decode
+func (m *model) infer(input *[]float32) (*[]float32, error) {
+	defer m.inputs.put(input)
+	output := m.outputs.get()
+	if err := m.runData(*input, *output); err != nil {
+		m.outputs.put(output)
+		return nil, &InferenceError{Model: m.spec.Name, Err: err}
+	}
+	return output, nil
+}
+
+// decode converts the area of output the image was resized to into a mask,
+// and returns output to the pool
+func (m *model) decode(output *[]float32, area image.Rectangle) *prediction {
+	defer m.outputs.put(output)
+	pred := maskFromPlane(m.planeOf(*output, area), area.Dx(), area.Dy(), m.spec.Output)
+	pred.model = m.spec.Name
+	return pred
+}
+
+// areaOf returns the values of the output plane inside area, the output
+// itself when area covers it
+func (m *model) areaOf(output []float32, area image.Rectangle) []float32 {
+	size := m.spec.InputSize
+	if area.Size() == image.Pt(size, size) {
+		return output
+	}
+	// Drop the letterbox padding, so it counts neither in the mask nor in the
+	// confidence
+	data := make([]float32, 0, area.Dx()*area.Dy())
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		data = append(data, output[y*size+area.Min.X:][:area.Dx()]...)
+	}
+	return data
+}
+
+// maskFromOutput converts a raw size x size model output plane to a mask
+func maskFromOutput(data []float32, size int, kind OutputKind) *prediction {
+	return maskFromPlane(data, size, size, kind)
+}
+
+// maskFromPlane converts a width x height plane of model output to a mask
+func maskFromPlane(data []float32, width, height int, kind OutputKind) *prediction {
+	maskImg := image.NewGray(image.Rect(0, 0, width, height))
+	probs := make([]float32, len(data))
+
+	switch kind {
+	case OutputAlpha:
+		for i, v := range data {
+			probs[i] = max(0, min(1, v))
+			maskImg.Pix[i] = uint8(math.Round(float64(probs[i]) * 255))
+		}
+		return &prediction{
+			mask:       maskImg,
+			confidence: computeConfidence(probs, 0.5),
+		}
+	case OutputSoftLogits:
+		for i, v := range data {
+			probs[i] = sigmoid(v)
+			maskImg.Pix[i] = uint8(probs[i]*255 + 0.5)
+		}
+		return &prediction{
+			mask:       maskImg,
+			confidence: computeConfidence(probs, 0.5),
+		}
+	}
+
+	hist := sigmoidHistogram(probs, data)
+	threshold := otsuFromHistogram(&hist, len(data))
+	binarize(maskImg.Pix, probs, threshold)
+
+	return &prediction{
+		mask:       maskImg,
+		confidence: computeConfidence(probs, threshold),
+	}
+}
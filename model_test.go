@@ -0,0 +1,75 @@
+//go:build cgo
+
+package rmbg
+
+import (
+	"testing"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+func TestMaskFromOutput(t *testing.T) {
+	t.Run("Alpha", func(t *testing.T) {
+		data := []float32{-0.5, 0, 0.5, 1, 1.5, 0.25, 0.75, 1, 0}
+		mask := maskFromOutput(data, 3, OutputAlpha).mask
+		want := []uint8{0, 0, 128, 255, 255, 64, 191, 255, 0}
+		for i, v := range want {
+			if mask.Pix[i] != v {
+				t.Errorf("at %d, expected %d, got %d", i, v, mask.Pix[i])
+			}
+		}
+	})
+
+	t.Run("LogitsAreBinarized", func(t *testing.T) {
+		data := make([]float32, 16)
+		for i := range data {
+			if i%2 == 0 {
+				data[i] = 5
+			} else {
+				data[i] = -5
+			}
+		}
+		mask := maskFromOutput(data, 4, OutputLogits).mask
+		for i, v := range mask.Pix {
+			if v != 0 && v != 255 {
+				t.Errorf("at %d, expected binary value, got %d", i, v)
+			}
+		}
+	})
+
+	t.Run("SoftLogits", func(t *testing.T) {
+		data := []float32{-20, 0, 20, -1}
+		mask := maskFromOutput(data, 2, OutputSoftLogits).mask
+		want := []uint8{0, 128, 255, 69}
+		for i, v := range want {
+			if mask.Pix[i] != v {
+				t.Errorf("at %d, expected %d, got %d", i, v, mask.Pix[i])
+			}
+		}
+	})
+}
+
+func TestModelSpecs(t *testing.T) {
+	for _, spec := range []ModelSpec{ModelU2NetP, ModelU2Net, ModelU2NetHumanSeg, ModelMODNet} {
+		if spec.Name == "" || spec.InputName == "" || spec.OutputName == "" || spec.InputSize <= 0 {
+			t.Errorf("incomplete model spec: %+v", spec)
+		}
+	}
+	if ModelMODNet.Output != OutputAlpha {
+		t.Errorf("expected MODNet to output an alpha matte")
+	}
+}
+
+func TestSessionThreading(t *testing.T) {
+	config := &Config{IntraOpNumThreads: 4, InterOpNumThreads: 2}
+	intra, inter, mode := sessionThreading(config)
+	if intra != 4 || inter != 2 || mode != ort.ExecutionModeParallel {
+		t.Errorf("expected configured threads in parallel mode, got %d, %d, %v", intra, inter, mode)
+	}
+
+	config.Deterministic = true
+	intra, inter, mode = sessionThreading(config)
+	if intra != 1 || inter != 1 || mode != ort.ExecutionModeSequential {
+		t.Errorf("expected one thread in sequential mode, got %d, %d, %v", intra, inter, mode)
+	}
+}
@@ -0,0 +1,165 @@
+// Package onnxgo is a minimal pure-Go ONNX interpreter. It covers the
+// operators of the U²-Net family of segmentation models, so that rmbg can run
+// them without cgo or the ONNX Runtime shared library, at the cost of speed.
+package onnxgo
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Model is a loaded ONNX graph. It is safe for concurrent use.
+type Model struct {
+	graph *graph
+	// lastUse maps each intermediate value to the index of the last node
+	// reading it, so Eval can drop it once it is no longer needed
+	lastUse map[string]int
+}
+
+// Load reads an ONNX model from path
+func Load(path string) (*Model, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read model: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse reads a serialized ONNX model. It fails if the graph uses an operator
+// the interpreter does not implement.
+func Parse(data []byte) (*Model, error) {
+	g, err := parseModel(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse model: %w", err)
+	}
+
+	var unsupported []string
+	seen := make(map[string]bool)
+	for _, n := range g.nodes {
+		if _, ok := operators[n.op]; !ok && !seen[n.op] {
+			seen[n.op] = true
+			unsupported = append(unsupported, n.op)
+		}
+	}
+	if len(unsupported) > 0 {
+		sort.Strings(unsupported)
+		return nil, fmt.Errorf("unsupported operators: %s", strings.Join(unsupported, ", "))
+	}
+	if len(g.outputs) == 0 {
+		return nil, fmt.Errorf("model has no outputs")
+	}
+
+	m := &Model{graph: g, lastUse: make(map[string]int)}
+	for i, n := range g.nodes {
+		for _, name := range n.inputs {
+			m.lastUse[name] = i
+		}
+	}
+	for _, name := range g.outputs {
+		m.lastUse[name] = len(g.nodes)
+	}
+	return m, nil
+}
+
+// Inputs returns the names of the graph inputs that are not initializers
+func (m *Model) Inputs() []string {
+	var names []string
+	for _, name := range m.graph.inputs {
+		if _, ok := m.graph.initializers[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Outputs returns the names of the graph outputs
+func (m *Model) Outputs() []string {
+	return m.graph.outputs
+}
+
+// Eval runs the graph on inputs, keyed by input name, and returns its outputs
+// keyed by output name. Inputs are not modified.
+func (m *Model) Eval(inputs map[string]*Tensor) (map[string]*Tensor, error) {
+	values := make(map[string]*Tensor, len(inputs))
+	for _, name := range m.Inputs() {
+		t, ok := inputs[name]
+		if !ok {
+			return nil, fmt.Errorf("missing input %s", name)
+		}
+		values[name] = t
+	}
+
+	for i, n := range m.graph.nodes {
+		in := make([]*Tensor, len(n.inputs))
+		for j, name := range n.inputs {
+			if name == "" {
+				// Omitted optional input
+				continue
+			}
+			t, ok := values[name]
+			if !ok {
+				if t, ok = m.graph.initializers[name]; !ok {
+					return nil, fmt.Errorf("node %d (%s): undefined input %s", i, n.op, name)
+				}
+			}
+			in[j] = t
+		}
+
+		out, err := operators[n.op](n, in)
+		if err != nil {
+			return nil, fmt.Errorf("node %d (%s): %w", i, n.op, err)
+		}
+		for j, name := range n.outputs {
+			if j < len(out) && name != "" {
+				values[name] = out[j]
+			}
+		}
+
+		for _, name := range n.inputs {
+			if last, ok := m.lastUse[name]; ok && last == i {
+				delete(values, name)
+			}
+		}
+	}
+
+	outputs := make(map[string]*Tensor, len(m.graph.outputs))
+	for _, name := range m.graph.outputs {
+		t, ok := values[name]
+		if !ok {
+			if t, ok = m.graph.initializers[name]; !ok {
+				return nil, fmt.Errorf("output %s was not computed", name)
+			}
+		}
+		outputs[name] = t
+	}
+	return outputs, nil
+}
+
+// Run implements rmbg.Backend: it feeds input, a 1×3×N×N image, to the first
+// graph input and copies the first graph output, a 1×1×N×N map, to output
+func (m *Model) Run(input, output []float32) error {
+	inputs := m.Inputs()
+	if len(inputs) != 1 {
+		return fmt.Errorf("expected a single model input, got %d", len(inputs))
+	}
+	size := int(math.Sqrt(float64(len(input) / 3)))
+	if 3*size*size != len(input) {
+		return fmt.Errorf("input of length %d is not a 1×3×N×N image", len(input))
+	}
+
+	outputs, err := m.Eval(map[string]*Tensor{
+		inputs[0]: {Shape: []int{1, 3, size, size}, Float: input},
+	})
+	if err != nil {
+		return err
+	}
+	out := outputs[m.graph.outputs[0]]
+	if out.isInt() || len(out.Float) != len(output) {
+		return fmt.Errorf("expected output of %d floats, got %v", len(output), out)
+	}
+	copy(output, out.Float)
+	return nil
+}
@@ -0,0 +1,150 @@
+package onnxgo
+
+import (
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+)
+
+// message encodes protobuf fields for building test models
+type message []byte
+
+func (m message) varint(num int, v uint64) message {
+	m = binary.AppendUvarint(m, uint64(num<<3|wireVarint))
+	return binary.AppendUvarint(m, v)
+}
+
+func (m message) bytes(num int, b []byte) message {
+	m = binary.AppendUvarint(m, uint64(num<<3|wireBytes))
+	m = binary.AppendUvarint(m, uint64(len(b)))
+	return append(m, b...)
+}
+
+func (m message) str(num int, s string) message {
+	return m.bytes(num, []byte(s))
+}
+
+func floatTensor(name string, shape []int, data []float32) message {
+	var m message
+	for _, d := range shape {
+		m = m.varint(tensorDims, uint64(d))
+	}
+	m = m.varint(tensorDataType, dataFloat).str(tensorName, name)
+	var raw []byte
+	for _, v := range data {
+		raw = binary.LittleEndian.AppendUint32(raw, math.Float32bits(v))
+	}
+	return m.bytes(tensorRawData, raw)
+}
+
+func nodeProto(op string, in, out []string, attrs ...message) message {
+	var m message
+	for _, s := range in {
+		m = m.str(nodeInput, s)
+	}
+	for _, s := range out {
+		m = m.str(nodeOutput, s)
+	}
+	m = m.str(nodeOpType, op)
+	for _, a := range attrs {
+		m = m.bytes(nodeAttribute, a)
+	}
+	return m
+}
+
+func intAttr(name string, v int64) message {
+	return message{}.str(attrName, name).varint(attrI, uint64(v))
+}
+
+// modelProto wraps nodes in a graph reading "x" and writing "y"
+func modelProto(initializers []message, nodes ...message) []byte {
+	var g message
+	for _, n := range nodes {
+		g = g.bytes(graphNode, n)
+	}
+	for _, t := range initializers {
+		g = g.bytes(graphInitializer, t)
+	}
+	g = g.bytes(graphInput, message{}.str(valueInfoName, "x"))
+	g = g.bytes(graphOutput, message{}.str(valueInfoName, "y"))
+	return message{}.varint(1, 8).bytes(modelGraph, g)
+}
+
+// sumModel averages the three channels of the input with a 1×1 convolution
+// and applies a sigmoid
+func sumModel() []byte {
+	w := floatTensor("w", []int{1, 3, 1, 1}, []float32{1, 1, 1})
+	b := floatTensor("b", []int{1}, []float32{-1.5})
+	return modelProto([]message{w, b},
+		nodeProto("Conv", []string{"x", "w", "b"}, []string{"c"}, intAttr("group", 1)),
+		nodeProto("Sigmoid", []string{"c"}, []string{"y"}),
+	)
+}
+
+func TestParse(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		m, err := Parse(sumModel())
+		if err != nil {
+			t.Fatalf("parse failed: %v", err)
+		}
+		if in := m.Inputs(); len(in) != 1 || in[0] != "x" {
+			t.Errorf("expected inputs [x], got %v", in)
+		}
+		if out := m.Outputs(); len(out) != 1 || out[0] != "y" {
+			t.Errorf("expected outputs [y], got %v", out)
+		}
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		_, err := Parse(modelProto(nil, nodeProto("LSTM", []string{"x"}, []string{"y"})))
+		if err == nil || !strings.Contains(err.Error(), "LSTM") {
+			t.Errorf("expected unsupported LSTM error, got %v", err)
+		}
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		data := sumModel()
+		if _, err := Parse(data[:len(data)-3]); err == nil {
+			t.Errorf("expected error for truncated model")
+		}
+	})
+
+	t.Run("External", func(t *testing.T) {
+		w := floatTensor("w", []int{1}, []float32{1}).varint(tensorLocation, 1)
+		if _, err := Parse(modelProto([]message{w}, nodeProto("Identity", []string{"x"}, []string{"y"}))); err == nil {
+			t.Errorf("expected error for external data")
+		}
+	})
+}
+
+func TestRun(t *testing.T) {
+	m, err := Parse(sumModel())
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	// Channels sum to 0, 1.5 and 3 in turn
+	input := []float32{
+		0, 0.5, 1, 0,
+		0, 0.5, 1, 0,
+		0, 0.5, 1, 0,
+	}
+	output := make([]float32, 4)
+	if err := m.Run(input, output); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	expected := []float32{sigmoid(-1.5), sigmoid(0), sigmoid(1.5), sigmoid(-1.5)}
+	for i, v := range output {
+		if math.Abs(float64(v-expected[i])) > 1e-6 {
+			t.Errorf("expected %v at %d, got %v", expected[i], i, v)
+		}
+	}
+
+	if err := m.Run(input[:9], output); err == nil {
+		t.Errorf("expected error for non-square input")
+	}
+	if err := m.Run(input, make([]float32, 3)); err == nil {
+		t.Errorf("expected error for mismatched output")
+	}
+}
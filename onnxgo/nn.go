@@ -0,0 +1,439 @@
+package onnxgo
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+)
+
+// image4D returns the dimensions of an NCHW tensor
+func image4D(t *Tensor) (n, c, h, w int, err error) {
+	if len(t.Shape) != 4 || t.isInt() {
+		return 0, 0, 0, 0, fmt.Errorf("expected a 4D float tensor, got %v", t)
+	}
+	return t.Shape[0], t.Shape[1], t.Shape[2], t.Shape[3], nil
+}
+
+// window holds the 2D kernel geometry of Conv and MaxPool
+type window struct {
+	kh, kw                   int
+	sh, sw                   int
+	dh, dw                   int
+	top, left, bottom, right int
+}
+
+func newWindow(n *node, kh, kw int) (window, error) {
+	if p := n.string("auto_pad", "NOTSET"); p != "NOTSET" && p != "VALID" {
+		return window{}, fmt.Errorf("unsupported auto_pad %s", p)
+	}
+	w := window{kh: kh, kw: kw, sh: 1, sw: 1, dh: 1, dw: 1}
+	if s := n.ints("strides"); len(s) == 2 {
+		w.sh, w.sw = int(s[0]), int(s[1])
+	}
+	if d := n.ints("dilations"); len(d) == 2 {
+		w.dh, w.dw = int(d[0]), int(d[1])
+	}
+	if p := n.ints("pads"); len(p) == 4 {
+		w.top, w.left, w.bottom, w.right = int(p[0]), int(p[1]), int(p[2]), int(p[3])
+	}
+	if w.sh <= 0 || w.sw <= 0 || w.dh <= 0 || w.dw <= 0 {
+		return window{}, errors.New("strides and dilations must be positive")
+	}
+	return w, nil
+}
+
+// outputSize returns the output length along one axis
+func outputSize(in, k, s, d, before, after int, ceil bool) int {
+	span := in + before + after - (k-1)*d - 1
+	if span < 0 {
+		return 0
+	}
+	out := span/s + 1
+	if ceil && span%s != 0 {
+		out++
+		// The last window must start inside the input or its leading padding
+		if (out-1)*s >= in+before {
+			out--
+		}
+	}
+	return out
+}
+
+// validRange returns the output positions [lo, hi) whose tap at offset reads
+// inside an input of length in, for position o reading o*s - pad + offset
+func validRange(in, out, s, pad, offset int) (int, int) {
+	// o*s >= pad - offset
+	lo := 0
+	if v := pad - offset; v > 0 {
+		lo = (v + s - 1) / s
+	}
+	// o*s <= in - 1 + pad - offset
+	v := in - 1 + pad - offset
+	if v < 0 {
+		return 0, 0
+	}
+	return lo, min(v/s+1, out)
+}
+
+// parallel runs f for each i in [0, n) on up to GOMAXPROCS goroutines
+func parallel(n int, f func(i int)) {
+	workers := min(runtime.GOMAXPROCS(0), n)
+	if workers <= 1 {
+		for i := range n {
+			f(i)
+		}
+		return
+	}
+	var wg sync.WaitGroup
+	next := make(chan int, n)
+	for i := range n {
+		next <- i
+	}
+	close(next)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				f(i)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func conv(n *node, in []*Tensor) ([]*Tensor, error) {
+	if err := inputs(in, 2); err != nil {
+		return nil, err
+	}
+	x, weights, bias := in[0], in[1], optional(in, 2)
+	batch, c, h, w, err := image4D(x)
+	if err != nil {
+		return nil, err
+	}
+	m, cg, kh, kw, err := image4D(weights)
+	if err != nil {
+		return nil, fmt.Errorf("weights: %w", err)
+	}
+	group := int(n.int("group", 1))
+	if group <= 0 || c%group != 0 || m%group != 0 || c/group != cg {
+		return nil, fmt.Errorf("weights %v do not match input %v with %d groups", weights.Shape, x.Shape, group)
+	}
+	if bias != nil && len(bias.floats()) != m {
+		return nil, fmt.Errorf("bias %v does not match %d output channels", bias.Shape, m)
+	}
+	win, err := newWindow(n, kh, kw)
+	if err != nil {
+		return nil, err
+	}
+	oh := outputSize(h, kh, win.sh, win.dh, win.top, win.bottom, false)
+	ow := outputSize(w, kw, win.sw, win.dw, win.left, win.right, false)
+
+	out := make([]float32, batch*m*oh*ow)
+	src, wt := x.Float, weights.Float
+	perGroup := m / group
+	parallel(batch*m, func(i int) {
+		b, oc := i/m, i%m
+		plane := out[i*oh*ow:][:oh*ow]
+		if bias != nil {
+			v := bias.floats()[oc]
+			for j := range plane {
+				plane[j] = v
+			}
+		}
+		first := (oc / perGroup) * cg
+		for ic := range cg {
+			in := src[(b*c+first+ic)*h*w:][:h*w]
+			for ky := range kh {
+				oy0, oy1 := validRange(h, oh, win.sh, win.top, ky*win.dh)
+				for kx := range kw {
+					k := wt[((oc*cg+ic)*kh+ky)*kw+kx]
+					if k == 0 {
+						continue
+					}
+					ox0, ox1 := validRange(w, ow, win.sw, win.left, kx*win.dw)
+					if ox0 >= ox1 {
+						continue
+					}
+					for oy := oy0; oy < oy1; oy++ {
+						row := in[(oy*win.sh-win.top+ky*win.dh)*w:]
+						dst := plane[oy*ow:]
+						ix := ox0*win.sw - win.left + kx*win.dw
+						if win.sw == 1 {
+							for ox, v := range row[ix : ix+ox1-ox0] {
+								dst[ox0+ox] += k * v
+							}
+							continue
+						}
+						for ox := ox0; ox < ox1; ox++ {
+							dst[ox] += k * row[ix]
+							ix += win.sw
+						}
+					}
+				}
+			}
+		}
+	})
+	return []*Tensor{{Shape: []int{batch, m, oh, ow}, Float: out}}, nil
+}
+
+func batchNormalization(n *node, in []*Tensor) ([]*Tensor, error) {
+	if err := inputs(in, 5); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	if len(x.Shape) < 2 || x.isInt() {
+		return nil, fmt.Errorf("expected a float tensor of rank 2 or more, got %v", x)
+	}
+	c := x.Shape[1]
+	scale, bias, mean, variance := in[1].floats(), in[2].floats(), in[3].floats(), in[4].floats()
+	if len(scale) != c || len(bias) != c || len(mean) != c || len(variance) != c {
+		return nil, fmt.Errorf("parameters do not match %d channels", c)
+	}
+	eps := float64(n.float("epsilon", 1e-5))
+
+	inner := x.Size() / (x.Shape[0] * c)
+	out := make([]float32, len(x.Float))
+	for i := range x.Shape[0] * c {
+		ch := i % c
+		a := scale[ch] / float32(math.Sqrt(float64(variance[ch])+eps))
+		b := bias[ch] - mean[ch]*a
+		for j, v := range x.Float[i*inner:][:inner] {
+			out[i*inner+j] = v*a + b
+		}
+	}
+	return []*Tensor{{Shape: x.Shape, Float: out}}, nil
+}
+
+func maxPool(n *node, in []*Tensor) ([]*Tensor, error) {
+	if err := inputs(in, 1); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	batch, c, h, w, err := image4D(x)
+	if err != nil {
+		return nil, err
+	}
+	k := n.ints("kernel_shape")
+	if len(k) != 2 {
+		return nil, fmt.Errorf("expected a 2D kernel, got %v", k)
+	}
+	win, err := newWindow(n, int(k[0]), int(k[1]))
+	if err != nil {
+		return nil, err
+	}
+	ceil := n.int("ceil_mode", 0) != 0
+	oh := outputSize(h, win.kh, win.sh, win.dh, win.top, win.bottom, ceil)
+	ow := outputSize(w, win.kw, win.sw, win.dw, win.left, win.right, ceil)
+
+	out := make([]float32, batch*c*oh*ow)
+	parallel(batch*c, func(i int) {
+		src := x.Float[i*h*w:][:h*w]
+		dst := out[i*oh*ow:][:oh*ow]
+		for oy := range oh {
+			for ox := range ow {
+				best := float32(math.Inf(-1))
+				for ky := range win.kh {
+					iy := oy*win.sh - win.top + ky*win.dh
+					if iy < 0 || iy >= h {
+						continue
+					}
+					for kx := range win.kw {
+						ix := ox*win.sw - win.left + kx*win.dw
+						if ix >= 0 && ix < w {
+							best = max(best, src[iy*w+ix])
+						}
+					}
+				}
+				dst[oy*ow+ox] = best
+			}
+		}
+	})
+	return []*Tensor{{Shape: []int{batch, c, oh, ow}, Float: out}}, nil
+}
+
+// resizeParams describes a spatial resize of an NCHW tensor
+type resizeParams struct {
+	mode      string
+	transform string
+	nearest   string
+	// scaleH and scaleW are set from scales, or derived from sizes
+	scaleH, scaleW float64
+	oh, ow         int
+}
+
+func resize(n *node, in []*Tensor) ([]*Tensor, error) {
+	if err := inputs(in, 1); err != nil {
+		return nil, err
+	}
+	p := resizeParams{
+		mode:      n.string("mode", "nearest"),
+		transform: n.string("coordinate_transformation_mode", "half_pixel"),
+		nearest:   n.string("nearest_mode", "round_prefer_floor"),
+	}
+	scales, sizes := optional(in, 2), optional(in, 3)
+	if len(in) == 2 {
+		// Opset 10 takes scales as the second input and has no coordinate
+		// transformation attribute
+		scales, p.transform = in[1], "asymmetric"
+	}
+	return resample(in[0], scales, sizes, p)
+}
+
+func upsample(n *node, in []*Tensor) ([]*Tensor, error) {
+	if err := inputs(in, 1); err != nil {
+		return nil, err
+	}
+	p := resizeParams{
+		mode:      n.string("mode", "nearest"),
+		transform: "asymmetric",
+		nearest:   "floor",
+	}
+	scales := optional(in, 1)
+	if scales == nil {
+		s := n.attrs["scales"]
+		if s == nil {
+			return nil, errors.New("upsample has no scales")
+		}
+		scales = &Tensor{Shape: []int{len(s.floats)}, Float: s.floats}
+	}
+	return resample(in[0], scales, nil, p)
+}
+
+// resample resizes the two spatial dimensions of x to sizes, or by scales
+func resample(x, scales, sizes *Tensor, p resizeParams) ([]*Tensor, error) {
+	batch, c, h, w, err := image4D(x)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case sizes != nil && sizes.Size() > 0:
+		s := sizes.ints()
+		if len(s) != 4 || int(s[0]) != batch || int(s[1]) != c {
+			return nil, fmt.Errorf("unsupported resize sizes %v of %v", s, x.Shape)
+		}
+		p.oh, p.ow = int(s[2]), int(s[3])
+		p.scaleH, p.scaleW = float64(p.oh)/float64(h), float64(p.ow)/float64(w)
+	case scales != nil && scales.Size() > 0:
+		s := scales.floats()
+		if len(s) != 4 || s[0] != 1 || s[1] != 1 {
+			return nil, fmt.Errorf("unsupported resize scales %v", s)
+		}
+		p.scaleH, p.scaleW = float64(s[2]), float64(s[3])
+		p.oh, p.ow = int(float64(h)*p.scaleH), int(float64(w)*p.scaleW)
+	default:
+		return nil, errors.New("resize has neither scales nor sizes")
+	}
+	if p.oh <= 0 || p.ow <= 0 {
+		return nil, fmt.Errorf("invalid resize output %dx%d", p.ow, p.oh)
+	}
+
+	var ys, xs []tap
+	switch p.mode {
+	case "linear", "bilinear":
+		ys, err = linearTaps(h, p.oh, p.scaleH, p.transform)
+		if err == nil {
+			xs, err = linearTaps(w, p.ow, p.scaleW, p.transform)
+		}
+	case "nearest":
+		ys, err = nearestTaps(h, p.oh, p.scaleH, p.transform, p.nearest)
+		if err == nil {
+			xs, err = nearestTaps(w, p.ow, p.scaleW, p.transform, p.nearest)
+		}
+	default:
+		err = fmt.Errorf("unsupported resize mode %s", p.mode)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]float32, batch*c*p.oh*p.ow)
+	parallel(batch*c, func(i int) {
+		src := x.Float[i*h*w:][:h*w]
+		dst := out[i*p.oh*p.ow:][:p.oh*p.ow]
+		for oy, ty := range ys {
+			r0, r1 := src[ty.i0*w:][:w], src[ty.i1*w:][:w]
+			for ox, tx := range xs {
+				top := r0[tx.i0] + (r0[tx.i1]-r0[tx.i0])*tx.f
+				bottom := r1[tx.i0] + (r1[tx.i1]-r1[tx.i0])*tx.f
+				dst[oy*p.ow+ox] = top + (bottom-top)*ty.f
+			}
+		}
+	})
+	return []*Tensor{{Shape: []int{batch, c, p.oh, p.ow}, Float: out}}, nil
+}
+
+// tap interpolates between input positions i0 and i1 with weight f on i1
+type tap struct {
+	i0, i1 int
+	f      float32
+}
+
+// sourceCoordinate maps output position o to the input axis
+func sourceCoordinate(o, in, out int, scale float64, transform string) (float64, error) {
+	switch transform {
+	case "half_pixel":
+		return (float64(o)+0.5)/scale - 0.5, nil
+	case "pytorch_half_pixel":
+		if out == 1 {
+			return 0, nil
+		}
+		return (float64(o)+0.5)/scale - 0.5, nil
+	case "align_corners":
+		if out == 1 {
+			return 0, nil
+		}
+		return float64(o) * float64(in-1) / float64(out-1), nil
+	case "asymmetric":
+		return float64(o) / scale, nil
+	case "tf_half_pixel_for_nn":
+		return (float64(o) + 0.5) / scale, nil
+	}
+	return 0, fmt.Errorf("unsupported coordinate transformation mode %s", transform)
+}
+
+func linearTaps(in, out int, scale float64, transform string) ([]tap, error) {
+	taps := make([]tap, out)
+	for o := range taps {
+		v, err := sourceCoordinate(o, in, out, scale, transform)
+		if err != nil {
+			return nil, err
+		}
+		v = min(max(v, 0), float64(in-1))
+		i0 := int(v)
+		taps[o] = tap{i0: i0, i1: min(i0+1, in-1), f: float32(v - float64(i0))}
+	}
+	return taps, nil
+}
+
+func nearestTaps(in, out int, scale float64, transform, mode string) ([]tap, error) {
+	taps := make([]tap, out)
+	for o := range taps {
+		v, err := sourceCoordinate(o, in, out, scale, transform)
+		if err != nil {
+			return nil, err
+		}
+		var i float64
+		switch mode {
+		case "round_prefer_floor":
+			if v == math.Floor(v)+0.5 {
+				i = math.Floor(v)
+			} else {
+				i = math.Round(v)
+			}
+		case "round_prefer_ceil":
+			i = math.Floor(v + 0.5)
+		case "floor":
+			i = math.Floor(v)
+		case "ceil":
+			i = math.Ceil(v)
+		default:
+			return nil, fmt.Errorf("unsupported nearest mode %s", mode)
+		}
+		idx := int(min(max(i, 0), float64(in-1)))
+		taps[o] = tap{i0: idx, i1: idx}
+	}
+	return taps, nil
+}
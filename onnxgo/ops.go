@@ -0,0 +1,580 @@
+package onnxgo
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// operator computes the outputs of a node from its inputs. Omitted optional
+// inputs are nil. Operators must not modify their inputs.
+type operator func(n *node, in []*Tensor) ([]*Tensor, error)
+
+// operators maps the supported op types to their implementation
+var operators = map[string]operator{
+	"Add":                elementwise(func(a, b float32) float32 { return a + b }, func(a, b int64) int64 { return a + b }),
+	"BatchNormalization": batchNormalization,
+	"Cast":               cast,
+	"Ceil":               unary(func(v float32) float32 { return float32(math.Ceil(float64(v))) }),
+	"Concat":             concat,
+	"Constant":           constant,
+	"ConstantOfShape":    constantOfShape,
+	"Conv":               conv,
+	"Div":                elementwise(func(a, b float32) float32 { return a / b }, divInt),
+	"Floor":              unary(func(v float32) float32 { return float32(math.Floor(float64(v))) }),
+	"Gather":             gather,
+	"Identity":           identity,
+	"MaxPool":            maxPool,
+	"Mul":                elementwise(func(a, b float32) float32 { return a * b }, func(a, b int64) int64 { return a * b }),
+	"Relu":               unary(func(v float32) float32 { return max(v, 0) }),
+	"Reshape":            reshape,
+	"Resize":             resize,
+	"Shape":              shape,
+	"Sigmoid":            unary(sigmoid),
+	"Slice":              slice,
+	"Squeeze":            squeeze,
+	"Sub":                elementwise(func(a, b float32) float32 { return a - b }, func(a, b int64) int64 { return a - b }),
+	"Unsqueeze":          unsqueeze,
+	"Upsample":           upsample,
+}
+
+var errMissingInput = errors.New("missing input")
+
+// inputs checks that the first n inputs are present
+func inputs(in []*Tensor, n int) error {
+	if len(in) < n {
+		return fmt.Errorf("%w: expected %d, got %d", errMissingInput, n, len(in))
+	}
+	for i := range n {
+		if in[i] == nil {
+			return fmt.Errorf("%w %d", errMissingInput, i)
+		}
+	}
+	return nil
+}
+
+// optional returns input i, or nil when it is omitted
+func optional(in []*Tensor, i int) *Tensor {
+	if i < len(in) {
+		return in[i]
+	}
+	return nil
+}
+
+func (n *node) int(name string, def int64) int64 {
+	if a, ok := n.attrs[name]; ok {
+		return a.i
+	}
+	return def
+}
+
+func (n *node) float(name string, def float32) float32 {
+	if a, ok := n.attrs[name]; ok {
+		return a.f
+	}
+	return def
+}
+
+func (n *node) string(name, def string) string {
+	if a, ok := n.attrs[name]; ok {
+		return a.s
+	}
+	return def
+}
+
+func (n *node) ints(name string) []int64 {
+	if a, ok := n.attrs[name]; ok {
+		return a.ints
+	}
+	return nil
+}
+
+func sigmoid(v float32) float32 {
+	return float32(1 / (1 + math.Exp(-float64(v))))
+}
+
+// divInt divides integers rounding toward negative infinity, like the floor
+// division of shape computations exported from PyTorch
+func divInt(a, b int64) int64 {
+	if b == 0 {
+		// Undefined in ONNX; avoid the runtime panic
+		return 0
+	}
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
+
+func unary(f func(float32) float32) operator {
+	return func(n *node, in []*Tensor) ([]*Tensor, error) {
+		if err := inputs(in, 1); err != nil {
+			return nil, err
+		}
+		x := in[0].floats()
+		out := make([]float32, len(x))
+		for i, v := range x {
+			out[i] = f(v)
+		}
+		return []*Tensor{{Shape: in[0].Shape, Float: out}}, nil
+	}
+}
+
+// elementwise applies an elementwise operator with numpy-style broadcasting. The
+// result holds integers only if both operands do.
+func elementwise(f func(a, b float32) float32, fi func(a, b int64) int64) operator {
+	return func(n *node, in []*Tensor) ([]*Tensor, error) {
+		if err := inputs(in, 2); err != nil {
+			return nil, err
+		}
+		a, b := in[0], in[1]
+		shape, ia, ib, err := broadcast(a.Shape, b.Shape)
+		if err != nil {
+			return nil, err
+		}
+		if a.isInt() && b.isInt() {
+			out := make([]int64, len(ia))
+			for i := range out {
+				out[i] = fi(a.Int[ia[i]], b.Int[ib[i]])
+			}
+			return []*Tensor{{Shape: shape, Int: out}}, nil
+		}
+		af, bf := a.floats(), b.floats()
+		out := make([]float32, len(ia))
+		for i := range out {
+			out[i] = f(af[ia[i]], bf[ib[i]])
+		}
+		return []*Tensor{{Shape: shape, Float: out}}, nil
+	}
+}
+
+// broadcast returns the broadcast shape of a and b, with the index into each
+// operand of every element of the result
+func broadcast(a, b []int) ([]int, []int, []int, error) {
+	rank := max(len(a), len(b))
+	shape := make([]int, rank)
+	pa, pb := pad(a, rank), pad(b, rank)
+	for i := range rank {
+		switch {
+		case pa[i] == pb[i], pb[i] == 1:
+			shape[i] = pa[i]
+		case pa[i] == 1:
+			shape[i] = pb[i]
+		default:
+			return nil, nil, nil, fmt.Errorf("cannot broadcast %v with %v", a, b)
+		}
+	}
+
+	sa, sb := strides(pa), strides(pb)
+	for i := range rank {
+		// Broadcast dimensions do not advance through the operand
+		if pa[i] == 1 {
+			sa[i] = 0
+		}
+		if pb[i] == 1 {
+			sb[i] = 0
+		}
+	}
+	n := 1
+	for _, d := range shape {
+		n *= d
+	}
+	ia, ib := make([]int, n), make([]int, n)
+	idx := make([]int, rank)
+	offA, offB := 0, 0
+	for i := range n {
+		ia[i], ib[i] = offA, offB
+		for d := rank - 1; d >= 0; d-- {
+			idx[d]++
+			offA += sa[d]
+			offB += sb[d]
+			if idx[d] < shape[d] {
+				break
+			}
+			offA -= sa[d] * idx[d]
+			offB -= sb[d] * idx[d]
+			idx[d] = 0
+		}
+	}
+	return shape, ia, ib, nil
+}
+
+// pad prepends ones to shape up to rank
+func pad(shape []int, rank int) []int {
+	out := make([]int, rank)
+	for i := range out {
+		out[i] = 1
+	}
+	copy(out[rank-len(shape):], shape)
+	return out
+}
+
+func identity(n *node, in []*Tensor) ([]*Tensor, error) {
+	if err := inputs(in, 1); err != nil {
+		return nil, err
+	}
+	return []*Tensor{in[0]}, nil
+}
+
+func constant(n *node, in []*Tensor) ([]*Tensor, error) {
+	a, ok := n.attrs["value"]
+	switch {
+	case ok:
+		return []*Tensor{a.t}, nil
+	case n.attrs["value_float"] != nil:
+		return []*Tensor{{Shape: []int{}, Float: []float32{n.attrs["value_float"].f}}}, nil
+	case n.attrs["value_floats"] != nil:
+		v := n.attrs["value_floats"].floats
+		return []*Tensor{{Shape: []int{len(v)}, Float: v}}, nil
+	case n.attrs["value_int"] != nil:
+		return []*Tensor{{Shape: []int{}, Int: []int64{n.attrs["value_int"].i}}}, nil
+	case n.attrs["value_ints"] != nil:
+		v := n.attrs["value_ints"].ints
+		return []*Tensor{{Shape: []int{len(v)}, Int: v}}, nil
+	}
+	return nil, errors.New("constant has no supported value attribute")
+}
+
+func constantOfShape(n *node, in []*Tensor) ([]*Tensor, error) {
+	if err := inputs(in, 1); err != nil {
+		return nil, err
+	}
+	dims := in[0].ints()
+	t := &Tensor{Shape: make([]int, len(dims))}
+	for i, d := range dims {
+		t.Shape[i] = int(d)
+	}
+	value := &Tensor{Float: []float32{0}}
+	if a, ok := n.attrs["value"]; ok && a.t != nil {
+		value = a.t
+	}
+	if value.isInt() {
+		t.Int = make([]int64, t.Size())
+		for i := range t.Int {
+			t.Int[i] = value.Int[0]
+		}
+	} else {
+		t.Float = make([]float32, t.Size())
+		for i := range t.Float {
+			t.Float[i] = value.Float[0]
+		}
+	}
+	return []*Tensor{t}, nil
+}
+
+func cast(n *node, in []*Tensor) ([]*Tensor, error) {
+	if err := inputs(in, 1); err != nil {
+		return nil, err
+	}
+	switch to := n.int("to", 0); to {
+	case dataFloat:
+		return []*Tensor{{Shape: in[0].Shape, Float: in[0].floats()}}, nil
+	case dataInt32, dataInt64:
+		return []*Tensor{{Shape: in[0].Shape, Int: in[0].ints()}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported cast to data type %d", to)
+	}
+}
+
+func shape(n *node, in []*Tensor) ([]*Tensor, error) {
+	if err := inputs(in, 1); err != nil {
+		return nil, err
+	}
+	dims := make([]int64, len(in[0].Shape))
+	for i, d := range in[0].Shape {
+		dims[i] = int64(d)
+	}
+	return []*Tensor{{Shape: []int{len(dims)}, Int: dims}}, nil
+}
+
+func reshape(n *node, in []*Tensor) ([]*Tensor, error) {
+	if err := inputs(in, 2); err != nil {
+		return nil, err
+	}
+	x, dims := in[0], in[1].ints()
+	out := make([]int, len(dims))
+	known, infer := 1, -1
+	for i, d := range dims {
+		switch {
+		case d == 0 && n.int("allowzero", 0) == 0:
+			if i >= len(x.Shape) {
+				return nil, fmt.Errorf("cannot copy dimension %d of %v", i, x.Shape)
+			}
+			out[i] = x.Shape[i]
+		case d == -1:
+			if infer >= 0 {
+				return nil, errors.New("more than one inferred dimension")
+			}
+			infer = i
+			continue
+		default:
+			out[i] = int(d)
+		}
+		known *= out[i]
+	}
+	if infer >= 0 {
+		if known == 0 || x.Size()%known != 0 {
+			return nil, fmt.Errorf("cannot reshape %v to %v", x.Shape, dims)
+		}
+		out[infer] = x.Size() / known
+		known *= out[infer]
+	}
+	if known != x.Size() {
+		return nil, fmt.Errorf("cannot reshape %v to %v", x.Shape, dims)
+	}
+	return []*Tensor{{Shape: out, Float: x.Float, Int: x.Int}}, nil
+}
+
+// axes returns the axes of a node, from its attribute in older opsets or its
+// input in newer ones
+func axes(n *node, in []*Tensor, input int) []int64 {
+	if t := optional(in, input); t != nil {
+		return t.ints()
+	}
+	return n.ints("axes")
+}
+
+func unsqueeze(n *node, in []*Tensor) ([]*Tensor, error) {
+	if err := inputs(in, 1); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	rank := len(x.Shape) + len(axes(n, in, 1))
+	insert := make([]bool, rank)
+	for _, a := range axes(n, in, 1) {
+		axis, err := normalizeAxis(a, rank)
+		if err != nil {
+			return nil, err
+		}
+		insert[axis] = true
+	}
+	out := make([]int, 0, rank)
+	rest := x.Shape
+	for _, ins := range insert {
+		if ins {
+			out = append(out, 1)
+		} else if len(rest) > 0 {
+			out, rest = append(out, rest[0]), rest[1:]
+		}
+	}
+	if len(out) != rank {
+		return nil, errors.New("duplicate unsqueeze axes")
+	}
+	return []*Tensor{{Shape: out, Float: x.Float, Int: x.Int}}, nil
+}
+
+func squeeze(n *node, in []*Tensor) ([]*Tensor, error) {
+	if err := inputs(in, 1); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	drop := make([]bool, len(x.Shape))
+	list := axes(n, in, 1)
+	for _, a := range list {
+		axis, err := normalizeAxis(a, len(x.Shape))
+		if err != nil {
+			return nil, err
+		}
+		if x.Shape[axis] != 1 {
+			return nil, fmt.Errorf("cannot squeeze dimension %d of %v", axis, x.Shape)
+		}
+		drop[axis] = true
+	}
+	out := []int{}
+	for i, d := range x.Shape {
+		if !drop[i] && (len(list) > 0 || d != 1) {
+			out = append(out, d)
+		}
+	}
+	return []*Tensor{{Shape: out, Float: x.Float, Int: x.Int}}, nil
+}
+
+func concat(n *node, in []*Tensor) ([]*Tensor, error) {
+	if len(in) == 0 {
+		return nil, errMissingInput
+	}
+	if err := inputs(in, len(in)); err != nil {
+		return nil, err
+	}
+	first := in[0]
+	axis, err := normalizeAxis(n.int("axis", 0), len(first.Shape))
+	if err != nil {
+		return nil, err
+	}
+
+	shape := append([]int(nil), first.Shape...)
+	ints := first.isInt()
+	for _, t := range in[1:] {
+		if len(t.Shape) != len(shape) {
+			return nil, fmt.Errorf("cannot concatenate %v with %v", first.Shape, t.Shape)
+		}
+		for i, d := range t.Shape {
+			if i != axis && d != shape[i] {
+				return nil, fmt.Errorf("cannot concatenate %v with %v", first.Shape, t.Shape)
+			}
+		}
+		shape[axis] += t.Shape[axis]
+		ints = ints && t.isInt()
+	}
+
+	outer := 1
+	for _, d := range shape[:axis] {
+		outer *= d
+	}
+	out := &Tensor{Shape: shape}
+	if ints {
+		out.Int = make([]int64, 0, out.Size())
+	} else {
+		out.Float = make([]float32, 0, out.Size())
+	}
+	for o := range outer {
+		for _, t := range in {
+			chunk := t.Size() / outer
+			if ints {
+				out.Int = append(out.Int, t.Int[o*chunk:(o+1)*chunk]...)
+			} else {
+				out.Float = append(out.Float, t.floats()[o*chunk:(o+1)*chunk]...)
+			}
+		}
+	}
+	return []*Tensor{out}, nil
+}
+
+func gather(n *node, in []*Tensor) ([]*Tensor, error) {
+	if err := inputs(in, 2); err != nil {
+		return nil, err
+	}
+	data, indices := in[0], in[1]
+	axis, err := normalizeAxis(n.int("axis", 0), len(data.Shape))
+	if err != nil {
+		return nil, err
+	}
+
+	dim := data.Shape[axis]
+	outer, inner := 1, 1
+	for _, d := range data.Shape[:axis] {
+		outer *= d
+	}
+	for _, d := range data.Shape[axis+1:] {
+		inner *= d
+	}
+	shape := append(append(append([]int{}, data.Shape[:axis]...), indices.Shape...), data.Shape[axis+1:]...)
+	out := &Tensor{Shape: shape}
+	idx := indices.ints()
+	for o := range outer {
+		for _, i := range idx {
+			if i < 0 {
+				i += int64(dim)
+			}
+			if i < 0 || int(i) >= dim {
+				return nil, fmt.Errorf("index %d out of range for dimension %d", i, dim)
+			}
+			start := (o*dim + int(i)) * inner
+			if data.isInt() {
+				out.Int = append(out.Int, data.Int[start:start+inner]...)
+			} else {
+				out.Float = append(out.Float, data.Float[start:start+inner]...)
+			}
+		}
+	}
+	if data.isInt() && out.Int == nil {
+		out.Int = []int64{}
+	}
+	return []*Tensor{out}, nil
+}
+
+func slice(n *node, in []*Tensor) ([]*Tensor, error) {
+	if err := inputs(in, 1); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	var starts, ends, axesList, steps []int64
+	if len(in) >= 3 {
+		if err := inputs(in, 3); err != nil {
+			return nil, err
+		}
+		starts, ends = in[1].ints(), in[2].ints()
+		axesList = axes(n, in, 3)
+		if t := optional(in, 4); t != nil {
+			steps = t.ints()
+		}
+	} else {
+		starts, ends, axesList = n.ints("starts"), n.ints("ends"), n.ints("axes")
+	}
+	if len(ends) != len(starts) {
+		return nil, errors.New("starts and ends differ in length")
+	}
+
+	rank := len(x.Shape)
+	begin, step, shape := make([]int, rank), make([]int, rank), append([]int(nil), x.Shape...)
+	for i := range step {
+		step[i] = 1
+	}
+	for i := range starts {
+		axis := i
+		if axesList != nil {
+			a, err := normalizeAxis(axesList[i], rank)
+			if err != nil {
+				return nil, err
+			}
+			axis = a
+		}
+		s := int64(1)
+		if steps != nil {
+			s = steps[i]
+		}
+		if s == 0 {
+			return nil, errors.New("slice step cannot be zero")
+		}
+		dim := int64(x.Shape[axis])
+		start, end := clampSlice(starts[i], dim, s), clampSlice(ends[i], dim, s)
+		count := int64(0)
+		if s > 0 && end > start {
+			count = (end - start + s - 1) / s
+		} else if s < 0 && start > end {
+			count = (start - end - s - 1) / -s
+		}
+		begin[axis], step[axis], shape[axis] = int(start), int(s), int(count)
+	}
+
+	out := &Tensor{Shape: shape}
+	size := out.Size()
+	if x.isInt() {
+		out.Int = make([]int64, size)
+	} else {
+		out.Float = make([]float32, size)
+	}
+	src := strides(x.Shape)
+	idx := make([]int, rank)
+	for i := range size {
+		off := 0
+		for d := range rank {
+			off += (begin[d] + idx[d]*step[d]) * src[d]
+		}
+		if x.isInt() {
+			out.Int[i] = x.Int[off]
+		} else {
+			out.Float[i] = x.Float[off]
+		}
+		for d := rank - 1; d >= 0; d-- {
+			if idx[d]++; idx[d] < shape[d] {
+				break
+			}
+			idx[d] = 0
+		}
+	}
+	return []*Tensor{out}, nil
+}
+
+// clampSlice resolves a slice bound against a dimension, clamping it to the
+// range reachable with the sign of step
+func clampSlice(v, dim, step int64) int64 {
+	if v < 0 {
+		v += dim
+	}
+	if step > 0 {
+		return min(max(v, 0), dim)
+	}
+	return min(max(v, -1), dim-1)
+}
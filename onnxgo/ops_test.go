@@ -0,0 +1,178 @@
+package onnxgo
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func newNode(attrs map[string]*attribute) *node {
+	if attrs == nil {
+		attrs = map[string]*attribute{}
+	}
+	return &node{attrs: attrs}
+}
+
+func ints(v ...int64) *attribute {
+	return &attribute{ints: v}
+}
+
+func run(t *testing.T, op string, n *node, in ...*Tensor) *Tensor {
+	t.Helper()
+	out, err := operators[op](n, in)
+	if err != nil {
+		t.Fatalf("%s failed: %v", op, err)
+	}
+	return out[0]
+}
+
+func expectFloats(t *testing.T, got *Tensor, shape []int, data []float32) {
+	t.Helper()
+	if !slices.Equal(got.Shape, shape) {
+		t.Fatalf("expected shape %v, got %v", shape, got.Shape)
+	}
+	for i, v := range data {
+		if math.Abs(float64(got.Float[i]-v)) > 1e-5 {
+			t.Errorf("expected %v, got %v", data, got.Float)
+			return
+		}
+	}
+}
+
+func TestConv(t *testing.T) {
+	x := &Tensor{Shape: []int{1, 1, 3, 3}, Float: []float32{1, 2, 3, 4, 5, 6, 7, 8, 9}}
+	ones := &Tensor{Shape: []int{1, 1, 3, 3}, Float: []float32{1, 1, 1, 1, 1, 1, 1, 1, 1}}
+
+	t.Run("Padded", func(t *testing.T) {
+		n := newNode(map[string]*attribute{"pads": ints(1, 1, 1, 1)})
+		expectFloats(t, run(t, "Conv", n, x, ones), []int{1, 1, 3, 3},
+			[]float32{12, 21, 16, 27, 45, 33, 24, 39, 28})
+	})
+
+	t.Run("Strided", func(t *testing.T) {
+		n := newNode(map[string]*attribute{"pads": ints(1, 1, 1, 1), "strides": ints(2, 2)})
+		expectFloats(t, run(t, "Conv", n, x, ones), []int{1, 1, 2, 2}, []float32{12, 16, 24, 28})
+	})
+
+	t.Run("Dilated", func(t *testing.T) {
+		n := newNode(map[string]*attribute{"pads": ints(2, 2, 2, 2), "dilations": ints(2, 2)})
+		out := run(t, "Conv", n, x, ones)
+		// The center tap of each window reads the pixel itself
+		expectFloats(t, out, []int{1, 1, 3, 3}, []float32{1 + 3 + 7 + 9, 2 + 8, 3 + 1 + 9 + 7})
+	})
+
+	t.Run("Grouped", func(t *testing.T) {
+		x := &Tensor{Shape: []int{1, 2, 1, 1}, Float: []float32{2, 3}}
+		w := &Tensor{Shape: []int{2, 1, 1, 1}, Float: []float32{10, 100}}
+		b := &Tensor{Shape: []int{2}, Float: []float32{1, 2}}
+		n := newNode(map[string]*attribute{"group": {i: 2}})
+		expectFloats(t, run(t, "Conv", n, x, w, b), []int{1, 2, 1, 1}, []float32{21, 302})
+	})
+}
+
+func TestMaxPool(t *testing.T) {
+	x := &Tensor{Shape: []int{1, 1, 3, 3}, Float: []float32{1, 2, 3, 4, 5, 6, 7, 8, 9}}
+	n := newNode(map[string]*attribute{"kernel_shape": ints(2, 2), "strides": ints(2, 2)})
+	expectFloats(t, run(t, "MaxPool", n, x), []int{1, 1, 1, 1}, []float32{5})
+
+	n.attrs["ceil_mode"] = &attribute{i: 1}
+	expectFloats(t, run(t, "MaxPool", n, x), []int{1, 1, 2, 2}, []float32{5, 6, 8, 9})
+}
+
+func TestBatchNormalization(t *testing.T) {
+	x := &Tensor{Shape: []int{1, 2, 1, 2}, Float: []float32{1, 2, 3, 4}}
+	scale := &Tensor{Shape: []int{2}, Float: []float32{2, 1}}
+	bias := &Tensor{Shape: []int{2}, Float: []float32{0, 1}}
+	mean := &Tensor{Shape: []int{2}, Float: []float32{1, 3}}
+	variance := &Tensor{Shape: []int{2}, Float: []float32{1, 4}}
+	n := newNode(map[string]*attribute{"epsilon": {f: 0}})
+	expectFloats(t, run(t, "BatchNormalization", n, x, scale, bias, mean, variance),
+		[]int{1, 2, 1, 2}, []float32{0, 2, 1, 1.5})
+}
+
+func TestResize(t *testing.T) {
+	x := &Tensor{Shape: []int{1, 1, 2, 2}, Float: []float32{0, 1, 2, 3}}
+	sizes := &Tensor{Shape: []int{4}, Int: []int64{1, 1, 3, 3}}
+	scales := &Tensor{Shape: []int{4}, Float: []float32{1, 1, 2, 2}}
+
+	t.Run("AlignCorners", func(t *testing.T) {
+		n := newNode(map[string]*attribute{
+			"mode":                           {s: "linear"},
+			"coordinate_transformation_mode": {s: "align_corners"},
+		})
+		expectFloats(t, run(t, "Resize", n, x, nil, nil, sizes), []int{1, 1, 3, 3},
+			[]float32{0, 0.5, 1, 1, 1.5, 2, 2, 2.5, 3})
+	})
+
+	t.Run("HalfPixel", func(t *testing.T) {
+		n := newNode(map[string]*attribute{"mode": {s: "linear"}})
+		out := run(t, "Resize", n, x, nil, scales)
+		expectFloats(t, out, []int{1, 1, 4, 4}, []float32{0, 0.25, 0.75, 1})
+	})
+
+	t.Run("Nearest", func(t *testing.T) {
+		expectFloats(t, run(t, "Upsample", newNode(nil), x, scales), []int{1, 1, 4, 4},
+			[]float32{0, 0, 1, 1, 0, 0, 1, 1, 2, 2, 3, 3})
+	})
+}
+
+func TestElementwise(t *testing.T) {
+	a := &Tensor{Shape: []int{2, 3}, Float: []float32{1, 2, 3, 4, 5, 6}}
+	b := &Tensor{Shape: []int{3}, Float: []float32{10, 20, 30}}
+	expectFloats(t, run(t, "Add", newNode(nil), a, b), []int{2, 3}, []float32{11, 22, 33, 14, 25, 36})
+
+	col := &Tensor{Shape: []int{2, 1}, Float: []float32{2, 3}}
+	expectFloats(t, run(t, "Mul", newNode(nil), col, b), []int{2, 3}, []float32{20, 40, 60, 30, 60, 90})
+
+	bad := &Tensor{Shape: []int{2}, Float: []float32{1, 2}}
+	if _, err := operators["Add"](newNode(nil), []*Tensor{a, bad}); err == nil {
+		t.Errorf("expected error broadcasting [2 3] with [2]")
+	}
+
+	q := run(t, "Div", newNode(nil), &Tensor{Shape: []int{2}, Int: []int64{7, -7}}, &Tensor{Shape: []int{}, Int: []int64{2}})
+	if !slices.Equal(q.Int, []int64{3, -4}) {
+		t.Errorf("expected [3 -4], got %v", q.Int)
+	}
+}
+
+// TestShapeChain runs the dynamic size computation PyTorch exports for an
+// upsample to the size of another tensor
+func TestShapeChain(t *testing.T) {
+	x := &Tensor{Shape: []int{1, 4, 6, 8}, Float: make([]float32, 192)}
+	shape := run(t, "Shape", newNode(nil), x)
+	hw := run(t, "Slice", newNode(nil), shape,
+		&Tensor{Shape: []int{1}, Int: []int64{2}}, &Tensor{Shape: []int{1}, Int: []int64{math.MaxInt64}})
+	if !slices.Equal(hw.Int, []int64{6, 8}) {
+		t.Fatalf("expected [6 8], got %v", hw.Int)
+	}
+
+	h := run(t, "Gather", newNode(nil), shape, &Tensor{Shape: []int{}, Int: []int64{-2}})
+	h = run(t, "Unsqueeze", newNode(map[string]*attribute{"axes": ints(0)}), h)
+	nc := run(t, "Constant", newNode(map[string]*attribute{"value_ints": ints(1, 4)}))
+	sizes := run(t, "Concat", newNode(nil), nc, h, run(t, "Cast", newNode(map[string]*attribute{"to": {i: dataInt64}}),
+		&Tensor{Shape: []int{1}, Float: []float32{8}}))
+	if !slices.Equal(sizes.Int, []int64{1, 4, 6, 8}) || !slices.Equal(sizes.Shape, []int{4}) {
+		t.Errorf("expected [1 4 6 8], got %v %v", sizes.Shape, sizes.Int)
+	}
+
+	r := run(t, "Reshape", newNode(nil), x, &Tensor{Shape: []int{2}, Int: []int64{0, -1}})
+	if !slices.Equal(r.Shape, []int{1, 192}) {
+		t.Errorf("expected [1 192], got %v", r.Shape)
+	}
+	s := run(t, "Squeeze", newNode(nil), r)
+	if !slices.Equal(s.Shape, []int{192}) {
+		t.Errorf("expected [192], got %v", s.Shape)
+	}
+}
+
+func TestConcat(t *testing.T) {
+	a := &Tensor{Shape: []int{1, 1, 1, 2}, Float: []float32{1, 2}}
+	b := &Tensor{Shape: []int{1, 2, 1, 2}, Float: []float32{3, 4, 5, 6}}
+	expectFloats(t, run(t, "Concat", newNode(map[string]*attribute{"axis": {i: 1}}), a, b),
+		[]int{1, 3, 1, 2}, []float32{1, 2, 3, 4, 5, 6})
+
+	c := &Tensor{Shape: []int{1, 1, 2, 1}, Float: []float32{7, 8}}
+	if _, err := operators["Concat"](newNode(map[string]*attribute{"axis": {i: 1}}), []*Tensor{a, c}); err == nil {
+		t.Errorf("expected error for mismatched shapes")
+	}
+}
@@ -0,0 +1,376 @@
+package onnxgo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errTruncated = errors.New("truncated protobuf message")
+
+// protoField is one field of a protobuf message
+type protoField struct {
+	num  int
+	wire int
+	// v holds varint and fixed values
+	v uint64
+	// b holds length-delimited values
+	b []byte
+}
+
+// parseMessage splits a protobuf message into its fields
+func parseMessage(data []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errTruncated
+		}
+		data = data[n:]
+		f := protoField{num: int(key >> 3), wire: int(key & 7)}
+		switch f.wire {
+		case wireVarint:
+			f.v, n = binary.Uvarint(data)
+			if n <= 0 {
+				return nil, errTruncated
+			}
+			data = data[n:]
+		case wireFixed64:
+			if len(data) < 8 {
+				return nil, errTruncated
+			}
+			f.v, data = binary.LittleEndian.Uint64(data), data[8:]
+		case wireFixed32:
+			if len(data) < 4 {
+				return nil, errTruncated
+			}
+			f.v, data = uint64(binary.LittleEndian.Uint32(data)), data[4:]
+		case wireBytes:
+			l, n := binary.Uvarint(data)
+			if n <= 0 || l > uint64(len(data)-n) {
+				return nil, errTruncated
+			}
+			f.b, data = data[n:n+int(l)], data[n+int(l):]
+		default:
+			return nil, fmt.Errorf("unsupported protobuf wire type %d", f.wire)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// varints decodes a repeated varint field, packed or not
+func (f protoField) varints(dst []int64) ([]int64, error) {
+	if f.wire == wireVarint {
+		return append(dst, int64(f.v)), nil
+	}
+	data := f.b
+	for len(data) > 0 {
+		v, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errTruncated
+		}
+		dst, data = append(dst, int64(v)), data[n:]
+	}
+	return dst, nil
+}
+
+// floats decodes a repeated float field, packed or not
+func (f protoField) floats(dst []float32) ([]float32, error) {
+	if f.wire == wireFixed32 {
+		return append(dst, math.Float32frombits(uint32(f.v))), nil
+	}
+	if len(f.b)%4 != 0 {
+		return nil, errTruncated
+	}
+	for i := 0; i < len(f.b); i += 4 {
+		dst = append(dst, math.Float32frombits(binary.LittleEndian.Uint32(f.b[i:])))
+	}
+	return dst, nil
+}
+
+// ONNX field numbers, from onnx.proto
+const (
+	modelGraph = 7
+
+	graphNode        = 1
+	graphInitializer = 5
+	graphInput       = 11
+	graphOutput      = 12
+
+	nodeInput     = 1
+	nodeOutput    = 2
+	nodeOpType    = 4
+	nodeAttribute = 5
+
+	attrName   = 1
+	attrF      = 2
+	attrI      = 3
+	attrS      = 4
+	attrT      = 5
+	attrFloats = 7
+	attrInts   = 8
+
+	tensorDims      = 1
+	tensorDataType  = 2
+	tensorFloatData = 4
+	tensorInt32Data = 5
+	tensorInt64Data = 7
+	tensorName      = 8
+	tensorRawData   = 9
+	tensorLocation  = 14
+
+	valueInfoName = 1
+)
+
+// ONNX tensor data types
+const (
+	dataFloat = 1
+	dataInt32 = 6
+	dataInt64 = 7
+)
+
+// graph is the part of an ONNX graph the interpreter needs
+type graph struct {
+	nodes        []*node
+	initializers map[string]*Tensor
+	inputs       []string
+	outputs      []string
+}
+
+// node is one operator invocation
+type node struct {
+	op      string
+	inputs  []string
+	outputs []string
+	attrs   map[string]*attribute
+}
+
+// attribute is a node attribute; only the field matching its type is set
+type attribute struct {
+	f      float32
+	i      int64
+	s      string
+	t      *Tensor
+	floats []float32
+	ints   []int64
+}
+
+// parseModel reads the graph of a serialized ModelProto
+func parseModel(data []byte) (*graph, error) {
+	fields, err := parseMessage(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range fields {
+		if f.num == modelGraph && f.wire == wireBytes {
+			return parseGraph(f.b)
+		}
+	}
+	return nil, errors.New("model has no graph")
+}
+
+func parseGraph(data []byte) (*graph, error) {
+	fields, err := parseMessage(data)
+	if err != nil {
+		return nil, err
+	}
+	g := &graph{initializers: make(map[string]*Tensor)}
+	for _, f := range fields {
+		switch f.num {
+		case graphNode:
+			n, err := parseNode(f.b)
+			if err != nil {
+				return nil, err
+			}
+			g.nodes = append(g.nodes, n)
+		case graphInitializer:
+			name, t, err := parseTensor(f.b)
+			if err != nil {
+				return nil, fmt.Errorf("initializer %s: %w", name, err)
+			}
+			g.initializers[name] = t
+		case graphInput, graphOutput:
+			name, err := parseValueInfoName(f.b)
+			if err != nil {
+				return nil, err
+			}
+			if f.num == graphInput {
+				g.inputs = append(g.inputs, name)
+			} else {
+				g.outputs = append(g.outputs, name)
+			}
+		}
+	}
+	return g, nil
+}
+
+func parseValueInfoName(data []byte) (string, error) {
+	fields, err := parseMessage(data)
+	if err != nil {
+		return "", err
+	}
+	for _, f := range fields {
+		if f.num == valueInfoName {
+			return string(f.b), nil
+		}
+	}
+	return "", nil
+}
+
+func parseNode(data []byte) (*node, error) {
+	fields, err := parseMessage(data)
+	if err != nil {
+		return nil, err
+	}
+	n := &node{attrs: make(map[string]*attribute)}
+	for _, f := range fields {
+		switch f.num {
+		case nodeInput:
+			n.inputs = append(n.inputs, string(f.b))
+		case nodeOutput:
+			n.outputs = append(n.outputs, string(f.b))
+		case nodeOpType:
+			n.op = string(f.b)
+		case nodeAttribute:
+			name, a, err := parseAttribute(f.b)
+			if err != nil {
+				return nil, fmt.Errorf("attribute %s: %w", name, err)
+			}
+			n.attrs[name] = a
+		}
+	}
+	return n, nil
+}
+
+func parseAttribute(data []byte) (string, *attribute, error) {
+	fields, err := parseMessage(data)
+	if err != nil {
+		return "", nil, err
+	}
+	var name string
+	a := &attribute{}
+	for _, f := range fields {
+		switch f.num {
+		case attrName:
+			name = string(f.b)
+		case attrF:
+			a.f = math.Float32frombits(uint32(f.v))
+		case attrI:
+			a.i = int64(f.v)
+		case attrS:
+			a.s = string(f.b)
+		case attrT:
+			if _, a.t, err = parseTensor(f.b); err != nil {
+				return name, nil, err
+			}
+		case attrFloats:
+			if a.floats, err = f.floats(a.floats); err != nil {
+				return name, nil, err
+			}
+		case attrInts:
+			if a.ints, err = f.varints(a.ints); err != nil {
+				return name, nil, err
+			}
+		}
+	}
+	return name, a, nil
+}
+
+func parseTensor(data []byte) (string, *Tensor, error) {
+	fields, err := parseMessage(data)
+	if err != nil {
+		return "", nil, err
+	}
+	var (
+		name     string
+		dims     []int64
+		dataType int
+		raw      []byte
+		floats   []float32
+		ints     []int64
+	)
+	for _, f := range fields {
+		switch f.num {
+		case tensorDims:
+			if dims, err = f.varints(dims); err != nil {
+				return name, nil, err
+			}
+		case tensorDataType:
+			dataType = int(f.v)
+		case tensorFloatData:
+			if floats, err = f.floats(floats); err != nil {
+				return name, nil, err
+			}
+		case tensorInt32Data, tensorInt64Data:
+			if ints, err = f.varints(ints); err != nil {
+				return name, nil, err
+			}
+		case tensorName:
+			name = string(f.b)
+		case tensorRawData:
+			raw = f.b
+		case tensorLocation:
+			if f.v != 0 {
+				return name, nil, errors.New("external tensor data is not supported")
+			}
+		}
+	}
+
+	shape := make([]int, len(dims))
+	for i, d := range dims {
+		shape[i] = int(d)
+	}
+	t := &Tensor{Shape: shape}
+	n := t.Size()
+	switch dataType {
+	case dataFloat:
+		if raw != nil {
+			if len(raw) != 4*n {
+				return name, nil, fmt.Errorf("raw data has %d bytes for %d floats", len(raw), n)
+			}
+			floats = make([]float32, n)
+			for i := range floats {
+				floats[i] = math.Float32frombits(binary.LittleEndian.Uint32(raw[4*i:]))
+			}
+		}
+		if len(floats) != n {
+			return name, nil, fmt.Errorf("expected %d floats, got %d", n, len(floats))
+		}
+		t.Float = floats
+	case dataInt32, dataInt64:
+		if raw != nil {
+			width := 8
+			if dataType == dataInt32 {
+				width = 4
+			}
+			if len(raw) != width*n {
+				return name, nil, fmt.Errorf("raw data has %d bytes for %d integers", len(raw), n)
+			}
+			ints = make([]int64, n)
+			for i := range ints {
+				if width == 8 {
+					ints[i] = int64(binary.LittleEndian.Uint64(raw[8*i:]))
+				} else {
+					ints[i] = int64(int32(binary.LittleEndian.Uint32(raw[4*i:])))
+				}
+			}
+		}
+		if len(ints) != n {
+			return name, nil, fmt.Errorf("expected %d integers, got %d", n, len(ints))
+		}
+		t.Int = ints
+	default:
+		return name, nil, fmt.Errorf("unsupported tensor data type %d", dataType)
+	}
+	return name, t, nil
+}
@@ -0,0 +1,80 @@
+package onnxgo
+
+import "fmt"
+
+// Tensor is a dense row-major tensor holding either float or integer data
+type Tensor struct {
+	Shape []int
+	// Float holds the elements of float tensors
+	Float []float32
+	// Int holds the elements of integer tensors, including shapes and indices
+	Int []int64
+}
+
+// Size returns the number of elements of t
+func (t *Tensor) Size() int {
+	n := 1
+	for _, d := range t.Shape {
+		n *= d
+	}
+	return n
+}
+
+// isInt reports whether t holds integer data
+func (t *Tensor) isInt() bool {
+	return t.Float == nil && t.Int != nil
+}
+
+// floats returns the elements of t as floats, converting integers
+func (t *Tensor) floats() []float32 {
+	if !t.isInt() {
+		return t.Float
+	}
+	out := make([]float32, len(t.Int))
+	for i, v := range t.Int {
+		out[i] = float32(v)
+	}
+	return out
+}
+
+// ints returns the elements of t as integers, truncating floats
+func (t *Tensor) ints() []int64 {
+	if t.isInt() {
+		return t.Int
+	}
+	out := make([]int64, len(t.Float))
+	for i, v := range t.Float {
+		out[i] = int64(v)
+	}
+	return out
+}
+
+func (t *Tensor) String() string {
+	kind := "float"
+	if t.isInt() {
+		kind = "int"
+	}
+	return fmt.Sprintf("%s%v", kind, t.Shape)
+}
+
+// strides returns the row-major strides of shape
+func strides(shape []int) []int {
+	s := make([]int, len(shape))
+	n := 1
+	for i := len(shape) - 1; i >= 0; i-- {
+		s[i] = n
+		n *= shape[i]
+	}
+	return s
+}
+
+// normalizeAxis resolves a negative axis against rank
+func normalizeAxis(axis int64, rank int) (int, error) {
+	if axis < 0 {
+		axis += int64(rank)
+	}
+	if axis < 0 || int(axis) >= rank {
+		return 0, fmt.Errorf("axis %d out of range for rank %d", axis, rank)
+	}
+	return int(axis), nil
+}
@@ -0,0 +1,279 @@
+package rmbg
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Option configures an engine created with NewWithOptions
+type Option func(*Config)
+
+// NewWithOptions creates an engine for the model at modelPath. Options are
+// applied in order to a zero Config, so it behaves like New with the
+// equivalent Config.
+func NewWithOptions(modelPath string, opts ...Option) (*RemBG, error) {
+	return New(configFromOptions(modelPath, opts))
+}
+
+func configFromOptions(modelPath string, opts []Option) *Config {
+	config := &Config{ModelPath: modelPath}
+	for _, opt := range opts {
+		opt(config)
+	}
+	return config
+}
+
+// WithThreads sets the intra-op and inter-op thread counts of the sessions
+func WithThreads(intraOp, interOp int) Option {
+	return func(c *Config) {
+		c.IntraOpNumThreads = intraOp
+		c.InterOpNumThreads = interOp
+	}
+}
+
+// WithMemoryOptimizations enables the CPU memory arena and memory pattern
+// optimization of the sessions
+func WithMemoryOptimizations() Option {
+	return func(c *Config) {
+		c.CpuMemArena = true
+		c.MemPattern = true
+	}
+}
+
+// WithORTLibrary loads the ONNX Runtime shared library from path
+func WithORTLibrary(path string) Option {
+	return func(c *Config) {
+		c.ORTLibraryPath = path
+	}
+}
+
+// WithProvider runs the model on the given execution provider
+func WithProvider(p Provider) Option {
+	return func(c *Config) {
+		c.Provider = p
+	}
+}
+
+// WithDevice selects the GPU used by GPU execution providers
+func WithDevice(id int) Option {
+	return func(c *Config) {
+		c.DeviceID = id
+	}
+}
+
+// WithSessionPool creates n sessions per model so n calls can run inference
+// at once
+func WithSessionPool(n int) Option {
+	return func(c *Config) {
+		c.Sessions = n
+	}
+}
+
+// WithModel sets the model spec
+func WithModel(spec ModelSpec) Option {
+	return func(c *Config) {
+		c.Model = &spec
+	}
+}
+
+// WithInputSize overrides the input resolution of the model
+func WithInputSize(size int) Option {
+	return func(c *Config) {
+		c.InputSize = size
+	}
+}
+
+// WithLetterbox keeps the aspect ratio of images in the model input
+func WithLetterbox() Option {
+	return func(c *Config) {
+		c.Letterbox = true
+	}
+}
+
+// WithSoftMask keeps logit model outputs as a soft alpha matte
+func WithSoftMask() Option {
+	return func(c *Config) {
+		c.SoftMask = true
+	}
+}
+
+// WithTargetClasses selects the classes of a multi-class model that form the
+// object
+func WithTargetClasses(classes ...string) Option {
+	return func(c *Config) {
+		c.TargetClasses = classes
+	}
+}
+
+// WithModelRouting routes portraits to a human segmentation model
+func WithModelRouting(routing ModelRouting) Option {
+	return func(c *Config) {
+		c.ModelRouting = &routing
+	}
+}
+
+// WithMaskCache keeps the masks of the last size images in an LRU cache
+func WithMaskCache(size int) Option {
+	return func(c *Config) {
+		c.MaskCacheSize = size
+	}
+}
+
+// WithMaskCacheDistance also serves the cached mask of a near-duplicate image
+// whose perceptual hash differs in at most distance bits
+func WithMaskCacheDistance(distance int) Option {
+	return func(c *Config) {
+		c.MaskCacheDistance = distance
+	}
+}
+
+// WithTiling segments images larger than size pixels in overlapping tiles; an
+// overlap of 0 uses the default of size/8
+func WithTiling(size, overlap int) Option {
+	return func(c *Config) {
+		c.TileSize = size
+		c.TileOverlap = overlap
+	}
+}
+
+// WithMaxMegapixels limits the resolution images are processed at, handling
+// larger ones according to policy
+func WithMaxMegapixels(limit float64, policy ResolutionPolicy) Option {
+	return func(c *Config) {
+		c.MaxMegapixels = limit
+		c.ResolutionPolicy = policy
+	}
+}
+
+// WithUpsampling sets how masks are scaled to the image resolution
+func WithUpsampling(u Upsampling) Option {
+	return func(c *Config) {
+		c.Upsampling = u
+	}
+}
+
+// WithAntialias upsamples masks with UpsampleAntialias, ramping edges over
+// width pixels (0 uses DefaultAntialiasWidth)
+func WithAntialias(width float64) Option {
+	return func(c *Config) {
+		c.Upsampling = UpsampleAntialias
+		c.AntialiasWidth = width
+	}
+}
+
+// WithScales also runs the model at the given input sizes and averages the
+// probability maps, see Config.Scales
+func WithScales(sizes ...int) Option {
+	return func(c *Config) {
+		c.Scales = sizes
+	}
+}
+
+// WithFlipTTA averages the masks of the image and of its mirror image, see
+// Config.FlipTTA
+func WithFlipTTA() Option {
+	return func(c *Config) {
+		c.FlipTTA = true
+	}
+}
+
+// WithEnsemble segments every image with the further models of members too,
+// fusing the probability maps with fusion
+func WithEnsemble(fusion Fusion, members ...EnsembleMember) Option {
+	return func(c *Config) {
+		c.Ensemble = members
+		c.Fusion = fusion
+	}
+}
+
+// WithRefine enables the second inference pass around the object boundary
+func WithRefine() Option {
+	return func(c *Config) {
+		c.Refine = true
+	}
+}
+
+// WithShadow keeps the soft shadow touching the subject; nil options use the
+// defaults
+func WithShadow(opts *ShadowOptions) Option {
+	return func(c *Config) {
+		if opts == nil {
+			opts = &ShadowOptions{}
+		}
+		c.Shadow = opts
+	}
+}
+
+// WithDenoise smooths sensor noise before inference; nil options use the
+// defaults
+func WithDenoise(opts *Bilateral) Option {
+	return func(c *Config) {
+		if opts == nil {
+			opts = &Bilateral{}
+		}
+		c.Denoise = opts
+	}
+}
+
+// WithExposure normalizes the exposure of images before inference
+func WithExposure(e Exposure) Option {
+	return func(c *Config) {
+		c.Exposure = e
+	}
+}
+
+// WithPreProcessors appends steps to run on every image before segmentation
+func WithPreProcessors(steps ...PreProcessor) Option {
+	return func(c *Config) {
+		c.PreProcessors = append(c.PreProcessors, steps...)
+	}
+}
+
+// WithPostProcessors appends steps to run on every mask before compositing
+func WithPostProcessors(steps ...PostProcessor) Option {
+	return func(c *Config) {
+		c.PostProcessors = append(c.PostProcessors, steps...)
+	}
+}
+
+// WithOutputPool recycles result buffers released with Result.Release
+func WithOutputPool() Option {
+	return func(c *Config) {
+		c.PoolOutputs = true
+	}
+}
+
+// WithStats records per-call timings
+func WithStats() Option {
+	return func(c *Config) {
+		c.CollectStats = true
+	}
+}
+
+// WithLogger sends structured engine events to logger
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Config) {
+		c.Logger = logger
+	}
+}
+
+// WithStageHook calls fn after each stage of a call, see Config.OnStage
+func WithStageHook(fn func(stage string, d time.Duration)) Option {
+	return func(c *Config) {
+		c.OnStage = fn
+	}
+}
+
+// WithMetrics reports engine metrics to c
+func WithMetrics(c MetricsCollector) Option {
+	return func(cfg *Config) {
+		cfg.Metrics = c
+	}
+}
+
+// WithDeterministic makes output bit-identical across runs on the same machine
+func WithDeterministic() Option {
+	return func(c *Config) {
+		c.Deterministic = true
+	}
+}
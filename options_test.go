@@ -0,0 +1,111 @@
+package rmbg
+
+import (
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConfigFromOptions(t *testing.T) {
+	t.Run("Empty", func(t *testing.T) {
+		got := configFromOptions("model.onnx", nil)
+		if !reflect.DeepEqual(got, &Config{ModelPath: "model.onnx"}) {
+			t.Errorf("expected zero config with model path, got %+v", got)
+		}
+	})
+
+	t.Run("All", func(t *testing.T) {
+		routing := ModelRouting{PortraitModelPath: "human.onnx"}
+		got := configFromOptions("model.onnx", []Option{
+			WithThreads(4, 2),
+			WithMemoryOptimizations(),
+			WithORTLibrary("/opt/ort/libonnxruntime.so"),
+			WithProvider(ProviderCUDA),
+			WithDevice(1),
+			WithSessionPool(3),
+			WithModel(ModelMODNet),
+			WithInputSize(256),
+			WithSoftMask(),
+			WithModelRouting(routing),
+			WithMaskCache(16),
+			WithMaskCacheDistance(4),
+			WithTiling(1024, 0),
+			WithUpsampling(UpsampleGuided),
+			WithRefine(),
+			WithOutputPool(),
+			WithStats(),
+			WithDeterministic(),
+			WithLogger(slog.Default()),
+		})
+		want := &Config{
+			ModelPath:         "model.onnx",
+			IntraOpNumThreads: 4,
+			InterOpNumThreads: 2,
+			CpuMemArena:       true,
+			MemPattern:        true,
+			ORTLibraryPath:    "/opt/ort/libonnxruntime.so",
+			Provider:          ProviderCUDA,
+			DeviceID:          1,
+			Sessions:          3,
+			Model:             &ModelMODNet,
+			InputSize:         256,
+			SoftMask:          true,
+			ModelRouting:      &routing,
+			MaskCacheSize:     16,
+			MaskCacheDistance: 4,
+			TileSize:          1024,
+			Upsampling:        UpsampleGuided,
+			Refine:            true,
+			PoolOutputs:       true,
+			CollectStats:      true,
+			Deterministic:     true,
+			Logger:            slog.Default(),
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %+v, got %+v", want, got)
+		}
+	})
+
+	t.Run("Antialias", func(t *testing.T) {
+		got := configFromOptions("m", []Option{WithUpsampling(UpsampleGuided), WithAntialias(2)})
+		if got.Upsampling != UpsampleAntialias || got.AntialiasWidth != 2 {
+			t.Errorf("expected antialiased upsampling over 2 pixels, got %v over %v", got.Upsampling, got.AntialiasWidth)
+		}
+	})
+
+	t.Run("StageHook", func(t *testing.T) {
+		called := false
+		got := configFromOptions("m", []Option{WithStageHook(func(string, time.Duration) { called = true })})
+		if got.OnStage == nil {
+			t.Fatalf("expected OnStage to be set")
+		}
+		got.OnStage(StageBlend, 0)
+		if !called {
+			t.Errorf("expected the configured hook to be called")
+		}
+	})
+
+	t.Run("Metrics", func(t *testing.T) {
+		metrics := &recordingMetrics{}
+		if got := configFromOptions("m", []Option{WithMetrics(metrics)}); got.Metrics != metrics {
+			t.Errorf("expected collector to be set, got %v", got.Metrics)
+		}
+	})
+
+	t.Run("LaterOptionsWin", func(t *testing.T) {
+		got := configFromOptions("m", []Option{WithSessionPool(2), WithSessionPool(5)})
+		if got.Sessions != 5 {
+			t.Errorf("expected 5 sessions, got %d", got.Sessions)
+		}
+	})
+}
+
+func TestProviderString(t *testing.T) {
+	if got := ProviderTensorRT.String(); got != "tensorrt" {
+		t.Errorf("expected tensorrt, got %s", got)
+	}
+	if got := Provider(42).String(); got != "Provider(42)" {
+		t.Errorf("expected Provider(42), got %s", got)
+	}
+}
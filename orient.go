@@ -0,0 +1,110 @@
+package rmbg
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"regexp"
+)
+
+// exifTagOrientation is the EXIF tag of the orientation, from 1 (upright) to
+// 8, in IFD0
+const exifTagOrientation = 0x0112
+
+// xmpOrientation matches the orientation property of an XMP packet, as an
+// attribute or as an element
+var xmpOrientation = regexp.MustCompile(`(tiff:Orientation(?:="|>))([2-8])`)
+
+// exifOrientation returns the orientation of an EXIF block and the offset of
+// its value, or 1 and -1 when it has none
+func exifOrientation(exif []byte) (int, int) {
+	order, ifd, ok := tiffHeader(exif)
+	if !ok {
+		return 1, -1
+	}
+	entries, ok := tiffEntries(exif, order, ifd)
+	if !ok {
+		return 1, -1
+	}
+	for i := 0; i+12 <= len(entries); i += 12 {
+		e := entries[i:]
+		if order.Uint16(e) == exifTagOrientation && order.Uint16(e[2:]) == 3 {
+			if o := int(order.Uint16(e[8:])); o >= 1 && o <= 8 {
+				return o, ifd + 2 + i + 8
+			}
+		}
+	}
+	return 1, -1
+}
+
+// orientation returns the EXIF orientation of the image
+func (md *metadata) orientation() int {
+	o, _ := exifOrientation(md.exif)
+	return o
+}
+
+// resetOrientation marks the EXIF block and XMP packet as upright, once the
+// orientation has been applied to the pixels. Both are copied first, as they
+// may alias the input.
+func (md *metadata) resetOrientation() {
+	if _, at := exifOrientation(md.exif); at >= 0 {
+		md.exif = bytes.Clone(md.exif)
+		order, _, _ := tiffHeader(md.exif)
+		order.PutUint16(md.exif[at:], 1)
+	}
+	if md.xmp != nil {
+		md.xmp = xmpOrientation.ReplaceAll(md.xmp, []byte("${1}1"))
+	}
+}
+
+// orient returns img turned upright according to an EXIF orientation, keeping
+// 16 bits per channel for deep images
+func orient(img image.Image, orientation int) image.Image {
+	b := img.Bounds()
+	if orientation < 2 || orientation > 8 || b.Empty() {
+		return img
+	}
+	src := image.Rect(0, 0, b.Dx(), b.Dy())
+	dst := src
+	if orientation >= 5 {
+		dst = image.Rect(0, 0, b.Dy(), b.Dx())
+	}
+	if isDeep(img) {
+		s, d := image.NewNRGBA64(src), image.NewNRGBA64(dst)
+		draw.Draw(s, src, img, b.Min, draw.Src)
+		orientPix(d.Pix, d.Stride, s.Pix, s.Stride, 8, orientation)
+		return d
+	}
+	s, d := image.NewNRGBA(src), image.NewNRGBA(dst)
+	draw.Draw(s, src, img, b.Min, draw.Src)
+	orientPix(d.Pix, d.Stride, s.Pix, s.Stride, 4, orientation)
+	return d
+}
+
+// orientPix moves the pixels of src, of bpp bytes each, to their upright
+// position in dst
+func orientPix(dst []uint8, dstStride int, src []uint8, srcStride, bpp, orientation int) {
+	w, h := srcStride/bpp, len(src)/srcStride
+	for y := range h {
+		for x := range w {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			copy(dst[dy*dstStride+dx*bpp:][:bpp], src[y*srcStride+x*bpp:])
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package rmbg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// orientedEXIF is an EXIF block holding only an orientation
+func orientedEXIF(order binary.AppendByteOrder, orientation uint16) []byte {
+	exif := []byte("II*\x00")
+	if order == binary.BigEndian {
+		exif = []byte("MM\x00*")
+	}
+	exif = order.AppendUint32(exif, 8)
+	exif = order.AppendUint16(exif, 1)
+	exif = order.AppendUint16(exif, exifTagOrientation)
+	exif = order.AppendUint16(exif, 3)
+	exif = order.AppendUint32(exif, 1)
+	exif = order.AppendUint16(exif, orientation)
+	exif = order.AppendUint16(exif, 0)
+	return order.AppendUint32(exif, 0)
+}
+
+func TestOrient(t *testing.T) {
+	src := gradientImage(5, 3)
+	for o, want := range map[int]*image.NRGBA{
+		2: imaging.FlipH(src),
+		3: imaging.Rotate180(src),
+		4: imaging.FlipV(src),
+		5: imaging.Transpose(src),
+		6: imaging.Rotate270(src),
+		7: imaging.Transverse(src),
+		8: imaging.Rotate90(src),
+	} {
+		got := orient(src, o).(*image.NRGBA)
+		if got.Rect != want.Rect || !bytes.Equal(got.Pix, want.Pix) {
+			t.Errorf("orientation %d: expected %v image, got %v", o, want.Rect, got.Rect)
+		}
+	}
+	if got := orient(src, 1); got != image.Image(src) {
+		t.Errorf("expected orientation 1 to keep the image")
+	}
+
+	t.Run("Deep", func(t *testing.T) {
+		deep := image.NewNRGBA64(image.Rect(2, 2, 6, 4))
+		deep.SetNRGBA64(2, 2, color.NRGBA64{R: 0x1234, A: 0xffff})
+		got, ok := orient(deep, 6).(*image.NRGBA64)
+		if !ok {
+			t.Fatalf("expected *image.NRGBA64, got %T", orient(deep, 6))
+		}
+		if got.Rect != image.Rect(0, 0, 2, 4) {
+			t.Errorf("expected 2x4, got %v", got.Rect)
+		}
+		if c := got.NRGBA64At(1, 0); c.R != 0x1234 {
+			t.Errorf("expected the top-left pixel at the top right, got %v", c)
+		}
+	})
+}
+
+func TestEXIFOrientation(t *testing.T) {
+	for _, order := range []binary.AppendByteOrder{binary.LittleEndian, binary.BigEndian} {
+		exif := orientedEXIF(order, 6)
+		md := metadata{exif: exif, xmp: []byte(`<x tiff:Orientation="6"/><tiff:Orientation>6</tiff:Orientation>`)}
+		if o := md.orientation(); o != 6 {
+			t.Errorf("expected orientation 6, got %d", o)
+		}
+		md.resetOrientation()
+		if o := md.orientation(); o != 1 {
+			t.Errorf("expected orientation 1 after reset, got %d", o)
+		}
+		if o, _ := exifOrientation(exif); o != 6 {
+			t.Errorf("expected the input EXIF to be left alone, got %d", o)
+		}
+		if want := `<x tiff:Orientation="1"/><tiff:Orientation>1</tiff:Orientation>`; string(md.xmp) != want {
+			t.Errorf("expected %s, got %s", want, md.xmp)
+		}
+	}
+	if o := (&metadata{exif: []byte("II*\x00\x08")}).orientation(); o != 1 {
+		t.Errorf("expected orientation 1 for truncated EXIF, got %d", o)
+	}
+}
+
+func TestAutoOrientation(t *testing.T) {
+	xmp := []byte(`<rdf:Description tiff:Orientation="6"/>`)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, solidImage(16, 8, color.NRGBA{G: 200, A: 255}), nil); err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	input := writeJPEGMetadata(buf.Bytes(), metadata{exif: orientedEXIF(binary.BigEndian, 6), xmp: xmp})
+	dir := t.TempDir()
+	inPath := filepath.Join(dir, "in.jpg")
+	if err := os.WriteFile(inPath, input, 0o644); err != nil {
+		t.Fatalf("failed to write input: %v", err)
+	}
+
+	t.Run("DecodeImage", func(t *testing.T) {
+		img, err := DecodeImage(bytes.NewReader(input), nil)
+		if err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+		if got := img.Bounds().Size(); got != image.Pt(8, 16) {
+			t.Errorf("expected 8x16, got %v", got)
+		}
+		img, err = DecodeImage(bytes.NewReader(input), &DecodeOptions{IgnoreOrientation: true})
+		if err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+		if got := img.Bounds().Size(); got != image.Pt(16, 8) {
+			t.Errorf("expected 16x8, got %v", got)
+		}
+	})
+
+	upright, err := DecodeImage(bytes.NewReader(input), nil)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	stored, err := DecodeImage(bytes.NewReader(input), &DecodeOptions{IgnoreOrientation: true})
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	r := cachedEngine(upright, stored)
+
+	for _, format := range []string{"jpg", "png", "webp"} {
+		t.Run(format, func(t *testing.T) {
+			outPath := filepath.Join(dir, "out."+format)
+			if err := r.ProcessFile(inPath, outPath, nil); err != nil {
+				t.Fatalf("ProcessFile failed: %v", err)
+			}
+			data, err := os.ReadFile(outPath)
+			if err != nil {
+				t.Fatalf("failed to read output: %v", err)
+			}
+			cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("failed to decode output: %v", err)
+			}
+			if cfg.Width != 8 || cfg.Height != 16 {
+				t.Errorf("expected 8x16 output, got %dx%d", cfg.Width, cfg.Height)
+			}
+			md := readMetadata(data)
+			if o := md.orientation(); o != 1 || md.exif == nil {
+				t.Errorf("expected EXIF with orientation 1, got %d", o)
+			}
+			if want := `<rdf:Description tiff:Orientation="1"/>`; string(md.xmp) != want {
+				t.Errorf("expected XMP %s, got %s", want, md.xmp)
+			}
+		})
+	}
+
+	t.Run("IgnoreOrientation", func(t *testing.T) {
+		var out bytes.Buffer
+		opts := &IOOptions{Decode: &DecodeOptions{IgnoreOrientation: true}}
+		if err := r.RemoveBackgroundFrom(bytes.NewReader(input), &out, FormatJPEG, opts); err != nil {
+			t.Fatalf("RemoveBackgroundFrom failed: %v", err)
+		}
+		if md := readMetadata(out.Bytes()); md.orientation() != 6 || !bytes.Equal(md.xmp, xmp) {
+			t.Errorf("expected orientation 6 to be kept, got %d and %s", md.orientation(), md.xmp)
+		}
+	})
+}
@@ -0,0 +1,142 @@
+package rmbg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// Default colors of DebugOverlay
+var (
+	DefaultOverlayColor = color.NRGBA{R: 255, G: 0, B: 255, A: 255}
+	DefaultContourColor = color.NRGBA{R: 255, G: 255, B: 0, A: 255}
+	DefaultBoundsColor  = color.NRGBA{R: 0, G: 255, B: 255, A: 255}
+)
+
+// defaultOverlayOpacity is the default OverlayOptions.Opacity
+const defaultOverlayOpacity = 0.45
+
+// OverlayOptions configures DebugOverlay
+type OverlayOptions struct {
+	// Color tints the object in proportion to the mask (default:
+	// DefaultOverlayColor)
+	Color color.Color
+	// Opacity is the strength of the tint on fully opaque mask pixels, from 0
+	// to 1 (default: 0.45)
+	Opacity float64
+	// ContourColor draws the contours of the object (default:
+	// DefaultContourColor)
+	ContourColor color.Color
+	// BoundsColor draws the bounding box of the object (default:
+	// DefaultBoundsColor)
+	BoundsColor color.Color
+	// LineWidth is the width of contours and bounding box in pixels (default:
+	// 1 per 400 pixels of the shorter side, at least 1)
+	LineWidth int
+	// Threshold is the mask value from which a pixel belongs to the object,
+	// for contours and bounding box (default: 128)
+	Threshold uint8
+}
+
+// DebugOverlay renders mask over img for inspection: the object is tinted
+// with a translucent color, outlined by the contours ExtractContours finds
+// at the threshold, and framed by its bounding box. The mask must have the
+// size of img. Tuning thresholds or reporting a bad mask is easier on this
+// than on the mask alone.
+func DebugOverlay(img image.Image, mask *image.Gray, opts *OverlayOptions) (*image.RGBA, error) {
+	o := OverlayOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Color == nil {
+		o.Color = DefaultOverlayColor
+	}
+	if o.Opacity <= 0 {
+		o.Opacity = defaultOverlayOpacity
+	}
+	o.Opacity = min(o.Opacity, 1)
+	if o.ContourColor == nil {
+		o.ContourColor = DefaultContourColor
+	}
+	if o.BoundsColor == nil {
+		o.BoundsColor = DefaultBoundsColor
+	}
+	if o.Threshold == 0 {
+		o.Threshold = 128
+	}
+	b := img.Bounds()
+	if o.LineWidth <= 0 {
+		o.LineWidth = max(1, min(b.Dx(), b.Dy())/400)
+	}
+	if mask.Bounds().Size() != b.Size() {
+		return nil, fmt.Errorf("overlay: %v mask for a %v image", mask.Bounds().Size(), b.Size())
+	}
+
+	dst := image.NewRGBA(b)
+	draw.Draw(dst, b, img, b.Min, draw.Src)
+	tint := color.RGBAModel.Convert(o.Color).(color.RGBA)
+	parallelRows(b.Dy(), func(start, end int) {
+		for y := start; y < end; y++ {
+			row := dst.Pix[y*dst.Stride:][:b.Dx()*4]
+			mrow := mask.Pix[y*mask.Stride:][:b.Dx()]
+			for x, m := range mrow {
+				if m == 0 {
+					continue
+				}
+				a := float64(m) / 255 * o.Opacity
+				p := row[x*4 : x*4+4 : x*4+4]
+				p[0] = uint8(float64(p[0])*(1-a) + float64(tint.R)*a + 0.5)
+				p[1] = uint8(float64(p[1])*(1-a) + float64(tint.G)*a + 0.5)
+				p[2] = uint8(float64(p[2])*(1-a) + float64(tint.B)*a + 0.5)
+				p[3] = uint8(float64(p[3])*(1-a) + 255*a + 0.5)
+			}
+		}
+	})
+
+	info, err := MeasureObject(b, mask, o.Threshold)
+	if err != nil {
+		// Nothing to outline
+		return dst, nil
+	}
+	aligned := &image.Gray{Pix: mask.Pix, Stride: mask.Stride, Rect: b}
+	pen := image.NewUniform(o.ContourColor)
+	for _, poly := range ExtractContours(aligned, &ContourConfig{Threshold: o.Threshold}) {
+		for i := range poly {
+			strokeLine(dst, poly[i], poly[(i+1)%len(poly)], o.LineWidth, pen)
+		}
+	}
+	strokeRect(dst, info.BBox, o.LineWidth, image.NewUniform(o.BoundsColor))
+	return dst, nil
+}
+
+// strokeLine draws a line of the given width from p to q by stamping squares
+// along it
+func strokeLine(dst draw.Image, p, q Point, width int, src image.Image) {
+	steps := int(math.Ceil(math.Max(math.Abs(q.X-p.X), math.Abs(q.Y-p.Y))))
+	half := float64(width) / 2
+	for i := 0; i <= steps; i++ {
+		t := 0.0
+		if steps > 0 {
+			t = float64(i) / float64(steps)
+		}
+		x := p.X + (q.X-p.X)*t
+		y := p.Y + (q.Y-p.Y)*t
+		x0, y0 := int(math.Floor(x-half)), int(math.Floor(y-half))
+		draw.Draw(dst, image.Rect(x0, y0, x0+width, y0+width), src, image.Point{}, draw.Src)
+	}
+}
+
+// strokeRect draws the outline of r, width pixels thick, inside r
+func strokeRect(dst draw.Image, r image.Rectangle, width int, src image.Image) {
+	width = min(width, r.Dx(), r.Dy())
+	for _, side := range []image.Rectangle{
+		{r.Min, image.Pt(r.Max.X, r.Min.Y+width)},
+		{image.Pt(r.Min.X, r.Max.Y-width), r.Max},
+		{r.Min, image.Pt(r.Min.X+width, r.Max.Y)},
+		{image.Pt(r.Max.X-width, r.Min.Y), r.Max},
+	} {
+		draw.Draw(dst, side, src, image.Point{}, draw.Src)
+	}
+}
@@ -0,0 +1,78 @@
+package rmbg
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestDebugOverlay(t *testing.T) {
+	img := solidImage(40, 30, color.NRGBA{R: 100, G: 100, B: 100, A: 255})
+	mask := image.NewGray(img.Rect)
+	fillRect(mask, image.Rect(10, 10, 30, 20), 255)
+
+	out, err := DebugOverlay(img, mask, nil)
+	if err != nil {
+		t.Fatalf("DebugOverlay failed: %v", err)
+	}
+	at := func(x, y int) color.RGBA {
+		return out.RGBAAt(x, y)
+	}
+	if got := at(2, 2); got != (color.RGBA{R: 100, G: 100, B: 100, A: 255}) {
+		t.Errorf("expected the background untouched, got %v", got)
+	}
+	// 100 tinted 45% toward 255 and 0
+	if got := at(20, 15); got != (color.RGBA{R: 170, G: 55, B: 170, A: 255}) {
+		t.Errorf("expected a tinted object, got %v", got)
+	}
+	// The bounding box is drawn over the contour along the object's border
+	for _, p := range []image.Point{{10, 15}, {29, 15}, {20, 10}, {20, 19}} {
+		if got := at(p.X, p.Y); got != (color.RGBA{G: 255, B: 255, A: 255}) {
+			t.Errorf("expected the bounding box at %v, got %v", p, got)
+		}
+	}
+
+	t.Run("Contour", func(t *testing.T) {
+		// A disk's contour lies inside its bounding box
+		disk := image.NewGray(img.Rect)
+		for y := range 30 {
+			for x := range 40 {
+				if (x-20)*(x-20)+(y-15)*(y-15) <= 100 {
+					disk.SetGray(x, y, color.Gray{Y: 255})
+				}
+			}
+		}
+		out, err := DebugOverlay(img, disk, &OverlayOptions{BoundsColor: color.Black})
+		if err != nil {
+			t.Fatalf("DebugOverlay failed: %v", err)
+		}
+		yellow := 0
+		for i := 0; i < len(out.Pix); i += 4 {
+			if out.Pix[i] == 255 && out.Pix[i+1] == 255 && out.Pix[i+2] == 0 {
+				yellow++
+			}
+		}
+		if yellow < 30 {
+			t.Errorf("expected a contour of at least 30 pixels, got %d", yellow)
+		}
+		if got := out.RGBAAt(10, 5); got != (color.RGBA{A: 255}) {
+			t.Errorf("expected the black bounding box corner, got %v", got)
+		}
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		out, err := DebugOverlay(img, image.NewGray(img.Rect), nil)
+		if err != nil {
+			t.Fatalf("DebugOverlay failed: %v", err)
+		}
+		if got := out.RGBAAt(20, 15); got != (color.RGBA{R: 100, G: 100, B: 100, A: 255}) {
+			t.Errorf("expected the image unchanged, got %v", got)
+		}
+	})
+
+	t.Run("SizeMismatch", func(t *testing.T) {
+		if _, err := DebugOverlay(img, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err == nil {
+			t.Errorf("expected error for a mask of another size")
+		}
+	})
+}
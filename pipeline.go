@@ -0,0 +1,325 @@
+package rmbg
+
+import (
+	"context"
+	"errors"
+	"image"
+	"io"
+	"log/slog"
+	"runtime"
+	"sync"
+	"time"
+)
+
+var errNoImage = errors.New("pipeline job has neither an image nor a reader")
+
+// PipelineConfig sizes the stages of a Pipeline
+type PipelineConfig struct {
+	// DecodeWorkers decode jobs given as readers (default: number of CPUs)
+	DecodeWorkers int
+	// PreprocessWorkers resize and normalize images into model tensors (default: 1)
+	PreprocessWorkers int
+	// InferWorkers run the model (default: one per session)
+	InferWorkers int
+	// PostprocessWorkers decode masks, upsample them and composite the output
+	// (default: 1)
+	PostprocessWorkers int
+	// Buffer is the capacity of the queues between stages; 0 makes every stage
+	// wait for the next one
+	Buffer int
+	// Decode bounds the decoding of reader jobs (default: DecodeImage defaults)
+	Decode *DecodeOptions
+	// Crop additionally smart crops every result when set, as RemoveAndCrop does
+	Crop *CropConfig
+}
+
+// PipelineJob is one image to process. Exactly one of Image and Reader is used;
+// Image takes precedence.
+type PipelineJob struct {
+	// ID is returned unchanged with the result
+	ID any
+	// Image is an already decoded image
+	Image image.Image
+	// Reader is decoded by the decode stage
+	Reader io.Reader
+}
+
+// PipelineResult is the outcome of one job
+type PipelineResult struct {
+	// ID is the ID of the job
+	ID any
+	// Result is the processed image, nil if Err is set
+	Result *Result
+	// Err is the error for this job only
+	Err error
+}
+
+// Pipeline processes a stream of jobs through decode, preprocess, inference and
+// postprocess stages that each run on their own fixed set of workers, so
+// decoding and compositing overlap with inference. The queues between stages
+// are bounded, so a slow stage holds back the ones before it instead of
+// buffering images.
+type Pipeline struct {
+	r       *RemBG
+	config  PipelineConfig
+	workers [4]int
+}
+
+// NewPipeline creates a pipeline running on r
+func (r *RemBG) NewPipeline(config *PipelineConfig) (*Pipeline, error) {
+	if config == nil {
+		config = &PipelineConfig{}
+	}
+	if config.Crop != nil {
+		if err := config.Crop.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	p := &Pipeline{r: r, config: *config}
+	defaults := [4]int{runtime.NumCPU(), 1, r.sessionCount(), 1}
+	for i, n := range [4]int{config.DecodeWorkers, config.PreprocessWorkers, config.InferWorkers, config.PostprocessWorkers} {
+		p.workers[i] = n
+		if n <= 0 {
+			p.workers[i] = defaults[i]
+		}
+	}
+	if p.config.Buffer < 0 {
+		p.config.Buffer = 0
+	}
+	return p, nil
+}
+
+// pipelineItem carries a job through the stages
+type pipelineItem struct {
+	job   PipelineJob
+	img   image.Image
+	start *callStart
+	// downscale is set when img was shrunk under ResolutionDownscale
+	downscale *Downscale
+
+	// Set by preprocess when the model runs in a single pass, otherwise infer
+	// runs the full prediction
+	m      *model
+	key    uint64
+	near   *nearKey
+	area   image.Rectangle
+	input  *[]float32
+	output *[]float32
+	timing stageTimes
+
+	pred *prediction
+	res  *Result
+	err  error
+}
+
+// discard returns the buffers and model held by an item that will not be
+// finished
+func (it *pipelineItem) discard() {
+	if it.input != nil {
+		it.m.inputs.put(it.input)
+	}
+	if it.output != nil {
+		it.m.outputs.put(it.output)
+	}
+	it.input, it.output = nil, nil
+	it.release()
+}
+
+// release lets go of the model selected by preprocess
+func (it *pipelineItem) release() {
+	if it.m != nil {
+		it.m.release()
+		it.m = nil
+	}
+}
+
+// Run starts the workers and processes the jobs received from jobs. Results
+// are sent in completion order. The returned channel is closed once jobs is
+// closed and every job has been processed, or once ctx is canceled, in which
+// case unfinished jobs are dropped.
+func (p *Pipeline) Run(ctx context.Context, jobs <-chan PipelineJob) <-chan PipelineResult {
+	p.r.log(slog.LevelDebug, "pipeline started",
+		slog.Int("decode_workers", p.workers[0]),
+		slog.Int("preprocess_workers", p.workers[1]),
+		slog.Int("infer_workers", p.workers[2]),
+		slog.Int("postprocess_workers", p.workers[3]),
+		slog.Int("buffer", p.config.Buffer),
+	)
+	queue := func() chan *pipelineItem { return make(chan *pipelineItem, p.config.Buffer) }
+
+	src := queue()
+	go func() {
+		defer close(src)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case job, ok := <-jobs:
+				if !ok {
+					return
+				}
+				select {
+				case src <- &pipelineItem{job: job}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	decoded := pipelineStage(ctx, src, queue(), p.workers[0], p.decode)
+	preprocessed := pipelineStage(ctx, decoded, queue(), p.workers[1], p.preprocess)
+	inferred := pipelineStage(ctx, preprocessed, queue(), p.workers[2], p.infer)
+	done := pipelineStage(ctx, inferred, queue(), p.workers[3], p.postprocess)
+
+	out := make(chan PipelineResult)
+	go func() {
+		defer close(out)
+		for it := range done {
+			// Failed items may still hold their model
+			it.release()
+			select {
+			case out <- PipelineResult{ID: it.job.ID, Result: it.res, Err: it.err}:
+			case <-ctx.Done():
+				if it.res != nil {
+					it.res.Release()
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// pipelineStage runs fn on the items received from in with the given number of
+// workers and forwards them to out, which is closed when in is drained. Items
+// that failed in an earlier stage are forwarded untouched; after cancellation
+// items are discarded.
+func pipelineStage(ctx context.Context, in <-chan *pipelineItem, out chan *pipelineItem, workers int, fn func(*pipelineItem)) <-chan *pipelineItem {
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Go(func() {
+			for it := range in {
+				if ctx.Err() != nil {
+					it.discard()
+					continue
+				}
+				if it.err == nil {
+					fn(it)
+				}
+				select {
+				case out <- it:
+				case <-ctx.Done():
+					it.discard()
+				}
+			}
+		})
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+func (p *Pipeline) decode(it *pipelineItem) {
+	if it.job.Image != nil {
+		it.img = it.job.Image
+		return
+	}
+	if it.job.Reader == nil {
+		it.err = errNoImage
+		return
+	}
+	it.img, it.err = DecodeImage(it.job.Reader, p.config.Decode)
+	p.r.countError(ErrorKindDecode, it.err)
+}
+
+func (p *Pipeline) preprocess(it *pipelineItem) {
+	r := p.r
+	it.start = r.stats.begin()
+	it.img, it.downscale = r.limitOutput(it.img)
+	// Tiled predictions and those of multiPass run several inferences per
+	// image, and images still above the pixel limit are shrunk or rejected,
+	// so they are left to the infer stage as a whole
+	if r.useTiles(it.img) || r.multiPass() || r.overLimit(it.img) {
+		return
+	}
+
+	r.observeImage(it.img)
+	m, err := r.selectModel(it.img)
+	if err != nil {
+		it.err = r.countError("", err)
+		return
+	}
+	it.m = m
+	if r.cache != nil {
+		var ok bool
+		if it.pred, it.key, it.near, ok = r.cachedPrediction(it.img, m); ok {
+			it.release()
+			return
+		}
+	}
+
+	infer, d, err := r.preProcessed(it.img)
+	if err != nil {
+		it.err = r.countError("", err)
+		it.release()
+		return
+	}
+	t0 := time.Now()
+	it.area = m.inputArea(infer.Bounds().Size())
+	it.input = m.preprocess(infer, it.area)
+	it.timing.preprocess = d + time.Since(t0)
+	r.stage(StagePreprocess, it.timing.preprocess)
+}
+
+func (p *Pipeline) infer(it *pipelineItem) {
+	if it.pred != nil {
+		return
+	}
+	if it.input == nil {
+		it.pred, it.err = p.r.predict(it.img)
+		return
+	}
+
+	t0 := time.Now()
+	input := it.input
+	it.input = nil
+	it.output, it.err = it.m.infer(input)
+	it.timing.inference = time.Since(t0)
+	if it.err == nil {
+		p.r.stage(StageInference, it.timing.inference)
+	}
+	p.r.countError("", it.err)
+}
+
+func (p *Pipeline) postprocess(it *pipelineItem) {
+	r := p.r
+	if it.output != nil {
+		t0 := time.Now()
+		output := it.output
+		it.output = nil
+		it.pred = it.m.decode(output, it.area)
+		it.timing.decode = time.Since(t0)
+		it.release()
+		if r.cache != nil {
+			r.cachePrediction(it.key, it.near, it.pred)
+		}
+		it.pred.timing = it.timing
+	}
+
+	it.res, it.err = r.compose(it.img, it.pred, it.start)
+	if it.err != nil {
+		return
+	}
+	if it.downscale != nil {
+		it.res.Downscale = it.downscale
+	}
+	if p.config.Crop != nil {
+		if err := cropResult(it.res, it.img, it.pred.mask, p.config.Crop); err != nil {
+			it.res.Release()
+			it.res, it.err = nil, err
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package rmbg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// cachedEngine returns an engine without a session whose cache holds a full
+// mask for every image in imgs, so only cache hits can succeed
+func cachedEngine(imgs ...image.Image) *RemBG {
+	m := &model{spec: ModelU2NetP}
+	r := &RemBG{model: m, cache: newMaskCache(len(imgs) + 1), blurPool: newBlurBufferPool()}
+	for _, img := range imgs {
+		mask := image.NewGray(image.Rect(0, 0, 8, 8))
+		for i := range mask.Pix {
+			mask.Pix[i] = 255
+		}
+		r.cache.put(hashImage(img, m.spec.Name), &prediction{mask: mask})
+	}
+	return r
+}
+
+func solidImage(w, h int, c color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	return img
+}
+
+func TestPipeline(t *testing.T) {
+	red := solidImage(20, 10, color.NRGBA{R: 255, A: 255})
+	blue := solidImage(10, 30, color.NRGBA{B: 255, A: 255})
+
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, blue); err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+
+	t.Run("Jobs", func(t *testing.T) {
+		p, err := cachedEngine(red, blue).NewPipeline(&PipelineConfig{Buffer: 2})
+		if err != nil {
+			t.Fatalf("NewPipeline failed: %v", err)
+		}
+
+		jobs := make(chan PipelineJob, 3)
+		jobs <- PipelineJob{ID: "image", Image: red}
+		jobs <- PipelineJob{ID: "reader", Reader: &encoded}
+		jobs <- PipelineJob{ID: "empty"}
+		close(jobs)
+
+		got := map[any]PipelineResult{}
+		for res := range p.Run(context.Background(), jobs) {
+			got[res.ID] = res
+		}
+		if len(got) != 3 {
+			t.Fatalf("expected 3 results, got %d", len(got))
+		}
+
+		if res := got["image"]; res.Err != nil || res.Result.Image.Bounds().Size() != image.Pt(20, 10) {
+			t.Errorf("expected 20x10 result, got %+v", res)
+		}
+		if res := got["reader"]; res.Err != nil || res.Result.Image.Bounds().Size() != image.Pt(10, 30) {
+			t.Errorf("expected 10x30 result, got %+v", res)
+		}
+		if res := got["empty"]; !errors.Is(res.Err, errNoImage) {
+			t.Errorf("expected errNoImage, got %v", res.Err)
+		}
+	})
+
+	t.Run("Crop", func(t *testing.T) {
+		p, err := cachedEngine(red).NewPipeline(&PipelineConfig{Crop: &CropConfig{}})
+		if err != nil {
+			t.Fatalf("NewPipeline failed: %v", err)
+		}
+		jobs := make(chan PipelineJob, 1)
+		jobs <- PipelineJob{Image: red}
+		close(jobs)
+
+		res := <-p.Run(context.Background(), jobs)
+		if res.Err != nil {
+			t.Fatalf("expected no error, got %v", res.Err)
+		}
+		if res.Result.Cropped == nil || res.Result.Bounds == nil {
+			t.Errorf("expected crop fields to be set")
+		}
+	})
+
+	t.Run("NearDuplicate", func(t *testing.T) {
+		img := hashPattern(40, 30, false)
+		r := cachedEngine()
+		r.cache.distance = 4
+		mask := image.NewGray(image.Rect(0, 0, 8, 8))
+		r.cache.putNear(hashImage(img, ModelU2NetP.Name), nearKeyOf(img, ModelU2NetP.Name), &prediction{mask: mask})
+		p, err := r.NewPipeline(nil)
+		if err != nil {
+			t.Fatalf("NewPipeline failed: %v", err)
+		}
+		jobs := make(chan PipelineJob, 1)
+		jobs <- PipelineJob{Image: imaging.AdjustBrightness(img, 5)}
+		close(jobs)
+
+		// The model has no session, so only a cache hit can succeed
+		if res := <-p.Run(context.Background(), jobs); res.Err != nil {
+			t.Fatalf("expected the near-duplicate's mask, got %v", res.Err)
+		}
+	})
+
+	t.Run("InvalidCrop", func(t *testing.T) {
+		_, err := cachedEngine().NewPipeline(&PipelineConfig{Crop: &CropConfig{Margin: -1}})
+		if !errors.Is(err, ErrInvalidMargin) {
+			t.Errorf("expected ErrInvalidMargin, got %v", err)
+		}
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		p, err := cachedEngine(red).NewPipeline(nil)
+		if err != nil {
+			t.Fatalf("NewPipeline failed: %v", err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		jobs := make(chan PipelineJob)
+		out := p.Run(ctx, jobs)
+
+		jobs <- PipelineJob{Image: red}
+		if res := <-out; res.Err != nil {
+			t.Fatalf("expected no error, got %v", res.Err)
+		}
+
+		// The jobs channel is never closed; cancellation alone must close the output
+		cancel()
+		for range out {
+		}
+	})
+}
+
+func TestNewPipelineDefaults(t *testing.T) {
+	p, err := (&RemBG{}).NewPipeline(&PipelineConfig{InferWorkers: 3, Buffer: -1})
+	if err != nil {
+		t.Fatalf("NewPipeline failed: %v", err)
+	}
+	if p.workers[1] != 1 || p.workers[2] != 3 || p.workers[3] != 1 {
+		t.Errorf("expected workers [n 1 3 1], got %v", p.workers)
+	}
+	if p.config.Buffer != 0 {
+		t.Errorf("expected negative buffer to be clamped, got %d", p.config.Buffer)
+	}
+}
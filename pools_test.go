@@ -1,7 +1,9 @@
 package rmbg
 
 import (
+	"image"
 	"testing"
+	"time"
 )
 
 func TestBlurBufferPool(t *testing.T) {
@@ -43,52 +45,126 @@ func TestBlurBufferPool(t *testing.T) {
 	})
 }
 
-func TestTensorPool(t *testing.T) {
-	// tensorPool relies on ONNX Runtime environment.
-	// If it's not initialized (e.g. missing shared libraries),
-	// the New functions might return nil or the init() might have panicked.
+func TestSessionPool(t *testing.T) {
+	a, b := &backendSession{}, &backendSession{}
+	pool := newSessionPool([]session{a, b})
+	if pool.size() != 2 {
+		t.Fatalf("expected 2 sessions, got %d", pool.size())
+	}
 
-	pool := newTensorPool()
+	acquire := func() session {
+		s, ok := pool.acquire()
+		if !ok {
+			t.Fatalf("expected open pool")
+		}
+		return s
+	}
+	first, second := acquire(), acquire()
+	if first == second {
+		t.Fatalf("expected distinct sessions for concurrent callers")
+	}
+
+	// A third caller waits until a session is released
+	got := make(chan session)
+	go func() { got <- acquire() }()
+	select {
+	case <-got:
+		t.Fatalf("expected acquire to block while all sessions are in use")
+	case <-time.After(10 * time.Millisecond):
+	}
+	pool.release(first)
+	if s := <-got; s != first {
+		t.Errorf("expected the released session, got another one")
+	}
+
+	// Close waits for the sessions still in use
+	closed := make(chan error)
+	go func() { closed <- pool.close() }()
+	pool.release(first)
+	select {
+	case <-closed:
+		t.Fatalf("expected close to wait for every session")
+	case <-time.After(10 * time.Millisecond):
+	}
+	pool.release(second)
+	if err := <-closed; err != nil {
+		t.Errorf("expected empty sessions to close cleanly, got %v", err)
+	}
+	if pool.size() != 0 {
+		t.Errorf("expected closed pool to be empty, got %d", pool.size())
+	}
+	if _, ok := pool.acquire(); ok {
+		t.Errorf("expected acquire to fail on a closed pool")
+	}
+}
+
+func TestFloatPool(t *testing.T) {
+	pool := newFloatPool(12)
+	buf := pool.get()
+	if len(*buf) != 12 {
+		t.Fatalf("expected 12 values, got %d", len(*buf))
+	}
+	pool.put(buf)
+	if again := pool.get(); len(*again) != 12 {
+		t.Errorf("expected 12 values, got %d", len(*again))
+	}
+}
 
-	t.Run("InputTensor", func(t *testing.T) {
-		input := pool.getInput()
-		if input == nil {
-			t.Log("Input tensor is nil - ORT environment might not be fully initialized in this environment")
-			return
+func TestImagePool(t *testing.T) {
+	t.Run("Nil", func(t *testing.T) {
+		var p *imagePool
+		img := p.rgba(image.Rect(5, 5, 15, 10))
+		if len(img.Pix) != 200 || img.Stride != 40 {
+			t.Errorf("expected 200 bytes with stride 40, got %d and %d", len(img.Pix), img.Stride)
 		}
-		defer pool.putInput(input)
+		p.putPix(img.Pix) // must not panic
+	})
+
+	t.Run("Reuse", func(t *testing.T) {
+		p := newImagePool()
+		img := p.gray(10, 10)
+		p.putPix(img.Pix)
 
-		shape := input.GetShape()
-		expected := []int64{1, 3, inputSize, inputSize}
-		if len(shape) != len(expected) {
-			t.Errorf("Expected shape length %d, got %d", len(expected), len(shape))
-			return
+		// A smaller image may reuse the buffer; a larger one must not
+		small := p.gray(5, 5)
+		if len(small.Pix) != 25 || small.Bounds() != image.Rect(0, 0, 5, 5) {
+			t.Errorf("expected 5x5 gray, got %v with %d bytes", small.Bounds(), len(small.Pix))
 		}
-		for i := range expected {
-			if shape[i] != expected[i] {
-				t.Errorf("Expected shape[%d] = %d, got %d", i, expected[i], shape[i])
-			}
+		p.putPix(small.Pix)
+		large := p.gray(20, 20)
+		if len(large.Pix) != 400 {
+			t.Errorf("expected 400 bytes, got %d", len(large.Pix))
 		}
 	})
 
-	t.Run("OutputTensor", func(t *testing.T) {
-		output := pool.getOutput()
-		if output == nil {
-			t.Log("Output tensor is nil - ORT environment might not be fully initialized in this environment")
-			return
+	t.Run("Release", func(t *testing.T) {
+		p := newImagePool()
+		res := &Result{Image: p.rgba(image.Rect(0, 0, 4, 4)), Mask: p.gray(4, 4), pool: p}
+		res.Release()
+		if res.Image != nil || res.Mask != nil {
+			t.Error("expected released result to be cleared")
 		}
-		defer pool.putOutput(output)
+		res.Release() // idempotent
 
-		shape := output.GetShape()
-		expected := []int64{1, 1, inputSize, inputSize}
-		if len(shape) != len(expected) {
-			t.Errorf("Expected shape length %d, got %d", len(expected), len(shape))
-			return
-		}
-		for i := range expected {
-			if shape[i] != expected[i] {
-				t.Errorf("Expected shape[%d] = %d, got %d", i, expected[i], shape[i])
-			}
+		unpooled := &Result{Image: image.NewRGBA(image.Rect(0, 0, 1, 1))}
+		unpooled.Release()
+		if unpooled.Image != nil {
+			t.Error("expected unpooled result to be cleared")
 		}
 	})
 }
+
+// openModel returns a model with one empty session holding a reference on the
+// environment, as newModel would
+func openModel(t *testing.T) *model {
+	t.Helper()
+	envMu.Lock()
+	envRefs++
+	envMu.Unlock()
+	return &model{
+		spec:     ModelU2NetP,
+		sessions: newSessionPool([]session{&backendSession{}}),
+		inputs:   newFloatPool(3),
+		outputs:  newFloatPool(1),
+	}
+}
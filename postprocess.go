@@ -0,0 +1,139 @@
+package rmbg
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/disintegration/imaging"
+)
+
+// DefaultFeatherSigma is the default Feather.Sigma
+const DefaultFeatherSigma = 1.0
+
+// decontaminateBackground is the mask value below which a pixel counts toward
+// the background color Decontaminate removes
+const decontaminateBackground = 16
+
+// PostProcessor adjusts a segmentation before it is composited. Apply gets
+// an 8-bit copy of the source image and its mask, both zero-based and of the
+// same size, and may change either in place.
+type PostProcessor interface {
+	Apply(img *image.NRGBA, mask *image.Gray) error
+}
+
+// PostProcessorFunc adapts a function to the PostProcessor interface
+type PostProcessorFunc func(img *image.NRGBA, mask *image.Gray) error
+
+// Apply calls f(img, mask)
+func (f PostProcessorFunc) Apply(img *image.NRGBA, mask *image.Gray) error {
+	return f(img, mask)
+}
+
+// Feather softens the edge of the mask with a Gaussian blur
+type Feather struct {
+	// Sigma is the standard deviation of the blur in pixels (default:
+	// DefaultFeatherSigma)
+	Sigma float64
+}
+
+// Apply implements PostProcessor
+func (f Feather) Apply(img *image.NRGBA, mask *image.Gray) error {
+	sigma := f.Sigma
+	if sigma <= 0 {
+		sigma = DefaultFeatherSigma
+	}
+	blurred := imaging.Blur(mask, sigma)
+	w, h := mask.Rect.Dx(), mask.Rect.Dy()
+	parallelRows(h, func(start, end int) {
+		for y := start; y < end; y++ {
+			row := mask.Pix[y*mask.Stride:][:w]
+			src := blurred.Pix[y*blurred.Stride:][:w*4]
+			for x := range row {
+				row[x] = src[x*4]
+			}
+		}
+	})
+	return nil
+}
+
+// Decontaminate removes the background color mixed into semi-transparent
+// edge pixels. The background color is the mean of the pixels outside the
+// mask; a pixel of alpha a is solved for the foreground color F in
+// C = a*F + (1-a)*B, so edges stop carrying a halo of the old backdrop.
+type Decontaminate struct{}
+
+// Apply implements PostProcessor
+func (Decontaminate) Apply(img *image.NRGBA, mask *image.Gray) error {
+	w, h := min(img.Rect.Dx(), mask.Rect.Dx()), min(img.Rect.Dy(), mask.Rect.Dy())
+	var sum [3]int64
+	var n int64
+	for y := range h {
+		row := img.Pix[y*img.Stride:][:w*4]
+		for x, m := range mask.Pix[y*mask.Stride:][:w] {
+			if m < decontaminateBackground {
+				sum[0] += int64(row[x*4])
+				sum[1] += int64(row[x*4+1])
+				sum[2] += int64(row[x*4+2])
+				n++
+			}
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+	var bg [3]float64
+	for c := range bg {
+		bg[c] = float64(sum[c]) / float64(n)
+	}
+
+	parallelRows(h, func(start, end int) {
+		for y := start; y < end; y++ {
+			row := img.Pix[y*img.Stride:][:w*4]
+			for x, m := range mask.Pix[y*mask.Stride:][:w] {
+				if m == 0 || m == 255 {
+					continue
+				}
+				a := float64(m) / 255
+				for c := range 3 {
+					v := (float64(row[x*4+c]) - (1-a)*bg[c]) / a
+					row[x*4+c] = uint8(min(max(v, 0), 255) + 0.5)
+				}
+			}
+		}
+	})
+	return nil
+}
+
+// KeepShadow keeps the soft shadow touching the subject in the mask, as
+// Config.Shadow does
+type KeepShadow struct {
+	// Options tunes the shadow detection (default: the ShadowOptions
+	// defaults)
+	Options *ShadowOptions
+}
+
+// Apply implements PostProcessor
+func (k KeepShadow) Apply(img *image.NRGBA, mask *image.Gray) error {
+	opts := k.Options
+	if opts == nil {
+		opts = &ShadowOptions{}
+	}
+	preserveShadow(mask, img, opts)
+	return nil
+}
+
+// postProcess runs the post-processors on an 8-bit copy of img and on mask,
+// which has the size of img, and returns the copy
+func (r *RemBG) postProcess(img image.Image, mask *image.Gray) (*image.NRGBA, error) {
+	src := toNRGBA(img)
+	// The mask is zero-based, so the copy is too while the steps run
+	b := src.Rect
+	src.Rect = image.Rect(0, 0, b.Dx(), b.Dy())
+	for i, p := range r.postProcessors {
+		if err := p.Apply(src, mask); err != nil {
+			return nil, fmt.Errorf("post-processor %d: %w", i, err)
+		}
+	}
+	src.Rect = b
+	return src, nil
+}
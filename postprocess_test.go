@@ -0,0 +1,90 @@
+package rmbg
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestFeather(t *testing.T) {
+	mask := image.NewGray(image.Rect(0, 0, 20, 20))
+	fillRect(mask, image.Rect(0, 0, 10, 20), 255)
+	if err := (Feather{Sigma: 2}).Apply(image.NewNRGBA(mask.Rect), mask); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if n := partial(mask, 10); n < 4 {
+		t.Errorf("expected a soft edge of at least 4 pixels, got %d", n)
+	}
+	if got := mask.GrayAt(0, 10).Y; got != 255 {
+		t.Errorf("expected the inside kept opaque, got %d", got)
+	}
+}
+
+func TestDecontaminate(t *testing.T) {
+	img := solidImage(10, 10, color.NRGBA{G: 255, A: 255})
+	mask := image.NewGray(img.Rect)
+	fillRect(mask, image.Rect(0, 0, 5, 10), 255)
+	for y := range 10 {
+		// Red mixed half and half with the green backdrop
+		img.SetNRGBA(5, y, color.NRGBA{R: 128, G: 128, A: 255})
+		for x := range 5 {
+			img.SetNRGBA(x, y, color.NRGBA{R: 255, A: 255})
+		}
+		mask.SetGray(5, y, color.Gray{Y: 128})
+	}
+	if err := (Decontaminate{}).Apply(img, mask); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if got := img.NRGBAAt(5, 3); got.R < 250 || got.G > 5 {
+		t.Errorf("expected the edge restored to red, got %v", got)
+	}
+	if got := img.NRGBAAt(8, 3); got != (color.NRGBA{G: 255, A: 255}) {
+		t.Errorf("expected the background untouched, got %v", got)
+	}
+}
+
+func TestPostProcessors(t *testing.T) {
+	src := solidImage(20, 10, color.NRGBA{R: 255, A: 255})
+	r := cachedEngine(src)
+	var calls []string
+	r.postProcessors = []PostProcessor{
+		PostProcessorFunc(func(img *image.NRGBA, mask *image.Gray) error {
+			calls = append(calls, "clear")
+			fillRect(mask, image.Rect(0, 0, 10, 10), 0)
+			return nil
+		}),
+		PostProcessorFunc(func(img *image.NRGBA, mask *image.Gray) error {
+			calls = append(calls, "tint")
+			img.SetNRGBA(15, 5, color.NRGBA{B: 255, A: 255})
+			return nil
+		}),
+	}
+
+	res, err := r.Process(src)
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if len(calls) != 2 || calls[0] != "clear" || calls[1] != "tint" {
+		t.Errorf("expected the steps to run in order, got %v", calls)
+	}
+	if got := res.Image.At(2, 5); !isWhite(got) {
+		t.Errorf("expected the cleared half on white, got %v", got)
+	}
+	if r, g, b, _ := res.Image.At(15, 5).RGBA(); r != 0 || g != 0 || b != 0xffff {
+		t.Errorf("expected the tinted pixel, got %d %d %d", r, g, b)
+	}
+	if got := src.NRGBAAt(15, 5); got != (color.NRGBA{R: 255, A: 255}) {
+		t.Errorf("expected the input unchanged, got %v", got)
+	}
+
+	t.Run("Error", func(t *testing.T) {
+		failure := errors.New("step failed")
+		r.postProcessors = []PostProcessor{PostProcessorFunc(func(*image.NRGBA, *image.Gray) error {
+			return failure
+		})}
+		if _, err := r.Process(src); !errors.Is(err, failure) {
+			t.Errorf("expected %v, got %v", failure, err)
+		}
+	})
+}
@@ -0,0 +1,286 @@
+package rmbg
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"runtime"
+	"sync"
+)
+
+// preprocessMinRows is the number of output rows below which preprocessing
+// runs on the calling goroutine, since spawning workers costs more than it saves
+const preprocessMinRows = 64
+
+// resampleWeights lists, for one output pixel, the first source index and the
+// normalized weights of the source pixels that contribute to it
+type resampleWeights struct {
+	start   int
+	weights []float32
+}
+
+// linearWeights computes triangle filter weights for resizing srcSize pixels to
+// dstSize, widening the filter when downscaling so every source pixel counts.
+// It matches imaging.Linear.
+func linearWeights(srcSize, dstSize int) []resampleWeights {
+	du := float64(srcSize) / float64(dstSize)
+	scale := max(du, 1)
+	ru := math.Ceil(scale)
+
+	out := make([]resampleWeights, dstSize)
+	// All weight slices share one backing array
+	backing := make([]float32, 0, dstSize*(2*int(ru)+1))
+	for v := range dstSize {
+		fu := (float64(v)+0.5)*du - 0.5
+		begin := max(0, int(math.Ceil(fu-ru)))
+		end := min(int(math.Floor(fu+ru)), srcSize-1)
+
+		var sum float64
+		weights := backing[len(backing):len(backing):cap(backing)]
+		for u := begin; u <= end; u++ {
+			w := max(0, 1-math.Abs((float64(u)-fu)/scale))
+			sum += w
+			weights = append(weights, float32(w))
+		}
+		if sum > 0 {
+			for i := range weights {
+				weights[i] = float32(float64(weights[i]) / sum)
+			}
+		}
+		backing = backing[:len(backing)+len(weights)]
+		out[v] = resampleWeights{start: begin, weights: weights}
+	}
+	return out
+}
+
+// rowBuffers holds the per-worker scratch rows of resizeNormalize
+type rowBuffers struct {
+	src  []float32
+	rows []float32
+}
+
+var rowBufferPool = sync.Pool{
+	New: func() any { return &rowBuffers{} },
+}
+
+// resizeNormalize resizes img to size x size and writes it to dst as planar CHW
+// floats normalized with mean and std, without allocating intermediate images.
+// Rows are split across CPUs.
+func resizeNormalize(dst []float32, img image.Image, size int, mean, std [3]float32) {
+	resizeNormalizeArea(dst, img, size, image.Rect(0, 0, size, size), mean, std)
+}
+
+// letterboxArea returns the largest rectangle of a size x size input with the
+// aspect ratio of an image of imgSize, centered
+func letterboxArea(imgSize image.Point, size int) image.Rectangle {
+	scale := float64(size) / float64(max(imgSize.X, imgSize.Y))
+	w := min(size, max(1, int(math.Round(float64(imgSize.X)*scale))))
+	h := min(size, max(1, int(math.Round(float64(imgSize.Y)*scale))))
+	x, y := (size-w)/2, (size-h)/2
+	return image.Rect(x, y, x+w, y+h)
+}
+
+// resizeNormalizeArea is resizeNormalize into the area of a size x size input,
+// which must lie within it. The rest of dst is set to 0, the mean color once
+// normalized.
+func resizeNormalizeArea(dst []float32, img image.Image, size int, area image.Rectangle, mean, std [3]float32) {
+	b := img.Bounds()
+	xw := linearWeights(b.Dx(), area.Dx())
+	yw := linearWeights(b.Dy(), area.Dy())
+	if area.Size() != image.Pt(size, size) {
+		clear(dst[:3*size*size])
+	}
+
+	// (v/255 - mean) / std == v*scale + bias
+	var scale, bias [3]float32
+	for c := range 3 {
+		scale[c] = 1 / (255 * std[c])
+		bias[c] = -mean[c] / std[c]
+	}
+
+	rows := area.Dy()
+	workers := min(runtime.NumCPU(), rows/preprocessMinRows)
+	if workers <= 1 {
+		resizeNormalizeRows(dst, img, size, area, 0, rows, xw, yw, scale, bias)
+		return
+	}
+
+	chunk := (rows + workers - 1) / workers
+	var wg sync.WaitGroup
+	for start := 0; start < rows; start += chunk {
+		end := min(start+chunk, rows)
+		wg.Go(func() {
+			resizeNormalizeRows(dst, img, size, area, start, end, xw, yw, scale, bias)
+		})
+	}
+	wg.Wait()
+}
+
+// resizeNormalizeRows produces rows [start, end) of area: every source row
+// they depend on is resampled horizontally once, then the rows are blended
+// vertically and normalized into dst.
+func resizeNormalizeRows(dst []float32, img image.Image, size int, area image.Rectangle, start, end int, xw, yw []resampleWeights, scale, bias [3]float32) {
+	b := img.Bounds()
+	w := b.Dx()
+
+	srcLo, srcHi := yw[start].start, 0
+	for y := start; y < end; y++ {
+		srcHi = max(srcHi, yw[y].start+len(yw[y].weights))
+	}
+	width := area.Dx()
+	rowLen := width * 3
+
+	bufs := rowBufferPool.Get().(*rowBuffers)
+	defer rowBufferPool.Put(bufs)
+	if cap(bufs.src) < w*3 {
+		bufs.src = make([]float32, w*3)
+	}
+	if n := (srcHi - srcLo) * rowLen; cap(bufs.rows) < n {
+		bufs.rows = make([]float32, n)
+	}
+	src, rows := bufs.src[:w*3], bufs.rows[:(srcHi-srcLo)*rowLen]
+
+	// Horizontal pass
+	for sy := srcLo; sy < srcHi; sy++ {
+		readRowRGB(src, img, b.Min.Y+sy)
+		row := rows[(sy-srcLo)*rowLen : (sy-srcLo+1)*rowLen]
+		for x := range width {
+			var sr, sg, sb float32
+			base := xw[x].start * 3
+			for i, wx := range xw[x].weights {
+				px := src[base+i*3 : base+i*3+3 : base+i*3+3]
+				sr += px[0] * wx
+				sg += px[1] * wx
+				sb += px[2] * wx
+			}
+			row[x*3+0], row[x*3+1], row[x*3+2] = sr, sg, sb
+		}
+	}
+
+	// Vertical pass and normalization
+	plane := size * size
+	for y := start; y < end; y++ {
+		off := (area.Min.Y+y)*size + area.Min.X
+		r := dst[0*plane+off : 0*plane+off+width]
+		g := dst[1*plane+off : 1*plane+off+width]
+		bl := dst[2*plane+off : 2*plane+off+width]
+		clear(r)
+		clear(g)
+		clear(bl)
+		for i, wy := range yw[y].weights {
+			off := (yw[y].start + i - srcLo) * rowLen
+			row := rows[off : off+rowLen]
+			for x := range r {
+				px := row[x*3 : x*3+3 : x*3+3]
+				r[x] += px[0] * wy
+				g[x] += px[1] * wy
+				bl[x] += px[2] * wy
+			}
+		}
+		for x := range r {
+			r[x] = r[x]*scale[0] + bias[0]
+			g[x] = g[x]*scale[1] + bias[1]
+			bl[x] = bl[x]*scale[2] + bias[2]
+		}
+	}
+}
+
+// readRowRGB writes row y of img as non-premultiplied RGB values in [0, 255]
+func readRowRGB(dst []float32, img image.Image, y int) {
+	b := img.Bounds()
+	w := b.Dx()
+
+	switch s := img.(type) {
+	case *image.NRGBA:
+		row := s.Pix[s.PixOffset(b.Min.X, y):][:w*4]
+		for x := range w {
+			dst[x*3+0] = float32(row[x*4+0])
+			dst[x*3+1] = float32(row[x*4+1])
+			dst[x*3+2] = float32(row[x*4+2])
+		}
+	case *image.RGBA:
+		row := s.Pix[s.PixOffset(b.Min.X, y):][:w*4]
+		for x := range w {
+			a := row[x*4+3]
+			if a == 255 || a == 0 {
+				dst[x*3+0] = float32(row[x*4+0])
+				dst[x*3+1] = float32(row[x*4+1])
+				dst[x*3+2] = float32(row[x*4+2])
+				continue
+			}
+			c := color.NRGBAModel.Convert(color.RGBA{R: row[x*4], G: row[x*4+1], B: row[x*4+2], A: a}).(color.NRGBA)
+			dst[x*3+0], dst[x*3+1], dst[x*3+2] = float32(c.R), float32(c.G), float32(c.B)
+		}
+	case *image.YCbCr:
+		var buf [ycbcrSpan * 4]uint8
+		for x0 := 0; x0 < w; x0 += ycbcrSpan {
+			n := min(ycbcrSpan, w-x0)
+			ycbcrRow(buf[:], s, b.Min.X+x0, y, n)
+			out := dst[x0*3:][:n*3]
+			for x := range n {
+				out[x*3+0] = float32(buf[x*4+0])
+				out[x*3+1] = float32(buf[x*4+1])
+				out[x*3+2] = float32(buf[x*4+2])
+			}
+		}
+	case *image.Gray:
+		row := s.Pix[s.PixOffset(b.Min.X, y):][:w]
+		for x, v := range row {
+			dst[x*3+0], dst[x*3+1], dst[x*3+2] = float32(v), float32(v), float32(v)
+		}
+	case *image.CMYK:
+		row := s.Pix[s.PixOffset(b.Min.X, y):][:w*4]
+		for x := range w {
+			r, g, bl := color.CMYKToRGB(row[x*4], row[x*4+1], row[x*4+2], row[x*4+3])
+			dst[x*3+0], dst[x*3+1], dst[x*3+2] = float32(r), float32(g), float32(bl)
+		}
+	default:
+		for x := range w {
+			c := color.NRGBAModel.Convert(img.At(b.Min.X+x, y)).(color.NRGBA)
+			dst[x*3+0], dst[x*3+1], dst[x*3+2] = float32(c.R), float32(c.G), float32(c.B)
+		}
+	}
+}
+
+// toNRGBA copies img to an *image.NRGBA with the same bounds. The gray,
+// YCbCr and CMYK images decoded from JPEG are converted row by row rather
+// than through color.Color.
+func toNRGBA(img image.Image) *image.NRGBA {
+	b := img.Bounds()
+	dst := image.NewNRGBA(b)
+	parallelRows(b.Dy(), func(start, end int) {
+		for y := start; y < end; y++ {
+			readRowNRGBA(dst.Pix[y*dst.Stride:][:b.Dx()*4], img, b.Min.Y+y)
+		}
+	})
+	return dst
+}
+
+// readRowNRGBA writes row y of img to dst as non-premultiplied RGBA
+func readRowNRGBA(dst []uint8, img image.Image, y int) {
+	b := img.Bounds()
+	w := b.Dx()
+
+	switch s := img.(type) {
+	case *image.NRGBA:
+		copy(dst, s.Pix[s.PixOffset(b.Min.X, y):][:w*4])
+	case *image.Gray:
+		row := s.Pix[s.PixOffset(b.Min.X, y):][:w]
+		for x, v := range row {
+			dst[x*4+0], dst[x*4+1], dst[x*4+2], dst[x*4+3] = v, v, v, 255
+		}
+	case *image.YCbCr:
+		ycbcrRow(dst, s, b.Min.X, y, w)
+	case *image.CMYK:
+		row := s.Pix[s.PixOffset(b.Min.X, y):][:w*4]
+		for x := range w {
+			r, g, bl := color.CMYKToRGB(row[x*4], row[x*4+1], row[x*4+2], row[x*4+3])
+			dst[x*4+0], dst[x*4+1], dst[x*4+2], dst[x*4+3] = r, g, bl, 255
+		}
+	default:
+		for x := range w {
+			c := color.NRGBAModel.Convert(img.At(b.Min.X+x, y)).(color.NRGBA)
+			dst[x*4+0], dst[x*4+1], dst[x*4+2], dst[x*4+3] = c.R, c.G, c.B, c.A
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package rmbg
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// referencePreprocess is the straightforward resize, clone and normalize path
+func referencePreprocess(img image.Image, size int) []float32 {
+	nrgba := imaging.Clone(imaging.Resize(img, size, size, imaging.Linear))
+	out := make([]float32, 3*size*size)
+	for y := range size {
+		for x := range size {
+			for c := range 3 {
+				v := nrgba.Pix[y*nrgba.Stride+x*4+c]
+				out[(c*size+y)*size+x] = (float32(v)/255.0 - mean[c]) / std[c]
+			}
+		}
+	}
+	return out
+}
+
+func TestResizeNormalize(t *testing.T) {
+	nrgba := image.NewNRGBA(image.Rect(10, 20, 730, 500))
+	for y := range 480 {
+		for x := range 720 {
+			nrgba.SetNRGBA(10+x, 20+y, color.NRGBA{R: uint8(x), G: uint8(y), B: uint8(x ^ y), A: 255})
+		}
+	}
+	ycbcr := image.NewYCbCr(image.Rect(0, 0, 100, 60), image.YCbCrSubsampleRatio420)
+	for i := range ycbcr.Y {
+		ycbcr.Y[i] = uint8(i * 7)
+	}
+	for i := range ycbcr.Cb {
+		ycbcr.Cb[i], ycbcr.Cr[i] = uint8(100+i%50), uint8(120+i%30)
+	}
+	gray := image.NewGray(image.Rect(0, 0, 64, 64))
+	for i := range gray.Pix {
+		gray.Pix[i] = uint8(i)
+	}
+	cmyk := image.NewCMYK(image.Rect(5, 5, 85, 45))
+	for i := range cmyk.Pix {
+		cmyk.Pix[i] = uint8(i * 13)
+	}
+
+	// Up to one gray level of difference from the intermediate 8-bit rounding
+	tolerance := 1.5 / 255 / 0.224
+	for name, img := range map[string]image.Image{"NRGBA": nrgba, "YCbCr": ycbcr, "Gray": gray, "CMYK": cmyk} {
+		t.Run(name, func(t *testing.T) {
+			for _, size := range []int{32, 320} {
+				want := referencePreprocess(img, size)
+				got := make([]float32, len(want))
+				resizeNormalize(got, img, size, mean, std)
+				for i := range want {
+					if d := math.Abs(float64(got[i] - want[i])); d > tolerance {
+						t.Fatalf("size %d at %d: expected %f, got %f", size, i, want[i], got[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestToNRGBA(t *testing.T) {
+	bounds := image.Rect(3, 5, 40, 26)
+	gray := image.NewGray(bounds)
+	for i := range gray.Pix {
+		gray.Pix[i] = uint8(i * 3)
+	}
+	cmyk := image.NewCMYK(bounds)
+	for i := range cmyk.Pix {
+		cmyk.Pix[i] = uint8(i * 7)
+	}
+	nrgba := image.NewNRGBA(bounds)
+	for i := range nrgba.Pix {
+		nrgba.Pix[i] = uint8(i * 5)
+	}
+	rgba := image.NewRGBA(bounds)
+	for i := range rgba.Pix {
+		rgba.Pix[i] = uint8(i * 5)
+		if i%4 == 3 {
+			rgba.Pix[i] = 200
+		}
+	}
+	images := map[string]image.Image{"Gray": gray, "CMYK": cmyk, "NRGBA": nrgba, "RGBA": rgba}
+	for _, ratio := range []image.YCbCrSubsampleRatio{image.YCbCrSubsampleRatio444, image.YCbCrSubsampleRatio420} {
+		ycbcr := image.NewYCbCr(bounds, ratio)
+		for i := range ycbcr.Y {
+			ycbcr.Y[i] = uint8(i * 3)
+		}
+		for i := range ycbcr.Cb {
+			ycbcr.Cb[i], ycbcr.Cr[i] = uint8(i*11), uint8(i*13)
+		}
+		images["YCbCr"+ratio.String()] = ycbcr
+	}
+
+	for name, img := range images {
+		t.Run(name, func(t *testing.T) {
+			got := toNRGBA(img)
+			if got.Bounds() != bounds {
+				t.Fatalf("expected bounds %v, got %v", bounds, got.Bounds())
+			}
+			for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+				for x := bounds.Min.X; x < bounds.Max.X; x++ {
+					want := color.NRGBAModel.Convert(img.At(x, y))
+					if c := got.NRGBAAt(x, y); c != want {
+						t.Fatalf("at %d,%d: expected %v, got %v", x, y, want, c)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestLinearWeights(t *testing.T) {
+	for _, sizes := range [][2]int{{1000, 320}, {100, 320}, {320, 320}} {
+		for i, w := range linearWeights(sizes[0], sizes[1]) {
+			var sum float32
+			for _, v := range w.weights {
+				sum += v
+			}
+			if math.Abs(float64(sum-1)) > 1e-5 {
+				t.Fatalf("%v at %d: expected weights to sum to 1, got %f", sizes, i, sum)
+			}
+			if w.start < 0 || w.start+len(w.weights) > sizes[0] {
+				t.Fatalf("%v at %d: weights out of range", sizes, i)
+			}
+		}
+	}
+}
+
+func BenchmarkPreprocess(b *testing.B) {
+	img := image.NewNRGBA(image.Rect(0, 0, 1920, 1080))
+	dst := make([]float32, 3*inputSize*inputSize)
+
+	b.Run("ResizeNormalize", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			resizeNormalize(dst, img, inputSize, mean, std)
+		}
+	})
+	b.Run("ResizeClone", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			referencePreprocess(img, inputSize)
+		}
+	})
+}
+
+func TestResizeNormalizeChunking(t *testing.T) {
+	// Output rows must not depend on how they are split across workers, so
+	// results are identical on every machine regardless of its CPU count
+	img := benchImage(image.Pt(333, 217))
+	xw, yw := linearWeights(333, inputSize), linearWeights(217, inputSize)
+	var scale, bias [3]float32
+	for c := range 3 {
+		scale[c], bias[c] = 1/(255*std[c]), -mean[c]/std[c]
+	}
+
+	square := image.Rect(0, 0, inputSize, inputSize)
+	whole := make([]float32, 3*inputSize*inputSize)
+	resizeNormalizeRows(whole, img, inputSize, square, 0, inputSize, xw, yw, scale, bias)
+
+	chunked := make([]float32, len(whole))
+	for start := 0; start < inputSize; start += 7 {
+		resizeNormalizeRows(chunked, img, inputSize, square, start, min(start+7, inputSize), xw, yw, scale, bias)
+	}
+	for i := range whole {
+		if whole[i] != chunked[i] {
+			t.Fatalf("expected identical output at %d, got %v and %v", i, whole[i], chunked[i])
+		}
+	}
+}
+
+func TestLetterbox(t *testing.T) {
+	tests := map[image.Point]image.Rectangle{
+		image.Pt(960, 320):  image.Rect(0, 106, 320, 213),
+		image.Pt(200, 800):  image.Rect(120, 0, 200, 320),
+		image.Pt(500, 500):  image.Rect(0, 0, 320, 320),
+		image.Pt(10000, 10): image.Rect(0, 159, 320, 160),
+	}
+	for size, want := range tests {
+		if got := letterboxArea(size, 320); got != want {
+			t.Errorf("expected %v for %v, got %v", want, size, got)
+		}
+	}
+
+	t.Run("Preprocess", func(t *testing.T) {
+		img := benchImage(image.Pt(96, 32))
+		const size = 48
+		area := letterboxArea(img.Bounds().Size(), size)
+		got := make([]float32, 3*size*size)
+		for i := range got {
+			got[i] = 42 // stale data from a pooled buffer
+		}
+		resizeNormalizeArea(got, img, size, area, mean, std)
+
+		// The same resize at the top left corner
+		inner := make([]float32, len(got))
+		resizeNormalizeArea(inner, img, size, area.Sub(area.Min), mean, std)
+		for c := range 3 {
+			for y := range size {
+				for x := range size {
+					v := got[(c*size+y)*size+x]
+					p := image.Pt(x, y)
+					if !p.In(area) {
+						if v != 0 {
+							t.Fatalf("expected padding 0 at %v, got %f", p, v)
+						}
+						continue
+					}
+					q := p.Sub(area.Min)
+					if w := inner[(c*size+q.Y)*size+q.X]; v != w {
+						t.Fatalf("expected %f at %v, got %f", w, p, v)
+					}
+				}
+			}
+		}
+	})
+
+	t.Run("Decode", func(t *testing.T) {
+		const size = 4
+		m := &model{spec: ModelSpec{Name: "test", InputSize: size, Output: OutputAlpha}, outputs: newFloatPool(size * size), letterbox: true}
+		area := m.inputArea(image.Pt(40, 20))
+		if area != image.Rect(0, 1, 4, 3) {
+			t.Fatalf("expected the middle rows, got %v", area)
+		}
+		output := m.outputs.get()
+		for i := range *output {
+			(*output)[i] = float32(i/size) / 3
+		}
+		mask := m.decode(output, area).mask
+		if got := mask.Bounds().Size(); got != area.Size() {
+			t.Fatalf("expected a %v mask, got %v", area.Size(), got)
+		}
+		if got := mask.GrayAt(0, 0).Y; got != 85 {
+			t.Errorf("expected row 1 of the output, got %d", got)
+		}
+		if got := mask.GrayAt(3, 1).Y; got != 170 {
+			t.Errorf("expected row 2 of the output, got %d", got)
+		}
+	})
+}
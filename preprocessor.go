@@ -0,0 +1,190 @@
+package rmbg
+
+import (
+	"fmt"
+	"image"
+	"slices"
+)
+
+// DefaultContrastClip is the default AutoContrast.Clip
+const DefaultContrastClip = 0.005
+
+// PreProcessor adjusts an image before the model sees it, e.g. to normalize
+// low-contrast or color-cast phone photos. Apply gets an 8-bit copy of the
+// image and changes it in place; outputs are still rendered from the
+// original.
+type PreProcessor interface {
+	Apply(img *image.NRGBA) error
+}
+
+// PreProcessorFunc adapts a function to the PreProcessor interface
+type PreProcessorFunc func(img *image.NRGBA) error
+
+// Apply calls f(img)
+func (f PreProcessorFunc) Apply(img *image.NRGBA) error {
+	return f(img)
+}
+
+// AutoContrast stretches each channel so that its darkest and brightest
+// values span the full range
+type AutoContrast struct {
+	// Clip is the fraction of pixels at each end of a channel that may
+	// saturate, so a few outliers do not limit the stretch (default:
+	// DefaultContrastClip)
+	Clip float64
+}
+
+// Apply implements PreProcessor
+func (a AutoContrast) Apply(img *image.NRGBA) error {
+	clip := a.Clip
+	if clip <= 0 || clip >= 0.5 {
+		clip = DefaultContrastClip
+	}
+	hist := channelHistograms(img)
+	n := img.Rect.Dx() * img.Rect.Dy()
+	skip := int(float64(n) * clip)
+
+	var lut [3][256]uint8
+	for c := range lut {
+		lo, hi := 0, 255
+		for count := 0; lo < 255; lo++ {
+			if count += hist[c][lo]; count > skip {
+				break
+			}
+		}
+		for count := 0; hi > 0; hi-- {
+			if count += hist[c][hi]; count > skip {
+				break
+			}
+		}
+		for v := range lut[c] {
+			if hi <= lo {
+				lut[c][v] = uint8(v)
+				continue
+			}
+			lut[c][v] = uint8(min(max((v-lo)*255/(hi-lo), 0), 255))
+		}
+	}
+	applyLUT(img, &lut)
+	return nil
+}
+
+// WhiteBalance removes a color cast by scaling the channels to the same mean,
+// assuming the scene averages to gray
+type WhiteBalance struct{}
+
+// Apply implements PreProcessor
+func (WhiteBalance) Apply(img *image.NRGBA) error {
+	hist := channelHistograms(img)
+	var mean [3]float64
+	for c := range mean {
+		var sum, n int
+		for v, count := range hist[c] {
+			sum += v * count
+			n += count
+		}
+		if n == 0 {
+			return nil
+		}
+		mean[c] = float64(sum) / float64(n)
+	}
+	gray := (mean[0] + mean[1] + mean[2]) / 3
+
+	var lut [3][256]uint8
+	for c := range lut {
+		if mean[c] == 0 {
+			for v := range lut[c] {
+				lut[c][v] = uint8(v)
+			}
+			continue
+		}
+		gain := gray / mean[c]
+		for v := range lut[c] {
+			lut[c][v] = uint8(min(float64(v)*gain+0.5, 255))
+		}
+	}
+	applyLUT(img, &lut)
+	return nil
+}
+
+// Denoise removes sensor noise with a median filter, which unlike a blur
+// keeps edges sharp
+type Denoise struct {
+	// Radius is the half size of the square window in pixels (default: 1,
+	// a 3x3 window)
+	Radius int
+}
+
+// Apply implements PreProcessor
+func (d Denoise) Apply(img *image.NRGBA) error {
+	radius := d.Radius
+	if radius <= 0 {
+		radius = 1
+	}
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	src := make([]uint8, len(img.Pix))
+	copy(src, img.Pix)
+	parallelRows(h, func(start, end int) {
+		window := make([]uint8, 0, (2*radius+1)*(2*radius+1))
+		for y := start; y < end; y++ {
+			row := img.Pix[y*img.Stride:][:w*4]
+			for x := range w {
+				for c := range 3 {
+					window = window[:0]
+					for yy := max(y-radius, 0); yy <= min(y+radius, h-1); yy++ {
+						srow := src[yy*img.Stride:]
+						for xx := max(x-radius, 0); xx <= min(x+radius, w-1); xx++ {
+							window = append(window, srow[xx*4+c])
+						}
+					}
+					slices.Sort(window)
+					row[x*4+c] = window[len(window)/2]
+				}
+			}
+		}
+	})
+	return nil
+}
+
+// channelHistograms counts the values of the red, green and blue channels of
+// img
+func channelHistograms(img *image.NRGBA) [3][256]int {
+	var hist [3][256]int
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	for y := range h {
+		row := img.Pix[y*img.Stride:][:w*4]
+		for i := 0; i < len(row); i += 4 {
+			hist[0][row[i]]++
+			hist[1][row[i+1]]++
+			hist[2][row[i+2]]++
+		}
+	}
+	return hist
+}
+
+// applyLUT maps the red, green and blue channels of img through lut
+func applyLUT(img *image.NRGBA, lut *[3][256]uint8) {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	parallelRows(h, func(start, end int) {
+		for y := start; y < end; y++ {
+			row := img.Pix[y*img.Stride:][:w*4]
+			for i := 0; i < len(row); i += 4 {
+				row[i] = lut[0][row[i]]
+				row[i+1] = lut[1][row[i+1]]
+				row[i+2] = lut[2][row[i+2]]
+			}
+		}
+	})
+}
+
+// preProcess runs the pre-processors on an 8-bit copy of img and returns the
+// copy
+func (r *RemBG) preProcess(img image.Image) (*image.NRGBA, error) {
+	src := toNRGBA(img)
+	for i, p := range r.preProcessors {
+		if err := p.Apply(src); err != nil {
+			return nil, fmt.Errorf("pre-processor %d: %w", i, err)
+		}
+	}
+	return src, nil
+}
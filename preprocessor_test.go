@@ -0,0 +1,104 @@
+package rmbg
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestAutoContrast(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 51, 4))
+	for y := range 4 {
+		for x := range 51 {
+			v := uint8(100 + x)
+			img.SetNRGBA(x, y, color.NRGBA{R: v, G: v, B: v, A: 255})
+		}
+	}
+	if err := (AutoContrast{}).Apply(img); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if got := img.NRGBAAt(0, 0).R; got != 0 {
+		t.Errorf("expected the darkest value stretched to 0, got %d", got)
+	}
+	if got := img.NRGBAAt(50, 0).R; got != 255 {
+		t.Errorf("expected the brightest value stretched to 255, got %d", got)
+	}
+
+	t.Run("Flat", func(t *testing.T) {
+		flat := solidImage(4, 4, color.NRGBA{R: 80, G: 80, B: 80, A: 255})
+		if err := (AutoContrast{}).Apply(flat); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+		if got := flat.NRGBAAt(1, 1).R; got != 80 {
+			t.Errorf("expected a flat image unchanged, got %d", got)
+		}
+	})
+}
+
+func TestWhiteBalance(t *testing.T) {
+	img := solidImage(8, 8, color.NRGBA{R: 100, G: 100, B: 160, A: 255})
+	if err := (WhiteBalance{}).Apply(img); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if got := img.NRGBAAt(6, 3); got.R != got.B || got.G != got.B {
+		t.Errorf("expected the cast removed, got %v", got)
+	}
+}
+
+func TestDenoise(t *testing.T) {
+	img := solidImage(10, 10, color.NRGBA{R: 50, G: 50, B: 50, A: 255})
+	for y := range 10 {
+		for x := 5; x < 10; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: 200, G: 200, B: 200, A: 255})
+		}
+	}
+	img.SetNRGBA(2, 2, color.NRGBA{R: 255, G: 255, B: 255, A: 255})
+	if err := (Denoise{}).Apply(img); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if got := img.NRGBAAt(2, 2).R; got != 50 {
+		t.Errorf("expected the speck removed, got %d", got)
+	}
+	if a, b := img.NRGBAAt(4, 5).R, img.NRGBAAt(5, 5).R; a != 50 || b != 200 {
+		t.Errorf("expected the edge kept, got %d and %d", a, b)
+	}
+}
+
+func TestPreProcessors(t *testing.T) {
+	var seen color.NRGBA
+	gray := PreProcessorFunc(func(img *image.NRGBA) error {
+		seen = img.NRGBAAt(0, 0)
+		for i := 0; i < len(img.Pix); i += 4 {
+			img.Pix[i], img.Pix[i+1], img.Pix[i+2] = 128, 128, 128
+		}
+		return nil
+	})
+	r, err := New(&Config{Backend: &squareBackend{}, PreProcessors: []PreProcessor{gray}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer r.Close()
+
+	src := solidImage(40, 40, color.NRGBA{R: 200, G: 10, B: 10, A: 255})
+	res, err := r.Process(src)
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if seen != (color.NRGBA{R: 200, G: 10, B: 10, A: 255}) {
+		t.Errorf("expected the pre-processor to see the input, got %v", seen)
+	}
+	if got := color.RGBAModel.Convert(res.Image.At(20, 20)).(color.RGBA); got != (color.RGBA{R: 200, G: 10, B: 10, A: 255}) {
+		t.Errorf("expected the output rendered from the original, got %v", got)
+	}
+
+	t.Run("Error", func(t *testing.T) {
+		failure := errors.New("step failed")
+		r.preProcessors = []PreProcessor{PreProcessorFunc(func(*image.NRGBA) error {
+			return failure
+		})}
+		if _, err := r.Process(src); !errors.Is(err, failure) {
+			t.Errorf("expected %v, got %v", failure, err)
+		}
+	})
+}
@@ -0,0 +1,205 @@
+package rmbg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// Preset bundles the output rules of a marketplace or catalog, so images can
+// be brought into compliance in one call
+type Preset struct {
+	// Name identifies the preset in reports
+	Name string
+	// Background fills the canvas around the object (default: transparent)
+	Background color.Color
+	// MinFill is the fraction of the canvas width or height the object must
+	// span along its larger relative dimension (0 keeps the object's margins)
+	MinFill float64
+	// AspectRatio is the width/height of the canvas (0 keeps the crop's)
+	AspectRatio float64
+	// MinSize is the smallest width and height of the output, which is
+	// upscaled to reach it (0 keeps the crop's size)
+	MinSize int
+}
+
+// PresetAmazonMainImage follows the rules for Amazon main product images: a
+// pure white background, the product filling at least 85% of a square frame,
+// at least 1000 pixels per side so zoom is enabled
+var PresetAmazonMainImage = Preset{
+	Name:        "amazon-main-image",
+	Background:  color.White,
+	MinFill:     0.85,
+	AspectRatio: 1,
+	MinSize:     1000,
+}
+
+// Preset rules reported in PresetViolation.Rule
+const (
+	RuleBackground  = "background"
+	RuleFill        = "fill"
+	RuleAspectRatio = "aspect_ratio"
+	RuleMinSize     = "min_size"
+)
+
+const (
+	// presetThreshold is the mask value from which a pixel belongs to the
+	// object when measuring it
+	presetThreshold = 128
+	// presetBackgroundMask is the mask value below which a pixel counts as
+	// background when checking its color
+	presetBackgroundMask = 16
+	// presetBackgroundShare is the fraction of background pixels that must
+	// already match Background for the source to pass RuleBackground
+	presetBackgroundShare = 0.98
+	// presetColorTolerance is how far, in 8-bit levels, a background pixel
+	// may be from Background
+	presetColorTolerance = 8
+	// presetAspectTolerance is the relative aspect ratio error accepted
+	presetAspectTolerance = 0.01
+)
+
+// PresetReport lists the rules of a preset the source image violated
+type PresetReport struct {
+	// Preset is the name of the preset
+	Preset string
+	// Violations is empty when the source already complied
+	Violations []PresetViolation
+}
+
+// OK reports whether the source complied with every rule
+func (r *PresetReport) OK() bool {
+	return len(r.Violations) == 0
+}
+
+// PresetViolation is a rule the source image did not follow
+type PresetViolation struct {
+	// Rule is one of the Rule constants
+	Rule string
+	// Message describes the violation with the measured value
+	Message string
+}
+
+// ApplyPreset removes the background of img and lays the object out as preset
+// requires: on its background, centered on a canvas of its aspect ratio that
+// the object fills to MinFill, scaled up to MinSize. The report lists the
+// rules img violated before processing.
+func (r *RemBG) ApplyPreset(img image.Image, preset *Preset) (image.Image, *PresetReport, error) {
+	if preset.MinFill < 0 || preset.MinFill > 1 {
+		return nil, nil, fmt.Errorf("preset fill %g must be in [0, 1]", preset.MinFill)
+	}
+	if preset.AspectRatio < 0 || preset.MinSize < 0 {
+		return nil, nil, fmt.Errorf("invalid preset aspect ratio %g or size %d", preset.AspectRatio, preset.MinSize)
+	}
+
+	res, pred, err := r.process(img)
+	if err != nil {
+		return nil, nil, err
+	}
+	b := img.Bounds()
+	info, err := MeasureObject(b, res.Mask, presetThreshold)
+	if err != nil {
+		return nil, nil, err
+	}
+	report := validatePreset(img, res.Mask, info, preset)
+
+	out, err := renderOutput(img, res, pred.mask, FormatPNG, &IOOptions{Background: preset.Background})
+	if err != nil {
+		return nil, nil, err
+	}
+	out = cropPadded(out, presetCanvas(info.BBox, preset), preset.Background)
+	if ob := out.Bounds(); preset.MinSize > 0 && min(ob.Dx(), ob.Dy()) < preset.MinSize {
+		scale := float64(preset.MinSize) / float64(min(ob.Dx(), ob.Dy()))
+		w := max(preset.MinSize, int(math.Round(float64(ob.Dx())*scale)))
+		h := max(preset.MinSize, int(math.Round(float64(ob.Dy())*scale)))
+		out = imaging.Resize(out, w, h, imaging.Lanczos)
+	}
+	return out, report, nil
+}
+
+// presetCanvas returns the canvas, in image coordinates, centered on object
+// with the aspect ratio of preset and the object filling MinFill of it
+func presetCanvas(object image.Rectangle, preset *Preset) image.Rectangle {
+	w, h := float64(object.Dx()), float64(object.Dy())
+	if preset.MinFill > 0 {
+		w, h = w/preset.MinFill, h/preset.MinFill
+	}
+	if a := preset.AspectRatio; a > 0 {
+		if w/h < a {
+			w = h * a
+		} else {
+			h = w / a
+		}
+	}
+	// Round down, so the object fills at least MinFill, forgiving the error of
+	// the division
+	cw, ch := max(1, int(w+1e-6)), max(1, int(h+1e-6))
+	c := object.Min.Add(object.Max).Div(2)
+	return image.Rect(c.X-cw/2, c.Y-ch/2, c.X-cw/2+cw, c.Y-ch/2+ch)
+}
+
+// validatePreset checks img, whose object has mask and geometry info, against
+// the rules of preset
+func validatePreset(img image.Image, mask *image.Gray, info *ObjectInfo, preset *Preset) *PresetReport {
+	report := &PresetReport{Preset: preset.Name, Violations: []PresetViolation{}}
+	violate := func(rule, format string, args ...any) {
+		report.Violations = append(report.Violations, PresetViolation{Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	b := img.Bounds()
+	if preset.Background != nil {
+		if share := backgroundShare(img, mask, preset.Background); share < presetBackgroundShare {
+			violate(RuleBackground, "%.0f%% of the background matches the required color, need %.0f%%",
+				share*100, presetBackgroundShare*100)
+		}
+	}
+	if preset.MinFill > 0 {
+		fill := math.Max(float64(info.BBox.Dx())/float64(b.Dx()), float64(info.BBox.Dy())/float64(b.Dy()))
+		if fill < preset.MinFill {
+			violate(RuleFill, "object fills %.0f%% of the frame, need %.0f%%", fill*100, preset.MinFill*100)
+		}
+	}
+	if a := preset.AspectRatio; a > 0 {
+		if got := float64(b.Dx()) / float64(b.Dy()); math.Abs(got-a) > a*presetAspectTolerance {
+			violate(RuleAspectRatio, "aspect ratio %.3f, need %.3f", got, a)
+		}
+	}
+	if preset.MinSize > 0 && min(b.Dx(), b.Dy()) < preset.MinSize {
+		violate(RuleMinSize, "%dx%d pixels, need at least %d per side", b.Dx(), b.Dy(), preset.MinSize)
+	}
+	return report
+}
+
+// backgroundShare returns the fraction of the background pixels of img, where
+// mask is below presetBackgroundMask, within presetColorTolerance of bg. An
+// image without background has a share of 1.
+func backgroundShare(img image.Image, mask *image.Gray, bg color.Color) float64 {
+	want := color.NRGBAModel.Convert(bg).(color.NRGBA)
+	near := func(a, b uint8) bool {
+		return max(a, b)-min(a, b) <= presetColorTolerance
+	}
+	src := toNRGBA(img)
+	b := src.Bounds()
+	var total, match int
+	for y := range b.Dy() {
+		row := src.Pix[y*src.Stride:][:b.Dx()*4]
+		mrow := mask.Pix[y*mask.Stride:][:b.Dx()]
+		for x, m := range mrow {
+			if m >= presetBackgroundMask {
+				continue
+			}
+			total++
+			p := row[x*4 : x*4+4]
+			if near(p[0], want.R) && near(p[1], want.G) && near(p[2], want.B) && near(p[3], want.A) {
+				match++
+			}
+		}
+	}
+	if total == 0 {
+		return 1
+	}
+	return float64(match) / float64(total)
+}
@@ -0,0 +1,98 @@
+package rmbg
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"slices"
+	"testing"
+)
+
+// presetRules returns the rules of the violations in report
+func presetRules(report *PresetReport) []string {
+	var rules []string
+	for _, v := range report.Violations {
+		rules = append(rules, v.Rule)
+	}
+	return rules
+}
+
+func TestPresetCanvas(t *testing.T) {
+	tests := []struct {
+		name   string
+		object image.Rectangle
+		preset Preset
+		want   image.Rectangle
+	}{
+		{"Fill", image.Rect(0, 0, 85, 85), Preset{MinFill: 0.85}, image.Rect(-8, -8, 92, 92)},
+		{"Square", image.Rect(0, 0, 170, 85), PresetAmazonMainImage, image.Rect(-15, -58, 185, 142)},
+		{"Tight", image.Rect(10, 10, 50, 30), Preset{}, image.Rect(10, 10, 50, 30)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := presetCanvas(tt.object, &tt.preset); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestValidatePreset(t *testing.T) {
+	// A 20x20 object in the middle of a 100x100 frame
+	object := image.Rect(40, 40, 60, 60)
+	mask := image.NewGray(image.Rect(0, 0, 100, 100))
+	fillRect(mask, object, 255)
+	info, err := MeasureObject(mask.Bounds(), mask, presetThreshold)
+	if err != nil {
+		t.Fatalf("MeasureObject failed: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		bg   color.NRGBA
+		want []string
+	}{
+		{"WhiteBackground", color.NRGBA{R: 255, G: 255, B: 255, A: 255}, []string{RuleFill, RuleMinSize}},
+		{"NearWhite", color.NRGBA{R: 250, G: 252, B: 255, A: 255}, []string{RuleFill, RuleMinSize}},
+		{"GrayBackground", color.NRGBA{R: 200, G: 200, B: 200, A: 255}, []string{RuleBackground, RuleFill, RuleMinSize}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := solidImage(100, 100, tt.bg)
+			draw.Draw(img, object, image.NewUniform(color.NRGBA{R: 255, A: 255}), image.Point{}, draw.Src)
+			report := validatePreset(img, mask, info, &PresetAmazonMainImage)
+			if got := presetRules(report); !slices.Equal(got, tt.want) {
+				t.Errorf("expected violations %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestApplyPreset(t *testing.T) {
+	red := solidImage(200, 100, color.NRGBA{R: 255, A: 255})
+	r := cachedEngine(red)
+
+	out, report, err := r.ApplyPreset(red, &PresetAmazonMainImage)
+	if err != nil {
+		t.Fatalf("ApplyPreset failed: %v", err)
+	}
+	if got := out.Bounds().Size(); got != image.Pt(1000, 1000) {
+		t.Errorf("expected 1000x1000, got %v", got)
+	}
+	if _, _, _, a := out.At(500, 500).RGBA(); a != 0xffff {
+		t.Errorf("expected an opaque object, got alpha %d", a)
+	}
+	if got := color.NRGBAModel.Convert(out.At(0, 0)).(color.NRGBA); got != (color.NRGBA{R: 255, G: 255, B: 255, A: 255}) {
+		t.Errorf("expected a white corner, got %v", got)
+	}
+	if want := []string{RuleAspectRatio, RuleMinSize}; !slices.Equal(presetRules(report), want) {
+		t.Errorf("expected violations %v, got %v", want, presetRules(report))
+	}
+	if report.OK() || report.Preset != PresetAmazonMainImage.Name {
+		t.Errorf("expected a failed %s report, got %+v", PresetAmazonMainImage.Name, report)
+	}
+
+	if _, _, err := r.ApplyPreset(red, &Preset{MinFill: 2}); err == nil {
+		t.Errorf("expected error for a fill above 1")
+	}
+}
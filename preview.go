@@ -0,0 +1,13 @@
+package rmbg
+
+import "image"
+
+// RenderPreview composites a transparent output, such as a cut-out decoded
+// from PNG, over the gray checkerboard design tools draw behind transparency,
+// so previews show what is transparent instead of flattening it to black or
+// white. To preview a Result, use ReplaceBackground with its Mask and a
+// Checkerboard.
+func RenderPreview(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	return flattenOver(img, Checkerboard{}.Render(b.Dx(), b.Dy()))
+}
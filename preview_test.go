@@ -0,0 +1,34 @@
+package rmbg
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestRenderPreview(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(5, 5, 25, 25))
+	for y := 5; y < 25; y++ {
+		img.SetNRGBA(5, y, color.NRGBA{R: 255, A: 255})
+		img.SetNRGBA(6, y, color.NRGBA{R: 255, A: 128})
+	}
+
+	out := RenderPreview(img)
+	if got := out.Bounds(); got != img.Rect {
+		t.Errorf("expected %v, got %v", img.Rect, got)
+	}
+	at := func(x, y int) color.NRGBA { return color.NRGBAModel.Convert(out.At(x, y)).(color.NRGBA) }
+	if c := at(5, 5); c != (color.NRGBA{R: 255, A: 255}) {
+		t.Errorf("expected the opaque pixel, got %v", c)
+	}
+	if c := at(6, 5); c.A != 255 || c.R != 255 || c.G < 100 || c.G > 155 {
+		t.Errorf("expected pink over the light square, got %v", c)
+	}
+	// The pattern starts at the origin of the image
+	if c := at(10, 5); c != DefaultCheckerLight {
+		t.Errorf("expected %v, got %v", DefaultCheckerLight, c)
+	}
+	if c := at(5+DefaultCheckerSize, 5); c != DefaultCheckerDark {
+		t.Errorf("expected %v, got %v", DefaultCheckerDark, c)
+	}
+}
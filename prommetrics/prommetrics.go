@@ -0,0 +1,184 @@
+// Package prommetrics exports rmbg engine metrics in the Prometheus text
+// exposition format, without depending on the Prometheus client library.
+//
+//	collector := prommetrics.New("")
+//	engine, err := rmbg.New(&rmbg.Config{ModelPath: path, Metrics: collector})
+//	http.Handle("/metrics", collector)
+package prommetrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultNamespace prefixes metric names when New is given none
+const DefaultNamespace = "rmbg"
+
+var (
+	// LatencyBuckets are the upper bounds, in seconds, of the stage latency
+	// histogram
+	LatencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	// ImageSizeBuckets are the upper bounds, in pixels, of the image size
+	// histogram: from thumbnails to 50 megapixels
+	ImageSizeBuckets = []float64{1e5, 3e5, 1e6, 2e6, 5e6, 1.2e7, 2.5e7, 5e7}
+)
+
+// Collector implements rmbg.MetricsCollector and serves the collected metrics
+// over HTTP. It is safe for concurrent use.
+type Collector struct {
+	namespace string
+
+	mu        sync.Mutex
+	latencies map[string]*histogram
+	errors    map[string]uint64
+	sizes     *histogram
+}
+
+// New creates a collector whose metric names start with namespace (default:
+// DefaultNamespace)
+func New(namespace string) *Collector {
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	return &Collector{
+		namespace: namespace,
+		latencies: make(map[string]*histogram),
+		errors:    make(map[string]uint64),
+		sizes:     newHistogram(ImageSizeBuckets),
+	}
+}
+
+// ObserveLatency records the duration of a stage
+func (c *Collector) ObserveLatency(stage string, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h, ok := c.latencies[stage]
+	if !ok {
+		h = newHistogram(LatencyBuckets)
+		c.latencies[stage] = h
+	}
+	h.observe(d.Seconds())
+}
+
+// IncErrors counts an error of the given kind
+func (c *Collector) IncErrors(kind string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.errors[kind]++
+}
+
+// ObserveImageSize records the pixel count of an image
+func (c *Collector) ObserveImageSize(pixels int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sizes.observe(float64(pixels))
+}
+
+// ServeHTTP writes the metrics in the text exposition format
+func (c *Collector) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = c.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the text exposition format to w
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+
+	name := c.namespace + "_stage_duration_seconds"
+	fmt.Fprintf(bw, "# HELP %s Duration of each processing stage.\n# TYPE %s histogram\n", name, name)
+	for _, stage := range sortedKeys(c.latencies) {
+		c.latencies[stage].write(bw, name, `stage="`+escapeLabel(stage)+`"`)
+	}
+
+	name = c.namespace + "_errors_total"
+	fmt.Fprintf(bw, "# HELP %s Failed calls by kind.\n# TYPE %s counter\n", name, name)
+	for _, kind := range sortedKeys(c.errors) {
+		fmt.Fprintf(bw, "%s{kind=\"%s\"} %d\n", name, escapeLabel(kind), c.errors[kind])
+	}
+
+	name = c.namespace + "_image_pixels"
+	fmt.Fprintf(bw, "# HELP %s Pixel count of segmented images.\n# TYPE %s histogram\n", name, name)
+	c.sizes.write(bw, name, "")
+
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// histogram counts observations in cumulative buckets
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(v float64) {
+	// counts are per bucket; write accumulates them
+	if i, _ := slices.BinarySearch(h.bounds, v); i < len(h.bounds) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+func (h *histogram) write(w io.Writer, name, labels string) {
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{%s%sle=\"%s\"} %d\n", name, labels, sep, formatFloat(bound), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, h.count)
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels, h.count)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// escapeLabel escapes a label value as the exposition format requires
+func escapeLabel(v string) string {
+	q := strconv.Quote(v)
+	return q[1 : len(q)-1]
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,63 @@
+package prommetrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josuedeavila/rmbg"
+)
+
+var _ rmbg.MetricsCollector = (*Collector)(nil)
+
+func TestCollector(t *testing.T) {
+	c := New("")
+	c.ObserveLatency(rmbg.StageInference, 30*time.Millisecond)
+	c.ObserveLatency(rmbg.StageInference, 2*time.Second)
+	c.ObserveLatency(rmbg.StageBlend, time.Millisecond)
+	c.IncErrors(rmbg.ErrorKindInference)
+	c.IncErrors(rmbg.ErrorKindInference)
+	c.IncErrors(`odd"kind`)
+	c.ObserveImageSize(640 * 480)
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("expected text/plain content type, got %q", ct)
+	}
+
+	body := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE rmbg_stage_duration_seconds histogram",
+		`rmbg_stage_duration_seconds_bucket{stage="inference",le="0.025"} 0`,
+		`rmbg_stage_duration_seconds_bucket{stage="inference",le="0.05"} 1`,
+		`rmbg_stage_duration_seconds_bucket{stage="inference",le="+Inf"} 2`,
+		`rmbg_stage_duration_seconds_count{stage="inference"} 2`,
+		`rmbg_stage_duration_seconds_bucket{stage="blend",le="0.001"} 1`,
+		`rmbg_errors_total{kind="inference"} 2`,
+		`rmbg_errors_total{kind="odd\"kind"} 1`,
+		`rmbg_image_pixels_bucket{le="300000"} 0`,
+		`rmbg_image_pixels_bucket{le="1e+06"} 1`,
+		`rmbg_image_pixels_sum 307200`,
+		`rmbg_image_pixels_count 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expected line %q in:\n%s", line, body)
+		}
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	var b strings.Builder
+	n, err := New("svc").WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	if int(n) != b.Len() {
+		t.Errorf("expected %d bytes written, got %d", b.Len(), n)
+	}
+	if !strings.Contains(b.String(), "svc_image_pixels_count 0\n") {
+		t.Errorf("expected namespaced metrics, got:\n%s", b.String())
+	}
+}
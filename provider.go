@@ -0,0 +1,43 @@
+package rmbg
+
+import (
+	"fmt"
+)
+
+// Provider selects the ONNX Runtime execution provider that runs the model.
+// Providers other than ProviderCPU need an ONNX Runtime build that includes
+// them.
+type Provider int
+
+const (
+	// ProviderCPU runs on the default CPU provider
+	ProviderCPU Provider = iota
+	// ProviderCUDA runs on an NVIDIA GPU
+	ProviderCUDA
+	// ProviderTensorRT runs on an NVIDIA GPU through TensorRT
+	ProviderTensorRT
+	// ProviderCoreML runs on the Apple Neural Engine or GPU
+	ProviderCoreML
+	// ProviderDirectML runs on a DirectX 12 GPU on Windows
+	ProviderDirectML
+	// ProviderOpenVINO runs on Intel CPUs, GPUs and NPUs
+	ProviderOpenVINO
+)
+
+func (p Provider) String() string {
+	switch p {
+	case ProviderCPU:
+		return "cpu"
+	case ProviderCUDA:
+		return "cuda"
+	case ProviderTensorRT:
+		return "tensorrt"
+	case ProviderCoreML:
+		return "coreml"
+	case ProviderDirectML:
+		return "directml"
+	case ProviderOpenVINO:
+		return "openvino"
+	}
+	return fmt.Sprintf("Provider(%d)", int(p))
+}
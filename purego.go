@@ -0,0 +1,13 @@
+//go:build purego
+
+package rmbg
+
+import "github.com/josuedeavila/rmbg/onnxgo"
+
+// Builds with the purego tag run models on the onnxgo interpreter when ONNX
+// Runtime cannot be loaded, including builds without cgo
+func init() {
+	fallbackBackend = func(modelPath string) (Backend, error) {
+		return onnxgo.Load(modelPath)
+	}
+}
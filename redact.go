@@ -0,0 +1,134 @@
+package rmbg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/disintegration/imaging"
+)
+
+// RedactMode selects how Redact hides masked regions
+type RedactMode int
+
+const (
+	// RedactBlur blurs masked regions
+	RedactBlur RedactMode = iota
+	// RedactPixelate replaces masked regions by large blocks of their mean
+	// color
+	RedactPixelate
+	// RedactFill paints masked regions with a solid color
+	RedactFill
+)
+
+func (m RedactMode) String() string {
+	switch m {
+	case RedactBlur:
+		return "blur"
+	case RedactPixelate:
+		return "pixelate"
+	case RedactFill:
+		return "fill"
+	}
+	return fmt.Sprintf("RedactMode(%d)", int(m))
+}
+
+// RedactStyle configures Redact
+type RedactStyle struct {
+	// Mode is how masked regions are hidden (default: RedactBlur)
+	Mode RedactMode
+	// Size is the pixelation block size, or twice the blur sigma, in pixels
+	// (default: 1/40 of the longer side of the image, at least 8)
+	Size int
+	// Color fills masked regions with RedactFill (default: black)
+	Color color.Color
+}
+
+// Redact returns img with the regions of mask blurred, pixelated or filled,
+// e.g. faces or license plates found by a segmentation model, for privacy
+// instead of background removal. Mask values blend the hidden and original
+// pixels, so soft edges stay soft; the mask may have any resolution.
+func Redact(img image.Image, mask *image.Gray, style *RedactStyle) (*image.NRGBA, error) {
+	var s RedactStyle
+	if style != nil {
+		s = *style
+	}
+	if mask == nil || mask.Bounds().Empty() {
+		return nil, fmt.Errorf("mask image is nil or empty")
+	}
+	if s.Size < 0 {
+		return nil, fmt.Errorf("%w: redaction size %d is negative", ErrInvalidSize, s.Size)
+	}
+	b := img.Bounds()
+	if s.Size == 0 {
+		s.Size = max(8, max(b.Dx(), b.Dy())/40)
+	}
+
+	dst := toNRGBA(img)
+	var hidden image.Image
+	switch s.Mode {
+	case RedactBlur:
+		hidden = imaging.Blur(dst, float64(s.Size)/2)
+	case RedactPixelate:
+		hidden = pixelate(dst, s.Size)
+	case RedactFill:
+		c := s.Color
+		if c == nil {
+			c = color.Black
+		}
+		hidden = image.NewUniform(c)
+	default:
+		return nil, fmt.Errorf("unknown redact mode %v", s.Mode)
+	}
+
+	mask = fitMask(mask, b.Dx(), b.Dy())
+	// Gray has no alpha channel, so view its pixels as one
+	alpha := &image.Alpha{Pix: mask.Pix, Stride: mask.Stride, Rect: mask.Rect}
+	draw.DrawMask(dst, b, hidden, image.Point{}, alpha, mask.Rect.Min, draw.Over)
+	return dst, nil
+}
+
+// pixelate returns img, zero-based, with each block x block square replaced
+// by its mean color
+func pixelate(img *image.NRGBA, block int) *image.NRGBA {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	rows := (h + block - 1) / block
+	parallelRows(rows, func(start, end int) {
+		for by := start; by < end; by++ {
+			y0, y1 := by*block, min((by+1)*block, h)
+			for x0 := 0; x0 < w; x0 += block {
+				x1 := min(x0+block, w)
+				// Average premultiplied colors, so transparent pixels do not
+				// darken the block
+				var sum [4]int
+				for y := y0; y < y1; y++ {
+					row := img.Pix[y*img.Stride+x0*4:][:(x1-x0)*4]
+					for i := 0; i < len(row); i += 4 {
+						a := int(row[i+3])
+						sum[0] += int(row[i]) * a
+						sum[1] += int(row[i+1]) * a
+						sum[2] += int(row[i+2]) * a
+						sum[3] += a
+					}
+				}
+				var c [4]uint8
+				if sum[3] > 0 {
+					for i := range 3 {
+						c[i] = uint8((sum[i] + sum[3]/2) / sum[3])
+					}
+					n := (x1 - x0) * (y1 - y0)
+					c[3] = uint8((sum[3] + n/2) / n)
+				}
+				for y := y0; y < y1; y++ {
+					row := dst.Pix[y*dst.Stride+x0*4:][:(x1-x0)*4]
+					for i := 0; i < len(row); i += 4 {
+						copy(row[i:i+4], c[:])
+					}
+				}
+			}
+		}
+	})
+	return dst
+}
@@ -0,0 +1,104 @@
+package rmbg
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	// Vertical stripes, two pixels wide
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for y := range 64 {
+		for x := range 64 {
+			v := uint8(255 * (x / 2 % 2))
+			img.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+	}
+	mask := image.NewGray(img.Rect)
+	fillRect(mask, image.Rect(16, 16, 48, 48), 255)
+	unchanged := func(t *testing.T, out *image.NRGBA) {
+		t.Helper()
+		for _, p := range []image.Point{{2, 2}, {3, 60}, {60, 30}} {
+			if out.NRGBAAt(p.X, p.Y) != img.NRGBAAt(p.X, p.Y) {
+				t.Errorf("expected (%d,%d) unchanged, got %v", p.X, p.Y, out.NRGBAAt(p.X, p.Y))
+			}
+		}
+	}
+
+	t.Run("Blur", func(t *testing.T) {
+		out, err := Redact(img, mask, nil)
+		if err != nil {
+			t.Fatalf("Redact failed: %v", err)
+		}
+		unchanged(t, out)
+		for x := 28; x < 36; x++ {
+			if v := out.NRGBAAt(x, 32).R; v < 64 || v > 192 {
+				t.Errorf("expected stripes blurred to gray at x=%d, got %d", x, v)
+			}
+		}
+	})
+
+	t.Run("Pixelate", func(t *testing.T) {
+		out, err := Redact(img, mask, &RedactStyle{Mode: RedactPixelate, Size: 16})
+		if err != nil {
+			t.Fatalf("Redact failed: %v", err)
+		}
+		unchanged(t, out)
+		want := out.NRGBAAt(16, 16)
+		for y := 16; y < 32; y++ {
+			for x := 16; x < 32; x++ {
+				if c := out.NRGBAAt(x, y); c != want {
+					t.Fatalf("expected a uniform block, got %v and %v", want, c)
+				}
+			}
+		}
+		if want.R < 120 || want.R > 136 {
+			t.Errorf("expected the mean gray, got %v", want)
+		}
+	})
+
+	t.Run("Fill", func(t *testing.T) {
+		red := color.NRGBA{R: 255, A: 255}
+		soft := image.NewGray(img.Rect)
+		fillRect(soft, image.Rect(16, 16, 48, 48), 255)
+		fillRect(soft, image.Rect(16, 16, 48, 20), 128)
+		out, err := Redact(img, soft, &RedactStyle{Mode: RedactFill, Color: red})
+		if err != nil {
+			t.Fatalf("Redact failed: %v", err)
+		}
+		unchanged(t, out)
+		if c := out.NRGBAAt(30, 30); c != red {
+			t.Errorf("expected red, got %v", c)
+		}
+		// Half red over a white stripe
+		if c := out.NRGBAAt(30, 17); c.R != 255 || c.G < 120 || c.G > 135 {
+			t.Errorf("expected a half blend at the soft edge, got %v", c)
+		}
+	})
+
+	t.Run("LowResolutionMask", func(t *testing.T) {
+		small := image.NewGray(image.Rect(0, 0, 8, 8))
+		fillRect(small, image.Rect(2, 2, 6, 6), 255)
+		out, err := Redact(img, small, &RedactStyle{Mode: RedactFill})
+		if err != nil {
+			t.Fatalf("Redact failed: %v", err)
+		}
+		unchanged(t, out)
+		if c := out.NRGBAAt(32, 32); c != (color.NRGBA{A: 255}) {
+			t.Errorf("expected black, got %v", c)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		if _, err := Redact(img, mask, &RedactStyle{Mode: RedactMode(7)}); err == nil {
+			t.Error("expected error for unknown mode")
+		}
+		if _, err := Redact(img, mask, &RedactStyle{Size: -1}); err == nil {
+			t.Error("expected error for negative size")
+		}
+		if _, err := Redact(img, nil, nil); err == nil {
+			t.Error("expected error for nil mask")
+		}
+	})
+}
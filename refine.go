@@ -0,0 +1,136 @@
+package rmbg
+
+import (
+	"fmt"
+	"image"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/disintegration/imaging"
+)
+
+const (
+	// refineMargin expands the boundary band by this fraction of its size so the
+	// model sees context around the edges
+	refineMargin = 0.1
+	// refineMaxArea skips refinement when the band covers more than this fraction
+	// of the image, since the zoomed pass would add little resolution
+	refineMaxArea = 0.64
+	// refineFeather is the width of the seam between the coarse and refined masks
+	// as a fraction of the refined region size
+	refineFeather = 0.05
+)
+
+// refinePrediction re-runs the model on a zoomed crop around the boundary of
+// the coarse mask and merges the result. The merged mask has the pixel density
+// of the zoomed pass, so it is larger than the coarse one.
+func (r *RemBG) refinePrediction(m *model, img image.Image, coarse *prediction) (*prediction, error) {
+	band, ok := boundaryBounds(coarse.mask, 128)
+	if !ok {
+		r.log(slog.LevelDebug, "refinement skipped", slog.String("reason", "no boundary"))
+		return coarse, nil
+	}
+
+	b := img.Bounds()
+	mb := coarse.mask.Bounds()
+	sx := float64(b.Dx()) / float64(mb.Dx())
+	sy := float64(b.Dy()) / float64(mb.Dy())
+	mx := float64(band.Dx()) * sx * refineMargin
+	my := float64(band.Dy()) * sy * refineMargin
+	region := image.Rect(
+		int(float64(band.Min.X-mb.Min.X)*sx-mx), int(float64(band.Min.Y-mb.Min.Y)*sy-my),
+		int(math.Ceil(float64(band.Max.X-mb.Min.X)*sx+mx)), int(math.Ceil(float64(band.Max.Y-mb.Min.Y)*sy+my)),
+	).Intersect(image.Rect(0, 0, b.Dx(), b.Dy()))
+	if region.Empty() || float64(region.Dx()*region.Dy()) > refineMaxArea*float64(b.Dx()*b.Dy()) {
+		r.log(slog.LevelDebug, "refinement skipped",
+			slog.String("reason", "boundary covers most of the image"),
+			slog.Float64("area", float64(region.Dx()*region.Dy())/float64(b.Dx()*b.Dy())),
+		)
+		return coarse, nil
+	}
+	r.log(slog.LevelDebug, "refining boundary", slog.Any("region", region))
+
+	fine, err := m.predict(imaging.Crop(img, region.Add(b.Min)))
+	if err != nil {
+		return nil, fmt.Errorf("refinement pass failed: %w", err)
+	}
+
+	mergeStart := time.Now()
+	mask := mergeRefined(coarse.mask, fine.mask, b.Size(), region)
+	timing := coarse.timing.add(fine.timing)
+	timing.decode += time.Since(mergeStart)
+	return &prediction{
+		mask:       mask,
+		confidence: fine.confidence,
+		timing:     timing,
+		model:      m.spec.Name,
+	}, nil
+}
+
+// mergeRefined combines a coarse mask of the whole image with a fine mask of
+// region, feathering the seam. The result has the density of the fine mask,
+// capped at the image resolution.
+func mergeRefined(coarse, fine *image.Gray, size image.Point, region image.Rectangle) *image.Gray {
+	cb, fb := coarse.Bounds(), fine.Bounds()
+	w := max(cb.Dx(), min(size.X, int(math.Round(float64(size.X)*float64(fb.Dx())/float64(region.Dx())))))
+	h := max(cb.Dy(), min(size.Y, int(math.Round(float64(size.Y)*float64(fb.Dy())/float64(region.Dy())))))
+	out := image.NewGray(image.Rect(0, 0, w, h))
+
+	// Scale factors from output pixels to image pixels
+	ox := float64(size.X) / float64(w)
+	oy := float64(size.Y) / float64(h)
+	featherX := max(1, float64(region.Dx())*refineFeather)
+	featherY := max(1, float64(region.Dy())*refineFeather)
+
+	for y := range h {
+		iy := (float64(y) + 0.5) * oy
+		row := out.Pix[y*out.Stride:]
+		for x := range w {
+			ix := (float64(x) + 0.5) * ox
+			v := sampleGray(coarse,
+				ix*float64(cb.Dx())/float64(size.X)-0.5,
+				iy*float64(cb.Dy())/float64(size.Y)-0.5)
+
+			lx, ly := ix-float64(region.Min.X), iy-float64(region.Min.Y)
+			if lx >= 0 && ly >= 0 && lx < float64(region.Dx()) && ly < float64(region.Dy()) {
+				fv := sampleGray(fine,
+					lx*float64(fb.Dx())/float64(region.Dx())-0.5,
+					ly*float64(fb.Dy())/float64(region.Dy())-0.5)
+				// Seams on the image border need no feathering
+				wx := edgeWeight(int(lx), region.Dx(), featherX, region.Min.X > 0, region.Max.X < size.X)
+				wy := edgeWeight(int(ly), region.Dy(), featherY, region.Min.Y > 0, region.Max.Y < size.Y)
+				weight := max(0, min(1, wx*wy))
+				v = weight*fv + (1-weight)*v
+			}
+			row[x] = uint8(math.Round(v))
+		}
+	}
+	return out
+}
+
+// boundaryBounds returns the bounding box of mask pixels on the edge between
+// foreground and background
+func boundaryBounds(mask *image.Gray, threshold uint8) (image.Rectangle, bool) {
+	b := mask.Bounds()
+	w, h := b.Dx(), b.Dy()
+	fg := func(x, y int) bool { return mask.Pix[y*mask.Stride+x] >= threshold }
+
+	minX, minY, maxX, maxY := w, h, -1, -1
+	for y := range h {
+		for x := range w {
+			v := fg(x, y)
+			edge := (x > 0 && fg(x-1, y) != v) || (x < w-1 && fg(x+1, y) != v) ||
+				(y > 0 && fg(x, y-1) != v) || (y < h-1 && fg(x, y+1) != v)
+			if !edge {
+				continue
+			}
+			minX, maxX = min(minX, x), max(maxX, x)
+			minY, maxY = min(minY, y), max(maxY, y)
+		}
+	}
+	if maxX < 0 {
+		return image.Rectangle{}, false
+	}
+	return image.Rect(minX, minY, maxX+1, maxY+1).Add(b.Min), true
+}
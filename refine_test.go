@@ -0,0 +1,49 @@
+package rmbg
+
+import (
+	"image"
+	"testing"
+)
+
+func TestBoundaryBounds(t *testing.T) {
+	mask := image.NewGray(image.Rect(0, 0, 50, 50))
+	fillRect(mask, image.Rect(10, 20, 30, 40), 255)
+
+	got, ok := boundaryBounds(mask, 128)
+	if !ok {
+		t.Fatal("expected boundary to be found")
+	}
+	// Both sides of the edge are part of the band
+	if want := image.Rect(9, 19, 31, 41); got != want {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	if _, ok := boundaryBounds(image.NewGray(image.Rect(0, 0, 10, 10)), 128); ok {
+		t.Error("expected no boundary in empty mask")
+	}
+}
+
+func TestMergeRefined(t *testing.T) {
+	// Coarse 10x10 mask of a 100x100 image, fine 40x40 mask of region (40,40)-(80,80)
+	coarse := image.NewGray(image.Rect(0, 0, 10, 10))
+	fillRect(coarse, image.Rect(4, 4, 8, 8), 255)
+	fine := image.NewGray(image.Rect(0, 0, 40, 40))
+	fillRect(fine, image.Rect(0, 0, 20, 20), 255)
+	region := image.Rect(40, 40, 80, 80)
+
+	out := mergeRefined(coarse, fine, image.Pt(100, 100), region)
+	if want := image.Rect(0, 0, 100, 100); out.Bounds() != want {
+		t.Fatalf("expected bounds %v, got %v", want, out.Bounds())
+	}
+	// Inside the region, the fine mask wins
+	if v := out.GrayAt(50, 50).Y; v != 255 {
+		t.Errorf("expected refined foreground at (50, 50), got %d", v)
+	}
+	if v := out.GrayAt(70, 70).Y; v != 0 {
+		t.Errorf("expected refined background at (70, 70), got %d", v)
+	}
+	// Outside it, the coarse mask is kept
+	if v := out.GrayAt(10, 10).Y; v != 0 {
+		t.Errorf("expected coarse background at (10, 10), got %d", v)
+	}
+}
@@ -0,0 +1,133 @@
+package rmbg
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+const (
+	// DefaultReflectionHeight is the default ReflectionOptions.Height
+	DefaultReflectionHeight = 0.35
+	// DefaultReflectionOpacity is the default ReflectionOptions.Opacity
+	DefaultReflectionOpacity = 0.35
+)
+
+// ReflectionOptions configures Reflect
+type ReflectionOptions struct {
+	// Height is the height of the reflection as a fraction of the subject's
+	// (default: DefaultReflectionHeight)
+	Height float64
+	// Opacity is the opacity of the reflection where it meets the subject,
+	// fading linearly to transparent (default: DefaultReflectionOpacity)
+	Opacity float64
+	// Gap is the distance in pixels between the subject and its reflection
+	Gap int
+}
+
+// withDefaults fills the zero fields of opts
+func (opts *ReflectionOptions) withDefaults() ReflectionOptions {
+	o := ReflectionOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Height <= 0 {
+		o.Height = DefaultReflectionHeight
+	}
+	if o.Opacity <= 0 {
+		o.Opacity = DefaultReflectionOpacity
+	}
+	o.Opacity = min(o.Opacity, 1)
+	o.Gap = max(o.Gap, 0)
+	return o
+}
+
+// Reflect returns the cut-out img with a mirrored, fading reflection of its
+// subject below it, as on a glossy floor. The subject is the box of the
+// pixels that are not fully transparent; the reflection starts below its
+// lowest row, over any transparent margin of img, and the canvas grows as
+// needed to fit it. Images without visible pixels are returned as copies.
+func Reflect(img image.Image, opts *ReflectionOptions) *image.NRGBA {
+	o := opts.withDefaults()
+	src := toNRGBA(img)
+	b := src.Rect
+	subject := opaqueBounds(src)
+	if subject.Empty() {
+		return src
+	}
+
+	height := max(1, int(math.Round(float64(subject.Dy())*o.Height)))
+	height = min(height, subject.Dy())
+	top := subject.Max.Y + o.Gap
+	dst := image.NewNRGBA(image.Rect(b.Min.X, b.Min.Y, b.Max.X, max(b.Max.Y, top+height)))
+	draw.Draw(dst, b, src, b.Min, draw.Src)
+
+	for k := range height {
+		// Fade from Opacity at the subject to transparent
+		fade := o.Opacity * (1 - float64(k)/float64(height))
+		row := src.Pix[src.PixOffset(b.Min.X, subject.Max.Y-1-k):][:b.Dx()*4]
+		out := dst.Pix[dst.PixOffset(b.Min.X, top+k):][:b.Dx()*4]
+		for x := 0; x < len(row); x += 4 {
+			a := uint8(math.Round(float64(row[x+3]) * fade))
+			if a == 0 {
+				continue
+			}
+			// Reflections go under whatever the margin already holds
+			under := color.NRGBA{R: row[x], G: row[x+1], B: row[x+2], A: a}
+			out[x], out[x+1], out[x+2], out[x+3] = over(color.NRGBA{R: out[x], G: out[x+1], B: out[x+2], A: out[x+3]}, under)
+		}
+	}
+	return dst
+}
+
+// over composites the non-premultiplied colors fg over bg
+func over(fg, bg color.NRGBA) (r, g, b, a uint8) {
+	if fg.A == 255 || bg.A == 0 {
+		return fg.R, fg.G, fg.B, fg.A
+	}
+	fa, ba := float64(fg.A)/255, float64(bg.A)/255
+	oa := fa + ba*(1-fa)
+	mix := func(f, b uint8) uint8 {
+		return uint8(math.Round((float64(f)*fa + float64(b)*ba*(1-fa)) / oa))
+	}
+	return mix(fg.R, bg.R), mix(fg.G, bg.G), mix(fg.B, bg.B), uint8(math.Round(oa * 255))
+}
+
+// opaqueBounds returns the box of the pixels of img that are not fully
+// transparent
+func opaqueBounds(img *image.NRGBA) image.Rectangle {
+	b := img.Rect
+	minX, minY, maxX, maxY := b.Max.X, b.Max.Y, b.Min.X, b.Min.Y
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(b.Min.X, y):][:b.Dx()*4]
+		for x := 0; x < b.Dx(); x++ {
+			if row[x*4+3] != 0 {
+				minX, maxX = min(minX, b.Min.X+x), max(maxX, b.Min.X+x+1)
+				minY, maxY = min(minY, y), max(maxY, y+1)
+			}
+		}
+	}
+	if maxX <= minX {
+		return image.Rectangle{}
+	}
+	return image.Rect(minX, minY, maxX, maxY)
+}
+
+// flatten composites img over bg
+func flatten(img image.Image, bg color.Color) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(b)
+	draw.Draw(dst, b, image.NewUniform(bg), image.Point{}, draw.Src)
+	draw.Draw(dst, b, img, b.Min, draw.Over)
+	return dst
+}
+
+// flattenOver composites img over bg, a zero-based image of its size
+func flattenOver(img, bg image.Image) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(b)
+	draw.Draw(dst, b, bg, image.Point{}, draw.Src)
+	draw.Draw(dst, b, img, b.Min, draw.Over)
+	return dst
+}
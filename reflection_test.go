@@ -0,0 +1,100 @@
+package rmbg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// reflectionInput is a 10x20 cut-out with an opaque 10x10 red subject on top
+// of a transparent margin
+func reflectionInput() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 10, 20))
+	for y := range 10 {
+		for x := range 10 {
+			img.SetNRGBA(x, y, color.NRGBA{R: 255, G: uint8(y), A: 255})
+		}
+	}
+	return img
+}
+
+func TestReflect(t *testing.T) {
+	t.Run("Margin", func(t *testing.T) {
+		out := Reflect(reflectionInput(), &ReflectionOptions{Height: 0.5, Opacity: 0.5})
+		if got := out.Bounds(); got != image.Rect(0, 0, 10, 20) {
+			t.Errorf("expected the margin to hold the reflection, got %v", got)
+		}
+		// Row 10 mirrors row 9 at full reflection opacity
+		if got := out.NRGBAAt(3, 10); got != (color.NRGBA{R: 255, G: 9, A: 128}) {
+			t.Errorf("expected the mirrored row at half opacity, got %v", got)
+		}
+		if got := out.NRGBAAt(3, 14).A; got != 25 {
+			t.Errorf("expected the reflection to fade to alpha 25, got %d", got)
+		}
+		if got := out.NRGBAAt(3, 15).A; got != 0 {
+			t.Errorf("expected the reflection to end after 5 rows, got alpha %d", got)
+		}
+		if got := out.NRGBAAt(3, 4); got != (color.NRGBA{R: 255, G: 4, A: 255}) {
+			t.Errorf("expected the subject unchanged, got %v", got)
+		}
+	})
+
+	t.Run("Grows", func(t *testing.T) {
+		out := Reflect(reflectionInput(), &ReflectionOptions{Height: 1, Gap: 5})
+		if got := out.Bounds(); got != image.Rect(0, 0, 10, 25) {
+			t.Errorf("expected the canvas to grow to 25 rows, got %v", got)
+		}
+		if got := out.NRGBAAt(3, 12).A; got != 0 {
+			t.Errorf("expected a transparent gap, got alpha %d", got)
+		}
+		if got := out.NRGBAAt(3, 15).G; got != 9 {
+			t.Errorf("expected the reflection after the gap, got %d", got)
+		}
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		empty := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+		if got := Reflect(empty, nil).Bounds(); got != empty.Rect {
+			t.Errorf("expected %v, got %v", empty.Rect, got)
+		}
+	})
+}
+
+func TestOver(t *testing.T) {
+	r, g, b, a := over(color.NRGBA{R: 255, A: 128}, color.NRGBA{B: 255, A: 255})
+	if a != 255 || r != 128 || b != 127 || g != 0 {
+		t.Errorf("expected half red over blue, got %d %d %d %d", r, g, b, a)
+	}
+}
+
+func TestRemoveBackgroundReflection(t *testing.T) {
+	src := solidImage(20, 10, color.NRGBA{R: 255, A: 255})
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, src); err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	r := cachedEngine(src)
+
+	var out bytes.Buffer
+	opts := &IOOptions{Background: color.White, Reflection: &ReflectionOptions{}}
+	if err := r.RemoveBackgroundFrom(bytes.NewReader(encoded.Bytes()), &out, FormatPNG, opts); err != nil {
+		t.Fatalf("RemoveBackgroundFrom failed: %v", err)
+	}
+	img, err := png.Decode(&out)
+	if err != nil {
+		t.Fatalf("invalid output: %v", err)
+	}
+	// The subject fills the image, so the reflection extends it by 35%
+	if got := img.Bounds().Size(); got != image.Pt(20, 14) {
+		t.Errorf("expected 20x14, got %v", got)
+	}
+	if got := color.NRGBAModel.Convert(img.At(5, 10)).(color.NRGBA); got.A != 255 || got.G == 255 || got.G == 0 {
+		t.Errorf("expected a pink reflection on white, got %v", got)
+	}
+
+	if err := r.RemoveBackgroundFrom(bytes.NewReader(encoded.Bytes()), &out, FormatSVG, opts); err == nil {
+		t.Errorf("expected error for a reflection in SVG output")
+	}
+}
@@ -0,0 +1,83 @@
+package rmbg
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// ReloadModel loads the model at modelPath and swaps it in for the default
+// model without interrupting calls in flight: calls started before the swap
+// finish on the old model, which is closed once they are done, and later calls
+// use the new one. spec describes the new model (nil keeps the current spec).
+// ReloadModel blocks until the old model is closed; on error the current model
+// stays in place. The portrait model of ModelRouting is not affected.
+func (r *RemBG) ReloadModel(modelPath string, spec *ModelSpec) error {
+	if r.closed.Load() {
+		return ErrClosed
+	}
+
+	r.modelMu.RLock()
+	next := r.model.spec
+	r.modelMu.RUnlock()
+	if spec != nil {
+		next = *spec
+	}
+
+	loadStart := time.Now()
+	m, err := newMainModel(&r.config, modelPath, next)
+	if err != nil {
+		return fmt.Errorf("failed to reload model: %w", err)
+	}
+
+	r.modelMu.Lock()
+	if r.closed.Load() {
+		r.modelMu.Unlock()
+		_ = m.close()
+		return ErrClosed
+	}
+	old := r.model
+	r.generation++
+	m.generation = r.generation
+	r.model, r.modelPath = m, modelPath
+	r.modelMu.Unlock()
+	r.logModelLoaded(m, &r.config, modelPath, time.Since(loadStart))
+
+	// No call can pick up old anymore, so once its users are done it is idle
+	old.users.Wait()
+	if err := old.close(); err != nil {
+		r.log(slog.LevelWarn, "failed to close replaced model", slog.String("model", old.spec.Name), slog.Any("error", err))
+	}
+	return nil
+}
+
+// acquireModel returns the default model, which stays open until release is
+// called on it even if ReloadModel replaces it in the meantime
+func (r *RemBG) acquireModel() *model {
+	r.modelMu.RLock()
+	defer r.modelMu.RUnlock()
+	r.model.users.Add(1)
+	return r.model
+}
+
+// currentModel returns the default model without holding it, for reading its
+// spec and session count
+func (r *RemBG) currentModel() *model {
+	r.modelMu.RLock()
+	defer r.modelMu.RUnlock()
+	return r.model
+}
+
+// release marks the end of a call using m
+func (m *model) release() {
+	m.users.Done()
+}
+
+// cacheSalt distinguishes the cached masks of a reloaded model from those of
+// the model it replaced, even when both share a spec name
+func (m *model) cacheSalt() string {
+	if m.generation == 0 {
+		return m.spec.Name
+	}
+	return fmt.Sprintf("%s#%d", m.spec.Name, m.generation)
+}
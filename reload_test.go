@@ -0,0 +1,53 @@
+package rmbg
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReloadModel(t *testing.T) {
+	t.Run("MissingModel", func(t *testing.T) {
+		m := openModel(t)
+		r := &RemBG{model: m}
+		t.Cleanup(func() { _ = r.Close() })
+
+		if err := r.ReloadModel("missing.onnx", nil); !errors.Is(err, ErrModelNotFound) {
+			t.Errorf("expected ErrModelNotFound, got %v", err)
+		}
+		if r.currentModel() != m {
+			t.Errorf("expected the current model to stay in place")
+		}
+	})
+
+	t.Run("InvalidSpec", func(t *testing.T) {
+		r := &RemBG{model: openModel(t)}
+		t.Cleanup(func() { _ = r.Close() })
+
+		spec := ModelU2NetP
+		spec.InputSize = 0
+		if err := r.ReloadModel("missing.onnx", &spec); !errors.Is(err, ErrUnsupportedModel) {
+			t.Errorf("expected ErrUnsupportedModel, got %v", err)
+		}
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		r := &RemBG{model: openModel(t)}
+		if err := r.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+		if err := r.ReloadModel("missing.onnx", nil); !errors.Is(err, ErrClosed) {
+			t.Errorf("expected ErrClosed, got %v", err)
+		}
+	})
+}
+
+func TestCacheSalt(t *testing.T) {
+	first := &model{spec: ModelU2NetP}
+	reloaded := &model{spec: ModelU2NetP, generation: 1}
+	if first.cacheSalt() != ModelU2NetP.Name {
+		t.Errorf("expected %q, got %q", ModelU2NetP.Name, first.cacheSalt())
+	}
+	if first.cacheSalt() == reloaded.cacheSalt() {
+		t.Errorf("expected reloaded model to use a different cache salt, got %q", reloaded.cacheSalt())
+	}
+}
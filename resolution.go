@@ -0,0 +1,104 @@
+package rmbg
+
+import (
+	"fmt"
+	"image"
+	"log/slog"
+	"math"
+)
+
+// ResolutionPolicy selects what happens to images above Config.MaxMegapixels
+type ResolutionPolicy int
+
+const (
+	// ResolutionReject fails with ErrImageTooLarge
+	ResolutionReject ResolutionPolicy = iota
+	// ResolutionDownscale shrinks the image to the limit and processes the
+	// copy, so the output has the reduced size
+	ResolutionDownscale
+	// ResolutionUpscaleMask segments a shrunk copy and scales its mask back
+	// up, so the output keeps the full resolution
+	ResolutionUpscaleMask
+)
+
+func (p ResolutionPolicy) String() string {
+	switch p {
+	case ResolutionReject:
+		return "reject"
+	case ResolutionDownscale:
+		return "downscale"
+	case ResolutionUpscaleMask:
+		return "upscale-mask"
+	}
+	return fmt.Sprintf("ResolutionPolicy(%d)", int(p))
+}
+
+// Downscale records that an image exceeded Config.MaxMegapixels and was
+// processed at a lower resolution
+type Downscale struct {
+	// Policy is how the image was handled: ResolutionDownscale when the output
+	// has the Processed size, ResolutionUpscaleMask when only segmentation ran
+	// at it
+	Policy ResolutionPolicy
+	// Original is the size of the input
+	Original image.Point
+	// Processed is the size it was shrunk to
+	Processed image.Point
+}
+
+// maxPixels is the pixel limit of Config.MaxMegapixels, or 0 for none
+func (r *RemBG) maxPixels() int {
+	return int(r.config.MaxMegapixels * 1e6)
+}
+
+// overLimit reports whether img has more pixels than Config.MaxMegapixels
+func (r *RemBG) overLimit(img image.Image) bool {
+	limit := r.maxPixels()
+	b := img.Bounds()
+	return limit > 0 && b.Dx()*b.Dy() > limit
+}
+
+// shrinkToLimit scales img down to at most Config.MaxMegapixels, keeping its
+// aspect ratio
+func (r *RemBG) shrinkToLimit(img image.Image) (image.Image, *Downscale) {
+	b := img.Bounds()
+	scale := math.Sqrt(float64(r.maxPixels()) / float64(b.Dx()*b.Dy()))
+	small := downsample(img, max(1, int(float64(max(b.Dx(), b.Dy()))*scale)))
+	ds := &Downscale{Original: b.Size(), Processed: small.Bounds().Size()}
+	r.log(slog.LevelDebug, "image downscaled",
+		slog.Int("width", b.Dx()),
+		slog.Int("height", b.Dy()),
+		slog.Int("processed_width", ds.Processed.X),
+		slog.Int("processed_height", ds.Processed.Y),
+	)
+	return small, ds
+}
+
+// limitOutput applies ResolutionDownscale to img, returning the image to
+// process and the decision, nil when img is kept. The other policies apply to
+// segmentation only, in limitInference.
+func (r *RemBG) limitOutput(img image.Image) (image.Image, *Downscale) {
+	if r.config.ResolutionPolicy != ResolutionDownscale || !r.overLimit(img) {
+		return img, nil
+	}
+	small, ds := r.shrinkToLimit(img)
+	ds.Policy = ResolutionDownscale
+	return small, ds
+}
+
+// limitInference returns the image to segment for img: img itself when it is
+// within Config.MaxMegapixels, a shrunk copy otherwise. Under ResolutionReject
+// it fails instead. Paths whose output must keep the size of img, like frames
+// and regions, shrink here even under ResolutionDownscale.
+func (r *RemBG) limitInference(img image.Image) (image.Image, *Downscale, error) {
+	if !r.overLimit(img) {
+		return img, nil, nil
+	}
+	if r.config.ResolutionPolicy == ResolutionReject {
+		b := img.Bounds()
+		return nil, nil, fmt.Errorf("%w: %dx%d, limit %d pixels", ErrImageTooLarge, b.Dx(), b.Dy(), r.maxPixels())
+	}
+	small, ds := r.shrinkToLimit(img)
+	ds.Policy = ResolutionUpscaleMask
+	return small, ds, nil
+}
@@ -0,0 +1,93 @@
+package rmbg
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func TestResolutionPolicy(t *testing.T) {
+	// 20000 pixels against a limit of 5000 halves each side
+	big := solidImage(200, 100, color.NRGBA{R: 255, A: 255})
+	shrunk := downsample(big, 100)
+	limited := func(r *RemBG, policy ResolutionPolicy) *RemBG {
+		r.config = Config{MaxMegapixels: 0.005, ResolutionPolicy: policy}
+		return r
+	}
+
+	t.Run("Reject", func(t *testing.T) {
+		r := limited(cachedEngine(big), ResolutionReject)
+		if _, err := r.Process(big); !errors.Is(err, ErrImageTooLarge) {
+			t.Errorf("expected ErrImageTooLarge, got %v", err)
+		}
+	})
+
+	t.Run("Downscale", func(t *testing.T) {
+		r := limited(cachedEngine(shrunk), ResolutionDownscale)
+		res, err := r.Process(big)
+		if err != nil {
+			t.Fatalf("Process failed: %v", err)
+		}
+		if got := res.Image.Bounds().Size(); got != image.Pt(100, 50) {
+			t.Errorf("expected 100x50 output, got %v", got)
+		}
+		want := Downscale{Policy: ResolutionDownscale, Original: image.Pt(200, 100), Processed: image.Pt(100, 50)}
+		if res.Downscale == nil || *res.Downscale != want {
+			t.Errorf("expected %+v, got %+v", want, res.Downscale)
+		}
+	})
+
+	t.Run("UpscaleMask", func(t *testing.T) {
+		r := limited(cachedEngine(big), ResolutionUpscaleMask)
+		res, err := r.Process(big)
+		if err != nil {
+			t.Fatalf("Process failed: %v", err)
+		}
+		if got := res.Mask.Bounds().Size(); got != image.Pt(200, 100) {
+			t.Errorf("expected a 200x100 mask, got %v", got)
+		}
+		want := Downscale{Policy: ResolutionUpscaleMask, Original: image.Pt(200, 100), Processed: image.Pt(100, 50)}
+		if res.Downscale == nil || *res.Downscale != want {
+			t.Errorf("expected %+v, got %+v", want, res.Downscale)
+		}
+	})
+
+	t.Run("WithinLimit", func(t *testing.T) {
+		r := limited(cachedEngine(shrunk), ResolutionReject)
+		res, err := r.Process(shrunk)
+		if err != nil {
+			t.Fatalf("Process failed: %v", err)
+		}
+		if res.Downscale != nil {
+			t.Errorf("expected no downscale, got %+v", res.Downscale)
+		}
+	})
+
+	t.Run("Encoded", func(t *testing.T) {
+		var encoded bytes.Buffer
+		if err := png.Encode(&encoded, big); err != nil {
+			t.Fatalf("failed to encode: %v", err)
+		}
+		r := limited(cachedEngine(shrunk), ResolutionDownscale)
+		var out bytes.Buffer
+		if err := r.RemoveBackgroundFrom(&encoded, &out, FormatPNG, nil); err != nil {
+			t.Fatalf("RemoveBackgroundFrom failed: %v", err)
+		}
+		cfg, err := png.DecodeConfig(&out)
+		if err != nil {
+			t.Fatalf("invalid output: %v", err)
+		}
+		if cfg.Width != 100 || cfg.Height != 50 {
+			t.Errorf("expected 100x50 output, got %dx%d", cfg.Width, cfg.Height)
+		}
+	})
+}
+
+func TestNewMaxMegapixels(t *testing.T) {
+	if _, err := New(&Config{MaxMegapixels: -1}); err == nil {
+		t.Errorf("expected error for a negative limit")
+	}
+}
@@ -0,0 +1,134 @@
+package rmbg
+
+import (
+	"fmt"
+	"image"
+	"strings"
+)
+
+// RLE is a COCO-style run-length encoded binary mask. Runs are counted in
+// column-major order and always start with a (possibly empty) background run.
+type RLE struct {
+	// Size is [height, width], matching the COCO annotation format
+	Size [2]int `json:"size"`
+	// Counts holds alternating background/foreground run lengths
+	Counts []int `json:"counts"`
+}
+
+// EncodeRLE encodes the pixels of mask that are >= threshold as a COCO RLE
+func EncodeRLE(mask *image.Gray, threshold uint8) RLE {
+	bounds := mask.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	rle := RLE{Size: [2]int{h, w}}
+
+	current := false
+	run := 0
+	for x := range w {
+		for y := range h {
+			on := mask.Pix[y*mask.Stride+x] >= threshold
+			if on != current {
+				rle.Counts = append(rle.Counts, run)
+				current = on
+				run = 0
+			}
+			run++
+		}
+	}
+	rle.Counts = append(rle.Counts, run)
+
+	return rle
+}
+
+// DecodeRLE expands an RLE into a binary mask (0 or 255)
+func DecodeRLE(rle RLE) (*image.Gray, error) {
+	h, w := rle.Size[0], rle.Size[1]
+	if h < 0 || w < 0 {
+		return nil, fmt.Errorf("invalid RLE size %dx%d", w, h)
+	}
+
+	mask := image.NewGray(image.Rect(0, 0, w, h))
+	total := w * h
+	pos := 0
+	for i, n := range rle.Counts {
+		if n < 0 || pos+n > total {
+			return nil, fmt.Errorf("invalid RLE run %d at index %d", n, i)
+		}
+		if i%2 == 1 {
+			for p := pos; p < pos+n; p++ {
+				mask.Pix[(p%h)*mask.Stride+p/h] = 255
+			}
+		}
+		pos += n
+	}
+	if pos != total {
+		return nil, fmt.Errorf("RLE covers %d pixels, expected %d", pos, total)
+	}
+
+	return mask, nil
+}
+
+// Area returns the number of foreground pixels
+func (r RLE) Area() int {
+	area := 0
+	for i := 1; i < len(r.Counts); i += 2 {
+		area += r.Counts[i]
+	}
+	return area
+}
+
+// String returns the compressed counts string used by pycocotools
+func (r RLE) String() string {
+	var sb strings.Builder
+	for i, n := range r.Counts {
+		x := int64(n)
+		if i > 2 {
+			x -= int64(r.Counts[i-2])
+		}
+		for more := true; more; {
+			c := x & 0x1f
+			x >>= 5
+			if c&0x10 != 0 {
+				more = x != -1
+			} else {
+				more = x != 0
+			}
+			if more {
+				c |= 0x20
+			}
+			sb.WriteByte(byte(c + 48))
+		}
+	}
+	return sb.String()
+}
+
+// ParseRLE decodes a pycocotools compressed counts string
+func ParseRLE(counts string, height, width int) (RLE, error) {
+	rle := RLE{Size: [2]int{height, width}}
+
+	for p := 0; p < len(counts); {
+		var x int64
+		k := 0
+		for more := true; more; {
+			if p >= len(counts) {
+				return RLE{}, fmt.Errorf("truncated RLE string")
+			}
+			c := int64(counts[p]) - 48
+			if c < 0 || c > 63 {
+				return RLE{}, fmt.Errorf("invalid RLE character %q", counts[p])
+			}
+			x |= (c & 0x1f) << (5 * k)
+			more = c&0x20 != 0
+			p++
+			k++
+			if !more && c&0x10 != 0 {
+				x |= -1 << (5 * k)
+			}
+		}
+		if m := len(rle.Counts); m > 2 {
+			x += int64(rle.Counts[m-2])
+		}
+		rle.Counts = append(rle.Counts, int(x))
+	}
+
+	return rle, nil
+}
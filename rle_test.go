@@ -0,0 +1,85 @@
+package rmbg
+
+import (
+	"image"
+	"slices"
+	"testing"
+)
+
+func TestEncodeRLE(t *testing.T) {
+	t.Run("ColumnMajor", func(t *testing.T) {
+		// 3x2 mask (w=3, h=2) with the middle column set
+		mask := image.NewGray(image.Rect(0, 0, 3, 2))
+		fillRect(mask, image.Rect(1, 0, 2, 2), 255)
+
+		rle := EncodeRLE(mask, 128)
+		if rle.Size != [2]int{2, 3} {
+			t.Errorf("expected size [2 3], got %v", rle.Size)
+		}
+		want := []int{2, 2, 2}
+		if !slices.Equal(rle.Counts, want) {
+			t.Errorf("expected counts %v, got %v", want, rle.Counts)
+		}
+		if rle.Area() != 2 {
+			t.Errorf("expected area 2, got %d", rle.Area())
+		}
+	})
+
+	t.Run("LeadingForeground", func(t *testing.T) {
+		mask := image.NewGray(image.Rect(0, 0, 2, 2))
+		fillRect(mask, image.Rect(0, 0, 1, 1), 255)
+
+		rle := EncodeRLE(mask, 128)
+		want := []int{0, 1, 3}
+		if !slices.Equal(rle.Counts, want) {
+			t.Errorf("expected counts %v, got %v", want, rle.Counts)
+		}
+	})
+}
+
+func TestDecodeRLE(t *testing.T) {
+	t.Run("RoundTrip", func(t *testing.T) {
+		mask := image.NewGray(image.Rect(0, 0, 17, 11))
+		fillRect(mask, image.Rect(3, 2, 9, 7), 255)
+		fillRect(mask, image.Rect(12, 0, 17, 11), 255)
+
+		got, err := DecodeRLE(EncodeRLE(mask, 128))
+		if err != nil {
+			t.Fatalf("DecodeRLE failed: %v", err)
+		}
+		if !slices.Equal(got.Pix, mask.Pix) {
+			t.Errorf("decoded mask differs from original")
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		if _, err := DecodeRLE(RLE{Size: [2]int{2, 2}, Counts: []int{1, 1}}); err == nil {
+			t.Errorf("expected error for short counts")
+		}
+		if _, err := DecodeRLE(RLE{Size: [2]int{2, 2}, Counts: []int{3, 3}}); err == nil {
+			t.Errorf("expected error for overflowing counts")
+		}
+	})
+}
+
+func TestRLEString(t *testing.T) {
+	rle := RLE{Size: [2]int{100, 100}, Counts: []int{120, 5, 1000, 30, 40, 0, 8804}}
+
+	s := rle.String()
+	parsed, err := ParseRLE(s, 100, 100)
+	if err != nil {
+		t.Fatalf("ParseRLE failed: %v", err)
+	}
+	if !slices.Equal(parsed.Counts, rle.Counts) {
+		t.Errorf("expected counts %v, got %v", rle.Counts, parsed.Counts)
+	}
+
+	// Known pycocotools encoding of counts [0, 1, 3]
+	if got := (RLE{Counts: []int{0, 1, 3}}).String(); got != "013" {
+		t.Errorf("expected \"013\", got %q", got)
+	}
+
+	if _, err := ParseRLE("0\x01", 2, 2); err == nil {
+		t.Errorf("expected error for invalid character")
+	}
+}
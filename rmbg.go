@@ -1,38 +1,23 @@
 package rmbg
 
 import (
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
-	"log"
-	"math"
-	"runtime"
+	"log/slog"
 	"sync"
-
-	"github.com/disintegration/imaging"
-	ort "github.com/yalue/onnxruntime_go"
+	"sync/atomic"
+	"time"
 )
 
-func initializeEnv() {
-	for i := range 256 {
-		v := float32(i)/255.0*12.0 - 6.0
-		sigmoidLUT[i] = 1.0 / (1.0 + float32(math.Exp(float64(-v))))
-	}
-
-	if err := ort.InitializeEnvironment(); err != nil {
-		log.Panicf("failed to init ORT env: %v", err)
-	}
-}
-
 const (
 	inputSize = 320
 )
 
 var (
-	initOnce   sync.Once
-	sigmoidLUT [256]float32
-	mean       = [3]float32{0.485, 0.456, 0.406}
-	std        = [3]float32{0.229, 0.224, 0.225}
+	mean = [3]float32{0.485, 0.456, 0.406}
+	std  = [3]float32{0.229, 0.224, 0.225}
 )
 
 // Config for RemBG
@@ -47,190 +32,666 @@ type Config struct {
 	CpuMemArena bool
 	// MemPattern is a flag indicating whether to use a memory pattern.
 	MemPattern bool
+	// ORTLibraryPath is the path to the ONNX Runtime shared library. It only
+	// applies if the runtime is not initialized yet, by Initialize or an earlier
+	// engine (default: see InitOptions.LibraryPath).
+	ORTLibraryPath string
+	// Provider is the execution provider that runs the model (default: ProviderCPU).
+	Provider Provider
+	// DeviceID selects the GPU used by the CUDA, TensorRT and DirectML providers.
+	DeviceID int
+	// Sessions is the number of ONNX sessions per model, each with its own bound
+	// input and output tensors, so that many calls can run inference at once
+	// (default: 1). Every session holds its own copy of the model weights.
+	Sessions int
+	// Model describes the model's tensors and output kind (default: ModelU2NetP).
+	Model *ModelSpec
+	// InputSize overrides the input resolution of Model, for models exported with
+	// dynamic spatial dimensions (0 keeps the spec's size).
+	InputSize int
+	// Letterbox resizes images into the model input keeping their aspect ratio,
+	// padding the rest with the mean color, instead of stretching them to a
+	// square. Objects in panoramas and other wide or tall images keep their
+	// shape, which improves their masks at the cost of fewer pixels.
+	Letterbox bool
+	// TargetClasses names the classes of a multi-class model that form the
+	// object, e.g. "person" and "product" (default: every class but the
+	// first, taken as the background). See ModelSpec.Classes and ClassMasks.
+	TargetClasses []string
+	// SoftMask keeps the sigmoid probabilities of logit models as a soft alpha
+	// matte instead of binarizing them with Otsu's threshold.
+	SoftMask bool
+	// ModelRouting optionally routes portraits to a dedicated human segmentation model.
+	ModelRouting *ModelRouting
+	// MaskCacheSize is the number of masks kept in an LRU cache keyed by image content,
+	// so repeated calls on the same image skip inference (0 disables the cache).
+	MaskCacheSize int
+	// MaskCacheDistance also serves the cached mask of a near-duplicate: an
+	// image of the same size whose perceptual hash, see PHash, differs in at
+	// most this many bits, such as a re-export of the same product shot
+	// (0 only serves identical content).
+	MaskCacheDistance int
+	// TileSize splits images larger than this many pixels into overlapping tiles that
+	// are segmented separately, preserving detail on large scans (0 disables tiling).
+	TileSize int
+	// TileOverlap is the overlap between neighboring tiles in pixels, blended with a
+	// feathered seam (default: TileSize/8).
+	TileOverlap int
+	// MaxMegapixels bounds the resolution images are processed at, so a single
+	// huge upload cannot exhaust the memory of a shared service (0 disables the
+	// limit). ResolutionPolicy decides what happens to larger images.
+	MaxMegapixels float64
+	// ResolutionPolicy handles images above MaxMegapixels (default:
+	// ResolutionReject). The decision is reported in Result.Downscale.
+	ResolutionPolicy ResolutionPolicy
+	// Scales are further input resolutions the model runs at, for models
+	// exported with dynamic spatial dimensions. The probability maps of all
+	// resolutions are averaged before thresholding, which improves masks of
+	// both small and large subjects at the cost of one inference per scale;
+	// each scale loads its own sessions. Combine it with Letterbox to keep
+	// the aspect ratio at every scale.
+	Scales []int
+	// FlipTTA also runs the model on the horizontally mirrored image and
+	// averages the mirrored-back probability map with the original one, at
+	// every scale. This test-time augmentation is a cheap accuracy gain for
+	// roughly symmetric subjects, at the cost of twice the inferences.
+	FlipTTA bool
+	// Ensemble lists further models segmenting every image together with
+	// the main one, e.g. u2netp and ISNet, for callers who put mask quality
+	// before latency. Their probability maps are fused by Fusion at the
+	// largest resolution. Each member loads its own sessions.
+	Ensemble []EnsembleMember
+	// Fusion combines the maps of Ensemble (default: FusionMean).
+	Fusion Fusion
+	// Upsampling selects how the mask is scaled to the image resolution (default:
+	// UpsampleBlur). UpsampleGuided snaps mask edges to image edges;
+	// UpsampleAntialias gives crisp, anti-aliased edges.
+	Upsampling Upsampling
+	// AntialiasWidth is the width in pixels over which UpsampleAntialias ramps
+	// mask edges: 1 is the coverage of a sharp edge, larger values soften it
+	// (default: DefaultAntialiasWidth).
+	AntialiasWidth float64
+	// Refine runs a second inference on a zoomed crop around the object boundary
+	// and merges it into the mask, improving edges at the cost of a second pass.
+	Refine bool
+	// Shadow keeps the soft shadow touching the subject in the mask at reduced
+	// opacity instead of cutting it away, for products shot on a plain
+	// background (default: off). See PreserveShadow.
+	Shadow *ShadowOptions
+	// Denoise smooths sensor noise with a bilateral filter before inference,
+	// so noisy night shots do not produce speckled masks (default: off). It
+	// runs first, before Exposure and PreProcessors, and only affects
+	// segmentation.
+	Denoise *Bilateral
+	// Exposure normalizes the exposure and contrast of images before
+	// inference, improving masks of underexposed and hazy photos (default:
+	// ExposureOff). It runs before PreProcessors and, like them, only affects
+	// segmentation.
+	Exposure Exposure
+	// PreProcessors run in order on an 8-bit copy of the image before it is
+	// resized and normalized for the model, e.g. AutoContrast, WhiteBalance or
+	// Denoise. They only affect segmentation: outputs are rendered from the
+	// original image.
+	PreProcessors []PreProcessor
+	// PostProcessors run in order on the upsampled mask and an 8-bit copy of
+	// the image before compositing, e.g. Feather, Decontaminate, KeepShadow or
+	// custom steps. Outputs are rendered from the image they return, so 16-bit
+	// sources lose their depth.
+	PostProcessors []PostProcessor
+	// PoolOutputs recycles the full-resolution image and mask buffers of results
+	// once Result.Release is called, reducing GC pressure in busy servers.
+	PoolOutputs bool
+	// CollectStats records per-stage timings and allocations in Result.Stats and
+	// in the aggregate returned by RemBG.Stats. Allocation counting briefly stops
+	// the world twice per call.
+	CollectStats bool
+	// Deterministic makes repeated calls on the same input produce bit-identical
+	// output on a given machine and ONNX Runtime build, for golden-image tests and
+	// content-addressed caches. Inference runs sequentially on one thread, so
+	// IntraOpNumThreads and InterOpNumThreads are ignored.
+	Deterministic bool
+	// Logger receives structured events: model loading at info level, routing,
+	// caching and tiling decisions and per-call timings at debug level (default:
+	// no logging).
+	Logger *slog.Logger
+	// OnStage is called on the calling goroutine after each stage of a call
+	// finishes, with one of the Stage names and the stage's duration. Masks
+	// served from the cache skip StagePreprocess and StageInference; tiled and
+	// refined predictions report the sum over all their inferences. It must be
+	// safe for concurrent use when the engine is.
+	OnStage func(stage string, d time.Duration)
+	// Metrics receives stage latencies, error counts and image sizes (default:
+	// none).
+	Metrics MetricsCollector
+	// Backend runs the model instead of ONNX Runtime, e.g. onnxruntime-web in
+	// a browser build (see JSBackend). ModelPath, the ONNX Runtime settings and
+	// ModelRouting do not apply; Model must describe the model it runs.
+	Backend Backend
 }
 
 // RemBG with session reuse and memory pooling
 type RemBG struct {
+	// modelMu guards model, modelPath and generation, which ReloadModel
+	// replaces
+	modelMu    sync.RWMutex
 	modelPath  string
-	session    *ort.DynamicAdvancedSession
-	sessionMu  sync.Mutex
-	tensorPool *tensorPool
-	blurPool   *blurBufferPool
+	model      *model
+	generation uint64
+	// config is kept to load replacement models with the same settings
+	config Config
+
+	portrait *model
+	detector PersonDetector
+	cache    *maskCache
+	blurPool *blurBufferPool
+
+	tileSize    int
+	tileOverlap int
+	upsampling  Upsampling
+	// antialiasWidth is Config.AntialiasWidth
+	antialiasWidth float64
+	refine         bool
+	shadow         *ShadowOptions
+	preProcessors  []PreProcessor
+	postProcessors []PostProcessor
+	outputs        *imagePool
+	stats          *statsCollector
+	logger         *slog.Logger
+	onStage        func(string, time.Duration)
+	metrics        MetricsCollector
+	closed         atomic.Bool
 }
 
-func createSession(config *Config) (*ort.DynamicAdvancedSession, error) {
-	options, err := ort.NewSessionOptions()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create session options: %w", err)
+// NewRemBG initializes ONNX session
+func New(config *Config) (*RemBG, error) {
+	tileOverlap := config.TileOverlap
+	if config.TileSize > 0 {
+		if tileOverlap == 0 {
+			tileOverlap = config.TileSize / 8
+		}
+		if tileOverlap < 0 || tileOverlap >= config.TileSize {
+			return nil, fmt.Errorf("tile overlap %d must be in [0, %d)", tileOverlap, config.TileSize)
+		}
 	}
-	defer func() {
-		_ = options.Destroy()
-	}()
 
-	err = options.SetIntraOpNumThreads(config.IntraOpNumThreads)
-	if err != nil {
-		return nil, fmt.Errorf("failed to set intra-op num threads: %w", err)
+	if config.MaxMegapixels < 0 {
+		return nil, fmt.Errorf("max megapixels %g must not be negative", config.MaxMegapixels)
 	}
-	err = options.SetInterOpNumThreads(config.InterOpNumThreads)
-	if err != nil {
-		return nil, fmt.Errorf("failed to set inter-op num threads: %w", err)
+
+	if err := validateScales(config.Scales); err != nil {
+		return nil, err
 	}
-	err = options.SetIntraOpNumThreads(config.IntraOpNumThreads)
-	if err != nil {
-		return nil, fmt.Errorf("failed to set intra-op num threads: %w", err)
+
+	if config.Backend != nil && config.ModelRouting != nil {
+		return nil, errors.New("model routing is not supported with a custom backend")
 	}
-	err = options.SetCpuMemArena(config.CpuMemArena)
+
+	preProcessors := config.PreProcessors
+	exposure, err := config.Exposure.preProcessor()
 	if err != nil {
-		return nil, fmt.Errorf("failed to set cpu memory arena: %w", err)
+		return nil, err
 	}
-	err = options.SetMemPattern(config.MemPattern)
-	if err != nil {
-		return nil, fmt.Errorf("failed to set memory pattern: %w", err)
+	if exposure != nil {
+		preProcessors = append([]PreProcessor{exposure}, preProcessors...)
 	}
-	err = options.SetExecutionMode(ort.ExecutionModeParallel)
-	if err != nil {
-		return nil, fmt.Errorf("failed to set execution mode: %w", err)
+	if config.Denoise != nil {
+		preProcessors = append([]PreProcessor{*config.Denoise}, preProcessors...)
 	}
-	err = options.SetGraphOptimizationLevel(ort.GraphOptimizationLevelEnableAll)
-	if err != nil {
-		return nil, fmt.Errorf("failed to set graph optimization level: %w", err)
+
+	spec := ModelU2NetP
+	if config.Model != nil {
+		spec = *config.Model
+	}
+	if config.InputSize < 0 {
+		return nil, fmt.Errorf("input size %d must not be negative", config.InputSize)
+	}
+	if config.InputSize > 0 {
+		spec.InputSize = config.InputSize
+	}
+	if config.MaskCacheDistance < 0 || config.MaskCacheDistance > 64 {
+		return nil, fmt.Errorf("mask cache distance %d must be between 0 and 64", config.MaskCacheDistance)
+	}
+	if len(config.TargetClasses) > 0 && len(spec.Classes) == 0 {
+		return nil, fmt.Errorf("%w: target classes need a multi-class model", ErrUnsupportedModel)
 	}
 
-	session, err := ort.NewDynamicAdvancedSession(
-		config.ModelPath,
-		[]string{"input.1"},
-		[]string{"1959"},
-		options,
-	)
+	loadStart := time.Now()
+	m, err := newMainModel(config, config.ModelPath, spec)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create ONNX session: %w", err)
+		return nil, err
 	}
 
-	return session, nil
-}
+	r := &RemBG{
+		modelPath: config.ModelPath,
+		model:     m,
+		config:    *config,
+		blurPool:  newBlurBufferPool(),
+		logger:    config.Logger,
+		onStage:   config.OnStage,
+		metrics:   config.Metrics,
+
+		tileSize:       config.TileSize,
+		tileOverlap:    tileOverlap,
+		upsampling:     config.Upsampling,
+		antialiasWidth: config.AntialiasWidth,
+		refine:         config.Refine,
+		shadow:         config.Shadow,
+		preProcessors:  preProcessors,
+		postProcessors: config.PostProcessors,
+	}
+	r.logModelLoaded(m, config, config.ModelPath, time.Since(loadStart))
 
-// NewRemBG initializes ONNX session
-func New(config *Config) (*RemBG, error) {
-	initOnce.Do(initializeEnv)
+	if config.PoolOutputs {
+		r.outputs = newImagePool()
+	}
+	if config.CollectStats {
+		r.stats = newStatsCollector()
+	}
 
-	session, err := createSession(config)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create ONNX session: %w", err)
+	if config.MaskCacheSize > 0 {
+		r.cache = newMaskCache(config.MaskCacheSize)
+		r.cache.distance = config.MaskCacheDistance
 	}
 
-	return &RemBG{
-		modelPath:  config.ModelPath,
-		session:    session,
-		tensorPool: newTensorPool(),
-		blurPool:   newBlurBufferPool(),
-	}, nil
+	if config.ModelRouting != nil {
+		loadStart = time.Now()
+		r.portrait, r.detector, err = newPortraitModel(config)
+		if err != nil {
+			_ = m.close()
+			return nil, err
+		}
+		r.logModelLoaded(r.portrait, config, config.ModelRouting.PortraitModelPath, time.Since(loadStart))
+	}
+
+	r.log(slog.LevelDebug, "engine configured",
+		slog.Int("tile_size", r.tileSize),
+		slog.Int("tile_overlap", r.tileOverlap),
+		slog.String("upsampling", r.upsampling.String()),
+		slog.Bool("letterbox", config.Letterbox),
+		slog.Any("target_classes", config.TargetClasses),
+		slog.Float64("max_megapixels", config.MaxMegapixels),
+		slog.String("resolution_policy", config.ResolutionPolicy.String()),
+		slog.Any("scales", config.Scales),
+		slog.Bool("flip_tta", config.FlipTTA),
+		slog.Int("ensemble", len(config.Ensemble)),
+		slog.Bool("refine", r.refine),
+		slog.Bool("shadow", r.shadow != nil),
+		slog.Bool("denoise", config.Denoise != nil),
+		slog.String("exposure", config.Exposure.String()),
+		slog.Int("pre_processors", len(r.preProcessors)),
+		slog.Int("post_processors", len(r.postProcessors)),
+		slog.Int("mask_cache", config.MaskCacheSize),
+		slog.Int("mask_cache_distance", config.MaskCacheDistance),
+		slog.Bool("pool_outputs", config.PoolOutputs),
+		slog.Bool("deterministic", config.Deterministic),
+	)
+	return r, nil
 }
 
-// Close destroys the session and releases resources
+// logModelLoaded reports the creation of the sessions of m
+func (r *RemBG) logModelLoaded(m *model, config *Config, path string, d time.Duration) {
+	r.log(slog.LevelInfo, "model loaded",
+		slog.String("model", m.spec.Name),
+		slog.String("path", path),
+		slog.Int("sessions", m.sessions.size()),
+		slog.String("provider", config.Provider.String()),
+		slog.Int("input_size", m.spec.InputSize),
+		slog.Duration("duration", d),
+	)
+}
+
+// Close waits for running inferences and destroys the sessions. Calls made
+// after Close return ErrClosed, and later calls to Close do nothing. The
+// ONNX Runtime environment stays loaded for other engines; see Shutdown.
 func (r *RemBG) Close() error {
-	if r.session != nil {
-		return r.session.Destroy()
+	if !r.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+	r.log(slog.LevelInfo, "engine closed")
+	var errs []error
+	if r.portrait != nil {
+		errs = append(errs, r.portrait.close())
+	}
+	if m := r.currentModel(); m != nil {
+		errs = append(errs, m.close())
+	}
+	return errors.Join(errs...)
+}
+
+// Result is the output of Process
+type Result struct {
+	// Image is the source composited over a white background: an
+	// *image.RGBA, or an *image.RGBA64 for 16-bit sources
+	Image image.Image
+	// Mask is the object mask at the source resolution
+	Mask *image.Gray
+	// Confidence estimates how reliable the segmentation is
+	Confidence Confidence
+	// Cropped is the smart crop of Image (set by RemoveAndCrop)
+	Cropped image.Image
+	// Bounds describes the object and crop rectangles (set by RemoveAndCrop)
+	Bounds *CropBounds
+	// Object describes the geometry of the object (set by RemoveAndCrop)
+	Object *ObjectInfo
+	// Stats breaks down the time spent in each stage (set when Config.CollectStats is on)
+	Stats *Stats
+	// Downscale is set when the image exceeded Config.MaxMegapixels and was
+	// processed at a lower resolution
+	Downscale *Downscale
+
+	// source is the image the post-processors changed, which outputs are
+	// rendered from instead of the input
+	source image.Image
+	pool   *imagePool
+}
+
+// Release returns the buffers of Image and Mask to the engine's pool when
+// Config.PoolOutputs is set. The result must not be used afterwards. Calling
+// Release on an unpooled result only clears it.
+func (res *Result) Release() {
+	if img, ok := res.Image.(*image.RGBA); ok {
+		res.pool.putPix(img.Pix)
+	}
+	if res.Mask != nil {
+		res.pool.putPix(res.Mask.Pix)
+	}
+	res.Image, res.Mask, res.source, res.pool = nil, nil, nil, nil
+}
+
+// sourceOf returns the image outputs of res are rendered from: img, the input
+// of res, unless post-processors changed it
+func (res *Result) sourceOf(img image.Image) image.Image {
+	if res.source != nil {
+		return res.source
 	}
-	return ort.DestroyEnvironment()
+	return img
 }
 
 // RemoveBackground processes image with memory pooling
 func (r *RemBG) RemoveBackground(img image.Image) (image.Image, error) {
-	maskImg, err := r.predictMask(img)
+	res, err := r.Process(img)
 	if err != nil {
 		return nil, err
 	}
+	return res.Image, nil
+}
 
-	bounds := img.Bounds()
-	resizedMask := r.resizeGrayBlur5O(maskImg, bounds.Dx(), bounds.Dy())
-
-	output := image.NewRGBA(bounds)
-	blendParallel(output, img, resizedMask)
-
-	return output, nil
+// Process removes the background and returns the output together with the
+// full-resolution mask and a confidence estimate
+func (r *RemBG) Process(img image.Image) (*Result, error) {
+	img, ds := r.limitOutput(img)
+	res, _, err := r.process(img)
+	if err != nil {
+		return nil, err
+	}
+	if ds != nil {
+		res.Downscale = ds
+	}
+	return res, nil
 }
 
-func (r *RemBG) predictMask(img image.Image) (*image.Gray, error) {
-	inputTensor := r.tensorPool.getInput()
-	outputTensor := r.tensorPool.getOutput()
-	defer func() {
-		r.tensorPool.putInput(inputTensor)
-		r.tensorPool.putOutput(outputTensor)
-	}()
-
-	resized := imaging.Resize(img, inputSize, inputSize, imaging.Linear)
-	nrgba := imaging.Clone(resized)
-	pix := nrgba.Pix
-	stride := nrgba.Stride
-
-	inputData := inputTensor.GetData()
-	for y := range inputSize {
-		row := pix[y*stride : y*stride+inputSize*4]
-		for x := range inputSize {
-			base := x * 4
-			r := (float32(row[base+0])/255.0 - mean[0]) / std[0]
-			g := (float32(row[base+1])/255.0 - mean[1]) / std[1]
-			b := (float32(row[base+2])/255.0 - mean[2]) / std[2]
-			inputData[(0*inputSize+y)*inputSize+x] = r
-			inputData[(1*inputSize+y)*inputSize+x] = g
-			inputData[(2*inputSize+y)*inputSize+x] = b
+// RemoveAndCrop runs inference once and returns both the background-removed
+// image and its smart crop, reusing the same mask for compositing and bounds
+func (r *RemBG) RemoveAndCrop(img image.Image, config *CropConfig) (*Result, error) {
+	if config == nil {
+		config = &CropConfig{
+			Margin:       10,
+			MinThreshold: 10,
 		}
 	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	img, ds := r.limitOutput(img)
+	res, pred, err := r.process(img)
+	if err != nil {
+		return nil, err
+	}
+	if ds != nil {
+		res.Downscale = ds
+	}
+	if err := cropResult(res, img, pred.mask, config); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
 
-	err := r.RunInference([]ort.Value{inputTensor}, []ort.Value{outputTensor})
+// cropResult sets the crop fields of res from the model mask of img
+func cropResult(res *Result, img image.Image, mask *image.Gray, config *CropConfig) error {
+	var err error
+	res.Bounds, mask, config, err = fallbackBounds(img, mask, config)
 	if err != nil {
-		return nil, fmt.Errorf("inference failed: %w", err)
+		return err
 	}
+	res.Object, err = MeasureObject(img.Bounds(), mask, config.MinThreshold)
+	if err != nil {
+		return err
+	}
+	res.Cropped = applyCrop(res.Image, res.Bounds.Crop, config)
+	return nil
+}
+
+func (r *RemBG) process(img image.Image) (*Result, *prediction, error) {
+	return r.processAs(img, img)
+}
 
-	data := outputTensor.GetData()
-	maskImg := image.NewGray(image.Rect(0, 0, inputSize, inputSize))
-	threshold := otsuThreshold(data)
+// processAs is process with the model run on infer, a color-converted copy of
+// img
+func (r *RemBG) processAs(img, infer image.Image) (*Result, *prediction, error) {
+	start := r.stats.begin()
+	pred, err := r.predict(infer)
+	if err != nil {
+		return nil, nil, err
+	}
+	res, err := r.compose(img, pred, start)
+	if err != nil {
+		return nil, nil, err
+	}
+	return res, pred, nil
+}
 
-	for i, v := range data {
-		s := 1.0 / (1.0 + float32(math.Exp(float64(-v))))
-		val := uint8(0)
-		if s > threshold {
-			val = 255
+// compose upsamples the mask of pred, runs the post-processors and blends img
+// over white
+func (r *RemBG) compose(img image.Image, pred *prediction, start *callStart) (*Result, error) {
+	t0 := time.Now()
+	resizedMask := r.upsampleMask(pred.mask, img)
+	if r.shadow != nil {
+		preserveShadow(resizedMask, img, r.shadow)
+	}
+	var source image.Image
+	if len(r.postProcessors) > 0 {
+		processed, err := r.postProcess(img, resizedMask)
+		if err != nil {
+			r.outputs.putPix(resizedMask.Pix)
+			return nil, r.countError(ErrorKindOther, err)
 		}
-		maskImg.SetGray(i%inputSize, i/inputSize, color.Gray{Y: val})
+		img, source = processed, processed
 	}
 
-	return maskImg, nil
+	t1 := time.Now()
+	r.stage(StageUpsample, t1.Sub(t0))
+	var output image.Image
+	if deep, ok := deepImage(img); ok {
+		output = blend16(deep, resizedMask)
+	} else {
+		rgba := r.outputs.rgba(img.Bounds())
+		blendParallel(rgba, img, resizedMask)
+		output = rgba
+	}
+	r.stage(StageBlend, time.Since(t1))
+
+	res := &Result{
+		Image:      output,
+		Mask:       resizedMask,
+		Confidence: pred.confidence,
+		Downscale:  pred.downscale,
+		source:     source,
+		pool:       r.outputs,
+	}
+	res.Stats = r.stats.finish(start, Stats{
+		Preprocess:  pred.timing.preprocess,
+		Inference:   pred.timing.inference,
+		Postprocess: pred.timing.decode + time.Since(t1),
+		Upsample:    t1.Sub(t0),
+	})
+	r.log(slog.LevelDebug, "image processed",
+		slog.String("model", pred.model),
+		slog.Int("width", img.Bounds().Dx()),
+		slog.Int("height", img.Bounds().Dy()),
+		slog.Float64("confidence", pred.confidence.Score),
+		slog.Duration("preprocess", pred.timing.preprocess),
+		slog.Duration("inference", pred.timing.inference),
+		slog.Duration("decode", pred.timing.decode),
+		slog.Duration("upsample", t1.Sub(t0)),
+		slog.Duration("blend", time.Since(t1)),
+	)
+	return res, nil
 }
 
-func blendParallel(dst *image.RGBA, src image.Image, mask *image.Gray) {
-	bounds := src.Bounds()
-	numCPU := runtime.NumCPU()
-	var wg sync.WaitGroup
-	chunk := (bounds.Dy() + numCPU - 1) / numCPU
-
-	for i := range runtime.NumCPU() {
-		startY := i * chunk
-		endY := min(startY+chunk, bounds.Dy())
-		if startY >= endY {
-			continue
+func (r *RemBG) predict(img image.Image) (*prediction, error) {
+	r.observeImage(img)
+	infer, downscale, err := r.limitInference(img)
+	if err != nil {
+		return nil, r.countError("", err)
+	}
+	m, err := r.selectModel(infer)
+	if err != nil {
+		return nil, r.countError("", err)
+	}
+	defer m.release()
+	run := m.predict
+	if r.useTiles(infer) {
+		run = func(img image.Image) (*prediction, error) {
+			return r.predictTiled(m, img)
 		}
-
-		wg.Go(func() {
-			for y := startY; y < endY; y++ {
-				for x := bounds.Min.X; x < bounds.Max.X; x++ {
-					rv, gv, bv, _ := src.At(x, y).RGBA()
-					alpha := float64(mask.GrayAt(x, y).Y) / 255.0
-					rOut := uint8(alpha*float64(rv>>8) + (1-alpha)*255)
-					gOut := uint8(alpha*float64(gv>>8) + (1-alpha)*255)
-					bOut := uint8(alpha*float64(bv>>8) + (1-alpha)*255)
-					dst.SetRGBA(x, y, color.RGBA{R: rOut, G: gOut, B: bOut, A: 255})
-				}
+	}
+	if r.refine {
+		coarse := run
+		run = func(img image.Image) (*prediction, error) {
+			pred, err := coarse(img)
+			if err != nil {
+				return nil, err
+			}
+			return r.refinePrediction(m, img, pred)
+		}
+	}
+	if len(r.preProcessors) > 0 {
+		raw := run
+		run = func(img image.Image) (*prediction, error) {
+			src, d, err := r.preProcessed(img)
+			if err != nil {
+				return nil, err
+			}
+			pred, err := raw(src)
+			if err != nil {
+				return nil, err
+			}
+			pred.timing.preprocess += d
+			return pred, nil
+		}
+	}
+	if r.onStage != nil || r.metrics != nil {
+		timed := run
+		run = func(img image.Image) (*prediction, error) {
+			pred, err := timed(img)
+			if err != nil {
+				return nil, err
 			}
-		})
+			r.stage(StagePreprocess, pred.timing.preprocess)
+			r.stage(StageInference, pred.timing.inference)
+			return pred, nil
+		}
+	}
+	if r.cache == nil {
+		pred, err := run(infer)
+		if err != nil {
+			return nil, r.countError("", err)
+		}
+		pred.downscale = downscale
+		return pred, nil
+	}
+
+	// Keyed by the input, so a shrunk copy never stands for another image
+	pred, key, near, ok := r.cachedPrediction(img, m)
+	if ok {
+		if downscale != nil {
+			hit := *pred
+			hit.downscale = downscale
+			return &hit, nil
+		}
+		return pred, nil
+	}
+	pred, err = run(infer)
+	if err != nil {
+		return nil, r.countError("", err)
+	}
+	pred.downscale = downscale
+	r.cachePrediction(key, near, pred)
+	return pred, nil
+}
+
+// cachedPrediction looks up the cached prediction of m for img, or for a
+// near-duplicate of it with Config.MaskCacheDistance. On a miss, it returns
+// the keys to store the prediction under with cachePrediction.
+func (r *RemBG) cachedPrediction(img image.Image, m *model) (*prediction, uint64, *nearKey, bool) {
+	key := hashImage(img, m.cacheSalt())
+	if pred, ok := r.cache.get(key); ok {
+		r.log(slog.LevelDebug, "mask cache hit", slog.String("model", m.spec.Name))
+		return pred, key, nil, true
+	}
+	if r.cache.distance == 0 {
+		return nil, key, nil, false
+	}
+	near := nearKeyOf(img, m.cacheSalt())
+	if pred, ok := r.cache.getNear(near); ok {
+		r.log(slog.LevelDebug, "mask cache near-duplicate hit", slog.String("model", m.spec.Name))
+		return pred, key, near, true
+	}
+	return nil, key, near, false
+}
+
+// cachePrediction caches a copy of pred under the keys of cachedPrediction
+func (r *RemBG) cachePrediction(key uint64, near *nearKey, pred *prediction) {
+	// No stage runs for a cached mask, so hits report zero timing
+	cached := *pred
+	cached.timing = stageTimes{}
+	r.cache.putNear(key, near, &cached)
+}
+
+// preProcessed returns img run through the pre-processors, and the time they
+// took
+func (r *RemBG) preProcessed(img image.Image) (image.Image, time.Duration, error) {
+	if len(r.preProcessors) == 0 {
+		return img, 0, nil
 	}
+	t0 := time.Now()
+	src, err := r.preProcess(img)
+	if err != nil {
+		return nil, 0, err
+	}
+	return src, time.Since(t0), nil
+}
 
-	wg.Wait()
+func (r *RemBG) predictMask(img image.Image) (*image.Gray, error) {
+	pred, err := r.predict(img)
+	if err != nil {
+		return nil, err
+	}
+	return pred.mask, nil
 }
 
 func (r *RemBG) resizeGrayBlur5O(src *image.Gray, newW, newH int) *image.Gray {
-	srcB := src.Bounds()
 	dst := image.NewGray(image.Rect(0, 0, newW, newH))
+	r.resizeGrayBlur5OInto(dst, src)
+	return dst
+}
+
+// resizeGrayBlur5OInto is resizeGrayBlur5O writing to a zero-based dst, whose
+// size is the target size
+func (r *RemBG) resizeGrayBlur5OInto(dst, src *image.Gray) {
+	srcB := src.Bounds()
+	newW, newH := dst.Bounds().Dx(), dst.Bounds().Dy()
 
 	xRatio := float64(srcB.Dx()) / float64(newW)
 	yRatio := float64(srcB.Dy()) / float64(newH)
@@ -301,15 +762,6 @@ func (r *RemBG) resizeGrayBlur5O(src *image.Gray, newW, newH int) *image.Gray {
 			dst.SetGray(x, y, color.Gray{Y: uint8(sum / window)})
 		}
 	}
-
-	return dst
-}
-
-func (r *RemBG) RunInference(input []ort.Value, output []ort.Value) error {
-	r.sessionMu.Lock()
-	err := r.session.Run(input, output)
-	r.sessionMu.Unlock()
-	return err
 }
 
 func clamp(v, min, max int) int {
@@ -321,42 +773,3 @@ func clamp(v, min, max int) int {
 	}
 	return v
 }
-
-func otsuThreshold(data []float32) float32 {
-	hist := make([]int, 256)
-	for _, v := range data {
-		s := sigmoidLUT[int((v+6.0)/12.0*255.0)]
-		val := int(s * 255.0)
-		val = max(val, 0)
-		val = min(val, 255)
-		hist[val]++
-	}
-
-	total := len(data)
-	sum := 0
-	for t := range 255 {
-		sum += t * hist[t]
-	}
-
-	sumB, wB, wF, varMax, threshold := 0, 0, 0, 0.0, 0
-	for t := range 255 {
-		wB += hist[t]
-		if wB == 0 {
-			continue
-		}
-		wF = total - wB
-		if wF == 0 {
-			break
-		}
-		sumB += t * hist[t]
-		mB := float64(sumB) / float64(wB)
-		mF := float64(sum-sumB) / float64(wF)
-		varBetween := float64(wB) * float64(wF) * (mB - mF) * (mB - mF)
-		if varBetween > varMax {
-			varMax = varBetween
-			threshold = t
-		}
-	}
-
-	return float32(threshold) / 255.0
-}
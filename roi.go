@@ -0,0 +1,101 @@
+package rmbg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// ProcessROI runs segmentation on roi only, e.g. a product region found by
+// another detector, so the model resolution is not wasted on the rest of the
+// image. The result has the size of img; everything outside roi is background.
+func (r *RemBG) ProcessROI(img image.Image, roi image.Rectangle) (*Result, error) {
+	bounds := img.Bounds()
+	roi, err := clipROI(bounds, roi)
+	if err != nil {
+		return nil, err
+	}
+
+	res, _, err := r.process(imaging.Crop(img, roi))
+	if err != nil {
+		return nil, err
+	}
+
+	offset := roi.Min.Sub(bounds.Min)
+	output := r.outputs.rgba(bounds)
+	draw.Draw(output, bounds, image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(output, roi, res.Image, res.Image.Bounds().Min, draw.Src)
+
+	mask := r.outputs.gray(bounds.Dx(), bounds.Dy())
+	clear(mask.Pix)
+	draw.Draw(mask, res.Mask.Bounds().Add(offset), res.Mask, res.Mask.Bounds().Min, draw.Src)
+
+	// The region-sized buffers are no longer needed
+	confidence, stats := res.Confidence, res.Stats
+	res.Release()
+	return &Result{
+		Image:      output,
+		Mask:       mask,
+		Confidence: confidence,
+		Stats:      stats,
+		pool:       r.outputs,
+	}, nil
+}
+
+// SmartCropROI runs segmentation on roi only and crops the full image around
+// the detected object. The margin may extend past roi.
+func (r *RemBG) SmartCropROI(img image.Image, roi image.Rectangle, config *CropConfig) (image.Image, error) {
+	if config == nil {
+		config = &CropConfig{
+			Margin:       10,
+			MinThreshold: 10,
+		}
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	roi, err := clipROI(bounds, roi)
+	if err != nil {
+		return nil, err
+	}
+
+	maskImg, err := r.predictMask(imaging.Crop(img, roi))
+	if err != nil {
+		return nil, err
+	}
+	full := embedMask(maskImg, roi.Sub(bounds.Min), bounds.Size())
+	fullB := full.Bounds()
+	return crop(img, full, config,
+		float64(bounds.Dx())/float64(fullB.Dx()),
+		float64(bounds.Dy())/float64(fullB.Dy()))
+}
+
+// clipROI restricts roi to bounds and rejects empty regions
+func clipROI(bounds, roi image.Rectangle) (image.Rectangle, error) {
+	clipped := roi.Intersect(bounds)
+	if clipped.Empty() {
+		return image.Rectangle{}, fmt.Errorf("region of interest %v does not overlap image %v", roi, bounds)
+	}
+	return clipped, nil
+}
+
+// embedMask places a mask computed for roi into an empty mask covering an image
+// of the given size, keeping the resolution of the roi mask
+func embedMask(mask *image.Gray, roi image.Rectangle, size image.Point) *image.Gray {
+	mb := mask.Bounds()
+	sx := float64(mb.Dx()) / float64(roi.Dx())
+	sy := float64(mb.Dy()) / float64(roi.Dy())
+
+	full := image.NewGray(image.Rect(0, 0,
+		max(1, int(math.Round(float64(size.X)*sx))),
+		max(1, int(math.Round(float64(size.Y)*sy)))))
+	at := image.Pt(int(math.Round(float64(roi.Min.X)*sx)), int(math.Round(float64(roi.Min.Y)*sy)))
+	draw.Draw(full, mb.Sub(mb.Min).Add(at), mask, mb.Min, draw.Src)
+	return full
+}
@@ -0,0 +1,49 @@
+package rmbg
+
+import (
+	"image"
+	"testing"
+)
+
+func TestClipROI(t *testing.T) {
+	bounds := image.Rect(0, 0, 100, 100)
+
+	got, err := clipROI(bounds, image.Rect(50, -10, 150, 40))
+	if err != nil {
+		t.Fatalf("clipROI failed: %v", err)
+	}
+	if want := image.Rect(50, 0, 100, 40); got != want {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	if _, err := clipROI(bounds, image.Rect(200, 200, 300, 300)); err == nil {
+		t.Error("expected error for region outside the image")
+	}
+}
+
+func TestEmbedMask(t *testing.T) {
+	// A 320x320 model mask for a 1000x1000 ROI at (2000, 1000) of a 4000x3000 image
+	mask := image.NewGray(image.Rect(0, 0, 320, 320))
+	fillRect(mask, image.Rect(100, 100, 220, 220), 255)
+	roi := image.Rect(2000, 1000, 3000, 2000)
+
+	full := embedMask(mask, roi, image.Pt(4000, 3000))
+	if want := image.Rect(0, 0, 1280, 960); full.Bounds() != want {
+		t.Fatalf("expected bounds %v, got %v", want, full.Bounds())
+	}
+
+	// Crop the full image around the embedded object and map it back
+	config := &CropConfig{MinThreshold: 10}
+	reg, err := cropRegion(image.Rect(0, 0, 4000, 3000), full, config, 4000.0/1280, 3000.0/960)
+	if err != nil {
+		t.Fatalf("cropRegion failed: %v", err)
+	}
+	// Object spans ROI pixels [312.5, 687.5) in both axes
+	want := image.Rect(2312, 1312, 2687, 1687)
+	if d := reg.object.Min.Sub(want.Min); abs(d.X) > 4 || abs(d.Y) > 4 {
+		t.Errorf("expected object near %v, got %v", want, reg.object)
+	}
+	if d := reg.object.Max.Sub(want.Max); abs(d.X) > 4 || abs(d.Y) > 4 {
+		t.Errorf("expected object near %v, got %v", want, reg.object)
+	}
+}
@@ -0,0 +1,139 @@
+package rmbg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"log/slog"
+
+	"github.com/disintegration/imaging"
+)
+
+// PersonDetector decides whether an image shows a person
+type PersonDetector interface {
+	DetectPerson(img image.Image) (bool, error)
+}
+
+// PersonDetectorFunc adapts a function to the PersonDetector interface
+type PersonDetectorFunc func(img image.Image) (bool, error)
+
+// DetectPerson calls f(img)
+func (f PersonDetectorFunc) DetectPerson(img image.Image) (bool, error) {
+	return f(img)
+}
+
+// ModelRouting sends portraits to a human segmentation model and everything
+// else to the main model
+type ModelRouting struct {
+	// PortraitModelPath is the path to the model used when a person is detected
+	PortraitModelPath string
+	// PortraitModel describes the portrait model (default: ModelU2NetHumanSeg)
+	PortraitModel *ModelSpec
+	// Detector decides whether an image is a portrait (default: SkinToneDetector)
+	Detector PersonDetector
+}
+
+const (
+	// DefaultMinSkinCoverage is SkinToneDetector.MinCoverage when unset
+	DefaultMinSkinCoverage = 0.08
+	// DefaultMaxSkinCoverage is SkinToneDetector.MaxCoverage when unset
+	DefaultMaxSkinCoverage = 0.6
+)
+
+// SkinToneDetector is a lightweight heuristic that flags images whose central
+// region contains enough, but not too many, skin-colored pixels. It only
+// looks at color: beige, wood, leather, tan or orange products match the skin
+// chrominance box as well as faces do. A frame filled with such a color is
+// taken for a product, but a skin-toned object on another background is still
+// routed as a portrait, and people with skin tones outside the box, or lit by
+// colored light, may be missed. Tune the coverage bounds on your own images,
+// or use a real person detector where routing matters.
+type SkinToneDetector struct {
+	// MinCoverage is the fraction of skin pixels in the central region needed
+	// to report a person (default: DefaultMinSkinCoverage)
+	MinCoverage float64
+	// MaxCoverage is the fraction of skin pixels above which the region is
+	// taken for a skin-toned product or backdrop rather than a person
+	// (default: DefaultMaxSkinCoverage; 1 or more disables the bound)
+	MaxCoverage float64
+}
+
+const skinSampleSize = 64
+
+// DetectPerson implements PersonDetector
+func (d SkinToneDetector) DetectPerson(img image.Image) (bool, error) {
+	minCoverage := d.MinCoverage
+	if minCoverage <= 0 {
+		minCoverage = DefaultMinSkinCoverage
+	}
+	maxCoverage := d.MaxCoverage
+	if maxCoverage <= 0 {
+		maxCoverage = DefaultMaxSkinCoverage
+	}
+
+	small := imaging.Resize(img, skinSampleSize, skinSampleSize, imaging.Box)
+
+	// Only the central 60% of the frame is considered, where subjects usually are
+	margin := skinSampleSize / 5
+	total, skin := 0, 0
+	for y := margin; y < skinSampleSize-margin; y++ {
+		row := small.Pix[y*small.Stride:]
+		for x := margin; x < skinSampleSize-margin; x++ {
+			i := x * 4
+			total++
+			if isSkin(row[i], row[i+1], row[i+2]) {
+				skin++
+			}
+		}
+	}
+
+	coverage := float64(skin) / float64(total)
+	return coverage >= minCoverage && (maxCoverage >= 1 || coverage <= maxCoverage), nil
+}
+
+// isSkin uses the classic YCbCr skin chrominance box
+func isSkin(r, g, b uint8) bool {
+	y, cb, cr := color.RGBToYCbCr(r, g, b)
+	return y > 40 && cb >= 77 && cb <= 127 && cr >= 133 && cr <= 173
+}
+
+func newPortraitModel(config *Config) (*model, PersonDetector, error) {
+	routing := config.ModelRouting
+	spec := ModelU2NetHumanSeg
+	if routing.PortraitModel != nil {
+		spec = *routing.PortraitModel
+	}
+
+	detector := routing.Detector
+	if detector == nil {
+		detector = SkinToneDetector{}
+	}
+
+	m, err := newModel(config, routing.PortraitModelPath, spec)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load portrait model: %w", err)
+	}
+	return m, detector, nil
+}
+
+// selectModel returns the model that should segment img. The caller must
+// release it when done.
+func (r *RemBG) selectModel(img image.Image) (*model, error) {
+	if r.portrait == nil {
+		return r.acquireModel(), nil
+	}
+
+	person, err := r.detector.DetectPerson(img)
+	if err != nil {
+		return nil, fmt.Errorf("person detection failed: %w", err)
+	}
+	var m *model
+	if person {
+		m = r.portrait
+		m.users.Add(1)
+	} else {
+		m = r.acquireModel()
+	}
+	r.log(slog.LevelDebug, "model routed", slog.Bool("person", person), slog.String("model", m.spec.Name))
+	return m, nil
+}
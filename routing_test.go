@@ -0,0 +1,93 @@
+package rmbg
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestSkinToneDetector(t *testing.T) {
+	fill := func(c color.RGBA) *image.RGBA {
+		img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+		for y := range 100 {
+			for x := range 100 {
+				img.SetRGBA(x, y, c)
+			}
+		}
+		return img
+	}
+
+	t.Run("Skin", func(t *testing.T) {
+		// A face on a dark background
+		img := fill(color.RGBA{40, 40, 50, 255})
+		for y := 30; y < 70; y++ {
+			for x := 35; x < 65; x++ {
+				img.SetRGBA(x, y, color.RGBA{224, 172, 140, 255})
+			}
+		}
+		person, err := SkinToneDetector{}.DetectPerson(img)
+		if err != nil {
+			t.Fatalf("DetectPerson failed: %v", err)
+		}
+		if !person {
+			t.Errorf("expected a face to be detected as a person")
+		}
+	})
+
+	t.Run("Product", func(t *testing.T) {
+		img := fill(color.RGBA{30, 90, 200, 255})
+		person, _ := SkinToneDetector{}.DetectPerson(img)
+		if person {
+			t.Errorf("expected blue image not to be detected as a person")
+		}
+	})
+
+	t.Run("SkinTonedProduct", func(t *testing.T) {
+		// A close-up of a beige leather bag is skin-colored throughout
+		img := fill(color.RGBA{225, 198, 160, 255})
+		person, err := SkinToneDetector{}.DetectPerson(img)
+		if err != nil {
+			t.Fatalf("DetectPerson failed: %v", err)
+		}
+		if person {
+			t.Errorf("expected a beige product not to be detected as a person")
+		}
+		if person, _ := (SkinToneDetector{MaxCoverage: 1}).DetectPerson(img); !person {
+			t.Errorf("expected no upper bound with MaxCoverage 1")
+		}
+	})
+}
+
+func TestSelectModel(t *testing.T) {
+	general := &model{spec: ModelU2NetP}
+	portrait := &model{spec: ModelU2NetHumanSeg}
+	img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+
+	t.Run("NoRouting", func(t *testing.T) {
+		r := &RemBG{model: general}
+		m, err := r.selectModel(img)
+		if err != nil || m != general {
+			t.Errorf("expected general model, got %v (%v)", m, err)
+		}
+	})
+
+	t.Run("Portrait", func(t *testing.T) {
+		r := &RemBG{model: general, portrait: portrait, detector: PersonDetectorFunc(func(image.Image) (bool, error) {
+			return true, nil
+		})}
+		m, err := r.selectModel(img)
+		if err != nil || m != portrait {
+			t.Errorf("expected portrait model, got %v (%v)", m, err)
+		}
+	})
+
+	t.Run("DetectorError", func(t *testing.T) {
+		r := &RemBG{model: general, portrait: portrait, detector: PersonDetectorFunc(func(image.Image) (bool, error) {
+			return false, errors.New("boom")
+		})}
+		if _, err := r.selectModel(img); err == nil {
+			t.Errorf("expected detector error to propagate")
+		}
+	})
+}
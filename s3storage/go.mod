@@ -0,0 +1,26 @@
+module github.com/josuedeavila/rmbg/s3storage
+
+go 1.25
+
+require (
+	github.com/aws/aws-sdk-go-v2 v1.41.7
+	github.com/aws/aws-sdk-go-v2/service/s3 v1.96.0
+	github.com/josuedeavila/rmbg v0.0.0-00010101000000-000000000000
+)
+
+require (
+	github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream v1.7.4 // indirect
+	github.com/aws/aws-sdk-go-v2/internal/configsources v1.4.17 // indirect
+	github.com/aws/aws-sdk-go-v2/internal/endpoints/v2 v2.7.17 // indirect
+	github.com/aws/aws-sdk-go-v2/internal/v4a v1.4.17 // indirect
+	github.com/aws/aws-sdk-go-v2/service/internal/accept-encoding v1.13.4 // indirect
+	github.com/aws/aws-sdk-go-v2/service/internal/checksum v1.9.8 // indirect
+	github.com/aws/aws-sdk-go-v2/service/internal/presigned-url v1.13.17 // indirect
+	github.com/aws/aws-sdk-go-v2/service/internal/s3shared v1.19.17 // indirect
+	github.com/aws/smithy-go v1.25.1 // indirect
+	github.com/disintegration/imaging v1.6.2 // indirect
+	github.com/yalue/onnxruntime_go v1.23.0 // indirect
+	golang.org/x/image v0.36.0 // indirect
+)
+
+replace github.com/josuedeavila/rmbg => ../
@@ -0,0 +1,76 @@
+//go:build s3
+
+// Package s3storage implements rmbg.Storage on Amazon S3 with the AWS SDK for
+// Go v2. It is a module of its own, so the core library does not depend on
+// the SDK, and is only built with the s3 tag:
+//
+//	go get github.com/josuedeavila/rmbg/s3storage
+//	go build -tags s3
+package s3storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/josuedeavila/rmbg"
+)
+
+var _ rmbg.Storage = (*Storage)(nil)
+
+// Storage stores objects in one bucket
+type Storage struct {
+	client *s3.Client
+	bucket string
+}
+
+// New creates a storage for bucket
+func New(client *s3.Client, bucket string) *Storage {
+	return &Storage{client: client, bucket: bucket}
+}
+
+// Get implements rmbg.Storage
+func (s *Storage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, fmt.Errorf("%w: s3://%s/%s", rmbg.ErrObjectNotFound, s.bucket, key)
+		}
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+// Put implements rmbg.Storage. Bodies that cannot seek are buffered, since S3
+// needs the content length up front.
+func (s *Storage) Put(ctx context.Context, key string, r io.Reader) error {
+	body, ok := r.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   body,
+	}
+	if ct := mime.TypeByExtension(path.Ext(key)); ct != "" {
+		input.ContentType = aws.String(ct)
+	}
+	_, err := s.client.PutObject(ctx, input)
+	return err
+}
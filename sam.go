@@ -0,0 +1,280 @@
+package rmbg
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sync"
+
+	"github.com/disintegration/imaging"
+)
+
+const (
+	samInputSize   = 1024
+	samMaskInput   = 256
+	samLabelPad    = -1
+	samLabelBack   = 0
+	samLabelFore   = 1
+	samLabelBoxTL  = 2
+	samLabelBoxBR  = 3
+	samEmbedDims   = 256
+	samEmbedLength = 64
+)
+
+var (
+	samMean = [3]float32{123.675, 116.28, 103.53}
+	samStd  = [3]float32{58.395, 57.12, 57.375}
+)
+
+// SAMConfig configures a promptable (Segment Anything / MobileSAM) engine
+type SAMConfig struct {
+	// EncoderPath is the path to the image encoder ONNX model
+	EncoderPath string
+	// DecoderPath is the path to the prompt/mask decoder ONNX model
+	DecoderPath string
+	// IntraOpNumThreads is the number of threads to use for intra-op parallelism
+	IntraOpNumThreads int
+	// InterOpNumThreads is the number of threads to use for inter-op parallelism
+	InterOpNumThreads int
+	// MaskThreshold is the logit above which a pixel belongs to the mask (default: 0)
+	MaskThreshold float32
+	// ORTLibraryPath is the path to the ONNX Runtime shared library, used when
+	// the runtime is not initialized yet (default: see InitOptions.LibraryPath)
+	ORTLibraryPath string
+}
+
+// PromptKind identifies the type of a segmentation prompt
+type PromptKind int
+
+const (
+	// PromptForeground marks a point that belongs to the object
+	PromptForeground PromptKind = iota
+	// PromptBackground marks a point that does not belong to the object
+	PromptBackground
+	// PromptBox is a bounding box around the object
+	PromptBox
+)
+
+// Prompt is a point or box hint, in image coordinates
+type Prompt struct {
+	Kind  PromptKind
+	Point image.Point
+	Box   image.Rectangle
+}
+
+// PointPrompt returns a foreground or background point prompt
+func PointPrompt(p image.Point, foreground bool) Prompt {
+	if foreground {
+		return Prompt{Kind: PromptForeground, Point: p}
+	}
+	return Prompt{Kind: PromptBackground, Point: p}
+}
+
+// BoxPrompt returns a box prompt
+func BoxPrompt(r image.Rectangle) Prompt {
+	return Prompt{Kind: PromptBox, Box: r}
+}
+
+// SAM runs a two-stage promptable segmentation model. The image encoder runs
+// once per image; the lightweight decoder runs once per set of prompts.
+type SAM struct {
+	sessions  *samSessions
+	encoderMu sync.Mutex
+	decoderMu sync.Mutex
+	threshold float32
+	// closed is guarded by both mutexes
+	closed bool
+}
+
+// SAMEmbedding holds the encoder output for one image so several prompt sets
+// can be decoded without re-running the encoder
+type SAMEmbedding struct {
+	data   []float32
+	bounds image.Rectangle
+	scale  float64
+}
+
+// SAMResult is the mask selected by the decoder for a set of prompts
+type SAMResult struct {
+	// Mask is a binary mask with the bounds of the source image
+	Mask *image.Gray
+	// Score is the decoder's predicted IoU for the mask
+	Score float32
+}
+
+// NewSAM loads the encoder and decoder sessions
+func NewSAM(config *SAMConfig) (*SAM, error) {
+	for _, path := range []string{config.EncoderPath, config.DecoderPath} {
+		if err := checkModelFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := acquireEnv(config.ORTLibraryPath); err != nil {
+		return nil, err
+	}
+
+	sessions, err := newSAMSessions(config)
+	if err != nil {
+		releaseEnv()
+		return nil, err
+	}
+	return &SAM{
+		sessions:  sessions,
+		threshold: config.MaskThreshold,
+	}, nil
+}
+
+// Close waits for running calls and destroys both sessions. Calls made after
+// Close return ErrClosed, and later calls to Close do nothing.
+func (s *SAM) Close() error {
+	s.encoderMu.Lock()
+	defer s.encoderMu.Unlock()
+	s.decoderMu.Lock()
+	defer s.decoderMu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	err := s.sessions.destroy()
+	releaseEnv()
+	return err
+}
+
+// Segment encodes img and decodes a mask for the given prompts
+func (s *SAM) Segment(img image.Image, prompts []Prompt) (*SAMResult, error) {
+	embedding, err := s.Encode(img)
+	if err != nil {
+		return nil, err
+	}
+	return s.Decode(embedding, prompts)
+}
+
+// Encode runs the image encoder
+func (s *SAM) Encode(img image.Image) (*SAMEmbedding, error) {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == 0 || h == 0 {
+		return nil, fmt.Errorf("image is empty")
+	}
+
+	// Resize the longest side to the encoder resolution and pad bottom/right
+	scale := float64(samInputSize) / float64(max(w, h))
+	newW := max(1, int(math.Round(float64(w)*scale)))
+	newH := max(1, int(math.Round(float64(h)*scale)))
+	resized := imaging.Resize(img, newW, newH, imaging.Linear)
+
+	plane := samInputSize * samInputSize
+	data := make([]float32, 3*plane)
+	for y := range newH {
+		row := resized.Pix[y*resized.Stride : y*resized.Stride+newW*4]
+		for x := range newW {
+			base := x * 4
+			for c := range 3 {
+				data[c*plane+y*samInputSize+x] = (float32(row[base+c]) - samMean[c]) / samStd[c]
+			}
+		}
+	}
+
+	s.encoderMu.Lock()
+	if s.closed {
+		s.encoderMu.Unlock()
+		return nil, ErrClosed
+	}
+	embedding, err := s.sessions.encode(data)
+	s.encoderMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return &SAMEmbedding{
+		data:   embedding,
+		bounds: bounds,
+		scale:  scale,
+	}, nil
+}
+
+// Decode runs the mask decoder on a previously computed embedding
+func (s *SAM) Decode(embedding *SAMEmbedding, prompts []Prompt) (*SAMResult, error) {
+	if len(prompts) == 0 {
+		return nil, fmt.Errorf("at least one prompt is required")
+	}
+
+	coords, labels := embedding.encodePrompts(prompts)
+	w, h := embedding.bounds.Dx(), embedding.bounds.Dy()
+
+	s.decoderMu.Lock()
+	if s.closed {
+		s.decoderMu.Unlock()
+		return nil, ErrClosed
+	}
+	logits, scoreData, err := s.sessions.decode(embedding.data, coords, labels, w, h)
+	s.decoderMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	// Multi-mask exports return several candidates; keep the best scored one
+	best := 0
+	for i, v := range scoreData {
+		if v > scoreData[best] {
+			best = i
+		}
+	}
+
+	plane := w * h
+	if len(logits) < (best+1)*plane {
+		return nil, fmt.Errorf("unexpected SAM mask size %d for %d candidates of %dx%d", len(logits), len(scoreData), w, h)
+	}
+	logits = logits[best*plane : (best+1)*plane]
+
+	mask := image.NewGray(embedding.bounds)
+	for y := range h {
+		row := mask.Pix[y*mask.Stride : y*mask.Stride+w]
+		for x := range w {
+			if logits[y*w+x] > s.threshold {
+				row[x] = 255
+			}
+		}
+	}
+
+	var score float32
+	if len(scoreData) > 0 {
+		score = scoreData[best]
+	}
+	return &SAMResult{Mask: mask, Score: score}, nil
+}
+
+// encodePrompts converts prompts to decoder point coordinates and labels.
+// Boxes become two corner points; a padding point is appended when no box is
+// given, as expected by the exported decoder.
+func (e *SAMEmbedding) encodePrompts(prompts []Prompt) ([]float32, []float32) {
+	var coords, labels []float32
+	hasBox := false
+
+	add := func(p image.Point, label float32) {
+		x := float64(p.X-e.bounds.Min.X) * e.scale
+		y := float64(p.Y-e.bounds.Min.Y) * e.scale
+		coords = append(coords, float32(x), float32(y))
+		labels = append(labels, label)
+	}
+
+	for _, p := range prompts {
+		switch p.Kind {
+		case PromptForeground:
+			add(p.Point, samLabelFore)
+		case PromptBackground:
+			add(p.Point, samLabelBack)
+		case PromptBox:
+			hasBox = true
+			add(p.Box.Min, samLabelBoxTL)
+			add(p.Box.Max, samLabelBoxBR)
+		}
+	}
+	if !hasBox {
+		coords = append(coords, 0, 0)
+		labels = append(labels, samLabelPad)
+	}
+
+	return coords, labels
+}
@@ -0,0 +1,24 @@
+//go:build !cgo
+
+package rmbg
+
+import "fmt"
+
+// samSessions is empty without cgo: NewSAM fails to acquire the environment
+type samSessions struct{}
+
+func newSAMSessions(*SAMConfig) (*samSessions, error) {
+	return nil, fmt.Errorf("%w: %w", ErrRuntimeUnavailable, errNoCgo)
+}
+
+func (s *samSessions) encode([]float32) ([]float32, error) {
+	return nil, ErrRuntimeUnavailable
+}
+
+func (s *samSessions) decode(_, _, _ []float32, _, _ int) (logits, scores []float32, err error) {
+	return nil, nil, ErrRuntimeUnavailable
+}
+
+func (s *samSessions) destroy() error {
+	return nil
+}
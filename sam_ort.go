@@ -0,0 +1,137 @@
+//go:build cgo
+
+package rmbg
+
+import (
+	"errors"
+	"fmt"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// samSessions are the ONNX Runtime sessions of a SAM model
+type samSessions struct {
+	encoder *ort.DynamicAdvancedSession
+	decoder *ort.DynamicAdvancedSession
+}
+
+// newSAMSessions loads the encoder and decoder. The environment must be
+// acquired.
+func newSAMSessions(config *SAMConfig) (*samSessions, error) {
+	options, err := newSessionOptions(&Config{
+		IntraOpNumThreads: config.IntraOpNumThreads,
+		InterOpNumThreads: config.InterOpNumThreads,
+		MemPattern:        true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = options.Destroy()
+	}()
+
+	encoder, err := ort.NewDynamicAdvancedSession(
+		config.EncoderPath,
+		[]string{"image"},
+		[]string{"image_embeddings"},
+		options,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SAM encoder session: %w", err)
+	}
+
+	decoder, err := ort.NewDynamicAdvancedSession(
+		config.DecoderPath,
+		[]string{"image_embeddings", "point_coords", "point_labels", "mask_input", "has_mask_input", "orig_im_size"},
+		[]string{"masks", "iou_predictions", "low_res_masks"},
+		options,
+	)
+	if err != nil {
+		_ = encoder.Destroy()
+		return nil, fmt.Errorf("failed to create SAM decoder session: %w", err)
+	}
+	return &samSessions{encoder: encoder, decoder: decoder}, nil
+}
+
+// encode runs the encoder on a normalized 1024×1024 image and returns the
+// embedding
+func (s *samSessions) encode(data []float32) ([]float32, error) {
+	input, err := ort.NewTensor(ort.NewShape(1, 3, samInputSize, samInputSize), data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SAM input tensor: %w", err)
+	}
+	defer func() {
+		_ = input.Destroy()
+	}()
+
+	output, err := ort.NewEmptyTensor[float32](ort.NewShape(1, samEmbedDims, samEmbedLength, samEmbedLength))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SAM embedding tensor: %w", err)
+	}
+	defer func() {
+		_ = output.Destroy()
+	}()
+
+	if err := s.encoder.Run([]ort.Value{input}, []ort.Value{output}); err != nil {
+		return nil, &InferenceError{Model: "sam-encoder", Err: err}
+	}
+	return append([]float32(nil), output.GetData()...), nil
+}
+
+// decode runs the decoder on an embedding and encoded prompts for a w×h image
+// and returns the mask logits of every candidate and their scores
+func (s *samSessions) decode(embedding, coords, labels []float32, w, h int) (logits, scores []float32, err error) {
+	n := int64(len(labels))
+	shapes := []ort.Shape{
+		ort.NewShape(1, samEmbedDims, samEmbedLength, samEmbedLength),
+		ort.NewShape(1, n, 2),
+		ort.NewShape(1, n),
+		ort.NewShape(1, 1, samMaskInput, samMaskInput),
+		ort.NewShape(1),
+		ort.NewShape(2),
+	}
+	data := [][]float32{
+		embedding,
+		coords,
+		labels,
+		make([]float32, samMaskInput*samMaskInput),
+		{0},
+		{float32(h), float32(w)},
+	}
+
+	inputs := make([]ort.Value, 0, len(shapes))
+	outputs := []ort.Value{nil, nil, nil}
+	defer func() {
+		for _, v := range append(inputs, outputs...) {
+			if v != nil {
+				_ = v.Destroy()
+			}
+		}
+	}()
+	for i, shape := range shapes {
+		t, err := ort.NewTensor(shape, data[i])
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create SAM decoder input: %w", err)
+		}
+		inputs = append(inputs, t)
+	}
+
+	if err := s.decoder.Run(inputs, outputs); err != nil {
+		return nil, nil, &InferenceError{Model: "sam-decoder", Err: err}
+	}
+
+	masks, ok := outputs[0].(*ort.Tensor[float32])
+	if !ok {
+		return nil, nil, fmt.Errorf("unexpected SAM mask output type")
+	}
+	iou, ok := outputs[1].(*ort.Tensor[float32])
+	if !ok {
+		return nil, nil, fmt.Errorf("unexpected SAM score output type")
+	}
+	// The outputs are destroyed on return
+	return append([]float32(nil), masks.GetData()...), append([]float32(nil), iou.GetData()...), nil
+}
+
+func (s *samSessions) destroy() error {
+	return errors.Join(s.encoder.Destroy(), s.decoder.Destroy())
+}
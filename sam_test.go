@@ -0,0 +1,43 @@
+package rmbg
+
+import (
+	"image"
+	"slices"
+	"testing"
+)
+
+func TestSAMEncodePrompts(t *testing.T) {
+	embedding := &SAMEmbedding{
+		bounds: image.Rect(10, 20, 522, 276),
+		scale:  2.0,
+	}
+
+	t.Run("PointsGetPadding", func(t *testing.T) {
+		coords, labels := embedding.encodePrompts([]Prompt{
+			PointPrompt(image.Pt(20, 30), true),
+			PointPrompt(image.Pt(10, 20), false),
+		})
+		wantCoords := []float32{20, 20, 0, 0, 0, 0}
+		wantLabels := []float32{samLabelFore, samLabelBack, samLabelPad}
+		if !slices.Equal(coords, wantCoords) {
+			t.Errorf("expected coords %v, got %v", wantCoords, coords)
+		}
+		if !slices.Equal(labels, wantLabels) {
+			t.Errorf("expected labels %v, got %v", wantLabels, labels)
+		}
+	})
+
+	t.Run("BoxCorners", func(t *testing.T) {
+		coords, labels := embedding.encodePrompts([]Prompt{
+			BoxPrompt(image.Rect(10, 20, 60, 70)),
+		})
+		wantCoords := []float32{0, 0, 100, 100}
+		wantLabels := []float32{samLabelBoxTL, samLabelBoxBR}
+		if !slices.Equal(coords, wantCoords) {
+			t.Errorf("expected coords %v, got %v", wantCoords, coords)
+		}
+		if !slices.Equal(labels, wantLabels) {
+			t.Errorf("expected labels %v, got %v", wantLabels, labels)
+		}
+	})
+}
@@ -0,0 +1,287 @@
+// Package server exposes an engine over HTTP:
+//
+//	POST /remove   image in, image without background out (PNG with alpha by default)
+//	POST /crop     as /remove, smart cropped around the object
+//	GET  /healthz  200 while the engine can serve requests, 503 otherwise
+//
+// The image is sent as the raw request body or as the "image" field of a
+// multipart form. The query parameters format (png or jpg), bg (transparent,
+// white, black or #rrggbb) and, for /crop, margin (pixels or a percentage like
+// 5%) and square select the output.
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/josuedeavila/rmbg"
+)
+
+const (
+	// DefaultMaxBodyBytes is the request body limit when Config sets none
+	DefaultMaxBodyBytes = 20 << 20
+	// DefaultQueueTimeout is how long a request waits for a free slot when
+	// Config sets no timeout
+	DefaultQueueTimeout = 30 * time.Second
+	// DefaultProcessTimeout is how long an image may take to process when
+	// Config sets no timeout
+	DefaultProcessTimeout = time.Minute
+)
+
+var (
+	// errBusy is returned when no processing slot frees up in time
+	errBusy = errors.New("server busy")
+	// errTimeout is returned when an image takes longer than ProcessTimeout
+	errTimeout = errors.New("processing timed out")
+)
+
+// Config configures a Server
+type Config struct {
+	// MaxBodyBytes rejects larger request bodies with 413 (default:
+	// DefaultMaxBodyBytes)
+	MaxBodyBytes int64
+	// MaxConcurrent is the number of images processed at once; further
+	// requests wait for a slot (default: number of CPUs)
+	MaxConcurrent int
+	// QueueTimeout is how long a request waits for a slot before failing with
+	// 503 (default: DefaultQueueTimeout)
+	QueueTimeout time.Duration
+	// ProcessTimeout is how long an image may take to process once it has a
+	// slot before the request fails with 503 (default: DefaultProcessTimeout).
+	// Inference cannot be interrupted, so the slot stays taken until it ends.
+	ProcessTimeout time.Duration
+	// ReadTimeout and WriteTimeout bound reading the request and writing the
+	// response in ListenAndServe (default: no limit)
+	ReadTimeout, WriteTimeout time.Duration
+	// Decode bounds the decoding of uploads (default: DecodeImage defaults)
+	Decode *rmbg.DecodeOptions
+}
+
+// Server is an http.Handler serving an engine
+type Server struct {
+	engine *rmbg.RemBG
+	config Config
+	slots  chan struct{}
+	mux    *http.ServeMux
+	// remove is engine.RemoveBackgroundFrom, replaced in tests
+	remove func(r io.Reader, w io.Writer, format rmbg.Format, opts *rmbg.IOOptions) error
+}
+
+// New creates a server for engine. The engine is not closed by the server.
+func New(engine *rmbg.RemBG, config *Config) *Server {
+	if config == nil {
+		config = &Config{}
+	}
+	s := &Server{engine: engine, config: *config, remove: engine.RemoveBackgroundFrom}
+	if s.config.MaxBodyBytes <= 0 {
+		s.config.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+	if s.config.MaxConcurrent <= 0 {
+		s.config.MaxConcurrent = runtime.NumCPU()
+	}
+	if s.config.QueueTimeout <= 0 {
+		s.config.QueueTimeout = DefaultQueueTimeout
+	}
+	if s.config.ProcessTimeout <= 0 {
+		s.config.ProcessTimeout = DefaultProcessTimeout
+	}
+	s.slots = make(chan struct{}, s.config.MaxConcurrent)
+
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("POST /remove", s.handleImage(false))
+	s.mux.HandleFunc("POST /crop", s.handleImage(true))
+	s.mux.HandleFunc("GET /healthz", s.handleHealth)
+	return s
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// ListenAndServe serves on addr with the configured timeouts until ctx is
+// canceled, then shuts down gracefully
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	srv := &http.Server{
+		Addr:         addr,
+		Handler:      s,
+		ReadTimeout:  s.config.ReadTimeout,
+		WriteTimeout: s.config.WriteTimeout,
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ListenAndServe() }()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), s.config.QueueTimeout)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
+	}
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, _ *http.Request) {
+	if err := s.engine.Healthy(); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = io.WriteString(w, "ok\n")
+}
+
+func (s *Server) handleImage(crop bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, opts, err := s.outputOptions(r, crop)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, s.config.MaxBodyBytes)
+		body, err := imageBody(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		defer body.Close()
+		// Read the upload before taking a slot, so slow clients do not hold
+		// one
+		data, err := io.ReadAll(body)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		if err := s.acquire(r.Context()); err != nil {
+			writeError(w, err)
+			return
+		}
+		ctx, cancel := context.WithTimeoutCause(r.Context(), s.config.ProcessTimeout, errTimeout)
+		defer cancel()
+		var out bytes.Buffer
+		done := make(chan error, 1)
+		go func() {
+			defer func() { <-s.slots }()
+			done <- s.remove(bytes.NewReader(data), &out, format, opts)
+		}()
+		select {
+		case err = <-done:
+		case <-ctx.Done():
+			err = context.Cause(ctx)
+		}
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", format.MediaType())
+		w.Header().Set("Content-Length", strconv.Itoa(out.Len()))
+		_, _ = out.WriteTo(w)
+	}
+}
+
+// acquire waits for a processing slot
+func (s *Server) acquire(ctx context.Context) error {
+	timer := time.NewTimer(s.config.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return errBusy
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// outputOptions reads the output settings from the query
+func (s *Server) outputOptions(r *http.Request, crop bool) (rmbg.Format, *rmbg.IOOptions, error) {
+	q := r.URL.Query()
+	format := rmbg.FormatPNG
+	if v := q.Get("format"); v != "" {
+		f, err := rmbg.ParseFormat(v)
+		if err != nil {
+			return 0, nil, err
+		}
+		format = f
+	}
+	bg, err := rmbg.ParseColor(q.Get("bg"))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	opts := &rmbg.IOOptions{Decode: s.config.Decode, Background: bg}
+	if crop {
+		config := &rmbg.CropConfig{Margin: 20, MinThreshold: 10}
+		if v := q.Get("margin"); v != "" {
+			if config.Margin, config.MarginPercent, err = rmbg.ParseMargin(v); err != nil {
+				return 0, nil, err
+			}
+		}
+		if v := q.Get("square"); v != "" {
+			if config.SquarePad, err = strconv.ParseBool(v); err != nil {
+				return 0, nil, fmt.Errorf("invalid square %q", v)
+			}
+		}
+		if err := config.Validate(); err != nil {
+			return 0, nil, err
+		}
+		opts.Crop = config
+	}
+	return format, opts, nil
+}
+
+// imageBody returns the uploaded image: the "image" field of a multipart
+// form, or the raw body
+func imageBody(r *http.Request) (io.ReadCloser, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, nil
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", rmbg.ErrInvalidImage, err)
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%w: multipart form has no image field", rmbg.ErrInvalidImage)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "image" {
+			return part, nil
+		}
+		_ = part.Close()
+	}
+}
+
+// writeError maps err to a status code
+func writeError(w http.ResponseWriter, err error) {
+	var maxBytes *http.MaxBytesError
+	status := http.StatusInternalServerError
+	switch {
+	case errors.As(err, &maxBytes), errors.Is(err, rmbg.ErrImageTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, rmbg.ErrInvalidImage):
+		status = http.StatusBadRequest
+	case errors.Is(err, rmbg.ErrNoObjectDetected):
+		status = http.StatusUnprocessableEntity
+	case errors.Is(err, errBusy), errors.Is(err, errTimeout), errors.Is(err, rmbg.ErrClosed):
+		status = http.StatusServiceUnavailable
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		// The client is gone; the status is for the logs only
+		status = http.StatusServiceUnavailable
+	}
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josuedeavila/rmbg"
+)
+
+func pngBody(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestServer(t *testing.T) {
+	// A zero engine has no model loaded, like a closed one
+	engine := &rmbg.RemBG{}
+
+	serve := func(s *Server, req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Health", func(t *testing.T) {
+		rec := serve(New(engine, nil), httptest.NewRequest("GET", "/healthz", nil))
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("expected 503, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Method", func(t *testing.T) {
+		rec := serve(New(engine, nil), httptest.NewRequest("GET", "/remove", nil))
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("expected 405, got %d", rec.Code)
+		}
+	})
+
+	t.Run("InvalidImage", func(t *testing.T) {
+		rec := serve(New(engine, nil), httptest.NewRequest("POST", "/remove", strings.NewReader("not an image")))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", rec.Code)
+		}
+	})
+
+	t.Run("InvalidParams", func(t *testing.T) {
+		for _, target := range []string{"/remove?format=gif", "/remove?bg=pink", "/crop?margin=-1", "/crop?margin=-5%25", "/crop?square=maybe"} {
+			rec := serve(New(engine, nil), httptest.NewRequest("POST", target, bytes.NewReader(pngBody(t))))
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected 400, got %d", target, rec.Code)
+			}
+		}
+	})
+
+	t.Run("TooLarge", func(t *testing.T) {
+		s := New(engine, &Config{MaxBodyBytes: 16})
+		rec := serve(s, httptest.NewRequest("POST", "/remove", bytes.NewReader(pngBody(t))))
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("expected 413, got %d", rec.Code)
+		}
+
+		s = New(engine, &Config{Decode: &rmbg.DecodeOptions{MaxPixels: 16}})
+		rec = serve(s, httptest.NewRequest("POST", "/remove", bytes.NewReader(pngBody(t))))
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("expected 413 for too many pixels, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Multipart", func(t *testing.T) {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		if err := mw.WriteField("other", "x"); err != nil {
+			t.Fatal(err)
+		}
+		if err := mw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest("POST", "/remove", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rec := serve(New(engine, nil), req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 without image field, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Busy", func(t *testing.T) {
+		s := New(engine, &Config{MaxConcurrent: 1, QueueTimeout: 10 * time.Millisecond})
+		s.slots <- struct{}{}
+		rec := serve(s, httptest.NewRequest("POST", "/remove", bytes.NewReader(pngBody(t))))
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("expected 503 when busy, got %d", rec.Code)
+		}
+
+		// The upload is read before waiting for a slot
+		s = New(engine, &Config{MaxConcurrent: 1, QueueTimeout: 10 * time.Millisecond, MaxBodyBytes: 16})
+		s.slots <- struct{}{}
+		rec = serve(s, httptest.NewRequest("POST", "/remove", bytes.NewReader(pngBody(t))))
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("expected 413 before waiting for a slot, got %d", rec.Code)
+		}
+	})
+
+	t.Run("ProcessTimeout", func(t *testing.T) {
+		s := New(engine, &Config{MaxConcurrent: 1, ProcessTimeout: 10 * time.Millisecond})
+		release := make(chan struct{})
+		s.remove = func(io.Reader, io.Writer, rmbg.Format, *rmbg.IOOptions) error {
+			<-release
+			return nil
+		}
+		rec := serve(s, httptest.NewRequest("POST", "/remove", bytes.NewReader(pngBody(t))))
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("expected 503 on timeout, got %d", rec.Code)
+		}
+		// The slot is held until the engine is done
+		if len(s.slots) != 1 {
+			t.Errorf("expected the slot held by the running call")
+		}
+		close(release)
+	})
+}
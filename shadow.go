@@ -0,0 +1,162 @@
+package rmbg
+
+import (
+	"image"
+	"math"
+)
+
+const (
+	// DefaultShadowOpacity is the default ShadowOptions.Opacity
+	DefaultShadowOpacity = 0.7
+	// DefaultShadowReach is the default ShadowOptions.Reach
+	DefaultShadowReach = 0.3
+	// DefaultShadowDarkness is the default ShadowOptions.MinDarkness
+	DefaultShadowDarkness = 0.04
+)
+
+const (
+	// shadowObject is the mask value from which a pixel belongs to the subject
+	shadowObject = 128
+	// shadowBackground is the mask value below which a pixel is sampled for the
+	// background color
+	shadowBackground = 16
+	// shadowChroma is how much more saturated than the background, in 8-bit
+	// levels, a pixel may be and still count as shadow
+	shadowChroma = 24
+)
+
+// ShadowOptions configures PreserveShadow
+type ShadowOptions struct {
+	// Opacity scales the darkness of the shadow into alpha, from 0 to 1
+	// (default: DefaultShadowOpacity)
+	Opacity float64
+	// Reach is how far the shadow may extend from the subject, as a fraction
+	// of the subject's height (default: DefaultShadowReach)
+	Reach float64
+	// MinDarkness is how much darker than the background, as a fraction of its
+	// luminance, a pixel must be to count as shadow (default:
+	// DefaultShadowDarkness)
+	MinDarkness float64
+}
+
+// withDefaults fills the zero fields of opts
+func (opts *ShadowOptions) withDefaults() ShadowOptions {
+	o := ShadowOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Opacity <= 0 {
+		o.Opacity = DefaultShadowOpacity
+	}
+	o.Opacity = min(o.Opacity, 1)
+	if o.Reach <= 0 {
+		o.Reach = DefaultShadowReach
+	}
+	if o.MinDarkness <= 0 {
+		o.MinDarkness = DefaultShadowDarkness
+	}
+	return o
+}
+
+// PreserveShadow returns a copy of mask, the object mask of img at its
+// resolution, in which the soft shadow touching the subject is kept instead
+// of cut away. Shadow pixels are background pixels darker than the
+// background and about as saturated, connected to the subject through other
+// shadow pixels; their alpha is their darkness scaled by opts.Opacity, so
+// contact shadows of products shot on white survive at reduced opacity.
+func PreserveShadow(img image.Image, mask *image.Gray, opts *ShadowOptions) *image.Gray {
+	dst := image.NewGray(mask.Rect)
+	copy(dst.Pix, mask.Pix)
+	preserveShadow(dst, img, opts)
+	return dst
+}
+
+// preserveShadow is PreserveShadow in place
+func preserveShadow(mask *image.Gray, img image.Image, opts *ShadowOptions) {
+	o := opts.withDefaults()
+	src := toNRGBA(img)
+	w, h := min(mask.Rect.Dx(), src.Rect.Dx()), min(mask.Rect.Dy(), src.Rect.Dy())
+	if w == 0 || h == 0 {
+		return
+	}
+	pixel := func(x, y int) []uint8 {
+		return src.Pix[y*src.Stride+x*4:][:3]
+	}
+	alpha := func(x, y int) *uint8 {
+		return &mask.Pix[y*mask.Stride+x]
+	}
+
+	// The background color is the per-channel median of the background
+	var hist [3][256]int
+	var samples, top, bottom int
+	top, bottom = h, -1
+	for y := range h {
+		for x := range w {
+			switch a := *alpha(x, y); {
+			case a < shadowBackground:
+				for c, v := range pixel(x, y) {
+					hist[c][v]++
+				}
+				samples++
+			case a >= shadowObject:
+				top, bottom = min(top, y), max(bottom, y)
+			}
+		}
+	}
+	if samples == 0 || bottom < 0 {
+		return
+	}
+	var bg [3]uint8
+	for c := range bg {
+		for n := 0; ; bg[c]++ {
+			if n += hist[c][bg[c]]; 2*n >= samples {
+				break
+			}
+		}
+	}
+	bgLuma := lumaOf(bg[0], bg[1], bg[2])
+	if bgLuma == 0 {
+		return
+	}
+	bgChroma := int(max(bg[0], bg[1], bg[2])) - int(min(bg[0], bg[1], bg[2]))
+	reach := max(1, int(math.Round(o.Reach*float64(bottom-top+1))))
+
+	// Grow from the subject through shadow pixels, up to reach steps away
+	dist := make([]int32, w*h)
+	queue := make([]int, 0, w*h/8)
+	for y := range h {
+		for x := range w {
+			if *alpha(x, y) >= shadowObject {
+				queue = append(queue, y*w+x)
+			} else {
+				dist[y*w+x] = -1
+			}
+		}
+	}
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		if int(dist[i]) >= reach {
+			continue
+		}
+		x0, y0 := i%w, i/w
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				x, y := x0+dx, y0+dy
+				if x < 0 || y < 0 || x >= w || y >= h || dist[y*w+x] >= 0 {
+					continue
+				}
+				p := pixel(x, y)
+				darkness := float64((bgLuma - lumaOf(p[0], p[1], p[2])) / bgLuma)
+				chroma := int(max(p[0], p[1], p[2])) - int(min(p[0], p[1], p[2]))
+				if darkness < o.MinDarkness || chroma > bgChroma+shadowChroma {
+					continue
+				}
+				dist[y*w+x] = dist[i] + 1
+				queue = append(queue, y*w+x)
+				a := alpha(x, y)
+				*a = max(*a, uint8(math.Round(math.Min(darkness, 1)*o.Opacity*255)))
+			}
+		}
+	}
+}
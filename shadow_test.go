@@ -0,0 +1,90 @@
+package rmbg
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+// shadowScene is a white 100x100 image with a dark object, a gray contact
+// shadow below it, a gray patch away from it and a red patch touching it
+func shadowScene() (*image.NRGBA, *image.Gray) {
+	img := solidImage(100, 100, color.NRGBA{R: 255, G: 255, B: 255, A: 255})
+	paint := func(r image.Rectangle, c color.NRGBA) {
+		draw.Draw(img, r, image.NewUniform(c), image.Point{}, draw.Src)
+	}
+	paint(image.Rect(30, 20, 70, 60), color.NRGBA{R: 40, G: 40, B: 40, A: 255})
+	paint(image.Rect(30, 60, 70, 66), color.NRGBA{R: 180, G: 180, B: 180, A: 255})
+	paint(image.Rect(80, 80, 90, 90), color.NRGBA{R: 180, G: 180, B: 180, A: 255})
+	paint(image.Rect(70, 20, 76, 30), color.NRGBA{R: 200, G: 30, B: 30, A: 255})
+
+	mask := image.NewGray(img.Rect)
+	fillRect(mask, image.Rect(30, 20, 70, 60), 255)
+	return img, mask
+}
+
+func TestPreserveShadow(t *testing.T) {
+	img, mask := shadowScene()
+	got := PreserveShadow(img, mask, nil)
+
+	// 180 on 255 is 29% darker, at 70% opacity
+	want := uint8(52)
+	tests := []struct {
+		name string
+		x, y int
+		want uint8
+	}{
+		{"Object", 50, 40, 255},
+		{"Shadow", 50, 63, want},
+		{"Background", 10, 10, 0},
+		{"Detached", 85, 85, 0},
+		{"Saturated", 72, 25, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if a := got.GrayAt(tt.x, tt.y).Y; a != tt.want {
+				t.Errorf("expected alpha %d at (%d, %d), got %d", tt.want, tt.x, tt.y, a)
+			}
+		})
+	}
+	if mask.GrayAt(50, 63).Y != 0 {
+		t.Errorf("expected the input mask to be left alone")
+	}
+
+	t.Run("Reach", func(t *testing.T) {
+		// 5% of the 40 pixel object is 2 pixels
+		got := PreserveShadow(img, mask, &ShadowOptions{Reach: 0.05})
+		if a := got.GrayAt(50, 61).Y; a != want {
+			t.Errorf("expected alpha %d next to the object, got %d", want, a)
+		}
+		if a := got.GrayAt(50, 63).Y; a != 0 {
+			t.Errorf("expected no shadow beyond reach, got %d", a)
+		}
+	})
+
+	t.Run("NoBackground", func(t *testing.T) {
+		full := image.NewGray(img.Rect)
+		fillRect(full, full.Rect, 255)
+		if got := PreserveShadow(img, full, nil); got.GrayAt(50, 63).Y != 255 {
+			t.Errorf("expected the mask unchanged")
+		}
+	})
+}
+
+func TestProcessShadow(t *testing.T) {
+	img, mask := shadowScene()
+	r := cachedEngine()
+	r.cache.put(hashImage(img, r.model.spec.Name), &prediction{mask: mask})
+	r.shadow = &ShadowOptions{}
+	res, err := r.Process(img)
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if a := res.Mask.GrayAt(50, 63).Y; a == 0 {
+		t.Errorf("expected the shadow in the mask")
+	}
+	if a := res.Mask.GrayAt(85, 85).Y; a != 0 {
+		t.Errorf("expected no alpha on the detached patch, got %d", a)
+	}
+}
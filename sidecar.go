@@ -0,0 +1,109 @@
+package rmbg
+
+import (
+	"encoding/json"
+	"image"
+	"time"
+)
+
+// sidecarThreshold is the mask value from which a pixel counts as object in
+// sidecars, as for ExtractContours
+const sidecarThreshold = 128
+
+// Sidecar describes the mask of a processed image. ProcessFile,
+// ProcessObject and ProcessDir write it as JSON next to the output when
+// IOOptions.Sidecar is set, for indexing assets without decoding them.
+type Sidecar struct {
+	// Input and Output are the paths or keys of the source and output
+	Input  string `json:"input,omitempty"`
+	Output string `json:"output,omitempty"`
+	// Width and Height are the size of the input, upright
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// BBox is the bounding box of the object; nil when none was detected
+	BBox *Box `json:"bbox"`
+	// Contour is the outline of the object as polygons of [x, y] points, holes
+	// wound opposite to outer boundaries as for ExtractContours
+	Contour [][][2]float64 `json:"contour"`
+	// Area is the number of pixels of the object
+	Area int `json:"area"`
+	// Coverage is the fraction of the image covered by the object
+	Coverage float64 `json:"coverage"`
+	// Confidence estimates how reliable the segmentation is
+	Confidence Confidence `json:"confidence"`
+	// Model is the name of the model that produced the mask
+	Model string `json:"model"`
+	// Timing is the time spent processing the image
+	Timing Timing `json:"timing"`
+}
+
+// Box is a rectangle in pixels
+type Box struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// Timing breaks down the time spent on an image, in milliseconds
+type Timing struct {
+	// Preprocess, Inference and Postprocess are the model stages
+	Preprocess  float64 `json:"preprocess_ms"`
+	Inference   float64 `json:"inference_ms"`
+	Postprocess float64 `json:"postprocess_ms"`
+	// Total also covers compositing and encoding the output
+	Total float64 `json:"total_ms"`
+}
+
+// newSidecar describes the mask of res, computed by pred for img, in image
+// coordinates
+func newSidecar(img image.Image, res *Result, pred *prediction) *Sidecar {
+	b := img.Bounds()
+	sc := &Sidecar{
+		Width:      b.Dx(),
+		Height:     b.Dy(),
+		Contour:    [][][2]float64{},
+		Confidence: res.Confidence,
+		Model:      pred.model,
+		Timing: Timing{
+			Preprocess:  milliseconds(pred.timing.preprocess),
+			Inference:   milliseconds(pred.timing.inference),
+			Postprocess: milliseconds(pred.timing.decode),
+		},
+	}
+	info, err := MeasureObject(b, res.Mask, sidecarThreshold)
+	if err != nil {
+		// No object: an empty bounding box and contour
+		return sc
+	}
+	sc.BBox = &Box{X: info.BBox.Min.X, Y: info.BBox.Min.Y, Width: info.BBox.Dx(), Height: info.BBox.Dy()}
+	sc.Area, sc.Coverage = info.Area, info.Coverage
+
+	aligned := &image.Gray{Pix: res.Mask.Pix, Stride: res.Mask.Stride, Rect: b}
+	for _, poly := range ExtractContours(aligned, nil) {
+		points := make([][2]float64, len(poly))
+		for i, p := range poly {
+			points[i] = [2]float64{roundCoord(p.X), roundCoord(p.Y)}
+		}
+		sc.Contour = append(sc.Contour, points)
+	}
+	return sc
+}
+
+// marshal encodes the sidecar as indented JSON
+func (sc *Sidecar) marshal() ([]byte, error) {
+	data, err := json.MarshalIndent(sc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// sidecarPath is the sidecar of the output at path
+func sidecarPath(path string) string {
+	return path + ".json"
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
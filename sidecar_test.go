@@ -0,0 +1,131 @@
+package rmbg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewSidecar(t *testing.T) {
+	img := solidImage(40, 30, color.NRGBA{G: 255, A: 255})
+	mask := image.NewGray(img.Bounds())
+	fillRect(mask, image.Rect(10, 5, 30, 25), 255)
+	res := &Result{Mask: mask, Confidence: Confidence{Score: 0.9}}
+	pred := &prediction{model: "u2netp", timing: stageTimes{inference: 1500 * time.Microsecond}}
+
+	sc := newSidecar(img, res, pred)
+	if sc.Width != 40 || sc.Height != 30 {
+		t.Errorf("expected 40x30, got %dx%d", sc.Width, sc.Height)
+	}
+	if want := (Box{X: 10, Y: 5, Width: 20, Height: 20}); sc.BBox == nil || *sc.BBox != want {
+		t.Errorf("expected bbox %+v, got %+v", want, sc.BBox)
+	}
+	if sc.Area != 400 {
+		t.Errorf("expected area 400, got %d", sc.Area)
+	}
+	if len(sc.Contour) != 1 || len(sc.Contour[0]) < 4 {
+		t.Errorf("expected one outline, got %v", sc.Contour)
+	}
+	if sc.Model != "u2netp" || sc.Confidence.Score != 0.9 || sc.Timing.Inference != 1.5 {
+		t.Errorf("expected model, confidence and timing to be copied, got %+v", sc)
+	}
+
+	data, err := sc.marshal()
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("expected valid JSON, got %v", err)
+	}
+	for _, key := range []string{"bbox", "contour", "area", "confidence", "model", "timing"} {
+		if _, ok := fields[key]; !ok {
+			t.Errorf("expected %q in %s", key, data)
+		}
+	}
+
+	t.Run("NoObject", func(t *testing.T) {
+		res := &Result{Mask: image.NewGray(img.Bounds())}
+		sc := newSidecar(img, res, pred)
+		if sc.BBox != nil || sc.Area != 0 || len(sc.Contour) != 0 {
+			t.Errorf("expected no object, got %+v", sc)
+		}
+		data, err := sc.marshal()
+		if err != nil {
+			t.Fatalf("marshal failed: %v", err)
+		}
+		if !bytes.Contains(data, []byte(`"contour": []`)) || !bytes.Contains(data, []byte(`"bbox": null`)) {
+			t.Errorf("expected an empty contour and null bbox, got %s", data)
+		}
+	})
+}
+
+func TestSidecarOutput(t *testing.T) {
+	src := solidImage(20, 10, color.NRGBA{R: 255, A: 255})
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, src); err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	r := cachedEngine(src)
+	opts := &IOOptions{Sidecar: true}
+
+	check := func(t *testing.T, data []byte, input, output string) {
+		t.Helper()
+		var sc Sidecar
+		if err := json.Unmarshal(data, &sc); err != nil {
+			t.Fatalf("expected a JSON sidecar, got %v", err)
+		}
+		if sc.Input != input || sc.Output != output {
+			t.Errorf("expected %s -> %s, got %s -> %s", input, output, sc.Input, sc.Output)
+		}
+		if want := (Box{Width: 20, Height: 10}); sc.BBox == nil || *sc.BBox != want {
+			t.Errorf("expected bbox %+v, got %+v", want, sc.BBox)
+		}
+		if sc.Area != 200 || sc.Timing.Total <= 0 {
+			t.Errorf("expected area 200 and a total time, got %d and %v", sc.Area, sc.Timing.Total)
+		}
+	}
+
+	t.Run("File", func(t *testing.T) {
+		dir := t.TempDir()
+		in, out := filepath.Join(dir, "in.png"), filepath.Join(dir, "out.webp")
+		if err := os.WriteFile(in, encoded.Bytes(), 0o644); err != nil {
+			t.Fatalf("failed to write input: %v", err)
+		}
+		if err := r.ProcessFile(in, out, opts); err != nil {
+			t.Fatalf("ProcessFile failed: %v", err)
+		}
+		data, err := os.ReadFile(out + ".json")
+		if err != nil {
+			t.Fatalf("expected a sidecar, got %v", err)
+		}
+		check(t, data, in, out)
+
+		other := filepath.Join(dir, "plain.png")
+		if err := r.ProcessFile(in, other, nil); err != nil {
+			t.Fatalf("ProcessFile failed: %v", err)
+		}
+		if _, err := os.Stat(other + ".json"); !os.IsNotExist(err) {
+			t.Errorf("expected no sidecar by default, got %v", err)
+		}
+	})
+
+	t.Run("Object", func(t *testing.T) {
+		store := &mapStorage{objects: map[string][]byte{"in/a.png": encoded.Bytes()}}
+		if err := r.ProcessObject(context.Background(), store, "in/a.png", "out/a.png", opts); err != nil {
+			t.Fatalf("ProcessObject failed: %v", err)
+		}
+		data, ok := store.objects["out/a.png.json"]
+		if !ok {
+			t.Fatalf("expected a sidecar object")
+		}
+		check(t, data, "in/a.png", "out/a.png")
+	})
+}
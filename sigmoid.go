@@ -0,0 +1,105 @@
+package rmbg
+
+import "math"
+
+const (
+	// sigmoidRange is the largest logit magnitude covered by the LUT; beyond it
+	// the sigmoid is within 3.4e-4 of 0 or 1 and is clamped
+	sigmoidRange = 8
+	// sigmoidSteps is the number of LUT intervals, giving a linear interpolation
+	// error below 1e-6
+	sigmoidSteps = 4096
+)
+
+// sigmoidLUT samples the sigmoid at sigmoidSteps+1 evenly spaced logits in
+// [-sigmoidRange, sigmoidRange], both ends included
+var sigmoidLUT = func() (lut [sigmoidSteps + 1]float32) {
+	for i := range lut {
+		v := float64(i)/sigmoidSteps*2*sigmoidRange - sigmoidRange
+		lut[i] = float32(1 / (1 + math.Exp(-v)))
+	}
+	return lut
+}()
+
+// sigmoid approximates 1/(1+e^-v) from the LUT. NaN maps to 0.
+func sigmoid(v float32) float32 {
+	// Written so NaN fails the first comparison
+	if !(v > -sigmoidRange) {
+		return sigmoidLUT[0]
+	}
+	if v >= sigmoidRange {
+		return sigmoidLUT[sigmoidSteps]
+	}
+	f := (v + sigmoidRange) * (sigmoidSteps / (2 * sigmoidRange))
+	i := int(f)
+	// Logits just below sigmoidRange can round up to the last LUT entry
+	if i >= sigmoidSteps {
+		return sigmoidLUT[sigmoidSteps]
+	}
+	frac := f - float32(i)
+	return sigmoidLUT[i] + (sigmoidLUT[i+1]-sigmoidLUT[i])*frac
+}
+
+// sigmoidHistogram writes the sigmoid of logits to probs and returns the
+// histogram of the probabilities over 256 bins, in a single pass
+func sigmoidHistogram(probs, logits []float32) [256]int {
+	var hist [256]int
+	probs = probs[:len(logits)]
+	for i, v := range logits {
+		s := sigmoid(v)
+		probs[i] = s
+		hist[uint8(s*255)]++
+	}
+	return hist
+}
+
+// otsuThreshold returns the Otsu threshold of the sigmoid of logits
+func otsuThreshold(logits []float32) float32 {
+	hist := sigmoidHistogram(make([]float32, len(logits)), logits)
+	return otsuFromHistogram(&hist, len(logits))
+}
+
+// otsuFromHistogram returns the threshold in [0, 1] that maximizes the
+// between-class variance of a 256-bin histogram of total values. Bin t holds
+// values in [t/255, (t+1)/255), so values above the threshold are exactly those
+// in the bins of the upper class.
+func otsuFromHistogram(hist *[256]int, total int) float32 {
+	sum := 0
+	for t, n := range hist {
+		sum += t * n
+	}
+
+	sumB, wB, varMax, threshold := 0, 0, 0.0, 0
+	for t, n := range hist {
+		wB += n
+		if wB == 0 {
+			continue
+		}
+		wF := total - wB
+		if wF == 0 {
+			break
+		}
+		sumB += t * n
+		mB := float64(sumB) / float64(wB)
+		mF := float64(sum-sumB) / float64(wF)
+		varBetween := float64(wB) * float64(wF) * (mB - mF) * (mB - mF)
+		if varBetween > varMax {
+			varMax = varBetween
+			threshold = t
+		}
+	}
+
+	return float32(threshold+1) / 255.0
+}
+
+// binarize sets mask pixels to 255 where probs exceed threshold and 0 elsewhere
+func binarize(mask []uint8, probs []float32, threshold float32) {
+	mask = mask[:len(probs)]
+	for i, s := range probs {
+		var v uint8
+		if s > threshold {
+			v = 255
+		}
+		mask[i] = v
+	}
+}
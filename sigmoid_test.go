@@ -0,0 +1,113 @@
+package rmbg
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSigmoid(t *testing.T) {
+	t.Run("Accuracy", func(t *testing.T) {
+		for v := -10.0; v <= 10; v += 0.001 {
+			want := 1 / (1 + math.Exp(-v))
+			if got := float64(sigmoid(float32(v))); math.Abs(got-want) > 4e-4 {
+				t.Fatalf("sigmoid(%f): expected %f, got %f", v, want, got)
+			}
+			if got := float64(sigmoid(float32(v))); math.Abs(v) < sigmoidRange && math.Abs(got-want) > 1e-6 {
+				t.Fatalf("sigmoid(%f): expected %f within 1e-6, got %f", v, want, got)
+			}
+		}
+	})
+
+	t.Run("Extremes", func(t *testing.T) {
+		cases := []struct {
+			v    float32
+			want float32
+		}{
+			{float32(math.Inf(-1)), sigmoidLUT[0]},
+			{-1e9, sigmoidLUT[0]},
+			{-sigmoidRange, sigmoidLUT[0]},
+			{sigmoidRange, sigmoidLUT[sigmoidSteps]},
+			{1e9, sigmoidLUT[sigmoidSteps]},
+			{float32(math.Inf(1)), sigmoidLUT[sigmoidSteps]},
+			{float32(math.NaN()), sigmoidLUT[0]},
+		}
+		for _, c := range cases {
+			if got := sigmoid(c.v); got != c.want {
+				t.Errorf("sigmoid(%v): expected %v, got %v", c.v, c.want, got)
+			}
+		}
+	})
+
+	t.Run("RangeEdges", func(t *testing.T) {
+		// The logits closest to the ends of the LUT must not index past them
+		for _, v := range []float32{-sigmoidRange, math.Nextafter32(-sigmoidRange, 0), math.Nextafter32(sigmoidRange, 0)} {
+			want := 1 / (1 + math.Exp(-float64(v)))
+			if got := float64(sigmoid(v)); math.Abs(got-want) > 1e-6 {
+				t.Errorf("sigmoid(%v): expected %f, got %f", v, want, got)
+			}
+		}
+	})
+
+	t.Run("Monotonic", func(t *testing.T) {
+		prev := sigmoid(-sigmoidRange)
+		for v := float32(-sigmoidRange); v <= sigmoidRange; v += 1.0 / 512 {
+			s := sigmoid(v)
+			if s < prev {
+				t.Fatalf("expected sigmoid to be non-decreasing at %f", v)
+			}
+			prev = s
+		}
+	})
+}
+
+func TestSigmoidHistogram(t *testing.T) {
+	logits := []float32{-100, 0, 100, float32(math.NaN())}
+	probs := make([]float32, len(logits))
+	hist := sigmoidHistogram(probs, logits)
+
+	if hist[0] != 2 || hist[127] != 1 || hist[254] != 1 {
+		t.Errorf("expected bins 0, 127 and 254 to hold 2, 1 and 1 values, got %d, %d and %d", hist[0], hist[127], hist[254])
+	}
+	if probs[1] != 0.5 {
+		t.Errorf("expected sigmoid(0) = 0.5, got %f", probs[1])
+	}
+}
+
+func TestOtsuFromHistogram(t *testing.T) {
+	// Saturated foreground in the last bin must count towards its class mean
+	var hist [256]int
+	hist[0], hist[255] = 90, 10
+	threshold := otsuFromHistogram(&hist, 100)
+	if threshold <= 0 || threshold >= 1 {
+		t.Errorf("expected threshold between the peaks, got %f", threshold)
+	}
+
+	// Values in the top bin of the lower class stay below the threshold
+	probs := []float32{0.001, 0.003, 0.999, 1}
+	hist = sigmoidHistogram(make([]float32, 4), []float32{-7, -5.8, 6.9, 9})
+	threshold = otsuFromHistogram(&hist, 4)
+	mask := make([]uint8, 4)
+	binarize(mask, probs, threshold)
+	if mask[0] != 0 || mask[1] != 0 || mask[2] != 255 || mask[3] != 255 {
+		t.Errorf("expected [0 0 255 255] at threshold %f, got %v", threshold, mask)
+	}
+}
+
+func TestBinarize(t *testing.T) {
+	mask := []uint8{7, 7, 7}
+	binarize(mask, []float32{0.2, 0.5, 0.9}, 0.5)
+	if mask[0] != 0 || mask[1] != 0 || mask[2] != 255 {
+		t.Errorf("expected [0 0 255], got %v", mask)
+	}
+}
+
+func BenchmarkMaskFromOutput(b *testing.B) {
+	data := make([]float32, inputSize*inputSize)
+	for i := range data {
+		data[i] = float32(i%97)/4 - 12
+	}
+	b.ReportAllocs()
+	for b.Loop() {
+		maskFromOutput(data, inputSize, OutputLogits)
+	}
+}
@@ -0,0 +1,113 @@
+package rmbg
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"slices"
+
+	"github.com/disintegration/imaging"
+)
+
+// DefaultSkyFade is the default SkyOptions.Fade
+const DefaultSkyFade = 0.04
+
+// SkyOptions configures ReplaceSky
+type SkyOptions struct {
+	// Fade is the half height of the band around the horizon, as a fraction
+	// of the image height, over which the new sky fades into the original,
+	// keeping the haze of distant scenery (default: DefaultSkyFade)
+	Fade float64
+}
+
+// withDefaults fills the zero fields of opts
+func (opts *SkyOptions) withDefaults() SkyOptions {
+	o := SkyOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Fade <= 0 {
+		o.Fade = DefaultSkyFade
+	}
+	return o
+}
+
+// ReplaceSky segments the sky of img with the engine's model, which should be
+// a sky model such as ModelSkySeg, and replaces it with sky, see
+// ReplaceSkyWithMask
+func (r *RemBG) ReplaceSky(img, sky image.Image, opts *SkyOptions) (*image.NRGBA, error) {
+	pred, err := r.predict(img)
+	if err != nil {
+		return nil, err
+	}
+	mask := r.upsampleMask(pred.mask, img)
+	defer r.outputs.putPix(mask.Pix)
+	return ReplaceSkyWithMask(img, sky, mask, opts)
+}
+
+// ReplaceSkyWithMask replaces the sky of img, given by mask, with sky. The
+// horizon is the typical lower edge of the sky hanging from the top of the
+// image; sky is scaled to cover the image down to it, so its own horizon
+// lines up, and fades into the original around it. Sky pixels well below the
+// horizon, such as reflections in water, are kept. The mask may have any
+// resolution. It returns ErrNoObjectDetected when no sky touches the top of
+// the image.
+func ReplaceSkyWithMask(img, sky image.Image, mask *image.Gray, opts *SkyOptions) (*image.NRGBA, error) {
+	if mask == nil || mask.Bounds().Empty() {
+		return nil, fmt.Errorf("mask image is nil or empty")
+	}
+	if sky == nil || sky.Bounds().Empty() {
+		return nil, fmt.Errorf("sky image is nil or empty")
+	}
+	o := opts.withDefaults()
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	mask = fitMask(mask, w, h)
+	horizon, ok := skyHorizon(mask)
+	if !ok {
+		return nil, fmt.Errorf("%w: no sky at the top of the image", ErrNoObjectDetected)
+	}
+
+	band := max(1, int(math.Round(o.Fade*float64(h))))
+	skyH := min(horizon+band, h)
+	filled := imaging.Fill(sky, w, skyH, imaging.Bottom, imaging.Lanczos)
+	alpha := image.NewAlpha(image.Rect(0, 0, w, skyH))
+	mb := mask.Bounds()
+	parallelRows(skyH, func(start, end int) {
+		for y := start; y < end; y++ {
+			ramp := min(max(float64(horizon+band-y)/float64(2*band), 0), 1)
+			row := mask.Pix[mask.PixOffset(mb.Min.X, mb.Min.Y+y):][:w]
+			for x, v := range row {
+				alpha.Pix[y*alpha.Stride+x] = uint8(float64(v)*ramp + 0.5)
+			}
+		}
+	})
+
+	dst := toNRGBA(img)
+	rect := image.Rect(b.Min.X, b.Min.Y, b.Max.X, b.Min.Y+skyH)
+	draw.DrawMask(dst, rect, filled, image.Point{}, alpha, image.Point{}, draw.Over)
+	return dst, nil
+}
+
+// skyHorizon returns the median, over the columns of mask whose top pixel is
+// sky, of the row where that sky ends. It reports false when no column starts
+// with sky.
+func skyHorizon(mask *image.Gray) (int, bool) {
+	mb := mask.Bounds()
+	var ends []int
+	for x := mb.Min.X; x < mb.Max.X; x++ {
+		y := mb.Min.Y
+		for y < mb.Max.Y && mask.Pix[mask.PixOffset(x, y)] >= 128 {
+			y++
+		}
+		if y > mb.Min.Y {
+			ends = append(ends, y-mb.Min.Y)
+		}
+	}
+	if len(ends) == 0 {
+		return 0, false
+	}
+	slices.Sort(ends)
+	return ends[len(ends)/2], true
+}
@@ -0,0 +1,99 @@
+package rmbg
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// topBackend outputs a confident foreground logit map over the upper half
+type topBackend struct{}
+
+func (topBackend) Run(input, output []float32) error {
+	for i := range output {
+		output[i] = -10
+		if i < len(output)/2 {
+			output[i] = 10
+		}
+	}
+	return nil
+}
+
+func TestReplaceSky(t *testing.T) {
+	ground := color.NRGBA{R: 60, G: 120, B: 40, A: 255}
+	blue := color.NRGBA{R: 40, G: 90, B: 220, A: 255}
+	img := solidImage(40, 40, ground)
+	sky := solidImage(30, 10, blue)
+	mask := image.NewGray(image.Rect(0, 0, 40, 40))
+	fillRect(mask, image.Rect(0, 0, 40, 20), 255)
+	// A lake reflecting the sky
+	fillRect(mask, image.Rect(0, 34, 40, 40), 255)
+
+	out, err := ReplaceSkyWithMask(img, sky, mask, &SkyOptions{Fade: 0.05})
+	if err != nil {
+		t.Fatalf("ReplaceSkyWithMask failed: %v", err)
+	}
+	if c := out.NRGBAAt(10, 5); c != blue {
+		t.Errorf("expected the new sky at the top, got %v", c)
+	}
+	if c := out.NRGBAAt(10, 37); c != ground {
+		t.Errorf("expected the reflection kept, got %v", c)
+	}
+	if c := out.NRGBAAt(10, 19); c == blue || c == ground {
+		t.Errorf("expected a blend at the horizon, got %v", c)
+	}
+	if c := img.NRGBAAt(10, 5); c != ground {
+		t.Errorf("expected the input unchanged, got %v", c)
+	}
+
+	t.Run("LowResolutionMask", func(t *testing.T) {
+		small := image.NewGray(image.Rect(0, 0, 10, 10))
+		fillRect(small, image.Rect(0, 0, 10, 5), 255)
+		out, err := ReplaceSkyWithMask(img, sky, small, nil)
+		if err != nil {
+			t.Fatalf("ReplaceSkyWithMask failed: %v", err)
+		}
+		if c := out.NRGBAAt(20, 4); c != blue {
+			t.Errorf("expected the new sky at the top, got %v", c)
+		}
+		if c := out.NRGBAAt(20, 35); c != ground {
+			t.Errorf("expected the ground kept, got %v", c)
+		}
+	})
+
+	t.Run("NoSky", func(t *testing.T) {
+		_, err := ReplaceSkyWithMask(img, sky, image.NewGray(image.Rect(0, 0, 40, 40)), nil)
+		if !errors.Is(err, ErrNoObjectDetected) {
+			t.Errorf("expected ErrNoObjectDetected, got %v", err)
+		}
+	})
+
+	t.Run("Engine", func(t *testing.T) {
+		r, err := New(&Config{Backend: topBackend{}})
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		defer r.Close()
+		out, err := r.ReplaceSky(img, sky, nil)
+		if err != nil {
+			t.Fatalf("ReplaceSky failed: %v", err)
+		}
+		if c := out.NRGBAAt(20, 5); c != blue {
+			t.Errorf("expected the new sky at the top, got %v", c)
+		}
+		if c := out.NRGBAAt(20, 35); c != ground {
+			t.Errorf("expected the ground kept, got %v", c)
+		}
+	})
+}
+
+func TestSkyHorizon(t *testing.T) {
+	mask := image.NewGray(image.Rect(0, 0, 5, 20))
+	for x, end := range []int{8, 10, 12, 0, 11} {
+		fillRect(mask, image.Rect(x, 0, x+1, end), 255)
+	}
+	if y, ok := skyHorizon(mask); !ok || y != 11 {
+		t.Errorf("expected horizon 11, got %d (%v)", y, ok)
+	}
+}
@@ -0,0 +1,65 @@
+package rmbg
+
+import (
+	"errors"
+	"fmt"
+	"image"
+)
+
+// DefaultSmoothing is the weight of the previous masks used when smoothing
+// masks over time
+const DefaultSmoothing = 0.5
+
+// ErrInvalidSmoothing is returned for smoothing weights outside [0, 1)
+var ErrInvalidSmoothing = errors.New("invalid smoothing")
+
+// MaskSmoother blends the masks of consecutive frames with an exponential
+// moving average, so the edges of a moving object do not flicker
+type MaskSmoother struct {
+	weight float32
+	acc    []float32
+	size   image.Point
+}
+
+// NewMaskSmoother creates a smoother giving weight, from 0 (no smoothing) to
+// below 1, to the previous masks; higher values flicker less but lag behind
+// fast motion
+func NewMaskSmoother(weight float64) (*MaskSmoother, error) {
+	if weight < 0 || weight >= 1 {
+		return nil, fmt.Errorf("%w: %g is outside [0, 1)", ErrInvalidSmoothing, weight)
+	}
+	return &MaskSmoother{weight: float32(weight)}, nil
+}
+
+// Apply blends mask into the running average and overwrites it with the
+// result. A mask of a different size than the previous one restarts the
+// average.
+func (s *MaskSmoother) Apply(mask *image.Gray) {
+	size := mask.Rect.Size()
+	w, h := size.X, size.Y
+	if s.acc == nil || s.size != size {
+		s.acc = make([]float32, w*h)
+		s.size = size
+		for y := range h {
+			for x, v := range mask.Pix[y*mask.Stride:][:w] {
+				s.acc[y*w+x] = float32(v)
+			}
+		}
+		return
+	}
+
+	prev, cur := s.weight, 1-s.weight
+	for y := range h {
+		row := mask.Pix[y*mask.Stride:][:w]
+		for x, v := range row {
+			i := y*w + x
+			s.acc[i] = prev*s.acc[i] + cur*float32(v)
+			row[x] = uint8(s.acc[i] + 0.5)
+		}
+	}
+}
+
+// Reset forgets the previous masks, e.g. at a scene cut
+func (s *MaskSmoother) Reset() {
+	s.acc = nil
+}
@@ -0,0 +1,183 @@
+package rmbg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultStateFile is the state file of DirOptions.Resume when
+// DirOptions.State is not set, in the output directory
+const DefaultStateFile = ".rmbg-state.jsonl"
+
+// stateRecord is a line of a state file: an input done by ProcessDir
+type stateRecord struct {
+	// Input and Output are relative to the input and output directories,
+	// slash-separated
+	Input   string    `json:"input"`
+	Output  string    `json:"output"`
+	Hash    string    `json:"hash,omitempty"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// stateHeader is the first line of a state file: the settings of the run
+// that wrote it, which a resumed run must share
+type stateHeader struct {
+	Params string `json:"params"`
+}
+
+// batchState records the inputs a ProcessDir run completes, one JSON line
+// each, so a later run can resume after a crash
+type batchState struct {
+	mu   sync.Mutex
+	f    *os.File
+	done map[string]stateRecord
+}
+
+// statePath returns the state file of opts, relative to outDir unless
+// absolute, or "" when the run keeps none
+func statePath(opts *DirOptions, outDir string) string {
+	path := opts.State
+	if path == "" {
+		if !opts.Resume {
+			return ""
+		}
+		path = DefaultStateFile
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(outDir, path)
+	}
+	return path
+}
+
+// openState opens the state file at path of a run with the given params,
+// loading the inputs it records when resume is set and the file was written
+// with the same params, and starting it over otherwise
+func openState(path, params string, resume bool) (*batchState, error) {
+	s := &batchState{done: make(map[string]stateRecord)}
+	partial := false
+	if resume {
+		var err error
+		var same bool
+		if same, partial, err = s.load(path, params); err != nil {
+			return nil, err
+		}
+		if !same {
+			// Outputs of other settings are not the outputs of this run
+			resume = false
+			clear(s.done)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if !resume {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state file: %w", err)
+	}
+	s.f = f
+	var start []byte
+	switch {
+	case !resume:
+		if start, err = json.Marshal(stateHeader{Params: params}); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		start = append(start, '\n')
+	case partial:
+		// End the line cut by the crash, so the next record starts its own
+		start = []byte{'\n'}
+	}
+	if start != nil {
+		if _, err := f.Write(start); err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("failed to write state file: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// load reads the records of the state file at path, if any, and reports
+// whether it was written with params and whether its last line is
+// unterminated. Lines that do not parse, such as the last one of a crashed
+// run, are ignored.
+func (s *batchState) load(path, params string) (same, partial bool, err error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, fmt.Errorf("failed to read state file: %w", err)
+	}
+	first := true
+	for line := range bytes.Lines(data) {
+		if first {
+			first = false
+			var header stateHeader
+			if json.Unmarshal(line, &header) != nil || header.Params != params {
+				return false, false, nil
+			}
+			continue
+		}
+		var rec stateRecord
+		if json.Unmarshal(line, &rec) == nil && rec.Input != "" {
+			s.done[rec.Input] = rec
+		}
+	}
+	if first {
+		return false, false, nil
+	}
+	return true, len(data) > 0 && data[len(data)-1] != '\n', nil
+}
+
+// stateParams returns the digest of the settings a resumed run must share
+// with the run that wrote its state file: those content names hash, see
+// manifestParams, and whether outputs are named after their content
+func stateParams(params []byte, contentNames bool) string {
+	h := sha256.New()
+	_, _ = h.Write(params)
+	if contentNames {
+		_, _ = h.Write([]byte("content-names"))
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// completed returns the record of the input rel when a previous run
+// completed it and the file is unchanged since
+func (s *batchState) completed(rel string, info fs.FileInfo) (stateRecord, bool) {
+	rec, ok := s.done[filepath.ToSlash(rel)]
+	if !ok || rec.Size != info.Size() || !rec.ModTime.Equal(info.ModTime()) {
+		return stateRecord{}, false
+	}
+	return rec, true
+}
+
+// record appends rec to the state file
+func (s *batchState) record(rec stateRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// A single write per line, so a crash leaves at most the last one partial
+	_, err = s.f.Write(append(line, '\n'))
+	return err
+}
+
+func (s *batchState) close() error {
+	return s.f.Close()
+}
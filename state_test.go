@@ -0,0 +1,82 @@
+package rmbg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBatchState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "run.jsonl")
+	input := filepath.Join(t.TempDir(), "a.png")
+	if err := os.WriteFile(input, []byte("pixels"), 0o644); err != nil {
+		t.Fatalf("failed to write input: %v", err)
+	}
+	info, err := os.Stat(input)
+	if err != nil {
+		t.Fatalf("failed to stat input: %v", err)
+	}
+
+	s, err := openState(path, "p1", false)
+	if err != nil {
+		t.Fatalf("openState failed: %v", err)
+	}
+	if err := s.record(stateRecord{Input: "a.png", Output: "a.png", Size: info.Size(), ModTime: info.ModTime()}); err != nil {
+		t.Fatalf("record failed: %v", err)
+	}
+	_ = s.close()
+
+	// A crash in the middle of a write leaves a partial line
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("failed to open state: %v", err)
+	}
+	_, _ = f.WriteString(`{"input":"b.p`)
+	_ = f.Close()
+
+	s, err = openState(path, "p1", true)
+	if err != nil {
+		t.Fatalf("openState failed: %v", err)
+	}
+	if _, ok := s.completed("a.png", info); !ok {
+		t.Errorf("expected a.png completed")
+	}
+	if _, ok := s.completed("b.png", info); ok {
+		t.Errorf("expected the partial record ignored")
+	}
+	if err := s.record(stateRecord{Input: "c.png", Output: "c.png", Size: info.Size(), ModTime: info.ModTime()}); err != nil {
+		t.Fatalf("record failed: %v", err)
+	}
+	_ = s.close()
+
+	s, err = openState(path, "p1", true)
+	if err != nil {
+		t.Fatalf("openState failed: %v", err)
+	}
+	defer s.close()
+	if _, ok := s.completed("c.png", info); !ok {
+		t.Errorf("expected the record after the partial line to load")
+	}
+	if len(s.done) != 2 {
+		t.Errorf("expected 2 records, got %d", len(s.done))
+	}
+
+	if err := os.Chtimes(input, time.Now().Add(time.Hour), time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("failed to touch input: %v", err)
+	}
+	changed, _ := os.Stat(input)
+	if _, ok := s.completed("a.png", changed); ok {
+		t.Errorf("expected a changed input not to count as completed")
+	}
+
+	// A run with other settings starts over
+	s, err = openState(path, "p2", true)
+	if err != nil {
+		t.Fatalf("openState failed: %v", err)
+	}
+	defer s.close()
+	if _, ok := s.completed("c.png", info); ok {
+		t.Errorf("expected no records for other settings")
+	}
+}
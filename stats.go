@@ -0,0 +1,174 @@
+package rmbg
+
+import (
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+)
+
+// statsWindow is the number of recent calls kept for the engine aggregate
+const statsWindow = 1024
+
+// Stats breaks down where the time of one call went
+type Stats struct {
+	// Preprocess is the time spent resizing and normalizing the model input
+	Preprocess time.Duration
+	// Inference is the time spent in the model, including waiting for the session
+	Inference time.Duration
+	// Postprocess is the time spent decoding the model output and compositing
+	Postprocess time.Duration
+	// Upsample is the time spent scaling the mask to the image resolution
+	Upsample time.Duration
+	// Total is the wall time of the call
+	Total time.Duration
+	// Allocs and AllocBytes are the heap allocations made during the call. They are
+	// process-wide counters, so concurrent calls inflate each other's numbers.
+	Allocs     uint64
+	AllocBytes uint64
+}
+
+// StatsSummary aggregates the stats of recent calls
+type StatsSummary struct {
+	// Calls is the number of calls since the engine was created
+	Calls uint64
+	// Window is the number of recent calls the other fields are computed from
+	Window int
+	// Mean is the average of each field over the window
+	Mean Stats
+	// P50, P95 and P99 are percentiles of Total over the window
+	P50, P95, P99 time.Duration
+}
+
+// Stage names passed to Config.OnStage
+const (
+	StagePreprocess = "preprocess"
+	StageInference  = "inference"
+	StageUpsample   = "upsample"
+	StageBlend      = "blend"
+)
+
+// stage reports a finished stage to the OnStage hook and the metrics collector
+func (r *RemBG) stage(name string, d time.Duration) {
+	if r.onStage != nil {
+		r.onStage(name, d)
+	}
+	if r.metrics != nil {
+		r.metrics.ObserveLatency(name, d)
+	}
+}
+
+// stageTimes are the per-stage durations of a prediction
+type stageTimes struct {
+	preprocess time.Duration
+	inference  time.Duration
+	decode     time.Duration
+}
+
+func (t stageTimes) add(o stageTimes) stageTimes {
+	return stageTimes{
+		preprocess: t.preprocess + o.preprocess,
+		inference:  t.inference + o.inference,
+		decode:     t.decode + o.decode,
+	}
+}
+
+// statsCollector keeps a ring buffer of recent call stats
+type statsCollector struct {
+	mu     sync.Mutex
+	calls  uint64
+	recent []Stats
+	next   int
+}
+
+func newStatsCollector() *statsCollector {
+	return &statsCollector{recent: make([]Stats, 0, statsWindow)}
+}
+
+// callStart marks the beginning of a measured call
+type callStart struct {
+	at  time.Time
+	mem runtime.MemStats
+}
+
+// begin returns the start of a call, or nil when stats are disabled
+func (c *statsCollector) begin() *callStart {
+	if c == nil {
+		return nil
+	}
+	start := &callStart{}
+	runtime.ReadMemStats(&start.mem)
+	start.at = time.Now()
+	return start
+}
+
+// finish completes the stats of a call and adds them to the window
+func (c *statsCollector) finish(start *callStart, s Stats) *Stats {
+	if c == nil || start == nil {
+		return nil
+	}
+	s.Total = time.Since(start.at)
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	s.Allocs = mem.Mallocs - start.mem.Mallocs
+	s.AllocBytes = mem.TotalAlloc - start.mem.TotalAlloc
+
+	c.mu.Lock()
+	c.calls++
+	if len(c.recent) < statsWindow {
+		c.recent = append(c.recent, s)
+	} else {
+		c.recent[c.next] = s
+		c.next = (c.next + 1) % statsWindow
+	}
+	c.mu.Unlock()
+	return &s
+}
+
+func (c *statsCollector) summary() StatsSummary {
+	c.mu.Lock()
+	recent := slices.Clone(c.recent)
+	calls := c.calls
+	c.mu.Unlock()
+
+	sum := StatsSummary{Calls: calls, Window: len(recent)}
+	if len(recent) == 0 {
+		return sum
+	}
+
+	totals := make([]time.Duration, len(recent))
+	for i, s := range recent {
+		sum.Mean.Preprocess += s.Preprocess
+		sum.Mean.Inference += s.Inference
+		sum.Mean.Postprocess += s.Postprocess
+		sum.Mean.Upsample += s.Upsample
+		sum.Mean.Total += s.Total
+		sum.Mean.Allocs += s.Allocs
+		sum.Mean.AllocBytes += s.AllocBytes
+		totals[i] = s.Total
+	}
+	n := time.Duration(len(recent))
+	sum.Mean.Preprocess /= n
+	sum.Mean.Inference /= n
+	sum.Mean.Postprocess /= n
+	sum.Mean.Upsample /= n
+	sum.Mean.Total /= n
+	sum.Mean.Allocs /= uint64(n)
+	sum.Mean.AllocBytes /= uint64(n)
+
+	slices.Sort(totals)
+	percentile := func(p float64) time.Duration {
+		return totals[min(len(totals)-1, int(p*float64(len(totals))))]
+	}
+	sum.P50, sum.P95, sum.P99 = percentile(0.50), percentile(0.95), percentile(0.99)
+	return sum
+}
+
+// Stats returns the aggregate of recent calls. It is empty unless
+// Config.CollectStats is set.
+func (r *RemBG) Stats() StatsSummary {
+	if r.stats == nil {
+		return StatsSummary{}
+	}
+	return r.stats.summary()
+}
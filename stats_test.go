@@ -0,0 +1,89 @@
+package rmbg
+
+import (
+	"image/color"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestStatsCollector(t *testing.T) {
+	t.Run("Disabled", func(t *testing.T) {
+		var c *statsCollector
+		if s := c.finish(c.begin(), Stats{}); s != nil {
+			t.Errorf("expected no stats when disabled, got %+v", s)
+		}
+		if sum := (&RemBG{}).Stats(); sum.Calls != 0 {
+			t.Errorf("expected empty summary, got %+v", sum)
+		}
+	})
+
+	t.Run("Summary", func(t *testing.T) {
+		c := newStatsCollector()
+		for i := range 100 {
+			start := c.begin()
+			start.at = time.Now().Add(-time.Duration(i+1) * time.Millisecond)
+			s := c.finish(start, Stats{Inference: time.Duration(i) * time.Millisecond})
+			if s.Total < time.Duration(i+1)*time.Millisecond {
+				t.Fatalf("expected total of at least %dms, got %v", i+1, s.Total)
+			}
+		}
+
+		sum := c.summary()
+		if sum.Calls != 100 || sum.Window != 100 {
+			t.Errorf("expected 100 calls in window, got %d and %d", sum.Calls, sum.Window)
+		}
+		if want := 49500 * time.Microsecond; sum.Mean.Inference != want {
+			t.Errorf("expected mean inference %v, got %v", want, sum.Mean.Inference)
+		}
+		if sum.P50 < 50*time.Millisecond || sum.P50 > 60*time.Millisecond {
+			t.Errorf("expected p50 around 51ms, got %v", sum.P50)
+		}
+		if sum.P99 < sum.P95 || sum.P95 < sum.P50 {
+			t.Errorf("expected ordered percentiles, got %v %v %v", sum.P50, sum.P95, sum.P99)
+		}
+	})
+
+	t.Run("Window", func(t *testing.T) {
+		c := newStatsCollector()
+		for i := range statsWindow + 10 {
+			c.finish(c.begin(), Stats{Inference: time.Duration(i)})
+		}
+		sum := c.summary()
+		if sum.Calls != statsWindow+10 || sum.Window != statsWindow {
+			t.Errorf("expected %d calls and window %d, got %d and %d", statsWindow+10, statsWindow, sum.Calls, sum.Window)
+		}
+		// The oldest ten calls were evicted
+		if want := time.Duration(10 + (statsWindow-1)/2); sum.Mean.Inference != want {
+			t.Errorf("expected mean inference %v, got %v", want, sum.Mean.Inference)
+		}
+	})
+}
+
+func TestStageTimesAdd(t *testing.T) {
+	got := stageTimes{preprocess: 1, inference: 2, decode: 3}.add(stageTimes{preprocess: 10, inference: 20, decode: 30})
+	if want := (stageTimes{preprocess: 11, inference: 22, decode: 33}); got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestOnStage(t *testing.T) {
+	img := solidImage(20, 10, color.NRGBA{R: 255, A: 255})
+	r := cachedEngine(img)
+	var stages []string
+	r.onStage = func(stage string, d time.Duration) {
+		if d < 0 {
+			t.Errorf("expected non-negative duration for %s, got %v", stage, d)
+		}
+		stages = append(stages, stage)
+	}
+
+	if _, err := r.Process(img); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	// The mask comes from the cache, so only the compositing stages run
+	want := []string{StageUpsample, StageBlend}
+	if !slices.Equal(stages, want) {
+		t.Errorf("expected stages %v, got %v", want, stages)
+	}
+}
@@ -0,0 +1,74 @@
+package rmbg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrObjectNotFound is returned by Storage implementations for missing keys
+var ErrObjectNotFound = errors.New("object not found")
+
+// Storage is an object store such as S3 or GCS. The s3storage and gcsstorage
+// packages provide implementations behind the s3 and gcs build tags.
+type Storage interface {
+	// Get opens the object at key; it returns an error matching
+	// ErrObjectNotFound if it does not exist
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Put stores the content of r at key, replacing any existing object
+	Put(ctx context.Context, key string, r io.Reader) error
+}
+
+// ProcessObject is ProcessFile for objects: it reads srcKey from store,
+// removes the background and writes the result to dstKey in the format given
+// by its extension
+func (r *RemBG) ProcessObject(ctx context.Context, store Storage, srcKey, dstKey string, opts *IOOptions) error {
+	if opts == nil {
+		opts = &IOOptions{}
+	}
+	format, err := FormatFromPath(dstKey)
+	if err != nil {
+		return err
+	}
+	if opts.Crop != nil {
+		if err := opts.Crop.Validate(); err != nil {
+			return err
+		}
+	}
+
+	rc, err := store.Get(ctx, srcKey)
+	if err != nil {
+		return fmt.Errorf("failed to get %s: %w", srcKey, err)
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", srcKey, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	encoded, sc, err := r.processData(srcKey, data, format, opts)
+	if err != nil {
+		return err
+	}
+	if err := store.Put(ctx, dstKey, bytes.NewReader(encoded)); err != nil {
+		return fmt.Errorf("failed to put %s: %w", dstKey, err)
+	}
+	if sc == nil {
+		return nil
+	}
+	sc.Input, sc.Output = srcKey, dstKey
+	js, err := sc.marshal()
+	if err != nil {
+		return err
+	}
+	key := sidecarPath(dstKey)
+	if err := store.Put(ctx, key, bytes.NewReader(js)); err != nil {
+		return fmt.Errorf("failed to put %s: %w", key, err)
+	}
+	return nil
+}
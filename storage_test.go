@@ -0,0 +1,88 @@
+package rmbg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image/color"
+	"image/png"
+	"io"
+	"sync"
+	"testing"
+)
+
+// mapStorage is an in-memory Storage
+type mapStorage struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (s *mapStorage) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.objects[key]
+	if !ok {
+		return nil, ErrObjectNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *mapStorage) Put(_ context.Context, key string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = data
+	return nil
+}
+
+func TestProcessObject(t *testing.T) {
+	ctx := context.Background()
+	img := solidImage(16, 8, color.NRGBA{B: 200, A: 255})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	store := &mapStorage{objects: map[string][]byte{"in/a.png": buf.Bytes()}}
+	r := cachedEngine(img)
+
+	t.Run("PNG", func(t *testing.T) {
+		if err := r.ProcessObject(ctx, store, "in/a.png", "out/a.png", nil); err != nil {
+			t.Fatalf("ProcessObject failed: %v", err)
+		}
+		out, err := png.Decode(bytes.NewReader(store.objects["out/a.png"]))
+		if err != nil {
+			t.Fatalf("expected valid PNG, got %v", err)
+		}
+		if out.Bounds() != img.Bounds() {
+			t.Errorf("expected bounds %v, got %v", img.Bounds(), out.Bounds())
+		}
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		err := r.ProcessObject(ctx, store, "in/missing.png", "out/missing.png", nil)
+		if !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("expected ErrObjectNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Format", func(t *testing.T) {
+		err := r.ProcessObject(ctx, store, "in/a.png", "out/a", nil)
+		if err == nil {
+			t.Error("expected an error for a key without extension")
+		}
+		if _, ok := store.objects["out/a"]; ok {
+			t.Error("expected nothing to be written")
+		}
+	})
+
+	t.Run("InvalidImage", func(t *testing.T) {
+		store.objects["in/bad.png"] = []byte("not an image")
+		err := r.ProcessObject(ctx, store, "in/bad.png", "out/bad.png", nil)
+		if !errors.Is(err, ErrInvalidImage) {
+			t.Errorf("expected ErrInvalidImage, got %v", err)
+		}
+	})
+}
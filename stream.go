@@ -0,0 +1,209 @@
+package rmbg
+
+import (
+	"context"
+	"image"
+
+	"github.com/disintegration/imaging"
+)
+
+// streamThumbSize is the side of the thumbnails compared to detect similar
+// frames
+const streamThumbSize = 16
+
+// StreamOptions configures ProcessStream
+type StreamOptions struct {
+	// KeepAll processes every frame. By default frames that arrive while the
+	// previous one is being processed are dropped, except the newest, so the
+	// output keeps up with a live source.
+	KeepAll bool
+	// ReuseThreshold reuses the last mask while the frame differs from the
+	// last inferred one by less than this mean absolute difference (0-255,
+	// measured on a thumbnail); 0 disables reuse
+	ReuseThreshold float64
+	// InferenceInterval runs inference on at most every Nth frame and reuses
+	// the last mask in between (default: 1, every frame)
+	InferenceInterval int
+	// Smoothing blends each mask with the previous ones, see MaskSmoother; it
+	// also eases the switch to a new mask after reused frames (default: 0)
+	Smoothing float64
+}
+
+// StreamResult is the outcome of one frame of a stream
+type StreamResult struct {
+	// Index is the position of the frame in the input, counting dropped frames
+	Index int
+	// Result is the processed frame, nil if Err is set
+	Result *Result
+	// Inferred is false when the mask was reused from an earlier frame
+	Inferred bool
+	// Dropped is the number of frames dropped since the previous result
+	Dropped int
+	// Err is the error for this frame only
+	Err error
+}
+
+// streamFrame is a frame waiting to be processed
+type streamFrame struct {
+	index   int
+	img     image.Image
+	dropped int
+}
+
+// ProcessStream removes the background of frames received from in, for live
+// sources such as a webcam. Unless opts.KeepAll is set, frames arriving while
+// the engine is busy are dropped in favor of the newest one, and
+// opts.ReuseThreshold and opts.InferenceInterval trade mask freshness for
+// fewer inferences. Results are sent in input order; the returned channel is
+// closed once in is closed and drained, or ctx is canceled.
+func (r *RemBG) ProcessStream(ctx context.Context, in <-chan image.Image, opts *StreamOptions) (<-chan StreamResult, error) {
+	if opts == nil {
+		opts = &StreamOptions{}
+	}
+	var smoother *MaskSmoother
+	if opts.Smoothing != 0 {
+		var err error
+		if smoother, err = NewMaskSmoother(opts.Smoothing); err != nil {
+			return nil, err
+		}
+	}
+
+	frames := make(chan streamFrame)
+	go streamIntake(ctx, in, frames, opts.KeepAll)
+
+	out := make(chan StreamResult)
+	go func() {
+		defer close(out)
+		s := &streamState{r: r, opts: opts, smoother: smoother}
+		for f := range frames {
+			if ctx.Err() != nil {
+				break
+			}
+			res := s.frame(f.img)
+			res.Index, res.Dropped = f.index, f.dropped
+			select {
+			case out <- res:
+			case <-ctx.Done():
+			}
+		}
+		// The intake stops on cancellation; drain it so it can exit
+		for range frames {
+		}
+	}()
+	return out, nil
+}
+
+// streamIntake forwards frames from in to frames. Unless keepAll is set, a
+// frame still pending when a newer one arrives is replaced by it.
+func streamIntake(ctx context.Context, in <-chan image.Image, frames chan<- streamFrame, keepAll bool) {
+	defer close(frames)
+	var (
+		pending    streamFrame
+		hasPending bool
+		index      int
+		dropped    int
+	)
+	for {
+		src, dst := in, frames
+		if !hasPending {
+			dst = nil
+		} else if keepAll {
+			src = nil
+		}
+
+		select {
+		case img, ok := <-src:
+			if !ok {
+				if hasPending {
+					select {
+					case frames <- pending:
+					case <-ctx.Done():
+					}
+				}
+				return
+			}
+			if hasPending {
+				dropped++
+			}
+			pending, hasPending = streamFrame{index: index, img: img, dropped: dropped}, true
+			index++
+		case dst <- pending:
+			hasPending, dropped = false, 0
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// streamState holds the mask reused across the frames of a stream
+type streamState struct {
+	r        *RemBG
+	opts     *StreamOptions
+	smoother *MaskSmoother
+
+	last      *prediction
+	lastSize  image.Point
+	lastThumb []uint8
+	// since is the number of frames since the last inference
+	since int
+}
+
+// frame processes one frame, reusing the last mask when allowed
+func (s *streamState) frame(img image.Image) StreamResult {
+	start := s.r.stats.begin()
+	size := img.Bounds().Size()
+	var thumb []uint8
+	if s.opts.ReuseThreshold > 0 {
+		thumb = frameThumbnail(img)
+	}
+
+	s.since++
+	reuse := s.last != nil && s.lastSize == size &&
+		(s.since < s.opts.InferenceInterval ||
+			thumb != nil && meanAbsDiff(thumb, s.lastThumb) < s.opts.ReuseThreshold)
+
+	if !reuse {
+		pred, err := s.r.predict(img)
+		if err != nil {
+			return StreamResult{Err: err}
+		}
+		s.last, s.lastSize, s.lastThumb, s.since = pred, size, thumb, 0
+	}
+
+	pred := s.last
+	if s.smoother != nil {
+		mask := image.NewGray(pred.mask.Rect)
+		copy(mask.Pix, pred.mask.Pix)
+		s.smoother.Apply(mask)
+		pred = &prediction{mask: mask, confidence: pred.confidence, model: pred.model, downscale: pred.downscale}
+	}
+	res, err := s.r.compose(img, pred, start)
+	if err != nil {
+		return StreamResult{Err: err}
+	}
+	return StreamResult{Result: res, Inferred: !reuse}
+}
+
+// frameThumbnail returns the luminance of img shrunk to streamThumbSize
+func frameThumbnail(img image.Image) []uint8 {
+	small := imaging.Resize(img, streamThumbSize, streamThumbSize, imaging.Box)
+	thumb := make([]uint8, streamThumbSize*streamThumbSize)
+	for i := range thumb {
+		p := small.Pix[i*4:]
+		thumb[i] = uint8((299*uint32(p[0]) + 587*uint32(p[1]) + 114*uint32(p[2])) / 1000)
+	}
+	return thumb
+}
+
+// meanAbsDiff returns the mean absolute difference of two thumbnails
+func meanAbsDiff(a, b []uint8) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 255
+	}
+	var sum int
+	for i := range a {
+		d := int(a[i]) - int(b[i])
+		sum += max(d, -d)
+	}
+	return float64(sum) / float64(len(a))
+}
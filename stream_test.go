@@ -0,0 +1,121 @@
+package rmbg
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+	"time"
+)
+
+func collect(out <-chan StreamResult) []StreamResult {
+	var results []StreamResult
+	for res := range out {
+		results = append(results, res)
+	}
+	return results
+}
+
+func feed(imgs ...image.Image) <-chan image.Image {
+	in := make(chan image.Image, len(imgs))
+	for _, img := range imgs {
+		in <- img
+	}
+	close(in)
+	return in
+}
+
+func TestProcessStream(t *testing.T) {
+	ctx := context.Background()
+	red := solidImage(16, 8, color.NRGBA{R: 200, A: 255})
+	nearRed := solidImage(16, 8, color.NRGBA{R: 201, A: 255})
+	blue := solidImage(16, 8, color.NRGBA{B: 200, A: 255})
+	r := cachedEngine(red, nearRed, blue)
+
+	t.Run("KeepAll", func(t *testing.T) {
+		out, err := r.ProcessStream(ctx, feed(red, blue, red), &StreamOptions{KeepAll: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		results := collect(out)
+		if len(results) != 3 {
+			t.Fatalf("expected 3 results, got %d", len(results))
+		}
+		for i, res := range results {
+			if res.Err != nil || res.Index != i || !res.Inferred || res.Dropped != 0 {
+				t.Errorf("result %d: unexpected %+v", i, res)
+			}
+			if res.Result.Mask.Bounds() != red.Bounds() {
+				t.Errorf("result %d: expected mask bounds %v, got %v", i, red.Bounds(), res.Result.Mask.Bounds())
+			}
+		}
+	})
+
+	t.Run("InferenceInterval", func(t *testing.T) {
+		out, err := r.ProcessStream(ctx, feed(red, blue, red, blue, red), &StreamOptions{KeepAll: true, InferenceInterval: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, res := range collect(out) {
+			if expected := i%2 == 0; res.Inferred != expected {
+				t.Errorf("frame %d: expected inferred %v, got %v", i, expected, res.Inferred)
+			}
+		}
+	})
+
+	t.Run("Reuse", func(t *testing.T) {
+		out, err := r.ProcessStream(ctx, feed(red, nearRed, blue), &StreamOptions{KeepAll: true, ReuseThreshold: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var inferred []bool
+		for _, res := range collect(out) {
+			inferred = append(inferred, res.Inferred)
+		}
+		if len(inferred) != 3 || !inferred[0] || inferred[1] || !inferred[2] {
+			t.Errorf("expected similar frame to reuse the mask, got %v", inferred)
+		}
+	})
+
+	t.Run("Drop", func(t *testing.T) {
+		out, err := r.ProcessStream(ctx, feed(red, blue, red, blue, red), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Let the intake run ahead of the blocked worker
+		time.Sleep(20 * time.Millisecond)
+		results := collect(out)
+		if len(results) > 2 {
+			t.Errorf("expected frames to be dropped, got %d results", len(results))
+		}
+		total := 0
+		for _, res := range results {
+			total += 1 + res.Dropped
+		}
+		if total != 5 {
+			t.Errorf("expected results and drops to add up to 5, got %d", total)
+		}
+		if last := results[len(results)-1]; last.Index != 4 {
+			t.Errorf("expected the newest frame to be kept, got index %d", last.Index)
+		}
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		in := make(chan image.Image)
+		out, err := r.ProcessStream(ctx, in, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		in <- red
+		cancel()
+		collect(out)
+	})
+
+	t.Run("InvalidSmoothing", func(t *testing.T) {
+		if _, err := r.ProcessStream(ctx, feed(), &StreamOptions{Smoothing: 1}); !errors.Is(err, ErrInvalidSmoothing) {
+			t.Errorf("expected ErrInvalidSmoothing, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,86 @@
+package rmbg
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+)
+
+// SVGOptions configures EncodeSVG
+type SVGOptions struct {
+	// Contour configures the outline the raster is clipped by (default:
+	// ExtractContours defaults)
+	Contour *ContourConfig
+}
+
+// EncodeSVG writes img to w as an SVG cropped to the object of mask: the
+// pixels under the object's bounding box are embedded as a PNG and clipped by
+// the vectorized mask contour, so the outline stays sharp at any scale and can
+// serve as a die-cut path. The SVG is in pixels of img, with the same
+// coordinates. It returns ErrNoObjectDetected when the contour is empty.
+func EncodeSVG(w io.Writer, img image.Image, mask *image.Gray, opts *SVGOptions) error {
+	if opts == nil {
+		opts = &SVGOptions{}
+	}
+	b := img.Bounds()
+	if mask.Bounds().Size() != b.Size() {
+		return fmt.Errorf("svg: %v mask for a %v image", mask.Bounds().Size(), b.Size())
+	}
+	// Contours are traced in mask coordinates; move the mask onto img
+	aligned := &image.Gray{Pix: mask.Pix, Stride: mask.Stride, Rect: b}
+	polygons := ExtractContours(aligned, opts.Contour)
+	crop := polygonBounds(polygons).Intersect(b)
+	if crop.Empty() {
+		return ErrNoObjectDetected
+	}
+
+	var raster image.Image
+	if isDeep(img) {
+		dst := image.NewNRGBA64(crop)
+		draw.Draw(dst, crop, img, crop.Min, draw.Src)
+		raster = dst
+	} else {
+		dst := image.NewNRGBA(crop)
+		draw.Draw(dst, crop, img, crop.Min, draw.Src)
+		raster = dst
+	}
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, raster); err != nil {
+		return fmt.Errorf("svg: %w", err)
+	}
+
+	x, y, width, height := crop.Min.X, crop.Min.Y, crop.Dx(), crop.Dy()
+	_, err := fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="%d %d %d %d">
+  <defs>
+    <clipPath id="object">
+      <path fill-rule="nonzero" d="%s"/>
+    </clipPath>
+  </defs>
+  <image x="%d" y="%d" width="%d" height="%d" clip-path="url(#object)" href="data:image/png;base64,%s"/>
+</svg>
+`, width, height, x, y, width, height, SVGPath(polygons),
+		x, y, width, height, base64.StdEncoding.EncodeToString(encoded.Bytes()))
+	return err
+}
+
+// polygonBounds returns the smallest whole-pixel rectangle covering polygons
+func polygonBounds(polygons []Polygon) image.Rectangle {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, poly := range polygons {
+		for _, p := range poly {
+			minX, minY = min(minX, p.X), min(minY, p.Y)
+			maxX, maxY = max(maxX, p.X), max(maxY, p.Y)
+		}
+	}
+	if minX > maxX {
+		return image.Rectangle{}
+	}
+	return image.Rect(int(math.Floor(minX)), int(math.Floor(minY)), int(math.Ceil(maxX)), int(math.Ceil(maxY)))
+}
@@ -0,0 +1,112 @@
+package rmbg
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// svgDoc is the part of EncodeSVG's output the tests check
+type svgDoc struct {
+	Width   int    `xml:"width,attr"`
+	Height  int    `xml:"height,attr"`
+	ViewBox string `xml:"viewBox,attr"`
+	Path    struct {
+		D string `xml:"d,attr"`
+	} `xml:"defs>clipPath>path"`
+	Image struct {
+		X        int    `xml:"x,attr"`
+		Y        int    `xml:"y,attr"`
+		ClipPath string `xml:"clip-path,attr"`
+		Href     string `xml:"href,attr"`
+	} `xml:"image"`
+}
+
+func TestEncodeSVG(t *testing.T) {
+	img := gradientImage(40, 30)
+	mask := image.NewGray(image.Rect(0, 0, 40, 30))
+	for y := 10; y < 20; y++ {
+		for x := 5; x < 25; x++ {
+			mask.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeSVG(&buf, img, mask, nil); err != nil {
+		t.Fatalf("EncodeSVG failed: %v", err)
+	}
+	var doc svgDoc
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("expected valid XML, got %v", err)
+	}
+	if doc.ViewBox != "5 10 20 10" || doc.Width != 20 || doc.Height != 10 {
+		t.Errorf("expected a 20x10 view box at 5,10, got %q %dx%d", doc.ViewBox, doc.Width, doc.Height)
+	}
+	if !strings.HasPrefix(doc.Path.D, "M") || doc.Image.ClipPath != "url(#object)" {
+		t.Errorf("expected the image clipped by a path, got %q clipped by %q", doc.Path.D, doc.Image.ClipPath)
+	}
+	if doc.Image.X != 5 || doc.Image.Y != 10 {
+		t.Errorf("expected the image at 5,10, got %d,%d", doc.Image.X, doc.Image.Y)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(doc.Image.Href, "data:image/png;base64,"))
+	if err != nil {
+		t.Fatalf("expected a base64 PNG, got %v", err)
+	}
+	raster, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("expected a PNG, got %v", err)
+	}
+	if got := raster.Bounds().Size(); got != image.Pt(20, 10) {
+		t.Errorf("expected a 20x10 raster, got %v", got)
+	}
+	if got, want := raster.At(0, 0), img.At(5, 10); color.NRGBAModel.Convert(got) != color.NRGBAModel.Convert(want) {
+		t.Errorf("expected the source pixel %v, got %v", want, got)
+	}
+
+	t.Run("Offset", func(t *testing.T) {
+		// The mask is matched to img by size, not coordinates
+		moved := image.NewGray(mask.Bounds().Add(image.Pt(100, 100)))
+		copy(moved.Pix, mask.Pix)
+		var buf bytes.Buffer
+		if err := EncodeSVG(&buf, img, moved, nil); err != nil {
+			t.Fatalf("EncodeSVG failed: %v", err)
+		}
+		var doc svgDoc
+		if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil || doc.ViewBox != "5 10 20 10" {
+			t.Errorf("expected view box 5 10 20 10, got %q (%v)", doc.ViewBox, err)
+		}
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		empty := image.NewGray(mask.Bounds())
+		if err := EncodeSVG(&buf, img, empty, nil); !errors.Is(err, ErrNoObjectDetected) {
+			t.Errorf("expected ErrNoObjectDetected, got %v", err)
+		}
+	})
+}
+
+func TestRemoveBackgroundSVG(t *testing.T) {
+	src := solidImage(20, 10, color.NRGBA{R: 255, A: 255})
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, src); err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	var out bytes.Buffer
+	if err := cachedEngine(src).RemoveBackgroundFrom(&encoded, &out, FormatSVG, nil); err != nil {
+		t.Fatalf("RemoveBackgroundFrom failed: %v", err)
+	}
+	var doc svgDoc
+	if err := xml.Unmarshal(out.Bytes(), &doc); err != nil {
+		t.Fatalf("expected valid SVG, got %v", err)
+	}
+	if doc.ViewBox != "0 0 20 10" {
+		t.Errorf("expected the whole image, got view box %q", doc.ViewBox)
+	}
+}
@@ -1,45 +1,127 @@
 package rmbg
 
 import (
+	"context"
+	"errors"
 	"sync"
-
-	ort "github.com/yalue/onnxruntime_go"
 )
 
-type tensorPool struct {
-	inputPool  sync.Pool
-	outputPool sync.Pool
+// Backend runs a segmentation model outside of the bundled ONNX Runtime
+// bindings, e.g. onnxruntime-web through JavaScript interop in a browser. See
+// Config.Backend.
+type Backend interface {
+	// Run fills output, the 1×1×N×N map of the model, from input, the 1×3×N×N
+	// normalized image, where N is the input size of the model's spec. The
+	// output of multi-class models is 1×C×N×N, C being the number of classes
+	// of the spec. It is called from one goroutine per engine session at a
+	// time.
+	Run(input, output []float32) error
 }
 
-func newTensorPool() *tensorPool {
-	return &tensorPool{
-		inputPool: sync.Pool{
-			New: func() any {
-				t, _ := ort.NewEmptyTensor[float32](ort.NewShape(1, 3, inputSize, inputSize))
-				return t
-			},
-		},
-		outputPool: sync.Pool{
-			New: func() any {
-				t, _ := ort.NewEmptyTensor[float32](ort.NewShape(1, 1, inputSize, inputSize))
-				return t
-			},
-		},
+// session runs a model for one caller at a time
+type session interface {
+	// run copies input in, runs the model and copies its map to output
+	run(input, output []float32) error
+	destroy() error
+}
+
+// backendSession is a session running on a Backend
+type backendSession struct {
+	backend Backend
+}
+
+func (s *backendSession) run(input, output []float32) error {
+	return s.backend.Run(input, output)
+}
+
+func (s *backendSession) destroy() error {
+	return nil
+}
+
+// sessionPool hands out sessions to one caller at a time, so concurrent calls
+// run on different sessions instead of queueing on a lock
+type sessionPool struct {
+	slots chan session
+	all   []session
+}
+
+func newSessionPool(sessions []session) *sessionPool {
+	p := &sessionPool{
+		slots: make(chan session, len(sessions)),
+		all:   sessions,
+	}
+	for _, s := range sessions {
+		p.slots <- s
 	}
+	return p
 }
 
-func (p *tensorPool) getInput() *ort.Tensor[float32] {
-	return p.inputPool.Get().(*ort.Tensor[float32])
+// acquire blocks until a session is free. It reports false once the pool is
+// closed.
+func (p *sessionPool) acquire() (session, bool) {
+	s, ok := <-p.slots
+	return s, ok
 }
 
-func (p *tensorPool) putInput(t *ort.Tensor[float32]) {
-	p.inputPool.Put(t)
+// acquireContext is acquire bounded by ctx. It returns ErrClosed once the pool
+// is closed.
+func (p *sessionPool) acquireContext(ctx context.Context) (session, error) {
+	select {
+	case s, ok := <-p.slots:
+		if !ok {
+			return nil, ErrClosed
+		}
+		return s, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (p *sessionPool) release(s session) {
+	p.slots <- s
+}
+
+func (p *sessionPool) size() int {
+	return len(p.all)
+}
+
+// close waits until every session is released, then destroys them. It must be
+// called once.
+func (p *sessionPool) close() error {
+	for range p.all {
+		<-p.slots
+	}
+	close(p.slots)
+
+	var errs []error
+	for _, s := range p.all {
+		errs = append(errs, s.destroy())
+	}
+	p.all = nil
+	return errors.Join(errs...)
+}
+
+// floatPool recycles float32 planes of a fixed length, used to stage model
+// inputs and outputs outside of the sessions
+type floatPool struct {
+	pool sync.Pool
+}
+
+func newFloatPool(size int) *floatPool {
+	return &floatPool{
+		pool: sync.Pool{
+			New: func() any {
+				buf := make([]float32, size)
+				return &buf
+			},
+		},
+	}
 }
 
-func (p *tensorPool) getOutput() *ort.Tensor[float32] {
-	return p.outputPool.Get().(*ort.Tensor[float32])
+func (p *floatPool) get() *[]float32 {
+	return p.pool.Get().(*[]float32)
 }
 
-func (p *tensorPool) putOutput(t *ort.Tensor[float32]) {
-	p.outputPool.Put(t)
+func (p *floatPool) put(buf *[]float32) {
+	p.pool.Put(buf)
 }
@@ -0,0 +1,11 @@
+//go:build !cgo
+
+package rmbg
+
+import "fmt"
+
+// newORTSessions is unreachable without cgo, as the environment cannot be
+// acquired
+func newORTSessions(*Config, string, ModelSpec) ([]session, error) {
+	return nil, fmt.Errorf("%w: %w", ErrRuntimeUnavailable, errNoCgo)
+}
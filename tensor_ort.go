@@ -0,0 +1,244 @@
+//go:build cgo
+
+package rmbg
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// newORTSessions creates config.Sessions ONNX Runtime sessions of the model at
+// modelPath. The environment must be acquired.
+func newORTSessions(config *Config, modelPath string, spec ModelSpec) ([]session, error) {
+	options, err := newSessionOptions(config)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = options.Destroy()
+	}()
+
+	sessions := make([]session, max(1, config.Sessions))
+	for i := range sessions {
+		sessions[i], err = newBoundSession(modelPath, spec, options)
+		if err != nil {
+			for _, s := range sessions[:i] {
+				_ = s.destroy()
+			}
+			return nil, diagnoseSessionError(modelPath, spec, err)
+		}
+	}
+	return sessions, nil
+}
+
+// boundSession is a session whose input and output tensors are bound at
+// creation, so a run needs no per-call tensor setup. It is used by one caller
+// at a time.
+type boundSession struct {
+	session *ort.AdvancedSession
+	input   *ort.Tensor[float32]
+	output  *ort.Tensor[float32]
+}
+
+func newBoundSession(modelPath string, spec ModelSpec, options *ort.SessionOptions) (*boundSession, error) {
+	size := int64(spec.InputSize)
+	input, err := ort.NewEmptyTensor[float32](ort.NewShape(1, 3, size, size))
+	if err != nil {
+		return nil, err
+	}
+	output, err := ort.NewEmptyTensor[float32](ort.NewShape(1, int64(spec.channels()), size, size))
+	if err != nil {
+		_ = input.Destroy()
+		return nil, err
+	}
+
+	session, err := ort.NewAdvancedSession(
+		modelPath,
+		[]string{spec.InputName},
+		[]string{spec.OutputName},
+		[]ort.Value{input},
+		[]ort.Value{output},
+		options,
+	)
+	if err != nil {
+		_ = input.Destroy()
+		_ = output.Destroy()
+		return nil, err
+	}
+	return &boundSession{session: session, input: input, output: output}, nil
+}
+
+func (s *boundSession) run(input, output []float32) error {
+	copy(s.input.GetData(), input)
+	if err := s.session.Run(); err != nil {
+		return err
+	}
+	copy(output, s.output.GetData())
+	return nil
+}
+
+func (s *boundSession) destroy() error {
+	var errs []error
+	if s.session != nil {
+		errs = append(errs, s.session.Destroy())
+	}
+	if s.input != nil {
+		errs = append(errs, s.input.Destroy())
+	}
+	if s.output != nil {
+		errs = append(errs, s.output.Destroy())
+	}
+	return errors.Join(errs...)
+}
+
+// run runs a session on a single float32 input and output tensor with the
+// model's shapes
+func (m *model) run(input []ort.Value, output []ort.Value) error {
+	if len(input) != 1 || len(output) != 1 {
+		return fmt.Errorf("expected one input and one output tensor, got %d and %d", len(input), len(output))
+	}
+	in, ok := input[0].(*ort.Tensor[float32])
+	if !ok {
+		return fmt.Errorf("expected float32 input tensor, got %T", input[0])
+	}
+	out, ok := output[0].(*ort.Tensor[float32])
+	if !ok {
+		return fmt.Errorf("expected float32 output tensor, got %T", output[0])
+	}
+	size := m.spec.InputSize * m.spec.InputSize
+	outSize := m.spec.channels() * size
+	if len(in.GetData()) != 3*size || len(out.GetData()) != outSize {
+		return fmt.Errorf("expected tensors of %d and %d values, got %d and %d", 3*size, outSize, len(in.GetData()), len(out.GetData()))
+	}
+	return m.runData(in.GetData(), out.GetData())
+}
+
+// RunInference runs a session of the default model on raw tensors: one float32
+// input and one float32 output with the model's shapes
+func (r *RemBG) RunInference(input []ort.Value, output []ort.Value) error {
+	m := r.acquireModel()
+	defer m.release()
+	return m.run(input, output)
+}
+
+// sessionThreading returns the thread counts and execution mode of the sessions.
+// Deterministic mode runs every operator on a single thread, in graph order, so
+// float reductions are always accumulated in the same order.
+func sessionThreading(config *Config) (intraOp, interOp int, mode ort.ExecutionMode) {
+	if config.Deterministic {
+		return 1, 1, ort.ExecutionModeSequential
+	}
+	return config.IntraOpNumThreads, config.InterOpNumThreads, ort.ExecutionModeParallel
+}
+
+func newSessionOptions(config *Config) (*ort.SessionOptions, error) {
+	options, err := ort.NewSessionOptions()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session options: %w", err)
+	}
+
+	intraOp, interOp, mode := sessionThreading(config)
+	err = options.SetIntraOpNumThreads(intraOp)
+	if err != nil {
+		_ = options.Destroy()
+		return nil, fmt.Errorf("failed to set intra-op num threads: %w", err)
+	}
+	err = options.SetInterOpNumThreads(interOp)
+	if err != nil {
+		_ = options.Destroy()
+		return nil, fmt.Errorf("failed to set inter-op num threads: %w", err)
+	}
+	err = options.SetCpuMemArena(config.CpuMemArena)
+	if err != nil {
+		_ = options.Destroy()
+		return nil, fmt.Errorf("failed to set cpu memory arena: %w", err)
+	}
+	err = options.SetMemPattern(config.MemPattern)
+	if err != nil {
+		_ = options.Destroy()
+		return nil, fmt.Errorf("failed to set memory pattern: %w", err)
+	}
+	err = options.SetExecutionMode(mode)
+	if err != nil {
+		_ = options.Destroy()
+		return nil, fmt.Errorf("failed to set execution mode: %w", err)
+	}
+	err = options.SetGraphOptimizationLevel(ort.GraphOptimizationLevelEnableAll)
+	if err != nil {
+		_ = options.Destroy()
+		return nil, fmt.Errorf("failed to set graph optimization level: %w", err)
+	}
+	err = appendProvider(options, config.Provider, config.DeviceID)
+	if err != nil {
+		_ = options.Destroy()
+		return nil, fmt.Errorf("failed to enable %v execution provider: %w", config.Provider, err)
+	}
+
+	return options, nil
+}
+
+// appendProvider enables p on options. device selects the GPU for the CUDA,
+// TensorRT and DirectML providers.
+func appendProvider(options *ort.SessionOptions, p Provider, device int) error {
+	deviceOptions := map[string]string{"device_id": strconv.Itoa(device)}
+
+	switch p {
+	case ProviderCPU:
+		return nil
+	case ProviderCUDA:
+		cuda, err := ort.NewCUDAProviderOptions()
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = cuda.Destroy()
+		}()
+		if err := cuda.Update(deviceOptions); err != nil {
+			return err
+		}
+		return options.AppendExecutionProviderCUDA(cuda)
+	case ProviderTensorRT:
+		trt, err := ort.NewTensorRTProviderOptions()
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = trt.Destroy()
+		}()
+		if err := trt.Update(deviceOptions); err != nil {
+			return err
+		}
+		return options.AppendExecutionProviderTensorRT(trt)
+	case ProviderCoreML:
+		return options.AppendExecutionProviderCoreMLV2(nil)
+	case ProviderDirectML:
+		return options.AppendExecutionProviderDirectML(device)
+	case ProviderOpenVINO:
+		return options.AppendExecutionProviderOpenVINO(nil)
+	}
+	return fmt.Errorf("unknown execution provider %v", p)
+}
+
+// diagnoseSessionError explains a failure to create a session for spec,
+// reporting ErrUnsupportedModel when the model lacks the expected tensors
+func diagnoseSessionError(path string, spec ModelSpec, err error) error {
+	inputs, outputs, infoErr := ort.GetInputOutputInfo(path)
+	if infoErr != nil {
+		return fmt.Errorf("failed to create ONNX session: %w", err)
+	}
+	if mismatch := tensorMismatch(spec, tensorNames(inputs), tensorNames(outputs)); mismatch != "" {
+		return fmt.Errorf("%w: %s: %s", ErrUnsupportedModel, path, mismatch)
+	}
+	return fmt.Errorf("failed to create ONNX session: %w", err)
+}
+
+func tensorNames(info []ort.InputOutputInfo) []string {
+	names := make([]string, len(info))
+	for i, v := range info {
+		names[i] = v.Name
+	}
+	return names
+}
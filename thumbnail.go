@@ -0,0 +1,61 @@
+package rmbg
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// thumbnailMargin is the margin kept around the subject of a thumbnail, as a
+// fraction of its size
+const thumbnailMargin = 0.1
+
+// Thumbnail returns a width x height thumbnail of img framed on its subject:
+// it segments img, crops around the object at the aspect ratio of the
+// thumbnail and resizes the crop with a Lanczos filter. The crop stays within
+// the image, so when the subject and its margin do not fit at that aspect
+// ratio the margin is cut rather than padded. Images without a detected
+// object are center-cropped.
+func (r *RemBG) Thumbnail(img image.Image, width, height int) (*image.NRGBA, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid thumbnail size %dx%d", width, height)
+	}
+	mask, err := r.predictMask(img)
+	if err != nil {
+		return nil, err
+	}
+	rect, err := thumbnailRegion(img.Bounds(), mask, float64(width)/float64(height))
+	if errors.Is(err, ErrNoObjectDetected) {
+		return imaging.Fill(img, width, height, imaging.Center, imaging.Lanczos), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return imaging.Resize(imaging.Crop(img, rect), width, height, imaging.Lanczos), nil
+}
+
+// thumbnailRegion computes the crop of a thumbnail with the given aspect
+// ratio, in image coordinates, from the model mask
+func thumbnailRegion(bounds image.Rectangle, mask *image.Gray, ratio float64) (image.Rectangle, error) {
+	config := &CropConfig{MarginPercent: thumbnailMargin, MinThreshold: 10, AspectRatio: ratio}
+	mb := mask.Bounds()
+	reg, err := cropRegion(bounds, mask, config,
+		float64(bounds.Dx())/float64(mb.Dx()),
+		float64(bounds.Dy())/float64(mb.Dy()))
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+
+	// Shrink crops larger than the image around their center
+	rect := reg.crop
+	if scale := math.Min(float64(bounds.Dx())/float64(rect.Dx()), float64(bounds.Dy())/float64(rect.Dy())); scale < 1 {
+		w := max(1, min(bounds.Dx(), int(math.Round(float64(rect.Dx())*scale))))
+		h := max(1, min(bounds.Dy(), int(math.Round(float64(rect.Dy())*scale))))
+		c := rect.Min.Add(rect.Max).Div(2)
+		rect = image.Rect(c.X-w/2, c.Y-h/2, c.X-w/2+w, c.Y-h/2+h)
+	}
+	return shiftInside(rect, bounds), nil
+}
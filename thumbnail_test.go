@@ -0,0 +1,79 @@
+package rmbg
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestThumbnailRegion(t *testing.T) {
+	bounds := image.Rect(0, 0, 200, 100)
+	// A 20x20 object in the right half
+	mask := image.NewGray(bounds)
+	fillRect(mask, image.Rect(140, 40, 160, 60), 255)
+
+	tests := []struct {
+		name  string
+		ratio float64
+		want  image.Rectangle
+	}{
+		{"Square", 1, image.Rect(139, 39, 160, 60)},
+		{"Wide", 2, image.Rect(129, 39, 171, 60)},
+		// Wider crops pull in more of the surroundings
+		{"Panorama", 4, image.Rect(108, 39, 192, 60)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := thumbnailRegion(bounds, mask, tt.ratio)
+			if err != nil {
+				t.Fatalf("thumbnailRegion failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("LargerThanImage", func(t *testing.T) {
+		full := image.NewGray(bounds)
+		fillRect(full, bounds, 255)
+		got, err := thumbnailRegion(bounds, full, 1)
+		if err != nil {
+			t.Fatalf("thumbnailRegion failed: %v", err)
+		}
+		if want := image.Rect(50, 0, 150, 100); got != want {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("Offset", func(t *testing.T) {
+		offset := bounds.Add(image.Pt(10, 10))
+		got, err := thumbnailRegion(offset, mask, 1)
+		if err != nil {
+			t.Fatalf("thumbnailRegion failed: %v", err)
+		}
+		if want := image.Rect(149, 49, 170, 70); got != want {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+	})
+}
+
+func TestThumbnail(t *testing.T) {
+	red := solidImage(60, 30, color.NRGBA{R: 255, A: 255})
+	r := cachedEngine(red)
+
+	thumb, err := r.Thumbnail(red, 16, 16)
+	if err != nil {
+		t.Fatalf("Thumbnail failed: %v", err)
+	}
+	if got := thumb.Bounds().Size(); got != image.Pt(16, 16) {
+		t.Errorf("expected 16x16, got %v", got)
+	}
+	if got := thumb.NRGBAAt(8, 8); got != (color.NRGBA{R: 255, A: 255}) {
+		t.Errorf("expected the source color, got %v", got)
+	}
+
+	if _, err := r.Thumbnail(red, 0, 16); err == nil {
+		t.Errorf("expected error for an empty size")
+	}
+}
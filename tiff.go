@@ -0,0 +1,47 @@
+package rmbg
+
+import (
+	"image"
+	"image/draw"
+	"io"
+
+	"golang.org/x/image/tiff"
+)
+
+// TIFFOptions configures EncodeTIFF
+type TIFFOptions struct {
+	// Depth16 writes 16 bits per channel even for 8-bit images, for prepress
+	// pipelines that expect them; 16-bit images always keep 16 bits
+	Depth16 bool
+}
+
+// EncodeTIFF writes img to w as a Deflate-compressed TIFF. Transparency is
+// kept as an unassociated alpha channel, as PNG does.
+func EncodeTIFF(w io.Writer, img image.Image, opts *TIFFOptions) error {
+	if opts == nil {
+		opts = &TIFFOptions{}
+	}
+	return tiff.Encode(w, tiffImage(img, opts.Depth16), &tiff.Options{Compression: tiff.Deflate})
+}
+
+// tiffImage converts img to a type the TIFF encoder writes with the wanted
+// depth and without losing alpha
+func tiffImage(img image.Image, depth16 bool) image.Image {
+	switch img.(type) {
+	case *image.NRGBA64, *image.RGBA64, *image.Gray16:
+		return img
+	case *image.NRGBA, *image.RGBA, *image.Gray:
+		if !depth16 {
+			return img
+		}
+	}
+	b := img.Bounds()
+	if depth16 {
+		dst := image.NewNRGBA64(b)
+		draw.Draw(dst, b, img, b.Min, draw.Src)
+		return dst
+	}
+	dst := image.NewNRGBA(b)
+	draw.Draw(dst, b, img, b.Min, draw.Src)
+	return dst
+}
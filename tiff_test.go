@@ -0,0 +1,70 @@
+package rmbg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestEncodeTIFF(t *testing.T) {
+	src := gradientImage(30, 20)
+
+	t.Run("Depth8", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := EncodeTIFF(&buf, src, nil); err != nil {
+			t.Fatalf("EncodeTIFF failed: %v", err)
+		}
+		img, err := DecodeImage(&buf, nil)
+		if err != nil {
+			t.Fatalf("failed to decode: %v", err)
+		}
+		got, ok := img.(*image.NRGBA)
+		if !ok {
+			t.Fatalf("expected *image.NRGBA, got %T", img)
+		}
+		if !bytes.Equal(got.Pix, src.Pix) {
+			t.Errorf("expected pixels to round-trip")
+		}
+	})
+
+	t.Run("Depth16", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := EncodeTIFF(&buf, src, &TIFFOptions{Depth16: true}); err != nil {
+			t.Fatalf("EncodeTIFF failed: %v", err)
+		}
+		img, err := DecodeImage(&buf, nil)
+		if err != nil {
+			t.Fatalf("failed to decode: %v", err)
+		}
+		got, ok := img.(*image.NRGBA64)
+		if !ok {
+			t.Fatalf("expected *image.NRGBA64, got %T", img)
+		}
+		for y := range 20 {
+			for x := range 30 {
+				if c, want := got.NRGBA64At(x, y), color.NRGBA64Model.Convert(src.NRGBAAt(x, y)); c != want {
+					t.Fatalf("expected %v at %d,%d, got %v", want, x, y, c)
+				}
+			}
+		}
+	})
+
+	t.Run("Premultiplied", func(t *testing.T) {
+		// Keeps 16-bit input at 16 bits and converts premultiplied alpha
+		src := image.NewRGBA64(image.Rect(0, 0, 2, 1))
+		src.SetRGBA64(0, 0, color.RGBA64{R: 0x1234, A: 0x8000})
+		var buf bytes.Buffer
+		if err := EncodeTIFF(&buf, src, &TIFFOptions{Depth16: true}); err != nil {
+			t.Fatalf("EncodeTIFF failed: %v", err)
+		}
+		img, err := DecodeImage(&buf, nil)
+		if err != nil {
+			t.Fatalf("failed to decode: %v", err)
+		}
+		r, _, _, a := img.At(0, 0).RGBA()
+		if r != 0x1234 || a != 0x8000 {
+			t.Errorf("expected 1234/8000, got %x/%x", r, a)
+		}
+	})
+}
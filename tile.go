@@ -0,0 +1,139 @@
+package rmbg
+
+import (
+	"fmt"
+	"image"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/disintegration/imaging"
+)
+
+// useTiles reports whether img is large enough to be segmented in tiles
+func (r *RemBG) useTiles(img image.Image) bool {
+	b := img.Bounds()
+	return r.tileSize > 0 && (b.Dx() > r.tileSize || b.Dy() > r.tileSize)
+}
+
+// predictTiled splits img into overlapping tiles of r.tileSize pixels, runs the
+// model on each and blends the tile masks with feathered seams. The mask keeps
+// the model's pixel density per tile, so it is larger than the model input.
+func (r *RemBG) predictTiled(m *model, img image.Image) (*prediction, error) {
+	start := time.Now()
+	bounds := img.Bounds()
+	tile, overlap := r.tileSize, r.tileOverlap
+	scale := float64(m.spec.InputSize) / float64(tile)
+	w := max(1, int(math.Round(float64(bounds.Dx())*scale)))
+	h := max(1, int(math.Round(float64(bounds.Dy())*scale)))
+
+	acc := make([]float32, w*h)
+	weights := make([]float32, w*h)
+	feather := max(1, float64(overlap)*scale)
+
+	var timing stageTimes
+	xs := tileStarts(bounds.Dx(), tile, overlap)
+	ys := tileStarts(bounds.Dy(), tile, overlap)
+	r.log(slog.LevelDebug, "tiled prediction",
+		slog.Int("tiles", len(xs)*len(ys)),
+		slog.Int("tile_size", tile),
+		slog.Int("overlap", overlap),
+	)
+	for _, ty := range ys {
+		for _, tx := range xs {
+			rect := image.Rect(tx, ty, min(tx+tile, bounds.Dx()), min(ty+tile, bounds.Dy()))
+			pred, err := m.predict(imaging.Crop(img, rect.Add(bounds.Min)))
+			if err != nil {
+				return nil, fmt.Errorf("tile %v: %w", rect, err)
+			}
+			timing = timing.add(pred.timing)
+
+			// Tile rectangle in mask space
+			x0 := int(math.Round(float64(rect.Min.X) * scale))
+			y0 := int(math.Round(float64(rect.Min.Y) * scale))
+			x1 := min(w, int(math.Round(float64(rect.Max.X)*scale)))
+			y1 := min(h, int(math.Round(float64(rect.Max.Y)*scale)))
+			tw, th := x1-x0, y1-y0
+			if tw <= 0 || th <= 0 {
+				continue
+			}
+			sx := float64(pred.mask.Bounds().Dx()) / float64(tw)
+			sy := float64(pred.mask.Bounds().Dy()) / float64(th)
+
+			for y := range th {
+				wy := edgeWeight(y, th, feather, y0 > 0, y1 < h)
+				for x := range tw {
+					wx := edgeWeight(x, tw, feather, x0 > 0, x1 < w)
+					weight := max(wx*wy, 1e-3)
+					v := sampleGray(pred.mask, (float64(x)+0.5)*sx-0.5, (float64(y)+0.5)*sy-0.5)
+					i := (y0+y)*w + x0 + x
+					acc[i] += float32(weight * v)
+					weights[i] += float32(weight)
+				}
+			}
+		}
+	}
+
+	mask := image.NewGray(image.Rect(0, 0, w, h))
+	probs := make([]float32, w*h)
+	for i := range acc {
+		if weights[i] > 0 {
+			probs[i] = acc[i] / weights[i] / 255
+		}
+		mask.Pix[i] = uint8(math.Round(float64(probs[i]) * 255))
+	}
+
+	// Tile cropping and blending count as decoding
+	timing.decode = time.Since(start) - timing.preprocess - timing.inference
+	return &prediction{
+		mask:       mask,
+		confidence: computeConfidence(probs, 0.5),
+		timing:     timing,
+		model:      m.spec.Name,
+	}, nil
+}
+
+// tileStarts returns the start offsets of tiles of the given size covering
+// [0, size) with at least overlap pixels shared by neighbors
+func tileStarts(size, tile, overlap int) []int {
+	if size <= tile {
+		return []int{0}
+	}
+	step := tile - overlap
+	var starts []int
+	for s := 0; ; s += step {
+		if s+tile >= size {
+			return append(starts, size-tile)
+		}
+		starts = append(starts, s)
+	}
+}
+
+// edgeWeight ramps from 0 to 1 over feather pixels at the tile sides that
+// border another tile; sides on the image border keep full weight
+func edgeWeight(i, n int, feather float64, lo, hi bool) float64 {
+	weight := 1.0
+	if lo {
+		weight = min(weight, (float64(i)+0.5)/feather)
+	}
+	if hi {
+		weight = min(weight, (float64(n-i)-0.5)/feather)
+	}
+	return weight
+}
+
+// sampleGray bilinearly samples src at (fx, fy), relative to its bounds, clamping
+// at the edges
+func sampleGray(src *image.Gray, fx, fy float64) float64 {
+	b := src.Bounds()
+	fx = max(0, min(fx, float64(b.Dx()-1)))
+	fy = max(0, min(fy, float64(b.Dy()-1)))
+	x0, y0 := int(fx), int(fy)
+	x1, y1 := min(x0+1, b.Dx()-1), min(y0+1, b.Dy()-1)
+	ax, ay := fx-float64(x0), fy-float64(y0)
+
+	at := func(x, y int) float64 { return float64(src.Pix[y*src.Stride+x]) }
+	top := at(x0, y0) + (at(x1, y0)-at(x0, y0))*ax
+	bottom := at(x0, y1) + (at(x1, y1)-at(x0, y1))*ax
+	return top + (bottom-top)*ay
+}
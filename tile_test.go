@@ -0,0 +1,67 @@
+package rmbg
+
+import (
+	"image"
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestTileStarts(t *testing.T) {
+	tests := []struct {
+		size, tile, overlap int
+		want                []int
+	}{
+		{500, 1000, 100, []int{0}},
+		{1000, 1000, 100, []int{0}},
+		{1800, 1000, 200, []int{0, 800}},
+		{2500, 1000, 100, []int{0, 900, 1500}},
+	}
+	for _, tt := range tests {
+		got := tileStarts(tt.size, tt.tile, tt.overlap)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("tileStarts(%d, %d, %d): expected %v, got %v", tt.size, tt.tile, tt.overlap, tt.want, got)
+		}
+		// Neighbors must overlap by at least the requested amount
+		for i := 1; i < len(got); i++ {
+			if got[i-1]+tt.tile-got[i] < tt.overlap {
+				t.Errorf("tiles at %d and %d overlap less than %d", got[i-1], got[i], tt.overlap)
+			}
+		}
+	}
+}
+
+func TestEdgeWeight(t *testing.T) {
+	if w := edgeWeight(0, 100, 10, false, false); w != 1 {
+		t.Errorf("expected full weight at image border, got %f", w)
+	}
+	if w := edgeWeight(0, 100, 10, true, false); w >= 0.1 {
+		t.Errorf("expected low weight at shared edge, got %f", w)
+	}
+	if w := edgeWeight(99, 100, 10, false, true); w >= 0.1 {
+		t.Errorf("expected low weight at shared edge, got %f", w)
+	}
+	if w := edgeWeight(50, 100, 10, true, true); w != 1 {
+		t.Errorf("expected full weight in the tile center, got %f", w)
+	}
+}
+
+func TestSampleGray(t *testing.T) {
+	src := image.NewGray(image.Rect(10, 10, 12, 12))
+	src.Pix = []uint8{0, 100, 100, 200}
+
+	tests := []struct {
+		x, y, want float64
+	}{
+		{0, 0, 0},
+		{1, 1, 200},
+		{0.5, 0.5, 100},
+		{0.5, 0, 50},
+		{-5, 5, 100},
+	}
+	for _, tt := range tests {
+		if got := sampleGray(src, tt.x, tt.y); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("sampleGray(%g, %g): expected %g, got %g", tt.x, tt.y, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package video
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+)
+
+// FFmpegPath is the ffmpeg binary run by OpenFFmpeg and CreateFFmpeg
+var FFmpegPath = "ffmpeg"
+
+// FFmpegSource is a Source decoding a video with ffmpeg
+type FFmpegSource struct {
+	*RawReader
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+}
+
+// OpenFFmpeg starts ffmpeg decoding input to frames scaled to width×height
+func OpenFFmpeg(ctx context.Context, input string, width, height int) (*FFmpegSource, error) {
+	cmd := exec.CommandContext(ctx, FFmpegPath,
+		"-loglevel", "error",
+		"-i", input,
+		"-vf", fmt.Sprintf("scale=%d:%d", width, height),
+		"-f", "rawvideo", "-pix_fmt", "rgb24",
+		"pipe:1",
+	)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+	return &FFmpegSource{RawReader: NewRawReader(stdout, width, height), cmd: cmd, stdout: stdout}, nil
+}
+
+// Close stops ffmpeg and waits for it to exit
+func (s *FFmpegSource) Close() error {
+	s.stdout.Close()
+	if err := s.cmd.Wait(); err != nil {
+		var exitErr *exec.ExitError
+		// Closing the pipe early kills ffmpeg with a broken pipe
+		if errors.As(err, &exitErr) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// FFmpegSink is a Sink encoding a video with ffmpeg
+type FFmpegSink struct {
+	*RawWriter
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+}
+
+// CreateFFmpeg starts ffmpeg encoding width×height frames at fps to output.
+// outputArgs are passed before output to select the codec; without them the
+// video is encoded as VP9 with alpha, which suits a .webm output.
+func CreateFFmpeg(ctx context.Context, output string, width, height int, fps float64, outputArgs ...string) (*FFmpegSink, error) {
+	if len(outputArgs) == 0 {
+		outputArgs = []string{"-c:v", "libvpx-vp9", "-pix_fmt", "yuva420p"}
+	}
+	args := []string{
+		"-loglevel", "error", "-y",
+		"-f", "rawvideo", "-pix_fmt", "rgba",
+		"-s", fmt.Sprintf("%dx%d", width, height),
+		"-r", strconv.FormatFloat(fps, 'f', -1, 64),
+		"-i", "pipe:0",
+	}
+	args = append(append(args, outputArgs...), output)
+
+	cmd := exec.CommandContext(ctx, FFmpegPath, args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+	return &FFmpegSink{RawWriter: NewRawWriter(stdin, width, height), cmd: cmd, stdin: stdin}, nil
+}
+
+// Close finishes the video and waits for ffmpeg to write it
+func (s *FFmpegSink) Close() error {
+	if err := s.stdin.Close(); err != nil {
+		return err
+	}
+	if err := s.cmd.Wait(); err != nil {
+		return fmt.Errorf("ffmpeg failed: %w", err)
+	}
+	return nil
+}
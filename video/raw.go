@@ -0,0 +1,61 @@
+package video
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+)
+
+// RawReader reads frames of packed 8-bit RGB (ffmpeg's rgb24) of a fixed size
+type RawReader struct {
+	r             io.Reader
+	width, height int
+	buf           []byte
+}
+
+// NewRawReader creates a reader of width×height frames
+func NewRawReader(r io.Reader, width, height int) *RawReader {
+	return &RawReader{r: r, width: width, height: height, buf: make([]byte, width*height*3)}
+}
+
+// Next implements Source. A truncated last frame returns io.ErrUnexpectedEOF.
+func (rr *RawReader) Next() (image.Image, error) {
+	if _, err := io.ReadFull(rr.r, rr.buf); err != nil {
+		return nil, err
+	}
+	img := image.NewRGBA(image.Rect(0, 0, rr.width, rr.height))
+	for i, j := 0, 0; i < len(rr.buf); i, j = i+3, j+4 {
+		img.Pix[j] = rr.buf[i]
+		img.Pix[j+1] = rr.buf[i+1]
+		img.Pix[j+2] = rr.buf[i+2]
+		img.Pix[j+3] = 255
+	}
+	return img, nil
+}
+
+// RawWriter writes frames as packed 8-bit RGBA with straight alpha (ffmpeg's
+// rgba)
+type RawWriter struct {
+	w             io.Writer
+	width, height int
+}
+
+// NewRawWriter creates a writer of width×height frames
+func NewRawWriter(w io.Writer, width, height int) *RawWriter {
+	return &RawWriter{w: w, width: width, height: height}
+}
+
+// Write implements Sink
+func (rw *RawWriter) Write(frame image.Image) error {
+	if size := frame.Bounds().Size(); size != image.Pt(rw.width, rw.height) {
+		return fmt.Errorf("frame size %v does not match %dx%d", size, rw.width, rw.height)
+	}
+	img, ok := frame.(*image.NRGBA)
+	if !ok || img.Stride != rw.width*4 {
+		img = image.NewNRGBA(image.Rect(0, 0, rw.width, rw.height))
+		draw.Draw(img, img.Rect, frame, frame.Bounds().Min, draw.Src)
+	}
+	_, err := rw.w.Write(img.Pix[:rw.width*rw.height*4])
+	return err
+}
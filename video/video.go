@@ -0,0 +1,169 @@
+// Package video removes the background of video frames. Masks of consecutive
+// frames are blended so the edges do not flicker, and frames are emitted with
+// alpha or over a replacement background.
+//
+// Frames come from a Source and go to a Sink; RawReader and RawWriter speak
+// the raw formats ffmpeg pipes, and OpenFFmpeg and CreateFFmpeg run it.
+package video
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+
+	"github.com/disintegration/imaging"
+	"github.com/josuedeavila/rmbg"
+)
+
+// Source yields frames; Next returns io.EOF after the last one
+type Source interface {
+	Next() (image.Image, error)
+}
+
+// Sink consumes frames
+type Sink interface {
+	Write(frame image.Image) error
+}
+
+// Segmenter computes the mask of a frame; *rmbg.RemBG implements it
+type Segmenter interface {
+	Process(img image.Image) (*rmbg.Result, error)
+}
+
+// Config configures a Processor
+type Config struct {
+	// Smoothing is the weight of the previous frames in each mask, from 0
+	// (no smoothing) to below 1; higher values flicker less but lag behind
+	// fast motion (default: rmbg.DefaultSmoothing)
+	Smoothing *float64
+	// Background replaces the background; nil keeps it transparent
+	Background color.Color
+	// BackgroundImage replaces the background with an image, scaled to fill
+	// the frame (overrides Background)
+	BackgroundImage image.Image
+}
+
+// Processor removes the background of consecutive frames of one video. It is
+// not safe for concurrent use.
+type Processor struct {
+	seg        Segmenter
+	smoother   *rmbg.MaskSmoother
+	background color.Color
+	bgImage    image.Image
+
+	// bg is BackgroundImage scaled to the frame size
+	bg *image.NRGBA
+}
+
+// NewProcessor creates a processor segmenting frames with seg
+func NewProcessor(seg Segmenter, config *Config) (*Processor, error) {
+	if config == nil {
+		config = &Config{}
+	}
+	smoothing := rmbg.DefaultSmoothing
+	if config.Smoothing != nil {
+		smoothing = *config.Smoothing
+	}
+	smoother, err := rmbg.NewMaskSmoother(smoothing)
+	if err != nil {
+		return nil, err
+	}
+	return &Processor{
+		seg:        seg,
+		smoother:   smoother,
+		background: config.Background,
+		bgImage:    config.BackgroundImage,
+	}, nil
+}
+
+// Reset forgets the previous frames, e.g. at a scene cut
+func (p *Processor) Reset() {
+	p.smoother.Reset()
+}
+
+// Frame removes the background of the next frame
+func (p *Processor) Frame(frame image.Image) (*image.NRGBA, error) {
+	res, err := p.seg.Process(frame)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Release()
+
+	b := frame.Bounds()
+	if res.Mask == nil || res.Mask.Bounds().Size() != b.Size() {
+		return nil, fmt.Errorf("mask size does not match frame size %v", b.Size())
+	}
+	p.smoother.Apply(res.Mask)
+	return p.blend(frame, res.Mask), nil
+}
+
+// blend applies mask to frame, over the background if one is set
+func (p *Processor) blend(frame image.Image, mask *image.Gray) *image.NRGBA {
+	b := frame.Bounds()
+	w, h := b.Dx(), b.Dy()
+	out := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(out, out.Bounds(), frame, b.Min, draw.Src)
+
+	var bg *image.NRGBA
+	switch {
+	case p.bgImage != nil:
+		if p.bg == nil || p.bg.Bounds().Size() != b.Size() {
+			p.bg = imaging.Fill(p.bgImage, w, h, imaging.Center, imaging.Linear)
+		}
+		bg = p.bg
+	case p.background != nil:
+		bg = image.NewNRGBA(out.Rect)
+		draw.Draw(bg, bg.Rect, image.NewUniform(p.background), image.Point{}, draw.Src)
+	}
+
+	for y := range h {
+		row := out.Pix[y*out.Stride:][:w*4]
+		for x, a := range mask.Pix[y*mask.Stride:][:w] {
+			o := x * 4
+			if bg == nil {
+				row[o+3] = uint8(uint32(row[o+3]) * uint32(a) / 255)
+				continue
+			}
+			fa, ba := uint32(a), 255-uint32(a)
+			bgRow := bg.Pix[y*bg.Stride:]
+			for c := range 3 {
+				row[o+c] = uint8((uint32(row[o+c])*fa + uint32(bgRow[o+c])*ba + 127) / 255)
+			}
+			row[o+3] = bgRow[o+3]
+		}
+	}
+	return out
+}
+
+// Process runs every frame of src through a new processor into dst until src
+// is exhausted or ctx is canceled, and returns the number of frames written
+func Process(ctx context.Context, seg Segmenter, src Source, dst Sink, config *Config) (int, error) {
+	p, err := NewProcessor(seg, config)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		frame, err := src.Next()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, fmt.Errorf("failed to read frame %d: %w", n, err)
+		}
+		out, err := p.Frame(frame)
+		if err != nil {
+			return n, fmt.Errorf("frame %d: %w", n, err)
+		}
+		if err := dst.Write(out); err != nil {
+			return n, fmt.Errorf("failed to write frame %d: %w", n, err)
+		}
+		n++
+	}
+}
@@ -0,0 +1,182 @@
+package video
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"testing"
+
+	"github.com/josuedeavila/rmbg"
+)
+
+var _ Segmenter = (*rmbg.RemBG)(nil)
+
+// fakeSegmenter returns masks filled with the next value of levels
+type fakeSegmenter struct {
+	levels []uint8
+}
+
+func (s *fakeSegmenter) Process(img image.Image) (*rmbg.Result, error) {
+	if len(s.levels) == 0 {
+		return nil, errors.New("no more masks")
+	}
+	mask := image.NewGray(img.Bounds())
+	for i := range mask.Pix {
+		mask.Pix[i] = s.levels[0]
+	}
+	s.levels = s.levels[1:]
+	return &rmbg.Result{Mask: mask}, nil
+}
+
+func solid(w, h int, c color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	return img
+}
+
+func TestProcessor(t *testing.T) {
+	frame := solid(4, 2, color.NRGBA{R: 200, A: 255})
+
+	t.Run("Smoothing", func(t *testing.T) {
+		half := 0.5
+		p, err := NewProcessor(&fakeSegmenter{levels: []uint8{255, 0, 0}}, &Config{Smoothing: &half})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, expected := range []uint8{255, 128, 64} {
+			out, err := p.Frame(frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a := out.Pix[3]; a != expected {
+				t.Errorf("frame %d: expected alpha %d, got %d", i, expected, a)
+			}
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		zero := 0.0
+		p, err := NewProcessor(&fakeSegmenter{levels: []uint8{255, 0}}, &Config{Smoothing: &zero})
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Frame(frame)
+		out, err := p.Frame(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a := out.Pix[3]; a != 0 {
+			t.Errorf("expected alpha 0 without smoothing, got %d", a)
+		}
+	})
+
+	t.Run("Reset", func(t *testing.T) {
+		p, err := NewProcessor(&fakeSegmenter{levels: []uint8{255, 0}}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Frame(frame)
+		p.Reset()
+		out, err := p.Frame(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a := out.Pix[3]; a != 0 {
+			t.Errorf("expected alpha 0 after Reset, got %d", a)
+		}
+	})
+
+	t.Run("Background", func(t *testing.T) {
+		p, err := NewProcessor(&fakeSegmenter{levels: []uint8{0}}, &Config{Background: color.White})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := p.Frame(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c := out.NRGBAAt(0, 0); c != (color.NRGBA{255, 255, 255, 255}) {
+			t.Errorf("expected white background, got %v", c)
+		}
+	})
+
+	t.Run("BackgroundImage", func(t *testing.T) {
+		bg := solid(8, 8, color.NRGBA{B: 255, A: 255})
+		p, err := NewProcessor(&fakeSegmenter{levels: []uint8{0}}, &Config{BackgroundImage: bg})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := p.Frame(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c := out.NRGBAAt(3, 1); c != (color.NRGBA{B: 255, A: 255}) {
+			t.Errorf("expected blue background, got %v", c)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, v := range []float64{-0.1, 1} {
+			if _, err := NewProcessor(&fakeSegmenter{}, &Config{Smoothing: &v}); !errors.Is(err, rmbg.ErrInvalidSmoothing) {
+				t.Errorf("%g: expected ErrInvalidSmoothing, got %v", v, err)
+			}
+		}
+	})
+}
+
+func TestProcess(t *testing.T) {
+	const w, h = 3, 2
+	var in bytes.Buffer
+	for f := range 3 {
+		for range w * h {
+			in.Write([]byte{byte(f * 10), 20, 30})
+		}
+	}
+
+	var out bytes.Buffer
+	seg := &fakeSegmenter{levels: []uint8{255, 255, 255}}
+	n, err := Process(context.Background(), seg, NewRawReader(&in, w, h), NewRawWriter(&out, w, h), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("expected 3 frames, got %d", n)
+	}
+	if out.Len() != 3*w*h*4 {
+		t.Fatalf("expected %d bytes, got %d", 3*w*h*4, out.Len())
+	}
+	if px := out.Bytes()[2*w*h*4:][:4]; !bytes.Equal(px, []byte{20, 20, 30, 255}) {
+		t.Errorf("expected first pixel of frame 2 to be [20 20 30 255], got %v", px)
+	}
+
+	t.Run("Truncated", func(t *testing.T) {
+		rr := NewRawReader(bytes.NewReader(make([]byte, w*h*3+1)), w, h)
+		if _, err := rr.Next(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := rr.Next(); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("expected ErrUnexpectedEOF, got %v", err)
+		}
+	})
+
+	t.Run("SizeMismatch", func(t *testing.T) {
+		rw := NewRawWriter(io.Discard, w, h)
+		if err := rw.Write(image.NewNRGBA(image.Rect(0, 0, 1, 1))); err == nil {
+			t.Error("expected an error for a frame of the wrong size")
+		}
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		src := NewRawReader(bytes.NewReader(make([]byte, w*h*3)), w, h)
+		if _, err := Process(ctx, &fakeSegmenter{}, src, NewRawWriter(io.Discard, w, h), nil); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	})
+}
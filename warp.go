@@ -0,0 +1,273 @@
+package rmbg
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+)
+
+// Homography is a projective transform of the plane, such as the one between
+// a photographed page and its scan: a 3x3 matrix in row-major order, defined
+// up to scale. Affine transforms have a last row of 0, 0, 1.
+type Homography [9]float64
+
+// IdentityHomography maps every point to itself
+var IdentityHomography = Homography{1, 0, 0, 0, 1, 0, 0, 0, 1}
+
+// EstimateHomography returns the homography mapping each point of from to the
+// point of to with the same index. It fails when three points of either side
+// are collinear.
+func EstimateHomography(from, to [4]Point) (Homography, error) {
+	// Two equations per correspondence in the eight unknowns, with the last
+	// entry fixed to 1
+	a := make([][]float64, 8)
+	for i := range 4 {
+		u, v := from[i].X, from[i].Y
+		x, y := to[i].X, to[i].Y
+		a[2*i] = []float64{u, v, 1, 0, 0, 0, -u * x, -v * x, x}
+		a[2*i+1] = []float64{0, 0, 0, u, v, 1, -u * y, -v * y, y}
+	}
+	sol, err := solveLinear(a)
+	if err != nil {
+		return Homography{}, err
+	}
+	var h Homography
+	copy(h[:], sol)
+	h[8] = 1
+	return h, nil
+}
+
+// EstimateAffine returns the affine transform mapping each point of from to
+// the point of to with the same index. It fails when the points of from are
+// collinear.
+func EstimateAffine(from, to [3]Point) (Homography, error) {
+	a := make([][]float64, 6)
+	for i := range 3 {
+		u, v := from[i].X, from[i].Y
+		a[2*i] = []float64{u, v, 1, 0, 0, 0, to[i].X}
+		a[2*i+1] = []float64{0, 0, 0, u, v, 1, to[i].Y}
+	}
+	sol, err := solveLinear(a)
+	if err != nil {
+		return Homography{}, err
+	}
+	var h Homography
+	copy(h[:], sol)
+	h[8] = 1
+	return h, nil
+}
+
+// solveLinear solves the n equations of a, each row holding n coefficients
+// followed by the right-hand side, by Gauss-Jordan elimination with partial
+// pivoting. It changes a.
+func solveLinear(a [][]float64) ([]float64, error) {
+	n := len(a)
+	for col := range n {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return nil, errors.New("degenerate points: three of them are collinear")
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		for row := range n {
+			if row == col {
+				continue
+			}
+			f := a[row][col] / a[col][col]
+			for k := col; k <= n; k++ {
+				a[row][k] -= f * a[col][k]
+			}
+		}
+	}
+	sol := make([]float64, n)
+	for i := range sol {
+		sol[i] = a[i][n] / a[i][i]
+	}
+	return sol, nil
+}
+
+// Apply maps p through h
+func (h Homography) Apply(p Point) Point {
+	w := h[6]*p.X + h[7]*p.Y + h[8]
+	return Point{
+		X: (h[0]*p.X + h[1]*p.Y + h[2]) / w,
+		Y: (h[3]*p.X + h[4]*p.Y + h[5]) / w,
+	}
+}
+
+// Inverse returns the homography undoing h. It reports false when h is
+// singular.
+func (h Homography) Inverse() (Homography, bool) {
+	// Adjugate divided by the determinant
+	inv := Homography{
+		h[4]*h[8] - h[5]*h[7], h[2]*h[7] - h[1]*h[8], h[1]*h[5] - h[2]*h[4],
+		h[5]*h[6] - h[3]*h[8], h[0]*h[8] - h[2]*h[6], h[2]*h[3] - h[0]*h[5],
+		h[3]*h[7] - h[4]*h[6], h[1]*h[6] - h[0]*h[7], h[0]*h[4] - h[1]*h[3],
+	}
+	det := h[0]*inv[0] + h[1]*inv[3] + h[2]*inv[6]
+	if math.Abs(det) < 1e-12 {
+		return Homography{}, false
+	}
+	for i := range inv {
+		inv[i] /= det
+	}
+	return inv, true
+}
+
+// Then returns the homography applying h, then next
+func (h Homography) Then(next Homography) Homography {
+	var out Homography
+	for r := range 3 {
+		for c := range 3 {
+			for k := range 3 {
+				out[r*3+c] += next[r*3+k] * h[k*3+c]
+			}
+		}
+	}
+	return out
+}
+
+// WarpImage returns the width x height image of img transformed by h, which
+// maps points of img, relative to its origin, to points of the output. Pixels
+// are sampled bilinearly; those coming from outside img are transparent. It
+// fails when h is singular.
+func WarpImage(img image.Image, h Homography, width, height int) (*image.NRGBA, error) {
+	inv, err := warpInverse(h, width, height)
+	if err != nil {
+		return nil, err
+	}
+	return warpNRGBA(toNRGBA(img), inv, width, height), nil
+}
+
+// WarpMask is WarpImage for a mask. Pixels coming from outside mask are 0.
+func WarpMask(mask *image.Gray, h Homography, width, height int) (*image.Gray, error) {
+	inv, err := warpInverse(h, width, height)
+	if err != nil {
+		return nil, err
+	}
+	return warpGray(mask, inv, width, height), nil
+}
+
+// WarpQuad returns the width x height image of the quadrilateral q of img,
+// relative to its origin, stretched over the whole output, e.g. to rectify a
+// photographed page, painting or screen
+func WarpQuad(img image.Image, q Quad, width, height int) (*image.NRGBA, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("%w: warp size %dx%d", ErrInvalidSize, width, height)
+	}
+	toImage, err := EstimateHomography(outputQuad(width, height), q)
+	if err != nil {
+		return nil, err
+	}
+	return warpNRGBA(toNRGBA(img), toImage, width, height), nil
+}
+
+// outputQuad returns the corners of a width x height output
+func outputQuad(width, height int) Quad {
+	w, h := float64(width), float64(height)
+	return Quad{{0, 0}, {w, 0}, {w, h}, {0, h}}
+}
+
+// warpInverse checks the output size of a warp and returns the inverse of h,
+// which maps output pixels to their source
+func warpInverse(h Homography, width, height int) (Homography, error) {
+	if width <= 0 || height <= 0 {
+		return Homography{}, fmt.Errorf("%w: warp size %dx%d", ErrInvalidSize, width, height)
+	}
+	inv, ok := h.Inverse()
+	if !ok {
+		return Homography{}, errors.New("singular homography")
+	}
+	return inv, nil
+}
+
+// bilinearTap locates a point of a w x h grid for bilinear sampling: the
+// pixels x0, x1 and y0, y1 around it, relative to the grid origin, and the
+// weights fx, fy of x1 and y1. It reports false for points outside the grid.
+func bilinearTap(p Point, w, h int) (x0, y0, x1, y1 int, fx, fy float64, ok bool) {
+	// Pixel centers sit at half coordinates
+	sx, sy := p.X-0.5, p.Y-0.5
+	if !(sx >= -0.5 && sx <= float64(w)-0.5 && sy >= -0.5 && sy <= float64(h)-0.5) {
+		return 0, 0, 0, 0, 0, 0, false
+	}
+	sx = min(max(sx, 0), float64(w-1))
+	sy = min(max(sy, 0), float64(h-1))
+	x0, y0 = int(sx), int(sy)
+	x1, y1 = min(x0+1, w-1), min(y0+1, h-1)
+	return x0, y0, x1, y1, sx - float64(x0), sy - float64(y0), true
+}
+
+// warpNRGBA returns the w x h image whose pixel centers are mapped by h to
+// src, relative to its origin, and sampled bilinearly. Pixels mapped outside
+// src are transparent.
+func warpNRGBA(src *image.NRGBA, h Homography, w, hgt int) *image.NRGBA {
+	dst := image.NewNRGBA(image.Rect(0, 0, w, hgt))
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	parallelRows(hgt, func(start, end int) {
+		for y := start; y < end; y++ {
+			row := dst.Pix[y*dst.Stride:][:w*4]
+			for x := range w {
+				p := h.Apply(Point{float64(x) + 0.5, float64(y) + 0.5})
+				x0, y0, x1, y1, fx, fy, ok := bilinearTap(p, sw, sh)
+				if !ok {
+					continue
+				}
+				// Interpolate premultiplied colors, so transparent pixels
+				// do not bleed into their neighbors
+				var sum [4]float64
+				for _, tap := range [4]struct {
+					x, y int
+					wt   float64
+				}{
+					{x0, y0, (1 - fx) * (1 - fy)},
+					{x1, y0, fx * (1 - fy)},
+					{x0, y1, (1 - fx) * fy},
+					{x1, y1, fx * fy},
+				} {
+					s := src.Pix[tap.y*src.Stride+tap.x*4:][:4]
+					a := float64(s[3]) * tap.wt
+					sum[0] += float64(s[0]) * a
+					sum[1] += float64(s[1]) * a
+					sum[2] += float64(s[2]) * a
+					sum[3] += a
+				}
+				o := row[x*4 : x*4+4]
+				if sum[3] > 0 {
+					for c := range 3 {
+						o[c] = uint8(min(sum[c]/sum[3]+0.5, 255))
+					}
+				}
+				o[3] = uint8(min(sum[3]+0.5, 255))
+			}
+		}
+	})
+	return dst
+}
+
+// warpGray is warpNRGBA for a mask. Pixels mapped outside src are 0.
+func warpGray(src *image.Gray, h Homography, w, hgt int) *image.Gray {
+	dst := image.NewGray(image.Rect(0, 0, w, hgt))
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	parallelRows(hgt, func(start, end int) {
+		for y := start; y < end; y++ {
+			row := dst.Pix[y*dst.Stride:][:w]
+			for x := range w {
+				p := h.Apply(Point{float64(x) + 0.5, float64(y) + 0.5})
+				x0, y0, x1, y1, fx, fy, ok := bilinearTap(p, sw, sh)
+				if !ok {
+					continue
+				}
+				at := func(x, y int) float64 { return float64(src.Pix[y*src.Stride+x]) }
+				top := at(x0, y0)*(1-fx) + at(x1, y0)*fx
+				bottom := at(x0, y1)*(1-fx) + at(x1, y1)*fx
+				row[x] = uint8(top*(1-fy) + bottom*fy + 0.5)
+			}
+		}
+	})
+	return dst
+}
@@ -0,0 +1,142 @@
+package rmbg
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func near(p, q Point) bool {
+	return math.Abs(p.X-q.X) < 1e-9 && math.Abs(p.Y-q.Y) < 1e-9
+}
+
+func TestHomography(t *testing.T) {
+	from := [4]Point{{0, 0}, {10, 0}, {10, 10}, {0, 10}}
+	to := [4]Point{{5, 5}, {30, 8}, {28, 40}, {2, 35}}
+	h, err := EstimateHomography(from, to)
+	if err != nil {
+		t.Fatalf("EstimateHomography failed: %v", err)
+	}
+	for i := range from {
+		if p := h.Apply(from[i]); !near(p, to[i]) {
+			t.Errorf("expected %v, got %v", to[i], p)
+		}
+	}
+
+	t.Run("Inverse", func(t *testing.T) {
+		inv, ok := h.Inverse()
+		if !ok {
+			t.Fatal("expected an inverse")
+		}
+		for i := range to {
+			if p := inv.Apply(to[i]); !near(p, from[i]) {
+				t.Errorf("expected %v, got %v", from[i], p)
+			}
+		}
+		if _, ok := (Homography{}).Inverse(); ok {
+			t.Error("expected no inverse of a singular matrix")
+		}
+	})
+
+	t.Run("Then", func(t *testing.T) {
+		shift := Homography{1, 0, 3, 0, 1, -2, 0, 0, 1}
+		p := Point{4, 6}
+		if got, want := h.Then(shift).Apply(p), shift.Apply(h.Apply(p)); !near(got, want) {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+		if got := IdentityHomography.Then(h).Apply(p); !near(got, h.Apply(p)) {
+			t.Errorf("expected %v, got %v", h.Apply(p), got)
+		}
+	})
+
+	t.Run("Collinear", func(t *testing.T) {
+		if _, err := EstimateHomography(from, [4]Point{{0, 0}, {1, 1}, {2, 2}, {3, 3}}); err == nil {
+			t.Error("expected error for collinear points")
+		}
+	})
+}
+
+func TestEstimateAffine(t *testing.T) {
+	from := [3]Point{{0, 0}, {10, 0}, {0, 10}}
+	to := [3]Point{{2, 3}, {12, 8}, {-3, 13}}
+	h, err := EstimateAffine(from, to)
+	if err != nil {
+		t.Fatalf("EstimateAffine failed: %v", err)
+	}
+	if h[6] != 0 || h[7] != 0 || h[8] != 1 {
+		t.Errorf("expected affine last row, got %v", h[6:])
+	}
+	for i := range from {
+		if p := h.Apply(from[i]); !near(p, to[i]) {
+			t.Errorf("expected %v, got %v", to[i], p)
+		}
+	}
+	if p := h.Apply(Point{10, 10}); !near(p, Point{7, 18}) {
+		t.Errorf("expected parallelogram corner (7,18), got %v", p)
+	}
+	if _, err := EstimateAffine([3]Point{{0, 0}, {1, 1}, {2, 2}}, to); err == nil {
+		t.Error("expected error for collinear points")
+	}
+}
+
+func TestWarp(t *testing.T) {
+	red := color.NRGBA{R: 255, A: 255}
+	img := solidImage(20, 10, color.NRGBA{B: 255, A: 255})
+	for y := range 10 {
+		for x := range 10 {
+			img.SetNRGBA(x, y, red)
+		}
+	}
+
+	t.Run("Image", func(t *testing.T) {
+		// Double the size and shift right by 10
+		h := Homography{2, 0, 10, 0, 2, 0, 0, 0, 1}
+		out, err := WarpImage(img, h, 60, 20)
+		if err != nil {
+			t.Fatalf("WarpImage failed: %v", err)
+		}
+		if c := out.NRGBAAt(5, 10); c.A != 0 {
+			t.Errorf("expected transparent left of the image, got %v", c)
+		}
+		if c := out.NRGBAAt(15, 10); c != red {
+			t.Errorf("expected red, got %v", c)
+		}
+		if c := out.NRGBAAt(45, 10); c.B != 255 || c.A != 255 {
+			t.Errorf("expected blue, got %v", c)
+		}
+		if _, err := WarpImage(img, Homography{}, 10, 10); err == nil {
+			t.Error("expected error for a singular homography")
+		}
+		if _, err := WarpImage(img, IdentityHomography, 0, 10); err == nil {
+			t.Error("expected error for an empty output")
+		}
+	})
+
+	t.Run("Mask", func(t *testing.T) {
+		mask := image.NewGray(image.Rect(0, 0, 10, 10))
+		fillRect(mask, image.Rect(0, 0, 5, 10), 255)
+		// Mirror horizontally
+		out, err := WarpMask(mask, Homography{-1, 0, 10, 0, 1, 0, 0, 0, 1}, 10, 10)
+		if err != nil {
+			t.Fatalf("WarpMask failed: %v", err)
+		}
+		if out.GrayAt(8, 5).Y != 255 || out.GrayAt(1, 5).Y != 0 {
+			t.Errorf("expected the mask mirrored, got %d and %d", out.GrayAt(8, 5).Y, out.GrayAt(1, 5).Y)
+		}
+	})
+
+	t.Run("Quad", func(t *testing.T) {
+		out, err := WarpQuad(img, Quad{{10, 0}, {20, 0}, {20, 10}, {10, 10}}, 4, 4)
+		if err != nil {
+			t.Fatalf("WarpQuad failed: %v", err)
+		}
+		for y := range 4 {
+			for x := range 4 {
+				if c := out.NRGBAAt(x, y); c.B != 255 || c.A != 255 {
+					t.Fatalf("expected the blue half, got %v at (%d,%d)", c, x, y)
+				}
+			}
+		}
+	})
+}
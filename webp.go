@@ -0,0 +1,253 @@
+package rmbg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+
+	"github.com/disintegration/imaging"
+)
+
+// DefaultWebPQuality is the lossy WebP quality used when none is set
+const DefaultWebPQuality = 90
+
+// WebPOptions configures EncodeWebP
+type WebPOptions struct {
+	// Lossless keeps every pixel exact, at the cost of larger files
+	Lossless bool
+	// Quality is the lossy quality from 1 to 100 (default: DefaultWebPQuality)
+	Quality int
+}
+
+const (
+	vp8xAlpha = 0x10
+	vp8xICC   = 0x20
+	vp8xEXIF  = 0x08
+	vp8xXMP   = 0x04
+
+	// alphCompressed marks an ALPH chunk holding a headerless VP8L stream,
+	// without filtering
+	alphCompressed = 0x01
+
+	// iccSegmentHeader is the length of the "ICC_PROFILE" header, sequence
+	// number and count of a JPEG APP2 segment
+	iccSegmentHeader = 14
+)
+
+// EncodeWebP writes img to w as WebP. Lossy images keep their alpha channel
+// exact, in a losslessly compressed plane next to the lossy color.
+func EncodeWebP(w io.Writer, img image.Image, opts *WebPOptions) error {
+	if opts == nil {
+		opts = &WebPOptions{}
+	}
+	b := img.Bounds()
+	if b.Dx() < 1 || b.Dy() < 1 || b.Dx() > vp8lMaxSide || b.Dy() > vp8lMaxSide {
+		return fmt.Errorf("webp: cannot encode a %dx%d image: sides must be within [1, %d]", b.Dx(), b.Dy(), vp8lMaxSide)
+	}
+	src := imaging.Clone(img)
+	width, height := src.Rect.Dx(), src.Rect.Dy()
+
+	var chunks []riffChunk
+	if opts.Lossless {
+		pix := make([]uint32, width*height)
+		for i := range pix {
+			p := src.Pix[i*4:][:4]
+			if p[3] != 0 {
+				pix[i] = uint32(p[3])<<24 | uint32(p[0])<<16 | uint32(p[1])<<8 | uint32(p[2])
+			}
+			// Invisible pixels stay transparent black, which compresses best
+		}
+		chunks = []riffChunk{{"VP8L", encodeVP8L(pix, width, height)}}
+	} else {
+		quality := opts.Quality
+		if quality <= 0 {
+			quality = DefaultWebPQuality
+		}
+		vp8, err := encodeVP8(src, quality)
+		if err != nil {
+			return err
+		}
+		alpha := make([]uint8, width*height)
+		opaque := true
+		for i := range alpha {
+			alpha[i] = src.Pix[i*4+3]
+			opaque = opaque && alpha[i] == 0xff
+		}
+		if !opaque {
+			chunks = append(chunks,
+				vp8xChunk(vp8xAlpha, width, height),
+				riffChunk{"ALPH", append([]byte{alphCompressed}, encodeVP8LAlpha(alpha, width, height)...)},
+			)
+		}
+		chunks = append(chunks, riffChunk{"VP8 ", vp8})
+	}
+	_, err := w.Write(writeRIFF(chunks))
+	return err
+}
+
+// riffChunk is a chunk of a WebP file
+type riffChunk struct {
+	id   string
+	data []byte
+}
+
+// writeRIFF assembles a WebP file from its chunks
+func writeRIFF(chunks []riffChunk) []byte {
+	size := 4
+	for _, c := range chunks {
+		size += 8 + len(c.data) + len(c.data)&1
+	}
+	out := make([]byte, 0, 8+size)
+	out = append(out, "RIFF"...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(size))
+	out = append(out, "WEBP"...)
+	for _, c := range chunks {
+		out = append(out, c.id...)
+		out = binary.LittleEndian.AppendUint32(out, uint32(len(c.data)))
+		out = append(out, c.data...)
+		if len(c.data)&1 == 1 {
+			out = append(out, 0)
+		}
+	}
+	return out
+}
+
+// readRIFF splits a WebP file into its chunks, or returns nil when data is
+// not a well-formed WebP file
+func readRIFF(data []byte) []riffChunk {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil
+	}
+	var chunks []riffChunk
+	for i := 12; i+8 <= len(data); {
+		n := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + n
+		if n < 0 || end > len(data) {
+			return nil
+		}
+		chunks = append(chunks, riffChunk{string(data[i : i+4]), data[i+8 : end]})
+		i = end + n&1
+	}
+	return chunks
+}
+
+// vp8xChunk returns the extended header of a still image
+func vp8xChunk(flags byte, width, height int) riffChunk {
+	data := make([]byte, 10)
+	data[0] = flags
+	w, h := width-1, height-1
+	data[4], data[5], data[6] = byte(w), byte(w>>8), byte(w>>16)
+	data[7], data[8], data[9] = byte(h), byte(h>>8), byte(h>>16)
+	return riffChunk{"VP8X", data}
+}
+
+// readWebPMetadata extracts the EXIF, XMP and ICCP chunks of a WebP file
+func readWebPMetadata(data []byte) metadata {
+	var md metadata
+	for _, c := range readRIFF(data) {
+		switch c.id {
+		case "EXIF":
+			// Some writers keep the JPEG header
+			md.exif = bytes.TrimPrefix(c.data, exifHeader)
+		case "XMP ":
+			md.xmp = c.data
+		case "ICCP":
+			md.icc = iccSegments(c.data)
+		}
+	}
+	return md
+}
+
+// writeWebPMetadata adds the metadata to an encoded WebP, which then needs
+// the extended VP8X header: the ICC profile goes before the image data and
+// the EXIF block and XMP packet after it
+func writeWebPMetadata(data []byte, md metadata) []byte {
+	chunks := readRIFF(data)
+	profile := iccProfile(md.icc)
+	if chunks == nil || md.exif == nil && md.xmp == nil && profile == nil {
+		return data
+	}
+
+	var flags byte
+	var width, height int
+	var body []riffChunk
+	for _, c := range chunks {
+		switch c.id {
+		case "VP8X":
+			if len(c.data) < 10 {
+				return data
+			}
+			flags = c.data[0]
+			width = int(c.data[4]) | int(c.data[5])<<8 | int(c.data[6])<<16 + 1
+			height = int(c.data[7]) | int(c.data[8])<<8 | int(c.data[9])<<16 + 1
+		case "VP8 ":
+			if width == 0 && len(c.data) >= 10 {
+				width = int(binary.LittleEndian.Uint16(c.data[6:])) & 0x3fff
+				height = int(binary.LittleEndian.Uint16(c.data[8:])) & 0x3fff
+			}
+			body = append(body, c)
+		case "VP8L":
+			// The alpha flag is left clear: the VP8L header carries it, and
+			// golang.org/x/image/webp rejects VP8L images flagged as such
+			if width == 0 && len(c.data) >= 5 {
+				bits := binary.LittleEndian.Uint32(c.data[1:])
+				width, height = int(bits&0x3fff)+1, int(bits>>14&0x3fff)+1
+			}
+			body = append(body, c)
+		default:
+			body = append(body, c)
+		}
+	}
+	if width == 0 {
+		return data
+	}
+
+	out := []riffChunk{{}}
+	if profile != nil {
+		flags |= vp8xICC
+		out = append(out, riffChunk{"ICCP", profile})
+	}
+	out = append(out, body...)
+	if md.exif != nil {
+		flags |= vp8xEXIF
+		out = append(out, riffChunk{"EXIF", md.exif})
+	}
+	if md.xmp != nil {
+		flags |= vp8xXMP
+		out = append(out, riffChunk{"XMP ", md.xmp})
+	}
+	out[0] = vp8xChunk(flags, width, height)
+	return writeRIFF(out)
+}
+
+// iccSegments splits an ICC profile into JPEG APP2 segment payloads
+func iccSegments(profile []byte) [][]byte {
+	const size = jpegMaxSegment - iccSegmentHeader
+	count := (len(profile) + size - 1) / size
+	if count == 0 || count > 255 {
+		return nil
+	}
+	segs := make([][]byte, 0, count)
+	for i := range count {
+		part := profile[i*size : min((i+1)*size, len(profile))]
+		seg := make([]byte, 0, iccSegmentHeader+len(part))
+		seg = append(seg, iccHeader...)
+		seg = append(seg, byte(i+1), byte(count))
+		segs = append(segs, append(seg, part...))
+	}
+	return segs
+}
+
+// iccProfile reassembles the ICC profile held by JPEG APP2 segment payloads,
+// or returns nil if there is none
+func iccProfile(segs [][]byte) []byte {
+	var profile []byte
+	for _, seg := range segs {
+		if len(seg) > iccSegmentHeader {
+			profile = append(profile, seg[iccSegmentHeader:]...)
+		}
+	}
+	return profile
+}
@@ -0,0 +1,664 @@
+package rmbg
+
+import (
+	"math/bits"
+	"slices"
+)
+
+// VP8L lossless bitstream, see
+// https://developers.google.com/speed/webp/docs/webp_lossless_bitstream_specification
+
+const (
+	vp8lSignature = 0x2f
+	// vp8lMaxSide is the largest width or height of a VP8L image
+	vp8lMaxSide = 1 << 14
+
+	vp8lPredictorTransform     = 0
+	vp8lSubtractGreenTransform = 2
+	// vp8lPredictorBits is the log2 side of the predictor transform tiles
+	vp8lPredictorBits = 4
+
+	vp8lLiteralCodes  = 256
+	vp8lLengthCodes   = 24
+	vp8lDistanceCodes = 40
+	// vp8lPlaneCodes are the distance codes mapping to nearby 2D offsets
+	vp8lPlaneCodes = 120
+
+	vp8lMinMatch  = 3
+	vp8lMaxMatch  = 4096
+	vp8lMaxWindow = 1<<20 - vp8lPlaneCodes
+	vp8lHashBits  = 16
+	vp8lMaxChain  = 16
+
+	vp8lMaxCodeLength       = 15
+	vp8lMaxCodeLengthLength = 7
+)
+
+// vp8lCodeLengthOrder is the order in which code length code lengths are sent
+var vp8lCodeLengthOrder = [19]uint8{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// vp8lDistanceMap holds the 2D offsets of the plane codes as 0xYX, with X
+// biased by 8
+var vp8lDistanceMap = [vp8lPlaneCodes]uint8{
+	0x18, 0x07, 0x17, 0x19, 0x28, 0x06, 0x27, 0x29, 0x16, 0x1a,
+	0x26, 0x2a, 0x38, 0x05, 0x37, 0x39, 0x15, 0x1b, 0x36, 0x3a,
+	0x25, 0x2b, 0x48, 0x04, 0x47, 0x49, 0x14, 0x1c, 0x35, 0x3b,
+	0x46, 0x4a, 0x24, 0x2c, 0x58, 0x45, 0x4b, 0x34, 0x3c, 0x03,
+	0x57, 0x59, 0x13, 0x1d, 0x56, 0x5a, 0x23, 0x2d, 0x44, 0x4c,
+	0x55, 0x5b, 0x33, 0x3d, 0x68, 0x02, 0x67, 0x69, 0x12, 0x1e,
+	0x66, 0x6a, 0x22, 0x2e, 0x54, 0x5c, 0x43, 0x4d, 0x65, 0x6b,
+	0x32, 0x3e, 0x78, 0x01, 0x77, 0x79, 0x53, 0x5d, 0x11, 0x1f,
+	0x64, 0x6c, 0x42, 0x4e, 0x76, 0x7a, 0x21, 0x2f, 0x75, 0x7b,
+	0x31, 0x3f, 0x63, 0x6d, 0x52, 0x5e, 0x00, 0x74, 0x7c, 0x41,
+	0x4f, 0x10, 0x20, 0x62, 0x6e, 0x30, 0x73, 0x7d, 0x51, 0x5f,
+	0x40, 0x72, 0x7e, 0x61, 0x6f, 0x50, 0x71, 0x7f, 0x60, 0x70,
+}
+
+// bitWriter accumulates the least significant bit first stream of VP8L
+type bitWriter struct {
+	buf  []byte
+	acc  uint64
+	nacc uint
+}
+
+// write appends the n low bits of v
+func (w *bitWriter) write(v uint32, n uint) {
+	w.acc |= uint64(v) << w.nacc
+	w.nacc += n
+	for w.nacc >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.nacc -= 8
+	}
+}
+
+// bytes flushes the pending bits, padding the last byte with zeros
+func (w *bitWriter) bytes() []byte {
+	if w.nacc > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.nacc = 0, 0
+	}
+	return w.buf
+}
+
+// encodeVP8L encodes ARGB pixels as the payload of a VP8L chunk
+func encodeVP8L(pix []uint32, width, height int) []byte {
+	alpha := uint32(0)
+	for _, p := range pix {
+		if p>>24 != 0xff {
+			alpha = 1
+			break
+		}
+	}
+	w := &bitWriter{}
+	w.write(vp8lSignature, 8)
+	w.write(uint32(width-1), 14)
+	w.write(uint32(height-1), 14)
+	w.write(alpha, 1)
+	w.write(0, 3)
+	writeVP8LImage(w, pix, width, height, true)
+	return w.bytes()
+}
+
+// encodeVP8LAlpha encodes an alpha plane as the headerless VP8L stream of an
+// ALPH chunk, which carries the values in the green channel
+func encodeVP8LAlpha(alpha []uint8, width, height int) []byte {
+	pix := make([]uint32, len(alpha))
+	for i, a := range alpha {
+		pix[i] = 0xff000000 | uint32(a)<<8
+	}
+	w := &bitWriter{}
+	writeVP8LImage(w, pix, width, height, false)
+	return w.bytes()
+}
+
+// writeVP8LImage writes the transforms and the entropy-coded pixels. pix is
+// modified. subtractGreen decorrelates the color channels, which is useless
+// for alpha planes.
+func writeVP8LImage(w *bitWriter, pix []uint32, width, height int, subtractGreen bool) {
+	if subtractGreen {
+		for i, p := range pix {
+			g := (p >> 8) & 0xff
+			pix[i] = p&0xff00ff00 | ((p>>16-g)&0xff)<<16 | (p-g)&0xff
+		}
+		w.write(1, 1)
+		w.write(vp8lSubtractGreenTransform, 2)
+	}
+
+	residuals, modes := vp8lPredict(pix, width, height)
+	w.write(1, 1)
+	w.write(vp8lPredictorTransform, 2)
+	w.write(vp8lPredictorBits-2, 3)
+	writeVP8LEntropyImage(w, modes, vp8lTiles(width), false)
+
+	w.write(0, 1)
+	writeVP8LEntropyImage(w, residuals, width, true)
+}
+
+func vp8lTiles(size int) int {
+	return (size + 1<<vp8lPredictorBits - 1) >> vp8lPredictorBits
+}
+
+// vp8lPredict picks the spatial predictor of each tile that leaves the
+// smallest residuals. It returns the residuals and the predictor sub-image.
+func vp8lPredict(pix []uint32, width, height int) (residuals, modes []uint32) {
+	tilesX, tilesY := vp8lTiles(width), vp8lTiles(height)
+	modes = make([]uint32, tilesX*tilesY)
+	residuals = make([]uint32, len(pix))
+	const tile = 1 << vp8lPredictorBits
+
+	for ty := range tilesY {
+		for tx := range tilesX {
+			x0, y0 := tx*tile, ty*tile
+			x1, y1 := min(x0+tile, width), min(y0+tile, height)
+			best, bestCost := 0, -1
+			for mode := range 14 {
+				cost := 0
+				for y := max(y0, 1); y < y1; y++ {
+					for x := max(x0, 1); x < x1; x++ {
+						i := y*width + x
+						cost += residualCost(subPixels(pix[i], vp8lPredictor(mode, pix, i, width)))
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+			modes[ty*tilesX+tx] = 0xff000000 | uint32(best)<<8
+
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					i := y*width + x
+					var pred uint32
+					switch {
+					case x == 0 && y == 0:
+						pred = 0xff000000
+					case y == 0:
+						pred = pix[i-1]
+					case x == 0:
+						pred = pix[i-width]
+					default:
+						pred = vp8lPredictor(best, pix, i, width)
+					}
+					residuals[i] = subPixels(pix[i], pred)
+				}
+			}
+		}
+	}
+	return residuals, modes
+}
+
+// vp8lPredictor predicts the pixel at i, which is neither on the first row
+// nor on the first column. On the last column, the top-right pixel is the
+// first of the current row, as in the decoder.
+func vp8lPredictor(mode int, pix []uint32, i, width int) uint32 {
+	l, t, tl, tr := pix[i-1], pix[i-width], pix[i-width-1], pix[i-width+1]
+	switch mode {
+	case 0:
+		return 0xff000000
+	case 1:
+		return l
+	case 2:
+		return t
+	case 3:
+		return tr
+	case 4:
+		return tl
+	case 5:
+		return average2(average2(l, tr), t)
+	case 6:
+		return average2(l, tl)
+	case 7:
+		return average2(l, t)
+	case 8:
+		return average2(tl, t)
+	case 9:
+		return average2(t, tr)
+	case 10:
+		return average2(average2(l, tl), average2(t, tr))
+	case 11:
+		// The decoder picks l when t is the closer guess to tl
+		if channelDistance(tl, t) < channelDistance(tl, l) {
+			return l
+		}
+		return t
+	case 12:
+		return mapChannels(func(c int) int { return int(channel(l, c)) + int(channel(t, c)) - int(channel(tl, c)) })
+	default:
+		avg := average2(l, t)
+		return mapChannels(func(c int) int {
+			a := int(channel(avg, c))
+			return a + (a-int(channel(tl, c)))/2
+		})
+	}
+}
+
+func channel(p uint32, c int) uint8 {
+	return uint8(p >> (8 * c))
+}
+
+// mapChannels builds a pixel from f evaluated on each channel, clamped to
+// [0, 255]
+func mapChannels(f func(c int) int) uint32 {
+	var out uint32
+	for c := range 4 {
+		out |= uint32(min(max(f(c), 0), 255)) << (8 * c)
+	}
+	return out
+}
+
+// average2 is the per-channel floor average of a and b
+func average2(a, b uint32) uint32 {
+	return (((a ^ b) & 0xfefefefe) >> 1) + (a & b)
+}
+
+func channelDistance(a, b uint32) int {
+	d := 0
+	for c := range 4 {
+		d += abs(int(channel(a, c)) - int(channel(b, c)))
+	}
+	return d
+}
+
+// subPixels subtracts b from a channel by channel, modulo 256
+func subPixels(a, b uint32) uint32 {
+	alphaGreen := 0x00ff00ff + (a & 0xff00ff00) - (b & 0xff00ff00)
+	redBlue := 0xff00ff00 + (a & 0x00ff00ff) - (b & 0x00ff00ff)
+	return alphaGreen&0xff00ff00 | redBlue&0x00ff00ff
+}
+
+// residualCost estimates the bits of a residual by the magnitude of its
+// channels read as signed bytes
+func residualCost(p uint32) int {
+	cost := 0
+	for c := range 4 {
+		cost += abs(int(int8(channel(p, c))))
+	}
+	return cost
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// vp8lSymbol is a literal pixel or, when length is set, a backward reference
+// to a run of earlier pixels
+type vp8lSymbol struct {
+	argb   uint32
+	length uint32
+	// dist is the distance code, see vp8lPlaneDistances
+	dist uint32
+}
+
+// vp8lPlaneDistances maps the pixel distances reachable with a plane code to
+// the smallest such code, for an image of the given width
+func vp8lPlaneDistances(width int) map[int]uint32 {
+	codes := make(map[int]uint32, vp8lPlaneCodes)
+	for i, v := range vp8lDistanceMap {
+		d := int(v>>4)*width + 8 - int(v&0xf)
+		d = max(d, 1)
+		if _, ok := codes[d]; !ok {
+			codes[d] = uint32(i + 1)
+		}
+	}
+	return codes
+}
+
+// vp8lBackwardRefs replaces repeated runs of pixels with LZ77 references. It
+// tries the previous pixel, the pixel above and a short hash chain of earlier
+// positions.
+func vp8lBackwardRefs(pix []uint32, width int) []vp8lSymbol {
+	n := len(pix)
+	head := make([]int32, 1<<vp8lHashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	prev := make([]int32, n)
+	hash := func(i int) uint32 {
+		return ((pix[i]*0x9e3779b1 + pix[i+1]) * 0x1e35a7bd) >> (32 - vp8lHashBits)
+	}
+	insert := func(i int) {
+		if i+1 < n {
+			h := hash(i)
+			prev[i] = head[h]
+			head[h] = int32(i)
+		}
+	}
+	matchLength := func(i, d int) int {
+		limit := min(vp8lMaxMatch, n-i)
+		l := 0
+		for l < limit && pix[i+l] == pix[i+l-d] {
+			l++
+		}
+		return l
+	}
+
+	codes := vp8lPlaneDistances(width)
+	symbols := make([]vp8lSymbol, 0, n/4)
+	for i := 0; i < n; {
+		best, bestDist := 0, 0
+		try := func(d int) {
+			if d >= 1 && d <= i && d <= vp8lMaxWindow {
+				if l := matchLength(i, d); l > best {
+					best, bestDist = l, d
+				}
+			}
+		}
+		try(1)
+		try(width)
+		if i+1 < n {
+			cand := head[hash(i)]
+			for range vp8lMaxChain {
+				if cand < 0 || i-int(cand) > vp8lMaxWindow || best == vp8lMaxMatch {
+					break
+				}
+				try(i - int(cand))
+				cand = prev[cand]
+			}
+		}
+
+		if best < vp8lMinMatch {
+			symbols = append(symbols, vp8lSymbol{argb: pix[i]})
+			insert(i)
+			i++
+			continue
+		}
+		code, ok := codes[bestDist]
+		if !ok {
+			code = uint32(bestDist + vp8lPlaneCodes)
+		}
+		symbols = append(symbols, vp8lSymbol{length: uint32(best), dist: code})
+		for j := i; j < i+best; j++ {
+			insert(j)
+		}
+		i += best
+	}
+	return symbols
+}
+
+// vp8lPrefix splits a length or distance code into its prefix symbol and
+// extra bits
+func vp8lPrefix(v uint32) (symbol, extraBits, extra uint32) {
+	d := v - 1
+	if d < 4 {
+		return d, 0, 0
+	}
+	h := uint32(bits.Len32(d)) - 1
+	second := (d >> (h - 1)) & 1
+	extraBits = h - 1
+	return 2*h + second, extraBits, d & (1<<extraBits - 1)
+}
+
+// writeVP8LEntropyImage writes pixels with one set of prefix codes and no
+// color cache. Only the main image can signal meta prefix codes.
+func writeVP8LEntropyImage(w *bitWriter, pix []uint32, width int, main bool) {
+	symbols := vp8lBackwardRefs(pix, width)
+
+	var (
+		green = make([]uint32, vp8lLiteralCodes+vp8lLengthCodes)
+		red   = make([]uint32, vp8lLiteralCodes)
+		blue  = make([]uint32, vp8lLiteralCodes)
+		alpha = make([]uint32, vp8lLiteralCodes)
+		dist  = make([]uint32, vp8lDistanceCodes)
+	)
+	for _, s := range symbols {
+		if s.length == 0 {
+			green[channel(s.argb, 1)]++
+			red[channel(s.argb, 2)]++
+			blue[channel(s.argb, 0)]++
+			alpha[channel(s.argb, 3)]++
+			continue
+		}
+		l, _, _ := vp8lPrefix(s.length)
+		d, _, _ := vp8lPrefix(s.dist)
+		green[vp8lLiteralCodes+l]++
+		dist[d]++
+	}
+
+	// No color cache
+	w.write(0, 1)
+	if main {
+		// No meta prefix codes
+		w.write(0, 1)
+	}
+	codes := [5]*prefixCode{
+		newPrefixCode(green, vp8lMaxCodeLength),
+		newPrefixCode(red, vp8lMaxCodeLength),
+		newPrefixCode(blue, vp8lMaxCodeLength),
+		newPrefixCode(alpha, vp8lMaxCodeLength),
+		newPrefixCode(dist, vp8lMaxCodeLength),
+	}
+	for _, c := range codes {
+		c.writeHeader(w)
+	}
+
+	for _, s := range symbols {
+		if s.length == 0 {
+			codes[0].write(w, uint32(channel(s.argb, 1)))
+			codes[1].write(w, uint32(channel(s.argb, 2)))
+			codes[2].write(w, uint32(channel(s.argb, 0)))
+			codes[3].write(w, uint32(channel(s.argb, 3)))
+			continue
+		}
+		sym, n, extra := vp8lPrefix(s.length)
+		codes[0].write(w, vp8lLiteralCodes+sym)
+		w.write(extra, uint(n))
+		sym, n, extra = vp8lPrefix(s.dist)
+		codes[4].write(w, sym)
+		w.write(extra, uint(n))
+	}
+}
+
+// prefixCode is a canonical Huffman code
+type prefixCode struct {
+	lengths []uint8
+	// codes are bit-reversed, ready for the least significant bit first stream
+	codes []uint16
+	// used is the number of symbols with a code
+	used int
+}
+
+func newPrefixCode(counts []uint32, limit int) *prefixCode {
+	c := &prefixCode{lengths: huffmanLengths(counts, limit), codes: make([]uint16, len(counts))}
+	var histogram [vp8lMaxCodeLength + 1]uint16
+	for _, l := range c.lengths {
+		if l > 0 {
+			histogram[l]++
+			c.used++
+		}
+	}
+	var next [vp8lMaxCodeLength + 1]uint16
+	code := uint16(0)
+	for l := 1; l <= vp8lMaxCodeLength; l++ {
+		code = (code + histogram[l-1]) << 1
+		next[l] = code
+	}
+	for s, l := range c.lengths {
+		if l > 0 {
+			c.codes[s] = uint16(bits.Reverse16(next[l]) >> (16 - l))
+			next[l]++
+		}
+	}
+	return c
+}
+
+// write writes the code of symbol s. A code with a single symbol takes no
+// bits.
+func (c *prefixCode) write(w *bitWriter, s uint32) {
+	if c.used > 1 {
+		w.write(uint32(c.codes[s]), uint(c.lengths[s]))
+	}
+}
+
+// writeHeader writes the code lengths, as a simple code when there are at
+// most two symbols below 256
+func (c *prefixCode) writeHeader(w *bitWriter) {
+	var symbols []uint32
+	for s, l := range c.lengths {
+		if l > 0 {
+			symbols = append(symbols, uint32(s))
+		}
+	}
+	if len(symbols) == 0 {
+		// Unused alphabet: a simple code with the single symbol 0
+		w.write(1, 1)
+		w.write(0, 1)
+		w.write(0, 1)
+		w.write(0, 1)
+		return
+	}
+	if len(symbols) <= 2 && symbols[len(symbols)-1] < 256 {
+		w.write(1, 1)
+		w.write(uint32(len(symbols)-1), 1)
+		if symbols[0] < 2 {
+			w.write(0, 1)
+			w.write(symbols[0], 1)
+		} else {
+			w.write(1, 1)
+			w.write(symbols[0], 8)
+		}
+		if len(symbols) == 2 {
+			w.write(symbols[1], 8)
+		}
+		return
+	}
+
+	// Run-length code the lengths: 16 repeats the previous length 3 to 6
+	// times, 17 and 18 write runs of 3 to 10 and 11 to 138 zeros
+	type token struct{ code, extra uint8 }
+	var tokens []token
+	for i := 0; i < len(c.lengths); {
+		l := c.lengths[i]
+		run := 1
+		for i+run < len(c.lengths) && c.lengths[i+run] == l {
+			run++
+		}
+		i += run
+		if l == 0 {
+			for run >= 11 {
+				n := min(run, 138)
+				tokens = append(tokens, token{18, uint8(n - 11)})
+				run -= n
+			}
+			if run >= 3 {
+				tokens = append(tokens, token{17, uint8(run - 3)})
+				run = 0
+			}
+		} else {
+			tokens = append(tokens, token{l, 0})
+			run--
+			for run >= 3 {
+				n := min(run, 6)
+				tokens = append(tokens, token{16, uint8(n - 3)})
+				run -= n
+			}
+		}
+		for range run {
+			tokens = append(tokens, token{l, 0})
+		}
+	}
+
+	counts := make([]uint32, len(vp8lCodeLengthOrder))
+	for _, t := range tokens {
+		counts[t.code]++
+	}
+	lengthCode := newPrefixCode(counts, vp8lMaxCodeLengthLength)
+	n := len(vp8lCodeLengthOrder)
+	for n > 4 && lengthCode.lengths[vp8lCodeLengthOrder[n-1]] == 0 {
+		n--
+	}
+	w.write(0, 1)
+	w.write(uint32(n-4), 4)
+	for _, s := range vp8lCodeLengthOrder[:n] {
+		w.write(uint32(lengthCode.lengths[s]), 3)
+	}
+	// The lengths cover the whole alphabet
+	w.write(0, 1)
+	for _, t := range tokens {
+		lengthCode.write(w, uint32(t.code))
+		switch t.code {
+		case 16:
+			w.write(uint32(t.extra), 2)
+		case 17:
+			w.write(uint32(t.extra), 3)
+		case 18:
+			w.write(uint32(t.extra), 7)
+		}
+	}
+}
+
+// huffmanLengths returns Huffman code lengths of at most limit bits for the
+// symbol counts. Lengths that exceed the limit are avoided by raising the
+// smallest counts until the tree is shallow enough.
+func huffmanLengths(counts []uint32, limit int) []uint8 {
+	type node struct {
+		weight uint64
+		parent int
+	}
+	var symbols []int
+	for s, c := range counts {
+		if c > 0 {
+			symbols = append(symbols, s)
+		}
+	}
+	lengths := make([]uint8, len(counts))
+	switch len(symbols) {
+	case 0:
+		return lengths
+	case 1:
+		lengths[symbols[0]] = 1
+		return lengths
+	}
+
+	for floor := uint64(1); ; floor *= 2 {
+		weight := func(s int) uint64 { return max(uint64(counts[s]), floor) }
+		slices.SortStableFunc(symbols, func(a, b int) int {
+			switch wa, wb := weight(a), weight(b); {
+			case wa < wb:
+				return -1
+			case wa > wb:
+				return 1
+			}
+			return 0
+		})
+
+		// Two-queue construction: leaves in weight order, then internal
+		// nodes, which are created in weight order too
+		n := len(symbols)
+		nodes := make([]node, 2*n-1)
+		for i, s := range symbols {
+			nodes[i].weight = weight(s)
+		}
+		leaf, inner := 0, n
+		pop := func(next int) int {
+			if leaf < n && (inner >= next || nodes[leaf].weight <= nodes[inner].weight) {
+				leaf++
+				return leaf - 1
+			}
+			inner++
+			return inner - 1
+		}
+		for next := n; next < 2*n-1; next++ {
+			a := pop(next)
+			b := pop(next)
+			nodes[next].weight = nodes[a].weight + nodes[b].weight
+			nodes[a].parent, nodes[b].parent = next, next
+		}
+
+		depth := make([]int, 2*n-1)
+		deepest := 0
+		for i := 2*n - 3; i >= 0; i-- {
+			depth[i] = depth[nodes[i].parent] + 1
+			deepest = max(deepest, depth[i])
+		}
+		if deepest <= limit {
+			for i, s := range symbols {
+				lengths[s] = uint8(depth[i])
+			}
+			return lengths
+		}
+	}
+}
@@ -0,0 +1,724 @@
+package rmbg
+
+import (
+	"errors"
+	"image"
+)
+
+// VP8 lossy key frames, see RFC 6386. Every macroblock is predicted as a
+// whole (16x16 luma and 8x8 chroma modes) and coded with the default token
+// probabilities, in a single partition.
+
+const (
+	// vp8PredDC to vp8PredHE are the intra prediction modes
+	vp8PredDC = iota
+	vp8PredTM
+	vp8PredVE
+	vp8PredHE
+	vp8Modes
+)
+
+const (
+	vp8PlaneY1AfterY2 = 0
+	vp8PlaneY2        = 1
+	vp8PlaneUV        = 2
+
+	// vp8MaxLevel is the largest quantized coefficient, the top of the last
+	// token category
+	vp8MaxLevel = 2047
+	// vp8MaxFirstPartition is the largest first partition the frame tag can
+	// describe
+	vp8MaxFirstPartition = 1<<19 - 1
+)
+
+var (
+	vp8CoeffBands = [17]uint8{0, 1, 2, 3, 6, 4, 5, 6, 6, 6, 6, 6, 6, 6, 6, 7, 0}
+	vp8Zigzag     = [16]uint8{0, 1, 4, 8, 5, 2, 3, 6, 9, 12, 13, 10, 7, 11, 14, 15}
+	// vp8CategoryProbs are the probabilities of the extra bits of the token
+	// categories 3 to 6, section 13.2
+	vp8CategoryProbs = [4][]uint8{
+		{173, 148, 140},
+		{176, 155, 140, 135},
+		{180, 157, 141, 134, 130},
+		{254, 254, 243, 230, 196, 177, 153, 140, 133, 130, 129},
+	}
+)
+
+var errVP8TooLarge = errors.New("webp: image too large for lossy encoding")
+
+// boolEncoder is the boolean entropy encoder of section 7
+type boolEncoder struct {
+	buf      []byte
+	rng      uint32
+	bottom   uint32
+	bitCount int
+}
+
+func newBoolEncoder() *boolEncoder {
+	return &boolEncoder{rng: 255, bitCount: 24}
+}
+
+// put writes bit, which is false with probability prob/256
+func (e *boolEncoder) put(bit bool, prob uint8) {
+	split := 1 + ((e.rng-1)*uint32(prob))>>8
+	if bit {
+		e.bottom += split
+		e.rng -= split
+	} else {
+		e.rng = split
+	}
+	for e.rng < 128 {
+		e.rng <<= 1
+		if e.bottom&(1<<31) != 0 {
+			// Propagate the carry into the bytes already written
+			i := len(e.buf) - 1
+			for ; i >= 0 && e.buf[i] == 0xff; i-- {
+				e.buf[i] = 0
+			}
+			e.buf[i]++
+		}
+		e.bottom <<= 1
+		e.bitCount--
+		if e.bitCount == 0 {
+			e.buf = append(e.buf, byte(e.bottom>>24))
+			e.bottom &= 1<<24 - 1
+			e.bitCount = 8
+		}
+	}
+}
+
+// literal writes the n low bits of v, most significant first, at even odds
+func (e *boolEncoder) literal(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		e.put(v>>i&1 != 0, 128)
+	}
+}
+
+// bytes pads the pending bits out of the encoder and returns its output
+func (e *boolEncoder) bytes() []byte {
+	for range 32 {
+		e.put(false, 128)
+	}
+	return e.buf
+}
+
+// vp8Quant are the DC and AC quantizer steps of each kind of block
+type vp8Quant struct {
+	y1, y2, uv [2]int32
+}
+
+func newVP8Quant(qi int) vp8Quant {
+	q := vp8Quant{
+		y1: [2]int32{int32(vp8DCTable[qi]), int32(vp8ACTable[qi])},
+		y2: [2]int32{int32(vp8DCTable[qi]) * 2, int32(vp8ACTable[qi]) * 155 / 100},
+		uv: [2]int32{int32(vp8DCTable[min(qi, 117)]), int32(vp8ACTable[qi])},
+	}
+	q.y2[1] = max(q.y2[1], 8)
+	return q
+}
+
+// vp8Biases are the rounding offsets of the quantizer for the DC and AC
+// coefficients, in 1/256 steps. Rounding down more than half keeps small
+// coefficients, mostly noise, out of the bitstream.
+var vp8Biases = [2]int32{96, 110}
+
+// quantize returns the level of the coefficient c for the quantizer step q
+func quantize(c, q, bias int32) int32 {
+	level := min((abs32(c)*256+bias*q)/(256*q), vp8MaxLevel)
+	if c < 0 {
+		return -level
+	}
+	return level
+}
+
+func abs32(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func clip8(v int32) uint8 {
+	return uint8(min(max(v, 0), 255))
+}
+
+// vp8NonZero are the flags, per 4x4 block along one edge of a macroblock,
+// telling whether the block has coded coefficients. They select the token
+// contexts of the neighbouring blocks.
+type vp8NonZero struct {
+	y    [4]uint8
+	u, v [2]uint8
+	y2   uint8
+}
+
+// vp8Encoder holds the planes and entropy state of a lossy encoding
+type vp8Encoder struct {
+	mbw, mbh int
+	// The source planes, padded to whole macroblocks, and their
+	// reconstruction as the decoder will see it
+	srcY, srcU, srcV []uint8
+	recY, recU, recV []uint8
+	// transparent marks the macroblocks without visible pixels
+	transparent []bool
+	quant       vp8Quant
+
+	header, tokens *boolEncoder
+	up             []vp8NonZero
+	left           vp8NonZero
+}
+
+// encodeVP8 encodes the color of img as the payload of a "VP8 " chunk.
+// quality ranges from 1 to 100.
+func encodeVP8(img *image.NRGBA, quality int) ([]byte, error) {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	qi := (100 - min(max(quality, 1), 100)) * 127 / 99
+	e := newVP8Encoder(img, newVP8Quant(qi))
+
+	e.header.put(false, 128) // color space
+	e.header.put(false, 128) // clamping type
+	e.header.put(false, 128) // segmentation
+	e.header.put(false, 128) // normal loop filter
+	e.header.literal(uint32(min(qi*2/5, 63)), 6)
+	e.header.literal(0, 3) // sharpness
+	e.header.put(false, 128)
+	e.header.literal(0, 2) // a single token partition
+	e.header.literal(uint32(qi), 7)
+	for range 5 {
+		// No quantizer deltas
+		e.header.put(false, 128)
+	}
+	e.header.put(false, 128) // refresh entropy probabilities
+	for i := range vp8UpdateProbs {
+		for j := range vp8UpdateProbs[i] {
+			for k := range vp8UpdateProbs[i][j] {
+				for _, p := range vp8UpdateProbs[i][j][k] {
+					e.header.put(false, p)
+				}
+			}
+		}
+	}
+	e.header.put(false, 128) // no macroblock skipping
+
+	for mby := range e.mbh {
+		e.left = vp8NonZero{}
+		for mbx := range e.mbw {
+			e.encodeMacroblock(mbx, mby)
+		}
+	}
+
+	first, tokens := e.header.bytes(), e.tokens.bytes()
+	if len(first) > vp8MaxFirstPartition {
+		return nil, errVP8TooLarge
+	}
+	out := make([]byte, 0, 10+len(first)+len(tokens))
+	size := uint32(len(first))
+	// Key frame, version 0, shown
+	out = append(out, byte(1<<4|size<<5), byte(size>>3), byte(size>>11))
+	out = append(out, 0x9d, 0x01, 0x2a)
+	out = append(out, byte(width), byte(width>>8), byte(height), byte(height>>8))
+	out = append(out, first...)
+	return append(out, tokens...), nil
+}
+
+// newVP8Encoder converts img to padded Y'CbCr planes. The conversion uses the
+// limited range BT.601 coefficients of libwebp.
+func newVP8Encoder(img *image.NRGBA, quant vp8Quant) *vp8Encoder {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	mbw, mbh := (width+15)/16, (height+15)/16
+	e := &vp8Encoder{
+		mbw: mbw, mbh: mbh,
+		srcY:        make([]uint8, mbw*16*mbh*16),
+		srcU:        make([]uint8, mbw*8*mbh*8),
+		srcV:        make([]uint8, mbw*8*mbh*8),
+		recY:        make([]uint8, mbw*16*mbh*16),
+		recU:        make([]uint8, mbw*8*mbh*8),
+		recV:        make([]uint8, mbw*8*mbh*8),
+		transparent: make([]bool, mbw*mbh),
+		quant:       quant,
+		header:      newBoolEncoder(),
+		tokens:      newBoolEncoder(),
+		up:          make([]vp8NonZero, mbw),
+	}
+	for i := range e.transparent {
+		e.transparent[i] = true
+	}
+
+	// Pixels past the edges repeat the last row and column
+	at := func(x, y int) []uint8 {
+		x, y = min(x, width-1), min(y, height-1)
+		return img.Pix[img.PixOffset(b.Min.X+x, b.Min.Y+y):][:4]
+	}
+	yStride, cStride := mbw*16, mbw*8
+	for y := range mbh * 16 {
+		for x := range mbw * 16 {
+			p := at(x, y)
+			e.srcY[y*yStride+x] = uint8((16839*int32(p[0]) + 33059*int32(p[1]) + 6420*int32(p[2]) + 16<<16 + 1<<15) >> 16)
+			if p[3] != 0 && x < width && y < height {
+				e.transparent[(y/16)*mbw+x/16] = false
+			}
+		}
+	}
+	for y := range mbh * 8 {
+		for x := range mbw * 8 {
+			var r, g, bl int32
+			for _, d := range [4][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+				p := at(2*x+d[0], 2*y+d[1])
+				r, g, bl = r+int32(p[0]), g+int32(p[1]), bl+int32(p[2])
+			}
+			const rounding = 1<<15<<2 + 128<<18
+			e.srcU[y*cStride+x] = clip8((-9719*r - 19081*g + 28800*bl + rounding) >> 18)
+			e.srcV[y*cStride+x] = clip8((28800*r - 24116*g - 4684*bl + rounding) >> 18)
+		}
+	}
+	return e
+}
+
+// vp8Edges are the reconstructed samples bordering a block, with the
+// substitutes the decoder uses outside the frame
+type vp8Edges struct {
+	top, left       [16]uint8
+	corner          uint8
+	hasTop, hasLeft bool
+	size            int
+	predictions     [vp8Modes][256]uint8
+}
+
+func edges(rec []uint8, stride, x, y, size int) *vp8Edges {
+	ed := &vp8Edges{size: size, hasTop: y > 0, hasLeft: x > 0}
+	for i := range size {
+		ed.top[i], ed.left[i] = 127, 129
+		if ed.hasTop {
+			ed.top[i] = rec[(y-1)*stride+x+i]
+		}
+		if ed.hasLeft {
+			ed.left[i] = rec[(y+i)*stride+x-1]
+		}
+	}
+	switch {
+	case !ed.hasTop:
+		ed.corner = 127
+	case !ed.hasLeft:
+		ed.corner = 129
+	default:
+		ed.corner = rec[(y-1)*stride+x-1]
+	}
+	return ed
+}
+
+// predict returns the prediction of the block in the given mode, row by row
+func (ed *vp8Edges) predict(mode int) []uint8 {
+	n := ed.size
+	pred := ed.predictions[mode][:n*n]
+	switch mode {
+	case vp8PredDC:
+		shift := 3
+		if n == 16 {
+			shift = 4
+		}
+		var sum int
+		dc := 128
+		switch {
+		case ed.hasTop && ed.hasLeft:
+			for i := range n {
+				sum += int(ed.top[i]) + int(ed.left[i])
+			}
+			dc = (sum + n) >> (shift + 1)
+		case ed.hasTop:
+			for i := range n {
+				sum += int(ed.top[i])
+			}
+			dc = (sum + n/2) >> shift
+		case ed.hasLeft:
+			for i := range n {
+				sum += int(ed.left[i])
+			}
+			dc = (sum + n/2) >> shift
+		}
+		for i := range pred {
+			pred[i] = uint8(dc)
+		}
+	case vp8PredTM:
+		for y := range n {
+			for x := range n {
+				pred[y*n+x] = clip8(int32(ed.left[y]) + int32(ed.top[x]) - int32(ed.corner))
+			}
+		}
+	case vp8PredVE:
+		for y := range n {
+			copy(pred[y*n:][:n], ed.top[:n])
+		}
+	case vp8PredHE:
+		for y := range n {
+			for x := range n {
+				pred[y*n+x] = ed.left[y]
+			}
+		}
+	}
+	return pred
+}
+
+// bestMode returns the mode whose predictions are closest to the source
+// blocks, the U and V blocks being predicted together
+func bestMode(src [][]uint8, stride, x, y int, eds []*vp8Edges) int {
+	best, bestErr := vp8PredDC, -1
+	for mode := range vp8Modes {
+		sse := 0
+		for k, ed := range eds {
+			pred := ed.predict(mode)
+			n := ed.size
+			for j := range n {
+				row := src[k][(y+j)*stride+x:][:n]
+				for i, s := range row {
+					d := int(s) - int(pred[j*n+i])
+					sse += d * d
+				}
+			}
+		}
+		if bestErr < 0 || sse < bestErr {
+			best, bestErr = mode, sse
+		}
+	}
+	return best
+}
+
+func (e *vp8Encoder) encodeMacroblock(mbx, mby int) {
+	yStride, cStride := e.mbw*16, e.mbw*8
+	x, y := mbx*16, mby*16
+	edY := edges(e.recY, yStride, x, y, 16)
+	edU := edges(e.recU, cStride, x/2, y/2, 8)
+	edV := edges(e.recV, cStride, x/2, y/2, 8)
+
+	yMode, uvMode := vp8PredDC, vp8PredDC
+	if e.transparent[mby*e.mbw+mbx] {
+		// Nothing shows through: code the cheapest prediction as is
+		copyBlock(e.srcY, yStride, x, y, edY.predict(vp8PredDC), 16)
+		copyBlock(e.srcU, cStride, x/2, y/2, edU.predict(vp8PredDC), 8)
+		copyBlock(e.srcV, cStride, x/2, y/2, edV.predict(vp8PredDC), 8)
+	} else {
+		yMode = bestMode([][]uint8{e.srcY}, yStride, x, y, []*vp8Edges{edY})
+		uvMode = bestMode([][]uint8{e.srcU, e.srcV}, cStride, x/2, y/2, []*vp8Edges{edU, edV})
+	}
+
+	h := e.header
+	h.put(true, 145) // 16x16 luma prediction
+	switch yMode {
+	case vp8PredDC:
+		h.put(false, 156)
+		h.put(false, 163)
+	case vp8PredVE:
+		h.put(false, 156)
+		h.put(true, 163)
+	case vp8PredHE:
+		h.put(true, 156)
+		h.put(false, 128)
+	case vp8PredTM:
+		h.put(true, 156)
+		h.put(true, 128)
+	}
+	switch uvMode {
+	case vp8PredDC:
+		h.put(false, 142)
+	case vp8PredVE:
+		h.put(true, 142)
+		h.put(false, 114)
+	case vp8PredHE:
+		h.put(true, 142)
+		h.put(true, 114)
+		h.put(false, 183)
+	case vp8PredTM:
+		h.put(true, 142)
+		h.put(true, 114)
+		h.put(true, 183)
+	}
+
+	e.encodeLuma(mbx, x, y, edY.predict(yMode))
+	up := &e.up[mbx]
+	e.encodeChroma(e.srcU, e.recU, x/2, y/2, edU.predict(uvMode), &e.left.u, &up.u)
+	e.encodeChroma(e.srcV, e.recV, x/2, y/2, edV.predict(uvMode), &e.left.v, &up.v)
+}
+
+func copyBlock(dst []uint8, stride, x, y int, src []uint8, n int) {
+	for j := range n {
+		copy(dst[(y+j)*stride+x:][:n], src[j*n:][:n])
+	}
+}
+
+// residual returns the forward DCT of the 4x4 block at (x, y) of src minus
+// its prediction, the 4x4 block at (px, py) of the n wide pred
+func residual(src []uint8, stride, x, y int, pred []uint8, n, px, py int) [16]int32 {
+	var d [16]int32
+	for j := range 4 {
+		for i := range 4 {
+			d[j*4+i] = int32(src[(y+j)*stride+x+i]) - int32(pred[(py+j)*n+px+i])
+		}
+	}
+	return fdct(d)
+}
+
+// reconstruct adds the inverse DCT of the dequantized coefficients to the
+// prediction and stores the block at (x, y) of rec
+func reconstruct(rec []uint8, stride, x, y int, pred []uint8, n, px, py int, coeffs [16]int32) {
+	out := idct(coeffs)
+	for j := range 4 {
+		for i := range 4 {
+			rec[(y+j)*stride+x+i] = clip8(int32(pred[(py+j)*n+px+i]) + out[j*4+i])
+		}
+	}
+}
+
+// encodeLuma codes the luma of a macroblock predicted by pred: the DC
+// coefficients of the 16 blocks through the Walsh-Hadamard transform, then
+// the AC coefficients of each block
+func (e *vp8Encoder) encodeLuma(mbx, x, y int, pred []uint8) {
+	stride := e.mbw * 16
+	q := e.quant.y1
+	var blocks [16][16]int32
+	var dc [16]int32
+	for n := range 16 {
+		bx, by := n%4*4, n/4*4
+		blocks[n] = residual(e.srcY, stride, x+bx, y+by, pred, 16, bx, by)
+		dc[n] = blocks[n][0]
+	}
+
+	wht := fwht(dc)
+	var y2 [16]int32
+	for i, c := range wht {
+		k := min(i, 1)
+		y2[i] = quantize(c, e.quant.y2[k], vp8Biases[k])
+		wht[i] = y2[i] * e.quant.y2[k]
+	}
+	up := &e.up[mbx]
+	nz := e.writeTokens(vp8PlaneY2, e.left.y2+up.y2, &y2, 0)
+	e.left.y2, up.y2 = nz, nz
+	dc = iwht(wht)
+
+	for n := range 16 {
+		bx, by := n%4*4, n/4*4
+		var levels, coeffs [16]int32
+		coeffs[0] = dc[n]
+		for i := 1; i < 16; i++ {
+			levels[i] = quantize(blocks[n][i], q[1], vp8Biases[1])
+			coeffs[i] = levels[i] * q[1]
+		}
+		row, col := n/4, n%4
+		nz := e.writeTokens(vp8PlaneY1AfterY2, e.left.y[row]+up.y[col], &levels, 1)
+		e.left.y[row], up.y[col] = nz, nz
+		reconstruct(e.recY, stride, x+bx, y+by, pred, 16, bx, by, coeffs)
+	}
+}
+
+// encodeChroma codes the four blocks of a chroma plane of a macroblock.
+// left and up are the non-zero flags of the plane.
+func (e *vp8Encoder) encodeChroma(src, rec []uint8, x, y int, pred []uint8, left, up *[2]uint8) {
+	stride := e.mbw * 8
+	q := e.quant.uv
+	for n := range 4 {
+		bx, by := n%2*4, n/2*4
+		blocks := residual(src, stride, x+bx, y+by, pred, 8, bx, by)
+		var levels, coeffs [16]int32
+		for i, c := range blocks {
+			k := min(i, 1)
+			levels[i] = quantize(c, q[k], vp8Biases[k])
+			coeffs[i] = levels[i] * q[k]
+		}
+		row, col := n/2, n%2
+		nz := e.writeTokens(vp8PlaneUV, left[row]+up[col], &levels, 0)
+		left[row], up[col] = nz, nz
+		reconstruct(rec, stride, x+bx, y+by, pred, 8, bx, by, coeffs)
+	}
+}
+
+// writeTokens writes the coefficient levels of a block from index first on,
+// in zigzag order, and returns 1 if any is non-zero. The token tree mirrors
+// section 13.2.
+func (e *vp8Encoder) writeTokens(plane int, ctx uint8, levels *[16]int32, first int) uint8 {
+	probs := &vp8DefaultProbs[plane]
+	last := -1
+	for n := first; n < 16; n++ {
+		if levels[vp8Zigzag[n]] != 0 {
+			last = n
+		}
+	}
+	t := e.tokens
+	p := &probs[vp8CoeffBands[first]][ctx]
+	t.put(last >= 0, p[0])
+	if last < 0 {
+		return 0
+	}
+	for n := first; n < 16; {
+		v := levels[vp8Zigzag[n]]
+		n++
+		if v == 0 {
+			t.put(false, p[1])
+			p = &probs[vp8CoeffBands[n]][0]
+			continue
+		}
+		t.put(true, p[1])
+		a := abs32(v)
+		if a == 1 {
+			t.put(false, p[2])
+			p = &probs[vp8CoeffBands[n]][1]
+		} else {
+			t.put(true, p[2])
+			switch {
+			case a <= 4:
+				t.put(false, p[3])
+				t.put(a != 2, p[4])
+				if a != 2 {
+					t.put(a == 4, p[5])
+				}
+			case a <= 10:
+				t.put(true, p[3])
+				t.put(false, p[6])
+				if a <= 6 {
+					t.put(false, p[7])
+					t.put(a == 6, 159)
+				} else {
+					t.put(true, p[7])
+					t.put((a-7)&2 != 0, 165)
+					t.put((a-7)&1 != 0, 145)
+				}
+			default:
+				t.put(true, p[3])
+				t.put(true, p[6])
+				cat := 3
+				for cat > 0 && a < 3+8<<cat {
+					cat--
+				}
+				t.put(cat >= 2, p[8])
+				t.put(cat&1 != 0, p[9+cat>>1])
+				extra := a - (3 + 8<<cat)
+				tab := vp8CategoryProbs[cat]
+				for i, prob := range tab {
+					t.put(extra>>(len(tab)-1-i)&1 != 0, prob)
+				}
+			}
+			p = &probs[vp8CoeffBands[n]][2]
+		}
+		t.put(v < 0, 128)
+		if n == 16 {
+			break
+		}
+		t.put(n <= last, p[0])
+		if n > last {
+			break
+		}
+	}
+	return 1
+}
+
+// fdct is the forward DCT of libwebp, which the inverse DCT of section 14.3
+// undoes
+func fdct(d [16]int32) [16]int32 {
+	var tmp, out [16]int32
+	for i := range 4 {
+		a0 := d[i*4+0] + d[i*4+3]
+		a1 := d[i*4+1] + d[i*4+2]
+		a2 := d[i*4+1] - d[i*4+2]
+		a3 := d[i*4+0] - d[i*4+3]
+		tmp[i*4+0] = (a0 + a1) * 8
+		tmp[i*4+1] = (a2*2217 + a3*5352 + 1812) >> 9
+		tmp[i*4+2] = (a0 - a1) * 8
+		tmp[i*4+3] = (a3*2217 - a2*5352 + 937) >> 9
+	}
+	for i := range 4 {
+		a0 := tmp[0+i] + tmp[12+i]
+		a1 := tmp[4+i] + tmp[8+i]
+		a2 := tmp[4+i] - tmp[8+i]
+		a3 := tmp[0+i] - tmp[12+i]
+		out[0+i] = (a0 + a1 + 7) >> 4
+		out[4+i] = (a2*2217 + a3*5352 + 12000) >> 16
+		if a3 != 0 {
+			out[4+i]++
+		}
+		out[8+i] = (a0 - a1 + 7) >> 4
+		out[12+i] = (a3*2217 - a2*5352 + 51000) >> 16
+	}
+	return out
+}
+
+// idct is the inverse DCT of section 14.3, returning the residuals row by row
+func idct(c [16]int32) [16]int32 {
+	const (
+		c1 = 85627 // 65536 * cos(pi/8) * sqrt(2)
+		c2 = 35468 // 65536 * sin(pi/8) * sqrt(2)
+	)
+	var m [4][4]int32
+	for i := range 4 {
+		a := c[i] + c[8+i]
+		b := c[i] - c[8+i]
+		cc := (c[4+i]*c2)>>16 - (c[12+i]*c1)>>16
+		d := (c[4+i]*c1)>>16 + (c[12+i]*c2)>>16
+		m[i] = [4]int32{a + d, b + cc, b - cc, a - d}
+	}
+	var out [16]int32
+	for j := range 4 {
+		dc := m[0][j] + 4
+		a := dc + m[2][j]
+		b := dc - m[2][j]
+		cc := (m[1][j]*c2)>>16 - (m[3][j]*c1)>>16
+		d := (m[1][j]*c1)>>16 + (m[3][j]*c2)>>16
+		out[j*4+0] = (a + d) >> 3
+		out[j*4+1] = (b + cc) >> 3
+		out[j*4+2] = (b - cc) >> 3
+		out[j*4+3] = (a - d) >> 3
+	}
+	return out
+}
+
+// fwht is the forward Walsh-Hadamard transform of libwebp over the DC
+// coefficients of the 16 luma blocks
+func fwht(dc [16]int32) [16]int32 {
+	var tmp, out [16]int32
+	for i := range 4 {
+		a0 := dc[i*4+0] + dc[i*4+2]
+		a1 := dc[i*4+1] + dc[i*4+3]
+		a2 := dc[i*4+1] - dc[i*4+3]
+		a3 := dc[i*4+0] - dc[i*4+2]
+		tmp[i*4+0] = a0 + a1
+		tmp[i*4+1] = a3 + a2
+		tmp[i*4+2] = a3 - a2
+		tmp[i*4+3] = a0 - a1
+	}
+	for i := range 4 {
+		a0 := tmp[0+i] + tmp[8+i]
+		a1 := tmp[4+i] + tmp[12+i]
+		a2 := tmp[4+i] - tmp[12+i]
+		a3 := tmp[0+i] - tmp[8+i]
+		out[0+i] = (a0 + a1) >> 1
+		out[4+i] = (a3 + a2) >> 1
+		out[8+i] = (a3 - a2) >> 1
+		out[12+i] = (a0 - a1) >> 1
+	}
+	return out
+}
+
+// iwht is the inverse Walsh-Hadamard transform of section 14.3, returning
+// the DC coefficient of each luma block
+func iwht(c [16]int32) [16]int32 {
+	var m, out [16]int32
+	for i := range 4 {
+		a0 := c[0+i] + c[12+i]
+		a1 := c[4+i] + c[8+i]
+		a2 := c[4+i] - c[8+i]
+		a3 := c[0+i] - c[12+i]
+		m[0+i] = a0 + a1
+		m[8+i] = a0 - a1
+		m[4+i] = a3 + a2
+		m[12+i] = a3 - a2
+	}
+	for i := range 4 {
+		dc := m[0+i*4] + 3
+		a0 := dc + m[3+i*4]
+		a1 := m[1+i*4] + m[2+i*4]
+		a2 := m[1+i*4] - m[2+i*4]
+		a3 := dc - m[3+i*4]
+		out[i*4+0] = (a0 + a1) >> 3
+		out[i*4+1] = (a3 + a2) >> 3
+		out[i*4+2] = (a0 - a1) >> 3
+		out[i*4+3] = (a3 - a2) >> 3
+	}
+	return out
+}
@@ -0,0 +1,203 @@
+package rmbg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// gradientImage is an image with smooth colors and an alpha ramp from fully
+// transparent on the left to opaque on the right
+func gradientImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			img.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(x * 255 / w),
+				G: uint8(y * 255 / h),
+				B: uint8((x + y) * 127 / (w + h)),
+				A: uint8(min(x*512/w, 255)),
+			})
+		}
+	}
+	return img
+}
+
+func TestEncodeWebP(t *testing.T) {
+	src := gradientImage(70, 45)
+
+	t.Run("Lossless", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := EncodeWebP(&buf, src, &WebPOptions{Lossless: true}); err != nil {
+			t.Fatalf("EncodeWebP failed: %v", err)
+		}
+		img, format, err := image.Decode(&buf)
+		if err != nil || format != "webp" {
+			t.Fatalf("expected WebP, got %s (%v)", format, err)
+		}
+		for y := range 45 {
+			for x := range 70 {
+				want := src.NRGBAAt(x, y)
+				if want.A == 0 {
+					want = color.NRGBA{}
+				}
+				if got := color.NRGBAModel.Convert(img.At(x, y)); got != want {
+					t.Fatalf("expected %v at %d,%d, got %v", want, x, y, got)
+				}
+			}
+		}
+	})
+
+	t.Run("Lossy", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := EncodeWebP(&buf, src, nil); err != nil {
+			t.Fatalf("EncodeWebP failed: %v", err)
+		}
+		img, _, err := image.Decode(&buf)
+		if err != nil {
+			t.Fatalf("failed to decode: %v", err)
+		}
+		ycc, ok := img.(*image.NYCbCrA)
+		if !ok {
+			t.Fatalf("expected *image.NYCbCrA, got %T", img)
+		}
+		for y := range 45 {
+			for x := range 70 {
+				if got, want := ycc.A[ycc.AOffset(x, y)], src.NRGBAAt(x, y).A; got != want {
+					t.Fatalf("expected alpha %d at %d,%d, got %d", want, x, y, got)
+				}
+			}
+		}
+		if psnr := lumaPSNR(src, &ycc.YCbCr); psnr < 40 {
+			t.Errorf("expected luma PSNR above 40 dB, got %.1f", psnr)
+		}
+	})
+
+	t.Run("Opaque", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := EncodeWebP(&buf, solidImage(33, 17, color.NRGBA{R: 200, G: 100, B: 50, A: 255}), nil); err != nil {
+			t.Fatalf("EncodeWebP failed: %v", err)
+		}
+		if chunks := readRIFF(buf.Bytes()); len(chunks) != 1 || chunks[0].id != "VP8 " {
+			t.Errorf("expected a single VP8 chunk, got %v", chunks)
+		}
+		if img, _, err := image.Decode(&buf); err != nil {
+			t.Errorf("failed to decode: %v", err)
+		} else if _, ok := img.(*image.YCbCr); !ok {
+			t.Errorf("expected *image.YCbCr, got %T", img)
+		}
+	})
+
+	t.Run("Quality", func(t *testing.T) {
+		var low, high bytes.Buffer
+		if err := EncodeWebP(&low, src, &WebPOptions{Quality: 20}); err != nil {
+			t.Fatalf("EncodeWebP failed: %v", err)
+		}
+		if err := EncodeWebP(&high, src, &WebPOptions{Quality: 100}); err != nil {
+			t.Fatalf("EncodeWebP failed: %v", err)
+		}
+		if low.Len() >= high.Len() {
+			t.Errorf("expected quality 20 to be smaller than quality 100, got %d and %d bytes", low.Len(), high.Len())
+		}
+	})
+
+	t.Run("InvalidSize", func(t *testing.T) {
+		if err := EncodeWebP(&bytes.Buffer{}, image.NewNRGBA(image.Rect(0, 0, 0, 5)), nil); err == nil {
+			t.Errorf("expected error for empty image")
+		}
+	})
+}
+
+// lumaPSNR compares the luma of a decoded image to the luma of src
+func lumaPSNR(src *image.NRGBA, img *image.YCbCr) float64 {
+	e := newVP8Encoder(src, vp8Quant{})
+	b := src.Bounds()
+	var sse float64
+	for y := range b.Dy() {
+		for x := range b.Dx() {
+			d := float64(img.Y[img.YOffset(x, y)]) - float64(e.srcY[y*e.mbw*16+x])
+			sse += d * d
+		}
+	}
+	return 10 * math.Log10(255*255*float64(b.Dx()*b.Dy())/max(sse, 1))
+}
+
+func TestVP8Reconstruction(t *testing.T) {
+	// Without loop filtering, at the finest quantizer, the decoder must see
+	// exactly what the encoder predicted from; noise exercises every token
+	rng := rand.New(rand.NewSource(1))
+	src := image.NewNRGBA(image.Rect(0, 0, 75, 50))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(rng.Intn(256))
+	}
+	payload, err := encodeVP8(src, 100)
+	if err != nil {
+		t.Fatalf("encodeVP8 failed: %v", err)
+	}
+	img, _, err := image.Decode(bytes.NewReader(writeRIFF([]riffChunk{{"VP8 ", payload}})))
+	if err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	ycc := img.(*image.YCbCr)
+
+	e := newVP8Encoder(src, newVP8Quant(0))
+	for mby := range e.mbh {
+		e.left = vp8NonZero{}
+		for mbx := range e.mbw {
+			e.encodeMacroblock(mbx, mby)
+		}
+	}
+	for y := range 50 {
+		for x := range 75 {
+			if got, want := ycc.Y[ycc.YOffset(x, y)], e.recY[y*e.mbw*16+x]; got != want {
+				t.Fatalf("expected luma %d at %d,%d, got %d", want, x, y, got)
+			}
+			if got, want := ycc.Cb[ycc.COffset(x, y)], e.recU[y/2*e.mbw*8+x/2]; got != want {
+				t.Fatalf("expected Cb %d at %d,%d, got %d", want, x, y, got)
+			}
+			if got, want := ycc.Cr[ycc.COffset(x, y)], e.recV[y/2*e.mbw*8+x/2]; got != want {
+				t.Fatalf("expected Cr %d at %d,%d, got %d", want, x, y, got)
+			}
+		}
+	}
+}
+
+func TestWebPMetadata(t *testing.T) {
+	exif := []byte("II\x2a\x00\x08\x00\x00\x00")
+	// Large enough to span two JPEG segments
+	profile := bytes.Repeat([]byte{0x5a}, jpegMaxSegment)
+	md := metadata{exif: exif, icc: iccSegments(profile)}
+	if len(md.icc) != 2 {
+		t.Fatalf("expected 2 ICC segments, got %d", len(md.icc))
+	}
+
+	for name, opts := range map[string]*WebPOptions{"Lossy": nil, "Lossless": {Lossless: true}} {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := EncodeWebP(&buf, gradientImage(20, 10), opts); err != nil {
+				t.Fatalf("EncodeWebP failed: %v", err)
+			}
+			data := writeWebPMetadata(buf.Bytes(), md)
+			if _, _, err := image.Decode(bytes.NewReader(data)); err != nil {
+				t.Fatalf("failed to decode: %v", err)
+			}
+			got := readMetadata(data)
+			if !bytes.Equal(got.exif, exif) {
+				t.Errorf("expected EXIF %q, got %q", exif, got.exif)
+			}
+			if p := iccProfile(got.icc); !bytes.Equal(p, profile) {
+				t.Errorf("expected %d byte ICC profile, got %d bytes", len(profile), len(p))
+			}
+		})
+	}
+
+	t.Run("Empty", func(t *testing.T) {
+		data := []byte("RIFF\x04\x00\x00\x00WEBP")
+		if got := writeWebPMetadata(data, metadata{}); !bytes.Equal(got, data) {
+			t.Errorf("expected data unchanged, got %q", got)
+		}
+	})
+}
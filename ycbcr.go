@@ -0,0 +1,65 @@
+package rmbg
+
+import (
+	"image"
+	"image/color"
+)
+
+// ycbcrSpan is the number of pixels converted at a time into stack buffers
+const ycbcrSpan = 256
+
+// ycbcrRow writes n pixels of row y of s starting at column x to dst as
+// opaque RGBA. It walks the luma and chroma planes directly instead of
+// computing offsets per pixel, and converts like color.YCbCrToRGB.
+func ycbcrRow(dst []uint8, s *image.YCbCr, x, y, n int) {
+	dst = dst[:n*4]
+	yi := s.YOffset(x, y)
+	ys := s.Y[yi : yi+n]
+
+	var shift uint
+	switch s.SubsampleRatio {
+	case image.YCbCrSubsampleRatio422, image.YCbCrSubsampleRatio420:
+		shift = 1
+	case image.YCbCrSubsampleRatio411, image.YCbCrSubsampleRatio410:
+		shift = 2
+	}
+	if x < 0 || s.Rect.Min.X < 0 {
+		// Chroma offsets round toward zero; keep to COffset for negative columns
+		for i, yy := range ys {
+			ci := s.COffset(x+i, y)
+			dst[i*4+0], dst[i*4+1], dst[i*4+2] = color.YCbCrToRGB(yy, s.Cb[ci], s.Cr[ci])
+			dst[i*4+3] = 255
+		}
+		return
+	}
+
+	ci0 := s.COffset(x, y) - x>>shift
+	for i, yy := range ys {
+		ci := ci0 + (x+i)>>shift
+		yy1 := int32(yy) * 0x10101
+		cb1 := int32(s.Cb[ci]) - 128
+		cr1 := int32(s.Cr[ci]) - 128
+
+		r := yy1 + 91881*cr1
+		if uint32(r)&0xff000000 == 0 {
+			r >>= 16
+		} else {
+			r = ^(r >> 31)
+		}
+		g := yy1 - 22554*cb1 - 46802*cr1
+		if uint32(g)&0xff000000 == 0 {
+			g >>= 16
+		} else {
+			g = ^(g >> 31)
+		}
+		b := yy1 + 116130*cb1
+		if uint32(b)&0xff000000 == 0 {
+			b >>= 16
+		} else {
+			b = ^(b >> 31)
+		}
+
+		d := dst[i*4 : i*4+4 : i*4+4]
+		d[0], d[1], d[2], d[3] = uint8(r), uint8(g), uint8(b), 255
+	}
+}
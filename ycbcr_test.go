@@ -0,0 +1,66 @@
+package rmbg
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestYCbCrRow(t *testing.T) {
+	ratios := []image.YCbCrSubsampleRatio{
+		image.YCbCrSubsampleRatio444,
+		image.YCbCrSubsampleRatio422,
+		image.YCbCrSubsampleRatio420,
+		image.YCbCrSubsampleRatio440,
+		image.YCbCrSubsampleRatio411,
+		image.YCbCrSubsampleRatio410,
+	}
+	// Odd and negative origins shift the chroma phase
+	rects := []image.Rectangle{image.Rect(0, 0, 37, 9), image.Rect(3, 5, 40, 12), image.Rect(-5, -3, 30, 4)}
+
+	for _, ratio := range ratios {
+		for _, r := range rects {
+			t.Run(ratio.String()+r.String(), func(t *testing.T) {
+				img := image.NewYCbCr(r, ratio)
+				for i := range img.Y {
+					img.Y[i] = uint8(i * 7)
+				}
+				for i := range img.Cb {
+					img.Cb[i], img.Cr[i] = uint8(i*11+40), uint8(i*13+90)
+				}
+				dst := make([]uint8, r.Dx()*4)
+				for y := r.Min.Y; y < r.Max.Y; y++ {
+					// A span starting mid-row, as readRowRGB converts them
+					for _, x0 := range []int{r.Min.X, r.Min.X + 3} {
+						n := r.Max.X - x0
+						ycbcrRow(dst, img, x0, y, n)
+						for i := range n {
+							c := img.YCbCrAt(x0+i, y)
+							cr, cg, cb := color.YCbCrToRGB(c.Y, c.Cb, c.Cr)
+							if got, want := [4]uint8(dst[i*4:]), [4]uint8{cr, cg, cb, 255}; got != want {
+								t.Fatalf("at %d,%d: expected %v, got %v", x0+i, y, want, got)
+							}
+						}
+					}
+				}
+			})
+		}
+	}
+
+	t.Run("Conversion", func(t *testing.T) {
+		img := image.NewYCbCr(image.Rect(0, 0, 1, 1), image.YCbCrSubsampleRatio444)
+		dst := make([]uint8, 4)
+		for y := 0; y < 256; y += 3 {
+			for cb := 0; cb < 256; cb += 5 {
+				for cr := 0; cr < 256; cr += 7 {
+					img.Y[0], img.Cb[0], img.Cr[0] = uint8(y), uint8(cb), uint8(cr)
+					ycbcrRow(dst, img, 0, 0, 1)
+					r, g, b := color.YCbCrToRGB(uint8(y), uint8(cb), uint8(cr))
+					if dst[0] != r || dst[1] != g || dst[2] != b {
+						t.Fatalf("for %d,%d,%d: expected %d,%d,%d, got %v", y, cb, cr, r, g, b, dst[:3])
+					}
+				}
+			}
+		}
+	})
+}